@@ -0,0 +1,21 @@
+package account
+
+import (
+	"database/sql"
+
+	"github.com/Bajahaw/ai-ui/cmd/settings"
+
+	logger "github.com/charmbracelet/log"
+)
+
+var log *logger.Logger
+var db *sql.DB
+var profiles ProfileRepository
+var userSettings settings.Repository
+
+func SetupAccount(l *logger.Logger, d *sql.DB) {
+	log = l
+	db = d
+	profiles = NewProfileRepository(db)
+	userSettings = settings.NewRepository(db)
+}
@@ -0,0 +1,511 @@
+package account
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/settings"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+type exportedConversation struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type exportedMessage struct {
+	ID          int       `json:"id"`
+	Role        string    `json:"role"`
+	Model       string    `json:"model,omitempty"`
+	ParentID    int       `json:"parentId,omitempty"`
+	Content     string    `json:"content"`
+	Reasoning   string    `json:"reasoning,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Status      string    `json:"status"`
+	TokenCount  int       `json:"tokenCount,omitempty"`
+	ContextSize int       `json:"contextSize,omitempty"`
+	Attachments []string  `json:"attachments,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type exportedToolCall struct {
+	ID        string `json:"id"`
+	ConvID    string `json:"convId"`
+	MessageID int    `json:"messageId"`
+	Name      string `json:"name"`
+	Args      string `json:"args"`
+	Output    string `json:"output"`
+	FileID    string `json:"fileId,omitempty"`
+}
+
+type exportedProvider struct {
+	ID      string            `json:"id"`
+	BaseURL string            `json:"base_url"`
+	APIKey  string            `json:"api_key"`
+	Headers map[string]string `json:"headers"`
+}
+
+type exportedTemplate struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Content     string    `json:"content"`
+	Shared      bool      `json:"shared"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type exportedMemory struct {
+	ID        int64     `json:"id"`
+	Content   string    `json:"content"`
+	Source    string    `json:"source"`
+	ConvID    string    `json:"convId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type exportedFile struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Size       int64  `json:"size"`
+	Archived   string `json:"archived,omitempty"`
+	CreatedAt  string `json:"createdAt"`
+	UploadedAt string `json:"uploadedAt"`
+}
+
+// exportAccount streams a zip archive with everything stored for the user.
+// Entries are written one by one straight to the response, so only a single
+// conversation or file is held in memory at a time. Times are written in
+// the user's time zone.
+func exportAccount(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	loc := settings.LocalizerFor(settings.NewRepository(db), user).Location
+
+	fileName := "ai-ui-export-" + time.Now().In(loc).Format("20060102-150405") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+
+	steps := []struct {
+		name string
+		run  func(zw *zip.Writer, user string, loc *time.Location) error
+	}{
+		{"conversations", exportConversations},
+		{"tool calls", exportToolCalls},
+		{"settings", exportSettings},
+		{"providers", exportProviders},
+		{"templates", exportTemplates},
+		{"memories", exportMemories},
+		{"files", exportFiles},
+	}
+
+	for _, step := range steps {
+		if err := step.run(zw, user, loc); err != nil {
+			// headers are already sent, the client will get a truncated archive
+			log.Error("Error exporting account data", "step", step.name, "user", user, "err", err)
+			break
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		log.Error("Error finalizing export archive", "err", err)
+	}
+}
+
+func exportConversations(zw *zip.Writer, user string, loc *time.Location) error {
+	rows, err := db.Query(`SELECT id, title, created_at, updated_at FROM Conversations WHERE user = ? ORDER BY created_at`, user)
+	if err != nil {
+		return err
+	}
+
+	var convs []exportedConversation
+	for rows.Next() {
+		var conv exportedConversation
+		if err := rows.Scan(&conv.ID, &conv.Title, &conv.CreatedAt, &conv.UpdatedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		conv.CreatedAt, conv.UpdatedAt = conv.CreatedAt.In(loc), conv.UpdatedAt.In(loc)
+		convs = append(convs, conv)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	index, err := zw.Create("conversations.json")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(index).Encode(convs); err != nil {
+		return err
+	}
+
+	for _, conv := range convs {
+		if err := exportConversation(zw, conv, loc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportConversation(zw *zip.Writer, conv exportedConversation, loc *time.Location) error {
+	entry, err := zw.Create("conversations/" + conv.ID + ".json")
+	if err != nil {
+		return err
+	}
+	return writeConversation(entry, conv, loc)
+}
+
+// ExportConversation writes a conversation and all its messages as JSON,
+// in the form of the account export, whoever it belongs to.
+func ExportConversation(w io.Writer, convID string) error {
+	var conv exportedConversation
+	var user string
+	err := db.QueryRow(`SELECT id, title, created_at, updated_at, user FROM Conversations WHERE id = ?`, convID).
+		Scan(&conv.ID, &conv.Title, &conv.CreatedAt, &conv.UpdatedAt, &user)
+	if err != nil {
+		return err
+	}
+	loc := settings.LocalizerFor(settings.NewRepository(db), user).Location
+	conv.CreatedAt, conv.UpdatedAt = conv.CreatedAt.In(loc), conv.UpdatedAt.In(loc)
+	return writeConversation(w, conv, loc)
+}
+
+func writeConversation(entry io.Writer, conv exportedConversation, loc *time.Location) error {
+	header, _ := json.Marshal(conv)
+	// reopen the conversation object to append the messages array
+	if _, err := io.WriteString(entry, strings.TrimSuffix(string(header), "}")+`,"messages":`); err != nil {
+		return err
+	}
+
+	query := `
+	SELECT m.id, m.role, m.model, m.parent_id, m.content, m.reasoning, m.error, m.status, m.token_count, m.context_size, m.created_at, m.updated_at,
+		COALESCE((SELECT GROUP_CONCAT(a.file_id) FROM Attachments a WHERE a.message_id = m.id), '')
+	FROM Messages m
+	WHERE m.conv_id = ?
+	ORDER BY m.id
+	`
+	rows, err := db.Query(query, conv.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	arr := newJSONArray(entry)
+	for rows.Next() {
+		var msg exportedMessage
+		var attachments string
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.Role,
+			&msg.Model,
+			&msg.ParentID,
+			&msg.Content,
+			&msg.Reasoning,
+			&msg.Error,
+			&msg.Status,
+			&msg.TokenCount,
+			&msg.ContextSize,
+			&msg.CreatedAt,
+			&msg.UpdatedAt,
+			&attachments,
+		); err != nil {
+			return err
+		}
+		msg.CreatedAt, msg.UpdatedAt = msg.CreatedAt.In(loc), msg.UpdatedAt.In(loc)
+		if attachments != "" {
+			msg.Attachments = strings.Split(attachments, ",")
+		}
+		if err := arr.add(msg); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := arr.close(); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(entry, "}\n")
+	return err
+}
+
+func exportToolCalls(zw *zip.Writer, user string, loc *time.Location) error {
+	entry, err := zw.Create("tool_calls.json")
+	if err != nil {
+		return err
+	}
+
+	query := `
+	SELECT tc.id, tc.conv_id, tc.message_id, tc.name, tc.args, COALESCE(tc.output, ''), tc.file_id
+	FROM ToolCalls tc
+	JOIN Conversations c ON tc.conv_id = c.id
+	WHERE c.user = ?
+	ORDER BY tc.message_id
+	`
+	rows, err := db.Query(query, user)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	arr := newJSONArray(entry)
+	for rows.Next() {
+		var tc exportedToolCall
+		var fileID sql.NullString
+		if err := rows.Scan(&tc.ID, &tc.ConvID, &tc.MessageID, &tc.Name, &tc.Args, &tc.Output, &fileID); err != nil {
+			return err
+		}
+		tc.FileID = fileID.String
+		if err := arr.add(tc); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return arr.close()
+}
+
+func exportSettings(zw *zip.Writer, user string, loc *time.Location) error {
+	rows, err := db.Query(`SELECT key, value FROM Settings WHERE user = ?`, user)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return err
+		}
+		settings[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	entry, err := zw.Create("settings.json")
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(entry).Encode(settings)
+}
+
+func exportProviders(zw *zip.Writer, user string, loc *time.Location) error {
+	rows, err := db.Query(`SELECT id, url, api_key, headers_json FROM Providers WHERE user = ?`, user)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	providers := make([]exportedProvider, 0)
+	for rows.Next() {
+		var p exportedProvider
+		var headersJson string
+		if err := rows.Scan(&p.ID, &p.BaseURL, &p.APIKey, &headersJson); err != nil {
+			return err
+		}
+		p.APIKey = maskSecret(p.APIKey)
+		p.Headers = make(map[string]string)
+		_ = json.Unmarshal([]byte(headersJson), &p.Headers)
+		// header values often carry credentials as well
+		for k, v := range p.Headers {
+			p.Headers[k] = maskSecret(v)
+		}
+		providers = append(providers, p)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	entry, err := zw.Create("providers.json")
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(entry).Encode(providers)
+}
+
+func exportTemplates(zw *zip.Writer, user string, loc *time.Location) error {
+	rows, err := db.Query(`SELECT id, name, description, content, shared, created_at, updated_at FROM Templates WHERE user = ?`, user)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	templates := make([]exportedTemplate, 0)
+	for rows.Next() {
+		var t exportedTemplate
+		if err := rows.Scan(&t.ID, &t.Name, &t.Description, &t.Content, &t.Shared, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return err
+		}
+		t.CreatedAt, t.UpdatedAt = t.CreatedAt.In(loc), t.UpdatedAt.In(loc)
+		templates = append(templates, t)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	entry, err := zw.Create("templates.json")
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(entry).Encode(templates)
+}
+
+func exportMemories(zw *zip.Writer, user string, loc *time.Location) error {
+	rows, err := db.Query(`SELECT id, content, source, COALESCE(conv_id, ''), created_at, updated_at FROM Memories WHERE user = ? ORDER BY id`, user)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	memories := make([]exportedMemory, 0)
+	for rows.Next() {
+		var m exportedMemory
+		if err := rows.Scan(&m.ID, &m.Content, &m.Source, &m.ConvID, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return err
+		}
+		m.CreatedAt, m.UpdatedAt = m.CreatedAt.In(loc), m.UpdatedAt.In(loc)
+		memories = append(memories, m)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	entry, err := zw.Create("memories.json")
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(entry).Encode(memories)
+}
+
+func exportFiles(zw *zip.Writer, user string, loc *time.Location) error {
+	rows, err := db.Query(`SELECT id, name, type, size, path, created_at, uploaded_at FROM Files WHERE user = ?`, user)
+	if err != nil {
+		return err
+	}
+
+	type fileRow struct {
+		meta exportedFile
+		path string
+	}
+	var found []fileRow
+	for rows.Next() {
+		var f fileRow
+		if err := rows.Scan(&f.meta.ID, &f.meta.Name, &f.meta.Type, &f.meta.Size, &f.path, &f.meta.CreatedAt, &f.meta.UploadedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		f.meta.CreatedAt, f.meta.UploadedAt = inLocation(f.meta.CreatedAt, loc), inLocation(f.meta.UploadedAt, loc)
+		found = append(found, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	index := make([]exportedFile, 0, len(found))
+	for _, f := range found {
+		archived := "files/" + f.meta.ID + path.Ext(f.path)
+		if err := copyFileToZip(zw, f.path, archived); err != nil {
+			// a missing file on disk should not break the whole export
+			log.Warn("Skipping file in export", "id", f.meta.ID, "err", err)
+		} else {
+			f.meta.Archived = archived
+		}
+		index = append(index, f.meta)
+	}
+
+	entry, err := zw.Create("files.json")
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(entry).Encode(index)
+}
+
+// inLocation moves an RFC 3339 time of a file to loc, leaving values that
+// do not parse as they are.
+func inLocation(value string, loc *time.Location) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
+
+func copyFileToZip(zw *zip.Writer, src, name string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entry, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
+}
+
+// maskSecret keeps the last 4 characters of a secret for recognition.
+func maskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return strings.Repeat("*", 8) + secret[len(secret)-4:]
+}
+
+// jsonArray writes a JSON array element by element to avoid
+// building the full slice in memory.
+type jsonArray struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONArray(w io.Writer) *jsonArray {
+	return &jsonArray{w: w}
+}
+
+func (a *jsonArray) add(v any) error {
+	sep := ","
+	if a.count == 0 {
+		sep = "["
+	}
+	if _, err := io.WriteString(a.w, sep); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	a.count++
+	_, err = a.w.Write(buf)
+	return err
+}
+
+func (a *jsonArray) close() error {
+	if a.count == 0 {
+		_, err := io.WriteString(a.w, "[]")
+		return err
+	}
+	_, err := io.WriteString(a.w, "]")
+	return err
+}
@@ -0,0 +1,204 @@
+package account
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Bajahaw/ai-ui/cmd/audit"
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/settings"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+const maxDisplayNameLength = 64
+
+// Profile is who the user is to the interface, and the preferences that
+// follow them to every device.
+type Profile struct {
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	DisplayName  string `json:"displayName"`
+	AvatarFileID string `json:"avatarFileId,omitempty"`
+	AvatarURL    string `json:"avatarUrl,omitempty"`
+	DefaultModel string `json:"defaultModel"`
+	// Preferences are the settings only the interface reads, such as the
+	// theme and what Enter does
+	Preferences map[string]string `json:"preferences"`
+}
+
+// ProfileUpdate changes the fields that are set.
+type ProfileUpdate struct {
+	DisplayName  *string           `json:"displayName,omitempty"`
+	DefaultModel *string           `json:"defaultModel,omitempty"`
+	Preferences  map[string]string `json:"preferences,omitempty"`
+}
+
+func loadProfile(user string) (*Profile, error) {
+	profile, err := profiles.Get(user)
+	if err != nil {
+		return nil, err
+	}
+	profile.Username = user
+	if profile.Role, err = auth.Role(user); err != nil {
+		return nil, err
+	}
+
+	stored, err := userSettings.GetAll(user)
+	if err != nil {
+		return nil, err
+	}
+	profile.Preferences = make(map[string]string)
+	for _, def := range settings.Registry {
+		if def.Scope != settings.ScopeClient || def.Key == "defaultModel" {
+			continue
+		}
+		value, ok := stored[def.Key]
+		if !ok {
+			value = def.Default
+		}
+		profile.Preferences[def.Key] = value
+	}
+	profile.DefaultModel = stored["defaultModel"]
+	return profile, nil
+}
+
+func getProfile(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	profile, err := loadProfile(user)
+	if err != nil {
+		log.Error("Error loading profile", "user", user, "err", err)
+		utils.Error(w, "Error loading profile", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, profile, http.StatusOK)
+}
+
+func updateProfile(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req ProfileUpdate
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// preferences and the default model are settings, validated as such
+	changes := make(map[string]string, len(req.Preferences)+1)
+	var errs []settings.ValidationError
+	for key, value := range req.Preferences {
+		if def, ok := settings.Lookup(key); ok && (def.Scope != settings.ScopeClient || key == "defaultModel") {
+			errs = append(errs, settings.ValidationError{Key: key, Message: "not a preference"})
+			continue
+		}
+		changes[key] = value
+	}
+	if req.DefaultModel != nil {
+		changes["defaultModel"] = *req.DefaultModel
+	}
+	errs = append(errs, settings.Validate(changes)...)
+
+	var displayName string
+	if req.DisplayName != nil {
+		displayName = strings.TrimSpace(*req.DisplayName)
+		if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+			errs = append(errs, settings.ValidationError{Key: "displayName", Message: "must be at most 64 characters"})
+		}
+	}
+	if len(errs) > 0 {
+		response := settings.ValidationResponse{Error: "Invalid profile", Fields: errs}
+		utils.RespondWithJSON(w, &response, http.StatusBadRequest)
+		return
+	}
+
+	if req.DisplayName != nil {
+		if err := profiles.SaveDisplayName(user, displayName); err != nil {
+			log.Error("Error saving display name", "user", user, "err", err)
+			utils.Error(w, "Error saving profile", http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(changes) > 0 {
+		before := make(map[string]string, len(changes))
+		if current, err := userSettings.GetAll(user); err == nil {
+			for key := range changes {
+				if v, ok := current[key]; ok {
+					before[key] = v
+				}
+			}
+		}
+		if err := userSettings.Save(changes, user); err != nil {
+			log.Error("Error saving preferences", "user", user, "err", err)
+			utils.Error(w, "Error saving profile", http.StatusInternalServerError)
+			return
+		}
+		if diff := audit.Diff(before, changes); len(diff) > 0 {
+			audit.Record(r, user, audit.SettingsUpdate, user, diff)
+		}
+	}
+
+	getProfile(w, r)
+}
+
+// uploadAvatar stores an image with the user's files and shows it as their
+// picture, the previous one is deleted.
+func uploadAvatar(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		utils.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+	file, handler, err := r.FormFile("file")
+	if err != nil {
+		utils.Error(w, "Error retrieving file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, _ := file.Read(head)
+	if !strings.HasPrefix(http.DetectContentType(head[:n]), "image/") {
+		utils.Error(w, "Avatar must be an image", http.StatusBadRequest)
+		return
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		utils.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+
+	stored, err := files.StoreUpload(file, handler, user)
+	if err != nil {
+		log.Error("Error saving avatar", "user", user, "err", err)
+		utils.Error(w, "Error saving file", http.StatusInternalServerError)
+		return
+	}
+	if !setAvatar(w, user, stored.ID) {
+		_ = files.Remove(stored.ID, user)
+		return
+	}
+	getProfile(w, r)
+}
+
+func deleteAvatar(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	if setAvatar(w, user, "") {
+		getProfile(w, r)
+	}
+}
+
+// setAvatar replaces the avatar of the user and deletes the previous file,
+// it reports whether it did or wrote an error.
+func setAvatar(w http.ResponseWriter, user string, fileID string) bool {
+	previous, err := profiles.SetAvatar(user, fileID)
+	if err != nil {
+		log.Error("Error saving avatar", "user", user, "err", err)
+		utils.Error(w, "Error saving profile", http.StatusInternalServerError)
+		return false
+	}
+	if previous != "" && previous != fileID {
+		if err := files.Remove(previous, user); err != nil {
+			log.Warn("Error deleting previous avatar", "user", user, "file", previous, "err", err)
+		}
+	}
+	return true
+}
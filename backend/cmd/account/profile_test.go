@@ -0,0 +1,148 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+	logger "github.com/charmbracelet/log"
+)
+
+func setupTest(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := data.InitDataSource(path.Join("data", "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	t.Cleanup(func() { data.DB.Close() })
+
+	l := logger.New(os.Stderr)
+	SetupAccount(l, data.DB)
+	auth.Setup(l, data.DB)
+	files.SetupFiles(l, data.DB, nil)
+	if _, err := data.DB.Exec("INSERT INTO Users (username, pass_hash) VALUES ('alice', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func serveProfile(t *testing.T, handler http.HandlerFunc, req *http.Request) (*httptest.ResponseRecorder, Profile) {
+	t.Helper()
+	req = req.WithContext(context.WithValue(req.Context(), "user", "alice"))
+	w := httptest.NewRecorder()
+	handler(w, req)
+	var profile Profile
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &profile); err != nil {
+			t.Fatalf("decoding profile: %v", err)
+		}
+	}
+	return w, profile
+}
+
+func TestProfile(t *testing.T) {
+	setupTest(t)
+
+	_, profile := serveProfile(t, getProfile, httptest.NewRequest("GET", "/", nil))
+	if profile.Username != "alice" || profile.DisplayName != "" || profile.Preferences["theme"] != "dark" {
+		t.Fatalf("unexpected initial profile: %+v", profile)
+	}
+
+	body := `{"displayName":"  Alice  ","defaultModel":"p1/m","preferences":{"theme":"light","enterBehavior":"newline"}}`
+	w, profile := serveProfile(t, updateProfile, httptest.NewRequest("PATCH", "/", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if profile.DisplayName != "Alice" || profile.DefaultModel != "p1/m" ||
+		profile.Preferences["theme"] != "light" || profile.Preferences["enterBehavior"] != "newline" {
+		t.Errorf("update not applied: %+v", profile)
+	}
+
+	// only the fields that are set change
+	w, profile = serveProfile(t, updateProfile, httptest.NewRequest("PATCH", "/", strings.NewReader(`{"preferences":{"theme":"dark"}}`)))
+	if w.Code != http.StatusOK || profile.DisplayName != "Alice" || profile.Preferences["theme"] != "dark" {
+		t.Errorf("partial update: %d %+v", w.Code, profile)
+	}
+
+	for _, body := range []string{
+		`{"preferences":{"theme":"blue"}}`,
+		`{"preferences":{"systemPrompt":"hi"}}`,
+		`{"displayName":"` + strings.Repeat("a", 65) + `"}`,
+	} {
+		w, _ := serveProfile(t, updateProfile, httptest.NewRequest("PATCH", "/", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func avatarRequest(t *testing.T, content []byte) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, _ := mw.CreateFormFile("file", "me.png")
+	part.Write(content)
+	mw.Close()
+	req := httptest.NewRequest("PUT", "/avatar", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestAvatar(t *testing.T) {
+	setupTest(t)
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+
+	w, _ := serveProfile(t, uploadAvatar, avatarRequest(t, []byte("not an image")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a text file to be rejected, got %d", w.Code)
+	}
+
+	_, first := serveProfile(t, uploadAvatar, avatarRequest(t, img.Bytes()))
+	if first.AvatarFileID == "" || !strings.HasPrefix(first.AvatarURL, "/data/resources/") {
+		t.Fatalf("avatar not set: %+v", first)
+	}
+
+	_, second := serveProfile(t, uploadAvatar, avatarRequest(t, img.Bytes()))
+	if second.AvatarFileID == first.AvatarFileID {
+		t.Fatal("avatar not replaced")
+	}
+	if _, err := os.Stat(strings.TrimPrefix(first.AvatarURL, "/")); !os.IsNotExist(err) {
+		t.Errorf("previous avatar should be deleted, stat: %v", err)
+	}
+
+	_, cleared := serveProfile(t, deleteAvatar, httptest.NewRequest("DELETE", "/avatar", nil))
+	if cleared.AvatarFileID != "" || cleared.AvatarURL != "" {
+		t.Errorf("avatar not removed: %+v", cleared)
+	}
+}
+
+func TestAvatarThroughMiddleware(t *testing.T) {
+	setupTest(t)
+	utils.Setup(log)
+	handler := utils.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploadAvatar(w, r.WithContext(context.WithValue(r.Context(), "user", "alice")))
+	}))
+
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	req := avatarRequest(t, img.Bytes())
+	req.URL.Path = "/api/account/avatar"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+}
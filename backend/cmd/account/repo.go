@@ -0,0 +1,78 @@
+package account
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+type ProfileRepository interface {
+	// Get returns the display name and avatar of the user
+	Get(user string) (*Profile, error)
+	SaveDisplayName(user string, name string) error
+	// SetAvatar points the profile at another file, or none, and returns
+	// the previous one
+	SetAvatar(user string, fileID string) (string, error)
+}
+
+type ProfileRepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewProfileRepository(db *sql.DB) ProfileRepository {
+	return &ProfileRepositoryImpl{db: db}
+}
+
+// Get returns the stored part of the profile, empty when none was saved yet.
+func (r *ProfileRepositoryImpl) Get(user string) (*Profile, error) {
+	query := `
+		SELECT p.display_name, COALESCE(p.avatar_file_id, ''), COALESCE(f.path, '')
+		FROM Profiles p
+		LEFT JOIN Files f ON f.id = p.avatar_file_id
+		WHERE p.user = ?
+	`
+	var p Profile
+	var avatarPath string
+	err := r.db.QueryRow(query, user).Scan(&p.DisplayName, &p.AvatarFileID, &avatarPath)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &Profile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if avatarPath != "" {
+		p.AvatarURL = "/" + strings.TrimPrefix(avatarPath, "./")
+	}
+	return &p, nil
+}
+
+func (r *ProfileRepositoryImpl) SaveDisplayName(user string, name string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO Profiles (user, display_name, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(user) DO UPDATE SET display_name = excluded.display_name, updated_at = excluded.updated_at
+	`, user, name)
+	return err
+}
+
+func (r *ProfileRepositoryImpl) SetAvatar(user string, fileID string) (string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.QueryRow(`SELECT COALESCE(avatar_file_id, '') FROM Profiles WHERE user = ?`, user).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO Profiles (user, avatar_file_id, updated_at) VALUES (?, NULLIF(?, ''), CURRENT_TIMESTAMP)
+		ON CONFLICT(user) DO UPDATE SET avatar_file_id = excluded.avatar_file_id, updated_at = excluded.updated_at
+	`, user, fileID)
+	if err != nil {
+		return "", err
+	}
+	return previous, tx.Commit()
+}
@@ -0,0 +1,28 @@
+package account
+
+import (
+	"net/http"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
+)
+
+func Handler() http.Handler {
+	mux := openapi.NewRouter("/api/account", "Account")
+
+	mux.HandleFunc("GET /", getProfile, openapi.Op{Summary: "Get the user's profile and preferences", Response: Profile{}})
+	mux.HandleFunc("PATCH /", updateProfile, openapi.Op{
+		Summary:     "Update the user's profile and preferences",
+		Description: "Only the fields that are set change. Preferences are the settings with the client scope.",
+		Request:     ProfileUpdate{},
+		Response:    Profile{},
+	})
+	mux.HandleFunc("PUT /avatar", uploadAvatar, openapi.Op{Summary: "Upload the user's avatar image", Upload: "file", Response: Profile{}})
+	mux.HandleFunc("DELETE /avatar", deleteAvatar, openapi.Op{Summary: "Remove the user's avatar", Response: Profile{}})
+	mux.HandleFunc("GET /export", exportAccount, openapi.Op{
+		Summary:     "Export the account's data as a zip archive",
+		ContentType: "application/zip",
+	})
+
+	return http.StripPrefix("/api/account", auth.Authenticated(mux))
+}
@@ -0,0 +1,64 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/audit"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+type AuditLogResponse struct {
+	Entries []*audit.Entry `json:"entries"`
+	// NextCursor is passed as before to get the next page
+	NextCursor int64 `json:"nextCursor,omitempty"`
+}
+
+func listAuditLog(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := audit.Filter{
+		Actor:  q.Get("actor"),
+		Action: q.Get("action"),
+		Target: q.Get("target"),
+		Limit:  100,
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			utils.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = min(n, 500)
+	}
+	if v := q.Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			utils.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		filter.Before = n
+	}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := q.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				utils.Error(w, "Invalid "+name+", expected an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	entries, err := audit.List(filter)
+	if err != nil {
+		log.Error("Error listing audit log", "err", err)
+		utils.Error(w, "Failed to list audit log", http.StatusInternalServerError)
+		return
+	}
+	response := AuditLogResponse{Entries: entries}
+	if len(entries) == filter.Limit {
+		response.NextCursor = entries[len(entries)-1].ID
+	}
+	utils.RespondWithJSON(w, response, http.StatusOK)
+}
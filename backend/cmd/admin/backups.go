@@ -0,0 +1,304 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+const (
+	backupPrefix = "ai-ui-"
+	backupSuffix = ".db"
+)
+
+type BackupInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type BackupStatus struct {
+	Enabled   bool         `json:"enabled"`
+	Target    string       `json:"target"`
+	Interval  string       `json:"interval,omitempty"`
+	Retention int          `json:"retention"`
+	Running   bool         `json:"running"`
+	LastRun   *time.Time   `json:"lastRun,omitempty"`
+	LastError string       `json:"lastError,omitempty"`
+	NextRun   *time.Time   `json:"nextRun,omitempty"`
+	Backups   []BackupInfo `json:"backups"`
+}
+
+// backupStore is a destination for database snapshots.
+type backupStore interface {
+	Put(name string, localPath string) error
+	List() ([]BackupInfo, error)
+	Delete(name string) error
+	String() string
+}
+
+type backupManager struct {
+	interval  time.Duration
+	retention int
+	stageDir  string
+	store     backupStore
+
+	mu        sync.Mutex
+	running   bool
+	lastRun   *time.Time
+	lastError string
+	nextRun   *time.Time
+}
+
+var backups *backupManager
+
+// setupBackups reads the backup configuration from the environment:
+// BACKUP_INTERVAL (e.g. "24h", empty disables the schedule), BACKUP_RETENTION,
+// BACKUP_DIR and the optional BACKUP_S3_* variables for bucket uploads.
+func setupBackups() {
+	dir := os.Getenv("BACKUP_DIR")
+	if dir == "" {
+		dir = "./data/backups"
+	}
+
+	retention := 7
+	if v := os.Getenv("BACKUP_RETENTION"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			retention = n
+		} else {
+			log.Warn("Invalid BACKUP_RETENTION, using default", "value", v, "default", retention)
+		}
+	}
+
+	var store backupStore = &dirStore{dir: dir}
+	if bucket := os.Getenv("BACKUP_S3_BUCKET"); bucket != "" {
+		store = newS3Store(bucket)
+	}
+
+	backups = &backupManager{
+		retention: retention,
+		stageDir:  dir,
+		store:     store,
+	}
+
+	if v := os.Getenv("BACKUP_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval < time.Minute {
+			log.Error("Invalid BACKUP_INTERVAL, periodic backups disabled", "value", v)
+			return
+		}
+		backups.interval = interval
+		go backups.schedule()
+		log.Info("Periodic backups enabled", "interval", interval, "target", store, "retention", retention)
+	}
+}
+
+func (m *backupManager) schedule() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	m.setNextRun(time.Now().Add(m.interval))
+	for range ticker.C {
+		if _, err := m.run(); err != nil {
+			log.Error("Scheduled backup failed", "err", err)
+		}
+		m.setNextRun(time.Now().Add(m.interval))
+	}
+}
+
+func (m *backupManager) setNextRun(t time.Time) {
+	m.mu.Lock()
+	m.nextRun = &t
+	m.mu.Unlock()
+}
+
+// RunBackup writes a new snapshot and prunes old ones.
+func RunBackup() (BackupInfo, error) {
+	if backups == nil {
+		return BackupInfo{}, fmt.Errorf("backups are not configured")
+	}
+	return backups.run()
+}
+
+func (m *backupManager) run() (BackupInfo, error) {
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return BackupInfo{}, fmt.Errorf("a backup is already in progress")
+	}
+	m.running = true
+	m.mu.Unlock()
+
+	info, err := m.snapshot()
+
+	now := time.Now()
+	m.mu.Lock()
+	m.running = false
+	m.lastRun = &now
+	m.lastError = ""
+	if err != nil {
+		m.lastError = err.Error()
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		return info, err
+	}
+
+	if err := m.prune(); err != nil {
+		log.Error("Error pruning old backups", "err", err)
+	}
+
+	log.Info("Database backup written", "name", info.Name, "size", info.Size, "target", m.store)
+	return info, nil
+}
+
+func (m *backupManager) snapshot() (BackupInfo, error) {
+	if err := os.MkdirAll(m.stageDir, 0o755); err != nil {
+		return BackupInfo{}, err
+	}
+
+	now := time.Now().UTC()
+	name := backupPrefix + now.Format("20060102-150405") + backupSuffix
+	staged := filepath.Join(m.stageDir, name+".tmp")
+	_ = os.Remove(staged)
+
+	// VACUUM INTO produces a consistent, compacted copy without blocking writers for long
+	if _, err := db.Exec(`VACUUM INTO ?`, staged); err != nil {
+		return BackupInfo{}, fmt.Errorf("error creating snapshot: %w", err)
+	}
+	defer os.Remove(staged)
+
+	stat, err := os.Stat(staged)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+
+	if err := m.store.Put(name, staged); err != nil {
+		return BackupInfo{}, fmt.Errorf("error storing snapshot: %w", err)
+	}
+
+	return BackupInfo{Name: name, Size: stat.Size(), CreatedAt: now}, nil
+}
+
+func (m *backupManager) prune() error {
+	list, err := m.store.List()
+	if err != nil {
+		return err
+	}
+	if len(list) <= m.retention {
+		return nil
+	}
+
+	// names embed the timestamp, so lexical order is chronological
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	for _, b := range list[:len(list)-m.retention] {
+		if err := m.store.Delete(b.Name); err != nil {
+			return err
+		}
+		log.Debug("Pruned old backup", "name", b.Name)
+	}
+	return nil
+}
+
+func (m *backupManager) status() BackupStatus {
+	m.mu.Lock()
+	status := BackupStatus{
+		Enabled:   m.interval > 0,
+		Target:    m.store.String(),
+		Retention: m.retention,
+		Running:   m.running,
+		LastRun:   m.lastRun,
+		LastError: m.lastError,
+		NextRun:   m.nextRun,
+		Backups:   []BackupInfo{},
+	}
+	if m.interval > 0 {
+		status.Interval = m.interval.String()
+	}
+	m.mu.Unlock()
+
+	list, err := m.store.List()
+	if err != nil {
+		log.Error("Error listing backups", "err", err)
+		if status.LastError == "" {
+			status.LastError = err.Error()
+		}
+		return status
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name > list[j].Name })
+	status.Backups = list
+	return status
+}
+
+func getBackupStatus(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, backups.status(), http.StatusOK)
+}
+
+func runBackupNow(w http.ResponseWriter, r *http.Request) {
+	info, err := backups.run()
+	if err != nil {
+		log.Error("Manual backup failed", "err", err)
+		utils.Error(w, "Backup failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, info, http.StatusCreated)
+}
+
+// dirStore keeps backups in a local directory.
+type dirStore struct {
+	dir string
+}
+
+func (s *dirStore) Put(name string, localPath string) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	return os.Rename(localPath, filepath.Join(s.dir, name))
+}
+
+func (s *dirStore) List() ([]BackupInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return []BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]BackupInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !isBackupName(e.Name()) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, BackupInfo{Name: e.Name(), Size: fi.Size(), CreatedAt: fi.ModTime().UTC()})
+	}
+	return list, nil
+}
+
+func (s *dirStore) Delete(name string) error {
+	if !isBackupName(name) {
+		return fmt.Errorf("invalid backup name: %s", name)
+	}
+	return os.Remove(filepath.Join(s.dir, name))
+}
+
+func (s *dirStore) String() string {
+	return "dir:" + s.dir
+}
+
+func isBackupName(name string) bool {
+	return strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) && !strings.ContainsAny(name, `/\`)
+}
@@ -0,0 +1,108 @@
+package admin
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	logger "github.com/charmbracelet/log"
+)
+
+func setupTestBackups(t *testing.T, retention int) (*backupManager, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	if err := data.InitDataSource(path.Join(tmpDir, "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db = data.DB
+	log = logger.New(os.Stderr)
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	dir := path.Join(tmpDir, "backups")
+	return &backupManager{
+		retention: retention,
+		stageDir:  dir,
+		store:     &dirStore{dir: dir},
+	}, dir
+}
+
+func TestBackupRunWritesSnapshot(t *testing.T) {
+	m, dir := setupTestBackups(t, 3)
+
+	info, err := m.run()
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if !isBackupName(info.Name) || info.Size == 0 {
+		t.Fatalf("unexpected backup info: %+v", info)
+	}
+	if _, err := os.Stat(path.Join(dir, info.Name)); err != nil {
+		t.Fatalf("backup file missing: %v", err)
+	}
+	if _, err := os.Stat(path.Join(dir, info.Name+".tmp")); !os.IsNotExist(err) {
+		t.Errorf("staged file was not cleaned up")
+	}
+
+	status := m.status()
+	if len(status.Backups) != 1 || status.LastRun == nil || status.LastError != "" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestBackupPruneKeepsNewest(t *testing.T) {
+	m, dir := setupTestBackups(t, 2)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{
+		"ai-ui-20240101-000000.db",
+		"ai-ui-20240102-000000.db",
+		"ai-ui-20240103-000000.db",
+		"ai-ui-20240104-000000.db",
+		"unrelated.db",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(path.Join(dir, name), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.prune(); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	want := []string{"ai-ui-20240103-000000.db", "ai-ui-20240104-000000.db", "unrelated.db"}
+	if len(left) != len(want) {
+		t.Fatalf("got %v, want %v", left, want)
+	}
+	for i := range want {
+		if left[i] != want[i] {
+			t.Errorf("got %v, want %v", left, want)
+			break
+		}
+	}
+}
+
+func TestAwsEscape(t *testing.T) {
+	cases := map[string]string{
+		"ai-ui-1.db": "ai-ui-1.db",
+		"a b":        "a%20b",
+		"a/b+c":      "a%2Fb%2Bc",
+		"~x_":        "~x_",
+	}
+	for in, want := range cases {
+		if got := awsEscape(in); got != want {
+			t.Errorf("awsEscape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
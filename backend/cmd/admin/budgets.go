@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/Bajahaw/ai-ui/cmd/audit"
+	"github.com/Bajahaw/ai-ui/cmd/usage"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+type BudgetsResponse struct {
+	Budgets []*usage.Budget `json:"budgets"`
+}
+
+// BudgetRequest sets the monthly limits of a user, 0 is no limit.
+type BudgetRequest struct {
+	MonthlyTokens int64   `json:"monthlyTokens"`
+	MonthlyCost   float64 `json:"monthlyCost"`
+}
+
+func listBudgets(w http.ResponseWriter, r *http.Request) {
+	budgets, err := usage.Budgets()
+	if err != nil {
+		log.Error("Error querying budgets", "err", err)
+		utils.Error(w, "Error querying budgets", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, BudgetsResponse{Budgets: budgets}, http.StatusOK)
+}
+
+func setBudget(w http.ResponseWriter, r *http.Request) {
+	var req BudgetRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil || req.MonthlyTokens < 0 || req.MonthlyCost < 0 {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	budget := &usage.Budget{User: r.PathValue("user"), MonthlyTokens: req.MonthlyTokens, MonthlyCost: req.MonthlyCost}
+	err := usage.SetBudget(budget)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error saving budget", "err", err)
+		utils.Error(w, "Error saving budget", http.StatusInternalServerError)
+		return
+	}
+	admin := utils.ExtractContextUser(r)
+	log.Info("Usage budget set", "admin", admin, "user", budget.User)
+	audit.Record(r, admin, audit.BudgetSet, budget.User, req)
+	utils.RespondWithJSON(w, budget, http.StatusOK)
+}
+
+func deleteBudget(w http.ResponseWriter, r *http.Request) {
+	if err := usage.DeleteBudget(r.PathValue("user")); err != nil {
+		log.Error("Error deleting budget", "err", err)
+		utils.Error(w, "Error deleting budget", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, utils.ExtractContextUser(r), audit.BudgetDelete, r.PathValue("user"), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,16 @@
+package admin
+
+import (
+	"database/sql"
+
+	logger "github.com/charmbracelet/log"
+)
+
+var log *logger.Logger
+var db *sql.DB
+
+func SetupAdmin(l *logger.Logger, d *sql.DB) {
+	log = l
+	db = d
+	setupBackups()
+}
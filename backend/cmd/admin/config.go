@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/Bajahaw/ai-ui/cmd/audit"
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+type ConfigResponse struct {
+	Options []config.Entry `json:"options"`
+}
+
+// ConfigUpdate maps option keys to new values, null resets an option
+// to its environment variable or default.
+type ConfigUpdate struct {
+	Values map[string]*string `json:"values"`
+}
+
+type ConfigValidationResponse struct {
+	Error  string                   `json:"error"`
+	Fields []config.ValidationError `json:"fields"`
+}
+
+func getConfig(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, ConfigResponse{Options: config.Entries()}, http.StatusOK)
+}
+
+func updateConfig(w http.ResponseWriter, r *http.Request) {
+	var request ConfigUpdate
+	if err := utils.ExtractJSONBody(r, &request); err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	before := configValues(request.Values)
+	errs, err := config.Update(request.Values)
+	if len(errs) > 0 {
+		response := ConfigValidationResponse{Error: "Invalid config", Fields: errs}
+		utils.RespondWithJSON(w, &response, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error("Error updating admin config", "err", err)
+		utils.Error(w, "Error updating config", http.StatusInternalServerError)
+		return
+	}
+	user := utils.ExtractContextUser(r)
+	log.Info("Admin config updated", "user", user, "keys", len(request.Values))
+	audit.Record(r, user, audit.ConfigUpdate, "", audit.Diff(before, configValues(request.Values)))
+
+	utils.RespondWithJSON(w, ConfigResponse{Options: config.Entries()}, http.StatusOK)
+}
+
+// configValues returns the current values of the options being updated.
+func configValues(keys map[string]*string) map[string]string {
+	values := make(map[string]string, len(keys))
+	for _, entry := range config.Entries() {
+		if _, ok := keys[entry.Key]; ok {
+			values[entry.Key] = entry.Value
+		}
+	}
+	return values
+}
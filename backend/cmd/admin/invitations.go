@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/audit"
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+type InvitationsResponse struct {
+	// Registration is who may sign up, invitations are only needed with
+	// invite
+	Registration string             `json:"registration"`
+	Invitations  []*auth.Invitation `json:"invitations"`
+}
+
+// InvitationRequest creates an invitation, it expires after 7 days by
+// default and at most 90.
+type InvitationRequest struct {
+	Note          string `json:"note"`
+	ExpiresInDays int    `json:"expiresInDays"`
+}
+
+func listInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := auth.Invitations()
+	if err != nil {
+		log.Error("Error querying invitations", "err", err)
+		utils.Error(w, "Error querying invitations", http.StatusInternalServerError)
+		return
+	}
+	response := InvitationsResponse{Registration: auth.RegistrationMode(), Invitations: invitations}
+	utils.RespondWithJSON(w, response, http.StatusOK)
+}
+
+func createInvitation(w http.ResponseWriter, r *http.Request) {
+	var req InvitationRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = auth.DefaultInvitationDays
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if req.ExpiresInDays < 1 || req.ExpiresInDays > auth.MaxInvitationDays || len(req.Note) > 200 {
+		utils.Error(w, "Invitations expire after 1 to 90 days, notes are at most 200 bytes", http.StatusBadRequest)
+		return
+	}
+
+	admin := utils.ExtractContextUser(r)
+	invitation, err := auth.CreateInvitation(admin, req.Note, req.ExpiresInDays)
+	if err != nil {
+		log.Error("Error creating invitation", "err", err)
+		utils.Error(w, "Error creating invitation", http.StatusInternalServerError)
+		return
+	}
+	log.Info("Invitation created", "admin", admin, "id", invitation.ID)
+	audit.Record(r, admin, audit.InvitationCreate, strconv.FormatInt(invitation.ID, 10), req)
+	utils.RespondWithJSON(w, invitation, http.StatusCreated)
+}
+
+func deleteInvitation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.Error(w, "Invalid invitation id", http.StatusBadRequest)
+		return
+	}
+	err = auth.DeleteInvitation(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error deleting invitation", "err", err)
+		utils.Error(w, "Error deleting invitation", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, utils.ExtractContextUser(r), audit.InvitationDelete, r.PathValue("id"), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/Bajahaw/ai-ui/cmd/audit"
+	"github.com/Bajahaw/ai-ui/cmd/usage"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+type QuotasResponse struct {
+	Quotas []*usage.Quota `json:"quotas"`
+}
+
+// QuotaRequest sets the token caps of every user of a shared provider,
+// 0 is no cap.
+type QuotaRequest struct {
+	DailyTokens   int64 `json:"dailyTokens"`
+	MonthlyTokens int64 `json:"monthlyTokens"`
+}
+
+func listQuotas(w http.ResponseWriter, r *http.Request) {
+	quotas, err := usage.Quotas()
+	if err != nil {
+		log.Error("Error querying quotas", "err", err)
+		utils.Error(w, "Error querying quotas", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, QuotasResponse{Quotas: quotas}, http.StatusOK)
+}
+
+func setQuota(w http.ResponseWriter, r *http.Request) {
+	var req QuotaRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil || req.DailyTokens < 0 || req.MonthlyTokens < 0 {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	quota := &usage.Quota{ProviderID: r.PathValue("provider"), DailyTokens: req.DailyTokens, MonthlyTokens: req.MonthlyTokens}
+	err := usage.SetQuota(quota)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Provider not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error saving quota", "err", err)
+		utils.Error(w, "Error saving quota", http.StatusInternalServerError)
+		return
+	}
+	admin := utils.ExtractContextUser(r)
+	log.Info("Provider quota set", "admin", admin, "provider", quota.ProviderID)
+	audit.Record(r, admin, audit.QuotaSet, quota.ProviderID, req)
+	utils.RespondWithJSON(w, quota, http.StatusOK)
+}
+
+func deleteQuota(w http.ResponseWriter, r *http.Request) {
+	if err := usage.DeleteQuota(r.PathValue("provider")); err != nil {
+		log.Error("Error deleting quota", "err", err)
+		utils.Error(w, "Error deleting quota", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, utils.ExtractContextUser(r), audit.QuotaDelete, r.PathValue("provider"), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+type RequestLogsResponse struct {
+	// Logs are listed without their headers and bodies
+	Logs []*providers.RequestLog `json:"logs"`
+	// NextCursor is passed as before to get the next page
+	NextCursor int64 `json:"nextCursor,omitempty"`
+}
+
+func listRequestLogs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			utils.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, 200)
+	}
+	var before int64
+	if v := q.Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			utils.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		before = n
+	}
+
+	logs, err := providers.RequestLogs(q.Get("user"), q.Get("provider"), before, limit)
+	if err != nil {
+		log.Error("Error listing request logs", "err", err)
+		utils.Error(w, "Failed to list request logs", http.StatusInternalServerError)
+		return
+	}
+	response := RequestLogsResponse{Logs: logs}
+	if len(logs) == limit {
+		response.NextCursor = logs[len(logs)-1].ID
+	}
+	utils.RespondWithJSON(w, response, http.StatusOK)
+}
+
+func getRequestLog(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.Error(w, "Invalid request log ID", http.StatusBadRequest)
+		return
+	}
+	entry, err := providers.GetRequestLog(id)
+	if err != nil {
+		utils.Error(w, "Request log not found", http.StatusNotFound)
+		return
+	}
+	utils.RespondWithJSON(w, entry, http.StatusOK)
+}
+
+func clearRequestLogs(w http.ResponseWriter, r *http.Request) {
+	if err := providers.DeleteRequestLogs(); err != nil {
+		log.Error("Error deleting request logs", "err", err)
+		utils.Error(w, "Failed to delete request logs", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
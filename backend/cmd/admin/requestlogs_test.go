@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	logger "github.com/charmbracelet/log"
+)
+
+func TestRequestLogs(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db = data.DB
+	log = logger.New(os.Stderr)
+	t.Cleanup(func() { db.Close() })
+	providers.SetupProviderClient(log, db)
+
+	insert := "INSERT INTO RequestLogs (user, provider_id, method, url, status, request_body, created_at) VALUES (?, ?, 'POST', 'https://api.example.com', 200, 'body', CURRENT_TIMESTAMP)"
+	for _, owner := range []string{"a", "b", "a"} {
+		if _, err := db.Exec(insert, owner, "p1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	listRequestLogs(rr, httptest.NewRequest(http.MethodGet, "/request-logs?user=a&limit=1", nil))
+	var page RequestLogsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("list: %d %s", rr.Code, rr.Body)
+	}
+	if len(page.Logs) != 1 || page.Logs[0].User != "a" || page.NextCursor != page.Logs[0].ID {
+		t.Errorf("unexpected page %+v", page)
+	}
+
+	rr = httptest.NewRecorder()
+	clearRequestLogs(rr, httptest.NewRequest(http.MethodDelete, "/request-logs", nil))
+	if logs, _ := providers.RequestLogs("", "", 0, 10); rr.Code != http.StatusNoContent || len(logs) != 0 {
+		t.Errorf("expected the logs to be deleted, got %d and %d logs", rr.Code, len(logs))
+	}
+}
@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/usage"
+)
+
+func Handler() http.Handler {
+	mux := openapi.NewRouter("/api/admin", "Admin")
+
+	mux.HandleFunc("GET /audit", listAuditLog, openapi.Op{
+		Summary:  "List logins and administrative changes, newest first",
+		Response: AuditLogResponse{},
+		Query: []openapi.Param{
+			{Name: "actor", Description: "Only actions of this user"},
+			{Name: "action", Description: "Only this action, or every action of a group such as provider."},
+			{Name: "target", Description: "Only actions on this user, provider or server"},
+			{Name: "since", Description: "Only actions at or after this RFC 3339 time"},
+			{Name: "until", Description: "Only actions before this RFC 3339 time"},
+			{Name: "limit", Description: "Entries per page, 100 by default, at most 500"},
+			{Name: "before", Description: "Only entries older than this cursor"},
+		},
+	})
+	mux.HandleFunc("GET /backups", getBackupStatus, openapi.Op{Summary: "Get the backup status and list backups", Response: BackupStatus{}})
+	mux.HandleFunc("POST /backups/run", runBackupNow, openapi.Op{Summary: "Run a backup now", Response: BackupInfo{}, Status: http.StatusCreated})
+	mux.HandleFunc("GET /config", getConfig, openapi.Op{Summary: "List the instance options", Response: ConfigResponse{}})
+	mux.HandleFunc("PUT /config", updateConfig, openapi.Op{Summary: "Change instance options", Request: ConfigUpdate{}, Response: ConfigResponse{}})
+	mux.HandleFunc("GET /stats", getStats, openapi.Op{
+		Summary:  "Get an overview of users, activity, providers and storage",
+		Query:    []openapi.Param{{Name: "days", Description: "Days of activity to count, 30 by default, at most 365"}},
+		Response: Stats{},
+	})
+	mux.HandleFunc("GET /budgets", listBudgets, openapi.Op{Summary: "List the usage budgets of users", Response: BudgetsResponse{}})
+	mux.HandleFunc("PUT /budgets/{user}", setBudget, openapi.Op{Summary: "Set the monthly usage budget of a user", Request: BudgetRequest{}, Response: usage.Budget{}})
+	mux.HandleFunc("DELETE /budgets/{user}", deleteBudget, openapi.Op{Summary: "Remove the usage budget of a user", Status: http.StatusNoContent})
+	mux.HandleFunc("GET /quotas", listQuotas, openapi.Op{Summary: "List the token quotas of shared providers", Response: QuotasResponse{}})
+	mux.HandleFunc("PUT /quotas/{provider}", setQuota, openapi.Op{
+		Summary:     "Set the daily and monthly token quota of a shared provider",
+		Description: "The quota applies to each user of the provider other than its owner.",
+		Request:     QuotaRequest{},
+		Response:    usage.Quota{},
+	})
+	mux.HandleFunc("DELETE /quotas/{provider}", deleteQuota, openapi.Op{Summary: "Remove the quota of a provider", Status: http.StatusNoContent})
+	mux.HandleFunc("GET /invitations", listInvitations, openapi.Op{Summary: "List the invitations to sign up, newest first", Response: InvitationsResponse{}})
+	mux.HandleFunc("POST /invitations", createInvitation, openapi.Op{
+		Summary:     "Create a single-use invitation code",
+		Description: "The code is only returned here.",
+		Request:     InvitationRequest{},
+		Response:    auth.Invitation{},
+		Status:      http.StatusCreated,
+	})
+	mux.HandleFunc("DELETE /invitations/{id}", deleteInvitation, openapi.Op{Summary: "Revoke an invitation", Status: http.StatusNoContent})
+	mux.HandleFunc("GET /usage", getUsage, openapi.Op{
+		Summary: "Get the usage of all users per day and model",
+		Query: []openapi.Param{
+			{Name: "user", Description: "Only this user"},
+			{Name: "model", Description: "Only this model"},
+			{Name: "from", Description: "First day (YYYY-MM-DD), 30 days before to by default"},
+			{Name: "to", Description: "Last day (YYYY-MM-DD), today (UTC) by default"},
+		},
+		Response: usage.DailyUsageResponse{},
+	})
+	mux.HandleFunc("GET /request-logs", listRequestLogs, openapi.Op{
+		Summary:  "List logged provider requests, newest first",
+		Response: RequestLogsResponse{},
+		Query: []openapi.Param{
+			{Name: "user", Description: "Only requests of this user"},
+			{Name: "provider", Description: "Only requests to this provider"},
+			{Name: "limit", Description: "Logs per page, at most 200"},
+			{Name: "before", Description: "Only logs older than this cursor"},
+		},
+	})
+	mux.HandleFunc("GET /request-logs/{id}", getRequestLog, openapi.Op{Summary: "Get a logged provider request with its payloads", Response: providers.RequestLog{}})
+	mux.HandleFunc("DELETE /request-logs", clearRequestLogs, openapi.Op{Summary: "Delete every logged provider request", Status: http.StatusNoContent})
+
+	return http.StripPrefix("/api/admin", auth.Authenticated(auth.Admin(mux)))
+}
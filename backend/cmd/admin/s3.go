@@ -0,0 +1,262 @@
+package admin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3Store uploads backups to an S3 compatible bucket using path-style
+// requests signed with AWS signature v4. Configured via BACKUP_S3_BUCKET,
+// BACKUP_S3_ENDPOINT, BACKUP_S3_REGION, BACKUP_S3_ACCESS_KEY,
+// BACKUP_S3_SECRET_KEY and BACKUP_S3_PREFIX.
+type s3Store struct {
+	endpoint  string
+	region    string
+	bucket    string
+	prefix    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func newS3Store(bucket string) *s3Store {
+	region := os.Getenv("BACKUP_S3_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := os.Getenv("BACKUP_S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	prefix := strings.Trim(os.Getenv("BACKUP_S3_PREFIX"), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &s3Store{
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		region:    region,
+		bucket:    bucket,
+		prefix:    prefix,
+		accessKey: os.Getenv("BACKUP_S3_ACCESS_KEY"),
+		secretKey: os.Getenv("BACKUP_S3_SECRET_KEY"),
+		client:    &http.Client{Timeout: 30 * time.Minute},
+	}
+}
+
+func (s *s3Store) Put(name string, localPath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(http.MethodPut, s.prefix+name, nil, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = stat.Size()
+	req.Header.Set("Content-Type", "application/vnd.sqlite3")
+
+	_, err = s.do(req)
+	return err
+}
+
+func (s *s3Store) List() ([]BackupInfo, error) {
+	query := url.Values{}
+	query.Set("list-type", "2")
+	query.Set("prefix", s.prefix+backupPrefix)
+
+	list := make([]BackupInfo, 0)
+	for {
+		req, err := s.newRequest(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		body, err := s.do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+			Contents              []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+		}
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
+
+		for _, obj := range result.Contents {
+			name := strings.TrimPrefix(obj.Key, s.prefix)
+			if !isBackupName(name) {
+				continue
+			}
+			list = append(list, BackupInfo{Name: name, Size: obj.Size, CreatedAt: obj.LastModified})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return list, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (s *s3Store) Delete(name string) error {
+	if !isBackupName(name) {
+		return fmt.Errorf("invalid backup name: %s", name)
+	}
+	req, err := s.newRequest(http.MethodDelete, s.prefix+name, nil, nil)
+	if err != nil {
+		return err
+	}
+	_, err = s.do(req)
+	return err
+}
+
+func (s *s3Store) String() string {
+	return "s3:" + s.bucket + "/" + s.prefix
+}
+
+func (s *s3Store) do(req *http.Request) ([]byte, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("s3 %s %s: %s %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+func (s *s3Store) newRequest(method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	path := "/" + s.bucket
+	if key != "" {
+		path += "/" + key
+	}
+
+	rawURL := s.endpoint + awsEscapePath(path)
+	canonicalQuery := awsCanonicalQuery(query)
+	if canonicalQuery != "" {
+		rawURL += "?" + canonicalQuery
+	}
+
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, awsEscapePath(path), canonicalQuery)
+	return req, nil
+}
+
+// sign adds an AWS signature v4 Authorization header. The payload is not
+// hashed (UNSIGNED-PAYLOAD) so large snapshots can be streamed from disk.
+func (s *s3Store) sign(req *http.Request, canonicalURI, canonicalQuery string) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := "UNSIGNED-PAYLOAD"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscape percent-encodes everything except the RFC 3986 unreserved characters.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func awsEscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = awsEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+func awsCanonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,166 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/chat"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 365
+)
+
+// Stats is an overview of the instance. Activity counts cover the days
+// (server time) since Since.
+type Stats struct {
+	Since          string          `json:"since"`
+	Users          int64           `json:"users"`
+	ActiveUsers    int64           `json:"activeUsers"`
+	Conversations  int64           `json:"conversations"`
+	Messages       int64           `json:"messages"`
+	MessagesPerDay []DayCount      `json:"messagesPerDay"`
+	ActiveStreams  int             `json:"activeStreams"`
+	Providers      []ProviderStats `json:"providers"`
+	Storage        StorageStats    `json:"storage"`
+}
+
+type DayCount struct {
+	Day   string `json:"day"`
+	Count int64  `json:"count"`
+}
+
+// ProviderStats counts the responses of the models of a provider and how
+// many of them failed. URL is empty once the provider is deleted.
+type ProviderStats struct {
+	ProviderID string  `json:"providerId"`
+	URL        string  `json:"url,omitempty"`
+	Responses  int64   `json:"responses"`
+	Errors     int64   `json:"errors"`
+	ErrorRate  float64 `json:"errorRate"`
+}
+
+type StorageStats struct {
+	DatabaseBytes int64 `json:"databaseBytes"`
+	Files         int64 `json:"files"`
+	FileBytes     int64 `json:"fileBytes"`
+}
+
+func getStats(w http.ResponseWriter, r *http.Request) {
+	days := defaultStatsDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxStatsDays {
+			utils.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	stats, err := collectStats(time.Now().AddDate(0, 0, -(days - 1)))
+	if err != nil {
+		log.Error("Error collecting stats", "err", err)
+		utils.Error(w, "Error collecting stats", http.StatusInternalServerError)
+		return
+	}
+	stats.ActiveStreams = chat.RunningGenerations()
+	utils.RespondWithJSON(w, stats, http.StatusOK)
+}
+
+func collectStats(start time.Time) (*Stats, error) {
+	since := start.Format(time.DateOnly)
+	stats := &Stats{Since: since}
+
+	// the first 10 characters of created_at are the day it was saved on
+	err := db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM Users),
+			(SELECT COUNT(DISTINCT c.user) FROM Messages m JOIN Conversations c ON c.id = m.conv_id
+				WHERE m.role = 'user' AND substr(m.created_at, 1, 10) >= ?),
+			(SELECT COUNT(*) FROM Conversations),
+			(SELECT COUNT(*) FROM Messages),
+			(SELECT COUNT(*) FROM Files),
+			(SELECT COALESCE(SUM(size), 0) FROM Files),
+			(SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size())
+	`, since).Scan(&stats.Users, &stats.ActiveUsers, &stats.Conversations, &stats.Messages,
+		&stats.Storage.Files, &stats.Storage.FileBytes, &stats.Storage.DatabaseBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if stats.MessagesPerDay, err = messagesPerDay(start); err != nil {
+		return nil, err
+	}
+	if stats.Providers, err = providerStats(since); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// messagesPerDay counts the messages of every day since start, days
+// without messages included.
+func messagesPerDay(start time.Time) ([]DayCount, error) {
+	rows, err := db.Query(`
+		SELECT substr(created_at, 1, 10) AS day, COUNT(*) FROM Messages
+		WHERE substr(created_at, 1, 10) >= ? GROUP BY day
+	`, start.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var day string
+		var n int64
+		if err := rows.Scan(&day, &n); err != nil {
+			return nil, err
+		}
+		counts[day] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	days := make([]DayCount, 0)
+	today := time.Now().Format(time.DateOnly)
+	for d := start; d.Format(time.DateOnly) <= today; d = d.AddDate(0, 0, 1) {
+		day := d.Format(time.DateOnly)
+		days = append(days, DayCount{Day: day, Count: counts[day]})
+	}
+	return days, nil
+}
+
+// providerStats counts the responses per provider, taken from the model
+// ids ("provider/model") of assistant messages.
+func providerStats(since string) ([]ProviderStats, error) {
+	rows, err := db.Query(`
+		SELECT s.provider, COALESCE(p.url, ''), s.responses, s.errors FROM (
+			SELECT substr(model, 1, instr(model, '/') - 1) AS provider,
+				COUNT(*) AS responses,
+				SUM(CASE WHEN error != '' THEN 1 ELSE 0 END) AS errors
+			FROM Messages
+			WHERE role = 'assistant' AND instr(model, '/') > 0 AND substr(created_at, 1, 10) >= ?
+			GROUP BY provider
+		) s LEFT JOIN Providers p ON p.id = s.provider
+		ORDER BY s.responses DESC, s.provider
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	providers := make([]ProviderStats, 0)
+	for rows.Next() {
+		var p ProviderStats
+		if err := rows.Scan(&p.ProviderID, &p.URL, &p.Responses, &p.Errors); err != nil {
+			return nil, err
+		}
+		p.ErrorRate = float64(p.Errors) / float64(p.Responses)
+		providers = append(providers, p)
+	}
+	return providers, rows.Err()
+}
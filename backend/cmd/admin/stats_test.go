@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	logger "github.com/charmbracelet/log"
+)
+
+func TestCollectStats(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db = data.DB
+	log = logger.New(os.Stderr)
+	t.Cleanup(func() { db.Close() })
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -60)
+	for _, stmt := range []string{
+		"INSERT INTO Users (username, pass_hash) VALUES ('a', 'hash'), ('b', 'hash'), ('c', 'hash')",
+		"INSERT INTO Providers (id, url, api_key, user) VALUES ('p1', 'https://api.example.com', 'key', 'a')",
+		"INSERT INTO Conversations (id, user) VALUES ('c1', 'a'), ('c2', 'b')",
+		"INSERT INTO Files (id, name, type, size, path, url, content, user) VALUES ('f1', 'x.txt', 'text/plain', 1500, 'x', '', '', 'a')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	insert := "INSERT INTO Messages (conv_id, role, model, content, error, created_at) VALUES (?, ?, ?, '', ?, ?)"
+	for _, m := range []struct {
+		conv, role, model, err string
+		at                     time.Time
+	}{
+		{"c1", "user", "", "", now},
+		{"c1", "assistant", "p1/m", "", now},
+		{"c1", "assistant", "p1/m", "timeout", now},
+		{"c1", "assistant", "gone/m", "", now.AddDate(0, 0, -1)},
+		{"c2", "user", "", "", old},
+		{"c2", "assistant", "p1/m", "boom", old},
+	} {
+		if _, err := db.Exec(insert, m.conv, m.role, m.model, m.err, m.at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := collectStats(now.AddDate(0, 0, -29))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Users != 3 || stats.ActiveUsers != 1 || stats.Conversations != 2 || stats.Messages != 6 {
+		t.Errorf("unexpected totals: %+v", stats)
+	}
+	if stats.Storage.Files != 1 || stats.Storage.FileBytes != 1500 || stats.Storage.DatabaseBytes == 0 {
+		t.Errorf("unexpected storage: %+v", stats.Storage)
+	}
+
+	if len(stats.MessagesPerDay) != 30 {
+		t.Fatalf("expected 30 days, got %d", len(stats.MessagesPerDay))
+	}
+	last := stats.MessagesPerDay[29]
+	if last.Day != now.Format(time.DateOnly) || last.Count+stats.MessagesPerDay[28].Count != 4 {
+		t.Errorf("expected 4 messages in the last two days, got %+v", stats.MessagesPerDay[28:])
+	}
+
+	if len(stats.Providers) != 2 {
+		t.Fatalf("expected 2 providers, got %+v", stats.Providers)
+	}
+	p := stats.Providers[0]
+	if p.ProviderID != "p1" || p.URL != "https://api.example.com" || p.Responses != 2 || p.Errors != 1 || p.ErrorRate != 0.5 {
+		t.Errorf("unexpected stats of p1: %+v", p)
+	}
+	if p := stats.Providers[1]; p.ProviderID != "gone" || p.URL != "" || p.Errors != 0 {
+		t.Errorf("unexpected stats of a deleted provider: %+v", p)
+	}
+}
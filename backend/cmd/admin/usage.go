@@ -0,0 +1,24 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/Bajahaw/ai-ui/cmd/usage"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+func getUsage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, to, err := usage.ParseRange(q)
+	if err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	days, err := usage.Daily(q.Get("user"), q.Get("model"), from, to)
+	if err != nil {
+		log.Error("Error querying usage", "err", err)
+		utils.Error(w, "Error querying usage", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, usage.DailyUsageResponse{Days: days}, http.StatusOK)
+}
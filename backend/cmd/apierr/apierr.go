@@ -0,0 +1,176 @@
+// Package apierr defines the machine readable error codes returned by the
+// API, both in error responses and in stream error events, so clients can
+// branch on the code instead of parsing the message.
+package apierr
+
+import (
+	"errors"
+	"net/http"
+)
+
+type Code string
+
+const (
+	BadRequest           Code = "BAD_REQUEST"
+	Unauthorized         Code = "UNAUTHORIZED"
+	Forbidden            Code = "FORBIDDEN"
+	NotFound             Code = "NOT_FOUND"
+	MethodNotAllowed     Code = "METHOD_NOT_ALLOWED"
+	Conflict             Code = "CONFLICT"
+	RequestTooLarge      Code = "REQUEST_TOO_LARGE"
+	UnsupportedMediaType Code = "UNSUPPORTED_MEDIA_TYPE"
+	RateLimited          Code = "RATE_LIMITED"
+	Internal             Code = "INTERNAL_ERROR"
+	BadGateway           Code = "BAD_GATEWAY"
+	Unavailable          Code = "UNAVAILABLE"
+	Timeout              Code = "TIMEOUT"
+
+	// TOTPRequired means the login needs a two-factor code.
+	TOTPRequired Code = "TOTP_REQUIRED"
+
+	// ProviderUnavailable means the provider could not be reached or failed.
+	ProviderUnavailable Code = "PROVIDER_UNAVAILABLE"
+	// ProviderUnauthorized means the provider rejected the API key.
+	ProviderUnauthorized Code = "PROVIDER_UNAUTHORIZED"
+	// ProviderRateLimited means the provider asked to slow down.
+	ProviderRateLimited Code = "PROVIDER_RATE_LIMITED"
+	ProviderTimeout     Code = "PROVIDER_TIMEOUT"
+	// ProviderError is any other error reported by the provider.
+	ProviderError Code = "PROVIDER_ERROR"
+	// TooManyGenerations means the user already runs as many responses at
+	// once as allowed.
+	TooManyGenerations Code = "TOO_MANY_GENERATIONS"
+	// BudgetExceeded means the user used up the monthly usage budget an
+	// admin set.
+	BudgetExceeded Code = "BUDGET_EXCEEDED"
+	// QuotaExceeded means the user used up their quota of a shared
+	// provider.
+	QuotaExceeded Code = "QUOTA_EXCEEDED"
+	// ContextTooLong means the conversation does not fit the model context.
+	ContextTooLong Code = "CONTEXT_TOO_LONG"
+
+	ToolTimeout Code = "TOOL_TIMEOUT"
+	ToolFailed  Code = "TOOL_FAILED"
+	// ToolInvalidArgs means the model called a tool with arguments that do
+	// not match its input schema.
+	ToolInvalidArgs Code = "TOOL_INVALID_ARGS"
+
+	// IdempotencyKeyInUse means a request with the same Idempotency-Key is
+	// still running.
+	IdempotencyKeyInUse Code = "IDEMPOTENCY_KEY_IN_USE"
+	// IdempotencyKeyReused means the Idempotency-Key was sent before with a
+	// different request.
+	IdempotencyKeyReused Code = "IDEMPOTENCY_KEY_REUSED"
+
+	// ContentBlocked means moderation blocked the message.
+	ContentBlocked Code = "CONTENT_BLOCKED"
+)
+
+// Error is an error carrying a code.
+type Error struct {
+	Code    Code
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return string(e.Code)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Wrap attaches code to err, keeping its message.
+func Wrap(code Code, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+// CodeOf returns the code of the first coded error in err's chain,
+// or an empty code.
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
+
+// Status returns the HTTP status matching code.
+func Status(code Code) int {
+	switch code {
+	case BadRequest, ContextTooLong:
+		return http.StatusBadRequest
+	case Unauthorized, TOTPRequired:
+		return http.StatusUnauthorized
+	case BudgetExceeded:
+		return http.StatusPaymentRequired
+	case Forbidden:
+		return http.StatusForbidden
+	case NotFound:
+		return http.StatusNotFound
+	case MethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case Conflict, IdempotencyKeyInUse:
+		return http.StatusConflict
+	case IdempotencyKeyReused, ContentBlocked:
+		return http.StatusUnprocessableEntity
+	case RequestTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case UnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	case RateLimited, ProviderRateLimited, TooManyGenerations, QuotaExceeded:
+		return http.StatusTooManyRequests
+	case Unavailable:
+		return http.StatusServiceUnavailable
+	case BadGateway, ProviderUnavailable, ProviderUnauthorized, ProviderError, ToolFailed:
+		return http.StatusBadGateway
+	case Timeout, ProviderTimeout, ToolTimeout:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// FromStatus returns the generic code of an HTTP status.
+func FromStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return BadRequest
+	case http.StatusUnauthorized:
+		return Unauthorized
+	case http.StatusForbidden:
+		return Forbidden
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusMethodNotAllowed:
+		return MethodNotAllowed
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusRequestEntityTooLarge:
+		return RequestTooLarge
+	case http.StatusUnsupportedMediaType:
+		return UnsupportedMediaType
+	case http.StatusTooManyRequests:
+		return RateLimited
+	case http.StatusBadGateway:
+		return BadGateway
+	case http.StatusServiceUnavailable:
+		return Unavailable
+	case http.StatusGatewayTimeout:
+		return Timeout
+	}
+	if status >= 500 {
+		return Internal
+	}
+	return BadRequest
+}
@@ -0,0 +1,40 @@
+package apierr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCodeOf(t *testing.T) {
+	sentinel := New(ProviderTimeout, "provider timeout")
+	wrapped := fmt.Errorf("%w: no data for 5m", sentinel)
+
+	if got := CodeOf(wrapped); got != ProviderTimeout {
+		t.Errorf("CodeOf = %q, want %q", got, ProviderTimeout)
+	}
+	if !errors.Is(wrapped, sentinel) {
+		t.Errorf("wrapped error should match its sentinel")
+	}
+	if got := CodeOf(errors.New("plain")); got != "" {
+		t.Errorf("plain errors have no code, got %q", got)
+	}
+
+	cause := errors.New("dial tcp: connection refused")
+	err := Wrap(ProviderUnavailable, cause)
+	if err.Error() != cause.Error() || !errors.Is(err, cause) {
+		t.Errorf("Wrap should keep the message and cause, got %q", err.Error())
+	}
+}
+
+func TestStatusRoundTrip(t *testing.T) {
+	for _, status := range []int{400, 401, 403, 404, 405, 409, 413, 415, 429, 500, 502, 503, 504} {
+		if got := Status(FromStatus(status)); got != status {
+			t.Errorf("Status(FromStatus(%d)) = %d", status, got)
+		}
+	}
+	if Status(ContextTooLong) != http.StatusBadRequest || Status(ProviderRateLimited) != http.StatusTooManyRequests {
+		t.Errorf("unexpected status for domain codes")
+	}
+}
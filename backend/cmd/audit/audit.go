@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// Actions recorded in the audit log. They are grouped by the part before
+// the dot, which also filters them.
+const (
+	Login             = "auth.login"
+	LoginFailed       = "auth.login_failed"
+	Logout            = "auth.logout"
+	UserCreate        = "user.create"
+	PasswordChange    = "user.password_change"
+	TwoFactorEnable   = "user.2fa_enable"
+	TwoFactorDisable  = "user.2fa_disable"
+	TwoFactorFailed   = "user.2fa_failed"
+	TwoFactorLocked   = "user.2fa_locked"
+	ProviderCreate    = "provider.create"
+	ProviderUpdate    = "provider.update"
+	ProviderDelete    = "provider.delete"
+	ProviderKeyAdd    = "provider.key_add"
+	ProviderKeyDelete = "provider.key_delete"
+	MCPSave           = "mcp.save"
+	MCPDelete         = "mcp.delete"
+	MCPRestore        = "mcp.restore_default"
+	SettingsUpdate    = "settings.update"
+	ConfigUpdate      = "config.update"
+	BudgetSet         = "budget.set"
+	BudgetDelete      = "budget.delete"
+	QuotaSet          = "quota.set"
+	QuotaDelete       = "quota.delete"
+	InvitationCreate  = "invitation.create"
+	InvitationDelete  = "invitation.delete"
+)
+
+const redacted = "[redacted]"
+
+// secretField matches the names of fields whose values are never logged.
+var secretField = regexp.MustCompile(`(?i)(key|secret|password|token|authorization|cookie)`)
+
+// Change is the value of a field before and after an action.
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Record saves an action of actor on target. payload is saved as JSON, a
+// map from Diff for changes. It is a no-op until the package is set up, and
+// failures are only logged so they never fail the action itself.
+func Record(r *http.Request, actor, action, target string, payload any) {
+	if repo == nil {
+		return
+	}
+	entry := &Entry{
+		Actor:     actor,
+		Action:    action,
+		Target:    target,
+		CreatedAt: time.Now().UTC(),
+	}
+	if r != nil {
+		entry.IP = utils.ClientIP(r)
+	}
+	if payload != nil {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Error("Error encoding audit payload", "action", action, "err", err)
+		} else {
+			entry.Payload = body
+		}
+	}
+	if err := repo.Save(entry); err != nil {
+		log.Error("Error saving audit entry", "action", action, "actor", actor, "err", err)
+	}
+}
+
+// Diff returns the top level fields of the JSON forms of before and after
+// that differ. Either may be nil, for something created or deleted. Values
+// of secret looking fields are redacted.
+func Diff(before, after any) map[string]Change {
+	from, to := fields(before), fields(after)
+	changes := make(map[string]Change)
+	for key, v := range to {
+		if old, ok := from[key]; !ok || !reflect.DeepEqual(old, v) {
+			changes[key] = Change{From: redact(key, from[key]), To: redact(key, v)}
+		}
+	}
+	for key, old := range from {
+		if _, ok := to[key]; !ok {
+			changes[key] = Change{From: redact(key, old)}
+		}
+	}
+	return changes
+}
+
+func fields(v any) map[string]any {
+	m := make(map[string]any)
+	if v == nil {
+		return m
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+	json.Unmarshal(body, &m)
+	return m
+}
+
+func redact(key string, v any) any {
+	if v == nil || v == "" || !secretField.MatchString(key) {
+		return v
+	}
+	return redacted
+}
+
+// List returns the entries matching the filter, newest first.
+func List(filter Filter) ([]*Entry, error) {
+	return repo.GetAll(filter)
+}
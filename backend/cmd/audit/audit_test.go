@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func TestDiff(t *testing.T) {
+	before := map[string]any{"endpoint": "https://a", "api_key": "old", "name": "x", "gone": 1}
+	after := map[string]any{"endpoint": "https://b", "api_key": "new", "name": "x", "headers": []string{"X-Org"}}
+
+	changes := Diff(before, after)
+	if len(changes) != 4 {
+		t.Fatalf("expected 4 changes, got %+v", changes)
+	}
+	if c := changes["endpoint"]; c.From != "https://a" || c.To != "https://b" {
+		t.Errorf("unexpected endpoint change: %+v", c)
+	}
+	if c := changes["api_key"]; c.From != redacted || c.To != redacted {
+		t.Errorf("expected the key to be redacted, got %+v", c)
+	}
+	if c, ok := changes["gone"]; !ok || c.To != nil {
+		t.Errorf("expected a removed field, got %+v", c)
+	}
+	if _, ok := changes["name"]; ok {
+		t.Error("did not expect unchanged fields")
+	}
+
+	created := Diff(nil, map[string]string{"token": ""})
+	if c := created["token"]; c.From != nil || c.To != "" {
+		t.Errorf("expected empty secrets to stay empty, got %+v", c)
+	}
+}
+
+func TestRecordAndList(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	log = logger.New(os.Stdout)
+	repo = NewRepository(db)
+	t.Cleanup(func() { repo = nil })
+
+	r := httptest.NewRequest("POST", "/api/auth/login", nil)
+	r.RemoteAddr = "203.0.113.7:5000"
+	Record(r, "alice", LoginFailed, "alice", map[string]string{"reason": "invalid credentials"})
+	Record(r, "alice", Login, "alice", nil)
+	Record(nil, "alice", ProviderCreate, "openai-1a2b", Diff(nil, map[string]string{"base_url": "https://api.openai.com"}))
+	Record(nil, "bob", ProviderDelete, "groq-3c4d", nil)
+
+	all, err := List(Filter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 || all[0].Action != ProviderDelete {
+		t.Fatalf("expected 4 entries newest first, got %d", len(all))
+	}
+	failed := all[3]
+	if failed.IP != "203.0.113.7" || failed.Actor != "alice" {
+		t.Errorf("unexpected failed login entry: %+v", failed)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal(failed.Payload, &payload); err != nil || payload["reason"] != "invalid credentials" {
+		t.Errorf("unexpected payload %s: %v", failed.Payload, err)
+	}
+	if all[2].Payload != nil {
+		t.Errorf("expected no payload for a login, got %s", all[2].Payload)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{"actor", Filter{Actor: "alice"}, 3},
+		{"action", Filter{Action: Login}, 1},
+		{"action group", Filter{Action: "provider."}, 2},
+		{"target", Filter{Target: "groq-3c4d"}, 1},
+		{"since", Filter{Since: time.Now().Add(time.Minute)}, 0},
+		{"until", Filter{Until: time.Now().Add(time.Minute)}, 4},
+		{"before", Filter{Before: all[1].ID}, 2},
+		{"limit", Filter{Limit: 1}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.filter.Limit == 0 {
+				tt.filter.Limit = 10
+			}
+			entries, err := List(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.want {
+				t.Errorf("expected %d entries, got %d", tt.want, len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package audit
+
+import (
+	"database/sql"
+
+	logger "github.com/charmbracelet/log"
+)
+
+var log *logger.Logger
+var repo Repository
+
+func SetupAudit(l *logger.Logger, db *sql.DB) {
+	log = l
+	repo = NewRepository(db)
+}
@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
+
+// Entry is an administrative or security relevant action. Actor is the
+// user who acted, or the username tried for a failed login.
+type Entry struct {
+	ID        int64           `json:"id"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// Filter narrows the entries listed, zero fields match all.
+type Filter struct {
+	Actor  string
+	Action string
+	Target string
+	Since  time.Time
+	Until  time.Time
+	Before int64
+	Limit  int
+}
+
+type Repository interface {
+	Save(entry *Entry) error
+	GetAll(filter Filter) ([]*Entry, error)
+}
+
+type RepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) Save(entry *Entry) error {
+	query := `
+		INSERT INTO AuditLog (actor, action, target, ip, payload, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	payload := ""
+	if len(entry.Payload) > 0 {
+		payload = string(entry.Payload)
+	}
+	res, err := data.Exec(r.db, query, entry.Actor, entry.Action, entry.Target, entry.IP, payload, entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+	entry.ID, err = res.LastInsertId()
+	return err
+}
+
+// GetAll returns the entries matching the filter, newest first.
+func (r *RepositoryImpl) GetAll(filter Filter) ([]*Entry, error) {
+	query := `SELECT id, actor, action, target, ip, payload, created_at FROM AuditLog WHERE 1 = 1`
+	var args []any
+	if filter.Actor != "" {
+		query += ` AND actor = ?`
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		// "provider." matches every provider action
+		query += ` AND (action = ? OR (substr(?, -1) = '.' AND action LIKE ? || '%'))`
+		args = append(args, filter.Action, filter.Action, filter.Action)
+	}
+	if filter.Target != "" {
+		query += ` AND target = ?`
+		args = append(args, filter.Target)
+	}
+	if !filter.Since.IsZero() {
+		query += ` AND created_at >= ?`
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		query += ` AND created_at < ?`
+		args = append(args, filter.Until.UTC())
+	}
+	if filter.Before > 0 {
+		query += ` AND id < ?`
+		args = append(args, filter.Before)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*Entry{}
+	for rows.Next() {
+		var e Entry
+		var payload string
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &e.IP, &payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if payload != "" {
+			e.Payload = json.RawMessage(payload)
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -13,12 +14,14 @@ import (
 	"time"
 
 	logger "github.com/charmbracelet/log"
+	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // MockUserRepository implements UserRepository for testing
 type MockUserRepository struct {
-	users map[string]*User
+	users    map[string]*User
+	subjects map[string]string
 }
 
 func (m *MockUserRepository) GetAll() []*User {
@@ -52,13 +55,111 @@ func (m *MockUserRepository) Update(user *User) error {
 	return nil
 }
 
+func (m *MockUserRepository) GetByOIDCSubject(subject string) (*User, error) {
+	if username, ok := m.subjects[subject]; ok {
+		return m.users[username], nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MockUserRepository) SaveOIDC(user *User, subject string) error {
+	if err := m.Save(user); err != nil {
+		return err
+	}
+	m.subjects[subject] = user.Username
+	return nil
+}
+
+func (m *MockUserRepository) LinkOIDC(username string, subject string) error {
+	m.subjects[subject] = username
+	return nil
+}
+
+func (m *MockUserRepository) SetRole(username string, role string) error {
+	m.users[username].Role = role
+	return nil
+}
+
+// MockTwoFactorRepository implements TwoFactorRepository for testing
+type MockTwoFactorRepository struct {
+	state    map[string]*TwoFactor
+	recovery map[string][]string
+}
+
+func (m *MockTwoFactorRepository) Get(username string) (*TwoFactor, error) {
+	if tf, ok := m.state[username]; ok {
+		stored := *tf
+		return &stored, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MockTwoFactorRepository) SavePending(username string, secret string) error {
+	m.state[username] = &TwoFactor{Secret: secret}
+	return nil
+}
+
+func (m *MockTwoFactorRepository) Enable(username string, counter int64, recoveryHashes []string) error {
+	m.state[username].Enabled = true
+	m.state[username].LastCounter = counter
+	m.recovery[username] = recoveryHashes
+	return nil
+}
+
+func (m *MockTwoFactorRepository) AdvanceCounter(username string, counter int64) (bool, error) {
+	tf := m.state[username]
+	if counter <= tf.LastCounter {
+		return false, nil
+	}
+	tf.LastCounter = counter
+	return true, nil
+}
+
+func (m *MockTwoFactorRepository) UseRecoveryCode(username string, hash string) (bool, error) {
+	for i, h := range m.recovery[username] {
+		if h == hash {
+			m.recovery[username] = append(m.recovery[username][:i], m.recovery[username][i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockTwoFactorRepository) RecordFailure(username string, limit int, lockout time.Duration) (*time.Time, error) {
+	tf := m.state[username]
+	tf.FailedAttempts++
+	if tf.FailedAttempts < limit {
+		return nil, nil
+	}
+	until := time.Now().Add(lockout)
+	tf.FailedAttempts, tf.LockedUntil = 0, &until
+	return &until, nil
+}
+
+func (m *MockTwoFactorRepository) ResetFailures(username string) error {
+	tf := m.state[username]
+	tf.FailedAttempts, tf.LockedUntil = 0, nil
+	return nil
+}
+
+func (m *MockTwoFactorRepository) Delete(username string) error {
+	delete(m.state, username)
+	delete(m.recovery, username)
+	return nil
+}
+
 func setupTest() *MockUserRepository {
 	log = logger.New(os.Stderr)
 
 	repo := &MockUserRepository{
-		users: make(map[string]*User),
+		users:    make(map[string]*User),
+		subjects: make(map[string]string),
 	}
 	users = repo
+	twoFactor = &MockTwoFactorRepository{
+		state:    make(map[string]*TwoFactor),
+		recovery: make(map[string][]string),
+	}
 
 	JWT_SECRET = "test-secret-key"
 
@@ -255,6 +356,36 @@ func TestChangePassword(t *testing.T) {
 	}
 }
 
+func TestSetPassword(t *testing.T) {
+	repo := setupTest()
+	repo.users["testuser"] = &User{Username: "testuser", passHash: "old"}
+	twoFactor.SavePending("testuser", "secret")
+
+	if err := SetPassword("nobody", "newpassword123", false); err == nil {
+		t.Error("Expected an unknown user to be rejected")
+	}
+	if err := SetPassword("testuser", "short", false); err == nil {
+		t.Error("Expected a short password to be rejected")
+	}
+
+	if err := SetPassword("testuser", "newpassword123", false); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(repo.users["testuser"].passHash), []byte("newpassword123")); err != nil {
+		t.Error("Password was not updated")
+	}
+	if _, err := twoFactor.Get("testuser"); err != nil {
+		t.Error("Two-factor authentication should be kept")
+	}
+
+	if err := SetPassword("testuser", "newpassword456", true); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+	if _, err := twoFactor.Get("testuser"); err == nil {
+		t.Error("Two-factor authentication should be reset")
+	}
+}
+
 func TestAuthStatus(t *testing.T) {
 	setupTest()
 
@@ -346,6 +477,12 @@ func TestLogout(t *testing.T) {
 func TestAuthenticatedMiddleware(t *testing.T) {
 	setupTest()
 	token, _ := generateJWT("testuser")
+	// signed with the same secret, even with a username
+	stateToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":      oidcStateToken,
+		"username": "testuser",
+		"exp":      time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte(JWT_SECRET))
 
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		username := utils.ExtractContextUser(r)
@@ -381,6 +518,14 @@ func TestAuthenticatedMiddleware(t *testing.T) {
 			},
 			expectedStatus: http.StatusUnauthorized,
 		},
+		{
+			name: "OIDC State Token",
+			cookie: &http.Cookie{
+				Name:  AUTH_COOKIE,
+				Value: stateToken,
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
 	}
 
 	for _, tc := range tests {
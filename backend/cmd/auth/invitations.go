@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+)
+
+// Registration modes, set with the registration option.
+const (
+	RegistrationOpen   = "open"
+	RegistrationInvite = "invite"
+	RegistrationClosed = "closed"
+)
+
+const (
+	DefaultInvitationDays = 7
+	MaxInvitationDays     = 90
+)
+
+// Invitation lets one person sign up until it expires. The code is only
+// returned when the invitation is created, the database keeps its hash.
+type Invitation struct {
+	ID        int64      `json:"id"`
+	Code      string     `json:"code,omitempty"`
+	Note      string     `json:"note"`
+	CreatedBy string     `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedBy    string     `json:"usedBy,omitempty"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+}
+
+type InvitationRepository interface {
+	Save(invitation *Invitation, codeHash string) error
+	// GetAll returns every invitation, newest first
+	GetAll() ([]*Invitation, error)
+	// Use marks the unused and unexpired invitation with the hash as used
+	// by username, and reports whether there was one
+	Use(codeHash string, username string, now time.Time) (bool, error)
+	// Release makes an invitation usable again, when signing up with it
+	// failed
+	Release(codeHash string) error
+	// Delete removes an invitation, or returns sql.ErrNoRows
+	Delete(id int64) error
+}
+
+type InvitationRepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewInvitationRepository(db *sql.DB) InvitationRepository {
+	return &InvitationRepositoryImpl{db: db}
+}
+
+func (r *InvitationRepositoryImpl) Save(invitation *Invitation, codeHash string) error {
+	res, err := r.db.Exec(
+		`INSERT INTO Invitations (code_hash, note, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		codeHash, invitation.Note, invitation.CreatedBy, invitation.CreatedAt, invitation.ExpiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	invitation.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *InvitationRepositoryImpl) GetAll() ([]*Invitation, error) {
+	rows, err := r.db.Query(`
+		SELECT id, note, COALESCE(created_by, ''), created_at, expires_at, COALESCE(used_by, ''), used_at
+		FROM Invitations
+		ORDER BY created_at DESC, id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+	for rows.Next() {
+		var inv Invitation
+		var usedAt sql.NullTime
+		if err := rows.Scan(&inv.ID, &inv.Note, &inv.CreatedBy, &inv.CreatedAt, &inv.ExpiresAt, &inv.UsedBy, &usedAt); err != nil {
+			return nil, err
+		}
+		if usedAt.Valid {
+			inv.UsedAt = &usedAt.Time
+		}
+		invitations = append(invitations, &inv)
+	}
+	return invitations, rows.Err()
+}
+
+func (r *InvitationRepositoryImpl) Use(codeHash string, username string, now time.Time) (bool, error) {
+	res, err := r.db.Exec(
+		`UPDATE Invitations SET used_by = ?, used_at = ?
+		WHERE code_hash = ? AND used_at IS NULL AND expires_at > ?`,
+		username, now, codeHash, now,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *InvitationRepositoryImpl) Release(codeHash string) error {
+	_, err := r.db.Exec(`UPDATE Invitations SET used_by = NULL, used_at = NULL WHERE code_hash = ?`, codeHash)
+	return err
+}
+
+func (r *InvitationRepositoryImpl) Delete(id int64) error {
+	res, err := r.db.Exec(`DELETE FROM Invitations WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// hashInvitationCode hashes a code ignoring case and surrounding spaces.
+// Codes are random, so a plain hash is enough to keep them unreadable.
+func hashInvitationCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToUpper(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// RegistrationMode returns who may sign up. Anyone may until the first
+// user exists, so a new instance can get its admin.
+func RegistrationMode() string {
+	if len(users.GetAll()) == 0 {
+		return RegistrationOpen
+	}
+	return config.Get("registration")
+}
+
+// CreateInvitation adds an invitation of creator that expires after days,
+// the returned invitation holds its code.
+func CreateInvitation(creator string, note string, days int) (*Invitation, error) {
+	now := time.Now().UTC()
+	invitation := &Invitation{
+		Code:      rand.Text(),
+		Note:      note,
+		CreatedBy: creator,
+		CreatedAt: now,
+		ExpiresAt: now.AddDate(0, 0, days),
+	}
+	if err := invitations.Save(invitation, hashInvitationCode(invitation.Code)); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// Invitations returns every invitation, newest first.
+func Invitations() ([]*Invitation, error) {
+	return invitations.GetAll()
+}
+
+// DeleteInvitation revokes an invitation, or forgets a used one. It returns
+// sql.ErrNoRows when there is none with the id.
+func DeleteInvitation(id int64) error {
+	return invitations.Delete(id)
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
+
+func setupInvitationTest(t *testing.T) {
+	setupTest()
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	t.Cleanup(func() { data.DB.Close() })
+	users = NewUserRepository(data.DB)
+	invitations = NewInvitationRepository(data.DB)
+}
+
+func register(username string, invitation string) int {
+	body, _ := json.Marshal(RegisterRequest{Username: username, Password: "password123", Invitation: invitation})
+	w := httptest.NewRecorder()
+	Register().ServeHTTP(w, httptest.NewRequest("POST", "/register", bytes.NewBuffer(body)))
+	return w.Code
+}
+
+func TestRegisterWithInvitation(t *testing.T) {
+	setupInvitationTest(t)
+	t.Setenv("REGISTRATION", RegistrationInvite)
+
+	// the first user needs no invitation
+	if code := register("admin", ""); code != http.StatusNoContent {
+		t.Fatalf("first user: expected 204, got %d", code)
+	}
+	if code := register("bob", ""); code != http.StatusForbidden {
+		t.Errorf("without invitation: expected 403, got %d", code)
+	}
+	if code := register("bob", "not-a-code"); code != http.StatusForbidden {
+		t.Errorf("unknown invitation: expected 403, got %d", code)
+	}
+
+	invitation, err := CreateInvitation("admin", "for bob", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a failed sign up leaves the invitation usable
+	if code := register("admin", invitation.Code); code != http.StatusBadRequest {
+		t.Errorf("taken username: expected 400, got %d", code)
+	}
+	if code := register("bob", " "+invitation.Code+" "); code != http.StatusNoContent {
+		t.Fatalf("valid invitation: expected 204, got %d", code)
+	}
+	if code := register("carol", invitation.Code); code != http.StatusForbidden {
+		t.Errorf("used invitation: expected 403, got %d", code)
+	}
+
+	all, err := Invitations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].UsedBy != "bob" || all[0].UsedAt == nil || all[0].Code != "" {
+		t.Errorf("unexpected invitations: %+v", all)
+	}
+
+	expired, _ := CreateInvitation("admin", "", 1)
+	if _, err := data.DB.Exec(`UPDATE Invitations SET expires_at = ? WHERE id = ?`, time.Now().UTC().Add(-time.Minute), expired.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := register("carol", expired.Code); code != http.StatusForbidden {
+		t.Errorf("expired invitation: expected 403, got %d", code)
+	}
+
+	revoked, _ := CreateInvitation("admin", "", 1)
+	if err := DeleteInvitation(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := register("carol", revoked.Code); code != http.StatusForbidden {
+		t.Errorf("revoked invitation: expected 403, got %d", code)
+	}
+}
+
+func TestRegistrationMode(t *testing.T) {
+	setupInvitationTest(t)
+
+	t.Setenv("REGISTRATION", RegistrationClosed)
+	if mode := RegistrationMode(); mode != RegistrationOpen {
+		t.Errorf("expected open registration without users, got %s", mode)
+	}
+	if code := register("admin", ""); code != http.StatusNoContent {
+		t.Fatalf("first user: expected 204, got %d", code)
+	}
+	if code := register("bob", ""); code != http.StatusForbidden {
+		t.Errorf("closed: expected 403, got %d", code)
+	}
+
+	t.Setenv("REGISTRATION", RegistrationOpen)
+	if code := register("bob", ""); code != http.StatusNoContent {
+		t.Errorf("open: expected 204, got %d", code)
+	}
+}
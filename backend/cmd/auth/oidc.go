@@ -0,0 +1,400 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/audit"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+const (
+	OIDC_STATE_COOKIE = "oidc_state"
+	oidcFlowTimeout   = 10 * time.Minute
+)
+
+// oidcProvider holds the OpenID Connect settings read from the environment.
+// The provider's endpoints are discovered on the first login so that the
+// server starts even when the identity provider is unreachable.
+type oidcProvider struct {
+	issuer        string
+	clientID      string
+	clientSecret  string
+	redirectURL   string
+	scopes        []string
+	usernameClaim string
+	groupsClaim   string
+	adminGroups   []string
+	linkExisting  bool
+	client        *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+// oidc is nil unless OIDC_ISSUER, OIDC_CLIENT_ID and OIDC_CLIENT_SECRET are set.
+var oidc *oidcProvider
+
+func setupOIDC() {
+	oidc = nil
+	issuer := strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/")
+	if issuer == "" {
+		return
+	}
+
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	clientSecret := os.Getenv("OIDC_CLIENT_SECRET")
+	if clientID == "" || clientSecret == "" {
+		log.Warn("OIDC_ISSUER is set without OIDC_CLIENT_ID and OIDC_CLIENT_SECRET; SSO login disabled")
+		return
+	}
+
+	oidc = &oidcProvider{
+		issuer:        issuer,
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		redirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+		scopes:        splitList(os.Getenv("OIDC_SCOPES"), " "),
+		usernameClaim: os.Getenv("OIDC_USERNAME_CLAIM"),
+		groupsClaim:   os.Getenv("OIDC_GROUPS_CLAIM"),
+		adminGroups:   splitList(os.Getenv("OIDC_ADMIN_GROUPS"), ","),
+		linkExisting:  os.Getenv("OIDC_LINK_EXISTING") == "true",
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+	if len(oidc.scopes) == 0 {
+		oidc.scopes = []string{"openid", "profile", "email"}
+	}
+	if !slices.Contains(oidc.scopes, "openid") {
+		oidc.scopes = append(oidc.scopes, "openid")
+	}
+	if oidc.usernameClaim == "" {
+		oidc.usernameClaim = "preferred_username"
+	}
+	if oidc.groupsClaim == "" {
+		oidc.groupsClaim = "groups"
+	}
+	log.Info("OIDC login enabled", "issuer", issuer)
+}
+
+func splitList(raw string, sep string) []string {
+	var items []string
+	for item := range strings.SplitSeq(raw, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery returned %s", resp.Status)
+	}
+
+	var d oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", d.Issuer, p.issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+func (p *oidcProvider) config(r *http.Request, d *oidcDiscovery) *oauth2.Config {
+	redirectURL := p.redirectURL
+	if redirectURL == "" {
+		redirectURL = utils.GetServerURL(r) + "/api/auth/oidc/callback"
+	}
+	return &oauth2.Config{
+		ClientID:     p.clientID,
+		ClientSecret: p.clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       p.scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  d.AuthorizationEndpoint,
+			TokenURL: d.TokenEndpoint,
+		},
+	}
+}
+
+// OIDCLogin redirects the browser to the identity provider. The state, nonce
+// and PKCE verifier of the flow are kept in a short-lived signed cookie.
+func OIDCLogin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if oidc == nil {
+			utils.Error(w, "SSO login is not configured", http.StatusNotFound)
+			return
+		}
+
+		d, err := oidc.discover(r.Context())
+		if err != nil {
+			log.Error("OIDC discovery failed", "err", err)
+			utils.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+			return
+		}
+
+		state, nonce, verifier := rand.Text(), rand.Text(), oauth2.GenerateVerifier()
+		flow, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"typ":      oidcStateToken,
+			"state":    state,
+			"nonce":    nonce,
+			"verifier": verifier,
+			"exp":      time.Now().Add(oidcFlowTimeout).Unix(),
+		}).SignedString([]byte(JWT_SECRET))
+		if err != nil {
+			utils.Error(w, "Failed to start login", http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     OIDC_STATE_COOKIE,
+			Value:    flow,
+			Path:     "/api/auth/oidc",
+			Expires:  time.Now().Add(oidcFlowTimeout),
+			HttpOnly: true,
+			Secure:   true,
+			// the callback is a cross-site navigation from the provider
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		authURL := oidc.config(r, d).AuthCodeURL(state,
+			oauth2.S256ChallengeOption(verifier),
+			oauth2.SetAuthURLParam("nonce", nonce),
+		)
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// OIDCCallback completes the login started by OIDCLogin: it exchanges the
+// code for an ID token, maps the subject to a local user and sets the
+// usual auth cookie.
+func OIDCCallback() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if oidc == nil {
+			utils.Error(w, "SSO login is not configured", http.StatusNotFound)
+			return
+		}
+
+		q := r.URL.Query()
+		if e := q.Get("error"); e != "" {
+			log.Warn("OIDC login rejected by provider", "error", e, "description", q.Get("error_description"))
+			utils.Error(w, "Login rejected by identity provider", http.StatusUnauthorized)
+			return
+		}
+
+		cookie, err := r.Cookie(OIDC_STATE_COOKIE)
+		if err != nil {
+			utils.Error(w, "Login session expired", http.StatusBadRequest)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     OIDC_STATE_COOKIE,
+			Value:    "",
+			Path:     "/api/auth/oidc",
+			Expires:  time.Unix(0, 0),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		flow, err := extractClaims(cookie.Value, oidcStateToken)
+		if err != nil || flow["state"] != q.Get("state") {
+			log.Warn("OIDC state mismatch", "ip", utils.ClientIP(r))
+			utils.Error(w, "Invalid login state", http.StatusBadRequest)
+			return
+		}
+		nonce, _ := flow["nonce"].(string)
+		verifier, _ := flow["verifier"].(string)
+
+		d, err := oidc.discover(r.Context())
+		if err != nil {
+			log.Error("OIDC discovery failed", "err", err)
+			utils.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), oauth2.HTTPClient, oidc.client)
+		token, err := oidc.config(r, d).Exchange(ctx, q.Get("code"), oauth2.VerifierOption(verifier))
+		if err != nil {
+			log.Error("OIDC code exchange failed", "err", err)
+			utils.Error(w, "Failed to complete login", http.StatusBadGateway)
+			return
+		}
+		rawIDToken, _ := token.Extra("id_token").(string)
+		claims, err := oidc.verifyIDToken(rawIDToken, d.Issuer, nonce)
+		if err != nil {
+			log.Warn("Invalid OIDC ID token", "err", err)
+			utils.Error(w, "Invalid identity token", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := oidc.resolveUser(claims)
+		if err != nil {
+			log.Error("Failed to map OIDC user", "err", err)
+			audit.Record(r, oidc.username(claims), audit.LoginFailed, "", map[string]string{"method": "oidc", "reason": err.Error()})
+			utils.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		signedToken, err := generateJWT(user.Username)
+		if err != nil {
+			utils.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		setAuthCookie(w, signedToken)
+		audit.Record(r, user.Username, audit.Login, user.Username, map[string]string{"method": "oidc"})
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
+
+// verifyIDToken checks the claims of an ID token. The token comes straight
+// from the token endpoint over TLS, which OIDC Core 3.1.3.7 allows in place
+// of checking its signature.
+func (p *oidcProvider) verifyIDToken(raw string, issuer string, nonce string) (jwt.MapClaims, error) {
+	if raw == "" {
+		return nil, errors.New("no id_token in token response")
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(raw, claims); err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims.GetIssuer(); iss != issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", iss)
+	}
+	if aud, _ := claims.GetAudience(); !slices.Contains(aud, p.clientID) {
+		return nil, errors.New("token is not issued for this client")
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil || time.Now().After(exp.Time) {
+		return nil, errors.New("token expired")
+	}
+	if claims["nonce"] != nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+	if sub, _ := claims.GetSubject(); sub == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+// resolveUser returns the local user of an OIDC subject, creating it on
+// first login, and applies the admin group mapping when one is configured.
+func (p *oidcProvider) resolveUser(claims jwt.MapClaims) (*User, error) {
+	subject, _ := claims.GetSubject()
+
+	user, err := users.GetByOIDCSubject(subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		user, err = p.createUser(subject, p.username(claims))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.adminGroups) > 0 {
+		role := RoleUser
+		if slices.ContainsFunc(p.groups(claims), func(g string) bool { return slices.Contains(p.adminGroups, g) }) {
+			role = RoleAdmin
+		}
+		if role != user.Role {
+			if err := users.SetRole(user.Username, role); err != nil {
+				return nil, err
+			}
+			log.Info("Updated role from OIDC groups", "user", user.Username, "role", role)
+			user.Role = role
+		}
+	}
+	return user, nil
+}
+
+func (p *oidcProvider) createUser(subject string, username string) (*User, error) {
+	if username == "" {
+		return nil, errors.New("Identity token has no usable username")
+	}
+
+	if existing, err := users.GetByUsername(username); err == nil {
+		if !p.linkExisting {
+			return nil, errors.New("Username already exists")
+		}
+		if err := users.LinkOIDC(username, subject); err != nil {
+			return nil, err
+		}
+		log.Info("Linked existing user to OIDC subject", "user", username)
+		return existing, nil
+	}
+
+	if err := users.SaveOIDC(&User{Username: username}, subject); err != nil {
+		return nil, err
+	}
+	for _, hook := range OnRegister {
+		hook(username)
+	}
+	audit.Record(nil, username, audit.UserCreate, username, map[string]string{"method": "oidc"})
+	log.Info("Created user from OIDC login", "user", username)
+	return users.GetByOIDCSubject(subject)
+}
+
+// username picks the configured claim, falling back to the email and
+// finally the subject.
+func (p *oidcProvider) username(claims jwt.MapClaims) string {
+	for _, name := range []string{p.usernameClaim, "email", "sub"} {
+		if v, ok := claims[name].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (p *oidcProvider) groups(claims jwt.MapClaims) []string {
+	var groups []string
+	switch v := claims[p.groupsClaim].(type) {
+	case string:
+		groups = append(groups, v)
+	case []any:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	}
+	return groups
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIdentityProvider serves discovery and a token endpoint that returns an
+// ID token with the given claims, plus the nonce sent to the authorize URL.
+func fakeIdentityProvider(t *testing.T, claims jwt.MapClaims) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(oidcDiscovery{
+				Issuer:                srv.URL,
+				AuthorizationEndpoint: srv.URL + "/authorize",
+				TokenEndpoint:         srv.URL + "/token",
+			})
+		case "/token":
+			if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") == "" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			idToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("idp-key"))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "access",
+				"token_type":   "Bearer",
+				"id_token":     idToken,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	claims["iss"] = srv.URL
+	return srv
+}
+
+// oidcLogin runs the login redirect and the callback, returning the callback response.
+func oidcLogin(t *testing.T, claims jwt.MapClaims) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	OIDCLogin()(w, httptest.NewRequest("GET", "/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body.String())
+	}
+	authURL, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := authURL.Query()
+	if params.Get("code_challenge") == "" || params.Get("client_id") != "ai-ui" {
+		t.Fatalf("unexpected authorize URL: %s", authURL)
+	}
+	claims["nonce"] = params.Get("nonce")
+
+	callback := httptest.NewRequest("GET", "/oidc/callback?code=good-code&state="+params.Get("state"), nil)
+	for _, c := range w.Result().Cookies() {
+		callback.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	OIDCCallback()(w, callback)
+	return w
+}
+
+func setupOIDCTest(t *testing.T, claims jwt.MapClaims) *MockUserRepository {
+	repo := setupTest()
+	srv := fakeIdentityProvider(t, claims)
+	t.Setenv("OIDC_ISSUER", srv.URL)
+	t.Setenv("OIDC_CLIENT_ID", "ai-ui")
+	t.Setenv("OIDC_CLIENT_SECRET", "secret")
+	t.Setenv("OIDC_REDIRECT_URL", "http://localhost/api/auth/oidc/callback")
+	t.Setenv("OIDC_ADMIN_GROUPS", "ai-admins")
+	setupOIDC()
+	t.Cleanup(func() { oidc = nil })
+	return repo
+}
+
+func idClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":                "subject-1",
+		"aud":                "ai-ui",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"preferred_username": "alice",
+		"groups":             []string{"staff", "ai-admins"},
+	}
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	claims := idClaims()
+	repo := setupOIDCTest(t, claims)
+
+	w := oidcLogin(t, claims)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/" {
+		t.Fatalf("callback: status %d: %s", w.Code, w.Body.String())
+	}
+
+	var token string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == AUTH_COOKIE {
+			token = c.Value
+		}
+	}
+	claimsOut, err := extractClaims(token, sessionToken)
+	if err != nil || claimsOut["username"] != "alice" {
+		t.Fatalf("expected an auth cookie for alice, got %v (%v)", claimsOut, err)
+	}
+
+	user := repo.users["alice"]
+	if user == nil || repo.subjects["subject-1"] != "alice" {
+		t.Fatalf("user was not created and mapped: %+v", repo.subjects)
+	}
+	if user.Role != RoleAdmin {
+		t.Errorf("expected the admin group to grant admin, got %q", user.Role)
+	}
+
+	// losing the group on the provider demotes the user on next login
+	claims["groups"] = []string{"staff"}
+	if w := oidcLogin(t, claims); w.Code != http.StatusFound {
+		t.Fatalf("second login: status %d", w.Code)
+	}
+	if repo.users["alice"].Role != RoleUser {
+		t.Errorf("expected role user after leaving the group, got %q", repo.users["alice"].Role)
+	}
+}
+
+func TestOIDCLoginRejectsExistingUsername(t *testing.T) {
+	claims := idClaims()
+	repo := setupOIDCTest(t, claims)
+	repo.users["alice"] = &User{Username: "alice", Role: RoleUser}
+
+	if w := oidcLogin(t, claims); w.Code != http.StatusConflict {
+		t.Errorf("expected conflict for an unlinked local user, got %d", w.Code)
+	}
+
+	t.Setenv("OIDC_LINK_EXISTING", "true")
+	setupOIDC()
+	if w := oidcLogin(t, claims); w.Code != http.StatusFound {
+		t.Fatalf("expected the local user to be linked, got %d", w.Code)
+	}
+	if repo.subjects["subject-1"] != "alice" {
+		t.Errorf("subject was not linked to the existing user")
+	}
+}
+
+func TestOIDCCallbackValidation(t *testing.T) {
+	claims := idClaims()
+	setupOIDCTest(t, claims)
+
+	w := httptest.NewRecorder()
+	OIDCCallback()(w, httptest.NewRequest("GET", "/oidc/callback?code=good-code&state=x", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("callback without a login cookie: status %d", w.Code)
+	}
+
+	claims["aud"] = "someone-else"
+	if w := oidcLogin(t, claims); w.Code != http.StatusUnauthorized {
+		t.Errorf("token for another client: status %d", w.Code)
+	}
+}
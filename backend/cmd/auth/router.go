@@ -1,25 +1,39 @@
 package auth
 
 import (
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 	"context"
 	"crypto/rand"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/audit"
 	logger "github.com/charmbracelet/log"
 )
 
 type AuthStatus struct {
 	Authenticated bool `json:"authenticated"`
+	OIDC          bool `json:"oidc"`
+	// Registration is who may sign up: open, invite or closed
+	Registration string `json:"registration"`
 }
 
 type RegisterRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// Invitation is the code from an admin, needed when registration is
+	// by invitation
+	Invitation string `json:"invitation,omitempty"`
+}
+
+type PasswordRequest struct {
+	Password string `json:"password"`
 }
 
 // PostRegisterHook defines the signature for actions after registration
@@ -30,6 +44,8 @@ var OnRegister []PostRegisterHook
 var log *logger.Logger
 var db *sql.DB
 var users UserRepository
+var twoFactor TwoFactorRepository
+var invitations InvitationRepository
 var JWT_SECRET string
 
 const AUTH_COOKIE = "auth_token"
@@ -38,20 +54,35 @@ func Setup(l *logger.Logger, d *sql.DB) {
 	log = l
 	db = d
 	users = NewUserRepository(db)
+	twoFactor = NewTwoFactorRepository(db)
+	invitations = NewInvitationRepository(db)
 	JWT_SECRET = os.Getenv("JWT_SECRET")
 	if JWT_SECRET == "" {
 		JWT_SECRET = rand.Text()
 		log.Warn("JWT_SECRET not set in environment; using random secret for this session")
 	}
+	setupOIDC()
 }
 
 func Handler() http.Handler {
-	mux := http.NewServeMux()
-	mux.Handle("POST /login", Login())
-	mux.Handle("POST /logout", Authenticated(Logout()))
-	mux.Handle("POST /register", Register())
-	mux.Handle("GET /status", GetAuthStatus())
-	mux.Handle("POST /change-pass", Authenticated(http.HandlerFunc(UpdateUser)))
+	mux := openapi.NewRouter("/api/auth", "Auth")
+	mux.Handle("POST /login", Login(), openapi.Op{
+		Summary:     "Sign in and set the session cookie",
+		Description: "Fails with TOTP_REQUIRED when the account needs a two-factor code.",
+		Form:        []openapi.Param{{Name: "username"}, {Name: "password"}, {Name: "code"}},
+		ContentType: "text/plain",
+		Public:      true,
+	})
+	mux.Handle("POST /logout", Authenticated(Logout()), openapi.Op{Summary: "Sign out", ContentType: "text/plain"})
+	mux.Handle("POST /register", Register(), openapi.Op{Summary: "Create an account", Description: "Needs an invitation code from an admin when registration is by invitation, fails when it is closed.", Request: RegisterRequest{}, Status: http.StatusNoContent, Public: true})
+	mux.Handle("GET /status", GetAuthStatus(), openapi.Op{Summary: "Tell whether the session is signed in", Response: AuthStatus{}, Public: true})
+	mux.Handle("GET /oidc/login", OIDCLogin(), openapi.Op{Summary: "Redirect to the single sign-on provider", Status: http.StatusFound, Public: true})
+	mux.Handle("GET /oidc/callback", OIDCCallback(), openapi.Op{Summary: "Finish single sign-on", Status: http.StatusFound, Public: true})
+	mux.Handle("POST /change-pass", Authenticated(http.HandlerFunc(UpdateUser)), openapi.Op{Summary: "Change the password", Request: PasswordRequest{}, Status: http.StatusNoContent})
+	mux.Handle("GET /2fa", Authenticated(http.HandlerFunc(GetTwoFactorStatus)), openapi.Op{Summary: "Tell whether two-factor login is on", Response: TwoFactorStatus{}})
+	mux.Handle("POST /2fa/setup", Authenticated(http.HandlerFunc(SetupTwoFactor)), openapi.Op{Summary: "Start setting up two-factor login", Response: TwoFactorSetup{}})
+	mux.Handle("POST /2fa/verify", Authenticated(http.HandlerFunc(VerifyTwoFactor)), openapi.Op{Summary: "Turn two-factor login on with a code", Request: TwoFactorCodeRequest{}, Response: RecoveryCodes{}})
+	mux.Handle("POST /2fa/disable", Authenticated(http.HandlerFunc(DisableTwoFactor)), openapi.Op{Summary: "Turn two-factor login off", Request: TwoFactorCodeRequest{}, Status: http.StatusNoContent})
 
 	return http.StripPrefix("/api/auth", mux)
 }
@@ -59,21 +90,19 @@ func Handler() http.Handler {
 func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	username := utils.ExtractContextUser(r)
 	if username == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		utils.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	var req struct {
-		Password string `json:"password"`
-	}
+	var req PasswordRequest
 	if err := utils.ExtractJSONBody(r, &req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	hash, err := hashPassword(req.Password)
 	if err != nil {
-		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		utils.Error(w, "Failed to hash password", http.StatusInternalServerError)
 		return
 	}
 
@@ -83,9 +112,10 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := users.Update(user); err != nil {
-		http.Error(w, "Failed to update password", http.StatusInternalServerError)
+		utils.Error(w, "Failed to update password", http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, username, audit.PasswordChange, username, nil)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -94,22 +124,52 @@ func Register() http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var req RegisterRequest
 		if err := utils.ExtractJSONBody(r, &req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			utils.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 
 		if len(req.Username) == 0 || len(req.Password) < 8 {
-			http.Error(w, "Bad Credentials", http.StatusBadRequest)
+			utils.Error(w, "Bad Credentials", http.StatusBadRequest)
+			return
+		}
+
+		var codeHash string
+		switch RegistrationMode() {
+		case RegistrationClosed:
+			utils.Error(w, "Registration is closed", http.StatusForbidden)
 			return
+		case RegistrationInvite:
+			if req.Invitation == "" {
+				utils.Error(w, "An invitation code is required", http.StatusForbidden)
+				return
+			}
+			codeHash = hashInvitationCode(req.Invitation)
+			ok, err := invitations.Use(codeHash, req.Username, time.Now().UTC())
+			if err != nil {
+				log.Error("Error using invitation", "err", err)
+				utils.Error(w, "Failed to register user", http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				utils.Error(w, "Invalid or expired invitation code", http.StatusForbidden)
+				return
+			}
 		}
 
 		err := registerNewUser(req.Username, req.Password)
 		if err != nil {
 			log.Error("Failed to register user", "error", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			if codeHash != "" {
+				if err := invitations.Release(codeHash); err != nil {
+					log.Error("Error releasing invitation", "err", err)
+				}
+			}
+			utils.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		audit.Record(r, req.Username, audit.UserCreate, req.Username, nil)
+
 		log.Debug("calling hooks")
 		for _, hook := range OnRegister {
 			hook(req.Username)
@@ -126,32 +186,59 @@ func Login() http.HandlerFunc {
 
 		err := verifyUserCredentials(username, password)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+			audit.Record(r, username, audit.LoginFailed, username, map[string]string{"reason": "invalid credentials"})
+			utils.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		signedToken, err := generateJWT(username)
+		err = checkSecondFactor(r, username, r.FormValue("code"))
+		if errors.Is(err, errTOTPRequired) {
+			utils.RespondWithError(w, apierr.TOTPRequired, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, errCodesLocked) {
+			audit.Record(r, username, audit.LoginFailed, username, map[string]string{"reason": "two-factor codes locked"})
+			respondCodesLocked(w)
+			return
+		}
+		if errors.Is(err, errInvalidCode) {
+			audit.Record(r, username, audit.LoginFailed, username, map[string]string{"reason": "invalid two-factor code"})
+			utils.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
 		if err != nil {
-			http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			log.Error("Error checking two-factor code", "err", err)
+			utils.Error(w, "Failed to verify two-factor code", http.StatusInternalServerError)
 			return
 		}
 
-		cookie := &http.Cookie{
-			Name:     AUTH_COOKIE,
-			Value:    signedToken,
-			Path:     "/",
-			Expires:  time.Now().Add(7 * 24 * time.Hour),
-			HttpOnly: true,
-			Secure:   true,
-			SameSite: http.SameSiteStrictMode,
+		signedToken, err := generateJWT(username)
+		if err != nil {
+			utils.Error(w, "Failed to generate token", http.StatusInternalServerError)
+			return
 		}
-		http.SetCookie(w, cookie)
+
+		setAuthCookie(w, signedToken)
+		audit.Record(r, username, audit.Login, username, nil)
 		fmt.Fprintln(w, "Login successful. Cookie set.")
 	}
 }
 
+func setAuthCookie(w http.ResponseWriter, signedToken string) {
+	cookie := &http.Cookie{
+		Name:     AUTH_COOKIE,
+		Value:    signedToken,
+		Path:     "/",
+		Expires:  time.Now().Add(7 * 24 * time.Hour),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	}
+	http.SetCookie(w, cookie)
+}
+
 func Logout() http.HandlerFunc {
-	return func(w http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
 		cookie := &http.Cookie{
 			Name:     AUTH_COOKIE,
 			Value:    "",
@@ -162,6 +249,10 @@ func Logout() http.HandlerFunc {
 			SameSite: http.SameSiteStrictMode,
 		}
 		http.SetCookie(w, cookie)
+		// the route is authenticated, but the handler works without a user
+		if user, ok := r.Context().Value("user").(string); ok {
+			audit.Record(r, user, audit.Logout, user, nil)
+		}
 		fmt.Fprintln(w, "Logged out.")
 	}
 }
@@ -170,23 +261,25 @@ func Authenticated(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie(AUTH_COOKIE)
 		if err != nil {
-			log.Warn("Unauthorized access attempt", "path", r.URL.Path, "ip", r.RemoteAddr)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			log.Warn("Unauthorized access attempt", "path", r.URL.Path, "ip", utils.ClientIP(r))
+			utils.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		claims, err := extractClaims(cookie.Value)
+		claims, err := extractClaims(cookie.Value, sessionToken)
 		if err != nil {
-			log.Warn("Invalid auth token", "path", r.URL.Path, "ip", r.RemoteAddr)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			log.Warn("Invalid auth token", "path", r.URL.Path, "ip", utils.ClientIP(r))
+			utils.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		username := claims["username"].(string)
-		exp := claims["exp"].(float64)
-		if time.Now().After(time.Unix(int64(exp), 0)) {
-			log.Warn("Auth token expired", "path", r.URL.Path, "ip", r.RemoteAddr)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		// other tokens signed with the same secret, like the OIDC login
+		// state, carry no username
+		username, _ := claims["username"].(string)
+		exp, _ := claims["exp"].(float64)
+		if username == "" || time.Now().After(time.Unix(int64(exp), 0)) {
+			log.Warn("Auth token expired", "path", r.URL.Path, "ip", utils.ClientIP(r))
+			utils.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
@@ -196,10 +289,89 @@ func Authenticated(next http.Handler) http.Handler {
 	})
 }
 
+// Admin restricts a handler to admin users. It must be wrapped by Authenticated.
+func Admin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username := utils.ExtractContextUser(r)
+		if !IsAdmin(username) {
+			log.Warn("Forbidden admin access attempt", "path", r.URL.Path, "user", username)
+			utils.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func IsAdmin(username string) bool {
+	user, err := users.GetByUsername(username)
+	return err == nil && user.Role == RoleAdmin
+}
+
+// CreateUser adds a user with a password and runs the OnRegister hooks,
+// as signing up does.
+func CreateUser(username string, password string) error {
+	if err := registerNewUser(username, password); err != nil {
+		return err
+	}
+	for _, hook := range OnRegister {
+		hook(username)
+	}
+	return nil
+}
+
+// Role returns the role of a user.
+func Role(username string) (string, error) {
+	user, err := users.GetByUsername(username)
+	if err != nil {
+		return "", err
+	}
+	return user.Role, nil
+}
+
+// SetRole makes a user an admin or a regular user.
+func SetRole(username string, role string) error {
+	if role != RoleAdmin && role != RoleUser {
+		return fmt.Errorf("invalid role %q", role)
+	}
+	return users.SetRole(username, role)
+}
+
+// SetPassword replaces the password of a user, and with resetTwoFactor also
+// turns off their two-factor authentication, to recover a locked out
+// account.
+func SetPassword(username string, password string, resetTwoFactor bool) error {
+	if _, err := users.GetByUsername(username); err != nil {
+		return fmt.Errorf("user %q not found", username)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := users.Update(&User{Username: username, passHash: string(hash)}); err != nil {
+		return err
+	}
+	if resetTwoFactor {
+		return twoFactor.Delete(username)
+	}
+	return nil
+}
+
+// Usernames returns the names of every user.
+func Usernames() []string {
+	all := users.GetAll()
+	names := make([]string, 0, len(all))
+	for _, u := range all {
+		names = append(names, u.Username)
+	}
+	return names
+}
+
 func GetAuthStatus() http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var status = AuthStatus{
 			Authenticated: false,
+			OIDC:          oidc != nil,
+			Registration:  RegistrationMode(),
 		}
 
 		cookie, err := r.Cookie(AUTH_COOKIE)
@@ -209,8 +381,8 @@ func GetAuthStatus() http.HandlerFunc {
 			return
 		}
 
-		claims, err := extractClaims(cookie.Value)
-		if err == nil && claims["username"] != "" {
+		claims, err := extractClaims(cookie.Value, sessionToken)
+		if username, _ := claims["username"].(string); err == nil && username != "" {
 			status.Authenticated = true
 		}
 
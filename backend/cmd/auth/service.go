@@ -8,12 +8,20 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Token types keep apart the tokens signed with JWT_SECRET, so the OIDC
+// login state can never stand in for a session.
+const (
+	sessionToken   = "session"
+	oidcStateToken = "oidc_state"
+)
+
 func generateJWT(username string) (string, error) {
 	if JWT_SECRET == "" {
 		return "", fmt.Errorf("JWT_SECRET environment variable not set")
 	}
 
 	claims := jwt.MapClaims{
+		"typ":      sessionToken,
 		"username": username,
 		"exp":      time.Now().Add(7 * 24 * time.Hour).Unix(),
 		"iat":      time.Now().Unix(),
@@ -28,7 +36,9 @@ func generateJWT(username string) (string, error) {
 	return signedToken, nil
 }
 
-func extractClaims(token string) (map[string]any, error) {
+// extractClaims verifies a token of type typ. Sessions issued before tokens
+// had a type carry none.
+func extractClaims(token string, typ string) (map[string]any, error) {
 	parsedToken, err := jwt.Parse(token, keyFunc)
 	if err != nil {
 		return nil, err
@@ -38,6 +48,9 @@ func extractClaims(token string) (map[string]any, error) {
 	if !ok || !parsedToken.Valid {
 		return nil, fmt.Errorf("Invalid token")
 	}
+	if got, _ := claims["typ"].(string); got != typ && (got != "" || typ != sessionToken) {
+		return nil, fmt.Errorf("Invalid token type")
+	}
 
 	return claims, nil
 }
@@ -0,0 +1,325 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/audit"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+const (
+	totpIssuer = "AI UI"
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is the number of time steps accepted on each side of now
+	// to allow for clock drift between the server and the device.
+	totpSkew          = 1
+	recoveryCodeCount = 10
+	// maxCodeFailures invalid codes in a row lock the codes of a user
+	// for codeLockout, which keeps the million TOTP codes out of reach
+	// of guessing
+	maxCodeFailures = 5
+	codeLockout     = 15 * time.Minute
+)
+
+var (
+	errTOTPRequired = errors.New("Two-factor code required")
+	errInvalidCode  = errors.New("Invalid two-factor code")
+	errCodesLocked  = errors.New("Too many invalid two-factor codes, try again later")
+)
+
+var base32NoPad = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TwoFactorStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+func newTOTPSecret() string {
+	secret := make([]byte, 20)
+	rand.Read(secret)
+	return base32NoPad.EncodeToString(secret)
+}
+
+func totpURL(username string, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(totpIssuer) + ":" + url.PathEscape(username)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// hotp computes the RFC 4226 code of a counter.
+func hotp(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
+
+// matchTOTP returns the time step code is valid for, if any.
+func matchTOTP(secret string, code string, now time.Time) (int64, bool) {
+	key, err := base32NoPad.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, counter)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+func newRecoveryCodes() (codes []string, hashes []string) {
+	for range recoveryCodeCount {
+		raw := strings.ToLower(rand.Text()[:10])
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashRecoveryCode(raw))
+	}
+	return codes, hashes
+}
+
+// hashRecoveryCode hashes a code ignoring case and separators. Recovery
+// codes are random, so a plain hash is enough to keep them unreadable.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkSecondFactor accepts a login for users without two-factor auth, and
+// otherwise requires a TOTP code or an unused recovery code. Invalid codes
+// count towards the lockout of the user.
+func checkSecondFactor(r *http.Request, username string, code string) error {
+	tf, err := twoFactor.Get(username)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !tf.Enabled) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if locked(tf) {
+		return errCodesLocked
+	}
+
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return errTOTPRequired
+	}
+
+	valid, err := useCode(tf, username, code)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return codeFailed(r, username)
+	}
+	return codeAccepted(tf, username)
+}
+
+// useCode consumes a TOTP code or a recovery code, reporting whether it was
+// valid.
+func useCode(tf *TwoFactor, username string, code string) (bool, error) {
+	if counter, ok := matchTOTP(tf.Secret, code, time.Now()); ok {
+		return twoFactor.AdvanceCounter(username, counter)
+	}
+	used, err := twoFactor.UseRecoveryCode(username, hashRecoveryCode(code))
+	if used {
+		log.Info("Recovery code used", "user", username)
+	}
+	return used, err
+}
+
+func locked(tf *TwoFactor) bool {
+	return tf.LockedUntil != nil && time.Now().Before(*tf.LockedUntil)
+}
+
+// codeFailed counts an invalid code and records the lockout it may cause.
+// It returns errCodesLocked once the user is locked out, errInvalidCode
+// otherwise.
+func codeFailed(r *http.Request, username string) error {
+	until, err := twoFactor.RecordFailure(username, maxCodeFailures, codeLockout)
+	if err != nil {
+		return err
+	}
+	if until == nil {
+		return errInvalidCode
+	}
+	log.Warn("Two-factor codes locked after repeated failures", "user", username, "until", until)
+	audit.Record(r, username, audit.TwoFactorLocked, username, map[string]string{"until": until.Format(time.RFC3339)})
+	return errCodesLocked
+}
+
+// codeAccepted starts the count of invalid codes again.
+func codeAccepted(tf *TwoFactor, username string) error {
+	if tf.FailedAttempts == 0 && tf.LockedUntil == nil {
+		return nil
+	}
+	return twoFactor.ResetFailures(username)
+}
+
+// respondCodesLocked answers a request refused during a lockout.
+func respondCodesLocked(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(codeLockout.Seconds())))
+	utils.RespondWithError(w, apierr.RateLimited, errCodesLocked.Error(), http.StatusTooManyRequests)
+}
+
+func GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	username := utils.ExtractContextUser(r)
+	tf, err := twoFactor.Get(username)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Error("Error retrieving two-factor status", "err", err)
+		utils.Error(w, "Failed to retrieve two-factor status", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, TwoFactorStatus{Enabled: tf != nil && tf.Enabled}, http.StatusOK)
+}
+
+// SetupTwoFactor starts enrollment by generating a new secret. It is not
+// enforced until confirmed with VerifyTwoFactor.
+func SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	username := utils.ExtractContextUser(r)
+	if tf, err := twoFactor.Get(username); err == nil && tf.Enabled {
+		utils.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret := newTOTPSecret()
+	if err := twoFactor.SavePending(username, secret); err != nil {
+		log.Error("Error saving two-factor secret", "err", err)
+		utils.Error(w, "Failed to set up two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, TwoFactorSetup{Secret: secret, URL: totpURL(username, secret)}, http.StatusOK)
+}
+
+// VerifyTwoFactor confirms enrollment with a first code and returns the
+// recovery codes, which are only shown once.
+func VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	username := utils.ExtractContextUser(r)
+	var req TwoFactorCodeRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tf, err := twoFactor.Get(username)
+	if err != nil {
+		utils.Error(w, "Two-factor setup has not been started", http.StatusBadRequest)
+		return
+	}
+	if tf.Enabled {
+		utils.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if locked(tf) {
+		respondCodesLocked(w)
+		return
+	}
+
+	counter, ok := matchTOTP(tf.Secret, strings.TrimSpace(req.Code), time.Now())
+	if !ok {
+		respondCodeFailed(w, r, username, codeFailed(r, username))
+		return
+	}
+	if err := codeAccepted(tf, username); err != nil {
+		log.Error("Error resetting two-factor failures", "err", err)
+	}
+
+	codes, hashes := newRecoveryCodes()
+	if err := twoFactor.Enable(username, counter, hashes); err != nil {
+		log.Error("Error enabling two-factor authentication", "err", err)
+		utils.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	log.Info("Two-factor authentication enabled", "user", username)
+	audit.Record(r, username, audit.TwoFactorEnable, username, nil)
+
+	utils.RespondWithJSON(w, RecoveryCodes{RecoveryCodes: codes}, http.StatusOK)
+}
+
+// DisableTwoFactor turns two-factor login off. It takes a current code or
+// a recovery code so a stolen session alone cannot remove it.
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	username := utils.ExtractContextUser(r)
+	var req TwoFactorCodeRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tf, err := twoFactor.Get(username)
+	if err != nil || !tf.Enabled {
+		utils.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	if err := checkSecondFactor(r, username, req.Code); err != nil {
+		respondCodeFailed(w, r, username, err)
+		return
+	}
+
+	if err := twoFactor.Delete(username); err != nil {
+		log.Error("Error disabling two-factor authentication", "err", err)
+		utils.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	log.Info("Two-factor authentication disabled", "user", username)
+	audit.Record(r, username, audit.TwoFactorDisable, username, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondCodeFailed answers a code refused by /2fa/verify or /2fa/disable
+// and records it.
+func respondCodeFailed(w http.ResponseWriter, r *http.Request, username string, err error) {
+	switch {
+	case errors.Is(err, errCodesLocked):
+		respondCodesLocked(w)
+	case errors.Is(err, errInvalidCode), errors.Is(err, errTOTPRequired):
+		audit.Record(r, username, audit.TwoFactorFailed, username, nil)
+		utils.Error(w, errInvalidCode.Error(), http.StatusBadRequest)
+	default:
+		log.Error("Error checking two-factor code", "err", err)
+		utils.Error(w, "Failed to verify two-factor code", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHOTPVectors(t *testing.T) {
+	// RFC 4226 appendix D
+	key := []byte("12345678901234567890")
+	want := []string{"755224", "287082", "359152", "969429", "338314"}
+	for counter, code := range want {
+		if got := hotp(key, int64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	secret := newTOTPSecret()
+	key, _ := base32NoPad.DecodeString(secret)
+	now := time.Unix(1_700_000_000, 0)
+	step := now.Unix() / totpPeriod
+
+	if counter, ok := matchTOTP(secret, hotp(key, step-1), now); !ok || counter != step-1 {
+		t.Errorf("expected the previous step to be accepted")
+	}
+	if _, ok := matchTOTP(secret, hotp(key, step+2), now); ok {
+		t.Errorf("expected a code outside the skew to be rejected")
+	}
+	if _, ok := matchTOTP(secret, "12345", now); ok {
+		t.Errorf("expected a short code to be rejected")
+	}
+}
+
+func twoFactorRequest(t *testing.T, handler http.HandlerFunc, code string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(TwoFactorCodeRequest{Code: code})
+	req := httptest.NewRequest("POST", "/2fa", bytes.NewBuffer(body))
+	req = req.WithContext(context.WithValue(req.Context(), "user", "testuser"))
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func loginWithCode(code string) *httptest.ResponseRecorder {
+	form := url.Values{"username": {"testuser"}, "password": {"password123"}, "code": {code}}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	Login().ServeHTTP(w, req)
+	return w
+}
+
+func TestTwoFactorEnrollmentAndLogin(t *testing.T) {
+	repo := setupTest()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	repo.users["testuser"] = &User{Username: "testuser", passHash: string(hash)}
+
+	w := twoFactorRequest(t, SetupTwoFactor, "")
+	var setup TwoFactorSetup
+	json.NewDecoder(w.Body).Decode(&setup)
+	if w.Code != http.StatusOK || !strings.HasPrefix(setup.URL, "otpauth://totp/") {
+		t.Fatalf("setup: status %d, url %q", w.Code, setup.URL)
+	}
+
+	// a pending secret is not enforced yet
+	if w := loginWithCode(""); w.Code != http.StatusOK {
+		t.Fatalf("login before verification: status %d", w.Code)
+	}
+
+	key, _ := base32NoPad.DecodeString(setup.Secret)
+	step := time.Now().Unix() / totpPeriod
+	if w := twoFactorRequest(t, VerifyTwoFactor, "000000"); w.Code != http.StatusBadRequest {
+		t.Errorf("verify with a wrong code: status %d", w.Code)
+	}
+	w = twoFactorRequest(t, VerifyTwoFactor, hotp(key, step-1))
+	var recovery RecoveryCodes
+	json.NewDecoder(w.Body).Decode(&recovery)
+	if w.Code != http.StatusOK || len(recovery.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("verify: status %d, %d recovery codes", w.Code, len(recovery.RecoveryCodes))
+	}
+
+	w = loginWithCode("")
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "TOTP_REQUIRED") {
+		t.Errorf("login without a code: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := loginWithCode(hotp(key, step)); w.Code != http.StatusOK {
+		t.Errorf("login with a valid code: status %d", w.Code)
+	}
+	if w := loginWithCode(hotp(key, step)); w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed code: status %d", w.Code)
+	}
+
+	code := strings.ToUpper(recovery.RecoveryCodes[0])
+	if w := loginWithCode(code); w.Code != http.StatusOK {
+		t.Errorf("login with a recovery code: status %d", w.Code)
+	}
+	if w := loginWithCode(code); w.Code != http.StatusUnauthorized {
+		t.Errorf("reused recovery code: status %d", w.Code)
+	}
+
+	if w := twoFactorRequest(t, DisableTwoFactor, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("disable without a code: status %d", w.Code)
+	}
+	if w := twoFactorRequest(t, DisableTwoFactor, recovery.RecoveryCodes[1]); w.Code != http.StatusNoContent {
+		t.Fatalf("disable: status %d", w.Code)
+	}
+	if w := loginWithCode(""); w.Code != http.StatusOK {
+		t.Errorf("login after disabling: status %d", w.Code)
+	}
+}
+
+// enrollTwoFactor turns on two-factor login for testuser and returns the
+// TOTP key.
+func enrollTwoFactor(t *testing.T) []byte {
+	t.Helper()
+	var setup TwoFactorSetup
+	json.NewDecoder(twoFactorRequest(t, SetupTwoFactor, "").Body).Decode(&setup)
+	key, _ := base32NoPad.DecodeString(setup.Secret)
+	if w := twoFactorRequest(t, VerifyTwoFactor, hotp(key, time.Now().Unix()/totpPeriod-1)); w.Code != http.StatusOK {
+		t.Fatalf("verify: status %d", w.Code)
+	}
+	return key
+}
+
+func TestTwoFactorLockout(t *testing.T) {
+	repo := setupTest()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	repo.users["testuser"] = &User{Username: "testuser", passHash: string(hash)}
+	key := enrollTwoFactor(t)
+	step := time.Now().Unix() / totpPeriod
+
+	for i := 1; i < maxCodeFailures; i++ {
+		if w := loginWithCode("000000"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("invalid code %d: status %d", i, w.Code)
+		}
+	}
+	w := loginWithCode("000000")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected the last invalid code to lock the codes, got %d", w.Code)
+	}
+
+	// a valid code is refused too while locked, on every endpoint
+	if w := loginWithCode(hotp(key, step)); w.Code != http.StatusTooManyRequests {
+		t.Errorf("valid code while locked: status %d", w.Code)
+	}
+	if w := twoFactorRequest(t, DisableTwoFactor, hotp(key, step)); w.Code != http.StatusTooManyRequests {
+		t.Errorf("disable while locked: status %d", w.Code)
+	}
+
+	mock := twoFactor.(*MockTwoFactorRepository)
+	past := time.Now().Add(-time.Minute)
+	mock.state["testuser"].LockedUntil = &past
+	if w := loginWithCode("000000"); w.Code != http.StatusUnauthorized {
+		t.Errorf("invalid code after the lockout: status %d", w.Code)
+	}
+	if w := loginWithCode(hotp(key, step)); w.Code != http.StatusOK {
+		t.Fatalf("valid code after the lockout: status %d", w.Code)
+	}
+	if tf := mock.state["testuser"]; tf.FailedAttempts != 0 || tf.LockedUntil != nil {
+		t.Errorf("expected a valid code to reset the failures, got %+v", tf)
+	}
+
+	for i := 1; i < maxCodeFailures; i++ {
+		if w := twoFactorRequest(t, DisableTwoFactor, "000000"); w.Code != http.StatusBadRequest {
+			t.Fatalf("invalid disable code %d: status %d", i, w.Code)
+		}
+	}
+	if w := twoFactorRequest(t, DisableTwoFactor, "000000"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected invalid disable codes to lock the codes, got %d", w.Code)
+	}
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+)
+
+// TwoFactor is the TOTP state of a user. A secret is stored as soon as
+// setup starts, but is only enforced once a first code verified it.
+type TwoFactor struct {
+	Secret      string
+	Enabled     bool
+	LastCounter int64
+	// FailedAttempts counts invalid codes since the last valid one
+	FailedAttempts int
+	// LockedUntil is set while codes are refused after too many failures
+	LockedUntil *time.Time
+}
+
+type TwoFactorRepository interface {
+	Get(username string) (*TwoFactor, error)
+	SavePending(username string, secret string) error
+	Enable(username string, counter int64, recoveryHashes []string) error
+	AdvanceCounter(username string, counter int64) (bool, error)
+	UseRecoveryCode(username string, hash string) (bool, error)
+	RecordFailure(username string, limit int, lockout time.Duration) (*time.Time, error)
+	ResetFailures(username string) error
+	Delete(username string) error
+}
+
+type TwoFactorRepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewTwoFactorRepository(db *sql.DB) TwoFactorRepository {
+	return &TwoFactorRepositoryImpl{db: db}
+}
+
+func (r *TwoFactorRepositoryImpl) Get(username string) (*TwoFactor, error) {
+	var tf TwoFactor
+	err := r.db.QueryRow(
+		`SELECT secret, enabled, last_counter, failed_attempts, locked_until FROM TwoFactor WHERE user = ?`,
+		username,
+	).Scan(&tf.Secret, &tf.Enabled, &tf.LastCounter, &tf.FailedAttempts, &tf.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return &tf, nil
+}
+
+func (r *TwoFactorRepositoryImpl) SavePending(username string, secret string) error {
+	_, err := r.db.Exec(
+		`INSERT INTO TwoFactor (user, secret, enabled, last_counter) VALUES (?, ?, 0, 0)
+		ON CONFLICT(user) DO UPDATE SET secret = excluded.secret, enabled = 0, last_counter = 0`,
+		username, secret,
+	)
+	return err
+}
+
+// Enable turns on two-factor login and replaces the recovery codes.
+func (r *TwoFactorRepositoryImpl) Enable(username string, counter int64, recoveryHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`UPDATE TwoFactor SET enabled = 1, last_counter = ? WHERE user = ?`,
+		counter, username,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM RecoveryCodes WHERE user = ?`, username); err != nil {
+		return err
+	}
+	for _, hash := range recoveryHashes {
+		if _, err := tx.Exec(
+			`INSERT INTO RecoveryCodes (user, code_hash) VALUES (?, ?)`,
+			username, hash,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AdvanceCounter records the time step of a used code. It reports false
+// when that step or a later one was already used, so codes cannot be replayed.
+func (r *TwoFactorRepositoryImpl) AdvanceCounter(username string, counter int64) (bool, error) {
+	res, err := r.db.Exec(
+		`UPDATE TwoFactor SET last_counter = ? WHERE user = ? AND last_counter < ?`,
+		counter, username, counter,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// UseRecoveryCode consumes a recovery code, reporting whether it existed.
+func (r *TwoFactorRepositoryImpl) UseRecoveryCode(username string, hash string) (bool, error) {
+	res, err := r.db.Exec(
+		`DELETE FROM RecoveryCodes WHERE id = (
+			SELECT id FROM RecoveryCodes WHERE user = ? AND code_hash = ? LIMIT 1
+		)`,
+		username, hash,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RecordFailure counts an invalid code. The limit-th failure in a row locks
+// the user out for lockout and starts the count again, the end of the
+// lockout is returned then.
+func (r *TwoFactorRepositoryImpl) RecordFailure(username string, limit int, lockout time.Duration) (*time.Time, error) {
+	var failures int
+	err := r.db.QueryRow(
+		`UPDATE TwoFactor SET failed_attempts = failed_attempts + 1 WHERE user = ? RETURNING failed_attempts`,
+		username,
+	).Scan(&failures)
+	if err != nil || failures < limit {
+		return nil, err
+	}
+	until := time.Now().UTC().Add(lockout)
+	_, err = r.db.Exec(
+		`UPDATE TwoFactor SET failed_attempts = 0, locked_until = ? WHERE user = ?`,
+		until, username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &until, nil
+}
+
+// ResetFailures clears the count of invalid codes after a valid one.
+func (r *TwoFactorRepositoryImpl) ResetFailures(username string) error {
+	_, err := r.db.Exec(
+		`UPDATE TwoFactor SET failed_attempts = 0, locked_until = NULL WHERE user = ?`,
+		username,
+	)
+	return err
+}
+
+func (r *TwoFactorRepositoryImpl) Delete(username string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM TwoFactor WHERE user = ?`, username); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM RecoveryCodes WHERE user = ?`, username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
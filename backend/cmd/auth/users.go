@@ -6,9 +6,15 @@ import (
 	"strings"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	ID       int64  `json:"id"`
 	Username string `json:"username"`
+	Role     string `json:"role"`
 	passHash string `json:"-"`
 }
 
@@ -17,6 +23,10 @@ type UserRepository interface {
 	GetByUsername(username string) (*User, error)
 	Save(user *User) error
 	Update(user *User) error
+	GetByOIDCSubject(subject string) (*User, error)
+	SaveOIDC(user *User, subject string) error
+	LinkOIDC(username string, subject string) error
+	SetRole(username string, role string) error
 }
 
 type UserRepositoryImpl struct {
@@ -28,7 +38,7 @@ func NewUserRepository(db *sql.DB) UserRepository {
 }
 
 func (r *UserRepositoryImpl) GetAll() []*User {
-	query := `SELECT id, username FROM users`
+	query := `SELECT id, username, role FROM users`
 	rows, err := r.db.Query(query)
 	if err != nil {
 		log.Error("Error retrieving users", "err", err)
@@ -42,6 +52,7 @@ func (r *UserRepositoryImpl) GetAll() []*User {
 		if err := rows.Scan(
 			&user.ID,
 			&user.Username,
+			&user.Role,
 		); err != nil {
 
 			log.Error("Error scanning user row", "err", err)
@@ -54,12 +65,13 @@ func (r *UserRepositoryImpl) GetAll() []*User {
 }
 
 func (r *UserRepositoryImpl) GetByUsername(username string) (*User, error) {
-	query := `SELECT id, username, pass_hash FROM users WHERE username = ?`
+	query := `SELECT id, username, pass_hash, role FROM users WHERE username = ?`
 	var user User
 	err := r.db.QueryRow(query, username).Scan(
 		&user.ID,
 		&user.Username,
 		&user.passHash,
+		&user.Role,
 	)
 
 	if err != nil {
@@ -70,8 +82,10 @@ func (r *UserRepositoryImpl) GetByUsername(username string) (*User, error) {
 }
 
 func (r *UserRepositoryImpl) Save(user *User) error {
+	// the very first user of an instance becomes its admin
 	_, err := r.db.Exec(
-		`INSERT INTO users (username, pass_hash) VALUES (?, ?)`,
+		`INSERT INTO users (username, pass_hash, role)
+		VALUES (?, ?, CASE WHEN EXISTS (SELECT 1 FROM users) THEN 'user' ELSE 'admin' END)`,
 		user.Username, user.passHash,
 	)
 	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
@@ -88,3 +102,51 @@ func (r *UserRepositoryImpl) Update(user *User) error {
 	)
 	return err
 }
+
+func (r *UserRepositoryImpl) GetByOIDCSubject(subject string) (*User, error) {
+	query := `SELECT id, username, pass_hash, role FROM users WHERE oidc_subject = ?`
+	var user User
+	err := r.db.QueryRow(query, subject).Scan(
+		&user.ID,
+		&user.Username,
+		&user.passHash,
+		&user.Role,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// SaveOIDC stores a user signing in through an OIDC provider. Such users
+// have no password, so they cannot use the password login.
+func (r *UserRepositoryImpl) SaveOIDC(user *User, subject string) error {
+	_, err := r.db.Exec(
+		`INSERT INTO users (username, pass_hash, role, oidc_subject)
+		VALUES (?, '', CASE WHEN EXISTS (SELECT 1 FROM users) THEN 'user' ELSE 'admin' END, ?)`,
+		user.Username, subject,
+	)
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return errors.New("Username already exists")
+	}
+
+	return err
+}
+
+func (r *UserRepositoryImpl) LinkOIDC(username string, subject string) error {
+	_, err := r.db.Exec(
+		`UPDATE users SET oidc_subject = ? WHERE username = ?`,
+		subject, username,
+	)
+	return err
+}
+
+func (r *UserRepositoryImpl) SetRole(username string, role string) error {
+	_, err := r.db.Exec(
+		`UPDATE users SET role = ? WHERE username = ?`,
+		role, username,
+	)
+	return err
+}
@@ -0,0 +1,114 @@
+package bridge
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Bajahaw/ai-ui/cmd/chat"
+)
+
+const (
+	PlatformTelegram = "telegram"
+	PlatformSlack    = "slack"
+
+	replyTimeout = 10 * time.Minute
+)
+
+// ask is the chat pipeline, replaced in tests
+var ask = chat.Ask
+
+// chatLocks serializes the messages of one chat, so each question is
+// asked after the previous answer was saved.
+var chatLocks sync.Map // platform:chatID -> *sync.Mutex
+
+// handleMessage answers a message from a bridged chat as the user the
+// bridge acts for. "/new" starts a new conversation, any other text
+// continues the conversation of the chat.
+func handleMessage(platform string, chatID string, user string, text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+
+	lock, _ := chatLocks.LoadOrStore(platform+":"+chatID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	command, _, _ := strings.Cut(text, " ")
+	switch command {
+	case "/new", "/start":
+		if err := repo.Delete(platform, chatID); err != nil {
+			log.Error("Error resetting bridged chat", "platform", platform, "err", err)
+			return "Could not start a new conversation, try again later."
+		}
+		return "Started a new conversation."
+	}
+
+	link, err := repo.Get(platform, chatID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Error("Error querying bridged chat", "platform", platform, "err", err)
+		return "Something went wrong, try again later."
+	}
+	var convID string
+	var parentID int
+	// a chat moved to another user starts over
+	if link != nil && link.User == user {
+		convID, parentID = link.ConvID, link.LastMessageID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), replyTimeout)
+	defer cancel()
+	reply, err := ask(ctx, user, convID, parentID, text)
+	if err != nil {
+		log.Error("Error answering bridged message", "platform", platform, "err", err)
+		return "Error: " + err.Error()
+	}
+
+	err = repo.Save(&Chat{
+		Platform:      platform,
+		ChatID:        chatID,
+		User:          user,
+		ConvID:        reply.ConversationID,
+		LastMessageID: reply.MessageID,
+	})
+	if err != nil {
+		log.Error("Error saving bridged chat", "platform", platform, "err", err)
+	}
+
+	switch {
+	case reply.Error != "" && reply.Content != "":
+		return reply.Content + "\n\n(Error: " + reply.Error + ")"
+	case reply.Error != "":
+		return "Error: " + reply.Error
+	case reply.Content == "":
+		return "(empty response)"
+	}
+	return reply.Content
+}
+
+// splitMessage cuts text into parts of at most limit bytes, preferring
+// line breaks, for platforms that limit the message length.
+func splitMessage(text string, limit int) []string {
+	var parts []string
+	for len(text) > limit {
+		cut := strings.LastIndex(text[:limit], "\n")
+		if cut <= 0 {
+			cut = limit
+			// do not split a multi-byte character
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		parts = append(parts, text[:cut])
+		text = strings.TrimLeft(text[cut:], "\n")
+	}
+	if text != "" {
+		parts = append(parts, text)
+	}
+	return parts
+}
@@ -0,0 +1,156 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Bajahaw/ai-ui/cmd/chat"
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+type askCall struct {
+	convID   string
+	parentID int
+	content  string
+}
+
+// fakeAsk answers every question in conversation c1, recording what it
+// was asked.
+func fakeAsk(t *testing.T) *[]askCall {
+	calls := &[]askCall{}
+	original := ask
+	ask = func(ctx context.Context, user string, convID string, parentID int, content string) (*chat.Reply, error) {
+		*calls = append(*calls, askCall{convID, parentID, content})
+		return &chat.Reply{ConversationID: "c1", MessageID: len(*calls) * 10, Content: "answer to " + content}, nil
+	}
+	t.Cleanup(func() { ask = original })
+	return calls
+}
+
+func setupTest(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	_, err := db.Exec(`
+		INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash');
+		INSERT INTO Conversations (id, user, title) VALUES ('c1', 'u', 'bridged');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetupBridge(logger.New(os.Stdout), db)
+}
+
+func TestHandleMessage(t *testing.T) {
+	setupTest(t)
+	calls := fakeAsk(t)
+
+	if got := handleMessage(PlatformTelegram, "42", "u", "hi"); got != "answer to hi" {
+		t.Errorf("unexpected reply %q", got)
+	}
+	handleMessage(PlatformTelegram, "42", "u", "more")
+	handleMessage(PlatformTelegram, "42", "u", "/new")
+	handleMessage(PlatformTelegram, "42", "u", "fresh")
+
+	want := []askCall{{"", 0, "hi"}, {"c1", 10, "more"}, {"", 0, "fresh"}}
+	if len(*calls) != len(want) {
+		t.Fatalf("expected %d questions, got %v", len(want), *calls)
+	}
+	for i, c := range *calls {
+		if c != want[i] {
+			t.Errorf("question %d: got %+v, want %+v", i, c, want[i])
+		}
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	text := strings.Repeat("a", 6) + "\n" + strings.Repeat("é", 5)
+	parts := splitMessage(text, 8)
+	if strings.Join(parts, "") != strings.ReplaceAll(text, "\n", "") {
+		t.Errorf("expected the parts to add up to the text, got %q", parts)
+	}
+	for _, p := range parts {
+		if len(p) > 8 || !utf8.ValidString(p) {
+			t.Errorf("invalid part %q", p)
+		}
+	}
+}
+
+func TestSlackEvents(t *testing.T) {
+	setupTest(t)
+	calls := fakeAsk(t)
+
+	posted := make(chan string, 1)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			t.Errorf("missing bot token")
+		}
+		var buf bytes.Buffer
+		buf.ReadFrom(r.Body)
+		posted <- buf.String()
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer api.Close()
+	original := slackAPI
+	slackAPI = api.URL
+	defer func() { slackAPI = original }()
+
+	slack = newSlackApp("xoxb-test", "secret", "u", nil)
+	defer func() { slack = nil }()
+
+	send := func(body string, sign bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/bridge/slack/events", strings.NewReader(body))
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Slack-Request-Timestamp", ts)
+		secret := "secret"
+		if !sign {
+			secret = "wrong"
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+		req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+		rr := httptest.NewRecorder()
+		Handler().ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send(`{"type":"url_verification","challenge":"abc"}`, false); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a bad signature, got %d", rr.Code)
+	}
+	if rr := send(`{"type":"url_verification","challenge":"abc"}`, true); !strings.Contains(rr.Body.String(), "abc") {
+		t.Errorf("expected the challenge echoed, got %s", rr.Body.String())
+	}
+
+	rr := send(`{"type":"event_callback","event":{"type":"app_mention","user":"U1","text":"<@UBOT> hello","channel":"C1","ts":"1.5"}}`, true)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	select {
+	case body := <-posted:
+		if !strings.Contains(body, `"thread_ts":"1.5"`) || !strings.Contains(body, "answer to hello") {
+			t.Errorf("unexpected reply %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply was posted")
+	}
+	if len(*calls) != 1 || (*calls)[0].content != "hello" {
+		t.Errorf("expected the mention to be stripped, got %+v", *calls)
+	}
+}
@@ -0,0 +1,69 @@
+package bridge
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+
+	logger "github.com/charmbracelet/log"
+)
+
+var log *logger.Logger
+var repo Repository
+var slack *slackApp
+
+// SetupBridge starts the bots configured in the environment. Each acts as
+// one ai-ui user and answers with that user's default model and settings:
+//   - Telegram: TELEGRAM_BOT_TOKEN, TELEGRAM_BRIDGE_USER and the chat IDs
+//     it may answer in TELEGRAM_ALLOWED_CHATS
+//   - Slack: SLACK_BOT_TOKEN, SLACK_SIGNING_SECRET, SLACK_BRIDGE_USER and
+//     optionally SLACK_ALLOWED_USERS, with events sent to
+//     /api/bridge/slack/events
+func SetupBridge(l *logger.Logger, db *sql.DB) {
+	log = l
+	repo = NewRepository(db)
+
+	if token := os.Getenv("TELEGRAM_BOT_TOKEN"); token != "" {
+		user := os.Getenv("TELEGRAM_BRIDGE_USER")
+		allowed := splitList(os.Getenv("TELEGRAM_ALLOWED_CHATS"))
+		if userExists(db, user) {
+			if len(allowed) == 0 {
+				log.Warn("TELEGRAM_ALLOWED_CHATS is empty, the Telegram bot will answer no chat")
+			}
+			go newTelegramBot(token, user, allowed).run()
+			log.Info("Telegram bridge enabled", "user", user)
+		} else {
+			log.Error("Telegram bridge disabled, TELEGRAM_BRIDGE_USER is not a user", "user", user)
+		}
+	}
+
+	if token := os.Getenv("SLACK_BOT_TOKEN"); token != "" {
+		user := os.Getenv("SLACK_BRIDGE_USER")
+		secret := os.Getenv("SLACK_SIGNING_SECRET")
+		switch {
+		case secret == "":
+			log.Error("Slack bridge disabled, SLACK_SIGNING_SECRET is required")
+		case !userExists(db, user):
+			log.Error("Slack bridge disabled, SLACK_BRIDGE_USER is not a user", "user", user)
+		default:
+			slack = newSlackApp(token, secret, user, splitList(os.Getenv("SLACK_ALLOWED_USERS")))
+			log.Info("Slack bridge enabled", "user", user)
+		}
+	}
+}
+
+func userExists(db *sql.DB, user string) bool {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM Users WHERE username = ?)`, user).Scan(&exists)
+	return err == nil && exists
+}
+
+func splitList(v string) []string {
+	var list []string
+	for item := range strings.SplitSeq(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
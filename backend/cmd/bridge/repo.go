@@ -0,0 +1,59 @@
+package bridge
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Chat links a Telegram or Slack chat to the conversation it continues.
+type Chat struct {
+	Platform string
+	ChatID   string
+	User     string
+	ConvID   string
+	// LastMessageID is the last answer, the next message is its reply
+	LastMessageID int
+}
+
+type Repository interface {
+	Get(platform string, chatID string) (*Chat, error)
+	Save(chat *Chat) error
+	Delete(platform string, chatID string) error
+}
+
+type RepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) Get(platform string, chatID string) (*Chat, error) {
+	query := `SELECT platform, chat_id, user, conv_id, last_message_id FROM BridgeChats WHERE platform = ? AND chat_id = ?`
+	var c Chat
+	err := r.db.QueryRow(query, platform, chatID).Scan(&c.Platform, &c.ChatID, &c.User, &c.ConvID, &c.LastMessageID)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *RepositoryImpl) Save(c *Chat) error {
+	query := `
+		INSERT INTO BridgeChats (platform, chat_id, user, conv_id, last_message_id, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(platform, chat_id) DO UPDATE SET
+			user = excluded.user,
+			conv_id = excluded.conv_id,
+			last_message_id = excluded.last_message_id,
+			updated_at = excluded.updated_at
+	`
+	_, err := r.db.Exec(query, c.Platform, c.ChatID, c.User, c.ConvID, c.LastMessageID, time.Now().UTC())
+	return err
+}
+
+func (r *RepositoryImpl) Delete(platform string, chatID string) error {
+	_, err := r.db.Exec(`DELETE FROM BridgeChats WHERE platform = ? AND chat_id = ?`, platform, chatID)
+	return err
+}
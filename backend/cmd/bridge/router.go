@@ -0,0 +1,28 @@
+package bridge
+
+import (
+	"net/http"
+
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// Handler serves the callbacks of the chat platforms. They are not
+// authenticated with a session, each platform signs its requests instead.
+func Handler() http.Handler {
+	mux := openapi.NewRouter("/api/bridge", "Bridge")
+
+	mux.HandleFunc("POST /slack/events", func(w http.ResponseWriter, r *http.Request) {
+		if slack == nil {
+			utils.Error(w, "Slack bridge is not enabled", http.StatusNotFound)
+			return
+		}
+		slack.events(w, r)
+	}, openapi.Op{
+		Summary:     "Receive Slack Events API callbacks",
+		Description: "Signed by Slack with the app's signing secret.",
+		Public:      true,
+	})
+
+	return http.StripPrefix("/api/bridge", mux)
+}
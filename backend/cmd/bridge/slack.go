@@ -0,0 +1,182 @@
+package bridge
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// slackLimit keeps messages well below what Slack shows without truncating
+const slackLimit = 3900
+
+var slackAPI = "https://slack.com/api"
+
+// slackApp answers direct messages and mentions of a Slack app, which
+// delivers them to the events endpoint.
+type slackApp struct {
+	token         string
+	signingSecret string
+	user          string
+	// allowedUsers are Slack user IDs, empty allows the whole workspace
+	allowedUsers []string
+	client       *http.Client
+}
+
+type slackEnvelope struct {
+	Type      string     `json:"type"`
+	Challenge string     `json:"challenge"`
+	Event     slackEvent `json:"event"`
+}
+
+type slackEvent struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype"`
+	BotID       string `json:"bot_id"`
+	User        string `json:"user"`
+	Text        string `json:"text"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	TS          string `json:"ts"`
+	ThreadTS    string `json:"thread_ts"`
+}
+
+var slackMention = regexp.MustCompile(`<@[A-Z0-9]+>`)
+
+func newSlackApp(token string, signingSecret string, user string, allowedUsers []string) *slackApp {
+	return &slackApp{
+		token:         token,
+		signingSecret: signingSecret,
+		user:          user,
+		allowedUsers:  allowedUsers,
+		client:        &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// events receives the Slack Events API callbacks. Slack wants an answer
+// within 3 seconds, so messages are answered in the background.
+func (s *slackApp) events(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !s.verify(r.Header, body, time.Now()) {
+		utils.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var envelope slackEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	switch envelope.Type {
+	case "url_verification":
+		utils.RespondWithJSON(w, map[string]string{"challenge": envelope.Challenge}, http.StatusOK)
+		return
+	case "event_callback":
+		// a retry means the event was received but answered too late
+		if r.Header.Get("X-Slack-Retry-Num") == "" {
+			if chatID, threadTS, text, ok := s.message(envelope.Event); ok {
+				go s.answer(chatID, envelope.Event.Channel, threadTS, text)
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// message picks the questions out of the events: direct messages and
+// mentions, which are answered in their thread.
+func (s *slackApp) message(e slackEvent) (chatID string, threadTS string, text string, ok bool) {
+	if e.BotID != "" || e.Subtype != "" || e.Text == "" {
+		return "", "", "", false
+	}
+	if len(s.allowedUsers) > 0 && !slices.Contains(s.allowedUsers, e.User) {
+		log.Warn("Slack message from a user that is not allowed", "user", e.User)
+		return "", "", "", false
+	}
+
+	switch {
+	case e.Type == "message" && e.ChannelType == "im":
+		return e.Channel, e.ThreadTS, e.Text, true
+	case e.Type == "app_mention":
+		threadTS = e.ThreadTS
+		if threadTS == "" {
+			threadTS = e.TS
+		}
+		return e.Channel + ":" + threadTS, threadTS, slackMention.ReplaceAllString(e.Text, ""), true
+	}
+	return "", "", "", false
+}
+
+func (s *slackApp) answer(chatID string, channel string, threadTS string, text string) {
+	reply := handleMessage(PlatformSlack, chatID, s.user, text)
+	for _, part := range splitMessage(reply, slackLimit) {
+		if err := s.post(channel, threadTS, part); err != nil {
+			log.Error("Error sending Slack message", "channel", channel, "err", err)
+			return
+		}
+	}
+}
+
+func (s *slackApp) post(channel string, threadTS string, text string) error {
+	params := map[string]string{"channel": channel, "text": text}
+	if threadTS != "" {
+		params["thread_ts"] = threadTS
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, slackAPI+"/chat.postMessage", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("slack chat.postMessage: %s", resp.Status)
+	}
+	if !result.OK {
+		return fmt.Errorf("slack chat.postMessage: %s", result.Error)
+	}
+	return nil
+}
+
+// verify checks the request signature, the HMAC-SHA256 of
+// "v0:<timestamp>:<body>" with the signing secret, and rejects requests
+// older than 5 minutes so they cannot be replayed.
+func (s *slackApp) verify(header http.Header, body []byte, now time.Time) bool {
+	ts, err := strconv.ParseInt(header.Get("X-Slack-Request-Timestamp"), 10, 64)
+	if err != nil || now.Sub(time.Unix(ts, 0)).Abs() > 5*time.Minute {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(s.signingSecret))
+	fmt.Fprintf(mac, "v0:%d:", ts)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature")))
+}
@@ -0,0 +1,127 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// telegramLimit is the longest message Telegram accepts
+const telegramLimit = 4096
+
+var telegramAPI = "https://api.telegram.org"
+
+// telegramBot answers the messages sent to a Telegram bot, found by long
+// polling, so the instance needs no public URL.
+type telegramBot struct {
+	token string
+	user  string
+	// allowed are the chat IDs the bot answers, anyone can message a bot
+	allowed []string
+	client  *http.Client
+}
+
+type telegramUpdate struct {
+	UpdateID int `json:"update_id"`
+	Message  *struct {
+		Text string `json:"text"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		From *struct {
+			IsBot bool `json:"is_bot"`
+		} `json:"from"`
+	} `json:"message"`
+}
+
+func newTelegramBot(token string, user string, allowed []string) *telegramBot {
+	return &telegramBot{
+		token:   token,
+		user:    user,
+		allowed: allowed,
+		// longer than the long polling timeout
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (b *telegramBot) run() {
+	offset := 0
+	for {
+		updates, err := b.getUpdates(offset)
+		if err != nil {
+			log.Error("Error polling Telegram", "err", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if u.Message == nil || u.Message.Text == "" || (u.Message.From != nil && u.Message.From.IsBot) {
+				continue
+			}
+			go b.answer(strconv.FormatInt(u.Message.Chat.ID, 10), u.Message.Text)
+		}
+	}
+}
+
+func (b *telegramBot) answer(chatID string, text string) {
+	if !slices.Contains(b.allowed, chatID) {
+		log.Warn("Telegram message from a chat that is not allowed", "chat", chatID)
+		b.send(chatID, fmt.Sprintf("This chat is not allowed to use the bot, add its ID %s to TELEGRAM_ALLOWED_CHATS.", chatID))
+		return
+	}
+
+	_ = b.call("sendChatAction", map[string]any{"chat_id": chatID, "action": "typing"}, nil)
+	reply := handleMessage(PlatformTelegram, chatID, b.user, text)
+	b.send(chatID, reply)
+}
+
+func (b *telegramBot) send(chatID string, text string) {
+	for _, part := range splitMessage(text, telegramLimit) {
+		if err := b.call("sendMessage", map[string]any{"chat_id": chatID, "text": part}, nil); err != nil {
+			log.Error("Error sending Telegram message", "chat", chatID, "err", err)
+			return
+		}
+	}
+}
+
+func (b *telegramBot) getUpdates(offset int) ([]telegramUpdate, error) {
+	var updates []telegramUpdate
+	params := map[string]any{"offset": offset, "timeout": 30, "allowed_updates": []string{"message"}}
+	err := b.call("getUpdates", params, &updates)
+	return updates, err
+}
+
+// call invokes a Bot API method and decodes its result into v.
+func (b *telegramBot) call(method string, params any, v any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	url := telegramAPI + "/bot" + b.token + "/" + method
+	resp, err := b.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// the URL holds the token, keep it out of the logs
+		return fmt.Errorf("telegram %s request failed", method)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("telegram %s: %s", method, resp.Status)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram %s: %s", method, result.Description)
+	}
+	if v != nil {
+		return json.Unmarshal(result.Result, v)
+	}
+	return nil
+}
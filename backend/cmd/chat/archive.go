@@ -0,0 +1,56 @@
+package chat
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// pinConversation pins (PUT) or unpins (DELETE) a conversation, pinned
+// conversations are never archived or deleted by retention.
+func pinConversation(w http.ResponseWriter, r *http.Request) {
+	changeConversation(w, r, func(conv *Conversation) {
+		conv.Pinned = r.Method == http.MethodPut
+	})
+}
+
+// archiveConversation archives (PUT) a conversation or takes it out of the
+// archive (DELETE). Taking it out counts as an update, so retention does not
+// archive it again right away.
+func archiveConversation(w http.ResponseWriter, r *http.Request) {
+	changeConversation(w, r, func(conv *Conversation) {
+		now := time.Now().UTC()
+		switch {
+		case r.Method == http.MethodDelete:
+			conv.ArchivedAt = nil
+			conv.UpdatedAt = now
+		case conv.ArchivedAt == nil:
+			conv.ArchivedAt = &now
+		}
+	})
+}
+
+func changeConversation(w http.ResponseWriter, r *http.Request, change func(*Conversation)) {
+	user := utils.ExtractContextUser(r)
+	convID := r.PathValue("id")
+	conv, err := conversations.GetByID(convID, user)
+	if err != nil {
+		utils.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	change(conv)
+	if err := conversations.Update(conv); err != nil {
+		log.Error("Error updating conversation", "err", err)
+		utils.Error(w, "Error updating conversation", http.StatusInternalServerError)
+		return
+	}
+
+	syncManager.Broadcast(user, r.Header.Get("X-Session-ID"), SyncEvent{
+		Type:           EventConversationUpdated,
+		ConversationID: convID,
+		Conversation:   conv,
+	})
+	utils.RespondWithJSON(w, conv, http.StatusOK)
+}
@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// Reply is the answer to a message sent with Ask.
+type Reply struct {
+	ConversationID string
+	// MessageID is the assistant message, the parent of the next question
+	MessageID int
+	Content   string
+	// Error is set when the model failed, Content may hold a partial answer
+	Error string
+}
+
+// Ask sends a message through the same pipeline as the chat stream, with
+// the user's default model, tools and settings, and waits for the answer.
+// It is meant for clients that cannot read a stream, such as the bot
+// bridges. An empty or unknown convID starts a new conversation.
+func Ask(ctx context.Context, user string, convID string, parentID int, content string) (*Reply, error) {
+	if convID == "" {
+		convID = uuid.NewString()
+	}
+	model, _ := settings.Get("model", user)
+	body, err := json.Marshal(Request{
+		ConversationID: convID,
+		ParentID:       parentID,
+		Model:          model,
+		Content:        content,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, "user", user)
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, "/api/chat/stream", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	w := &replyRecorder{header: make(http.Header), status: http.StatusOK}
+	chatStream(w, r)
+
+	if w.status >= 400 {
+		var resp utils.ErrorResponse
+		if err := json.Unmarshal(w.body.Bytes(), &resp); err != nil {
+			return nil, errors.New(strings.TrimSpace(w.body.String()))
+		}
+		return nil, apierr.New(resp.Error.Code, resp.Error.Message)
+	}
+	if w.metadata == nil {
+		return nil, errors.New("no response was generated")
+	}
+
+	msg, err := getMessage(w.metadata.AssistantMessageID, user)
+	if err != nil {
+		return nil, err
+	}
+	return &Reply{
+		ConversationID: w.metadata.ConversationID,
+		MessageID:      msg.ID,
+		Content:        msg.Content,
+		Error:          msg.Error,
+	}, nil
+}
+
+// replyRecorder stands in for the client of a stream. It keeps the stream
+// metadata to find the saved answer and the body of error responses.
+type replyRecorder struct {
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	metadata *utils.StreamMetadata
+	// pending holds the stream up to the end of its last full frame
+	pending bytes.Buffer
+}
+
+func (w *replyRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *replyRecorder) WriteHeader(status int) {
+	w.status = status
+}
+
+// Write receives the stream in any pieces, a write may hold part of a
+// frame or several of them. Frames end with a blank line.
+func (w *replyRecorder) Write(p []byte) (int, error) {
+	if w.status >= 400 {
+		return w.body.Write(p)
+	}
+	w.pending.Write(p)
+	for {
+		frame, _, ok := bytes.Cut(w.pending.Bytes(), []byte("\n\n"))
+		if !ok {
+			break
+		}
+		w.readFrame(string(frame))
+		w.pending.Next(len(frame) + 2)
+	}
+	return len(p), nil
+}
+
+func (w *replyRecorder) readFrame(frame string) {
+	if data, ok := strings.CutPrefix(frame, "event: "+utils.EVENT_METADATA+"\ndata: "); ok {
+		var payload struct {
+			Metadata utils.StreamMetadata `json:"metadata"`
+		}
+		if err := json.Unmarshal([]byte(data), &payload); err == nil {
+			w.metadata = &payload.Metadata
+		}
+	}
+}
+
+func (w *replyRecorder) Flush() {}
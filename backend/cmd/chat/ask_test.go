@@ -0,0 +1,55 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+)
+
+func TestAsk(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	reply, err := Ask(context.Background(), "test-user", "", 0, "hello")
+	if err != nil {
+		t.Fatalf("Ask failed: %v", err)
+	}
+	if reply.Content != "final content" || reply.ConversationID == "" || reply.MessageID == 0 {
+		t.Fatalf("unexpected reply %+v", reply)
+	}
+
+	// a follow-up continues the same conversation below the answer
+	next, err := Ask(context.Background(), "test-user", reply.ConversationID, reply.MessageID, "and then?")
+	if err != nil {
+		t.Fatalf("follow-up failed: %v", err)
+	}
+	if next.ConversationID != reply.ConversationID {
+		t.Errorf("expected the conversation to be continued, got %q", next.ConversationID)
+	}
+	msg, err := getMessage(next.MessageID, "test-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	question, err := getMessage(msg.ParentID, "test-user")
+	if err != nil || question.ParentID != reply.MessageID {
+		t.Errorf("expected the question to follow the first answer, got %+v", question)
+	}
+}
+
+func TestAskRejected(t *testing.T) {
+	t.Setenv("MAX_CONCURRENT_GENERATIONS", "1")
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	slot, err := generations.start("test-user", Generation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer generations.finish("test-user", slot)
+
+	_, err = Ask(context.Background(), "test-user", "", 0, "hello")
+	if apierr.CodeOf(err) != apierr.TooManyGenerations {
+		t.Errorf("expected TOO_MANY_GENERATIONS, got %v", err)
+	}
+}
@@ -0,0 +1,321 @@
+package chat
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/jobs"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+const (
+	// BatchJob runs a list of prompts against one model
+	BatchJob        = "chat_batch"
+	maxBatchPrompts = 500
+	// batchTimeout bounds an attempt of a batch, a retry resumes it
+	batchTimeout = 2 * time.Hour
+)
+
+// PromptBatch is a list of prompts sent to a model one by one, each
+// without any conversation around it.
+type PromptBatch struct {
+	// Model is a model ID or one of the user's aliases
+	Model   string   `json:"model"`
+	Prompts []string `json:"prompts"`
+	// SystemPrompt is sent before every prompt, the user's systemPrompt
+	// setting when nil
+	SystemPrompt *string                   `json:"systemPrompt,omitempty"`
+	Params       *providers.SamplingParams `json:"params,omitempty"`
+}
+
+// BatchItem is the answer to one prompt of a batch.
+type BatchItem struct {
+	Prompt  string `json:"prompt"`
+	Content string `json:"content"`
+	Error   string `json:"error,omitempty"`
+	Tokens  int    `json:"tokens"`
+}
+
+// BatchProgress is reported while a batch runs. Items are nil until their
+// prompt was answered.
+type BatchProgress struct {
+	Done  int          `json:"done"`
+	Total int          `json:"total"`
+	Items []*BatchItem `json:"items"`
+}
+
+// BatchResults is the result of a finished batch job.
+type BatchResults struct {
+	Model string      `json:"model"`
+	Items []BatchItem `json:"items"`
+}
+
+// runBatch queues a batch of prompts given as JSON.
+func runBatch(w http.ResponseWriter, r *http.Request) {
+	var req PromptBatch
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	queueBatch(w, r, req)
+}
+
+// runBatchCSV queues a batch of prompts from the column of an uploaded CSV
+// file named by the column field, "prompt" by default, or its first column
+// when no header matches. The first row is the header.
+func runBatchCSV(w http.ResponseWriter, r *http.Request) {
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		utils.Error(w, "A CSV file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	column := r.FormValue("column")
+	if column == "" {
+		column = "prompt"
+	}
+	prompts, err := csvPrompts(file, column)
+	if err != nil {
+		utils.Error(w, "Invalid CSV file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := PromptBatch{Model: r.FormValue("model"), Prompts: prompts}
+	if r.Form.Has("systemPrompt") {
+		systemPrompt := r.FormValue("systemPrompt")
+		req.SystemPrompt = &systemPrompt
+	}
+	queueBatch(w, r, req)
+}
+
+func queueBatch(w http.ResponseWriter, r *http.Request, req PromptBatch) {
+	user := utils.ExtractContextUser(r)
+	req.Prompts = slices.DeleteFunc(req.Prompts, func(p string) bool { return strings.TrimSpace(p) == "" })
+	if req.Model == "" || len(req.Prompts) == 0 {
+		utils.Error(w, "A model and at least one prompt are required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Prompts) > maxBatchPrompts {
+		utils.Error(w, fmt.Sprintf("At most %d prompts can be run at once", maxBatchPrompts), http.StatusBadRequest)
+		return
+	}
+	if err := validateSamplingParams(req.Params); err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Model = providers.ResolveModel(req.Model, user)
+	if err := checkLimits(user, req.Model); err != nil {
+		code := apierr.CodeOf(err)
+		utils.RespondWithError(w, code, err.Error(), apierr.Status(code))
+		return
+	}
+
+	job, err := jobs.Enqueue(user, BatchJob, req)
+	if err != nil {
+		log.Error("Error queuing batch", "err", err)
+		utils.Error(w, "Error queuing batch", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, job, http.StatusAccepted)
+}
+
+func csvPrompts(r io.Reader, column string) ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	index := max(slices.IndexFunc(header, func(name string) bool {
+		return strings.EqualFold(strings.TrimSpace(name), column)
+	}), 0)
+
+	var prompts []string
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return prompts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if index < len(record) {
+			prompts = append(prompts, record[index])
+		}
+	}
+}
+
+// batchJob answers the prompts of a batch, batchConcurrency at a time. The
+// answers are reported as progress, so a retried attempt only runs the
+// prompts that are left. A prompt the provider fails keeps its error and
+// does not fail the batch, and so does a prompt sent once the user used up
+// the budget or the quota.
+func batchJob(ctx context.Context, job *jobs.Job) (any, error) {
+	var batch PromptBatch
+	if err := json.Unmarshal(job.Payload, &batch); err != nil {
+		return nil, jobs.Permanent(err)
+	}
+
+	progress := BatchProgress{Total: len(batch.Prompts), Items: make([]*BatchItem, len(batch.Prompts))}
+	if job.Progress != nil {
+		var previous BatchProgress
+		if err := json.Unmarshal(job.Progress, &previous); err == nil && len(previous.Items) == len(batch.Prompts) {
+			progress = previous
+		}
+	}
+
+	systemPrompt := ""
+	if batch.SystemPrompt != nil {
+		systemPrompt = *batch.SystemPrompt
+	} else {
+		systemPrompt, _ = settings.Get("systemPrompt", job.User)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(config.Int64("batchConcurrency"), 1))
+	for i, prompt := range batch.Prompts {
+		if progress.Items[i] != nil {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			item := answerPrompt(ctx, job.User, batch, systemPrompt, prompt)
+			if ctx.Err() != nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			progress.Items[i] = item
+			progress.Done++
+			if err := jobs.Report(job, progress); err != nil {
+				log.Error("Error reporting batch progress", "job", job.ID, "err", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("batch stopped after %d of %d prompts: %w", progress.Done, progress.Total, err)
+	}
+
+	results := BatchResults{Model: batch.Model, Items: make([]BatchItem, 0, len(progress.Items))}
+	for _, item := range progress.Items {
+		results.Items = append(results.Items, *item)
+	}
+	return results, nil
+}
+
+func answerPrompt(ctx context.Context, user string, batch PromptBatch, systemPrompt string, prompt string) *BatchItem {
+	var messages []providers.SimpleMessage
+	if strings.TrimSpace(systemPrompt) != "" {
+		messages = append(messages, providers.SimpleMessage{Role: "system", Content: systemPrompt})
+	}
+	params := providers.RequestParams{
+		Context:  ctx,
+		Messages: append(messages, providers.SimpleMessage{Role: "user", Content: prompt}),
+		Model:    batch.Model,
+		User:     user,
+	}
+	if batch.Params != nil {
+		params.SamplingParams = *batch.Params
+	}
+
+	item := &BatchItem{Prompt: prompt}
+	slot, err := waitForGeneration(ctx, user, batch.Model)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	defer generations.finish(user, slot)
+
+	response, err := provider.SendChatCompletionRequest(params)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	item.Content = response.Content
+	item.Tokens = response.Stats.CompletionTokens
+	return item
+}
+
+// waitForGeneration reserves a generation slot for a prompt of a batch like
+// a chat would. At the concurrency limit it waits for a free slot, so a
+// batch runs next to the user's chats rather than failing them.
+func waitForGeneration(ctx context.Context, user string, model string) (int, error) {
+	for {
+		slot, err := reserveGeneration(user, Generation{Model: model})
+		if apierr.CodeOf(err) != apierr.TooManyGenerations {
+			return slot, err
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// getBatchResults downloads the answers of a finished batch as CSV, or as
+// JSON with ?format=json.
+func getBatchResults(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.Error(w, "Invalid batch ID", http.StatusBadRequest)
+		return
+	}
+	job, err := jobs.Get(id, utils.ExtractContextUser(r))
+	if err != nil || job.Kind != BatchJob {
+		utils.Error(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+	if job.Status != jobs.StatusDone {
+		utils.Error(w, fmt.Sprintf("The batch is %s, results are ready once it is done", job.Status), http.StatusConflict)
+		return
+	}
+	var results BatchResults
+	if err := json.Unmarshal(job.Result, &results); err != nil {
+		log.Error("Error reading batch results", "job", job.ID, "err", err)
+		utils.Error(w, "Error reading batch results", http.StatusInternalServerError)
+		return
+	}
+
+	name := fmt.Sprintf("batch-%d", job.ID)
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.json"`)
+		utils.RespondWithJSON(w, results, http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"prompt", "model", "answer", "error", "tokens"})
+	for _, item := range results.Items {
+		_ = out.Write([]string{item.Prompt, results.Model, item.Content, item.Error, strconv.Itoa(item.Tokens)})
+	}
+	out.Flush()
+}
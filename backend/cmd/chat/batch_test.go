@@ -0,0 +1,158 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/jobs"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/usage"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	logger "github.com/charmbracelet/log"
+)
+
+// mockProviderEchoPrompt answers every prompt by quoting it, and fails the
+// prompt "fail".
+type mockProviderEchoPrompt struct{}
+
+func (m *mockProviderEchoPrompt) SendChatCompletionRequest(params providers.RequestParams) (*providers.ChatCompletionMessage, error) {
+	prompt := params.Messages[len(params.Messages)-1].Content
+	if prompt == "fail" {
+		return nil, errors.New("provider unavailable")
+	}
+	return &providers.ChatCompletionMessage{
+		Content: "answer to " + prompt,
+		Stats:   utils.StreamStats{CompletionTokens: len(prompt)},
+	}, nil
+}
+
+func (m *mockProviderEchoPrompt) SendChatCompletionStreamRequest(params providers.RequestParams, sc utils.StreamClient) (*providers.ChatCompletionMessage, error) {
+	return m.SendChatCompletionRequest(params)
+}
+
+func TestBatch(t *testing.T) {
+	teardown := setupTest(t, &mockProviderEchoPrompt{})
+	defer teardown()
+	jobs.SetupJobs(logger.New(os.Stdout), data.DB)
+
+	call := func(handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	finished := func(rr *httptest.ResponseRecorder) *jobs.Job {
+		t.Helper()
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d %s", rr.Code, rr.Body.String())
+		}
+		var queued jobs.Job
+		if err := json.Unmarshal(rr.Body.Bytes(), &queued); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			job, err := jobs.Get(queued.ID, "test-user")
+			if err == nil && job.Status == jobs.StatusDone {
+				return job
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("batch never finished: %+v, %v", job, err)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	b, _ := json.Marshal(PromptBatch{Model: "provider-x/model", Prompts: []string{"one", "", "fail", "three"}})
+	job := finished(call(runBatch, httptest.NewRequest(http.MethodPost, "/batch", bytes.NewReader(b))))
+
+	var progress BatchProgress
+	if err := json.Unmarshal(job.Progress, &progress); err != nil || progress.Done != 3 || progress.Total != 3 {
+		t.Errorf("expected 3 of 3 prompts done, got %s", job.Progress)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/batch/"+strconv.FormatInt(job.ID, 10)+"/results", nil)
+	req.SetPathValue("id", strconv.FormatInt(job.ID, 10))
+	rr := call(getBatchResults, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("expected CSV results, got %d %s", rr.Code, rr.Body.String())
+	}
+	rows, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"prompt", "model", "answer", "error", "tokens"},
+		{"one", "provider-x/model", "answer to one", "", "3"},
+		{"fail", "provider-x/model", "", "provider unavailable", "0"},
+		{"three", "provider-x/model", "answer to three", "", "5"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got rows %q, want %q", rows, want)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if rows[i][j] != want[i][j] {
+				t.Errorf("row %d: got %q, want %q", i, rows[i], want[i])
+				break
+			}
+		}
+	}
+
+	// a CSV upload takes the prompts of the named column
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	_ = form.WriteField("model", "provider-x/model")
+	_ = form.WriteField("column", "Question")
+	part, _ := form.CreateFormFile("file", "inputs.csv")
+	_, _ = part.Write([]byte("id,question\n1,\"red, green\"\n2,blue\n"))
+	form.Close()
+	req = httptest.NewRequest(http.MethodPost, "/batch/csv", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	job = finished(call(runBatchCSV, req))
+	var results BatchResults
+	if err := json.Unmarshal(job.Result, &results); err != nil || len(results.Items) != 2 ||
+		results.Items[0].Content != "answer to red, green" || results.Items[1].Prompt != "blue" {
+		t.Errorf("unexpected CSV batch results %s", job.Result)
+	}
+
+	rr = call(runBatch, httptest.NewRequest(http.MethodPost, "/batch", bytes.NewReader([]byte(`{"model":"provider-x/model","prompts":[]}`))))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without prompts, got %d", rr.Code)
+	}
+
+	// a used up budget stops a batch from being queued and its prompts
+	usage.SetupUsage(logger.New(os.Stdout), data.DB)
+	if err := usage.SetBudget(&usage.Budget{User: "test-user", MonthlyTokens: 10}); err != nil {
+		t.Fatal(err)
+	}
+	usage.Record("test-user", "provider-x/model", 10, 0, nil)
+	rr = call(runBatch, httptest.NewRequest(http.MethodPost, "/batch", bytes.NewReader(b)))
+	if rr.Code != http.StatusPaymentRequired {
+		t.Errorf("expected 402 over budget, got %d %s", rr.Code, rr.Body.String())
+	}
+	result, err := batchJob(context.Background(), &jobs.Job{User: "test-user", Kind: BatchJob, Payload: b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range result.(BatchResults).Items {
+		if item.Content != "" || item.Error == "" {
+			t.Errorf("expected the prompt to be refused over budget, got %+v", item)
+		}
+	}
+	if n := generations.count(); n != 0 {
+		t.Errorf("expected every generation slot released, %d left", n)
+	}
+}
@@ -0,0 +1,196 @@
+package chat
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+)
+
+const (
+	// maxCachedTrees bounds the number of conversation trees kept in memory.
+	maxCachedTrees = 64
+	// treeCacheTTL drops trees that were not read for a while, bounding how
+	// long a change made outside of this package can stay unseen.
+	treeCacheTTL = 10 * time.Minute
+)
+
+// treeCache keeps the message trees of recently used conversations so
+// buildContext does not re-read the whole conversation on every turn.
+// Message writes go through the cache, and trees are dropped when
+// their conversation is deleted.
+//
+// Trees are copied in and out of the cache since callers modify the
+// messages they get, e.g. buildContext embeds attachments into Content.
+type treeCache struct {
+	mu    sync.Mutex
+	trees map[string]*cachedTree
+}
+
+type cachedTree struct {
+	user     string
+	messages map[int]*Message
+	lastUsed time.Time
+}
+
+var messageCache = newTreeCache()
+
+func newTreeCache() *treeCache {
+	return &treeCache{trees: make(map[string]*cachedTree)}
+}
+
+func (c *treeCache) get(convID string, user string) (map[int]*Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tree, ok := c.trees[convID]
+	if !ok || tree.user != user {
+		return nil, false
+	}
+	if time.Since(tree.lastUsed) > treeCacheTTL {
+		delete(c.trees, convID)
+		return nil, false
+	}
+	tree.lastUsed = time.Now()
+	return cloneMessages(tree.messages), true
+}
+
+func (c *treeCache) put(convID string, user string, messages map[int]*Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.trees[convID]; !exists && len(c.trees) >= maxCachedTrees {
+		c.evictOldest()
+	}
+	c.trees[convID] = &cachedTree{
+		user:     user,
+		messages: cloneMessages(messages),
+		lastUsed: time.Now(),
+	}
+}
+
+func (c *treeCache) evictOldest() {
+	var oldestID string
+	var oldest time.Time
+	for id, tree := range c.trees {
+		if oldestID == "" || tree.lastUsed.Before(oldest) {
+			oldestID, oldest = id, tree.lastUsed
+		}
+	}
+	delete(c.trees, oldestID)
+}
+
+func (c *treeCache) invalidate(convID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.trees, convID)
+}
+
+// update applies fn to the cached tree of a conversation, if there is one.
+func (c *treeCache) update(convID string, fn func(messages map[int]*Message)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tree, ok := c.trees[convID]; ok {
+		fn(tree.messages)
+	}
+}
+
+// saveMessage adds a newly stored message to its cached tree.
+func (c *treeCache) saveMessage(msg *Message) {
+	c.update(msg.ConvID, func(messages map[int]*Message) {
+		if _, exists := messages[msg.ID]; exists {
+			return
+		}
+		cached := cloneMessage(msg)
+		for i := range cached.Attachments {
+			cached.Attachments[i].MessageID = msg.ID
+		}
+		messages[msg.ID] = cached
+		if parent, ok := messages[msg.ParentID]; ok && !slices.Contains(parent.Children, msg.ID) {
+			parent.Children = append(parent.Children, msg.ID)
+		}
+	})
+}
+
+// updateMessage replaces a message in its cached tree.
+func (c *treeCache) updateMessage(msg *Message) {
+	c.update(msg.ConvID, func(messages map[int]*Message) {
+		messages[msg.ID] = cloneMessage(msg)
+	})
+}
+
+// saveToolCall attaches a newly stored tool call to its cached message.
+func (c *treeCache) saveToolCall(call *providers.ToolCall) {
+	c.update(call.ConvID, func(messages map[int]*Message) {
+		if msg, ok := messages[call.MessageID]; ok {
+			tool := *call
+			msg.Tools = append(msg.Tools, &tool)
+		}
+	})
+}
+
+// setFileContent records text extracted from a file after it was cached.
+func (c *treeCache) setFileContent(convID string, fileID string, content string) {
+	c.update(convID, func(messages map[int]*Message) {
+		for _, msg := range messages {
+			for i := range msg.Attachments {
+				if msg.Attachments[i].File.ID == fileID {
+					msg.Attachments[i].File.Content = content
+				}
+			}
+		}
+	})
+}
+
+// updateFile replaces the name, content and description of a file in
+// every cached attachment of it.
+func (c *treeCache) updateFile(file fs.File) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tree := range c.trees {
+		for _, msg := range tree.messages {
+			for i := range msg.Attachments {
+				if att := &msg.Attachments[i]; att.File.ID == file.ID {
+					att.File.Name = file.Name
+					att.File.Content = file.Content
+					att.File.Description = file.Description
+				}
+			}
+		}
+	}
+}
+
+// invalidateOnSync keeps the cache in line with changes announced to
+// other sessions that are not written through it.
+func invalidateOnSync(_ string, event SyncEvent) {
+	if event.Type == EventConversationDeleted {
+		messageCache.invalidate(event.ConversationID)
+	}
+}
+
+func cloneMessages(messages map[int]*Message) map[int]*Message {
+	clone := make(map[int]*Message, len(messages))
+	for id, msg := range messages {
+		clone[id] = cloneMessage(msg)
+	}
+	return clone
+}
+
+func cloneMessage(msg *Message) *Message {
+	clone := *msg
+	clone.Children = slices.Clone(msg.Children)
+	if clone.Children == nil {
+		clone.Children = make([]int, 0)
+	}
+	clone.Attachments = slices.Clone(msg.Attachments)
+	if msg.Tools != nil {
+		clone.Tools = make([]*providers.ToolCall, len(msg.Tools))
+		for i, tool := range msg.Tools {
+			t := *tool
+			clone.Tools[i] = &t
+		}
+	}
+	return &clone
+}
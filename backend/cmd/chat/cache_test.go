@@ -0,0 +1,105 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+)
+
+func TestMessageCacheReadThrough(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	convID, last := seedConversation(t, 2)
+	first := getAllConversationMessages(convID, "test-user")
+
+	// a change behind the cache's back shows that the second read is cached
+	if _, err := data.DB.Exec(`UPDATE Messages SET content = 'changed' WHERE id = ?`, last); err != nil {
+		t.Fatal(err)
+	}
+	if got := getAllConversationMessages(convID, "test-user")[last].Content; got != first[last].Content {
+		t.Errorf("expected the cached content, got %q", got)
+	}
+
+	// callers may modify what they get without touching the cache
+	first[last].Content = "modified by caller"
+	first[last].Tools[0].Output = "modified by caller"
+	again := getAllConversationMessages(convID, "test-user")
+	if again[last].Content == "modified by caller" || again[last].Tools[0].Output == "modified by caller" {
+		t.Errorf("cached tree was modified through a returned copy")
+	}
+
+	if got := getAllConversationMessages(convID, "other-user"); len(got) != 0 {
+		t.Errorf("cached tree leaked to another user: %d messages", len(got))
+	}
+}
+
+func TestMessageCacheWriteThrough(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	convID, last := seedConversation(t, 1)
+	getAllConversationMessages(convID, "test-user")
+
+	id, err := saveMessage(Message{ConvID: convID, Role: "user", ParentID: last, Content: "follow up", Status: "completed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := updateMessage(id, "test-user", Message{Content: "edited follow up", Status: "completed"}); err != nil {
+		t.Fatal(err)
+	}
+	call := &providers.ToolCall{ID: "call-x", ConvID: convID, MessageID: id, Name: "search", Args: "{}"}
+	if err := toolCalls.Save(call); err != nil {
+		t.Fatal(err)
+	}
+	messageCache.saveToolCall(call)
+
+	cached := getAllConversationMessages(convID, "test-user")
+	messageCache.invalidate(convID)
+	stored := getAllConversationMessages(convID, "test-user")
+
+	if len(cached) != len(stored) {
+		t.Fatalf("cached %d messages, stored %d", len(cached), len(stored))
+	}
+	for msgID, want := range stored {
+		got := cached[msgID]
+		if got == nil || got.Content != want.Content || len(got.Children) != len(want.Children) || len(got.Tools) != len(want.Tools) {
+			t.Errorf("message %d: cached %+v, stored %+v", msgID, got, want)
+		}
+	}
+
+	syncManager.Broadcast("test-user", "", SyncEvent{Type: EventConversationDeleted, ConversationID: convID})
+	if _, ok := messageCache.get(convID, "test-user"); ok {
+		t.Errorf("deleted conversation is still cached")
+	}
+}
+
+func TestConversationCache(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	conv := newConversation("test-user")
+	if err := conversations.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := conversations.GetByID(conv.ID, "test-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Title = "not saved"
+	if again, _ := conversations.GetByID(conv.ID, "test-user"); again.Title != "" {
+		t.Errorf("cached conversation was modified through a returned copy")
+	}
+	if _, err := conversations.GetByID(conv.ID, "other-user"); err == nil {
+		t.Errorf("cached conversation leaked to another user")
+	}
+
+	if err := conversations.DeleteByID(conv.ID, "test-user"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conversations.GetByID(conv.ID, "test-user"); err == nil {
+		t.Errorf("deleted conversation is still returned")
+	}
+}
@@ -1,30 +1,48 @@
 package chat
 
 import (
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/config"
 	fs "github.com/Bajahaw/ai-ui/cmd/files"
 	"github.com/Bajahaw/ai-ui/cmd/providers"
-	"github.com/Bajahaw/ai-ui/cmd/tools"
+	"github.com/Bajahaw/ai-ui/cmd/templates"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 
 	"fmt"
 	"net/http"
+	"slices"
 
 	"github.com/google/uuid"
 )
 
 type Request struct {
-	ConversationID  string   `json:"conversationId"`
-	ParentID        int      `json:"parentId"`
+	ConversationID string `json:"conversationId"`
+	ParentID       int    `json:"parentId"`
+	// Model is a model ID or one of the user's aliases
 	Model           string   `json:"model"`
 	Content         string   `json:"content"`
 	WebSearch       bool     `json:"webSearch,omitempty"`
 	AttachedFileIDs []string `json:"attachedFileIds,omitempty"`
+	// Params overrides the model profile and user settings for this request
+	Params *providers.SamplingParams `json:"params,omitempty"`
+	// TemplateID renders a saved prompt template with Variables as the content
+	TemplateID string            `json:"templateId,omitempty"`
+	Variables  map[string]string `json:"variables,omitempty"`
 }
 
 type Retry struct {
+	ConversationID string                    `json:"conversationId"`
+	ParentID       int                       `json:"parentId"`
+	Model          string                    `json:"model"`
+	Params         *providers.SamplingParams `json:"params,omitempty"`
+}
+
+type Continue struct {
 	ConversationID string `json:"conversationId"`
-	ParentID       int    `json:"parentId"`
-	Model          string `json:"model"`
+	MessageID      int    `json:"messageId"`
+	// Model defaults to the model that wrote the message
+	Model  string                    `json:"model,omitempty"`
+	Params *providers.SamplingParams `json:"params,omitempty"`
 }
 
 type Update struct {
@@ -37,15 +55,37 @@ type Response struct {
 	Messages map[int]*Message `json:"messages"`
 }
 
+type BatchRequest struct {
+	IDs []int `json:"ids"`
+}
+
 func chatStream(w http.ResponseWriter, r *http.Request) {
 	user := utils.ExtractContextUser(r)
 	var req Request
 	err := utils.ExtractJSONBody(r, &req)
-	if err != nil || req.ConversationID == "" || req.Content == "" {
+	if err != nil || req.ConversationID == "" || (req.Content == "" && req.TemplateID == "") {
 		log.Error("Error unmarshalling request body", "err", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if req.TemplateID != "" {
+		req.Content, err = templates.RenderByID(req.TemplateID, user, req.Variables)
+		if err != nil {
+			log.Error("Error rendering template", "id", req.TemplateID, "err", err)
+			utils.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err = validateSamplingParams(req.Params); err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Model = providers.ResolveModel(req.Model, user)
+	slot, started := startGeneration(w, user, Generation{ConversationID: req.ConversationID, Model: req.Model})
+	if !started {
+		return
+	}
+	defer generations.finish(user, slot)
 
 	// Find or create conversation
 	convID := req.ConversationID
@@ -54,7 +94,7 @@ func chatStream(w http.ResponseWriter, r *http.Request) {
 		conv := newConversation(user)
 		if err = conversations.Save(conv); err != nil {
 			log.Error("Error creating conversation", "err", err)
-			http.Error(w, fmt.Sprintf("Error creating conversation: %v", err), http.StatusBadRequest)
+			utils.Error(w, fmt.Sprintf("Error creating conversation: %v", err), http.StatusBadRequest)
 			return
 		}
 		convID = conv.ID
@@ -81,7 +121,7 @@ func chatStream(w http.ResponseWriter, r *http.Request) {
 	attachedFiles, err := files.GetByIDs(req.AttachedFileIDs, user)
 	if err != nil {
 		log.Error("Error getting files data", "err", err)
-		http.Error(w, fmt.Sprintf("Error getting files data: %v", err), http.StatusBadRequest)
+		utils.Error(w, fmt.Sprintf("Error getting files data: %v", err), http.StatusBadRequest)
 		return
 	}
 
@@ -93,7 +133,7 @@ func chatStream(w http.ResponseWriter, r *http.Request) {
 		Content:  req.Content,
 		ParentID: req.ParentID,
 		Children: []int{},
-		Status:   "completed",
+		Status:   StatusCompleted,
 	}
 
 	userMessage.Attachments = make([]fs.Attachment, 0)
@@ -109,7 +149,7 @@ func chatStream(w http.ResponseWriter, r *http.Request) {
 	userMessage.ID, err = saveMessage(userMessage)
 	if err != nil {
 		log.Error("Error saving user message", "err", err)
-		http.Error(w, fmt.Sprintf("Error saving user message: %v", err), http.StatusBadRequest)
+		utils.Error(w, fmt.Sprintf("Error saving user message: %v", err), http.StatusBadRequest)
 		return
 	}
 	syncManager.Broadcast(user, r.Header.Get("X-Session-ID"), SyncEvent{
@@ -118,20 +158,26 @@ func chatStream(w http.ResponseWriter, r *http.Request) {
 		MessageID:      userMessage.ID,
 		Message:        &userMessage,
 	})
+	clearDraft(convID, user, r.Header.Get("X-Session-ID"))
 
 	// prepare for streaming response
 	sc := utils.StreamClient{
 		User:      user,
 		MessageID: userMessage.ID,
 		Writer:    w,
+		Context:   r.Context(),
 	}
 	utils.AddStreamHeaders(sc.Writer)
 	_, ok := sc.Writer.(http.Flusher)
 	if !ok {
 		log.Error("Streaming not supported")
-		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		utils.Error(w, "Streaming not supported", http.StatusInternalServerError)
 		return
 	}
+	sc, stopHeartbeat := utils.KeepAlive(sc, utils.HeartbeatInterval())
+	defer stopHeartbeat()
+	sc, flushChunks := utils.Batch(sc, config.Duration("streamFlushInterval"), int(config.Int64("streamFlushBytes")))
+	defer flushChunks()
 
 	responseMessage := Message{
 		ID:        -1,
@@ -140,7 +186,7 @@ func chatStream(w http.ResponseWriter, r *http.Request) {
 		Model:     req.Model,
 		Content:   "",
 		Reasoning: "",
-		Status:    "pending",
+		Status:    StatusPending,
 		ParentID:  userMessage.ID,
 		Children:  []int{},
 	}
@@ -150,12 +196,14 @@ func chatStream(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Error("Error saving response message", "err", err)
 	} else {
+		generations.attach(user, slot, convID, responseMessage.ID)
 		syncManager.Broadcast(user, r.Header.Get("X-Session-ID"), SyncEvent{
 			Type:           EventMessageSaved,
 			ConversationID: convID,
 			MessageID:      responseMessage.ID,
 			Message:        &responseMessage,
 		})
+		sc.OnOutput = markStreaming(user, r.Header.Get("X-Session-ID"), &responseMessage)
 	}
 
 	// Send metadata first (conversation ID, user message ID)
@@ -171,7 +219,11 @@ func chatStream(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Build context from user message
-	ctx := buildContext(convID, userMessage.ID, user)
+	ctx := buildContext(r.Context(), convID, userMessage.ID, user, req.Model)
+	// ephemeral pastes were only kept until the message is sent
+	if err := fs.ExpireEphemeral(req.AttachedFileIDs, user); err != nil {
+		log.Error("Error expiring ephemeral files", "err", err)
+	}
 	reasoningSetting, _ := settings.Get("reasoningEffort", user)
 
 	providerParams := providers.RequestParams{
@@ -180,19 +232,23 @@ func chatStream(w http.ResponseWriter, r *http.Request) {
 		ReasoningEffort: providers.ReasoningEffort(reasoningSetting),
 		User:            user,
 		MessageID:       responseMessage.ID,
-		Tools:           toOpenAITools(tools.GetAvailableTools(user)),
+		Tools:           availableTools(convID, user),
+	}
+	if req.Params != nil {
+		providerParams.SamplingParams = *req.Params
 	}
 
 	var calls []providers.ToolCall
 	var isToolsUsed bool
 	var streamStats utils.StreamStats
 
-	completion, err := provider.SendChatCompletionStreamRequest(providerParams, sc)
+	completion, err := streamCompletion(convID, providerParams, sc)
 	if err != nil {
 		log.Error("Error streaming chat completion", "err", err)
 		utils.SendStreamChunk(sc, utils.StreamChunk{
 			Type:    utils.EVENT_ERROR,
 			Payload: err.Error(),
+			Code:    apierr.CodeOf(err),
 		})
 		responseMessage.Error = err.Error()
 	} else {
@@ -200,9 +256,11 @@ func chatStream(w http.ResponseWriter, r *http.Request) {
 		responseMessage.Reasoning = completion.Reasoning
 		streamStats = completion.Stats
 		calls = completion.ToolCalls
+		responseMessage.FinishReason = completion.FinishReason
 	}
 
-	isToolsUsed = len(calls) > 0
+	// tools are not run for a client that is gone
+	isToolsUsed = len(calls) > 0 && !sc.Gone()
 
 	if isToolsUsed {
 		completion, err = enterAgentLoop(
@@ -216,23 +274,21 @@ func chatStream(w http.ResponseWriter, r *http.Request) {
 		} else {
 			// Content is already accumulated in responseMessage by enterAgentLoop.
 			streamStats = completion.Stats
+			responseMessage.FinishReason = completion.FinishReason
 		}
 	}
 
-	responseMessage.Status = "completed"
+	responseMessage.Content = postProcess(responseMessage.Content, user)
+	responseMessage.Status = completionStatus(sc, &responseMessage, completion)
 	responseMessage.Speed = streamStats.Speed
 	responseMessage.TokenCount = streamStats.CompletionTokens
 	responseMessage.ContextSize = streamStats.PromptTokens
 
-	if updatedMsg, updateErr := updateMessage(responseMessage.ID, user, responseMessage); updateErr != nil {
+	if updatedMsg, updateErr := finishMessage(responseMessage.ID, user, responseMessage); updateErr != nil {
 		log.Error("Error updating assistant message after tool calls", "err", updateErr)
 	} else if updatedMsg != nil {
-		syncManager.Broadcast(user, r.Header.Get("X-Session-ID"), SyncEvent{
-			Type:           EventMessageUpdated,
-			ConversationID: convID,
-			MessageID:      updatedMsg.ID,
-			Message:        updatedMsg,
-		})
+		generationCompleted(user, r.Header.Get("X-Session-ID"), updatedMsg)
+		digestOnCompletion(user, slot, updatedMsg)
 	}
 
 	log.Debug("Completed streaming chat response", "responseMessageID", responseMessage.ID)
@@ -258,14 +314,24 @@ func retryStream(w http.ResponseWriter, r *http.Request) {
 	err := utils.ExtractJSONBody(r, &req)
 	if err != nil || req.ConversationID == "" || req.ParentID <= 0 {
 		log.Error("Error unmarshalling retry stream body", "err", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err = validateSamplingParams(req.Params); err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Model = providers.ResolveModel(req.Model, user)
+	slot, started := startGeneration(w, user, Generation{ConversationID: req.ConversationID, Model: req.Model})
+	if !started {
 		return
 	}
+	defer generations.finish(user, slot)
 
 	// Ensure conversation exists and update its timestamp
 	if err = conversations.Touch(req.ConversationID, user); err != nil {
 		log.Error("Error retrieving conversation", "err", err)
-		http.Error(w, fmt.Sprintf("Error retrieving conversation: %v", err), http.StatusNotFound)
+		utils.Error(w, fmt.Sprintf("Error retrieving conversation: %v", err), http.StatusNotFound)
 		return
 	}
 
@@ -283,7 +349,7 @@ func retryStream(w http.ResponseWriter, r *http.Request) {
 	parent, err := getMessage(req.ParentID, user)
 	if err != nil || parent.Role != "user" {
 		log.Error("Invalid parent message for retry stream", "err", err)
-		http.Error(w, "Invalid parent message", http.StatusBadRequest)
+		utils.Error(w, "Invalid parent message", http.StatusBadRequest)
 		return
 	}
 
@@ -291,6 +357,7 @@ func retryStream(w http.ResponseWriter, r *http.Request) {
 		User:      user,
 		MessageID: parent.ID,
 		Writer:    w,
+		Context:   r.Context(),
 	}
 
 	utils.AddStreamHeaders(sc.Writer)
@@ -298,9 +365,13 @@ func retryStream(w http.ResponseWriter, r *http.Request) {
 	_, ok := sc.Writer.(http.Flusher)
 	if !ok {
 		log.Error("Streaming not supported")
-		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		utils.Error(w, "Streaming not supported", http.StatusInternalServerError)
 		return
 	}
+	sc, stopHeartbeat := utils.KeepAlive(sc, utils.HeartbeatInterval())
+	defer stopHeartbeat()
+	sc, flushChunks := utils.Batch(sc, config.Duration("streamFlushInterval"), int(config.Int64("streamFlushBytes")))
+	defer flushChunks()
 
 	responseMessage := Message{
 		ID:        -1,
@@ -309,7 +380,7 @@ func retryStream(w http.ResponseWriter, r *http.Request) {
 		Model:     req.Model,
 		Content:   "",
 		Reasoning: "",
-		Status:    "pending",
+		Status:    StatusPending,
 		ParentID:  parent.ID,
 		Children:  []int{},
 	}
@@ -318,12 +389,14 @@ func retryStream(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Error("Error saving retry response message", "err", err)
 	} else {
+		generations.attach(user, slot, req.ConversationID, responseMessage.ID)
 		syncManager.Broadcast(user, r.Header.Get("X-Session-ID"), SyncEvent{
 			Type:           EventMessageSaved,
 			ConversationID: req.ConversationID,
 			MessageID:      responseMessage.ID,
 			Message:        &responseMessage,
 		})
+		sc.OnOutput = markStreaming(user, r.Header.Get("X-Session-ID"), &responseMessage)
 	}
 
 	// Metadata: no new user message; client already knows conversation
@@ -338,7 +411,7 @@ func retryStream(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Build context from the parent message
-	ctx := buildContext(req.ConversationID, parent.ID, user)
+	ctx := buildContext(r.Context(), req.ConversationID, parent.ID, user, req.Model)
 	reasoningSetting, _ := settings.Get("reasoningEffort", user)
 
 	providerParams := providers.RequestParams{
@@ -347,7 +420,10 @@ func retryStream(w http.ResponseWriter, r *http.Request) {
 		ReasoningEffort: providers.ReasoningEffort(reasoningSetting),
 		User:            user,
 		MessageID:       responseMessage.ID,
-		Tools:           toOpenAITools(tools.GetAvailableTools(user)),
+		Tools:           availableTools(req.ConversationID, user),
+	}
+	if req.Params != nil {
+		providerParams.SamplingParams = *req.Params
 	}
 
 	var calls []providers.ToolCall
@@ -355,12 +431,13 @@ func retryStream(w http.ResponseWriter, r *http.Request) {
 	var streamStats utils.StreamStats
 
 	// Stream assistant content
-	completion, err := provider.SendChatCompletionStreamRequest(providerParams, sc)
+	completion, err := streamCompletion(req.ConversationID, providerParams, sc)
 	if err != nil {
 		log.Error("Error streaming retry completion", "err", err)
 		utils.SendStreamChunk(sc, utils.StreamChunk{
 			Type:    utils.EVENT_ERROR,
 			Payload: err.Error(),
+			Code:    apierr.CodeOf(err),
 		})
 		responseMessage.Error = err.Error()
 	} else {
@@ -368,9 +445,11 @@ func retryStream(w http.ResponseWriter, r *http.Request) {
 		responseMessage.Reasoning = completion.Reasoning
 		streamStats = completion.Stats
 		calls = completion.ToolCalls
+		responseMessage.FinishReason = completion.FinishReason
 	}
 
-	isToolsUsed = len(calls) > 0
+	// tools are not run for a client that is gone
+	isToolsUsed = len(calls) > 0 && !sc.Gone()
 	// if !isToolsUsed {
 	// }
 
@@ -386,17 +465,155 @@ func retryStream(w http.ResponseWriter, r *http.Request) {
 		} else {
 			// Content is already accumulated in responseMessage by enterAgentLoop.
 			streamStats = completion.Stats
+			responseMessage.FinishReason = completion.FinishReason
 		}
 	}
 
-	responseMessage.Status = "completed"
+	responseMessage.Content = postProcess(responseMessage.Content, user)
+	responseMessage.Status = completionStatus(sc, &responseMessage, completion)
 	responseMessage.Speed = streamStats.Speed
 	responseMessage.TokenCount = streamStats.CompletionTokens
 	responseMessage.ContextSize = streamStats.PromptTokens
 
-	if updatedMsg, updateErr := updateMessage(responseMessage.ID, user, responseMessage); updateErr != nil {
+	if updatedMsg, updateErr := finishMessage(responseMessage.ID, user, responseMessage); updateErr != nil {
 		log.Error("Error updating assistant message after tool calls", "err", updateErr)
 	} else if updatedMsg != nil {
+		generationCompleted(user, r.Header.Get("X-Session-ID"), updatedMsg)
+		digestOnCompletion(user, slot, updatedMsg)
+	}
+
+	// Send completion event with the new assistant message id
+	completionData := utils.StreamComplete{
+		UserMessageID:      parent.ID,
+		AssistantMessageID: responseMessage.ID,
+		StreamStats:        streamStats,
+	}
+	utils.SendStreamChunk(sc, utils.StreamChunk{
+		Type:    utils.EVENT_COMPLETE,
+		Payload: completionData,
+	})
+}
+
+// continuePrompt asks for the rest of an answer that was cut off at the max
+// token limit. Not every provider resumes a trailing assistant message on
+// its own, so the request is made explicit.
+const continuePrompt = "Your previous response was cut off. Continue exactly where it stopped, without repeating anything or adding any introduction."
+
+// continueStream resumes an assistant message that stopped at the provider's
+// max token limit. The continuation is streamed as regular chunks and
+// appended to the same message.
+func continueStream(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req Continue
+	err := utils.ExtractJSONBody(r, &req)
+	if err != nil || req.ConversationID == "" || req.MessageID <= 0 {
+		log.Error("Error unmarshalling continue stream body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err = validateSamplingParams(req.Params); err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responseMessage, err := getMessage(req.MessageID, user)
+	if err != nil || responseMessage.ConvID != req.ConversationID {
+		log.Error("Invalid message for continue stream", "err", err)
+		utils.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	// a continuation already running for the message, for example one
+	// started from another tab, is followed rather than requested again
+	var entry *StreamEntry
+	for {
+		var leader bool
+		entry, leader = streams.join(user, req.MessageID)
+		if leader {
+			defer streams.finish(user, req.MessageID, entry)
+			break
+		}
+		if entry.follow(r.Context(), w) || r.Context().Err() != nil {
+			return
+		}
+	}
+
+	// the message may have changed while another request continued it
+	if responseMessage, err = getMessage(req.MessageID, user); err != nil {
+		log.Error("Error retrieving message for continue stream", "err", err)
+		utils.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if responseMessage.Role != "assistant" || inProgress(responseMessage.Status) || responseMessage.FinishReason != "length" {
+		utils.Error(w, "Only answers cut off at the token limit can be continued", http.StatusBadRequest)
+		return
+	}
+
+	if err = conversations.Touch(req.ConversationID, user); err != nil {
+		log.Error("Error retrieving conversation", "err", err)
+		utils.Error(w, fmt.Sprintf("Error retrieving conversation: %v", err), http.StatusNotFound)
+		return
+	}
+
+	// Broadcast update to other sessions to reorder sidebar
+	if conv, err := conversations.GetByID(req.ConversationID, user); err == nil {
+		sessionID := r.Header.Get("X-Session-ID")
+		syncManager.Broadcast(user, sessionID, SyncEvent{
+			Type:           EventConversationUpdated,
+			ConversationID: conv.ID,
+			Conversation:   conv,
+		})
+	}
+
+	model := providers.ResolveModel(req.Model, user)
+	if model == "" {
+		model = responseMessage.Model
+	}
+	slot, started := startGeneration(w, user, Generation{
+		ConversationID: req.ConversationID,
+		MessageID:      responseMessage.ID,
+		Model:          model,
+	})
+	if !started {
+		return
+	}
+	defer generations.finish(user, slot)
+
+	sc := utils.StreamClient{
+		User:      user,
+		MessageID: responseMessage.ID,
+		Writer:    w,
+		Context:   r.Context(),
+		OnOutput:  markStreaming(user, r.Header.Get("X-Session-ID"), responseMessage),
+	}
+
+	utils.AddStreamHeaders(sc.Writer)
+
+	_, ok := sc.Writer.(http.Flusher)
+	if !ok {
+		log.Error("Streaming not supported")
+		utils.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	sc.Writer = entry.tee(sc.Writer)
+	sc, stopHeartbeat := utils.KeepAlive(sc, utils.HeartbeatInterval())
+	defer stopHeartbeat()
+	sc, flushChunks := utils.Batch(sc, config.Duration("streamFlushInterval"), int(config.Int64("streamFlushBytes")))
+	defer flushChunks()
+
+	// Build context up to and including the partial answer
+	ctx := buildContext(r.Context(), req.ConversationID, responseMessage.ID, user, model)
+	ctx = append(ctx, providers.SimpleMessage{
+		Role:    "user",
+		Content: continuePrompt,
+	})
+
+	// Mark the message pending, so other sessions see it is being generated
+	responseMessage.Status = StatusPending
+	responseMessage.Error = ""
+	if updatedMsg, updateErr := updateMessage(responseMessage.ID, user, *responseMessage); updateErr != nil {
+		log.Error("Error marking message pending", "err", updateErr)
+	} else {
 		syncManager.Broadcast(user, r.Header.Get("X-Session-ID"), SyncEvent{
 			Type:           EventMessageUpdated,
 			ConversationID: req.ConversationID,
@@ -405,9 +622,67 @@ func retryStream(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	// Send completion event with the new assistant message id
+	metadata := utils.StreamMetadata{
+		ConversationID:     req.ConversationID,
+		UserMessageID:      responseMessage.ParentID,
+		AssistantMessageID: responseMessage.ID,
+	}
+	utils.SendStreamChunk(sc, utils.StreamChunk{
+		Type:    utils.EVENT_METADATA,
+		Payload: metadata,
+	})
+
+	reasoningSetting, _ := settings.Get("reasoningEffort", user)
+
+	providerParams := providers.RequestParams{
+		Messages:        ctx,
+		Model:           model,
+		ReasoningEffort: providers.ReasoningEffort(reasoningSetting),
+		User:            user,
+		MessageID:       responseMessage.ID,
+	}
+	if req.Params != nil {
+		providerParams.SamplingParams = *req.Params
+	}
+
+	var streamStats utils.StreamStats
+
+	completion, err := streamCompletion(req.ConversationID, providerParams, sc)
+	if err != nil {
+		log.Error("Error streaming continue completion", "err", err)
+		utils.SendStreamChunk(sc, utils.StreamChunk{
+			Type:    utils.EVENT_ERROR,
+			Payload: err.Error(),
+			Code:    apierr.CodeOf(err),
+		})
+		responseMessage.Error = err.Error()
+	} else {
+		responseMessage.Content += completion.Content
+		if responseMessage.Reasoning != "" && completion.Reasoning != "" {
+			responseMessage.Reasoning += "\n\n"
+		}
+		responseMessage.Reasoning += completion.Reasoning
+		responseMessage.FinishReason = completion.FinishReason
+		streamStats = completion.Stats
+	}
+
+	responseMessage.Content = postProcess(responseMessage.Content, user)
+	responseMessage.Status = completionStatus(sc, responseMessage, completion)
+	if streamStats.CompletionTokens > 0 {
+		responseMessage.Speed = streamStats.Speed
+		responseMessage.TokenCount += streamStats.CompletionTokens
+		responseMessage.ContextSize = streamStats.PromptTokens
+	}
+
+	if updatedMsg, updateErr := finishMessage(responseMessage.ID, user, *responseMessage); updateErr != nil {
+		log.Error("Error updating continued message", "err", updateErr)
+	} else if updatedMsg != nil {
+		generationCompleted(user, r.Header.Get("X-Session-ID"), updatedMsg)
+		digestOnCompletion(user, slot, updatedMsg)
+	}
+
 	completionData := utils.StreamComplete{
-		UserMessageID:      parent.ID,
+		UserMessageID:      responseMessage.ParentID,
 		AssistantMessageID: responseMessage.ID,
 		StreamStats:        streamStats,
 	}
@@ -423,14 +698,14 @@ func update(w http.ResponseWriter, r *http.Request) {
 	err := utils.ExtractJSONBody(r, &req)
 	if err != nil || req.ConversationID == "" || req.MessageID < 0 || req.Content == "" {
 		log.Error("Error unmarshalling request body", "err", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	err = conversations.Touch(req.ConversationID, user)
 	if err != nil {
 		log.Error("Error updating conversation", "err", err)
-		http.Error(w, fmt.Sprintf("Error updating conversation: %v", err), http.StatusNotFound)
+		utils.Error(w, fmt.Sprintf("Error updating conversation: %v", err), http.StatusNotFound)
 		return
 	}
 
@@ -447,7 +722,7 @@ func update(w http.ResponseWriter, r *http.Request) {
 	msg, err := updateMessage(req.MessageID, user, Message{Content: req.Content})
 	if err != nil {
 		log.Error("Error updating message", "err", err)
-		http.Error(w, fmt.Sprintf("Error updating message: %v", err), http.StatusInternalServerError)
+		utils.Error(w, fmt.Sprintf("Error updating message: %v", err), http.StatusInternalServerError)
 		return
 	}
 	syncManager.Broadcast(user, r.Header.Get("X-Session-ID"), SyncEvent{
@@ -465,13 +740,33 @@ func update(w http.ResponseWriter, r *http.Request) {
 	utils.RespondWithJSON(w, &response, http.StatusOK)
 }
 
+// getMessagesBatch returns the full messages of the given IDs, so clients
+// that load the conversation tree first only fetch the branch they show.
+func getMessagesBatch(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req BatchRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil || len(req.IDs) == 0 {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	slices.Sort(req.IDs)
+	req.IDs = slices.Compact(req.IDs)
+	if len(req.IDs) > maxPageSize {
+		utils.Error(w, fmt.Sprintf("At most %d messages can be fetched at once", maxPageSize), http.StatusBadRequest)
+		return
+	}
+
+	response := &Response{Messages: loadMessages(req.IDs, user)}
+	utils.RespondWithJSON(w, response, http.StatusOK)
+}
+
 func cancelStream(w http.ResponseWriter, r *http.Request) {
 	user := utils.ExtractContextUser(r)
 
 	messageIDStr := r.URL.Query().Get("messageId")
 	if messageIDStr == "" {
 		log.Error("Missing messageId parameter")
-		http.Error(w, "Missing messageId parameter", http.StatusBadRequest)
+		utils.Error(w, "Missing messageId parameter", http.StatusBadRequest)
 		return
 	}
 
@@ -479,30 +774,33 @@ func cancelStream(w http.ResponseWriter, r *http.Request) {
 	_, err := fmt.Sscanf(messageIDStr, "%d", &messageID)
 	if err != nil || messageID <= 0 {
 		log.Error("Invalid messageId parameter", "err", err)
-		http.Error(w, "Invalid messageId parameter", http.StatusBadRequest)
+		utils.Error(w, "Invalid messageId parameter", http.StatusBadRequest)
 		return
 	}
 
 	cancelled := providers.CancelStream(messageID, user)
 	if cancelled {
 		log.Debug("Cancelling stream", "messageID", messageID)
+	} else if syncManager.cancelElsewhere(messageID, user) {
+		log.Debug("Asked other instances to cancel stream", "messageID", messageID)
 	} else {
 		log.Warn("Stream not found for cancellation or unauthorized", "messageID", messageID)
 	}
 
-	// Force status to completed so the frontend never gets stuck on pending
+	// Mark the message stopped so the frontend never gets stuck on pending,
+	// also when no stream was running anymore
 	msg, err := getMessage(messageID, user)
 	if err != nil {
 		log.Error("Failed to fetch message after cancel", "err", err)
-		http.Error(w, "Message not found", http.StatusNotFound)
+		utils.Error(w, "Message not found", http.StatusNotFound)
 		return
 	}
 
-	if msg.Status == "pending" {
-		msg.Status = "completed"
+	if inProgress(msg.Status) {
+		msg.Status = StatusStopped
 		updated, updateErr := updateMessage(messageID, user, *msg)
 		if updateErr != nil {
-			log.Error("Failed to force-complete message after cancel", "err", updateErr)
+			log.Error("Failed to mark message stopped after cancel", "err", updateErr)
 		} else if updated != nil {
 			msg = updated
 			syncManager.Broadcast(user, r.Header.Get("X-Session-ID"), SyncEvent{
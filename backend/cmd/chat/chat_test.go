@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -63,7 +65,7 @@ func (m *mockProviderError) SendChatCompletionStreamRequest(params providers.Req
 
 // setupTest initializes sqlite DB, logger, utils and chat package with the provided mock provider.
 // It returns a teardown function that closes the DB.
-func setupTest(t *testing.T, mock providers.Client) func() {
+func setupTest(t testing.TB, mock providers.Client) func() {
 	t.Helper()
 	dbPath := t.TempDir() + "/test.db"
 	if err := data.InitDataSource(dbPath); err != nil {
@@ -84,6 +86,7 @@ func setupTest(t *testing.T, mock providers.Client) func() {
 	}
 
 	SetupChat(l, data.DB, mock)
+	providers.SetupProviderClient(l, data.DB)
 	tools.SetUpTools(l, data.DB)
 	return teardown
 }
@@ -138,6 +141,14 @@ func TestChatStream_ProviderError(t *testing.T) {
 	if !contains(body, "event: error") {
 		t.Errorf("expected error event in body; got: %s", body)
 	}
+
+	var status string
+	if err := data.DB.QueryRow("SELECT status FROM Messages WHERE role = 'assistant'").Scan(&status); err != nil {
+		t.Fatalf("assistant message not found: %v", err)
+	}
+	if status != StatusError {
+		t.Errorf("expected failed answer marked %q, got %q", StatusError, status)
+	}
 }
 
 func contains(s, sub string) bool { return bytes.Contains([]byte(s), []byte(sub)) }
@@ -536,3 +547,334 @@ func TestChatStream_NewlineSeparatorStreamedBetweenToolCalls(t *testing.T) {
 		t.Errorf("expected 'After tool' content chunk after the '\\n' separator, got chunks: %v", contentChunks)
 	}
 }
+
+// mockProviderTruncated stops the first answer at the token limit and
+// finishes it on the next call.
+type mockProviderTruncated struct {
+	callCount int
+	last      providers.RequestParams
+}
+
+func (m *mockProviderTruncated) SendChatCompletionRequest(params providers.RequestParams) (*providers.ChatCompletionMessage, error) {
+	return nil, nil
+}
+
+func (m *mockProviderTruncated) SendChatCompletionStreamRequest(params providers.RequestParams, sc utils.StreamClient) (*providers.ChatCompletionMessage, error) {
+	m.callCount++
+	m.last = params
+
+	if m.callCount == 1 {
+		_ = utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: "The first half"})
+		return &providers.ChatCompletionMessage{
+			Content:      "The first half",
+			Stats:        utils.StreamStats{PromptTokens: 5, CompletionTokens: 10, Speed: 1},
+			FinishReason: "length",
+		}, nil
+	}
+
+	_ = utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: " and the rest."})
+	return &providers.ChatCompletionMessage{
+		Content:      " and the rest.",
+		Stats:        utils.StreamStats{PromptTokens: 15, CompletionTokens: 4, Speed: 2},
+		FinishReason: "stop",
+	}, nil
+}
+
+func TestContinueStream(t *testing.T) {
+	mock := &mockProviderTruncated{}
+	teardown := setupTest(t, mock)
+	defer teardown()
+
+	b, _ := json.Marshal(map[string]any{"conversationId": "conv-cont", "parentId": 0, "model": "provider-x/model", "content": "write a story"})
+	req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b))
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	chatStream(&flushRecorder{httptest.NewRecorder()}, req)
+
+	var msgID int
+	var convID string
+	err := data.DB.QueryRow("SELECT id, conv_id FROM Messages WHERE role = 'assistant'").Scan(&msgID, &convID)
+	if err != nil {
+		t.Fatalf("assistant message not found: %v", err)
+	}
+	msg, _ := getMessage(msgID, "test-user")
+	if msg.FinishReason != "length" {
+		t.Fatalf("expected finish reason length, got %q", msg.FinishReason)
+	}
+
+	continueReq := func() *flushRecorder {
+		b, _ := json.Marshal(map[string]any{"conversationId": convID, "messageId": msgID})
+		req := httptest.NewRequest(http.MethodPost, "/chat/continue", bytes.NewReader(b))
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := &flushRecorder{httptest.NewRecorder()}
+		continueStream(rr, req)
+		return rr
+	}
+
+	rr := continueReq()
+	body := rr.Body.String()
+	if !contains(body, "and the rest.") || !contains(body, "event: complete") {
+		t.Fatalf("expected continuation chunks and complete event; got: %s", body)
+	}
+
+	// the partial answer is sent back, followed by the request to continue
+	n := len(mock.last.Messages)
+	if n < 2 || mock.last.Messages[n-2].Role != "assistant" || mock.last.Messages[n-2].Content != "The first half" {
+		t.Errorf("expected partial answer before the continue prompt, got %+v", mock.last.Messages)
+	}
+	if mock.last.Messages[n-1].Content != continuePrompt {
+		t.Errorf("expected continue prompt last, got %q", mock.last.Messages[n-1].Content)
+	}
+	if mock.last.Model != "provider-x/model" {
+		t.Errorf("expected the message model to be reused, got %q", mock.last.Model)
+	}
+
+	msg, _ = getMessage(msgID, "test-user")
+	if msg.Content != "The first half and the rest." {
+		t.Errorf("expected continuation appended to the message, got %q", msg.Content)
+	}
+	if msg.FinishReason != "stop" || msg.Status != "completed" {
+		t.Errorf("expected completed message with finish reason stop, got %q %q", msg.Status, msg.FinishReason)
+	}
+	if msg.TokenCount != 14 {
+		t.Errorf("expected token count 14, got %d", msg.TokenCount)
+	}
+
+	// the answer is complete now
+	if rr := continueReq(); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a complete answer, got %d", rr.Code)
+	}
+}
+
+// mockProviderDisconnect simulates the client leaving mid-answer: it streams a
+// chunk, cancels the request and returns what was generated so far.
+type mockProviderDisconnect struct {
+	cancel context.CancelFunc
+	calls  int
+}
+
+func (m *mockProviderDisconnect) SendChatCompletionRequest(params providers.RequestParams) (*providers.ChatCompletionMessage, error) {
+	return &providers.ChatCompletionMessage{}, nil
+}
+
+func (m *mockProviderDisconnect) SendChatCompletionStreamRequest(params providers.RequestParams, sc utils.StreamClient) (*providers.ChatCompletionMessage, error) {
+	m.calls++
+	utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: "Half an"})
+	m.cancel()
+	if err := utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: " answer"}); !errors.Is(err, utils.ErrClientGone) {
+		return nil, fmt.Errorf("expected write to a gone client to fail, got %v", err)
+	}
+	return &providers.ChatCompletionMessage{
+		Content:      "Half an",
+		ToolCalls:    []providers.ToolCall{{ID: "call-1", Name: "search"}},
+		Disconnected: true,
+	}, nil
+}
+
+func TestChatStream_ClientDisconnect(t *testing.T) {
+	mock := &mockProviderDisconnect{}
+	teardown := setupTest(t, mock)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "user", "test-user"))
+	defer cancel()
+	mock.cancel = cancel
+
+	b, _ := json.Marshal(map[string]any{"conversationId": "conv-gone", "parentId": 0, "model": "provider-x/model", "content": "hello"})
+	req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b)).WithContext(ctx)
+	chatStream(&flushRecorder{httptest.NewRecorder()}, req)
+
+	if mock.calls != 1 {
+		t.Errorf("expected no tool round after disconnect, got %d provider calls", mock.calls)
+	}
+
+	var msgID int
+	if err := data.DB.QueryRow("SELECT id FROM Messages WHERE role = 'assistant'").Scan(&msgID); err != nil {
+		t.Fatalf("assistant message not found: %v", err)
+	}
+	msg, _ := getMessage(msgID, "test-user")
+	if msg.Content != "Half an" || msg.Status != "interrupted" {
+		t.Errorf("expected partial answer marked interrupted, got %q %q", msg.Content, msg.Status)
+	}
+}
+
+// mockProviderStopped streams a chunk, records the status of the answer at
+// that point and returns what was generated as stopped by the user.
+type mockProviderStopped struct {
+	statuses []string
+}
+
+func (m *mockProviderStopped) SendChatCompletionRequest(params providers.RequestParams) (*providers.ChatCompletionMessage, error) {
+	return &providers.ChatCompletionMessage{}, nil
+}
+
+func (m *mockProviderStopped) SendChatCompletionStreamRequest(params providers.RequestParams, sc utils.StreamClient) (*providers.ChatCompletionMessage, error) {
+	m.statuses = append(m.statuses, messageStatus(params.MessageID))
+	utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: "Half an"})
+	utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: " answer"})
+	m.statuses = append(m.statuses, messageStatus(params.MessageID))
+	return &providers.ChatCompletionMessage{Content: "Half an answer", Stopped: true}, nil
+}
+
+func messageStatus(id int) string {
+	var status string
+	data.DB.QueryRow("SELECT status FROM Messages WHERE id = ?", id).Scan(&status)
+	return status
+}
+
+func TestChatStream_StatusLifecycle(t *testing.T) {
+	mock := &mockProviderStopped{}
+	teardown := setupTest(t, mock)
+	defer teardown()
+
+	b, _ := json.Marshal(map[string]any{"conversationId": "conv-stop", "parentId": 0, "model": "provider-x/model", "content": "hello"})
+	req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b))
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	chatStream(&flushRecorder{httptest.NewRecorder()}, req)
+
+	if len(mock.statuses) != 2 || mock.statuses[0] != StatusPending || mock.statuses[1] != StatusStreaming {
+		t.Errorf("expected pending before and streaming after the first chunk, got %v", mock.statuses)
+	}
+
+	var msgID int
+	if err := data.DB.QueryRow("SELECT id FROM Messages WHERE role = 'assistant'").Scan(&msgID); err != nil {
+		t.Fatalf("assistant message not found: %v", err)
+	}
+	msg, _ := getMessage(msgID, "test-user")
+	if msg.Content != "Half an answer" || msg.Status != StatusStopped {
+		t.Errorf("expected partial answer marked stopped, got %q %q", msg.Content, msg.Status)
+	}
+}
+
+func TestConversationStats(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	b, _ := json.Marshal(map[string]any{
+		"conversationId": "new-conv",
+		"parentId":       0,
+		"model":          "provider-x/model",
+		"content":        "hello",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b))
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	rr := &flushRecorder{httptest.NewRecorder()}
+	chatStream(rr, req)
+
+	all := conversations.GetAll("test-user")
+	if len(all) != 1 {
+		t.Fatalf("expected one conversation, got %d", len(all))
+	}
+
+	statsReq := httptest.NewRequest(http.MethodGet, "/"+all[0].ID+"/stats", nil)
+	statsReq = statsReq.WithContext(context.WithValue(statsReq.Context(), "user", "test-user"))
+	statsReq.SetPathValue("id", all[0].ID)
+	statsRR := httptest.NewRecorder()
+	getConversationStats(statsRR, statsReq)
+
+	if statsRR.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", statsRR.Code, statsRR.Body.String())
+	}
+	var stats ConversationDetail
+	if err := json.Unmarshal(statsRR.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if stats.Messages["user"] != 1 || stats.Messages["assistant"] != 1 {
+		t.Errorf("messages = %v", stats.Messages)
+	}
+	if stats.Branches != 1 || stats.TotalTokens != 2 || stats.TotalInputTokens != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if len(stats.Models) != 1 || stats.Models[0].Model != "provider-x/model" || stats.Cost != nil {
+		t.Errorf("models = %+v, cost = %v", stats.Models, stats.Cost)
+	}
+
+	// someone else's conversation is not found
+	otherReq := httptest.NewRequest(http.MethodGet, "/"+all[0].ID+"/stats", nil)
+	otherReq = otherReq.WithContext(context.WithValue(otherReq.Context(), "user", "other-user"))
+	otherReq.SetPathValue("id", all[0].ID)
+	otherRR := httptest.NewRecorder()
+	getConversationStats(otherRR, otherReq)
+	if otherRR.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", otherRR.Code)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	for i := 0; i < 3; i++ {
+		b, _ := json.Marshal(map[string]any{
+			"conversationId": "new-conv",
+			"parentId":       0,
+			"model":          "provider-x/model",
+			"content":        fmt.Sprintf("hello %d", i),
+		})
+		req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b))
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		chatStream(&flushRecorder{httptest.NewRecorder()}, req)
+	}
+
+	get := func(handler http.HandlerFunc, target string, convID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		req.SetPathValue("id", convID)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	var first ConversationPage
+	rr := get(getAllConversations, "/?limit=2", "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &first); err != nil {
+		t.Fatalf("decode: %v (%s)", err, rr.Body.String())
+	}
+	if len(first.Conversations) != 2 || first.NextCursor == "" {
+		t.Fatalf("first page = %+v", first)
+	}
+	if first.Conversations[0].Preview == "" {
+		t.Errorf("expected a last message preview")
+	}
+
+	var second ConversationPage
+	rr = get(getAllConversations, "/?limit=2&before="+first.NextCursor, "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &second); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(second.Conversations) != 1 || second.NextCursor != "" {
+		t.Fatalf("second page = %+v", second)
+	}
+	for _, c := range first.Conversations {
+		if c.ID == second.Conversations[0].ID {
+			t.Errorf("conversation %s returned on both pages", c.ID)
+		}
+	}
+
+	if rr = get(getAllConversations, "/?before=unknown", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown cursor status = %d, want 400", rr.Code)
+	}
+
+	convID := second.Conversations[0].ID
+	var newest MessagePage
+	rr = get(getConversationMessages, "/"+convID+"/messages?limit=1", convID)
+	if err := json.Unmarshal(rr.Body.Bytes(), &newest); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(newest.Messages) != 1 || newest.NextCursor == 0 {
+		t.Fatalf("newest messages = %+v", newest)
+	}
+	reply := newest.Messages[newest.NextCursor]
+	if reply == nil || reply.Role != "assistant" {
+		t.Fatalf("expected the assistant reply first, got %+v", reply)
+	}
+
+	var older MessagePage
+	rr = get(getConversationMessages, fmt.Sprintf("/%s/messages?limit=1&before=%d", convID, reply.ID), convID)
+	if err := json.Unmarshal(rr.Body.Bytes(), &older); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	prompt := older.Messages[reply.ParentID]
+	if prompt == nil || len(prompt.Children) != 1 || prompt.Children[0] != reply.ID {
+		t.Errorf("children outside the page should still be listed, got %+v", prompt)
+	}
+}
@@ -2,6 +2,8 @@ package chat
 
 import (
 	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/jobs"
+	"github.com/Bajahaw/ai-ui/cmd/memory"
 	"github.com/Bajahaw/ai-ui/cmd/providers"
 	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
 	"github.com/Bajahaw/ai-ui/cmd/tools"
@@ -12,10 +14,14 @@ import (
 
 var log *logger.Logger
 var conversations ConversationRepo
+var drafts DraftRepo
+var reads ReadStateRepo
 var toolCalls tools.ToolCallsRepository
 var provider providers.Client
 var settings stngs.Repository
 var files fs.Repository
+var memories memory.Repository
+var models providers.Repository
 
 func SetupChat(
 	l *logger.Logger,
@@ -25,7 +31,19 @@ func SetupChat(
 	log = l
 	provider = p
 	conversations = NewRepository(db)
+	drafts = NewDraftRepository(db)
+	reads = NewReadStateRepository(db)
 	toolCalls = tools.NewToolCallsRepository(db)
 	settings = stngs.NewRepository(db)
 	files = fs.NewRepository(db)
+	memories = memory.NewRepository(db)
+	models = providers.NewRepository(db)
+	messageCache = newTreeCache()
+	fs.OnUpdate(func(file fs.File) { messageCache.updateFile(file) })
+	loadFailedSaves(db)
+	setupSyncBus()
+	tools.RegisterBuiltIn("search_history", searchHistoryTool)
+	jobs.Register(BatchJob, batchJob)
+	jobs.SetTimeout(BatchJob, batchTimeout)
+	go enforceRetention()
 }
@@ -0,0 +1,61 @@
+package chat
+
+import (
+	"net/http"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// completeChat sends a message like POST /stream but answers with a single
+// JSON response once the answer is saved, for clients that do not read
+// event streams such as scripts and webhook integrations.
+func completeChat(w http.ResponseWriter, r *http.Request) {
+	complete(w, r, chatStream)
+}
+
+// completeRetry is the JSON counterpart of POST /retry/stream.
+func completeRetry(w http.ResponseWriter, r *http.Request) {
+	complete(w, r, retryStream)
+}
+
+// complete runs a streaming handler to its end and responds with what the
+// user's responseType setting asks for: the question and the answer
+// ("messages") or only the answer ("answer"). Errors of the handler are
+// passed on as they are.
+func complete(w http.ResponseWriter, r *http.Request, stream http.HandlerFunc) {
+	user := utils.ExtractContextUser(r)
+	rec := &replyRecorder{header: make(http.Header), status: http.StatusOK}
+	stream(rec, r)
+
+	if rec.status >= 400 {
+		for key, values := range rec.header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(rec.status)
+		_, _ = w.Write(rec.body.Bytes())
+		return
+	}
+	if rec.metadata == nil {
+		utils.Error(w, "No response was generated", http.StatusInternalServerError)
+		return
+	}
+
+	answer, err := getMessage(rec.metadata.AssistantMessageID, user)
+	if err != nil {
+		log.Error("Error retrieving completed answer", "err", err)
+		utils.Error(w, "Error retrieving the answer", http.StatusInternalServerError)
+		return
+	}
+
+	responseType, _ := settings.Get("responseType", user)
+	if responseType == "answer" {
+		utils.RespondWithJSON(w, answer, http.StatusOK)
+		return
+	}
+
+	resp := Response{Messages: map[int]*Message{answer.ID: answer}}
+	if question, err := getMessage(rec.metadata.UserMessageID, user); err == nil {
+		resp.Messages[question.ID] = question
+	}
+	utils.RespondWithJSON(w, resp, http.StatusOK)
+}
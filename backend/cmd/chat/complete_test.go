@@ -0,0 +1,82 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+func TestCompleteChat(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	post := func(handler http.HandlerFunc, body map[string]any) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/chat/complete", bytes.NewReader(b))
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	rr := post(completeChat, map[string]any{"conversationId": "conv-complete", "parentId": 0, "model": "provider-x/model", "content": "hello"})
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected a JSON response, got %d %q: %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	var resp Response
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var question, answer *Message
+	for _, msg := range resp.Messages {
+		switch msg.Role {
+		case "user":
+			question = msg
+		case "assistant":
+			answer = msg
+		}
+	}
+	if len(resp.Messages) != 2 || question == nil || answer == nil {
+		t.Fatalf("expected the question and the answer, got %s", rr.Body.String())
+	}
+	if question.Content != "hello" || answer.Content != "final content" || answer.ParentID != question.ID {
+		t.Errorf("unexpected messages %+v %+v", question, answer)
+	}
+
+	if err := settings.Save(map[string]string{"responseType": "answer"}, "test-user"); err != nil {
+		t.Fatal(err)
+	}
+	rr = post(completeRetry, map[string]any{"conversationId": answer.ConvID, "parentId": question.ID, "model": "provider-x/model"})
+	var retried Message
+	if err := json.Unmarshal(rr.Body.Bytes(), &retried); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("retry: %d %s", rr.Code, rr.Body.String())
+	}
+	if retried.Role != "assistant" || retried.ID == answer.ID || retried.ParentID != question.ID || retried.Content != "final content" {
+		t.Errorf("expected another answer to the question, got %+v", retried)
+	}
+
+	// errors of the stream handler are passed on
+	rr = post(completeChat, map[string]any{"parentId": 0, "content": "no conversation"})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid request, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestReplyRecorderFrames(t *testing.T) {
+	stream := ": keep-alive\n\nevent: " + utils.EVENT_METADATA + "\ndata: {\"metadata\":{\"assistantMessageId\":7}}\n\nevent: content\ndata: {}\n\n"
+	// frames merged into one write and split across writes
+	for _, pieces := range [][]string{{stream}, {stream[:20], stream[20:41], stream[41:]}} {
+		rec := &replyRecorder{header: make(http.Header), status: http.StatusOK}
+		for _, piece := range pieces {
+			_, _ = rec.Write([]byte(piece))
+		}
+		if rec.metadata == nil || rec.metadata.AssistantMessageID != 7 {
+			t.Errorf("metadata not read from %q: %+v", pieces, rec.metadata)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package chat
+
+import (
+	"context"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/moderation"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// blockedAnswer replaces an answer blocked by moderation.
+const blockedAnswer = "_This answer was blocked by moderation._"
+
+// streamCompletion streams an answer from the provider.
+//
+// With moderation enabled the user's new message is checked before it is
+// sent and the answer after it arrived, flagged content being reported to
+// the client with a moderation event. When flagged content is blocked, the
+// text of the answer is held back until it passed, so a blocked answer
+// reaches the client as blockedAnswer only. With outbound redaction enabled
+// the messages are redacted before they are sent, and the placeholders in
+// the answer are restored, both in the stream and in the returned
+// completion.
+func streamCompletion(convID string, params providers.RequestParams, sc utils.StreamClient) (*providers.ChatCompletionMessage, error) {
+	moderated := moderation.Enabled()
+	if moderated {
+		if last := len(params.Messages) - 1; last >= 0 && params.Messages[last].Role == "user" {
+			d := moderate(sc, params.User, convID, params.MessageID, moderation.StageInput, params.Messages[last].Content)
+			if d.Blocked() {
+				return nil, apierr.New(apierr.ContentBlocked, "The message was blocked by moderation")
+			}
+		}
+	}
+
+	var held *heldOutput
+	outputSC := sc
+	if moderation.Blocking() {
+		held = &heldOutput{text: make(map[string]string)}
+		outputSC.Transform = held.transform
+	}
+
+	completion, err := redactedCompletion(convID, params, outputSC)
+
+	if moderated {
+		answer := held.content()
+		if completion != nil {
+			answer = completion.Content
+		}
+		d := moderate(sc, params.User, convID, params.MessageID, moderation.StageOutput, answer)
+		if d.Blocked() && completion != nil {
+			completion.Content = blockedAnswer
+			completion.Reasoning = ""
+			completion.ToolCalls = nil
+		}
+		held.release(sc, d.Blocked())
+	}
+	return completion, err
+}
+
+// heldOutput keeps the text of an answer from the client until it passed
+// moderation.
+type heldOutput struct {
+	text map[string]string
+}
+
+func (h *heldOutput) transform(chunk utils.StreamChunk) utils.StreamChunk {
+	if text, ok := chunk.Payload.(string); ok && (chunk.Type == utils.CONTENT || chunk.Type == utils.REASONING) {
+		h.text[chunk.Type] += text
+		chunk.Payload = ""
+	}
+	return chunk
+}
+
+func (h *heldOutput) content() string {
+	if h == nil {
+		return ""
+	}
+	return h.text[utils.CONTENT]
+}
+
+// release sends the held text, or blockedAnswer in its place.
+func (h *heldOutput) release(sc utils.StreamClient, blocked bool) {
+	if h == nil {
+		return
+	}
+	if blocked {
+		utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: blockedAnswer})
+		return
+	}
+	for _, kind := range []string{utils.REASONING, utils.CONTENT} {
+		if text := h.text[kind]; text != "" {
+			utils.SendStreamChunk(sc, utils.StreamChunk{Type: kind, Payload: text})
+		}
+	}
+}
+
+func redactedCompletion(convID string, params providers.RequestParams, sc utils.StreamClient) (*providers.ChatCompletionMessage, error) {
+	r := newRedactor(convID, params.User)
+	if r == nil {
+		return provider.SendChatCompletionStreamRequest(params, sc)
+	}
+
+	params.Messages = r.redactMessages(params.Messages)
+	restorer := &streamRestorer{r: r, held: make(map[string]string)}
+	redactedSC := sc
+	redactedSC.Transform = restorer.transform
+	if next := sc.Transform; next != nil {
+		redactedSC.Transform = func(chunk utils.StreamChunk) utils.StreamChunk {
+			if chunk = restorer.transform(chunk); chunk.Payload == "" {
+				return chunk
+			}
+			return next(chunk)
+		}
+	}
+
+	completion, err := provider.SendChatCompletionStreamRequest(params, redactedSC)
+	restorer.flush(sc)
+	if completion != nil {
+		completion.Content = r.restore(completion.Content)
+		completion.Reasoning = r.restore(completion.Reasoning)
+		for i := range completion.ToolCalls {
+			completion.ToolCalls[i].Args = r.restore(completion.ToolCalls[i].Args)
+		}
+	}
+	return completion, err
+}
+
+// moderate checks text and tells the client about flagged content.
+func moderate(sc utils.StreamClient, user string, convID string, messageID int, stage moderation.Stage, text string) *moderation.Decision {
+	d := moderation.Check(requestContext(sc), user, convID, messageID, stage, text)
+	if d != nil {
+		utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.EVENT_MODERATION, Payload: d})
+	}
+	return d
+}
+
+// requestContext is the context of the request a stream answers, done once
+// the client goes away.
+func requestContext(sc utils.StreamClient) context.Context {
+	if sc.Context == nil {
+		return context.Background()
+	}
+	return sc.Context
+}
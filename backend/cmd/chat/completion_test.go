@@ -0,0 +1,65 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/moderation"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func TestChatStream_Moderation(t *testing.T) {
+	mock := &mockProviderEcho{}
+	teardown := setupTest(t, mock)
+	defer teardown()
+	moderation.SetupModeration(logger.New(os.Stdout), data.DB)
+	t.Setenv("MODERATION_RULES", "forbidden, mail")
+
+	stream := func(content string) (string, *Message) {
+		t.Helper()
+		b, _ := json.Marshal(map[string]any{"conversationId": "new", "parentId": 0, "model": "provider-x/model", "content": content})
+		req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b))
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := &flushRecorder{httptest.NewRecorder()}
+		chatStream(rr, req)
+
+		var msgID int
+		if err := data.DB.QueryRow("SELECT id FROM Messages WHERE role = 'assistant' ORDER BY id DESC LIMIT 1").Scan(&msgID); err != nil {
+			t.Fatalf("assistant message not found: %v", err)
+		}
+		msg, _ := getMessage(msgID, "test-user")
+		return rr.Body.String(), msg
+	}
+
+	// annotated: the answer is kept and the client told about it
+	body, msg := stream("hello")
+	if !strings.Contains(body, "event: moderation") || !strings.Contains(body, `"content": "Mail [EMA`) || msg.Content != "Mail [EMAIL_1] now" {
+		t.Errorf("expected the answer annotated, got %q and %s", msg.Content, body)
+	}
+
+	t.Setenv("MODERATION_ACTION", "block")
+	mock.sent = nil
+	body, msg = stream("something forbidden")
+	if mock.sent != nil {
+		t.Error("expected a blocked message not to reach the provider")
+	}
+	if !strings.Contains(body, "CONTENT_BLOCKED") || msg.Status != StatusError {
+		t.Errorf("expected the message blocked, got %q %q and %s", msg.Status, msg.Error, body)
+	}
+
+	body, msg = stream("hello")
+	if msg.Content != blockedAnswer {
+		t.Errorf("expected the answer replaced, got %q", msg.Content)
+	}
+	if strings.Contains(body, `"content": "Mail [EMA`) || !strings.Contains(body, blockedAnswer) {
+		t.Errorf("expected the flagged answer held back from the stream, got %s", body)
+	}
+}
@@ -16,25 +16,46 @@ type Conversation struct {
 	Title     string    `json:"title,omitempty"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
+	// MemoryEnabled controls whether saved memories are used in this conversation
+	MemoryEnabled bool `json:"memoryEnabled"`
+	// Pinned conversations are never archived or deleted by retention
+	Pinned bool `json:"pinned"`
+	// ArchivedAt is when the conversation was archived, nil while it is
+	// listed
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	// Unread is the number of answers the user has not seen, only set in
+	// the conversation list
+	Unread int `json:"unread,omitempty"`
+}
+
+type ConversationRequest struct {
+	Conv Conversation `json:"conversation"`
+}
+
+type RenameRequest struct {
+	Title string `json:"title"`
+}
+
+type ConversationMemoryRequest struct {
+	Enabled bool `json:"enabled"`
 }
 
 func saveConversation(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Conv Conversation `json:"conversation"`
-	}
+	var req ConversationRequest
 	err := utils.ExtractJSONBody(r, &req)
 	if err != nil {
 		log.Error("Error unmarshalling request body", "err", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	conv := &Conversation{
-		ID:        uuid.NewString(),
-		UserID:    utils.ExtractContextUser(r),
-		Title:     req.Conv.Title,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:            uuid.NewString(),
+		UserID:        utils.ExtractContextUser(r),
+		Title:         req.Conv.Title,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		MemoryEnabled: true,
 	}
 
 	// debug
@@ -43,7 +64,7 @@ func saveConversation(w http.ResponseWriter, r *http.Request) {
 	err = conversations.Save(conv)
 	if err != nil {
 		log.Error("Error adding conversation", "err", err)
-		http.Error(w, fmt.Sprintf("Error adding conversation: %v", err), http.StatusInternalServerError)
+		utils.Error(w, fmt.Sprintf("Error adding conversation: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -64,7 +85,7 @@ func getConversation(w http.ResponseWriter, r *http.Request) {
 	conv, err := conversations.GetByID(convId, user)
 	if err != nil {
 		log.Error("Error retrieving conversation", "err", err)
-		http.Error(w, "Error retrieving conversation", http.StatusNotFound)
+		utils.Error(w, "Error retrieving conversation", http.StatusNotFound)
 		return
 	}
 	utils.RespondWithJSON(w, &conv, http.StatusOK)
@@ -72,9 +93,23 @@ func getConversation(w http.ResponseWriter, r *http.Request) {
 
 func getAllConversations(writer http.ResponseWriter, r *http.Request) {
 	user := utils.ExtractContextUser(r)
+	if isPaged(r) {
+		getConversationsPage(writer, r, user)
+		return
+	}
+	archived := isArchived(r)
+	listed := make([]*Conversation, 0)
+	unread := unreadCounts(user)
+	for _, conv := range conversations.GetAll(user) {
+		if (conv.ArchivedAt != nil) != archived {
+			continue
+		}
+		conv.Unread = unread[conv.ID]
+		listed = append(listed, conv)
+	}
 	utils.RespondWithJSON(
 		writer,
-		conversations.GetAll(user),
+		listed,
 		http.StatusOK,
 	)
 }
@@ -84,7 +119,7 @@ func deleteConversation(w http.ResponseWriter, r *http.Request) {
 	convId := r.PathValue("id")
 	err := conversations.DeleteByID(convId, user)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error deleting conversation: %v", err), http.StatusInternalServerError)
+		utils.Error(w, fmt.Sprintf("Error deleting conversation: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -101,20 +136,18 @@ func deleteConversation(w http.ResponseWriter, r *http.Request) {
 func renameConversation(w http.ResponseWriter, r *http.Request) {
 	user := utils.ExtractContextUser(r)
 	convId := r.PathValue("id")
-	var req struct {
-		Title string `json:"title"`
-	}
+	var req RenameRequest
 	err := utils.ExtractJSONBody(r, &req)
 	if err != nil {
 		log.Error("Error unmarshalling request body", "err", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	conv, err := conversations.GetByID(convId, user)
 	if err != nil {
 		log.Error("Error retrieving conversation", "err", err)
-		http.Error(w, "Error retrieving conversation", http.StatusNotFound)
+		utils.Error(w, "Error retrieving conversation", http.StatusNotFound)
 		return
 	}
 
@@ -123,7 +156,7 @@ func renameConversation(w http.ResponseWriter, r *http.Request) {
 	err = conversations.Update(conv)
 	if err != nil {
 		log.Error("Error updating conversation", "err", err)
-		http.Error(w, fmt.Sprintf("Error updating conversation: %v", err), http.StatusInternalServerError)
+		utils.Error(w, fmt.Sprintf("Error updating conversation: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -138,9 +171,50 @@ func renameConversation(w http.ResponseWriter, r *http.Request) {
 	utils.RespondWithJSON(w, &conv, http.StatusOK)
 }
 
+func setConversationMemory(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	convId := r.PathValue("id")
+	var req ConversationMemoryRequest
+	err := utils.ExtractJSONBody(r, &req)
+	if err != nil {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	conv, err := conversations.GetByID(convId, user)
+	if err != nil {
+		log.Error("Error retrieving conversation", "err", err)
+		utils.Error(w, "Error retrieving conversation", http.StatusNotFound)
+		return
+	}
+
+	conv.MemoryEnabled = req.Enabled
+
+	err = conversations.Update(conv)
+	if err != nil {
+		log.Error("Error updating conversation", "err", err)
+		utils.Error(w, fmt.Sprintf("Error updating conversation: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	sessionID := r.Header.Get("X-Session-ID")
+	syncManager.Broadcast(user, sessionID, SyncEvent{
+		Type:           EventConversationUpdated,
+		ConversationID: convId,
+		Conversation:   conv,
+	})
+
+	utils.RespondWithJSON(w, &conv, http.StatusOK)
+}
+
 func getConversationMessages(w http.ResponseWriter, r *http.Request) {
 	user := utils.ExtractContextUser(r)
 	convId := r.PathValue("id")
+	if isPaged(r) {
+		getMessagesPage(w, r, convId, user)
+		return
+	}
 	messages := getAllConversationMessages(convId, user)
 	utils.RespondWithJSON(w, &messages, http.StatusOK)
 }
@@ -180,7 +254,7 @@ func getStats(w http.ResponseWriter, r *http.Request) {
 	)
 	if err != nil {
 		log.Error("Error querying stats", "err", err)
-		http.Error(w, "Error querying stats", http.StatusInternalServerError)
+		utils.Error(w, "Error querying stats", http.StatusInternalServerError)
 		return
 	}
 
@@ -3,8 +3,11 @@ package chat
 import (
 	"database/sql"
 	"errors"
+	"sync"
 	"time"
 
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
 	"github.com/google/uuid"
 )
 
@@ -12,41 +15,54 @@ type ConversationRepo interface {
 	GetByID(id string, user string) (*Conversation, error)
 	Touch(id string, user string) error
 	GetAll(user string) []*Conversation
+	ListPage(user string, limit int, before string, archived bool) ([]*ConversationSummary, error)
 	Save(conversation *Conversation) error
 	Update(conversation *Conversation) error
 	DeleteByID(id string, user string) error
+	// ArchiveStale archives the user's unpinned conversations last updated
+	// before cutoff and returns their IDs.
+	ArchiveStale(user string, cutoff time.Time, now time.Time) ([]string, error)
+	// Stale returns the IDs of the user's unpinned conversations last
+	// updated before cutoff.
+	Stale(user string, cutoff time.Time) ([]string, error)
+	// Forget drops a conversation from memory after another instance
+	// changed it.
+	Forget(id string)
 }
 
+// ConversationRepository keeps conversations it has read or written in
+// memory, every write to the Conversations table goes through it.
 type ConversationRepository struct {
 	db    *sql.DB
+	mu    sync.RWMutex
 	cache map[string]*Conversation
 }
 
 func newConversation(userId string) *Conversation {
 	return &Conversation{
-		ID:        uuid.New().String(),
-		UserID:    userId,
-		Title:     "",
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
+		ID:            uuid.New().String(),
+		UserID:        userId,
+		Title:         "",
+		CreatedAt:     time.Now().UTC(),
+		UpdatedAt:     time.Now().UTC(),
+		MemoryEnabled: true,
 	}
 }
 
 func NewRepository(db *sql.DB) *ConversationRepository {
 	return &ConversationRepository{
-		db: db,
-		// todo
-		//cache: make(map[string]*Conversation),
+		db:    db,
+		cache: make(map[string]*Conversation),
 	}
 }
 
 func (repo *ConversationRepository) GetByID(id string, user string) (*Conversation, error) {
-	if conv, exists := repo.cache[id]; exists {
+	if conv, exists := repo.cached(id); exists && conv.UserID == user {
 		return conv, nil
 	}
 
-	query := `SELECT * FROM Conversations WHERE id = ? AND user = ?`
-	row := repo.db.QueryRow(query, id, user)
+	query := `SELECT id, user, title, created_at, updated_at, memory_enabled, pinned, archived_at FROM Conversations WHERE id = ? AND user = ?`
+	row := data.QueryRow(repo.db, query, id, user)
 
 	var conv Conversation
 	err := row.Scan(
@@ -55,18 +71,24 @@ func (repo *ConversationRepository) GetByID(id string, user string) (*Conversati
 		&conv.Title,
 		&conv.CreatedAt,
 		&conv.UpdatedAt,
+		&conv.MemoryEnabled,
+		&conv.Pinned,
+		&conv.ArchivedAt,
 	)
 	if err == nil {
-		//repo.cache[id] = &conv
+		repo.store(&conv)
 		return &conv, nil
 	}
 
 	return nil, errors.New("conversation not found")
 }
 
+// Touch marks a conversation updated now, which also takes it out of the
+// archive.
 func (repo *ConversationRepository) Touch(id string, user string) error {
-	query := `UPDATE Conversations SET updated_at = ? WHERE id = ? AND user = ?`
-	result, err := repo.db.Exec(query, time.Now().UTC(), id, user)
+	now := time.Now().UTC()
+	query := `UPDATE Conversations SET updated_at = ?, archived_at = NULL WHERE id = ? AND user = ?`
+	result, err := data.Exec(repo.db, query, now, id, user)
 	if err != nil {
 		return err
 	}
@@ -80,11 +102,17 @@ func (repo *ConversationRepository) Touch(id string, user string) error {
 		return errors.New("conversation not found")
 	}
 
+	repo.mu.Lock()
+	if conv, exists := repo.cache[id]; exists {
+		conv.UpdatedAt = now
+		conv.ArchivedAt = nil
+	}
+	repo.mu.Unlock()
 	return nil
 }
 
 func (repo *ConversationRepository) GetAll(user string) []*Conversation {
-	query := `SELECT * FROM Conversations WHERE user = ?`
+	query := `SELECT id, user, title, created_at, updated_at, memory_enabled, pinned, archived_at FROM Conversations WHERE user = ?`
 	var conversations = make([]*Conversation, 0)
 
 	rows, err := repo.db.Query(query, user)
@@ -102,6 +130,9 @@ func (repo *ConversationRepository) GetAll(user string) []*Conversation {
 			&conv.Title,
 			&conv.CreatedAt,
 			&conv.UpdatedAt,
+			&conv.MemoryEnabled,
+			&conv.Pinned,
+			&conv.ArchivedAt,
 		)
 		if err != nil {
 			return conversations
@@ -112,35 +143,92 @@ func (repo *ConversationRepository) GetAll(user string) []*Conversation {
 	return conversations
 }
 
+// ListPage returns the listed or, with archived, the archived conversations
+// updated before the conversation with ID before, newest first. An empty
+// before starts from the most recent.
+func (repo *ConversationRepository) ListPage(user string, limit int, before string, archived bool) ([]*ConversationSummary, error) {
+	query := `
+		SELECT c.id, c.title, c.updated_at, c.pinned, COALESCE((
+			SELECT substr(m.content, 1, ?) FROM Messages m
+			WHERE m.conv_id = c.id
+			ORDER BY m.id DESC LIMIT 1
+		), '')
+		FROM Conversations c
+		WHERE c.user = ?
+	`
+	args := []any{previewLength, user}
+	if archived {
+		query += ` AND c.archived_at IS NOT NULL`
+	} else {
+		query += ` AND c.archived_at IS NULL`
+	}
+	if before != "" {
+		var exists bool
+		err := repo.db.QueryRow(`SELECT 1 FROM Conversations WHERE id = ? AND user = ?`, before, user).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidCursor
+		}
+		if err != nil {
+			return nil, err
+		}
+		query += ` AND (c.updated_at, c.id) < (SELECT updated_at, id FROM Conversations WHERE id = ?)`
+		args = append(args, before)
+	}
+	query += ` ORDER BY c.updated_at DESC, c.id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := make([]*ConversationSummary, 0, limit)
+	for rows.Next() {
+		var conv ConversationSummary
+		if err := rows.Scan(&conv.ID, &conv.Title, &conv.UpdatedAt, &conv.Pinned, &conv.Preview); err != nil {
+			return nil, err
+		}
+		page = append(page, &conv)
+	}
+	return page, rows.Err()
+}
+
 func (repo *ConversationRepository) Save(conversation *Conversation) error {
-	query := `INSERT INTO Conversations (id, user, title, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`
+	query := `INSERT INTO Conversations (id, user, title, created_at, updated_at, memory_enabled, pinned, archived_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
 	_, err := repo.db.Exec(query,
 		conversation.ID,
 		conversation.UserID,
 		conversation.Title,
 		conversation.CreatedAt,
 		conversation.UpdatedAt,
+		conversation.MemoryEnabled,
+		conversation.Pinned,
+		conversation.ArchivedAt,
 	)
 	if err != nil {
 		return err
 	}
 
-	//repo.cache[conversation.ID] = conversation
+	repo.store(conversation)
 	return nil
 }
 
 func (repo *ConversationRepository) Update(conversation *Conversation) error {
-	query := `UPDATE Conversations SET title = ?, updated_at = ? WHERE id = ?`
+	query := `UPDATE Conversations SET title = ?, updated_at = ?, memory_enabled = ?, pinned = ?, archived_at = ? WHERE id = ?`
 	_, err := repo.db.Exec(query,
 		conversation.Title,
 		conversation.UpdatedAt,
+		conversation.MemoryEnabled,
+		conversation.Pinned,
+		conversation.ArchivedAt,
 		conversation.ID,
 	)
 	if err != nil {
 		return err
 	}
 
-	//repo.cache[conversation.ID] = conversation
+	repo.store(conversation)
 	return nil
 }
 
@@ -151,6 +239,82 @@ func (repo *ConversationRepository) DeleteByID(id string, user string) error {
 		return err
 	}
 
-	//delete(repo.cache, id)
+	repo.mu.Lock()
+	delete(repo.cache, id)
+	repo.mu.Unlock()
 	return nil
 }
+
+func (repo *ConversationRepository) ArchiveStale(user string, cutoff time.Time, now time.Time) ([]string, error) {
+	ids, err := repo.stale(user, cutoff, `AND archived_at IS NULL`)
+	if err != nil || len(ids) == 0 {
+		return ids, err
+	}
+
+	args := []any{now}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query := `UPDATE Conversations SET archived_at = ? WHERE id IN (` + utils.SqlPlaceholders(len(ids)) + `)`
+	if _, err := repo.db.Exec(query, args...); err != nil {
+		return nil, err
+	}
+
+	repo.mu.Lock()
+	for _, id := range ids {
+		if conv, exists := repo.cache[id]; exists {
+			archivedAt := now
+			conv.ArchivedAt = &archivedAt
+		}
+	}
+	repo.mu.Unlock()
+	return ids, nil
+}
+
+func (repo *ConversationRepository) Stale(user string, cutoff time.Time) ([]string, error) {
+	return repo.stale(user, cutoff, "")
+}
+
+func (repo *ConversationRepository) stale(user string, cutoff time.Time, filter string) ([]string, error) {
+	query := `SELECT id FROM Conversations WHERE user = ? AND pinned = 0 AND updated_at < ? ` + filter
+	rows, err := repo.db.Query(query, user, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (repo *ConversationRepository) Forget(id string) {
+	repo.mu.Lock()
+	delete(repo.cache, id)
+	repo.mu.Unlock()
+}
+
+// cached returns a copy of the cached conversation, callers may change it.
+func (repo *ConversationRepository) cached(id string) (*Conversation, bool) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	conv, exists := repo.cache[id]
+	if !exists {
+		return nil, false
+	}
+	c := *conv
+	return &c, true
+}
+
+func (repo *ConversationRepository) store(conv *Conversation) {
+	c := *conv
+	repo.mu.Lock()
+	repo.cache[conv.ID] = &c
+	repo.mu.Unlock()
+}
@@ -0,0 +1,32 @@
+package chat
+
+import (
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/mail"
+)
+
+// digestOnCompletion queues a finished response for the user's email
+// digest when it took at least emailDigestMinDuration and no session of
+// the user is open to see it arrive.
+func digestOnCompletion(user string, slot int, msg *Message) {
+	if msg.Status != StatusCompleted || !mail.Enabled() {
+		return
+	}
+	minDuration := config.Duration("emailDigestMinDuration")
+	started := generations.startedAt(user, slot)
+	if started.IsZero() || time.Since(started) < minDuration || syncManager.Online(user) {
+		return
+	}
+
+	item := mail.DigestItem{
+		ConversationID: msg.ConvID,
+		Content:        msg.Content,
+		FinishedAt:     time.Now(),
+	}
+	if conv, err := conversations.GetByID(msg.ConvID, user); err == nil {
+		item.Title = conv.Title
+	}
+	mail.QueueDigest(user, item)
+}
@@ -0,0 +1,136 @@
+package chat
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// Draft is a message the user started typing but has not sent yet.
+type Draft struct {
+	ConversationID  string    `json:"conversationId"`
+	Content         string    `json:"content"`
+	ParentID        int       `json:"parentId,omitempty"`
+	AttachedFileIDs []string  `json:"attachedFileIds"`
+	UpdatedAt       time.Time `json:"updatedAt,omitzero"`
+}
+
+func (d *Draft) empty() bool {
+	return strings.TrimSpace(d.Content) == "" && len(d.AttachedFileIDs) == 0
+}
+
+func getDraft(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	convID := r.PathValue("id")
+	if _, err := conversations.GetByID(convID, user); err != nil {
+		utils.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	draft, err := drafts.Get(convID, user)
+	if errors.Is(err, sql.ErrNoRows) {
+		draft = &Draft{ConversationID: convID, AttachedFileIDs: []string{}}
+	} else if err != nil {
+		log.Error("Error retrieving draft", "err", err)
+		utils.Error(w, "Error retrieving draft", http.StatusInternalServerError)
+		return
+	}
+
+	// files deleted since the draft was saved are dropped
+	if len(draft.AttachedFileIDs) > 0 {
+		attached, err := files.GetByIDs(draft.AttachedFileIDs, user)
+		if err != nil {
+			log.Error("Error getting draft files", "err", err)
+			utils.Error(w, "Error retrieving draft", http.StatusInternalServerError)
+			return
+		}
+		draft.AttachedFileIDs = slices.DeleteFunc(draft.AttachedFileIDs, func(id string) bool {
+			return !slices.ContainsFunc(attached, func(f fs.File) bool { return f.ID == id })
+		})
+	}
+
+	utils.RespondWithJSON(w, draft, http.StatusOK)
+}
+
+// saveDraft stores the draft of a conversation and sends it to the user's
+// other sessions. An empty draft is deleted.
+func saveDraft(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	convID := r.PathValue("id")
+	var draft Draft
+	if err := utils.ExtractJSONBody(r, &draft); err != nil {
+		log.Error("Error unmarshalling draft body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	draft.ConversationID = convID
+	seen := make(map[string]bool)
+	fileIDs := make([]string, 0, len(draft.AttachedFileIDs))
+	for _, id := range draft.AttachedFileIDs {
+		if !seen[id] {
+			seen[id] = true
+			fileIDs = append(fileIDs, id)
+		}
+	}
+	draft.AttachedFileIDs = fileIDs
+
+	if _, err := conversations.GetByID(convID, user); err != nil {
+		utils.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	attached, err := files.GetByIDs(draft.AttachedFileIDs, user)
+	if err != nil {
+		log.Error("Error getting draft files", "err", err)
+		utils.Error(w, "Error saving draft", http.StatusInternalServerError)
+		return
+	}
+	if len(attached) != len(draft.AttachedFileIDs) {
+		utils.Error(w, "Unknown attached file", http.StatusBadRequest)
+		return
+	}
+
+	if draft.empty() {
+		if _, err = drafts.Delete(convID, user); err != nil {
+			log.Error("Error deleting draft", "err", err)
+			utils.Error(w, "Error saving draft", http.StatusInternalServerError)
+			return
+		}
+		draft.Content = ""
+		draft.ParentID = 0
+	} else if err = drafts.Save(&draft); err != nil {
+		log.Error("Error saving draft", "err", err)
+		utils.Error(w, "Error saving draft", http.StatusInternalServerError)
+		return
+	}
+
+	syncManager.Broadcast(user, r.Header.Get("X-Session-ID"), SyncEvent{
+		Type:           EventDraftUpdated,
+		ConversationID: convID,
+		Draft:          &draft,
+	})
+
+	utils.RespondWithJSON(w, &draft, http.StatusOK)
+}
+
+// clearDraft drops the draft of a conversation once its message is sent.
+func clearDraft(convID string, user string, sessionID string) {
+	deleted, err := drafts.Delete(convID, user)
+	if err != nil {
+		log.Error("Error deleting draft", "err", err)
+		return
+	}
+	if deleted {
+		syncManager.Broadcast(user, sessionID, SyncEvent{
+			Type:           EventDraftUpdated,
+			ConversationID: convID,
+			Draft:          &Draft{ConversationID: convID, AttachedFileIDs: []string{}},
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
+
+type DraftRepo interface {
+	Get(convID string, user string) (*Draft, error)
+	Save(draft *Draft) error
+	// Delete reports whether there was a draft to delete.
+	Delete(convID string, user string) (bool, error)
+}
+
+// DraftRepository stores one draft per conversation. Callers check that
+// the conversation belongs to the user before saving.
+type DraftRepository struct {
+	db *sql.DB
+}
+
+func NewDraftRepository(db *sql.DB) *DraftRepository {
+	return &DraftRepository{db: db}
+}
+
+func (repo *DraftRepository) Get(convID string, user string) (*Draft, error) {
+	query := `
+	SELECT d.conv_id, d.content, d.parent_id, d.file_ids, d.updated_at
+	FROM Drafts d
+	INNER JOIN Conversations c ON d.conv_id = c.id
+	WHERE d.conv_id = ? AND c.user = ?
+	`
+	var draft Draft
+	var fileIDs string
+	err := data.QueryRow(repo.db, query, convID, user).Scan(
+		&draft.ConversationID,
+		&draft.Content,
+		&draft.ParentID,
+		&fileIDs,
+		&draft.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	draft.AttachedFileIDs = splitFileIDs(fileIDs)
+	return &draft, nil
+}
+
+func (repo *DraftRepository) Save(draft *Draft) error {
+	draft.UpdatedAt = time.Now().UTC()
+	query := `
+	INSERT INTO Drafts (conv_id, content, parent_id, file_ids, updated_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(conv_id) DO UPDATE SET
+		content = excluded.content,
+		parent_id = excluded.parent_id,
+		file_ids = excluded.file_ids,
+		updated_at = excluded.updated_at
+	`
+	_, err := data.Exec(repo.db, query,
+		draft.ConversationID,
+		draft.Content,
+		draft.ParentID,
+		strings.Join(draft.AttachedFileIDs, ","),
+		draft.UpdatedAt,
+	)
+	return err
+}
+
+func (repo *DraftRepository) Delete(convID string, user string) (bool, error) {
+	query := `
+	DELETE FROM Drafts
+	WHERE conv_id = ? AND conv_id IN (SELECT id FROM Conversations WHERE user = ?)
+	`
+	result, err := data.Exec(repo.db, query, convID, user)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func splitFileIDs(ids string) []string {
+	fileIDs := make([]string, 0)
+	for id := range strings.SplitSeq(ids, ",") {
+		if id != "" {
+			fileIDs = append(fileIDs, id)
+		}
+	}
+	return fileIDs
+}
@@ -0,0 +1,102 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
+
+func draftRequest(method string, convID string, body any, session string) *http.Request {
+	var b []byte
+	if body != nil {
+		b, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, "/conversations/"+convID+"/draft", bytes.NewReader(b))
+	req.SetPathValue("id", convID)
+	req.Header.Set("X-Session-ID", session)
+	return req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+}
+
+func TestDrafts(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	conv := newConversation("test-user")
+	if err := conversations.Save(conv); err != nil {
+		t.Fatalf("failed to save conversation: %v", err)
+	}
+	_, err := data.DB.Exec("INSERT INTO Files (id, name, type, size, path, url, content, user) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		"file-1", "notes.txt", "text/plain", 5, "/tmp/notes.txt", "/data/notes.txt", "notes", "test-user")
+	if err != nil {
+		t.Fatalf("failed to insert file: %v", err)
+	}
+
+	other := syncManager.Subscribe("test-user", "session-b", "")
+	defer syncManager.Unsubscribe("test-user", "session-b")
+
+	rr := httptest.NewRecorder()
+	saveDraft(rr, draftRequest(http.MethodPut, conv.ID, map[string]any{
+		"content":         "half written",
+		"parentId":        3,
+		"attachedFileIds": []string{"file-1", "file-1"},
+	}, "session-a"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 saving draft, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	select {
+	case event := <-other.Events:
+		if event.Type != EventDraftUpdated || event.Draft == nil || event.Draft.Content != "half written" {
+			t.Errorf("expected draft event, got %+v", event)
+		}
+	default:
+		t.Error("expected draft event for the other session")
+	}
+
+	rr = httptest.NewRecorder()
+	getDraft(rr, draftRequest(http.MethodGet, conv.ID, nil, "session-b"))
+	var draft Draft
+	if err := json.Unmarshal(rr.Body.Bytes(), &draft); err != nil {
+		t.Fatalf("failed to decode draft: %v", err)
+	}
+	if draft.Content != "half written" || draft.ParentID != 3 || len(draft.AttachedFileIDs) != 1 || draft.AttachedFileIDs[0] != "file-1" {
+		t.Errorf("unexpected draft %+v", draft)
+	}
+
+	// attached files are checked against the user's files
+	rr = httptest.NewRecorder()
+	saveDraft(rr, draftRequest(http.MethodPut, conv.ID, map[string]any{"content": "x", "attachedFileIds": []string{"missing"}}, "session-a"))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown file, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	saveDraft(rr, draftRequest(http.MethodPut, "no-such-conv", map[string]any{"content": "x"}, "session-a"))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown conversation, got %d", rr.Code)
+	}
+
+	// sending the message clears the draft
+	b, _ := json.Marshal(map[string]any{"conversationId": conv.ID, "model": "provider-x/model", "content": "half written"})
+	req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b))
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	chatStream(&flushRecorder{httptest.NewRecorder()}, req)
+
+	if _, err := drafts.Get(conv.ID, "test-user"); err == nil {
+		t.Error("expected draft to be deleted after sending")
+	}
+	cleared := false
+	for len(other.Events) > 0 {
+		if event := <-other.Events; event.Type == EventDraftUpdated && event.Draft.Content == "" {
+			cleared = true
+		}
+	}
+	if !cleared {
+		t.Error("expected cleared draft event after sending")
+	}
+}
@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// ConversationFile is a file used in a conversation, attached by the user
+// or made by a tool, with the messages it appears in, oldest first.
+type ConversationFile struct {
+	fs.File
+	MessageIDs []int `json:"messageIds"`
+}
+
+type ConversationFilesResponse struct {
+	Files []ConversationFile `json:"files"`
+}
+
+// getConversationFiles lists the files of all branches of a conversation
+// in the order they first appear, without their extracted text.
+func getConversationFiles(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	convID := r.PathValue("id")
+	fileType := r.URL.Query().Get("type")
+
+	if _, err := conversations.GetByID(convID, user); err != nil {
+		utils.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	messages := getAllConversationMessages(convID, user)
+	messageIDs := make(map[string][]int)
+	for _, msg := range messages {
+		for _, att := range msg.Attachments {
+			messageIDs[att.File.ID] = append(messageIDs[att.File.ID], msg.ID)
+		}
+		for _, tool := range msg.Tools {
+			if tool.File != "" {
+				messageIDs[tool.File] = append(messageIDs[tool.File], msg.ID)
+			}
+		}
+	}
+
+	resp := ConversationFilesResponse{Files: make([]ConversationFile, 0)}
+	if len(messageIDs) == 0 {
+		utils.RespondWithJSON(w, resp, http.StatusOK)
+		return
+	}
+	ids := make([]string, 0, len(messageIDs))
+	for id := range messageIDs {
+		ids = append(ids, id)
+	}
+	found, err := files.GetByIDs(ids, user)
+	if err != nil {
+		log.Error("Error querying conversation files", "err", err)
+		utils.Error(w, "Error retrieving files", http.StatusInternalServerError)
+		return
+	}
+
+	for _, file := range found {
+		if fileType != "" && !strings.HasPrefix(file.Type, fileType) {
+			continue
+		}
+		ids := messageIDs[file.ID]
+		slices.Sort(ids)
+		file.Content = ""
+		resp.Files = append(resp.Files, ConversationFile{File: file, MessageIDs: slices.Compact(ids)})
+	}
+	slices.SortFunc(resp.Files, func(a, b ConversationFile) int {
+		if a.MessageIDs[0] != b.MessageIDs[0] {
+			return a.MessageIDs[0] - b.MessageIDs[0]
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	utils.RespondWithJSON(w, resp, http.StatusOK)
+}
@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/google/uuid"
+)
+
+func TestConversationFiles(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	conv := newConversation("test-user")
+	if err := conversations.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []fs.File{
+		{ID: "photo", Name: "photo.jpg", Type: "image/jpeg", Content: "a cat", User: "test-user"},
+		{ID: "report", Name: "report.pdf", Type: "application/pdf", User: "test-user"},
+		{ID: "drawing", Name: "drawing.png", Type: "image/png", User: "test-user"},
+	} {
+		if err := files.Save(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	attach := func(ids ...string) []fs.Attachment {
+		var atts []fs.Attachment
+		for _, id := range ids {
+			atts = append(atts, fs.Attachment{ID: uuid.NewString(), File: fs.File{ID: id}})
+		}
+		return atts
+	}
+	first, err := saveMessage(Message{ConvID: conv.ID, Role: "user", Content: "look", Attachments: attach("report", "photo")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := saveMessage(Message{ConvID: conv.ID, Role: "assistant", ParentID: first, Content: "drawn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = toolCalls.Save(&providers.ToolCall{ID: "draw", ConvID: conv.ID, MessageID: reply, Name: "generate_image", Args: "{}", File: "drawing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the photo again on another branch
+	again, err := saveMessage(Message{ConvID: conv.ID, Role: "user", Content: "again", Attachments: attach("photo")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(convID, query string) (int, ConversationFilesResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/"+convID+"/files"+query, nil)
+		req.SetPathValue("id", convID)
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := httptest.NewRecorder()
+		getConversationFiles(rr, req)
+		var resp ConversationFilesResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	code, resp := list(conv.ID, "")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	var ids []string
+	for _, file := range resp.Files {
+		ids = append(ids, file.ID)
+	}
+	if want := []string{"photo", "report", "drawing"}; !slices.Equal(ids, want) {
+		t.Fatalf("got files %v, want %v", ids, want)
+	}
+	if got := resp.Files[0].MessageIDs; !slices.Equal(got, []int{first, again}) || resp.Files[0].Content != "" {
+		t.Errorf("unexpected photo entry: %+v", resp.Files[0])
+	}
+	if got := resp.Files[2].MessageIDs; !slices.Equal(got, []int{reply}) {
+		t.Errorf("expected the drawing in the tool's message, got %v", got)
+	}
+
+	if _, resp := list(conv.ID, "?type=image/"); len(resp.Files) != 2 {
+		t.Errorf("expected two images, got %+v", resp.Files)
+	}
+	if code, _ := list("missing", ""); code != http.StatusNotFound {
+		t.Errorf("unknown conversation: expected 404, got %d", code)
+	}
+}
@@ -0,0 +1,193 @@
+package chat
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/usage"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// Generation is a response being streamed for a user.
+type Generation struct {
+	ConversationID string `json:"conversationId"`
+	// MessageID is the assistant message, 0 until it is saved
+	MessageID int       `json:"messageId,omitempty"`
+	Model     string    `json:"model"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+type ActiveGenerations struct {
+	Generations []Generation `json:"generations"`
+	// Limit is the most generations a user can run at once, 0 for no limit
+	Limit int `json:"limit"`
+}
+
+// generationTracker counts the generations of every user, so a single user
+// cannot run an unbounded number of streams at the same time.
+type generationTracker struct {
+	mu     sync.Mutex
+	next   int
+	active map[string]map[int]*Generation // user -> slot -> generation
+}
+
+var generations = &generationTracker{active: make(map[string]map[int]*Generation)}
+
+// start reserves a slot for a generation of the user. It fails with
+// apierr.TooManyGenerations once the user runs maxConcurrentGenerations of
+// them; otherwise the slot must be released with finish.
+func (t *generationTracker) start(user string, gen Generation) (int, error) {
+	limit := int(config.Int64("maxConcurrentGenerations"))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if limit > 0 && len(t.active[user]) >= limit {
+		return 0, apierr.New(apierr.TooManyGenerations,
+			fmt.Sprintf("Another response is in progress, at most %d can be generated at once", limit))
+	}
+	if _, ok := t.active[user]; !ok {
+		t.active[user] = make(map[int]*Generation)
+	}
+	t.next++
+	gen.StartedAt = time.Now()
+	t.active[user][t.next] = &gen
+	return t.next, nil
+}
+
+// attach records the conversation and assistant message of a generation
+// once they are known.
+func (t *generationTracker) attach(user string, slot int, convID string, messageID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if gen, ok := t.active[user][slot]; ok {
+		gen.ConversationID = convID
+		gen.MessageID = messageID
+	}
+}
+
+func (t *generationTracker) finish(user string, slot int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.active[user], slot)
+	if len(t.active[user]) == 0 {
+		delete(t.active, user)
+	}
+}
+
+// generationCompleted sends the saved final state of a generated answer to
+// the user's other sessions and to webhooks.
+func generationCompleted(user string, sessionID string, msg *Message) {
+	syncManager.Broadcast(user, sessionID, SyncEvent{
+		Type:           EventGenerationCompleted,
+		ConversationID: msg.ConvID,
+		MessageID:      msg.ID,
+		Message:        msg,
+	})
+	publishMessageCompleted(user, msg)
+}
+
+// startedAt returns when the generation in slot started, zero once it
+// finished.
+func (t *generationTracker) startedAt(user string, slot int) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if gen, ok := t.active[user][slot]; ok {
+		return gen.StartedAt
+	}
+	return time.Time{}
+}
+
+// count returns how many generations of all users are running.
+func (t *generationTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := 0
+	for _, slots := range t.active {
+		n += len(slots)
+	}
+	return n
+}
+
+// list returns the generations of the user, oldest first.
+func (t *generationTracker) list(user string) []Generation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := make([]Generation, 0, len(t.active[user]))
+	for _, gen := range t.active[user] {
+		list = append(list, *gen)
+	}
+	slices.SortFunc(list, func(a, b Generation) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+	return list
+}
+
+// RunningGenerations returns how many responses are being generated for
+// all users.
+func RunningGenerations() int {
+	return generations.count()
+}
+
+// startGeneration reserves a generation slot for a streaming handler and
+// counts the use of its model. It writes the error response and returns
+// false when the user used up the budget or the quota of the provider, or
+// is at the limit.
+func startGeneration(w http.ResponseWriter, user string, gen Generation) (int, bool) {
+	slot, err := reserveGeneration(user, gen)
+	if err != nil {
+		code := apierr.CodeOf(err)
+		utils.RespondWithError(w, code, err.Error(), apierr.Status(code))
+		return 0, false
+	}
+	return slot, true
+}
+
+// reserveGeneration checks the budget of the user and the quota of the
+// provider, reserves a generation slot and counts the use of the model.
+func reserveGeneration(user string, gen Generation) (int, error) {
+	if err := checkLimits(user, gen.Model); err != nil {
+		return 0, err
+	}
+	slot, err := generations.start(user, gen)
+	if err != nil {
+		log.Warn("Concurrent generation limit reached", "user", user)
+		return 0, err
+	}
+	providers.RecordModelUse(gen.Model, user)
+	return slot, nil
+}
+
+// checkLimits fails once the user used up the budget or the quota of the
+// provider of model.
+func checkLimits(user string, model string) error {
+	if err := usage.Check(user); err != nil {
+		log.Warn("Usage budget exceeded", "user", user)
+		return err
+	}
+	if err := usage.CheckQuota(user, model); err != nil {
+		log.Warn("Provider quota exceeded", "user", user, "model", model)
+		return err
+	}
+	return nil
+}
+
+func getActiveGenerations(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	response := ActiveGenerations{
+		Generations: generations.list(user),
+		Limit:       int(config.Int64("maxConcurrentGenerations")),
+	}
+	utils.RespondWithJSON(w, &response, http.StatusOK)
+}
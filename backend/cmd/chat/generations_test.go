@@ -0,0 +1,88 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// mockProviderBlocking holds every stream open until release is closed.
+type mockProviderBlocking struct {
+	release chan struct{}
+}
+
+func (m *mockProviderBlocking) SendChatCompletionRequest(params providers.RequestParams) (*providers.ChatCompletionMessage, error) {
+	return &providers.ChatCompletionMessage{}, nil
+}
+
+func (m *mockProviderBlocking) SendChatCompletionStreamRequest(params providers.RequestParams, sc utils.StreamClient) (*providers.ChatCompletionMessage, error) {
+	<-m.release
+	return &providers.ChatCompletionMessage{Content: "done"}, nil
+}
+
+func TestConcurrentGenerationLimit(t *testing.T) {
+	t.Setenv("MAX_CONCURRENT_GENERATIONS", "1")
+	mock := &mockProviderBlocking{release: make(chan struct{})}
+	teardown := setupTest(t, mock)
+	defer teardown()
+
+	send := func() *flushRecorder {
+		b, _ := json.Marshal(map[string]any{"conversationId": "conv-limit", "parentId": 0, "model": "provider-x/model", "content": "hello"})
+		req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b))
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := &flushRecorder{httptest.NewRecorder()}
+		chatStream(rr, req)
+		return rr
+	}
+	active := func() ActiveGenerations {
+		req := httptest.NewRequest(http.MethodGet, "/chat/active", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := httptest.NewRecorder()
+		getActiveGenerations(rr, req)
+		var resp ActiveGenerations
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode active generations: %v", err)
+		}
+		return resp
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		send()
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if gens := active().Generations; len(gens) == 1 && gens[0].MessageID > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("first generation never became active")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rr := send()
+	if rr.Code != http.StatusTooManyRequests || !contains(rr.Body.String(), "TOO_MANY_GENERATIONS") {
+		t.Errorf("expected 429 with TOO_MANY_GENERATIONS, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	resp := active()
+	if resp.Limit != 1 || len(resp.Generations) != 1 || resp.Generations[0].Model != "provider-x/model" {
+		t.Errorf("expected the running generation and limit 1, got %+v", resp)
+	}
+
+	close(mock.release)
+	<-done
+	if gens := active().Generations; len(gens) != 0 {
+		t.Errorf("expected no active generations after completion, got %+v", gens)
+	}
+}
@@ -0,0 +1,79 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+)
+
+const (
+	historySearchLimit    = 5
+	maxHistorySearchLimit = 20
+)
+
+// HistoryResult is a past message found by the search_history tool.
+type HistoryResult struct {
+	Conversation string `json:"conversation"`
+	MessageID    int    `json:"messageId"`
+	Role         string `json:"role"`
+	Date         string `json:"date"`
+	Snippet      string `json:"snippet"`
+	// RepliesTo is the start of the message this one answers
+	RepliesTo string `json:"repliesTo,omitempty"`
+}
+
+func historySearchEnabled(user string) bool {
+	enabled, _ := settings.Get("historySearch", user)
+	return enabled == "true"
+}
+
+// searchHistoryTool lets the model search the user's other conversations,
+// only while historySearch is on.
+func searchHistoryTool(ctx context.Context, args, user, convID string) providers.ToolOutput {
+	if !historySearchEnabled(user) {
+		return providers.ToolOutput{Content: "error: history search is turned off in the user's settings"}
+	}
+
+	var params struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return providers.ToolOutput{Content: fmt.Sprintf("error decoding arguments: %v", err)}
+	}
+	query, err := parseSearchQuery(params.Query)
+	if err != nil {
+		return providers.ToolOutput{Content: fmt.Sprintf("error: %v", err)}
+	}
+	// the current conversation is already in the context
+	query.ExcludeConversationID = convID
+	limit := params.Limit
+	if limit <= 0 {
+		limit = historySearchLimit
+	}
+
+	results, err := searchMessages(user, query, min(limit, maxHistorySearchLimit), 0)
+	if err != nil {
+		log.Error("Error searching history", "err", err)
+		return providers.ToolOutput{Content: "Error occurred while searching past conversations."}
+	}
+	if len(results) == 0 {
+		return providers.ToolOutput{Content: "No matching messages found in past conversations."}
+	}
+
+	found := make([]HistoryResult, len(results))
+	for i, res := range results {
+		found[i] = HistoryResult{
+			Conversation: res.ConversationTitle,
+			MessageID:    res.MessageID,
+			Role:         res.Role,
+			Date:         res.CreatedAt.Format(searchDateLayout),
+			Snippet:      res.Snippet,
+			RepliesTo:    res.Context,
+		}
+	}
+	out, _ := json.Marshal(found)
+	return providers.ToolOutput{Content: string(out), Type: providers.OutputTable}
+}
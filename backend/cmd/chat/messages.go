@@ -1,6 +1,10 @@
 package chat
 
 import (
+	dbsql "database/sql"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Bajahaw/ai-ui/cmd/data"
@@ -8,6 +12,29 @@ import (
 	"github.com/Bajahaw/ai-ui/cmd/providers"
 )
 
+// Message statuses, in the order a generated answer goes through them.
+// User messages and other messages that are not generated are completed
+// right away.
+const (
+	// StatusPending is an answer that was saved but has no output yet
+	StatusPending = "pending"
+	// StatusStreaming is an answer the provider is sending right now
+	StatusStreaming = "streaming"
+	// StatusCompleted is an answer that finished normally
+	StatusCompleted = "completed"
+	// StatusError is an answer that failed, the message error says why
+	StatusError = "error"
+	// StatusStopped is an answer the user stopped, keeping its partial output
+	StatusStopped = "stopped"
+	// StatusInterrupted is an answer cut short because the client went away
+	StatusInterrupted = "interrupted"
+)
+
+// inProgress reports whether the message is still being generated.
+func inProgress(status string) bool {
+	return status == StatusPending || status == StatusStreaming
+}
+
 type Message struct {
 	ID          int                   `json:"id"`
 	ConvID      string                `json:"convId"`
@@ -24,25 +51,34 @@ type Message struct {
 	Speed       float64               `json:"speed,omitempty"`
 	TokenCount  int                   `json:"tokenCount,omitempty"`
 	ContextSize int                   `json:"contextSize,omitempty"`
-	CreatedAt   time.Time             `json:"createdAt"`
-	UpdatedAt   time.Time             `json:"updatedAt"`
+	// FinishReason is "length" when the answer hit the max token limit and
+	// can be continued
+	FinishReason string `json:"finishReason,omitempty"`
+	// Pinned messages are sent to the model right after the system prompt
+	// when they are not on the branch being answered
+	Pinned    bool      `json:"pinned,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
 }
 
-func getMessage(id int, user string) (*Message, error) {
-	sql := `
-	SELECT m.id, m.conv_id, m.role, m.content, m.reasoning, m.parent_id, m.error, m.status, m.speed, m.token_count, m.context_size, m.created_at, m.updated_at
-	FROM Messages m
-	INNER JOIN Conversations c ON m.conv_id = c.id
-	WHERE m.id = ? AND c.user = ?
-	`
-	row := data.DB.QueryRow(sql, id, user)
+// messageColumns are the Messages columns read by scanMessage, followed by
+// the comma separated IDs of the message's children so that a message and
+// its children are read in a single query.
+const messageColumns = `m.id, m.conv_id, m.role, m.model, m.content, m.reasoning, m.parent_id, m.error, m.status, m.speed, m.token_count, m.context_size, m.finish_reason, m.pinned, m.created_at, m.updated_at,
+	COALESCE((SELECT group_concat(ch.id) FROM Messages ch WHERE ch.parent_id = m.id), '')`
 
-	var msg = Message{
-		Children: make([]int, 0),
-	}
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMessage(row rowScanner) (*Message, error) {
+	var msg Message
+	var children string
 	err := row.Scan(
-		&msg.ID, &msg.ConvID,
+		&msg.ID,
+		&msg.ConvID,
 		&msg.Role,
+		&msg.Model,
 		&msg.Content,
 		&msg.Reasoning,
 		&msg.ParentID,
@@ -51,26 +87,40 @@ func getMessage(id int, user string) (*Message, error) {
 		&msg.Speed,
 		&msg.TokenCount,
 		&msg.ContextSize,
+		&msg.FinishReason,
+		&msg.Pinned,
 		&msg.CreatedAt,
 		&msg.UpdatedAt,
+		&children,
 	)
 	if err != nil {
 		return nil, err
 	}
+	msg.Children = parseChildren(children)
+	return &msg, nil
+}
 
-	childrenSql := `SELECT id FROM Messages WHERE parent_id = ?`
-	rows, err := data.DB.Query(childrenSql, id)
-	if err != nil {
-		return nil, err
+func parseChildren(ids string) []int {
+	children := make([]int, 0)
+	for _, id := range strings.Split(ids, ",") {
+		if n, err := strconv.Atoi(id); err == nil {
+			children = append(children, n)
+		}
 	}
+	slices.Sort(children)
+	return children
+}
 
-	defer rows.Close()
-	for rows.Next() {
-		var childID int
-		if err := rows.Scan(&childID); err != nil {
-			return nil, err
-		}
-		msg.Children = append(msg.Children, childID)
+func getMessage(id int, user string) (*Message, error) {
+	sql := `
+	SELECT ` + messageColumns + `
+	FROM Messages m
+	INNER JOIN Conversations c ON m.conv_id = c.id
+	WHERE m.id = ? AND c.user = ?
+	`
+	msg, err := scanMessage(data.QueryRow(data.DB, sql, id, user))
+	if err != nil {
+		return nil, err
 	}
 
 	// Fetch attachments
@@ -79,15 +129,17 @@ func getMessage(id int, user string) (*Message, error) {
 	// Fetch tool calls
 	msg.Tools = toolCalls.GetAllByMessageID(id)
 
-	return &msg, nil
+	return msg, nil
 }
 
 func saveMessage(msg Message) (int, error) {
 	sql := `
-	INSERT INTO Messages (conv_id, role, model, parent_id, content, reasoning, error, status, speed, token_count, context_size, created_at, updated_at) 
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO Messages (conv_id, role, model, parent_id, content, reasoning, error, status, speed, token_count, context_size, finish_reason, created_at, updated_at) 
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := data.DB.Exec(sql,
+	msg.CreatedAt = time.Now()
+	msg.UpdatedAt = msg.CreatedAt
+	result, err := data.Exec(data.DB, sql,
 		msg.ConvID,
 		msg.Role,
 		msg.Model,
@@ -99,8 +151,9 @@ func saveMessage(msg Message) (int, error) {
 		msg.Speed,
 		msg.TokenCount,
 		msg.ContextSize,
-		time.Now(),
-		time.Now(),
+		msg.FinishReason,
+		msg.CreatedAt,
+		msg.UpdatedAt,
 	)
 	if err != nil {
 		return 0, err
@@ -116,13 +169,17 @@ func saveMessage(msg Message) (int, error) {
 		return 0, err
 	}
 
+	msg.ID = intId
+	msg.Tools = nil
+	messageCache.saveMessage(&msg)
+
 	return intId, nil
 }
 
 func saveMessageAttachments(id int, attachments []fs.Attachment) error {
 	attSql := `INSERT INTO Attachments (id, message_id, file_id) VALUES (?, ?, ?)`
 	for _, att := range attachments {
-		_, err := data.DB.Exec(attSql,
+		_, err := data.Exec(data.DB, attSql,
 			att.ID,
 			id,
 			att.File.ID,
@@ -138,70 +195,90 @@ func saveMessageAttachments(id int, attachments []fs.Attachment) error {
 func updateMessage(id int, user string, msg Message) (*Message, error) {
 	sql := `
 	UPDATE Messages
-	SET content = ?, reasoning = ?, error = ?, status = ?, speed = ?, token_count = ?, context_size = ?, updated_at = ?
+	SET content = ?, reasoning = ?, error = ?, status = ?, speed = ?, token_count = ?, context_size = ?, finish_reason = ?, updated_at = ?
 	FROM Conversations
 	WHERE Messages.conv_id = Conversations.id 
 		AND Messages.id = ? 
 		AND Conversations.user = ?
-	RETURNING Messages.id, Messages.conv_id, Messages.role, Messages.model, Messages.content, Messages.reasoning, Messages.parent_id, Messages.error, Messages.status, Messages.speed, Messages.token_count, Messages.context_size, Messages.created_at, Messages.updated_at;
+	RETURNING Messages.id, Messages.conv_id, Messages.role, Messages.model, Messages.content, Messages.reasoning, Messages.parent_id, Messages.error, Messages.status, Messages.speed, Messages.token_count, Messages.context_size, Messages.finish_reason, Messages.pinned, Messages.created_at, Messages.updated_at,
+		COALESCE((SELECT group_concat(ch.id) FROM Messages ch WHERE ch.parent_id = Messages.id), '');
 	`
-	row := data.DB.QueryRow(sql, msg.Content, msg.Reasoning, msg.Error, msg.Status, msg.Speed, msg.TokenCount, msg.ContextSize, time.Now(), id, user)
-	var updatedMsg Message
-	err := row.Scan(
-		&updatedMsg.ID,
-		&updatedMsg.ConvID,
-		&updatedMsg.Role,
-		&updatedMsg.Model,
-		&updatedMsg.Content,
-		&updatedMsg.Reasoning,
-		&updatedMsg.ParentID,
-		&updatedMsg.Error,
-		&updatedMsg.Status,
-		&updatedMsg.Speed,
-		&updatedMsg.TokenCount,
-		&updatedMsg.ContextSize,
-		&updatedMsg.CreatedAt,
-		&updatedMsg.UpdatedAt,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	updatedMsg.Children = make([]int, 0)
-	childrenSql := `SELECT id FROM Messages WHERE parent_id = ?`
-	rows, err := data.DB.Query(childrenSql, id)
+	row := data.QueryRow(data.DB, sql, msg.Content, msg.Reasoning, msg.Error, msg.Status, msg.Speed, msg.TokenCount, msg.ContextSize, msg.FinishReason, time.Now(), id, user)
+	updatedMsg, err := scanMessage(row)
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
-	for rows.Next() {
-		var childID int
-		if err := rows.Scan(&childID); err != nil {
-			return nil, err
-		}
-		updatedMsg.Children = append(updatedMsg.Children, childID)
-	}
-
 	// Fetch attachments
 	updatedMsg.Attachments = getMessageAttachments(id)
 
 	// Fetch tool calls
 	updatedMsg.Tools = toolCalls.GetAllByMessageID(id)
 
-	return &updatedMsg, nil
+	messageCache.updateMessage(updatedMsg)
+	forgetPendingSave(id)
+
+	return updatedMsg, nil
+}
+
+// setPinned pins or unpins a message of the user.
+func setPinned(id int, user string, pinned bool) (*Message, error) {
+	sql := `
+	UPDATE Messages
+	SET pinned = ?
+	FROM Conversations
+	WHERE Messages.conv_id = Conversations.id
+		AND Messages.id = ?
+		AND Conversations.user = ?
+	`
+	result, err := data.Exec(data.DB, sql, pinned, id, user)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, dbsql.ErrNoRows
+	}
+	msg, err := getMessage(id, user)
+	if err != nil {
+		return nil, err
+	}
+	messageCache.updateMessage(msg)
+	return msg, nil
 }
 
 func getAllConversationMessages(convID string, user string) map[int]*Message {
+	if messages, ok := messageCache.get(convID, user); ok {
+		return messages
+	}
+	messages := loadConversationMessages(convID, user, 0, 0)
+	if len(messages) > 0 {
+		messageCache.put(convID, user, messages)
+	}
+	return messages
+}
+
+// loadConversationMessages loads the messages of a conversation with their
+// children, attachments and tool calls in three queries. With a positive
+// limit only the newest limit messages older than before are loaded, while
+// their children still list every child in the conversation.
+func loadConversationMessages(convID string, user string, limit int, before int) map[int]*Message {
 	messages := make(map[int]*Message)
 	sql := ` 
-	SELECT m.id, m.conv_id, m.role, m.model, m.content, m.reasoning, m.parent_id, m.error, m.status, m.speed, m.token_count, m.context_size, m.created_at, m.updated_at
+	SELECT ` + messageColumns + `
 	FROM Messages m 
 	INNER JOIN Conversations c ON m.conv_id = c.id
 	WHERE m.conv_id = ? AND c.user = ? 
 	`
-	rows, err := data.DB.Query(sql, convID, user)
+	args := []any{convID, user}
+	if limit > 0 {
+		if before > 0 {
+			sql += ` AND m.id < ?`
+			args = append(args, before)
+		}
+		sql += ` ORDER BY m.id DESC LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := data.Query(data.DB, sql, args...)
 	if err != nil {
 		log.Error("Error querying messages", "err", err)
 		return messages
@@ -209,42 +286,15 @@ func getAllConversationMessages(convID string, user string) map[int]*Message {
 	defer rows.Close()
 
 	for rows.Next() {
-		var msg Message
-		err := rows.Scan(
-			&msg.ID,
-			&msg.ConvID,
-			&msg.Role,
-			&msg.Model,
-			&msg.Content,
-			&msg.Reasoning,
-			&msg.ParentID,
-			&msg.Error,
-			&msg.Status,
-			&msg.Speed,
-			&msg.TokenCount,
-			&msg.ContextSize,
-			&msg.CreatedAt,
-			&msg.UpdatedAt,
-		)
+		msg, err := scanMessage(rows)
 		if err != nil {
 			log.Error("Error scanning message", "err", err)
 			continue
 		}
-		messages[msg.ID] = &msg
+		messages[msg.ID] = msg
 	}
-
-	for _, msg := range messages {
-		if msg.Children == nil {
-			msg.Children = make([]int, 0)
-		}
-		if msg.ParentID != 0 {
-			if parent, exists := messages[msg.ParentID]; exists {
-				if parent.Children == nil {
-					parent.Children = make([]int, 0)
-				}
-				parent.Children = append(parent.Children, msg.ID)
-			}
-		}
+	if len(messages) == 0 {
+		return messages
 	}
 
 	// Fetch attachments for all messages in the conversation
@@ -266,14 +316,65 @@ func getAllConversationMessages(convID string, user string) map[int]*Message {
 	return messages
 }
 
+// loadMessages loads the messages of the user with the given IDs, with
+// their attachments and tool calls. IDs that are not found are skipped.
+func loadMessages(ids []int, user string) map[int]*Message {
+	messages := make(map[int]*Message)
+	if len(ids) == 0 {
+		return messages
+	}
+	args := []any{user}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	sql := `
+	SELECT ` + messageColumns + `
+	FROM Messages m
+	INNER JOIN Conversations c ON m.conv_id = c.id
+	WHERE c.user = ? AND m.id IN (?` + strings.Repeat(", ?", len(ids)-1) + `)
+	`
+	rows, err := data.Query(data.DB, sql, args...)
+	if err != nil {
+		log.Error("Error querying messages", "err", err)
+		return messages
+	}
+	defer rows.Close()
+
+	convIDs := make(map[string]bool)
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			log.Error("Error scanning message", "err", err)
+			continue
+		}
+		messages[msg.ID] = msg
+		convIDs[msg.ConvID] = true
+	}
+
+	// the IDs usually belong to a single conversation
+	for convID := range convIDs {
+		for msgID, atts := range files.GetAllConversationAttachments(convID) {
+			if msg, exists := messages[msgID]; exists {
+				msg.Attachments = atts
+			}
+		}
+		for _, tool := range toolCalls.GetAllByConvID(convID) {
+			if msg, exists := messages[tool.MessageID]; exists {
+				msg.Tools = append(msg.Tools, tool)
+			}
+		}
+	}
+	return messages
+}
+
 func getMessageAttachments(messageID int) []fs.Attachment {
 	attachmentsSql := `
-	SELECT a.id, a.message_id, f.id, f.name, f.type, f.size, f.path, f.url, f.content, f.created_at
+	SELECT a.id, a.message_id, f.id, f.name, f.type, f.size, f.path, f.url, f.content, f.description, f.created_at
 	FROM Attachments a
 	JOIN Files f ON a.file_id = f.id
 	WHERE a.message_id = ?
 	`
-	attRows, err := data.DB.Query(attachmentsSql, messageID)
+	attRows, err := data.Query(data.DB, attachmentsSql, messageID)
 	if err != nil {
 		log.Error("Error querying attachments", "err", err)
 		return nil
@@ -294,6 +395,7 @@ func getMessageAttachments(messageID int) []fs.Attachment {
 			&file.Path,
 			&file.URL,
 			&file.Content,
+			&file.Description,
 			&file.CreatedAt,
 		); err != nil {
 			return nil
@@ -0,0 +1,409 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+)
+
+// seedConversation stores a conversation of depth user/assistant turns, each
+// assistant reply making one tool call, plus a second reply to the first
+// prompt so the tree has a branch. It returns the conversation ID and the
+// ID of the last message.
+func seedConversation(t testing.TB, depth int) (string, int) {
+	t.Helper()
+	conv := newConversation("test-user")
+	if err := conversations.Save(conv); err != nil {
+		t.Fatalf("save conversation: %v", err)
+	}
+
+	parent := 0
+	for i := 0; i < depth; i++ {
+		prompt, err := saveMessage(Message{ConvID: conv.ID, Role: "user", ParentID: parent, Content: fmt.Sprintf("question %d", i)})
+		if err != nil {
+			t.Fatalf("save message: %v", err)
+		}
+		reply, err := saveMessage(Message{ConvID: conv.ID, Role: "assistant", ParentID: prompt, Content: fmt.Sprintf("answer %d", i)})
+		if err != nil {
+			t.Fatalf("save message: %v", err)
+		}
+		err = toolCalls.Save(&providers.ToolCall{
+			ID:        fmt.Sprintf("%s-call-%d", conv.ID, i),
+			ConvID:    conv.ID,
+			MessageID: reply,
+			Name:      "search",
+			Args:      "{}",
+			Output:    "result",
+		})
+		if err != nil {
+			t.Fatalf("save tool call: %v", err)
+		}
+		if i == 0 {
+			if _, err := saveMessage(Message{ConvID: conv.ID, Role: "assistant", ParentID: prompt, Content: "other answer"}); err != nil {
+				t.Fatalf("save message: %v", err)
+			}
+		}
+		parent = reply
+	}
+	return conv.ID, parent
+}
+
+func TestMessageTreeLoading(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	convID, last := seedConversation(t, 3)
+	messages := getAllConversationMessages(convID, "test-user")
+	if len(messages) != 7 {
+		t.Fatalf("expected 7 messages, got %d", len(messages))
+	}
+
+	var root *Message
+	for _, msg := range messages {
+		if msg.ParentID == 0 {
+			root = msg
+		}
+	}
+	if root == nil || len(root.Children) != 2 || !slices.IsSorted(root.Children) {
+		t.Fatalf("root children = %+v", root)
+	}
+	if len(messages[root.Children[0]].Tools) != 1 {
+		t.Errorf("expected the tool call to be attached, got %+v", messages[root.Children[0]].Tools)
+	}
+
+	single, err := getMessage(root.ID, "test-user")
+	if err != nil {
+		t.Fatalf("getMessage: %v", err)
+	}
+	if !slices.Equal(single.Children, root.Children) {
+		t.Errorf("getMessage children = %v, want %v", single.Children, root.Children)
+	}
+
+	updated, err := updateMessage(last, "test-user", Message{Content: "edited", Status: "completed"})
+	if err != nil {
+		t.Fatalf("updateMessage: %v", err)
+	}
+	if updated.Content != "edited" || len(updated.Children) != 0 || len(updated.Tools) != 1 {
+		t.Errorf("unexpected updated message: %+v", updated)
+	}
+}
+
+func BenchmarkGetAllConversationMessages(b *testing.B) {
+	teardown := setupTest(b, nil)
+	defer teardown()
+	convID, _ := seedConversation(b, 100)
+
+	for b.Loop() {
+		getAllConversationMessages(convID, "test-user")
+	}
+}
+
+func BenchmarkGetMessage(b *testing.B) {
+	teardown := setupTest(b, nil)
+	defer teardown()
+	_, last := seedConversation(b, 100)
+
+	for b.Loop() {
+		if _, err := getMessage(last, "test-user"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildContext(b *testing.B) {
+	teardown := setupTest(b, nil)
+	defer teardown()
+	convID, last := seedConversation(b, 100)
+
+	for b.Loop() {
+		buildContext(context.Background(), convID, last, "test-user", "provider-x/model")
+	}
+}
+
+func TestPinnedMessagesInContext(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	convID, last := seedConversation(t, 2)
+	var other, first int
+	for id, msg := range getAllConversationMessages(convID, "test-user") {
+		switch msg.Content {
+		case "other answer":
+			other = id
+		case "question 0":
+			first = id
+		}
+	}
+
+	pin := func(id int, method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/"+convID+"/messages/"+strconv.Itoa(id)+"/pin", nil)
+		req.SetPathValue("id", convID)
+		req.SetPathValue("messageId", strconv.Itoa(id))
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := httptest.NewRecorder()
+		pinMessage(rr, req)
+		return rr
+	}
+	// a message on another branch, and one on the path that stays in place
+	for _, id := range []int{other, first} {
+		if rr := pin(id, http.MethodPut); rr.Code != http.StatusOK {
+			t.Fatalf("pin %d: status %d: %s", id, rr.Code, rr.Body.String())
+		}
+	}
+
+	messages := buildContext(context.Background(), convID, last, "test-user", "provider-x/model")
+	if messages[1].Content != "other answer" || messages[1].Role != "assistant" {
+		t.Errorf("expected the pinned branch message after the system prompt, got %+v", messages[1])
+	}
+	count := 0
+	for _, msg := range messages {
+		if msg.Content == "question 0" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected a pinned message on the path once, got %d", count)
+	}
+
+	if rr := pin(other, http.MethodDelete); rr.Code != http.StatusOK {
+		t.Fatalf("unpin: status %d", rr.Code)
+	}
+	if messages := buildContext(context.Background(), convID, last, "test-user", "provider-x/model"); messages[1].Content != "question 0" {
+		t.Errorf("expected the unpinned message to be left out, got %+v", messages[1])
+	}
+	req := httptest.NewRequest(http.MethodPut, "/other-conversation/messages/1/pin", nil)
+	req.SetPathValue("id", "other-conversation")
+	req.SetPathValue("messageId", strconv.Itoa(other))
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	rr := httptest.NewRecorder()
+	pinMessage(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a message of another conversation, got %d", rr.Code)
+	}
+}
+
+func TestSystemPromptDateAndProfile(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	convID, last := seedConversation(t, 1)
+	err := settings.Save(map[string]string{
+		"appendDateToSystemPrompt":    "true",
+		"appendProfileToSystemPrompt": "true",
+		"userProfile":                 "Name: Sam. Works as a nurse.",
+		"timezone":                    "Asia/Tokyo",
+		"locale":                      "en-GB",
+	}, "test-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prompt := buildContext(context.Background(), convID, last, "test-user", "provider-x/model")[0].Content
+	if !strings.HasPrefix(prompt, "Current date: ") || !strings.Contains(prompt, "JST (Asia/Tokyo)") {
+		t.Errorf("expected the date in the user's time zone, got %q", prompt)
+	}
+	if !strings.Contains(prompt, "<user_profile>\n\nName: Sam. Works as a nurse.\n\n</user_profile>") {
+		t.Errorf("expected the user profile, got %q", prompt)
+	}
+
+	at := time.Date(2025, 3, 1, 23, 30, 0, 0, time.UTC)
+	if got, want := currentDate("test-user", at), "Current date: Sunday, 2 March 2025\nCurrent time: 2 Mar 2025, 08:30 JST (Asia/Tokyo)"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestConversationTree(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	convID, _ := seedConversation(t, 2)
+	long := strings.Repeat("word\n", 40)
+	if _, err := saveMessage(Message{ConvID: convID, Role: "user", Content: long}); err != nil {
+		t.Fatalf("save message: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/"+convID+"/tree", nil)
+	req.SetPathValue("id", convID)
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	rr := httptest.NewRecorder()
+	getConversationTree(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var tree Tree
+	if err := json.Unmarshal(rr.Body.Bytes(), &tree); err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Nodes) != 6 || len(tree.Roots) != 2 {
+		t.Fatalf("expected 6 nodes and 2 roots, got %+v", tree)
+	}
+	first := tree.Nodes[0]
+	if first.Role != "user" || first.Preview != "question 0" || first.ChildCount != 2 {
+		t.Errorf("unexpected root node %+v", first)
+	}
+	last := tree.Nodes[len(tree.Nodes)-1]
+	if !strings.HasSuffix(last.Preview, "…") || strings.Contains(last.Preview, "\n") || len([]rune(last.Preview)) > previewLength+1 {
+		t.Errorf("expected a one line truncated preview, got %q", last.Preview)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/missing/tree", nil)
+	req.SetPathValue("id", "missing")
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	rr = httptest.NewRecorder()
+	getConversationTree(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown conversation, got %d", rr.Code)
+	}
+}
+
+func TestMessagesBatch(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	convID, last := seedConversation(t, 2)
+	if _, err := data.DB.Exec("INSERT INTO Users (username, pass_hash) VALUES ('other-user', 'x')"); err != nil {
+		t.Fatal(err)
+	}
+	foreign := newConversation("other-user")
+	if err := conversations.Save(foreign); err != nil {
+		t.Fatal(err)
+	}
+	hidden, err := saveMessage(Message{ConvID: foreign.ID, Role: "user", Content: "not yours"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := loadTree(convID, "test-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := tree.Roots[0]
+
+	batch := func(ids ...int) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(BatchRequest{IDs: ids})
+		req := httptest.NewRequest(http.MethodPost, "/messages/batch", bytes.NewReader(b))
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := httptest.NewRecorder()
+		getMessagesBatch(rr, req)
+		return rr
+	}
+
+	rr := batch(first, last, last, hidden, 99999)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp Response
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Messages) != 2 || resp.Messages[first] == nil || resp.Messages[last] == nil {
+		t.Fatalf("expected only the two messages of the user, got %v", resp.Messages)
+	}
+	if resp.Messages[first].Content != "question 0" || len(resp.Messages[last].Tools) != 1 {
+		t.Errorf("expected full messages with tool calls, got %+v and %+v", resp.Messages[first], resp.Messages[last])
+	}
+
+	if rr := batch(); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without IDs, got %d", rr.Code)
+	}
+	ids := make([]int, maxPageSize+1)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	if rr := batch(ids...); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for too many IDs, got %d", rr.Code)
+	}
+}
+
+func TestAttachmentsInRetriedContext(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	conv := newConversation("test-user")
+	if err := conversations.Save(conv); err != nil {
+		t.Fatal(err)
+	}
+	noVision := false
+	if err := models.Save(&providers.Provider{ID: "text-only", BaseURL: "http://localhost", User: "test-user"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SaveModels([]*providers.Model{{ID: "text-only/model", ProviderID: "text-only", Name: "model", IsEnabled: true, SupportsVision: &noVision}}, "test-user"); err != nil {
+		t.Fatal(err)
+	}
+	notes := t.TempDir() + "/notes.txt"
+	if err := os.WriteFile(notes, []byte("some notes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	attached := []fs.File{
+		{ID: "scan", Name: "scan.png", Type: "image/png", Path: t.TempDir() + "/scan.png", Content: "text of the scan", User: "test-user"},
+		{ID: "notes", Name: "notes.txt", Type: "text/plain", Path: notes, Content: "some notes", User: "test-user"},
+	}
+	var attachments []fs.Attachment
+	for _, file := range attached {
+		if err := files.Save(file); err != nil {
+			t.Fatal(err)
+		}
+		attachments = append(attachments, fs.Attachment{ID: "att-" + file.ID, File: file})
+	}
+	prompt, err := saveMessage(Message{ConvID: conv.ID, Role: "user", Content: "look at these", Attachments: attachments})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := saveMessage(Message{ConvID: conv.ID, Role: "assistant", ParentID: prompt, Content: "first answer"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a retry builds the context from the user message, once from the cache
+	// and once from the database
+	contexts := [][]providers.SimpleMessage{
+		buildContext(context.Background(), conv.ID, prompt, "test-user", "text-only/model"),
+		buildContext(context.Background(), conv.ID, prompt, "test-user", "text-only/model"),
+	}
+	messageCache.invalidate(conv.ID)
+	contexts = append(contexts, buildContext(context.Background(), conv.ID, prompt, "test-user", "text-only/model"))
+	for i, ctx := range contexts {
+		last := ctx[len(ctx)-1]
+		if strings.Count(last.Content, "text of the scan") != 1 {
+			t.Errorf("context %d: expected the text of the image once for a model without vision, got %q", i, last.Content)
+		}
+		if len(last.Files) != 1 || !strings.HasPrefix(last.Files[0], "data:text/plain;base64,") {
+			t.Errorf("context %d: expected the text file to be sent, got %v", i, last.Files)
+		}
+	}
+
+	if err := settings.Save(map[string]string{"attachmentOcrOnly": "true"}, "test-user"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		ctx := buildContext(context.Background(), conv.ID, prompt, "test-user", "text-only/model")
+		last := ctx[len(ctx)-1]
+		if strings.Count(last.Content, "[user attachment:") != 2 || len(last.Files) != 0 || len(last.Images) != 0 {
+			t.Errorf("expected both attachments embedded once in OCR-only mode, got %+v", last)
+		}
+	}
+
+	// corrected text and a description reach the model right away
+	scan := attached[0]
+	scan.Content, scan.Description = "corrected text", "receipt from the bakery"
+	if err := files.Update(scan); err != nil {
+		t.Fatal(err)
+	}
+	messageCache.updateFile(scan)
+	ctx := buildContext(context.Background(), conv.ID, prompt, "test-user", "text-only/model")
+	if last := ctx[len(ctx)-1].Content; !strings.Contains(last, "description: receipt from the bakery\ncontent: corrected text") {
+		t.Errorf("expected the edited attachment, got %q", last)
+	}
+}
@@ -0,0 +1,128 @@
+package chat
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+	// previewLength is the number of characters of a message shown as
+	// its preview, in conversation list pages and trees.
+	previewLength = 120
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ConversationSummary is the list projection of a conversation.
+type ConversationSummary struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Pinned    bool      `json:"pinned"`
+	Preview   string    `json:"preview"`
+	Unread    int       `json:"unread,omitempty"`
+}
+
+type ConversationPage struct {
+	Conversations []*ConversationSummary `json:"conversations"`
+	NextCursor    string                 `json:"nextCursor,omitempty"`
+}
+
+type MessagePage struct {
+	Messages   map[int]*Message `json:"messages"`
+	NextCursor int              `json:"nextCursor,omitempty"`
+}
+
+// isPaged reports whether the client asked for a page instead of the
+// full list, which is kept as the default for older clients.
+func isPaged(r *http.Request) bool {
+	q := r.URL.Query()
+	return q.Has("limit") || q.Has("before")
+}
+
+// isArchived reports whether the client asked for archived conversations,
+// which are left out of the list otherwise.
+func isArchived(r *http.Request) bool {
+	return r.URL.Query().Get("archived") == "true"
+}
+
+func pageSize(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	return min(limit, maxPageSize), nil
+}
+
+func getConversationsPage(w http.ResponseWriter, r *http.Request, user string) {
+	limit, err := pageSize(r)
+	if err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := conversations.ListPage(user, limit, r.URL.Query().Get("before"), isArchived(r))
+	if errors.Is(err, ErrInvalidCursor) {
+		utils.Error(w, "Unknown conversation cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Error("Error listing conversations", "err", err)
+		utils.Error(w, "Error listing conversations", http.StatusInternalServerError)
+		return
+	}
+
+	unread := unreadCounts(user)
+	for _, conv := range page {
+		conv.Unread = unread[conv.ID]
+	}
+	resp := ConversationPage{Conversations: page}
+	if len(page) == limit {
+		resp.NextCursor = page[len(page)-1].ID
+	}
+	utils.RespondWithJSON(w, resp, http.StatusOK)
+}
+
+func getMessagesPage(w http.ResponseWriter, r *http.Request, convID string, user string) {
+	limit, err := pageSize(r)
+	if err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var before int
+	if raw := r.URL.Query().Get("before"); raw != "" {
+		before, err = strconv.Atoi(raw)
+		if err != nil || before <= 0 {
+			utils.Error(w, "before must be a message ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	messages := loadConversationMessages(convID, user, limit, before)
+	resp := MessagePage{Messages: messages}
+	if len(messages) == limit {
+		resp.NextCursor = oldestMessage(messages)
+	}
+	utils.RespondWithJSON(w, resp, http.StatusOK)
+}
+
+func oldestMessage(messages map[int]*Message) int {
+	oldest := 0
+	for id := range messages {
+		if oldest == 0 || id < oldest {
+			oldest = id
+		}
+	}
+	return oldest
+}
@@ -0,0 +1,170 @@
+package chat
+
+import (
+	dbsql "database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
+
+// saveRetryInterval is how often answers that could not be saved are
+// written again.
+var saveRetryInterval = 5 * time.Second
+
+// pendingSave is a generated answer whose final update failed, for example
+// because the database was locked for longer than the busy timeout.
+type pendingSave struct {
+	User    string  `json:"user"`
+	Message Message `json:"message"`
+	// stored is set once the answer is kept in the FailedSaves table, so it
+	// survives a restart
+	stored bool
+}
+
+var pendingSaves = struct {
+	sync.Mutex
+	byID    map[int]*pendingSave
+	running bool
+}{byID: make(map[int]*pendingSave)}
+
+// finishMessage saves the final state of a generated answer. When that
+// fails the answer is queued and written again until it is saved, so its
+// content is not lost; the error is still returned to be logged.
+func finishMessage(id int, user string, msg Message) (*Message, error) {
+	updated, err := updateMessage(id, user, msg)
+	if err == nil || errors.Is(err, dbsql.ErrNoRows) {
+		return updated, err
+	}
+
+	msg.ID = id
+	pendingSaves.Lock()
+	pendingSaves.byID[id] = &pendingSave{User: user, Message: msg}
+	start := !pendingSaves.running
+	pendingSaves.running = true
+	pendingSaves.Unlock()
+	log.Warn("Queued answer to be saved again", "messageID", id, "err", err)
+
+	if start {
+		go retrySaves()
+	}
+	return nil, err
+}
+
+// forgetPendingSave drops a queued answer once the message is saved
+// otherwise, so an older state does not overwrite it.
+func forgetPendingSave(id int) {
+	pendingSaves.Lock()
+	save, ok := pendingSaves.byID[id]
+	delete(pendingSaves.byID, id)
+	pendingSaves.Unlock()
+	if ok && save.stored {
+		deleteFailedSave(id)
+	}
+}
+
+// retrySaves writes the queued answers again until none is left.
+func retrySaves() {
+	ticker := time.NewTicker(saveRetryInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if flushPendingSaves() == 0 {
+			pendingSaves.Lock()
+			// an answer may have been queued while flushing
+			if len(pendingSaves.byID) == 0 {
+				pendingSaves.running = false
+				pendingSaves.Unlock()
+				return
+			}
+			pendingSaves.Unlock()
+		}
+	}
+}
+
+// flushPendingSaves tries to save every queued answer and returns how many
+// are left. Answers that still fail are kept in the FailedSaves table.
+func flushPendingSaves() int {
+	pendingSaves.Lock()
+	queued := make([]*pendingSave, 0, len(pendingSaves.byID))
+	for _, save := range pendingSaves.byID {
+		queued = append(queued, save)
+	}
+	pendingSaves.Unlock()
+
+	for _, save := range queued {
+		id := save.Message.ID
+		updated, err := updateMessage(id, save.User, save.Message)
+		switch {
+		case err == nil:
+			// updateMessage forgot the queued answer
+			log.Info("Saved queued answer", "messageID", id)
+			generationCompleted(save.User, "", updated)
+		case errors.Is(err, dbsql.ErrNoRows):
+			// the message or its conversation was deleted meanwhile
+			forgetPendingSave(id)
+		case !save.stored:
+			if storeErr := storeFailedSave(save); storeErr != nil {
+				log.Error("Error keeping queued answer", "messageID", id, "err", storeErr)
+				continue
+			}
+			pendingSaves.Lock()
+			save.stored = true
+			pendingSaves.Unlock()
+		}
+	}
+
+	pendingSaves.Lock()
+	defer pendingSaves.Unlock()
+	return len(pendingSaves.byID)
+}
+
+func storeFailedSave(save *pendingSave) error {
+	body, err := json.Marshal(save)
+	if err != nil {
+		return err
+	}
+	_, err = data.Exec(data.DB,
+		`INSERT OR REPLACE INTO FailedSaves (message_id, payload, created_at) VALUES (?, ?, ?)`,
+		save.Message.ID, string(body), time.Now().UTC(),
+	)
+	return err
+}
+
+func deleteFailedSave(id int) {
+	if _, err := data.Exec(data.DB, `DELETE FROM FailedSaves WHERE message_id = ?`, id); err != nil {
+		log.Error("Error deleting saved answer from the failsafe table", "messageID", id, "err", err)
+	}
+}
+
+// loadFailedSaves queues the answers a previous run could not save.
+func loadFailedSaves(db *dbsql.DB) {
+	rows, err := db.Query(`SELECT payload FROM FailedSaves`)
+	if err != nil {
+		log.Error("Error loading answers left to save", "err", err)
+		return
+	}
+	defer rows.Close()
+
+	pendingSaves.Lock()
+	defer pendingSaves.Unlock()
+	for rows.Next() {
+		var body string
+		if err := rows.Scan(&body); err != nil {
+			log.Error("Error scanning answer left to save", "err", err)
+			continue
+		}
+		save := &pendingSave{stored: true}
+		if err := json.Unmarshal([]byte(body), save); err != nil {
+			log.Error("Error decoding answer left to save", "err", err)
+			continue
+		}
+		pendingSaves.byID[save.Message.ID] = save
+	}
+	if len(pendingSaves.byID) > 0 && !pendingSaves.running {
+		log.Info("Saving answers left by the last run", "count", len(pendingSaves.byID))
+		pendingSaves.running = true
+		go retrySaves()
+	}
+}
@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
+
+func TestFinishMessageQueuesFailedSaves(t *testing.T) {
+	saveRetryInterval = time.Hour
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	db := data.DB
+	for _, stmt := range []string{
+		"INSERT INTO Conversations (id, user, title, created_at, updated_at) VALUES ('conv-save', 'test-user', '', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)",
+		"INSERT INTO Messages (id, conv_id, role, model, parent_id, content, status, created_at, updated_at) VALUES (7, 'conv-save', 'assistant', 'provider-x/model', 0, '', 'streaming', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)",
+		// stands in for a database locked past its busy timeout
+		"CREATE TRIGGER locked BEFORE UPDATE ON Messages BEGIN SELECT RAISE(ABORT, 'database is locked'); END",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	if _, err := finishMessage(7, "test-user", Message{Content: "the answer", Status: StatusCompleted}); err == nil {
+		t.Fatal("expected the save to fail")
+	}
+	if left := flushPendingSaves(); left != 1 {
+		t.Fatalf("expected 1 queued answer, got %d", left)
+	}
+	var stored int
+	db.QueryRow("SELECT COUNT(*) FROM FailedSaves WHERE message_id = 7").Scan(&stored)
+	if stored != 1 {
+		t.Fatal("expected the answer in the failsafe table")
+	}
+
+	// a restart only has the failsafe table
+	pendingSaves.Lock()
+	delete(pendingSaves.byID, 7)
+	pendingSaves.Unlock()
+	loadFailedSaves(db)
+
+	if _, err := db.Exec("DROP TRIGGER locked"); err != nil {
+		t.Fatal(err)
+	}
+	if left := flushPendingSaves(); left != 0 {
+		t.Fatalf("expected no queued answer, got %d", left)
+	}
+	var content, status string
+	db.QueryRow("SELECT content, status FROM Messages WHERE id = 7").Scan(&content, &status)
+	if content != "the answer" || status != StatusCompleted {
+		t.Errorf("expected the queued answer saved, got %q %q", content, status)
+	}
+	db.QueryRow("SELECT COUNT(*) FROM FailedSaves").Scan(&stored)
+	if stored != 0 {
+		t.Error("expected the failsafe table emptied")
+	}
+}
@@ -0,0 +1,47 @@
+package chat
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// pinMessage pins (PUT) or unpins (DELETE) a message, so it is sent to the
+// model in every answer of the conversation.
+func pinMessage(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	convID := r.PathValue("id")
+	messageID, err := strconv.Atoi(r.PathValue("messageId"))
+	if err != nil || messageID <= 0 {
+		utils.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+
+	current, err := getMessage(messageID, user)
+	if err != nil || current.ConvID != convID {
+		utils.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	msg, err := setPinned(messageID, user, r.Method == http.MethodPut)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error pinning message", "err", err)
+		utils.Error(w, "Error pinning message", http.StatusInternalServerError)
+		return
+	}
+
+	syncManager.Broadcast(user, r.Header.Get("X-Session-ID"), SyncEvent{
+		Type:           EventMessageUpdated,
+		ConversationID: convID,
+		MessageID:      msg.ID,
+		Message:        msg,
+	})
+	utils.RespondWithJSON(w, msg, http.StatusOK)
+}
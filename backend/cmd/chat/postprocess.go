@@ -0,0 +1,124 @@
+package chat
+
+import (
+	"regexp"
+	"strings"
+
+	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
+)
+
+// postProcessor rewrites the final content of an answer before it is saved.
+type postProcessor func(content string, user string) string
+
+// postProcessors are the processors a user can list in the postProcessors
+// setting, by name.
+var postProcessors = map[string]postProcessor{
+	"stripWrappers":  stripWrappers,
+	"normalizeLatex": normalizeLatex,
+	"redact":         redact,
+}
+
+// composeProcessors chains processors, each getting the output of the one
+// before.
+func composeProcessors(processors ...postProcessor) postProcessor {
+	return func(content string, user string) string {
+		for _, process := range processors {
+			content = process(content, user)
+		}
+		return content
+	}
+}
+
+// postProcess applies the user's post-processors to an answer, in the order
+// of the setting.
+func postProcess(content string, user string) string {
+	value, err := settings.Get("postProcessors", user)
+	if err != nil || value == "" || content == "" {
+		return content
+	}
+	var processors []postProcessor
+	for _, name := range stngs.SplitList(value) {
+		if process, ok := postProcessors[name]; ok {
+			processors = append(processors, process)
+		}
+	}
+	return composeProcessors(processors...)(content, user)
+}
+
+var (
+	thinkBlock = regexp.MustCompile(`^\s*<think>[\s\S]*?</think>\s*`)
+	// wrapperTags are the tags some providers wrap the whole answer in
+	wrapperTags = []string{"answer", "response", "output", "final_answer", "result"}
+)
+
+// stripWrappers removes a leading <think> block, which some providers put
+// in the content instead of the reasoning, and tags wrapping the whole
+// answer.
+func stripWrappers(content string, user string) string {
+	content = thinkBlock.ReplaceAllString(content, "")
+	trimmed := strings.TrimSpace(content)
+	for _, tag := range wrapperTags {
+		open, closing := "<"+tag+">", "</"+tag+">"
+		if strings.HasPrefix(trimmed, open) && strings.HasSuffix(trimmed, closing) {
+			inner := trimmed[len(open) : len(trimmed)-len(closing)]
+			// only a single wrapper, not two sibling elements
+			if !strings.Contains(inner, open) {
+				return strings.TrimSpace(inner)
+			}
+		}
+	}
+	return content
+}
+
+var (
+	codeSpan     = regexp.MustCompile("(?s)```.*?(```|$)|`[^`\n]*`")
+	inlineLatex  = regexp.MustCompile(`(?s)\\\((.+?)\\\)`)
+	displayLatex = regexp.MustCompile(`(?s)\\\[(.+?)\\\]`)
+)
+
+// normalizeLatex rewrites \( \) and \[ \] math delimiters to the $ and $$
+// ones the frontend renders, leaving code untouched.
+func normalizeLatex(content string, user string) string {
+	return outsideCode(content, func(text string) string {
+		text = displayLatex.ReplaceAllString(text, "$$$$$1$$$$")
+		return inlineLatex.ReplaceAllString(text, "$$$1$$")
+	})
+}
+
+// outsideCode applies rewrite to the parts of markdown that are not code
+// blocks or inline code.
+func outsideCode(content string, rewrite func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range codeSpan.FindAllStringIndex(content, -1) {
+		b.WriteString(rewrite(content[last:loc[0]]))
+		b.WriteString(content[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(rewrite(content[last:]))
+	return b.String()
+}
+
+const redacted = "[redacted]"
+
+// redact replaces the matches of the user's redactionRules, one regular
+// expression per line. Invalid rules are skipped.
+func redact(content string, user string) string {
+	rules, err := settings.Get("redactionRules", user)
+	if err != nil {
+		return content
+	}
+	for _, rule := range strings.Split(rules, "\n") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		re, err := regexp.Compile(rule)
+		if err != nil {
+			log.Warn("Skipping invalid redaction rule", "user", user, "rule", rule, "err", err)
+			continue
+		}
+		content = re.ReplaceAllLiteralString(content, redacted)
+	}
+	return content
+}
@@ -0,0 +1,64 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
+
+func TestStripWrappers(t *testing.T) {
+	tests := map[string]string{
+		"<think>hmm</think>\n\nHello":               "Hello",
+		"<answer>\n42\n</answer>":                   "42",
+		"  <response>Hi there</response>\n":         "Hi there",
+		"<answer>a</answer><answer>b</answer>":      "<answer>a</answer><answer>b</answer>",
+		"Use <output> tags like <output>x</output>": "Use <output> tags like <output>x</output>",
+	}
+	for in, want := range tests {
+		if got := stripWrappers(in, "test-user"); got != want {
+			t.Errorf("stripWrappers(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeLatex(t *testing.T) {
+	in := "Inline \\(x^2\\) and\n\\[\\sum_i i\\]\n`\\(code\\)`\n```\n\\[block\\]\n```"
+	want := "Inline $x^2$ and\n$$\\sum_i i$$\n`\\(code\\)`\n```\n\\[block\\]\n```"
+	if got := normalizeLatex(in, "test-user"); got != want {
+		t.Errorf("normalizeLatex:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestPostProcessorsApplyInOrder(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	err := settings.Save(map[string]string{
+		"postProcessors": "stripWrappers, redact",
+		"redactionRules": "final\n(unclosed",
+	}, "test-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := postProcess("<answer>the final content</answer>", "test-user"); got != "the [redacted] content" {
+		t.Errorf("unexpected processed content %q", got)
+	}
+
+	b, _ := json.Marshal(map[string]any{"conversationId": "conv-post", "parentId": 0, "model": "provider-x/model", "content": "hello"})
+	req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b))
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	chatStream(&flushRecorder{httptest.NewRecorder()}, req)
+
+	var content string
+	if err := data.DB.QueryRow("SELECT content FROM Messages WHERE role = 'assistant'").Scan(&content); err != nil {
+		t.Fatalf("assistant message not found: %v", err)
+	}
+	if content != "[redacted] content" {
+		t.Errorf("expected the saved answer to be redacted, got %q", content)
+	}
+}
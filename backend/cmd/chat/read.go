@@ -0,0 +1,68 @@
+package chat
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// ReadState is how far the user has read a conversation.
+type ReadState struct {
+	ConversationID    string    `json:"conversationId"`
+	LastReadMessageID int       `json:"lastReadMessageId"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+type ReadRequest struct {
+	// MessageID is the last message seen, the latest message when omitted
+	MessageID int `json:"messageId,omitempty"`
+}
+
+// markRead records the last message the user has seen in a conversation
+// and clears its unread indicator on the user's other sessions.
+func markRead(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	convID := r.PathValue("id")
+	var req ReadRequest
+	if r.ContentLength != 0 {
+		if err := utils.ExtractJSONBody(r, &req); err != nil {
+			utils.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if _, err := conversations.GetByID(convID, user); err != nil {
+		utils.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	state, err := reads.MarkRead(convID, user, req.MessageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error marking conversation read", "err", err)
+		utils.Error(w, "Error marking conversation read", http.StatusInternalServerError)
+		return
+	}
+
+	syncManager.Broadcast(user, r.Header.Get("X-Session-ID"), SyncEvent{
+		Type:           EventConversationRead,
+		ConversationID: convID,
+		MessageID:      state.LastReadMessageID,
+	})
+	utils.RespondWithJSON(w, state, http.StatusOK)
+}
+
+// unreadCounts returns the unread answers per conversation for the
+// conversation list. Lists still load when counting fails.
+func unreadCounts(user string) map[string]int {
+	counts, err := reads.UnreadCounts(user)
+	if err != nil {
+		log.Error("Error counting unread messages", "err", err)
+	}
+	return counts
+}
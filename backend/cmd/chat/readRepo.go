@@ -0,0 +1,95 @@
+package chat
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
+
+type ReadStateRepo interface {
+	// MarkRead records messageID as the last message the user has seen,
+	// the latest message of the conversation when it is 0.
+	MarkRead(convID string, user string, messageID int) (*ReadState, error)
+	// UnreadCounts returns the number of unread answers per conversation,
+	// leaving out conversations that have none.
+	UnreadCounts(user string) (map[string]int, error)
+}
+
+// ReadStateRepository keeps one read state per conversation, shared by all
+// sessions of its user. Conversations without one have nothing read.
+type ReadStateRepository struct {
+	db *sql.DB
+}
+
+func NewReadStateRepository(db *sql.DB) *ReadStateRepository {
+	return &ReadStateRepository{db: db}
+}
+
+func (repo *ReadStateRepository) MarkRead(convID string, user string, messageID int) (*ReadState, error) {
+	if messageID == 0 {
+		err := data.QueryRow(repo.db,
+			`SELECT COALESCE(MAX(id), 0) FROM Messages WHERE conv_id = ?`, convID,
+		).Scan(&messageID)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var exists bool
+		err := data.QueryRow(repo.db,
+			`SELECT 1 FROM Messages WHERE id = ? AND conv_id = ?`, messageID, convID,
+		).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	state := &ReadState{
+		ConversationID:    convID,
+		LastReadMessageID: messageID,
+		UpdatedAt:         time.Now().UTC(),
+	}
+	// reading an older message on another branch does not mark newer ones
+	// unread again
+	query := `
+	INSERT INTO ReadStates (conv_id, message_id, updated_at)
+	SELECT id, ?, ? FROM Conversations WHERE id = ? AND user = ?
+	ON CONFLICT(conv_id) DO UPDATE SET
+		message_id = MAX(message_id, excluded.message_id),
+		updated_at = excluded.updated_at
+	RETURNING message_id
+	`
+	err := data.QueryRow(repo.db, query, state.LastReadMessageID, state.UpdatedAt, convID, user).
+		Scan(&state.LastReadMessageID)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (repo *ReadStateRepository) UnreadCounts(user string) (map[string]int, error) {
+	query := `
+	SELECT m.conv_id, COUNT(*)
+	FROM Messages m
+	INNER JOIN Conversations c ON m.conv_id = c.id
+	LEFT JOIN ReadStates r ON r.conv_id = m.conv_id
+	WHERE c.user = ? AND m.role = 'assistant' AND m.id > COALESCE(r.message_id, 0)
+	GROUP BY m.conv_id
+	`
+	rows, err := repo.db.Query(query, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var convID string
+		var count int
+		if err := rows.Scan(&convID, &count); err != nil {
+			return nil, err
+		}
+		counts[convID] = count
+	}
+	return counts, rows.Err()
+}
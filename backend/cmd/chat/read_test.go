@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadState(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	convID, last := seedConversation(t, 2)
+
+	read := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/"+convID+"/read", bytes.NewBufferString(body))
+		req.SetPathValue("id", convID)
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := httptest.NewRecorder()
+		markRead(rr, req)
+		return rr
+	}
+	unread := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := httptest.NewRecorder()
+		getAllConversations(rr, req)
+		var list []Conversation
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list) != 1 {
+			t.Fatalf("unexpected list %s", rr.Body.String())
+		}
+		return list[0].Unread
+	}
+
+	// three answers, one of them on another branch
+	if n := unread(); n != 3 {
+		t.Fatalf("expected 3 unread answers, got %d", n)
+	}
+	if rr := read(`{"messageId": 3}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if n := unread(); n != 1 {
+		t.Errorf("expected 1 unread answer, got %d", n)
+	}
+
+	// an older message keeps the newer ones read
+	rr := read(`{"messageId": 2}`)
+	var state ReadState
+	json.Unmarshal(rr.Body.Bytes(), &state)
+	if state.LastReadMessageID != 3 {
+		t.Errorf("expected the read state to stay at 3, got %d", state.LastReadMessageID)
+	}
+
+	rr = read("")
+	json.Unmarshal(rr.Body.Bytes(), &state)
+	if rr.Code != http.StatusOK || state.LastReadMessageID != last {
+		t.Errorf("expected the latest message read, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if n := unread(); n != 0 {
+		t.Errorf("expected no unread answer, got %d", n)
+	}
+
+	if rr := read(`{"messageId": 999}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown message, got %d", rr.Code)
+	}
+}
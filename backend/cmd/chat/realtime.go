@@ -0,0 +1,476 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/moderation"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/usage"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"golang.org/x/net/websocket"
+)
+
+// Voice sessions relay the events of an OpenAI compatible realtime API
+// between the browser and the provider, so the API key never leaves the
+// server. The browser sends audio with input_audio_buffer.append and gets
+// audio and transcripts back unchanged. Transcripts of both sides are saved
+// as regular messages of the conversation, along with relay.* events that
+// tell the browser about them.
+//
+// The audio has already been played when a transcript arrives, so
+// moderation cannot hold an answer back. A blocked answer is saved as
+// blockedAnswer, and blocked input ends the session.
+
+const (
+	relaySession    = "relay.session"
+	relayMessage    = "relay.message"
+	relayModeration = "relay.moderation"
+	relayError      = "relay.error"
+)
+
+// historyItemPrefix marks the items created from earlier messages, so they
+// are not saved a second time.
+const historyItemPrefix = "hist_"
+
+type realtimeContent struct {
+	Type       string `json:"type"`
+	Text       string `json:"text,omitempty"`
+	Transcript string `json:"transcript,omitempty"`
+}
+
+type realtimeItem struct {
+	ID      string            `json:"id,omitempty"`
+	Type    string            `json:"type"`
+	Role    string            `json:"role,omitempty"`
+	Content []realtimeContent `json:"content,omitempty"`
+}
+
+// text joins the text and transcripts of the item's content parts.
+func (item *realtimeItem) text() string {
+	var parts []string
+	for _, c := range item.Content {
+		if c.Text != "" {
+			parts = append(parts, c.Text)
+		} else if c.Transcript != "" {
+			parts = append(parts, c.Transcript)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (item *realtimeItem) hasAudio() bool {
+	return slices.ContainsFunc(item.Content, func(c realtimeContent) bool {
+		return c.Type == "input_audio"
+	})
+}
+
+// realtimeEvent holds the fields of the provider events the relay reads.
+type realtimeEvent struct {
+	Type       string        `json:"type"`
+	Item       *realtimeItem `json:"item,omitempty"`
+	ItemID     string        `json:"item_id,omitempty"`
+	Transcript string        `json:"transcript,omitempty"`
+	Response   *struct {
+		Status string         `json:"status"`
+		Output []realtimeItem `json:"output"`
+		Usage  *struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	} `json:"response,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// relayEvent is sent to the browser next to the provider's events.
+type relayEvent struct {
+	Type           string               `json:"type"`
+	ConversationID string               `json:"conversationId,omitempty"`
+	ParentID       int                  `json:"parentId,omitempty"`
+	Message        *Message             `json:"message,omitempty"`
+	Moderation     *moderation.Decision `json:"moderation,omitempty"`
+	Code           apierr.Code          `json:"code,omitempty"`
+	Error          string               `json:"error,omitempty"`
+}
+
+type realtimeSession struct {
+	user      string
+	convID    string
+	model     string
+	sessionID string
+	// leaf is the newest message, the parent of the next one
+	leaf int
+	// items maps realtime item IDs to the messages saved for them
+	items    map[string]int
+	client   *websocket.Conn
+	upstream *websocket.Conn
+}
+
+// realtimeStream upgrades to a websocket and relays it to the realtime API
+// of the model. Query parameters: model, conversationId (a new conversation
+// is created when empty or unknown), parentId and sessionId.
+func realtimeStream(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	if !allowedOrigin(r) {
+		log.Warn("Rejected realtime session from foreign origin", "origin", r.Header.Get("Origin"))
+		utils.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	s := &realtimeSession{
+		user:      user,
+		convID:    q.Get("conversationId"),
+		model:     providers.ResolveModel(q.Get("model"), user),
+		sessionID: q.Get("sessionId"),
+		items:     make(map[string]int),
+	}
+	if s.model == "" {
+		utils.Error(w, "Missing model parameter", http.StatusBadRequest)
+		return
+	}
+	if parent := q.Get("parentId"); parent != "" {
+		id, err := strconv.Atoi(parent)
+		if err != nil || id < 0 {
+			utils.Error(w, "Invalid parentId parameter", http.StatusBadRequest)
+			return
+		}
+		s.leaf = id
+	}
+
+	if s.convID == "" || conversations.Touch(s.convID, user) != nil {
+		conv := newConversation(user)
+		if err := conversations.Save(conv); err != nil {
+			log.Error("Error creating conversation", "err", err)
+			utils.Error(w, fmt.Sprintf("Error creating conversation: %v", err), http.StatusBadRequest)
+			return
+		}
+		s.convID, s.leaf = conv.ID, 0
+		syncManager.Broadcast(user, s.sessionID, SyncEvent{
+			Type:           EventConversationCreated,
+			ConversationID: conv.ID,
+			Conversation:   conv,
+		})
+	} else if s.leaf > 0 {
+		if parent, err := getMessage(s.leaf, user); err != nil || parent.ConvID != s.convID {
+			utils.Error(w, "Invalid parent message", http.StatusBadRequest)
+			return
+		}
+	}
+
+	slot, ok := startGeneration(w, user, Generation{ConversationID: s.convID, Model: s.model})
+	if !ok {
+		return
+	}
+	defer generations.finish(user, slot)
+
+	upstream, err := providers.DialRealtime(s.model, user)
+	if err != nil {
+		log.Error("Error connecting to realtime API", "model", s.model, "err", err)
+		code := apierr.CodeOf(err)
+		utils.RespondWithError(w, code, err.Error(), apierr.Status(code))
+		return
+	}
+	defer upstream.Close()
+	s.upstream = upstream
+
+	// the origin was checked above
+	server := websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   s.run,
+	}
+	server.ServeHTTP(w, r)
+}
+
+// allowedOrigin accepts websocket upgrades from the app itself and from the
+// configured CORS origins. Browsers do not apply CORS to websockets.
+func allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || os.Getenv("ENV") == "dev" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == utils.RequestHost(r) || slices.Contains(config.List("corsOrigins"), origin)
+}
+
+func (s *realtimeSession) run(client *websocket.Conn) {
+	s.client = client
+	client.MaxPayloadBytes = int(utils.MaxBodySize())
+	// the server's read timeout still applies to the hijacked connection
+	_ = client.SetDeadline(time.Time{})
+	defer s.finish()
+
+	if err := s.setup(); err != nil {
+		log.Error("Error starting realtime session", "err", err)
+		_ = websocket.JSON.Send(client, relayEvent{Type: relayError, Code: apierr.ProviderUnavailable, Error: err.Error()})
+		return
+	}
+	_ = websocket.JSON.Send(client, relayEvent{Type: relaySession, ConversationID: s.convID, ParentID: s.leaf})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer s.upstream.Close()
+		for {
+			var frame string
+			if err := websocket.Message.Receive(client, &frame); err != nil {
+				return
+			}
+			if err := websocket.Message.Send(s.upstream, frame); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		var frame string
+		if err := websocket.Message.Receive(s.upstream, &frame); err != nil {
+			break
+		}
+		s.handle(frame)
+		if err := websocket.Message.Send(client, frame); err != nil {
+			break
+		}
+	}
+	client.Close()
+	<-done
+}
+
+// setup sends the system prompt and the earlier messages of the branch to
+// the provider, and turns on transcription of the user's audio.
+func (s *realtimeSession) setup() error {
+	ctx := buildContext(s.client.Request().Context(), s.convID, s.leaf, s.user, s.model)
+
+	update := map[string]any{
+		"type": "session.update",
+		"session": map[string]any{
+			"type":         "realtime",
+			"instructions": ctx[0].Content,
+			"audio": map[string]any{
+				"input": map[string]any{
+					"transcription": map[string]any{"model": config.Get("realtimeTranscriptionModel")},
+				},
+			},
+		},
+	}
+	if err := websocket.JSON.Send(s.upstream, update); err != nil {
+		return err
+	}
+
+	for i, msg := range ctx[1:] {
+		contentType := "input_text"
+		switch {
+		case msg.Content == "":
+			continue
+		case msg.Role == "assistant":
+			contentType = "output_text"
+		case msg.Role != "user":
+			continue
+		}
+		item := map[string]any{
+			"type": "conversation.item.create",
+			"item": realtimeItem{
+				ID:      historyItemPrefix + strconv.Itoa(i),
+				Type:    "message",
+				Role:    msg.Role,
+				Content: []realtimeContent{{Type: contentType, Text: msg.Content}},
+			},
+		}
+		if err := websocket.JSON.Send(s.upstream, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handle saves the messages found in a provider event.
+func (s *realtimeSession) handle(frame string) {
+	var event realtimeEvent
+	if err := json.Unmarshal([]byte(frame), &event); err != nil {
+		return
+	}
+
+	switch event.Type {
+	case "conversation.item.created", "conversation.item.added":
+		item := event.Item
+		if item == nil || item.Type != "message" || item.Role != "user" || strings.HasPrefix(item.ID, historyItemPrefix) {
+			return
+		}
+		if _, seen := s.items[item.ID]; seen {
+			return
+		}
+		msg := Message{
+			Role:    "user",
+			Content: item.text(),
+			Status:  StatusCompleted,
+		}
+		// the transcript of spoken input arrives later
+		if msg.Content == "" && item.hasAudio() {
+			msg.Status = StatusPending
+		}
+		s.save(&msg, item.ID)
+		if msg.Status == StatusCompleted {
+			s.moderateInput(msg.ID, msg.Content)
+		}
+
+	case "conversation.item.input_audio_transcription.completed":
+		s.transcribed(event.ItemID, event.Transcript, "")
+
+	case "conversation.item.input_audio_transcription.failed":
+		reason := "Transcription failed"
+		if event.Error != nil && event.Error.Message != "" {
+			reason = event.Error.Message
+		}
+		s.transcribed(event.ItemID, "", reason)
+
+	case "response.done":
+		if event.Response == nil {
+			return
+		}
+		if u := event.Response.Usage; u != nil {
+			cost := providers.UsageCost(s.model, s.user, u.InputTokens, u.OutputTokens)
+			usage.Record(s.user, s.model, u.InputTokens, u.OutputTokens, cost)
+		}
+		for _, item := range event.Response.Output {
+			if item.Type != "message" || item.Role != "assistant" {
+				continue
+			}
+			msg := Message{
+				Role:    "assistant",
+				Model:   s.model,
+				Content: item.text(),
+				Status:  StatusCompleted,
+			}
+			if msg.Content == "" && event.Response.Status != "failed" {
+				continue
+			}
+			if event.Response.Status == "failed" {
+				msg.Error = "Response failed"
+				msg.Status = StatusError
+			}
+			if u := event.Response.Usage; u != nil {
+				msg.TokenCount = u.OutputTokens
+				msg.ContextSize = u.InputTokens
+			}
+			// checked against the user message it answers, like chat answers
+			if s.moderate(s.leaf, moderation.StageOutput, msg.Content).Blocked() {
+				msg.Content = blockedAnswer
+			}
+			s.save(&msg, item.ID)
+		}
+	}
+}
+
+func (s *realtimeSession) save(msg *Message, itemID string) {
+	msg.ConvID = s.convID
+	msg.ParentID = s.leaf
+	msg.Children = []int{}
+
+	id, err := saveMessage(*msg)
+	if err != nil {
+		log.Error("Error saving realtime message", "err", err)
+		return
+	}
+	msg.ID = id
+	s.items[itemID] = id
+	s.leaf = id
+
+	syncManager.Broadcast(s.user, s.sessionID, SyncEvent{
+		Type:           EventMessageSaved,
+		ConversationID: s.convID,
+		MessageID:      id,
+		Message:        msg,
+	})
+	_ = websocket.JSON.Send(s.client, relayEvent{Type: relayMessage, Message: msg})
+}
+
+func (s *realtimeSession) transcribed(itemID string, transcript string, errMsg string) {
+	id, ok := s.items[itemID]
+	if !ok {
+		return
+	}
+	msg, err := getMessage(id, s.user)
+	if err != nil {
+		log.Error("Error retrieving realtime message", "err", err)
+		return
+	}
+	msg.Content = transcript
+	msg.Error = errMsg
+	msg.Status = StatusCompleted
+	if errMsg != "" {
+		msg.Status = StatusError
+	}
+	s.update(msg)
+	if errMsg == "" {
+		s.moderateInput(msg.ID, transcript)
+	}
+}
+
+// moderate checks a transcript and tells the browser about flagged content.
+func (s *realtimeSession) moderate(messageID int, stage moderation.Stage, text string) *moderation.Decision {
+	if !moderation.Enabled() {
+		return nil
+	}
+	d := moderation.Check(s.client.Request().Context(), s.user, s.convID, messageID, stage, text)
+	if d != nil {
+		_ = websocket.JSON.Send(s.client, relayEvent{Type: relayModeration, Moderation: d})
+	}
+	return d
+}
+
+// moderateInput checks what the user said and ends the session when it is
+// blocked, so the provider does not keep answering it.
+func (s *realtimeSession) moderateInput(messageID int, text string) {
+	if !s.moderate(messageID, moderation.StageInput, text).Blocked() {
+		return
+	}
+	_ = websocket.JSON.Send(s.client, relayEvent{
+		Type:  relayError,
+		Code:  apierr.ContentBlocked,
+		Error: "The message was blocked by moderation",
+	})
+	s.upstream.Close()
+}
+
+func (s *realtimeSession) update(msg *Message) {
+	updated, err := finishMessage(msg.ID, s.user, *msg)
+	if err != nil {
+		log.Error("Error updating realtime message", "err", err)
+		return
+	}
+	syncManager.Broadcast(s.user, s.sessionID, SyncEvent{
+		Type:           EventMessageUpdated,
+		ConversationID: s.convID,
+		MessageID:      updated.ID,
+		Message:        updated,
+	})
+	_ = websocket.JSON.Send(s.client, relayEvent{Type: relayMessage, Message: updated})
+}
+
+// finish completes the messages still waiting for a transcript when the
+// session ends.
+func (s *realtimeSession) finish() {
+	for _, id := range s.items {
+		msg, err := getMessage(id, s.user)
+		if err != nil || msg.Status != StatusPending {
+			continue
+		}
+		msg.Status = StatusCompleted
+		s.update(msg)
+	}
+}
@@ -0,0 +1,219 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/moderation"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/usage"
+
+	logger "github.com/charmbracelet/log"
+	"golang.org/x/net/websocket"
+)
+
+// fakeRealtimeAPI answers a committed audio buffer like the realtime API:
+// the user item, the assistant response and then, out of order, the
+// transcript of the user's audio.
+func fakeRealtimeAPI(received chan<- map[string]any, auth chan<- string) *httptest.Server {
+	return httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		auth <- ws.Request().Header.Get("Authorization")
+		for {
+			var event map[string]any
+			if err := websocket.JSON.Receive(ws, &event); err != nil {
+				return
+			}
+			received <- event
+			if event["type"] != "input_audio_buffer.commit" {
+				continue
+			}
+			for _, reply := range []string{
+				`{"type":"conversation.item.added","item":{"id":"item_u1","type":"message","role":"user","content":[{"type":"input_audio","transcript":null}]}}`,
+				`{"type":"response.done","response":{"status":"completed","output":[{"id":"item_a1","type":"message","role":"assistant","content":[{"type":"output_audio","transcript":"Hi there"}]}],"usage":{"input_tokens":20,"output_tokens":7}}}`,
+				`{"type":"conversation.item.input_audio_transcription.completed","item_id":"item_u1","transcript":"Hello"}`,
+			} {
+				if err := websocket.Message.Send(ws, reply); err != nil {
+					return
+				}
+			}
+		}
+	}))
+}
+
+// dialRelay connects a client to a relay in front of fakeRealtimeAPI.
+func dialRelay(t *testing.T, received chan<- map[string]any, auth chan<- string) *websocket.Conn {
+	t.Helper()
+	upstream := fakeRealtimeAPI(received, auth)
+	t.Cleanup(upstream.Close)
+
+	err := providers.NewRepository(data.DB).Save(&providers.Provider{
+		ID:      "provider-rt",
+		BaseURL: upstream.URL + "/v1",
+		APIKey:  "secret-key",
+		User:    "test-user",
+	})
+	if err != nil {
+		t.Fatalf("failed to save provider: %v", err)
+	}
+
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realtimeStream(w, r.WithContext(context.WithValue(r.Context(), "user", "test-user")))
+	}))
+	t.Cleanup(relay.Close)
+
+	wsURL := "ws" + strings.TrimPrefix(relay.URL, "http") + "/realtime?model=provider-rt/gpt-realtime"
+	client, err := websocket.Dial(wsURL, "", relay.URL)
+	if err != nil {
+		t.Fatalf("failed to connect to relay: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+	return client
+}
+
+func TestRealtimeRelay(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+	usage.SetupUsage(logger.New(os.Stdout), data.DB)
+
+	received := make(chan map[string]any, 20)
+	auth := make(chan string, 1)
+	client := dialRelay(t, received, auth)
+
+	if got := <-auth; got != "Bearer secret-key" {
+		t.Errorf("expected provider key on upstream connection, got %q", got)
+	}
+
+	var start relayEvent
+	if err := websocket.JSON.Receive(client, &start); err != nil || start.Type != relaySession || start.ConversationID == "" {
+		t.Fatalf("expected session event, got %+v (%v)", start, err)
+	}
+
+	if event := <-received; event["type"] != "session.update" {
+		t.Errorf("expected session.update first, got %v", event["type"])
+	}
+
+	if err := websocket.Message.Send(client, `{"type":"input_audio_buffer.commit"}`); err != nil {
+		t.Fatalf("failed to send event: %v", err)
+	}
+
+	var messages []*Message
+	forwarded := 0
+	for len(messages) < 3 || forwarded < 3 {
+		var event relayEvent
+		if err := websocket.JSON.Receive(client, &event); err != nil {
+			t.Fatalf("stream ended early: %v", err)
+		}
+		if event.Type == relayMessage {
+			messages = append(messages, event.Message)
+		} else {
+			forwarded++
+		}
+	}
+
+	if messages[0].Role != "user" || messages[0].Status != "pending" {
+		t.Errorf("expected pending user message first, got %+v", messages[0])
+	}
+	if messages[1].Role != "assistant" || messages[1].Content != "Hi there" || messages[1].ParentID != messages[0].ID {
+		t.Errorf("expected assistant reply to the user message, got %+v", messages[1])
+	}
+
+	user, err := getMessage(messages[0].ID, "test-user")
+	if err != nil || user.Content != "Hello" || user.Status != "completed" || user.ConvID != start.ConversationID {
+		t.Errorf("expected transcribed user message, got %+v (%v)", user, err)
+	}
+	assistant, err := getMessage(messages[1].ID, "test-user")
+	if err != nil || assistant.TokenCount != 7 || assistant.ContextSize != 20 || assistant.Model != "provider-rt/gpt-realtime" {
+		t.Errorf("expected assistant message with usage, got %+v (%v)", assistant, err)
+	}
+	if status, err := usage.Status("test-user"); err != nil || status.TokensUsed != 27 {
+		t.Errorf("expected the response usage recorded, got %+v (%v)", status, err)
+	}
+}
+
+func TestRealtimeModeration(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+	usage.SetupUsage(logger.New(os.Stdout), data.DB)
+	moderation.SetupModeration(logger.New(os.Stdout), data.DB)
+	t.Setenv("MODERATION_RULES", "there")
+	t.Setenv("MODERATION_ACTION", "block")
+
+	received := make(chan map[string]any, 20)
+	client := dialRelay(t, received, make(chan string, 1))
+
+	var start relayEvent
+	if err := websocket.JSON.Receive(client, &start); err != nil || start.Type != relaySession {
+		t.Fatalf("expected session event, got %+v (%v)", start, err)
+	}
+	if err := websocket.Message.Send(client, `{"type":"input_audio_buffer.commit"}`); err != nil {
+		t.Fatalf("failed to send event: %v", err)
+	}
+
+	var answer *Message
+	var decision *moderation.Decision
+	for answer == nil || decision == nil {
+		var event relayEvent
+		if err := websocket.JSON.Receive(client, &event); err != nil {
+			t.Fatalf("stream ended early: %v", err)
+		}
+		switch {
+		case event.Type == relayModeration:
+			decision = event.Moderation
+		case event.Type == relayMessage && event.Message.Role == "assistant":
+			answer = event.Message
+		}
+	}
+	if decision.Stage != moderation.StageOutput || !decision.Blocked() {
+		t.Errorf("expected the answer blocked, got %+v", decision)
+	}
+	if saved, err := getMessage(answer.ID, "test-user"); err != nil || saved.Content != blockedAnswer {
+		t.Errorf("expected the blocked answer saved, got %+v (%v)", saved, err)
+	}
+}
+
+func TestRealtimeRejectsForeignOrigin(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	req := httptest.NewRequest(http.MethodGet, "http://chat.example.com/realtime?model=p/m", nil)
+	req.Header.Set("Origin", "https://evil.example.net")
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	rr := httptest.NewRecorder()
+
+	realtimeStream(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for foreign origin, got %d", rr.Code)
+	}
+}
+
+func TestRealtimeRefusedOverBudget(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	usage.SetupUsage(logger.New(os.Stdout), data.DB)
+	if err := usage.SetBudget(&usage.Budget{User: "test-user", MonthlyTokens: 10}); err != nil {
+		t.Fatal(err)
+	}
+	usage.Record("test-user", "provider-rt/gpt-realtime", 10, 0, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/realtime?model=provider-rt/gpt-realtime", nil)
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	rr := httptest.NewRecorder()
+
+	realtimeStream(rr, req)
+
+	if rr.Code != http.StatusPaymentRequired {
+		t.Errorf("expected 402 over budget, got %d %s", rr.Code, rr.Body.String())
+	}
+	if n := generations.count(); n != 0 {
+		t.Errorf("expected no generation slot held, %d left", n)
+	}
+}
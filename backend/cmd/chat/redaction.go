@@ -0,0 +1,253 @@
+package chat
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// detector finds one kind of personal data, valid rejects matches that only
+// look like it.
+type detector struct {
+	label   string
+	pattern *regexp.Regexp
+	valid   func(match string) bool
+}
+
+// detectors are the kinds of the outboundRedaction setting. Cards go
+// before phones, whose pattern also matches card numbers.
+var detectors = map[string]detector{
+	"email": {
+		label:   "EMAIL",
+		pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	"creditCard": {
+		label:   "CARD",
+		pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		valid:   luhn,
+	},
+	"phone": {
+		label:   "PHONE",
+		pattern: regexp.MustCompile(`(?:\+|\b)\d[\d\s().-]{6,18}\d\b`),
+		valid: func(match string) bool {
+			n := countDigits(match)
+			return n >= 9 && n <= 15 && !isoDate.MatchString(match)
+		},
+	},
+}
+
+var isoDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}\b`)
+
+var detectorOrder = []string{"email", "creditCard", "phone"}
+
+// placeholderPattern matches the placeholders redaction puts in messages.
+var placeholderPattern = regexp.MustCompile(`\[(?:EMAIL|CARD|PHONE|REDACTED)_\d+\]`)
+
+// maxPlaceholder is the longest placeholder a stream can hold back.
+const maxPlaceholder = 24
+
+// redactor replaces personal data in the messages of a conversation with
+// placeholders such as [EMAIL_1], the same value always getting the same
+// placeholder, and restores them in answers. The mapping is saved so it
+// stays the same over the whole conversation.
+type redactor struct {
+	convID    string
+	detectors []detector
+	// placeholders maps values to their placeholders, values the reverse
+	placeholders map[string]string
+	values       map[string]string
+}
+
+// newRedactor returns the redactor of the user's outboundRedaction setting,
+// nil when nothing is redacted.
+func newRedactor(convID string, user string) *redactor {
+	value, err := settings.Get("outboundRedaction", user)
+	if err != nil || value == "" {
+		return nil
+	}
+	kinds := stngs.SplitList(value)
+	r := &redactor{
+		convID:       convID,
+		placeholders: make(map[string]string),
+		values:       make(map[string]string),
+	}
+	for _, kind := range detectorOrder {
+		if slices.Contains(kinds, kind) {
+			r.detectors = append(r.detectors, detectors[kind])
+		}
+	}
+	if slices.Contains(kinds, "custom") {
+		r.detectors = append(r.detectors, customDetectors(user)...)
+	}
+	if len(r.detectors) == 0 {
+		return nil
+	}
+
+	rows, err := data.DB.Query("SELECT placeholder, value FROM Redactions WHERE conv_id = ?", convID)
+	if err != nil {
+		log.Error("Error loading redactions", "convID", convID, "err", err)
+		return r
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var placeholder, value string
+		if err := rows.Scan(&placeholder, &value); err == nil {
+			r.placeholders[value] = placeholder
+			r.values[placeholder] = value
+		}
+	}
+	return r
+}
+
+// customDetectors are the user's redactionRules.
+func customDetectors(user string) []detector {
+	rules, err := settings.Get("redactionRules", user)
+	if err != nil {
+		return nil
+	}
+	var custom []detector
+	for _, rule := range strings.Split(rules, "\n") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		re, err := regexp.Compile(rule)
+		if err != nil {
+			log.Warn("Skipping invalid redaction rule", "user", user, "rule", rule, "err", err)
+			continue
+		}
+		custom = append(custom, detector{label: "REDACTED", pattern: re})
+	}
+	return custom
+}
+
+// redact replaces the personal data in text with placeholders.
+func (r *redactor) redact(text string) string {
+	for _, d := range r.detectors {
+		text = d.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if placeholderPattern.MatchString(match) || (d.valid != nil && !d.valid(match)) {
+				return match
+			}
+			return r.placeholder(d.label, match)
+		})
+	}
+	return text
+}
+
+func (r *redactor) placeholder(label string, value string) string {
+	if placeholder, ok := r.placeholders[value]; ok {
+		return placeholder
+	}
+	n := 1
+	for placeholder := range r.values {
+		if strings.HasPrefix(placeholder, "["+label+"_") {
+			n++
+		}
+	}
+	placeholder := fmt.Sprintf("[%s_%d]", label, n)
+	_, err := data.DB.Exec("INSERT OR IGNORE INTO Redactions (conv_id, placeholder, value, created_at) VALUES (?, ?, ?, ?)",
+		r.convID, placeholder, value, time.Now())
+	if err != nil {
+		log.Error("Error saving redaction", "convID", r.convID, "err", err)
+	}
+	r.placeholders[value] = placeholder
+	r.values[placeholder] = value
+	return placeholder
+}
+
+// restore puts the redacted values back in place of their placeholders.
+func (r *redactor) restore(text string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if value, ok := r.values[placeholder]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// redactMessages returns a copy of the messages with their text redacted.
+func (r *redactor) redactMessages(messages []providers.SimpleMessage) []providers.SimpleMessage {
+	redacted := make([]providers.SimpleMessage, len(messages))
+	for i, msg := range messages {
+		msg.Content = r.redact(msg.Content)
+		msg.ToolCall.Args = r.redact(msg.ToolCall.Args)
+		msg.ToolCall.Output = r.redact(msg.ToolCall.Output)
+		redacted[i] = msg
+	}
+	return redacted
+}
+
+// streamRestorer restores placeholders in the chunks streamed to the
+// client. A chunk ending in what may be the start of a placeholder is held
+// back until the next one completes it.
+type streamRestorer struct {
+	r    *redactor
+	held map[string]string
+}
+
+func (s *streamRestorer) transform(chunk utils.StreamChunk) utils.StreamChunk {
+	switch payload := chunk.Payload.(type) {
+	case string:
+		if chunk.Type != utils.CONTENT && chunk.Type != utils.REASONING {
+			return chunk
+		}
+		text := s.held[chunk.Type] + payload
+		s.held[chunk.Type] = ""
+		if i := strings.LastIndexByte(text, '['); i >= 0 && len(text)-i < maxPlaceholder && !strings.Contains(text[i:], "]") {
+			s.held[chunk.Type] = text[i:]
+			text = text[:i]
+		}
+		chunk.Payload = s.r.restore(text)
+	case providers.ToolCall:
+		payload.Args = s.r.restore(payload.Args)
+		chunk.Payload = payload
+	}
+	return chunk
+}
+
+// flush sends what is still held back.
+func (s *streamRestorer) flush(sc utils.StreamClient) {
+	for _, kind := range []string{utils.REASONING, utils.CONTENT} {
+		if text := s.held[kind]; text != "" {
+			utils.SendStreamChunk(sc, utils.StreamChunk{Type: kind, Payload: s.r.restore(text)})
+		}
+	}
+}
+
+// luhn checks the checksum of a card number.
+func luhn(number string) bool {
+	sum, n := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,94 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// mockProviderEcho records what it was sent and answers with the
+// placeholder of the email, split over two chunks.
+type mockProviderEcho struct {
+	sent []providers.SimpleMessage
+}
+
+func (m *mockProviderEcho) SendChatCompletionRequest(params providers.RequestParams) (*providers.ChatCompletionMessage, error) {
+	return &providers.ChatCompletionMessage{}, nil
+}
+
+func (m *mockProviderEcho) SendChatCompletionStreamRequest(params providers.RequestParams, sc utils.StreamClient) (*providers.ChatCompletionMessage, error) {
+	m.sent = params.Messages
+	utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: "Mail [EMA"})
+	utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: "IL_1] now"})
+	return &providers.ChatCompletionMessage{Content: "Mail [EMAIL_1] now"}, nil
+}
+
+func TestRedactorDetectors(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	if err := settings.Save(map[string]string{"outboundRedaction": "phone,email,creditCard"}, "test-user"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := data.DB.Exec("INSERT INTO Conversations (id, user, title) VALUES ('conv-pii', 'test-user', 'pii')"); err != nil {
+		t.Fatal(err)
+	}
+	r := newRedactor("conv-pii", "test-user")
+	in := "Reach jane.doe@example.com or +1 (555) 123-4567, card 4111 1111 1111 1111, not 1234 5678 9012 3456 on 2024-06-01 12:30, jane.doe@example.com"
+	got := r.redact(in)
+	want := "Reach [EMAIL_1] or [PHONE_1], card [CARD_1], not 1234 5678 9012 3456 on 2024-06-01 12:30, [EMAIL_1]"
+	if got != want {
+		t.Errorf("redact:\ngot  %q\nwant %q", got, want)
+	}
+	if restored := r.restore(got); restored != in {
+		t.Errorf("restore: got %q", restored)
+	}
+
+	// the mapping is kept for the next messages of the conversation
+	next := newRedactor("conv-pii", "test-user")
+	if got := next.redact("+1 (555) 123-4567 or bob@example.com"); got != "[PHONE_1] or [EMAIL_2]" {
+		t.Errorf("expected the saved placeholders to be reused, got %q", got)
+	}
+}
+
+func TestChatStream_OutboundRedaction(t *testing.T) {
+	mock := &mockProviderEcho{}
+	teardown := setupTest(t, mock)
+	defer teardown()
+
+	if err := settings.Save(map[string]string{"outboundRedaction": "email"}, "test-user"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := json.Marshal(map[string]any{"conversationId": "conv-pii", "parentId": 0, "model": "provider-x/model", "content": "Write to jane@example.com"})
+	req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b))
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	rr := &flushRecorder{httptest.NewRecorder()}
+	chatStream(rr, req)
+
+	last := mock.sent[len(mock.sent)-1]
+	if last.Content != "Write to [EMAIL_1]" {
+		t.Errorf("expected the email redacted before sending, got %q", last.Content)
+	}
+
+	body := rr.Body.String()
+	if strings.Contains(body, "EMA") || !strings.Contains(body, "jane@example.com") {
+		t.Errorf("expected the placeholder restored in the stream, got %s", body)
+	}
+
+	var content string
+	if err := data.DB.QueryRow("SELECT content FROM Messages WHERE role = 'assistant'").Scan(&content); err != nil {
+		t.Fatalf("assistant message not found: %v", err)
+	}
+	if content != "Mail jane@example.com now" {
+		t.Errorf("expected the placeholder restored in the saved answer, got %q", content)
+	}
+}
@@ -0,0 +1,103 @@
+package chat
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+)
+
+// retainEvery is how often retention policies are enforced.
+const retainEvery = time.Hour
+
+// retentionDays is the user's setting of a retention option, or the
+// server's when they have none. 0 turns the option off.
+func retentionDays(key string, user string) int {
+	if value, err := settings.Get(key, user); err == nil && value != "" {
+		if days, err := strconv.Atoi(value); err == nil && days >= 0 {
+			return days
+		}
+	}
+	return int(config.Int64(key))
+}
+
+func enforceRetention() {
+	for {
+		time.Sleep(retainEvery)
+		retain(time.Now())
+	}
+}
+
+// retain archives, deletes and expires what every user's retention
+// policies no longer keep by now.
+func retain(now time.Time) {
+	rows, err := data.DB.Query(`SELECT username FROM Users`)
+	if err != nil {
+		log.Error("Error querying users for retention", "err", err)
+		return
+	}
+	var users []string
+	for rows.Next() {
+		var user string
+		if err := rows.Scan(&user); err == nil {
+			users = append(users, user)
+		}
+	}
+	rows.Close()
+
+	for _, user := range users {
+		retainFor(user, now.UTC())
+	}
+}
+
+func retainFor(user string, now time.Time) {
+	if days := retentionDays("conversationArchiveDays", user); days > 0 {
+		ids, err := conversations.ArchiveStale(user, now.AddDate(0, 0, -days), now)
+		if err != nil {
+			log.Error("Error archiving conversations", "user", user, "err", err)
+		}
+		for _, id := range ids {
+			conv, err := conversations.GetByID(id, user)
+			if err != nil {
+				continue
+			}
+			syncManager.Broadcast(user, "", SyncEvent{
+				Type:           EventConversationUpdated,
+				ConversationID: id,
+				Conversation:   conv,
+			})
+		}
+		if len(ids) > 0 {
+			log.Info("Archived conversations", "user", user, "count", len(ids))
+		}
+	}
+
+	if days := retentionDays("conversationDeleteDays", user); days > 0 {
+		ids, err := conversations.Stale(user, now.AddDate(0, 0, -days))
+		if err != nil {
+			log.Error("Error querying conversations to delete", "user", user, "err", err)
+		}
+		for _, id := range ids {
+			if err := conversations.DeleteByID(id, user); err != nil {
+				log.Error("Error deleting conversation", "conversation", id, "err", err)
+				continue
+			}
+			syncManager.Broadcast(user, "", SyncEvent{
+				Type:           EventConversationDeleted,
+				ConversationID: id,
+			})
+		}
+		if len(ids) > 0 {
+			log.Info("Deleted conversations", "user", user, "count", len(ids))
+		}
+	}
+
+	// expired files are deleted by the files package's purge
+	if days := retentionDays("fileRetentionDays", user); days > 0 {
+		if _, err := fs.ExpireUploadedBefore(user, now.AddDate(0, 0, -days)); err != nil {
+			log.Error("Error expiring files", "user", user, "err", err)
+		}
+	}
+}
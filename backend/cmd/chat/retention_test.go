@@ -0,0 +1,158 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/google/uuid"
+)
+
+func TestRetention(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	now := time.Now().UTC()
+	save := func(age time.Duration, pinned bool) *Conversation {
+		conv := newConversation("test-user")
+		conv.UpdatedAt = now.Add(-age)
+		conv.Pinned = pinned
+		if err := conversations.Save(conv); err != nil {
+			t.Fatal(err)
+		}
+		return conv
+	}
+	day := 24 * time.Hour
+	fresh := save(day, false)
+	stale := save(60*day, false)
+	pinned := save(400*day, true)
+	ancient := save(400*day, false)
+
+	err := settings.Save(map[string]string{
+		"conversationArchiveDays": "30",
+		"conversationDeleteDays":  "365",
+	}, "test-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	retainFor("test-user", now)
+
+	if _, err := conversations.GetByID(ancient.ID, "test-user"); err == nil {
+		t.Error("conversation past the delete policy was kept")
+	}
+	for _, conv := range []*Conversation{fresh, pinned} {
+		got, err := conversations.GetByID(conv.ID, "test-user")
+		if err != nil || got.ArchivedAt != nil {
+			t.Errorf("conversation %s should stay listed, got %+v, %v", conv.ID, got, err)
+		}
+	}
+	if got, err := conversations.GetByID(stale.ID, "test-user"); err != nil || got.ArchivedAt == nil {
+		t.Fatalf("stale conversation was not archived: %+v, %v", got, err)
+	}
+
+	call := func(handler http.HandlerFunc, method, path, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if id != "" {
+			req.SetPathValue("id", id)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	list := func(query string) []string {
+		rr := call(getAllConversations, http.MethodGet, "/"+query, "")
+		var convs []*Conversation
+		if err := json.Unmarshal(rr.Body.Bytes(), &convs); err != nil {
+			t.Fatalf("decode list: %v, body %s", err, rr.Body.String())
+		}
+		var ids []string
+		for _, conv := range convs {
+			ids = append(ids, conv.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	sorted := func(ids ...string) []string {
+		slices.Sort(ids)
+		return ids
+	}
+
+	if got, want := list(""), sorted(fresh.ID, pinned.ID); !slices.Equal(got, want) {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+	if got, want := list("?archived=true"), []string{stale.ID}; !slices.Equal(got, want) {
+		t.Errorf("archived %v, want %v", got, want)
+	}
+	rr := call(getAllConversations, http.MethodGet, "/?archived=true&limit=10", "")
+	var page ConversationPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil || len(page.Conversations) != 1 || page.Conversations[0].ID != stale.ID {
+		t.Errorf("archived page %s, %v", rr.Body.String(), err)
+	}
+
+	if rr := call(archiveConversation, http.MethodDelete, "/"+stale.ID+"/archive", stale.ID); rr.Code != http.StatusOK {
+		t.Fatalf("unarchive: %d %s", rr.Code, rr.Body.String())
+	}
+	if got, want := list(""), sorted(fresh.ID, stale.ID, pinned.ID); !slices.Equal(got, want) {
+		t.Errorf("after unarchiving listed %v, want %v", got, want)
+	}
+	// unarchiving counts as an update, so retention leaves it listed
+	retainFor("test-user", now)
+	if got, _ := conversations.GetByID(stale.ID, "test-user"); got.ArchivedAt != nil {
+		t.Error("unarchived conversation was archived again")
+	}
+
+	rr = call(pinConversation, http.MethodPut, "/"+fresh.ID+"/pin", fresh.ID)
+	var conv Conversation
+	if err := json.Unmarshal(rr.Body.Bytes(), &conv); err != nil || !conv.Pinned {
+		t.Errorf("pin: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := call(pinConversation, http.MethodPut, "/missing/pin", "missing"); rr.Code != http.StatusNotFound {
+		t.Errorf("pinning an unknown conversation: expected 404, got %d", rr.Code)
+	}
+}
+
+func TestFileRetention(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	now := time.Now().UTC()
+	pinned := newConversation("test-user")
+	pinned.Pinned = true
+	if err := conversations.Save(pinned); err != nil {
+		t.Fatal(err)
+	}
+	uploaded := func(age time.Duration) string {
+		return now.Add(-age).Local().Format(time.RFC3339)
+	}
+	day := 24 * time.Hour
+	for _, file := range []fs.File{
+		{ID: "old", Name: "old.txt", User: "test-user", UploadedAt: uploaded(100 * day)},
+		{ID: "recent", Name: "recent.txt", User: "test-user", UploadedAt: uploaded(day)},
+		{ID: "in-pinned", Name: "kept.txt", User: "test-user", UploadedAt: uploaded(100 * day)},
+	} {
+		if err := files.Save(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := saveMessage(Message{ConvID: pinned.ID, Role: "user", Content: "keep this", Attachments: []fs.Attachment{
+		{ID: uuid.NewString(), File: fs.File{ID: "in-pinned"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := files.ExpireUploadedBefore("test-user", now.Add(-90*day), now)
+	if err != nil || n != 1 {
+		t.Fatalf("expired %d files, %v; want 1", n, err)
+	}
+	expired, err := files.GetExpired(now)
+	if err != nil || len(expired) != 1 || expired[0].ID != "old" {
+		t.Errorf("expired files %+v, %v", expired, err)
+	}
+}
@@ -2,33 +2,163 @@ package chat
 
 import (
 	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/idempotency"
+	"github.com/Bajahaw/ai-ui/cmd/jobs"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
 	"net/http"
 )
 
+// streamDescription tells clients how to read the chat streams
+const streamDescription = "Server-sent events: metadata with the saved message IDs, then chunks of content, reasoning and tool calls, and complete or error."
+
+// completeDescription tells clients what the non-streaming endpoints return
+const completeDescription = "Returns the question and the saved answer, or only the answer when the responseType setting is answer."
+
 func Handler() http.Handler {
-	mux := http.NewServeMux()
+	mux := openapi.NewRouter("/api/chat", "Chat")
 
-	mux.HandleFunc("POST /stream", chatStream)
-	mux.HandleFunc("POST /retry/stream", retryStream)
-	mux.HandleFunc("POST /update", update)
-	mux.HandleFunc("GET /cancel", cancelStream)
-	// mux.HandleFunc("POST /new", chat) // Temporarily disabled, use /stream instead
-	// mux.HandleFunc("POST /retry", retry)
+	mux.HandleFunc("POST /stream", idempotency.Handle(chatStream), openapi.Op{
+		Summary:     "Send a message and stream the response",
+		Description: streamDescription + " " + idempotency.Description,
+		Request:     Request{},
+		ContentType: "text/event-stream",
+	})
+	mux.HandleFunc("POST /retry/stream", retryStream, openapi.Op{
+		Summary:     "Generate another response to a message",
+		Description: streamDescription,
+		Request:     Retry{},
+		ContentType: "text/event-stream",
+	})
+	mux.HandleFunc("POST /complete", idempotency.Handle(completeChat), openapi.Op{
+		Summary:     "Send a message and wait for the response",
+		Description: completeDescription + " " + idempotency.Description,
+		Request:     Request{},
+		Response:    openapi.OneOf(Response{}, Message{}),
+	})
+	mux.HandleFunc("POST /retry/complete", idempotency.Handle(completeRetry), openapi.Op{
+		Summary:     "Generate another response to a message and wait for it",
+		Description: completeDescription + " " + idempotency.Description,
+		Request:     Retry{},
+		Response:    openapi.OneOf(Response{}, Message{}),
+	})
+	mux.HandleFunc("POST /batch", runBatch, openapi.Op{
+		Summary:     "Run a list of prompts against a model in the background",
+		Description: "Returns the queued job, its progress is reported on GET /api/jobs/{id}.",
+		Request:     PromptBatch{},
+		Response:    jobs.Job{},
+		Status:      http.StatusAccepted,
+	})
+	mux.HandleFunc("POST /batch/csv", runBatchCSV, openapi.Op{
+		Summary:     "Run the prompts of a CSV file against a model in the background",
+		Description: "Multipart form fields: file, model, column (default prompt, else the first column) and systemPrompt.",
+		Response:    jobs.Job{},
+		Status:      http.StatusAccepted,
+	})
+	mux.HandleFunc("GET /batch/{id}/results", getBatchResults, openapi.Op{
+		Summary:     "Download the answers of a finished batch",
+		Description: "CSV with the columns prompt, model, answer, error and tokens.",
+		ContentType: "text/csv",
+		Query:       []openapi.Param{{Name: "format", Description: "json for JSON instead of CSV"}},
+	})
+	mux.HandleFunc("POST /continue", continueStream, openapi.Op{
+		Summary:     "Continue an interrupted response",
+		Description: streamDescription,
+		Request:     Continue{},
+		ContentType: "text/event-stream",
+	})
+	mux.HandleFunc("GET /realtime", realtimeStream, openapi.Op{
+		Summary:     "Open a voice session",
+		Description: "Upgrades to a websocket relaying the provider's realtime API.",
+		Status:      http.StatusSwitchingProtocols,
+		Query: []openapi.Param{
+			{Name: "model", Required: true},
+			{Name: "conversationId"},
+			{Name: "parentId"},
+		},
+	})
+	mux.HandleFunc("POST /update", update, openapi.Op{Summary: "Edit a message", Request: Update{}, Response: Response{}})
+	mux.HandleFunc("POST /messages/batch", getMessagesBatch, openapi.Op{
+		Summary:     "Get messages by ID",
+		Description: "IDs that are not found are left out of the response.",
+		Request:     BatchRequest{},
+		Response:    Response{},
+	})
+	mux.HandleFunc("GET /cancel", cancelStream, openapi.Op{
+		Summary:  "Stop a response being generated",
+		Response: Message{},
+		Query:    []openapi.Param{{Name: "messageId", Required: true}},
+	})
+	mux.HandleFunc("GET /active", getActiveGenerations, openapi.Op{Summary: "List the responses being generated", Response: ActiveGenerations{}})
 
 	return http.StripPrefix("/api/chat", auth.Authenticated(mux))
 }
 
 func ConvsHandler() http.Handler {
-	mux := http.NewServeMux()
+	mux := openapi.NewRouter("/api/conversations", "Conversations")
 
-	mux.HandleFunc("GET     /", getAllConversations)
-	mux.HandleFunc("GET     /stats", getStats)
-	mux.HandleFunc("GET     /sync", syncHandler)
-	mux.HandleFunc("POST 	/add", saveConversation)
-	mux.HandleFunc("GET  	/{id}", getConversation)
-	mux.HandleFunc("DELETE  /{id}", deleteConversation)
-	mux.HandleFunc("POST 	/{id}/rename", renameConversation)
-	mux.HandleFunc("GET 	/{id}/messages", getConversationMessages)
+	pages := []openapi.Param{
+		{Name: "limit", Description: "Page size, returns a page instead of the full list"},
+		{Name: "before", Description: "nextCursor of the previous page"},
+	}
+	archived := openapi.Param{Name: "archived", Description: "true lists the archived conversations instead"}
+
+	mux.HandleFunc("GET     /", getAllConversations, openapi.Op{
+		Summary:  "List conversations",
+		Response: openapi.OneOf([]*Conversation{}, ConversationPage{}),
+		Query:    append([]openapi.Param{archived}, pages...),
+	})
+	mux.HandleFunc("GET     /stats", getStats, openapi.Op{Summary: "Get usage statistics", Response: ConversationStats{}})
+	mux.HandleFunc("GET     /search", searchConversations, openapi.Op{
+		Summary:  "Search messages",
+		Response: SearchPage{},
+		Query:    append([]openapi.Param{{Name: "q", Description: "Words, quoted phrases and filters", Required: true}}, pages...),
+	})
+	mux.HandleFunc("GET     /sync", syncHandler, openapi.Op{
+		Summary:     "Receive changes made by other sessions",
+		ContentType: "text/event-stream",
+		Query:       []openapi.Param{{Name: "sessionId", Required: true}},
+	})
+	mux.HandleFunc("POST 	/add", saveConversation, openapi.Op{Summary: "Create a conversation", Request: ConversationRequest{}, Response: Conversation{}, Status: http.StatusCreated})
+	mux.HandleFunc("GET  	/{id}", getConversation, openapi.Op{Summary: "Get a conversation", Response: Conversation{}})
+	mux.HandleFunc("DELETE  /{id}", deleteConversation, openapi.Op{Summary: "Delete a conversation", Status: http.StatusNoContent})
+	mux.HandleFunc("POST 	/{id}/rename", renameConversation, openapi.Op{Summary: "Rename a conversation", Request: RenameRequest{}, Response: Conversation{}})
+	mux.HandleFunc("POST 	/{id}/title", generateTitle, openapi.Op{Summary: "Name a conversation with the utility model", Response: Conversation{}})
+	mux.HandleFunc("POST 	/{id}/summary", summarizeConversation, openapi.Op{Summary: "Summarize the latest branch of a conversation with the utility model", Response: SummaryResponse{}})
+	mux.HandleFunc("POST 	/{id}/read", markRead, openapi.Op{Summary: "Mark a conversation read up to a message", Request: ReadRequest{}, Response: ReadState{}})
+	mux.HandleFunc("POST 	/{id}/memory", setConversationMemory, openapi.Op{Summary: "Turn memories on or off for a conversation", Request: ConversationMemoryRequest{}, Response: Conversation{}})
+	mux.HandleFunc("PUT 	/{id}/pin", pinConversation, openapi.Op{Summary: "Pin a conversation so retention never archives or deletes it", Response: Conversation{}})
+	mux.HandleFunc("DELETE 	/{id}/pin", pinConversation, openapi.Op{Summary: "Unpin a conversation", Response: Conversation{}})
+	mux.HandleFunc("PUT 	/{id}/archive", archiveConversation, openapi.Op{Summary: "Archive a conversation", Response: Conversation{}})
+	mux.HandleFunc("DELETE 	/{id}/archive", archiveConversation, openapi.Op{Summary: "Take a conversation out of the archive", Response: Conversation{}})
+	mux.HandleFunc("GET 	/{id}/messages", getConversationMessages, openapi.Op{
+		Summary:  "Get the messages of a conversation, by ID",
+		Response: openapi.OneOf(map[int]*Message{}, MessagePage{}),
+		Query:    pages,
+	})
+	mux.HandleFunc("GET 	/{id}/tree", getConversationTree, openapi.Op{Summary: "Get the branch structure of a conversation without message bodies", Response: Tree{}})
+	mux.HandleFunc("PUT 	/{id}/messages/{messageId}/pin", pinMessage, openapi.Op{Summary: "Pin a message so it is always sent to the model", Response: Message{}})
+	mux.HandleFunc("DELETE 	/{id}/messages/{messageId}/pin", pinMessage, openapi.Op{Summary: "Unpin a message", Response: Message{}})
+	mux.HandleFunc("GET 	/{id}/draft", getDraft, openapi.Op{Summary: "Get the unsent draft of a conversation", Response: Draft{}})
+	mux.HandleFunc("PUT 	/{id}/draft", saveDraft, openapi.Op{Summary: "Save the draft of a conversation", Request: Draft{}, Response: Draft{}})
+	mux.HandleFunc("GET 	/{id}/files", getConversationFiles, openapi.Op{
+		Summary:     "List the files attached to or made in a conversation, with the messages they appear in",
+		Description: "Files are listed in the order they first appear, without their extracted text.",
+		Query:       []openapi.Param{{Name: "type", Description: "Only files whose type starts with this, such as image/"}},
+		Response:    ConversationFilesResponse{},
+	})
+	mux.HandleFunc("GET 	/{id}/stats", getConversationStats, openapi.Op{Summary: "Get the token and model usage of a conversation", Response: ConversationDetail{}})
 
 	return http.StripPrefix("/api/conversations", auth.Authenticated(mux))
 }
+
+func SessionsHandler() http.Handler {
+	mux := openapi.NewRouter("/api/sessions", "Sessions")
+
+	mux.HandleFunc("GET /active", getActiveSessions, openapi.Op{
+		Summary:     "List the connected sessions of the user",
+		Description: "Sessions are the tabs and apps listening on `GET /api/conversations/sync`. The other sessions are told of connects and disconnects with `session_connected` and `session_disconnected` sync events.",
+		Response:    []*Session{},
+	})
+
+	return http.StripPrefix("/api/sessions", auth.Authenticated(mux))
+}
@@ -0,0 +1,281 @@
+package chat
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// SearchQuery is a parsed message search, e.g.
+//
+//	model:gpt-4o role:assistant before:2024-06-01 has:tool "segfault" core
+//
+// Terms and quoted phrases must all appear in the message content, filters
+// narrow down the messages they are looked for in. Unknown filters are
+// searched for as plain terms.
+type SearchQuery struct {
+	Terms          []string  `json:"terms,omitempty"`
+	Role           string    `json:"role,omitempty"`
+	Model          string    `json:"model,omitempty"`
+	ConversationID string    `json:"conversationId,omitempty"`
+	After          time.Time `json:"after,omitzero"`
+	Before         time.Time `json:"before,omitzero"`
+	HasAttachment  bool      `json:"hasAttachment,omitempty"`
+	HasToolCall    bool      `json:"hasToolCall,omitempty"`
+	// ExcludeConversationID leaves out a conversation, it is not parsed
+	ExcludeConversationID string `json:"-"`
+}
+
+type SearchResult struct {
+	ConversationID    string `json:"conversationId"`
+	ConversationTitle string `json:"conversationTitle"`
+	MessageID         int    `json:"messageId"`
+	Role              string `json:"role"`
+	Model             string `json:"model,omitempty"`
+	// Snippet is the part of the message around the first match
+	Snippet string `json:"snippet"`
+	// Context is the start of the message this one replies to
+	Context   string    `json:"context,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type SearchPage struct {
+	Query   SearchQuery    `json:"query"`
+	Results []SearchResult `json:"results"`
+	// NextCursor is passed as before to get the next page
+	NextCursor int `json:"nextCursor,omitempty"`
+}
+
+const (
+	searchDateLayout = "2006-01-02"
+	snippetLength    = 200
+)
+
+// tokenizeSearch splits a query on spaces, keeping quoted phrases, also as
+// filter values (model:"gpt 4o"), together.
+func tokenizeSearch(q string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case (r == ' ' || r == '\t' || r == '\n') && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+func parseSearchQuery(q string) (SearchQuery, error) {
+	var query SearchQuery
+	for _, token := range tokenizeSearch(q) {
+		key, value, ok := strings.Cut(token, ":")
+		if !ok || value == "" {
+			query.Terms = append(query.Terms, token)
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "role":
+			value = strings.ToLower(value)
+			if value != "user" && value != "assistant" {
+				return query, fmt.Errorf("role must be user or assistant")
+			}
+			query.Role = value
+		case "model":
+			query.Model = value
+		case "conv", "conversation":
+			query.ConversationID = value
+		case "before", "after":
+			date, err := time.ParseInLocation(searchDateLayout, value, time.Local)
+			if err != nil {
+				return query, fmt.Errorf("%s must be a date such as 2024-06-01", key)
+			}
+			if key == "before" {
+				query.Before = date
+			} else {
+				query.After = date
+			}
+		case "has":
+			switch strings.ToLower(value) {
+			case "attachment", "attachments", "file":
+				query.HasAttachment = true
+			case "tool", "tools", "tool-call":
+				query.HasToolCall = true
+			default:
+				return query, fmt.Errorf("has must be attachment or tool")
+			}
+		default:
+			query.Terms = append(query.Terms, token)
+		}
+	}
+	if query.empty() {
+		return query, fmt.Errorf("search query is empty")
+	}
+	return query, nil
+}
+
+func (q SearchQuery) empty() bool {
+	return len(q.Terms) == 0 && q.Role == "" && q.Model == "" && q.ConversationID == "" &&
+		q.After.IsZero() && q.Before.IsZero() && !q.HasAttachment && !q.HasToolCall
+}
+
+// likePattern matches s anywhere, with LIKE wildcards in s escaped by \.
+func likePattern(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(s) + "%"
+}
+
+func searchMessages(user string, query SearchQuery, limit int, before int) ([]SearchResult, error) {
+	sql := `
+	SELECT m.id, m.conv_id, COALESCE(c.title, ''), m.role, m.model, m.content, m.created_at,
+		COALESCE((SELECT p.content FROM Messages p WHERE p.id = m.parent_id), '')
+	FROM Messages m
+	INNER JOIN Conversations c ON m.conv_id = c.id
+	WHERE c.user = ?`
+	args := []any{user}
+
+	for _, term := range query.Terms {
+		sql += ` AND m.content LIKE ? ESCAPE '\'`
+		args = append(args, likePattern(term))
+	}
+	if query.Role != "" {
+		sql += ` AND m.role = ?`
+		args = append(args, query.Role)
+	}
+	if query.Model != "" {
+		sql += ` AND m.model LIKE ? ESCAPE '\'`
+		args = append(args, likePattern(query.Model))
+	}
+	if query.ConversationID != "" {
+		sql += ` AND m.conv_id = ?`
+		args = append(args, query.ConversationID)
+	}
+	if query.ExcludeConversationID != "" {
+		sql += ` AND m.conv_id != ?`
+		args = append(args, query.ExcludeConversationID)
+	}
+	if !query.After.IsZero() {
+		sql += ` AND m.created_at >= ?`
+		args = append(args, query.After)
+	}
+	if !query.Before.IsZero() {
+		sql += ` AND m.created_at < ?`
+		args = append(args, query.Before)
+	}
+	if query.HasAttachment {
+		sql += ` AND EXISTS (SELECT 1 FROM Attachments a WHERE a.message_id = m.id)`
+	}
+	if query.HasToolCall {
+		sql += ` AND EXISTS (SELECT 1 FROM ToolCalls t WHERE t.message_id = m.id)`
+	}
+	if before > 0 {
+		sql += ` AND m.id < ?`
+		args = append(args, before)
+	}
+	sql += ` ORDER BY m.id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := data.Query(data.DB, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]SearchResult, 0)
+	for rows.Next() {
+		var res SearchResult
+		var content, parent string
+		if err := rows.Scan(&res.MessageID, &res.ConversationID, &res.ConversationTitle, &res.Role, &res.Model, &content, &res.CreatedAt, &parent); err != nil {
+			return nil, err
+		}
+		res.Snippet = snippet(content, query.Terms)
+		res.Context = snippet(parent, nil)
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
+
+// snippet returns about snippetLength characters of s around the first of
+// terms found in it, or the start of s.
+func snippet(s string, terms []string) string {
+	start := 0
+	lower := strings.ToLower(s)
+	for _, term := range terms {
+		if i := strings.Index(lower, strings.ToLower(term)); i >= 0 {
+			// lowercasing may change the length of some characters
+			start = min(max(i-snippetLength/4, 0), len(s)-1)
+			break
+		}
+	}
+	// don't cut a character in half
+	for start > 0 && !utf8.RuneStart(s[start]) {
+		start--
+	}
+	end := len(s)
+	if n := start + snippetLength; n < end {
+		end = n
+		for end > start && !utf8.RuneStart(s[end]) {
+			end--
+		}
+	}
+
+	out := strings.TrimSpace(s[start:end])
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(s) {
+		out += "…"
+	}
+	return out
+}
+
+func searchConversations(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+
+	query, err := parseSearchQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := pageSize(r)
+	if err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	before := 0
+	if raw := r.URL.Query().Get("before"); raw != "" {
+		if before, err = strconv.Atoi(raw); err != nil || before <= 0 {
+			utils.Error(w, "before must be a message ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	results, err := searchMessages(user, query, limit, before)
+	if err != nil {
+		log.Error("Error searching messages", "err", err)
+		utils.Error(w, "Error searching messages", http.StatusInternalServerError)
+		return
+	}
+
+	resp := SearchPage{Query: query, Results: results}
+	if len(results) == limit {
+		resp.NextCursor = results[len(results)-1].MessageID
+	}
+	utils.RespondWithJSON(w, resp, http.StatusOK)
+}
@@ -0,0 +1,174 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	q, err := parseSearchQuery(`model:gpt-4o before:2024-06-01 role:Assistant has:tool "null pointer" segfault foo:bar`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q.Model != "gpt-4o" || q.Role != "assistant" || !q.HasToolCall || q.HasAttachment {
+		t.Errorf("unexpected filters: %+v", q)
+	}
+	if q.Before.Format(searchDateLayout) != "2024-06-01" || !q.After.IsZero() {
+		t.Errorf("unexpected dates: %+v", q)
+	}
+	if len(q.Terms) != 3 || q.Terms[0] != "null pointer" || q.Terms[1] != "segfault" || q.Terms[2] != "foo:bar" {
+		t.Errorf("unexpected terms: %q", q.Terms)
+	}
+
+	for _, bad := range []string{"", "   ", "role:system", "before:yesterday", "has:everything"} {
+		if _, err := parseSearchQuery(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestSearchConversations(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	conv := newConversation("test-user")
+	conv.Title = "Debugging"
+	if err := conversations.Save(conv); err != nil {
+		t.Fatalf("failed to save conversation: %v", err)
+	}
+	save := func(msg Message) int {
+		msg.ConvID = conv.ID
+		msg.Status = "completed"
+		id, err := saveMessage(msg)
+		if err != nil {
+			t.Fatalf("failed to save message: %v", err)
+		}
+		return id
+	}
+	question := save(Message{Role: "user", Content: "Why does this segfault?"})
+	answer := save(Message{Role: "assistant", Model: "openai/gpt-4o", ParentID: question, Content: "The segfault comes from a 100% null pointer."})
+	old := save(Message{Role: "assistant", Model: "openai/gpt-3.5", ParentID: question, Content: "A segfault, probably."})
+	if _, err := data.DB.Exec("UPDATE Messages SET created_at = ? WHERE id = ?", time.Date(2024, 1, 10, 12, 0, 0, 0, time.Local), old); err != nil {
+		t.Fatalf("failed to backdate message: %v", err)
+	}
+	call := &providers.ToolCall{ID: "call-s", ConvID: conv.ID, MessageID: answer, Name: "search", Args: "{}"}
+	if err := toolCalls.Save(call); err != nil {
+		t.Fatalf("failed to save tool call: %v", err)
+	}
+
+	search := func(q string) (int, SearchPage) {
+		req := httptest.NewRequest(http.MethodGet, "/conversations/search?q="+url.QueryEscape(q), nil)
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := httptest.NewRecorder()
+		searchConversations(rr, req)
+		var page SearchPage
+		_ = json.NewDecoder(rr.Body).Decode(&page)
+		return rr.Code, page
+	}
+	ids := func(page SearchPage) []int {
+		var ids []int
+		for _, res := range page.Results {
+			ids = append(ids, res.MessageID)
+		}
+		return ids
+	}
+
+	cases := []struct {
+		query string
+		want  []int
+	}{
+		{"segfault", []int{old, answer, question}},
+		{"SEGFAULT role:assistant", []int{old, answer}},
+		{"model:gpt-4o segfault", []int{answer}},
+		{`"null pointer"`, []int{answer}},
+		{"100%", []int{answer}},
+		{"has:tool", []int{answer}},
+		{"has:attachment", nil},
+		{"before:2024-02-01", []int{old}},
+		{"after:2024-02-01 role:assistant", []int{answer}},
+		{"conv:" + conv.ID + " role:user", []int{question}},
+		{"conv:other segfault", nil},
+	}
+	for _, c := range cases {
+		code, page := search(c.query)
+		if code != http.StatusOK {
+			t.Errorf("%q: expected 200, got %d", c.query, code)
+			continue
+		}
+		if got := ids(page); len(got) != len(c.want) || (len(got) > 0 && got[0] != c.want[0]) || (len(got) > 1 && got[len(got)-1] != c.want[len(c.want)-1]) {
+			t.Errorf("%q: expected messages %v, got %v", c.query, c.want, got)
+		}
+	}
+
+	_, page := search("model:gpt-4o")
+	res := page.Results[0]
+	if res.ConversationTitle != "Debugging" || res.Context != "Why does this segfault?" || res.Model != "openai/gpt-4o" {
+		t.Errorf("expected title and parent context in result, got %+v", res)
+	}
+
+	if code, _ := search("role:system"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid filter, got %d", code)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := ""
+	for range 100 {
+		long += "word "
+	}
+	got := snippet(long+"needle "+long, []string{"NEEDLE"})
+	if got[:3] != "…" || !contains(got, "needle") || len(got) > snippetLength+2*len("…") {
+		t.Errorf("expected snippet around the match, got %q", got)
+	}
+	if got := snippet("short", nil); got != "short" {
+		t.Errorf("expected short text unchanged, got %q", got)
+	}
+}
+
+func TestSearchHistoryTool(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	var convIDs []string
+	for _, content := range []string{"The launch code is blue-42.", "Remind me of the launch code"} {
+		conv := newConversation("test-user")
+		conv.Title = "Launch"
+		if err := conversations.Save(conv); err != nil {
+			t.Fatalf("failed to save conversation: %v", err)
+		}
+		if _, err := saveMessage(Message{ConvID: conv.ID, Role: "user", Status: "completed", Content: content}); err != nil {
+			t.Fatalf("failed to save message: %v", err)
+		}
+		convIDs = append(convIDs, conv.ID)
+	}
+	current := convIDs[1]
+
+	out := searchHistoryTool(context.Background(), `{"query": "launch code"}`, "test-user", current)
+	if !strings.Contains(out.Content, "turned off") {
+		t.Fatalf("expected history search to be off by default, got %q", out.Content)
+	}
+	if err := settings.Save(map[string]string{"historySearch": "true"}, "test-user"); err != nil {
+		t.Fatalf("failed to save setting: %v", err)
+	}
+
+	out = searchHistoryTool(context.Background(), `{"query": "launch code"}`, "test-user", current)
+	var results []HistoryResult
+	if err := json.Unmarshal([]byte(out.Content), &results); err != nil {
+		t.Fatalf("expected results, got %q", out.Content)
+	}
+	if len(results) != 1 || results[0].Snippet != "The launch code is blue-42." || results[0].Conversation != "Launch" {
+		t.Errorf("expected only the message of the other conversation, got %+v", results)
+	}
+	if out := searchHistoryTool(context.Background(), `{"query": "role:robot"}`, "test-user", current); !strings.HasPrefix(out.Content, "error:") {
+		t.Errorf("expected an invalid query to be reported, got %q", out.Content)
+	}
+}
@@ -0,0 +1,150 @@
+package chat
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// Session is a connected sync session of a user, one per open tab or app.
+type Session struct {
+	ID string `json:"id"`
+	// Device is a hint from the user agent, such as "Firefox on Linux"
+	Device      string    `json:"device"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	LastSeen    time.Time `json:"lastSeen"`
+	// Current is set for the session that asked for the list
+	Current bool `json:"current,omitempty"`
+}
+
+// Sessions lists the connected sessions of a user, oldest first. With a
+// bus it lists the sessions of every instance.
+func (sm *SyncManager) Sessions(userID string) []*Session {
+	if sm.bus != nil {
+		sessions, err := sm.bus.sessions(userID)
+		if err == nil {
+			slices.SortFunc(sessions, func(a, b *Session) int {
+				return a.ConnectedAt.Compare(b.ConnectedAt)
+			})
+			return sessions
+		}
+		log.Error("Error listing sessions of other instances", "err", err)
+	}
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	sessions := make([]*Session, 0, len(sm.subscribers[userID]))
+	for _, sub := range sm.subscribers[userID] {
+		sessions = append(sessions, sub.session())
+	}
+	slices.SortFunc(sessions, func(a, b *Session) int {
+		return a.ConnectedAt.Compare(b.ConnectedAt)
+	})
+	return sessions
+}
+
+func (sub *Subscriber) session() *Session {
+	return &Session{
+		ID:          sub.SessionID,
+		Device:      sub.Device,
+		ConnectedAt: sub.ConnectedAt,
+		LastSeen:    time.Unix(0, sub.lastSeen.Load()).UTC(),
+	}
+}
+
+// seen records that the session's connection is still alive.
+func (sub *Subscriber) seen() {
+	sub.lastSeen.Store(time.Now().UnixNano())
+}
+
+// connected tells the user's other sessions that sub connected.
+func (sm *SyncManager) connected(sub *Subscriber) {
+	if sm.bus != nil {
+		if err := sm.bus.join(sub.UserID, sub.session()); err != nil {
+			log.Error("Error sharing session with other instances", "err", err)
+		}
+	}
+	sm.Broadcast(sub.UserID, sub.SessionID, SyncEvent{Type: EventSessionConnected, Session: sub.session()})
+}
+
+// heartbeat records that the connection of sub is still alive.
+func (sm *SyncManager) heartbeat(sub *Subscriber) {
+	sub.seen()
+	if sm.bus != nil {
+		if err := sm.bus.join(sub.UserID, sub.session()); err != nil {
+			log.Error("Error sharing session with other instances", "err", err)
+		}
+	}
+}
+
+// disconnected unsubscribes sub and tells the user's other sessions. A
+// reconnect of the same session replaces sub and stays online.
+func (sm *SyncManager) disconnected(sub *Subscriber) {
+	if !sm.leave(sub) {
+		return
+	}
+	if sm.bus != nil {
+		if err := sm.bus.leave(sub.UserID, sub.SessionID); err != nil {
+			log.Error("Error removing session from other instances", "err", err)
+		}
+	}
+	sm.Broadcast(sub.UserID, sub.SessionID, SyncEvent{Type: EventSessionDisconnected, Session: sub.session()})
+}
+
+func getActiveSessions(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	current := r.Header.Get("X-Session-ID")
+	sessions := syncManager.Sessions(user)
+	for _, session := range sessions {
+		session.Current = session.ID == current
+	}
+	utils.RespondWithJSON(w, sessions, http.StatusOK)
+}
+
+// deviceHint names the browser and system of a user agent, "Unknown
+// device" when neither is recognized.
+func deviceHint(userAgent string) string {
+	var browser, system string
+	// Edge and Opera also name Chrome, and Chrome also names Safari
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	} {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	// iOS and Android user agents also name macOS and Linux
+	for _, s := range []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	return "Unknown device"
+}
@@ -0,0 +1,58 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestActiveSessions(t *testing.T) {
+	laptop := syncManager.Subscribe("test-user", "laptop", deviceHint("Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"))
+	phone := syncManager.Subscribe("test-user", "phone", deviceHint("Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"))
+	defer syncManager.Unsubscribe("test-user", "phone")
+
+	req := httptest.NewRequest(http.MethodGet, "/active", nil)
+	req.Header.Set("X-Session-ID", "phone")
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	rr := httptest.NewRecorder()
+	getActiveSessions(rr, req)
+
+	var sessions []Session
+	if err := json.Unmarshal(rr.Body.Bytes(), &sessions); err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].Device != "Firefox on Linux" || sessions[1].Device != "Safari on iPhone" {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+	if sessions[0].Current || !sessions[1].Current || sessions[1].LastSeen.IsZero() {
+		t.Errorf("expected the asking session marked current, got %+v", sessions)
+	}
+
+	// the laptop reconnects before its old connection is closed
+	reconnected := syncManager.Subscribe("test-user", "laptop", laptop.Device)
+	if syncManager.leave(laptop) {
+		t.Error("expected the replaced connection to leave the session online")
+	}
+	if !syncManager.leave(reconnected) {
+		t.Error("expected the current connection to leave")
+	}
+	if sessions := syncManager.Sessions("test-user"); len(sessions) != 1 || sessions[0].ID != phone.SessionID {
+		t.Errorf("expected only the phone left, got %+v", sessions)
+	}
+}
+
+func TestDeviceHint(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0": "Edge on Windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36":         "Chrome on macOS",
+		"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36":                  "Chrome on Android",
+		"curl/8.5.0": "Unknown device",
+	}
+	for ua, want := range tests {
+		if got := deviceHint(ua); got != want {
+			t.Errorf("%s: got %q, want %q", ua, got, want)
+		}
+	}
+}
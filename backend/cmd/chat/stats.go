@@ -0,0 +1,153 @@
+package chat
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// ConversationDetail is the aggregate view of a single conversation.
+// Cost is left out when none of the used models has a price.
+type ConversationDetail struct {
+	Messages         map[string]int `json:"messages"`
+	Branches         int            `json:"branches"`
+	TotalTokens      int64          `json:"totalTokens"`
+	TotalInputTokens int64          `json:"totalInputTokens"`
+	Models           []ModelUsage   `json:"models"`
+	ToolCalls        map[string]int `json:"toolCalls"`
+	Cost             *float64       `json:"cost,omitempty"`
+}
+
+type ModelUsage struct {
+	Model       string   `json:"model"`
+	Messages    int      `json:"messages"`
+	Tokens      int64    `json:"tokens"`
+	InputTokens int64    `json:"inputTokens"`
+	Cost        *float64 `json:"cost,omitempty"`
+}
+
+func getConversationStats(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	convID := r.PathValue("id")
+
+	if _, err := conversations.GetByID(convID, user); err != nil {
+		utils.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	stats, err := conversationDetail(data.DB, convID)
+	if err != nil {
+		log.Error("Error querying conversation stats", "err", err)
+		utils.Error(w, "Error querying conversation stats", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, stats, http.StatusOK)
+}
+
+func conversationDetail(db *sql.DB, convID string) (*ConversationDetail, error) {
+	stats := &ConversationDetail{
+		Messages:  make(map[string]int),
+		Models:    make([]ModelUsage, 0),
+		ToolCalls: make(map[string]int),
+	}
+
+	if err := countBy(db, stats.Messages,
+		`SELECT role, COUNT(*) FROM Messages WHERE conv_id = ? GROUP BY role`, convID); err != nil {
+		return nil, err
+	}
+	if err := countBy(db, stats.ToolCalls,
+		`SELECT name, COUNT(*) FROM ToolCalls WHERE conv_id = ? GROUP BY name`, convID); err != nil {
+		return nil, err
+	}
+
+	// every leaf message ends one branch of the tree
+	branchQuery := `
+		SELECT COUNT(*) FROM Messages m
+		WHERE m.conv_id = ?
+		AND NOT EXISTS (SELECT 1 FROM Messages c WHERE c.parent_id = m.id)
+	`
+	if err := db.QueryRow(branchQuery, convID).Scan(&stats.Branches); err != nil {
+		return nil, err
+	}
+
+	// completions before a tool call keep their tokens on the tool call row
+	usageQuery := `
+		SELECT
+			u.model,
+			COUNT(DISTINCT u.message_id),
+			COALESCE(SUM(u.completion), 0),
+			COALESCE(SUM(u.prompt), 0),
+			SUM(u.prompt * COALESCE(md.prompt_price, 0) + u.completion * COALESCE(md.completion_price, 0)) / 1000000.0,
+			MAX(md.prompt_price IS NOT NULL OR md.completion_price IS NOT NULL)
+		FROM (
+			SELECT id AS message_id, model, token_count AS completion, context_size AS prompt
+			FROM Messages WHERE conv_id = ? AND role = 'assistant'
+			UNION ALL
+			SELECT m.id, m.model, tc.token_count, tc.context_size
+			FROM ToolCalls tc JOIN Messages m ON tc.message_id = m.id
+			WHERE tc.conv_id = ?
+		) u
+		LEFT JOIN Models md ON md.id = u.model
+		GROUP BY u.model
+		ORDER BY u.model
+	`
+	rows, err := db.Query(usageQuery, convID, convID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var total float64
+	var priced bool
+	for rows.Next() {
+		var usage ModelUsage
+		var cost sql.NullFloat64
+		var hasPrice sql.NullBool
+		if err := rows.Scan(&usage.Model, &usage.Messages, &usage.Tokens, &usage.InputTokens, &cost, &hasPrice); err != nil {
+			return nil, err
+		}
+		if hasPrice.Bool {
+			c := roundCost(cost.Float64)
+			usage.Cost = &c
+			total += c
+			priced = true
+		}
+		stats.TotalTokens += usage.Tokens
+		stats.TotalInputTokens += usage.InputTokens
+		stats.Models = append(stats.Models, usage)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if priced {
+		total = roundCost(total)
+		stats.Cost = &total
+	}
+	return stats, nil
+}
+
+func countBy(db *sql.DB, into map[string]int, query string, args ...any) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var count int
+		if err := rows.Scan(&key, &count); err != nil {
+			return err
+		}
+		into[key] = count
+	}
+	return rows.Err()
+}
+
+func roundCost(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
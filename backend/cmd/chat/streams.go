@@ -0,0 +1,146 @@
+package chat
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// StreamEntry is the response stream of an assistant message. Only one
+// request, the leader, asks the provider for it; the requests that come in
+// for the same message while it runs follow the entry and get the same
+// stream, from the start, instead of generating it again.
+type StreamEntry struct {
+	mu sync.Mutex
+	// frames are the bytes the leader wrote so far, replayed to followers
+	frames [][]byte
+	done   bool
+	// changed is closed and replaced on every write and when the entry is
+	// done
+	changed chan struct{}
+}
+
+// streamKey identifies the stream of a message. The user is part of it so
+// a stream is only ever shared between requests of its owner.
+type streamKey struct {
+	user      string
+	messageID int
+}
+
+// streamRegistry guarantees a single flight per assistant message on this
+// instance.
+type streamRegistry struct {
+	mu      sync.Mutex
+	entries map[streamKey]*StreamEntry
+}
+
+var streams = &streamRegistry{entries: make(map[streamKey]*StreamEntry)}
+
+// join returns the entry of a message and whether the caller leads it. A
+// leader must call finish once it is done; followers call follow. Callers
+// must have checked that the user owns the message.
+func (s *streamRegistry) join(user string, messageID int) (*StreamEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := streamKey{user, messageID}
+	if entry, ok := s.entries[key]; ok {
+		return entry, false
+	}
+	entry := &StreamEntry{changed: make(chan struct{})}
+	s.entries[key] = entry
+	return entry, true
+}
+
+// finish ends the stream of a message, its followers return and the next
+// request for the message leads a new entry.
+func (s *streamRegistry) finish(user string, messageID int, entry *StreamEntry) {
+	s.mu.Lock()
+	key := streamKey{user, messageID}
+	if s.entries[key] == entry {
+		delete(s.entries, key)
+	}
+	s.mu.Unlock()
+
+	entry.mu.Lock()
+	entry.done = true
+	close(entry.changed)
+	entry.mu.Unlock()
+}
+
+func (e *StreamEntry) write(p []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.done {
+		return
+	}
+	e.frames = append(e.frames, append([]byte(nil), p...))
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// tee returns a writer that sends the leader's stream to its followers as
+// well. It must wrap the writer after the stream headers are set.
+func (e *StreamEntry) tee(w http.ResponseWriter) http.ResponseWriter {
+	return &teeWriter{ResponseWriter: w, entry: e}
+}
+
+// follow copies the stream to w until it is done or ctx ends, and reports
+// whether anything was sent. Nothing is sent when the leader failed before
+// it started streaming, the follower then has to handle its request itself.
+func (e *StreamEntry) follow(ctx context.Context, w http.ResponseWriter) bool {
+	sent := 0
+	for {
+		e.mu.Lock()
+		frames := e.frames[sent:]
+		done := e.done
+		changed := e.changed
+		e.mu.Unlock()
+
+		if len(frames) > 0 {
+			if sent == 0 {
+				utils.AddStreamHeaders(w)
+			}
+			for _, frame := range frames {
+				if _, err := w.Write(frame); err != nil {
+					return true
+				}
+			}
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+			sent += len(frames)
+		}
+		if done {
+			return sent > 0
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return sent > 0
+		}
+	}
+}
+
+type teeWriter struct {
+	http.ResponseWriter
+	entry *StreamEntry
+}
+
+func (w *teeWriter) Write(p []byte) (int, error) {
+	w.entry.write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *teeWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *teeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,154 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// mockProviderHeldContinuation cuts the first answer off at the token limit
+// and holds the continuation open until release is closed.
+type mockProviderHeldContinuation struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (m *mockProviderHeldContinuation) SendChatCompletionRequest(params providers.RequestParams) (*providers.ChatCompletionMessage, error) {
+	return &providers.ChatCompletionMessage{}, nil
+}
+
+func (m *mockProviderHeldContinuation) SendChatCompletionStreamRequest(params providers.RequestParams, sc utils.StreamClient) (*providers.ChatCompletionMessage, error) {
+	if m.calls.Add(1) == 1 {
+		_ = utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: "The first half"})
+		return &providers.ChatCompletionMessage{Content: "The first half", FinishReason: "length"}, nil
+	}
+	_ = utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: " and the rest."})
+	<-m.release
+	return &providers.ChatCompletionMessage{Content: " and the rest.", FinishReason: "stop"}, nil
+}
+
+// lockedRecorder can be read while a handler writes to it.
+type lockedRecorder struct {
+	mu sync.Mutex
+	*httptest.ResponseRecorder
+}
+
+func (r *lockedRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ResponseRecorder.Write(p)
+}
+
+func (r *lockedRecorder) Flush() {}
+
+func (r *lockedRecorder) body() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Body.String()
+}
+
+func TestContinueStreamSingleFlight(t *testing.T) {
+	mock := &mockProviderHeldContinuation{release: make(chan struct{})}
+	teardown := setupTest(t, mock)
+	defer teardown()
+
+	b, _ := json.Marshal(map[string]any{"conversationId": "conv-flight", "parentId": 0, "model": "provider-x/model", "content": "write a story"})
+	req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b))
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	chatStream(&flushRecorder{httptest.NewRecorder()}, req)
+
+	var msgID int
+	var convID string
+	if err := data.DB.QueryRow("SELECT id, conv_id FROM Messages WHERE role = 'assistant'").Scan(&msgID, &convID); err != nil {
+		t.Fatalf("assistant message not found: %v", err)
+	}
+
+	continueAs := func(user string, rr *lockedRecorder) {
+		b, _ := json.Marshal(map[string]any{"conversationId": convID, "messageId": msgID})
+		req := httptest.NewRequest(http.MethodPost, "/chat/continue", bytes.NewReader(b))
+		req = req.WithContext(context.WithValue(req.Context(), "user", user))
+		continueStream(rr, req)
+	}
+	continueReq := func(rr *lockedRecorder, done chan<- struct{}) {
+		defer close(done)
+		continueAs("test-user", rr)
+	}
+	waitFor := func(rr *lockedRecorder, text string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !contains(rr.body(), text) {
+			if time.Now().After(deadline) {
+				t.Fatalf("stream never sent %q, got %s", text, rr.body())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	first, second := &lockedRecorder{ResponseRecorder: httptest.NewRecorder()}, &lockedRecorder{ResponseRecorder: httptest.NewRecorder()}
+	firstDone, secondDone := make(chan struct{}), make(chan struct{})
+	go continueReq(first, firstDone)
+	waitFor(first, "and the rest.")
+
+	// the second tab gets the running continuation, metadata included
+	go continueReq(second, secondDone)
+	waitFor(second, "and the rest.")
+
+	// another user asking for the same message ID gets nothing of it
+	stranger := &lockedRecorder{ResponseRecorder: httptest.NewRecorder()}
+	continueAs("other-user", stranger)
+	if stranger.Code != http.StatusNotFound || contains(stranger.body(), "and the rest.") {
+		t.Errorf("expected 404 without frames for another user, got %d %s", stranger.Code, stranger.body())
+	}
+	close(mock.release)
+	<-firstDone
+	<-secondDone
+
+	if n := mock.calls.Load(); n != 2 {
+		t.Errorf("expected one continuation request to the provider, got %d", n-1)
+	}
+	if body := second.body(); !contains(body, "event: metadata") || !contains(body, "event: complete") {
+		t.Errorf("follower missed parts of the stream: %s", body)
+	}
+	if ct := second.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected an event stream for the follower, got %q", ct)
+	}
+
+	msg, _ := getMessage(msgID, "test-user")
+	if msg.Content != "The first half and the rest." {
+		t.Errorf("expected the continuation appended once, got %q", msg.Content)
+	}
+}
+
+func TestStreamFollowerOfFailedLeader(t *testing.T) {
+	entry, leader := streams.join("test-user", -1)
+	if !leader {
+		t.Fatal("expected the first request to lead")
+	}
+	if _, leader := streams.join("test-user", -1); leader {
+		t.Fatal("expected the second request to follow")
+	}
+
+	sent := make(chan bool)
+	go func() {
+		sent <- entry.follow(context.Background(), httptest.NewRecorder())
+	}()
+	streams.finish("test-user", -1, entry)
+	if <-sent {
+		t.Error("follower of a leader that never streamed should handle the request itself")
+	}
+	next, leader := streams.join("test-user", -1)
+	if !leader {
+		t.Error("expected a new leader once the entry finished")
+	}
+	streams.finish("test-user", -1, next)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,6 +17,14 @@ const (
 	EventConversationDeleted = "conversation_deleted"
 	EventMessageSaved        = "message_saved"
 	EventMessageUpdated      = "message_updated"
+	// EventGenerationCompleted carries the final state of a generated
+	// answer, whatever its status
+	EventGenerationCompleted = "generation_completed"
+	EventDraftUpdated        = "draft_updated"
+	EventConversationRead    = "conversation_read"
+	// presence of the user's other sessions
+	EventSessionConnected    = "session_connected"
+	EventSessionDisconnected = "session_disconnected"
 )
 
 type SyncEvent struct {
@@ -24,25 +33,40 @@ type SyncEvent struct {
 	Conversation   *Conversation `json:"conversation,omitempty"`
 	MessageID      int           `json:"messageId,omitempty"`
 	Message        *Message      `json:"message,omitempty"`
+	Draft          *Draft        `json:"draft,omitempty"`
+	Session        *Session      `json:"session,omitempty"`
 }
 
 type Subscriber struct {
-	UserID    string
-	SessionID string
-	Events    chan SyncEvent
-	Done      chan struct{}
+	UserID      string
+	SessionID   string
+	Device      string
+	ConnectedAt time.Time
+	Events      chan SyncEvent
+	Done        chan struct{}
+	// lastSeen is when the connection last wrote an event or heartbeat, in
+	// Unix nanoseconds
+	lastSeen atomic.Int64
 }
 
 type SyncManager struct {
 	subscribers map[string]map[string]*Subscriber // userId -> sessionId -> subscriber
 	mu          sync.RWMutex
+	// hooks see every broadcast event, even when no other session listens
+	hooks []func(userID string, event SyncEvent)
+	// bus shares events and sessions with other instances, nil when this
+	// instance runs alone
+	bus syncBus
 }
 
 var syncManager = &SyncManager{
 	subscribers: make(map[string]map[string]*Subscriber),
+	hooks:       []func(string, SyncEvent){invalidateOnSync, publishOnSync},
 }
 
-func (sm *SyncManager) Subscribe(userID, sessionID string) *Subscriber {
+// Subscribe registers a session of the user, device is a hint shown to the
+// user's other sessions.
+func (sm *SyncManager) Subscribe(userID, sessionID, device string) *Subscriber {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -58,11 +82,14 @@ func (sm *SyncManager) Subscribe(userID, sessionID string) *Subscriber {
 	}
 
 	sub := &Subscriber{
-		UserID:    userID,
-		SessionID: sessionID,
-		Events:    make(chan SyncEvent, 10), // Buffer slightly to avoid blocking
-		Done:      make(chan struct{}),
+		UserID:      userID,
+		SessionID:   sessionID,
+		Device:      device,
+		ConnectedAt: time.Now().UTC(),
+		Events:      make(chan SyncEvent, 10), // Buffer slightly to avoid blocking
+		Done:        make(chan struct{}),
 	}
+	sub.seen()
 
 	sm.subscribers[userID][sessionID] = sub
 	return sub
@@ -83,7 +110,49 @@ func (sm *SyncManager) Unsubscribe(userID, sessionID string) {
 	}
 }
 
+// leave unsubscribes sub unless its session reconnected meanwhile, and
+// reports whether it did.
+func (sm *SyncManager) leave(sub *Subscriber) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	userSubs := sm.subscribers[sub.UserID]
+	if userSubs[sub.SessionID] != sub {
+		return false
+	}
+	close(sub.Done)
+	delete(userSubs, sub.SessionID)
+	if len(userSubs) == 0 {
+		delete(sm.subscribers, sub.UserID)
+	}
+	return true
+}
+
+// Online reports whether the user has a session listening for events, on
+// any instance.
+func (sm *SyncManager) Online(userID string) bool {
+	if sm.bus != nil {
+		return len(sm.Sessions(userID)) > 0
+	}
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return len(sm.subscribers[userID]) > 0
+}
+
 func (sm *SyncManager) Broadcast(userID, sourceSessionID string, event SyncEvent) {
+	for _, hook := range sm.hooks {
+		hook(userID, event)
+	}
+	sm.deliver(userID, sourceSessionID, event)
+	if sm.bus != nil {
+		if err := sm.bus.publish(busMessage{User: userID, Source: sourceSessionID, Event: &event}); err != nil {
+			log.Error("Error publishing sync event to other instances", "type", event.Type, "err", err)
+		}
+	}
+}
+
+// deliver sends an event to the sessions connected to this instance.
+func (sm *SyncManager) deliver(userID, sourceSessionID string, event SyncEvent) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
@@ -107,21 +176,21 @@ func (sm *SyncManager) Broadcast(userID, sourceSessionID string, event SyncEvent
 func syncHandler(w http.ResponseWriter, r *http.Request) {
 	userID := utils.ExtractContextUser(r)
 	if userID == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		utils.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	// Session ID comes from query param — EventSource cannot send custom headers
 	sessionID := r.URL.Query().Get("sessionId")
 	if sessionID == "" {
-		http.Error(w, "Session ID required", http.StatusBadRequest)
+		utils.Error(w, "Session ID required", http.StatusBadRequest)
 		return
 	}
 
 	// Require flusher support — same pattern used by the rest of the streaming code
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		utils.Error(w, "Streaming not supported", http.StatusInternalServerError)
 		return
 	}
 
@@ -132,11 +201,12 @@ func syncHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("X-Accel-Buffering", "no")
 	w.WriteHeader(http.StatusOK)
 
-	sub := syncManager.Subscribe(userID, sessionID)
-	defer syncManager.Unsubscribe(userID, sessionID)
+	sub := syncManager.Subscribe(userID, sessionID, deviceHint(r.UserAgent()))
+	syncManager.connected(sub)
+	defer syncManager.disconnected(sub)
 
-	// Send a heartbeat every 30 s to keep proxies and load balancers alive
-	heartbeat := time.NewTicker(30 * time.Second)
+	// Send a heartbeat to keep proxies and load balancers alive
+	heartbeat := time.NewTicker(utils.HeartbeatInterval())
 	defer heartbeat.Stop()
 
 	for {
@@ -149,10 +219,12 @@ func syncHandler(w http.ResponseWriter, r *http.Request) {
 			}
 			fmt.Fprintf(w, "data: %s\n\n", data)
 			flusher.Flush()
+			sub.seen()
 
 		case <-heartbeat.C:
 			fmt.Fprintf(w, ": heartbeat\n\n")
 			flusher.Flush()
+			syncManager.heartbeat(sub)
 
 		case <-r.Context().Done():
 			// Client disconnected
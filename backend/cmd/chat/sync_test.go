@@ -0,0 +1,46 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamSyncEvents(t *testing.T) {
+	teardown := setupTest(t, &mockProviderSuccess{})
+	defer teardown()
+
+	other := syncManager.Subscribe("test-user", "session-b", "")
+	defer syncManager.Unsubscribe("test-user", "session-b")
+
+	b, _ := json.Marshal(map[string]any{"conversationId": "conv-sync", "parentId": 0, "model": "provider-x/model", "content": "Hello"})
+	req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b))
+	req.Header.Set("X-Session-ID", "session-a")
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	chatStream(&flushRecorder{httptest.NewRecorder()}, req)
+
+	var types []string
+	var last SyncEvent
+	for len(other.Events) > 0 {
+		last = <-other.Events
+		types = append(types, last.Type)
+	}
+	if len(types) == 0 || last.Type != EventGenerationCompleted {
+		t.Fatalf("expected the stream to end with %s, got %v", EventGenerationCompleted, types)
+	}
+	if last.Message == nil || last.Message.Status != StatusCompleted || last.MessageID != last.Message.ID {
+		t.Errorf("expected the completed answer, got %+v", last.Message)
+	}
+	saved := 0
+	for _, typ := range types {
+		if typ == EventMessageSaved {
+			saved++
+		}
+	}
+	if saved != 2 {
+		t.Errorf("expected the question and the answer saved, got %v", types)
+	}
+}
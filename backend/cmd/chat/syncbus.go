@@ -0,0 +1,190 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	syncChannel    = "ai-ui:sync"
+	sessionsPrefix = "ai-ui:sessions:"
+)
+
+// sessionTTL drops sessions of instances that stopped without saying
+// goodbye, a few missed heartbeats after their last one.
+func sessionTTL() time.Duration {
+	return 3 * utils.HeartbeatInterval()
+}
+
+// syncBus shares sync events and sessions between instances that serve
+// the same users.
+type syncBus interface {
+	publish(msg busMessage) error
+	// join adds or refreshes a session of the user
+	join(userID string, session *Session) error
+	leave(userID string, sessionID string) error
+	sessions(userID string) ([]*Session, error)
+}
+
+// busMessage is sent to every instance: an event for the user's sessions,
+// or a stream to cancel.
+type busMessage struct {
+	Instance string     `json:"instance"`
+	User     string     `json:"user"`
+	Source   string     `json:"source,omitempty"`
+	Event    *SyncEvent `json:"event,omitempty"`
+	// Cancel is the ID of an answer whose stream runs on another instance
+	Cancel int `json:"cancel,omitempty"`
+}
+
+// receive handles a message published by another instance.
+func (sm *SyncManager) receive(msg busMessage) {
+	if msg.Cancel != 0 {
+		if providers.CancelStream(msg.Cancel, msg.User) {
+			log.Debug("Cancelling stream for another instance", "messageID", msg.Cancel)
+		}
+		return
+	}
+	if msg.Event == nil {
+		return
+	}
+
+	// the other instance wrote to the database, what this one keeps in
+	// memory of the conversation is out of date
+	event := *msg.Event
+	if event.ConversationID != "" {
+		messageCache.invalidate(event.ConversationID)
+		conversations.Forget(event.ConversationID)
+	}
+	sm.deliver(msg.User, msg.Source, event)
+}
+
+// cancelElsewhere asks the other instances to cancel the stream of an
+// answer, it reports whether there are any.
+func (sm *SyncManager) cancelElsewhere(messageID int, user string) bool {
+	if sm.bus == nil {
+		return false
+	}
+	if err := sm.bus.publish(busMessage{User: user, Cancel: messageID}); err != nil {
+		log.Error("Error asking other instances to cancel a stream", "err", err)
+		return false
+	}
+	return true
+}
+
+// setupSyncBus connects to the Redis server of REDIS_URL, when set, so
+// several instances behind a load balancer share sync events, sessions and
+// stream cancellation. Without it every instance only knows its own
+// sessions.
+func setupSyncBus() {
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		return
+	}
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		log.Error("Invalid REDIS_URL, sync stays local to this instance", "err", err)
+		return
+	}
+	bus, err := newRedisBus(redis.NewClient(opts), syncManager.receive)
+	if err != nil {
+		log.Error("Error connecting to Redis, sync stays local to this instance", "err", err)
+		return
+	}
+	syncManager.bus = bus
+	log.Info("Sharing sync events through Redis", "addr", opts.Addr)
+}
+
+type redisBus struct {
+	client   *redis.Client
+	instance string
+}
+
+// newRedisBus subscribes to the sync channel and passes the messages of
+// other instances to handle.
+func newRedisBus(client *redis.Client, handle func(busMessage)) (*redisBus, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pubsub := client.Subscribe(context.Background(), syncChannel)
+	// wait for the subscription, so no event published after setup is lost
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	bus := &redisBus{client: client, instance: uuid.NewString()}
+	go func() {
+		// the channel survives reconnects and is closed with pubsub
+		for m := range pubsub.Channel() {
+			var msg busMessage
+			if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+				log.Warn("Failed to decode sync message", "err", err)
+				continue
+			}
+			if msg.Instance != bus.instance {
+				handle(msg)
+			}
+		}
+	}()
+	return bus, nil
+}
+
+func (b *redisBus) publish(msg busMessage) error {
+	msg.Instance = b.instance
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(context.Background(), syncChannel, body).Err()
+}
+
+func (b *redisBus) join(userID string, session *Session) error {
+	body, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	key := sessionsPrefix + userID
+	_, err = b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, session.ID, body)
+		pipe.Expire(ctx, key, sessionTTL())
+		return nil
+	})
+	return err
+}
+
+func (b *redisBus) leave(userID string, sessionID string) error {
+	return b.client.HDel(context.Background(), sessionsPrefix+userID, sessionID).Err()
+}
+
+func (b *redisBus) sessions(userID string) ([]*Session, error) {
+	ctx := context.Background()
+	key := sessionsPrefix + userID
+	all, err := b.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*Session, 0, len(all))
+	var stale []string
+	for id, body := range all {
+		var session Session
+		if err := json.Unmarshal([]byte(body), &session); err != nil || time.Since(session.LastSeen) > sessionTTL() {
+			stale = append(stale, id)
+			continue
+		}
+		sessions = append(sessions, &session)
+	}
+	if len(stale) > 0 {
+		b.client.HDel(ctx, key, stale...)
+	}
+	return sessions, nil
+}
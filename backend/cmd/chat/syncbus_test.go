@@ -0,0 +1,100 @@
+package chat
+
+import (
+	"sync"
+	"testing"
+)
+
+// memBus stands in for Redis between SyncManagers of one process.
+type memBus struct {
+	mu     sync.Mutex
+	peers  *[]*SyncManager
+	shared map[string]map[string]*Session
+	self   *SyncManager
+}
+
+func (b *memBus) publish(msg busMessage) error {
+	for _, peer := range *b.peers {
+		if peer != b.self {
+			peer.receive(msg)
+		}
+	}
+	return nil
+}
+
+func (b *memBus) join(userID string, session *Session) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.shared[userID] == nil {
+		b.shared[userID] = make(map[string]*Session)
+	}
+	b.shared[userID][session.ID] = session
+	return nil
+}
+
+func (b *memBus) leave(userID string, sessionID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.shared[userID], sessionID)
+	return nil
+}
+
+func (b *memBus) sessions(userID string) ([]*Session, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sessions := make([]*Session, 0)
+	for _, session := range b.shared[userID] {
+		s := *session
+		sessions = append(sessions, &s)
+	}
+	return sessions, nil
+}
+
+func TestSyncAcrossInstances(t *testing.T) {
+	teardown := setupTest(t, nil)
+	defer teardown()
+
+	var peers []*SyncManager
+	shared := make(map[string]map[string]*Session)
+	newInstance := func() *SyncManager {
+		sm := &SyncManager{subscribers: make(map[string]map[string]*Subscriber)}
+		sm.bus = &memBus{peers: &peers, shared: shared, self: sm}
+		peers = append(peers, sm)
+		return sm
+	}
+	a, b := newInstance(), newInstance()
+
+	laptop := a.Subscribe("test-user", "laptop", "Firefox on Linux")
+	a.connected(laptop)
+	phone := b.Subscribe("test-user", "phone", "Safari on iPhone")
+	b.connected(phone)
+
+	if event := <-laptop.Events; event.Type != EventSessionConnected || event.Session.ID != "phone" {
+		t.Errorf("expected the phone to connect on the other instance, got %+v", event)
+	}
+	if sessions := a.Sessions("test-user"); len(sessions) != 2 || !b.Online("test-user") {
+		t.Errorf("expected both sessions on every instance, got %+v", sessions)
+	}
+
+	convID, _ := seedConversation(t, 1)
+	conv, _ := conversations.GetByID(convID, "test-user")
+	b.Broadcast("test-user", "phone", SyncEvent{Type: EventConversationUpdated, ConversationID: convID, Conversation: conv})
+	if event := <-laptop.Events; event.Type != EventConversationUpdated || event.ConversationID != convID {
+		t.Errorf("expected the update on the other instance, got %+v", event)
+	}
+	if len(phone.Events) != 0 {
+		t.Error("expected no echo to the session that made the change")
+	}
+
+	a.disconnected(laptop)
+	if event := <-phone.Events; event.Type != EventSessionDisconnected {
+		t.Errorf("expected the laptop to disconnect, got %+v", event)
+	}
+	if sessions := b.Sessions("test-user"); len(sessions) != 1 || sessions[0].ID != "phone" {
+		t.Errorf("expected only the phone left, got %+v", sessions)
+	}
+	b.disconnected(phone)
+	if a.Online("test-user") {
+		t.Error("expected the user offline")
+	}
+}
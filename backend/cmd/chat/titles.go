@@ -0,0 +1,171 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+const titlePrompt = "Write a short title of at most six words for the conversation below. " +
+	"Answer with the title only, without quotes or punctuation at the end."
+
+const summaryPrompt = "Summarize the conversation below in a few sentences, " +
+	"keeping the questions asked, the answers found and what is left open."
+
+// maxTitleLength caps generated titles, in characters.
+const maxTitleLength = 80
+
+// transcriptMessageLength caps every message of a transcript sent to the
+// utility model, in characters, so long answers do not fill its context.
+const transcriptMessageLength = 2000
+
+type SummaryResponse struct {
+	Summary string `json:"summary"`
+	// Model is the utility model that wrote the summary
+	Model string `json:"model"`
+}
+
+func generateTitle(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	convId := r.PathValue("id")
+
+	conv, err := conversations.GetByID(convId, user)
+	if err != nil {
+		log.Error("Error retrieving conversation", "err", err)
+		utils.Error(w, "Error retrieving conversation", http.StatusNotFound)
+		return
+	}
+
+	// the first question and answer say what the conversation is about
+	branch := latestBranch(getAllConversationMessages(convId, user))
+	if len(branch) > 2 {
+		branch = branch[:2]
+	}
+	title, _, err := utilityCompletion(r.Context(), branch, user, titlePrompt)
+	if err != nil {
+		log.Error("Error generating title", "conv", convId, "err", err)
+		utils.RespondWithError(w, apierr.CodeOf(err), "Error generating title: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	conv.Title = cleanTitle(title)
+	if conv.Title == "" {
+		utils.Error(w, "The model did not answer with a title", http.StatusBadGateway)
+		return
+	}
+	if err := conversations.Update(conv); err != nil {
+		log.Error("Error updating conversation", "err", err)
+		utils.Error(w, fmt.Sprintf("Error updating conversation: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	sessionID := r.Header.Get("X-Session-ID")
+	syncManager.Broadcast(user, sessionID, SyncEvent{
+		Type:           EventConversationUpdated,
+		ConversationID: convId,
+		Conversation:   conv,
+	})
+
+	utils.RespondWithJSON(w, &conv, http.StatusOK)
+}
+
+func summarizeConversation(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	convId := r.PathValue("id")
+
+	if _, err := conversations.GetByID(convId, user); err != nil {
+		log.Error("Error retrieving conversation", "err", err)
+		utils.Error(w, "Error retrieving conversation", http.StatusNotFound)
+		return
+	}
+
+	branch := latestBranch(getAllConversationMessages(convId, user))
+	summary, model, err := utilityCompletion(r.Context(), branch, user, summaryPrompt)
+	if err != nil {
+		log.Error("Error summarizing conversation", "conv", convId, "err", err)
+		utils.RespondWithError(w, apierr.CodeOf(err), "Error summarizing conversation: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	utils.RespondWithJSON(w, SummaryResponse{Summary: strings.TrimSpace(summary), Model: model}, http.StatusOK)
+}
+
+// utilityCompletion asks the user's utility model to follow prompt over a
+// transcript of messages. When no utility model is set, the model of the
+// last answer is used. It returns the answer and the model that gave it.
+func utilityCompletion(ctx context.Context, messages []*Message, user string, prompt string) (string, string, error) {
+	var transcript strings.Builder
+	conversationModel := ""
+	for _, msg := range messages {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+		if msg.Role == "assistant" && msg.Model != "" {
+			conversationModel = msg.Model
+		}
+		content := []rune(msg.Content)
+		if len(content) > transcriptMessageLength {
+			content = append(content[:transcriptMessageLength], []rune("...")...)
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, string(content))
+	}
+	if transcript.Len() == 0 {
+		return "", "", errors.New("the conversation has no messages")
+	}
+
+	model := providers.UtilityModel(user, conversationModel)
+	params := providers.RequestParams{
+		Messages: []providers.SimpleMessage{
+			{Role: "system", Content: prompt},
+			{Role: "user", Content: transcript.String()},
+		},
+		Context: ctx,
+		Model:   model,
+		User:    user,
+	}
+	temperature := 0.0
+	params.Temperature = &temperature
+
+	response, err := provider.SendChatCompletionRequest(params)
+	if err != nil {
+		return "", model, err
+	}
+	return response.Content, model, nil
+}
+
+// latestBranch returns the messages from the root of the conversation to
+// its newest message, oldest first.
+func latestBranch(messages map[int]*Message) []*Message {
+	newest := 0
+	for id := range messages {
+		newest = max(newest, id)
+	}
+	var branch []*Message
+	for msg := messages[newest]; msg != nil; msg = messages[msg.ParentID] {
+		branch = append(branch, msg)
+		if msg.ParentID == 0 {
+			break
+		}
+	}
+	slices.Reverse(branch)
+	return branch
+}
+
+// cleanTitle keeps the first line of a generated title, without the quotes
+// and trailing punctuation models tend to add.
+func cleanTitle(title string) string {
+	title, _, _ = strings.Cut(strings.TrimSpace(title), "\n")
+	title = strings.TrimPrefix(title, "Title:")
+	title = strings.Trim(strings.TrimSpace(title), "\"'*.`")
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = strings.TrimSpace(string(runes[:maxTitleLength]))
+	}
+	return title
+}
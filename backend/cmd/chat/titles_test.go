@@ -0,0 +1,85 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// mockProviderUtility answers chats and records the requests of the
+// utility model.
+type mockProviderUtility struct {
+	utility []providers.RequestParams
+}
+
+func (m *mockProviderUtility) SendChatCompletionRequest(params providers.RequestParams) (*providers.ChatCompletionMessage, error) {
+	m.utility = append(m.utility, params)
+	return &providers.ChatCompletionMessage{Content: "\"Planning a Trip to Paris.\"\nMore text"}, nil
+}
+
+func (m *mockProviderUtility) SendChatCompletionStreamRequest(params providers.RequestParams, sc utils.StreamClient) (*providers.ChatCompletionMessage, error) {
+	_ = utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: "Visit the Louvre"})
+	return &providers.ChatCompletionMessage{Content: "Visit the Louvre"}, nil
+}
+
+func TestGenerateTitle(t *testing.T) {
+	mock := &mockProviderUtility{}
+	teardown := setupTest(t, mock)
+	defer teardown()
+
+	b, _ := json.Marshal(map[string]any{"conversationId": "conv-title", "parentId": 0, "model": "provider-x/model", "content": "What should I see in Paris?"})
+	req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b))
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	rr := &flushRecorder{httptest.NewRecorder()}
+	chatStream(rr, req)
+
+	var convID string
+	if err := data.DB.QueryRow("SELECT id FROM Conversations WHERE user = 'test-user'").Scan(&convID); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(handler http.HandlerFunc, action string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/"+convID+"/"+action, nil)
+		req.SetPathValue("id", convID)
+		req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	// without a utility model the conversation's model names it
+	rr2 := post(generateTitle, "title")
+	if rr2.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr2.Code, rr2.Body.String())
+	}
+	var conv Conversation
+	json.Unmarshal(rr2.Body.Bytes(), &conv)
+	if conv.Title != "Planning a Trip to Paris" {
+		t.Errorf("unexpected title %q", conv.Title)
+	}
+	last := mock.utility[len(mock.utility)-1]
+	if last.Model != "provider-x/model" || !strings.Contains(last.Messages[1].Content, "user: What should I see in Paris?") {
+		t.Errorf("unexpected request %+v", last)
+	}
+
+	if err := settings.Save(map[string]string{"utilityModel": "provider-x/small"}, "test-user"); err != nil {
+		t.Fatal(err)
+	}
+	rr3 := post(summarizeConversation, "summary")
+	var summary SummaryResponse
+	json.Unmarshal(rr3.Body.Bytes(), &summary)
+	if rr3.Code != http.StatusOK || summary.Model != "provider-x/small" {
+		t.Errorf("expected a summary by the utility model, got %d: %s", rr3.Code, rr3.Body.String())
+	}
+	if last := mock.utility[len(mock.utility)-1]; !strings.Contains(last.Messages[1].Content, "assistant: Visit the Louvre") {
+		t.Errorf("expected the answer in the transcript, got %q", last.Messages[1].Content)
+	}
+}
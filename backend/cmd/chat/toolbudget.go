@@ -0,0 +1,103 @@
+package chat
+
+import (
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// toolBudgetNote asks the model to answer once the tools of an answer are
+// used up, as it is not offered tools anymore.
+const toolBudgetNote = "The tool budget of this answer is used up. Answer now with what you found so far, without calling tools."
+
+// toolBudget limits the tool calls of one answer, so a model that keeps
+// asking for tools cannot loop forever.
+type toolBudget struct {
+	maxRounds int64
+	maxTime   time.Duration
+	// rounds of tool calls run and the time the tools took, waiting for
+	// approval included
+	rounds int64
+	spent  time.Duration
+}
+
+// ToolBudgetExceeded is the payload of the tool_budget_exceeded event.
+type ToolBudgetExceeded struct {
+	// Reason is "iterations" or "time"
+	Reason     string `json:"reason"`
+	Iterations int64  `json:"iterations"`
+	ToolTimeMs int64  `json:"toolTimeMs"`
+}
+
+func newToolBudget() *toolBudget {
+	return &toolBudget{
+		maxRounds: config.Int64("maxToolIterations"),
+		maxTime:   config.Duration("maxToolTime"),
+	}
+}
+
+// exceeded tells why no other round of tool calls may run, "" when one may.
+func (b *toolBudget) exceeded() string {
+	switch {
+	case b.maxRounds > 0 && b.rounds >= b.maxRounds:
+		return "iterations"
+	case b.maxTime > 0 && b.spent >= b.maxTime:
+		return "time"
+	}
+	return ""
+}
+
+// finishWithoutTools tells the client the budget is used up and streams the
+// rest of the answer without offering tools. The tool calls the model asked
+// for last are dropped.
+func finishWithoutTools(
+	reason string,
+	budget *toolBudget,
+	providerParams providers.RequestParams,
+	responseMessage *Message,
+	convID string,
+	sc utils.StreamClient,
+) (*providers.ChatCompletionMessage, error) {
+	log.Info("Tool budget exceeded", "messageID", responseMessage.ID, "reason", reason, "rounds", budget.rounds, "toolTime", budget.spent)
+	utils.SendStreamChunk(sc, utils.StreamChunk{
+		Type: utils.EVENT_TOOL_BUDGET,
+		Payload: ToolBudgetExceeded{
+			Reason:     reason,
+			Iterations: budget.rounds,
+			ToolTimeMs: budget.spent.Milliseconds(),
+		},
+	})
+
+	providerParams.Tools = nil
+	providerParams.Messages = append(providerParams.Messages, providers.SimpleMessage{
+		Role:    "user",
+		Content: toolBudgetNote,
+	})
+	if responseMessage.Content != "" {
+		utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: "\n"})
+	}
+
+	completion, err := streamCompletion(convID, providerParams, sc)
+	if err != nil {
+		log.Error("Error streaming chat completion after tool budget", "err", err)
+		utils.SendStreamChunk(sc, utils.StreamChunk{
+			Type:    utils.EVENT_ERROR,
+			Payload: err.Error(),
+			Code:    apierr.CodeOf(err),
+		})
+		return completion, err
+	}
+
+	if completion.Content != "" {
+		if responseMessage.Content != "" {
+			responseMessage.Content += "\n"
+		}
+		responseMessage.Content += completion.Content
+	}
+	responseMessage.Reasoning += completion.Reasoning
+	completion.ToolCalls = nil
+	return completion, nil
+}
@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// mockProviderLoopingTools asks for a tool every time it is offered tools.
+type mockProviderLoopingTools struct {
+	calls      int
+	lastParams providers.RequestParams
+}
+
+func (m *mockProviderLoopingTools) SendChatCompletionRequest(params providers.RequestParams) (*providers.ChatCompletionMessage, error) {
+	return nil, nil
+}
+
+func (m *mockProviderLoopingTools) SendChatCompletionStreamRequest(params providers.RequestParams, sc utils.StreamClient) (*providers.ChatCompletionMessage, error) {
+	m.calls++
+	m.lastParams = params
+	last := params.Messages[len(params.Messages)-1]
+	if last.Content == toolBudgetNote {
+		_ = utils.SendStreamChunk(sc, utils.StreamChunk{Type: utils.CONTENT, Payload: "Final answer"})
+		return &providers.ChatCompletionMessage{Content: "Final answer"}, nil
+	}
+	return &providers.ChatCompletionMessage{
+		ToolCalls: []providers.ToolCall{{ID: fmt.Sprintf("tc-%d", m.calls), ReferenceID: "ref", Name: "fake_tool", Args: `{}`}},
+	}, nil
+}
+
+func TestChatStream_ToolBudget(t *testing.T) {
+	t.Setenv("MAX_TOOL_ITERATIONS", "2")
+	mock := &mockProviderLoopingTools{}
+	teardown := setupTest(t, mock)
+	defer teardown()
+
+	b, _ := json.Marshal(map[string]any{"conversationId": "conv-budget", "parentId": 0, "model": "provider-x/model", "content": "hello"})
+	req := httptest.NewRequest(http.MethodPost, "/chat/stream", bytes.NewReader(b))
+	req = req.WithContext(context.WithValue(req.Context(), "user", "test-user"))
+	rr := &flushRecorder{httptest.NewRecorder()}
+	chatStream(rr, req)
+
+	body := rr.Body.String()
+	// the first answer, two rounds of tools and the final answer
+	if mock.calls != 4 {
+		t.Errorf("expected 4 completions, got %d", mock.calls)
+	}
+	if mock.lastParams.Tools != nil {
+		t.Error("expected the final completion to be sent without tools")
+	}
+	if !strings.Contains(body, `"`+utils.EVENT_TOOL_BUDGET+`"`) || !strings.Contains(body, `"reason":"iterations"`) {
+		t.Errorf("expected a tool budget event, got: %s", body)
+	}
+	if !strings.Contains(body, "Final answer") || !strings.Contains(body, "event: complete") {
+		t.Errorf("expected the answer to complete, got: %s", body)
+	}
+}
@@ -0,0 +1,84 @@
+package chat
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// TreeNode is a message without its body, enough to draw the branch graph.
+type TreeNode struct {
+	ID         int    `json:"id"`
+	ParentID   int    `json:"parentId,omitempty"`
+	Role       string `json:"role"`
+	Model      string `json:"model,omitempty"`
+	Status     string `json:"status"`
+	Preview    string `json:"preview"`
+	ChildCount int    `json:"childCount"`
+	Pinned     bool   `json:"pinned,omitempty"`
+}
+
+// Tree lists the nodes of a conversation in ID order, so parents come
+// before their children, and the IDs of the root messages.
+type Tree struct {
+	ConversationID string     `json:"conversationId"`
+	Roots          []int      `json:"roots"`
+	Nodes          []TreeNode `json:"nodes"`
+}
+
+func getConversationTree(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	convID := r.PathValue("id")
+	if _, err := conversations.GetByID(convID, user); err != nil {
+		utils.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	tree, err := loadTree(convID, user)
+	if err != nil {
+		log.Error("Error loading conversation tree", "convID", convID, "err", err)
+		utils.Error(w, "Error loading conversation tree", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, tree, http.StatusOK)
+}
+
+// loadTree reads the nodes in one query, without the message bodies.
+func loadTree(convID string, user string) (*Tree, error) {
+	sql := `
+	SELECT m.id, m.parent_id, m.role, m.model, m.status, m.pinned,
+		substr(m.content, 1, ?), length(m.content) > ?,
+		(SELECT COUNT(*) FROM Messages ch WHERE ch.parent_id = m.id)
+	FROM Messages m
+	INNER JOIN Conversations c ON m.conv_id = c.id
+	WHERE m.conv_id = ? AND c.user = ?
+	ORDER BY m.id
+	`
+	rows, err := data.Query(data.DB, sql, previewLength, previewLength, convID, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tree := &Tree{ConversationID: convID, Roots: []int{}, Nodes: []TreeNode{}}
+	for rows.Next() {
+		var node TreeNode
+		var truncated bool
+		err := rows.Scan(&node.ID, &node.ParentID, &node.Role, &node.Model, &node.Status, &node.Pinned,
+			&node.Preview, &truncated, &node.ChildCount)
+		if err != nil {
+			return nil, err
+		}
+		node.Preview = strings.Join(strings.Fields(node.Preview), " ")
+		if truncated {
+			node.Preview += "…"
+		}
+		if node.ParentID == 0 {
+			tree.Roots = append(tree.Roots, node.ID)
+		}
+		tree.Nodes = append(tree.Nodes, node)
+	}
+	return tree, rows.Err()
+}
@@ -1,17 +1,26 @@
 package chat
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"os"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/data"
 	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/memory"
 	"github.com/Bajahaw/ai-ui/cmd/providers"
+	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
 	"github.com/Bajahaw/ai-ui/cmd/tools"
+	"github.com/Bajahaw/ai-ui/cmd/tracing"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 	"github.com/openai/openai-go/v3"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const platformInstructions = `
@@ -55,8 +64,17 @@ const platformInstructions = `
 </platform_instructions>
 `
 
+// currentDate tells the model the date and time in the user's time zone,
+// so it does not answer with the date of its training data.
+func currentDate(user string, now time.Time) string {
+	l := stngs.LocalizerFor(settings, user)
+	return "Current date: " + l.Date(now) + "\nCurrent time: " + l.Time(now) + " (" + l.Location.String() + ")"
+}
+
 // Helper
-func buildContext(convID string, start int, user string) []providers.SimpleMessage {
+func buildContext(ctx context.Context, convID string, start int, user string, model string) []providers.SimpleMessage {
+	ctx, span := tracing.Start(ctx, "chat.context", attribute.String("conversation", convID))
+	defer span.End()
 	var convMessages = getAllConversationMessages(convID, user) // todo: cache or something
 	var path []int
 	var current = start
@@ -72,20 +90,33 @@ func buildContext(convID string, start int, user string) []providers.SimpleMessa
 
 	systemPrompt, _ := settings.Get("systemPrompt", user)
 	appendDateFlag, _ := settings.Get("appendDateToSystemPrompt", user)
+	appendProfileFlag, _ := settings.Get("appendProfileToSystemPrompt", user)
 	appendPlatformFlag, _ := settings.Get("appendPlatformInstructions", user)
 
-	// Append date and/or platform instructions based on user settings
+	// Append date, profile and/or platform instructions based on user settings
 	finalSystemPrompt := "<user_instructions>\n\n" + systemPrompt + "\n\n</user_instructions>"
+	if appendProfileFlag == "true" {
+		if profile, _ := settings.Get("userProfile", user); strings.TrimSpace(profile) != "" {
+			finalSystemPrompt += "\n\n<user_profile>\n\n" + strings.TrimSpace(profile) + "\n\n</user_profile>"
+		}
+	}
 	if appendDateFlag == "true" {
-		finalSystemPrompt = "Current date: " + time.Now().Format("2006-01-02") + "\n\n" + finalSystemPrompt
+		finalSystemPrompt = currentDate(user, time.Now()) + "\n\n" + finalSystemPrompt
 	}
 	if appendPlatformFlag == "true" {
 		finalSystemPrompt += "\n\n" + platformInstructions
 	}
-	attachmentOcrOnly, _ := settings.Get("attachmentOcrOnly", user)
-	ocrOnly := attachmentOcrOnly == "true"
-	agenticRetrievalStr, _ := settings.Get("agenticDocumentRetrieval", user)
-	agenticRetrieval := agenticRetrievalStr == "true"
+	if memoryEnabled(convID, user) {
+		var query string
+		if msg, ok := convMessages[start]; ok {
+			query = msg.Content
+		}
+		if section := relevantMemories(query, user); section != "" {
+			finalSystemPrompt += "\n\n" + section
+		}
+	}
+	attach := newAttacher(convID, user, model)
+	toolFiles := toolCallFiles(path, convMessages, user)
 
 	var messages = []providers.SimpleMessage{
 		{
@@ -93,6 +124,7 @@ func buildContext(convID string, start int, user string) []providers.SimpleMessa
 			Content: finalSystemPrompt,
 		},
 	}
+	messages = append(messages, pinnedMessages(path, convMessages)...)
 
 	for i := len(path) - 1; i >= 0; i-- {
 		msg, ok := convMessages[path[i]]
@@ -117,7 +149,9 @@ func buildContext(convID string, start int, user string) []providers.SimpleMessa
 
 				// TODO: remove this temp hack
 				// swap to base64 instead of file id
-				tool.File = convertToolCallFileIDToBase64(tool.File, user)
+				if file, ok := toolFiles[tool.File]; ok {
+					tool.File = fileToBase64(file)
+				}
 
 				messages = append(messages, providers.SimpleMessage{
 					Role:     "tool",
@@ -127,46 +161,10 @@ func buildContext(convID string, start int, user string) []providers.SimpleMessa
 			continue
 		}
 
-		var imageURLs []string
-		var fileURLs []string
-		if ocrOnly {
-			// embed all content if ocrOnly (vision assistant) required
-			for _, att := range msg.Attachments {
-				msg.Content += embeddedAttachment(att)
-			}
-
-		} else {
-
-			// embed docs and encode the rest if agentic retrieval is on, otherwise just provide links to files
-			for _, att := range msg.Attachments {
-
-				if fs.IsRetrievableDoc(att.File.Type) && agenticRetrieval {
-					// content of first page, model will figure to use tools to get rest of content if needed
-					msg.Content += embeddedAttachment(att)
-					continue
-				}
-
-				file, err := os.ReadFile(att.File.Path)
-				if err != nil {
-					log.Error("Error reading attachment file", "err", err)
-					continue
-				}
-
-				// Strip any parameters from the mime type (e.g., ;charset=utf-8)
-				mimeType := strings.Split(att.File.Type, ";")[0]
-				b64url := "data:" + strings.ReplaceAll(mimeType, " ", "") + ";base64," + toBase64(file)
-				log.Debug("Converted attachment to base64", "b64url", b64url[:50]+"...")
-				if strings.HasPrefix(att.File.Type, "image/") {
-					imageURLs = append(imageURLs, b64url)
-				} else {
-					fileURLs = append(fileURLs, b64url)
-				}
-			}
-		}
-
+		text, imageURLs, fileURLs := attach.parts(ctx, msg.Attachments)
 		messages = append(messages, providers.SimpleMessage{
 			Role:    msg.Role,
-			Content: msg.Content,
+			Content: msg.Content + text,
 			Images:  imageURLs,
 			Files:   fileURLs,
 		})
@@ -176,6 +174,97 @@ func buildContext(convID string, start int, user string) []providers.SimpleMessa
 	return messages
 }
 
+// attacher turns the attachments of a message into what is sent to the
+// model, following the attachment settings of the user. Every path that
+// builds a context goes through it, so a retried or continued answer sees
+// the same attachments as the first one.
+type attacher struct {
+	convID           string
+	user             string
+	ocrOnly          bool
+	agenticRetrieval bool
+	vision           bool
+}
+
+func newAttacher(convID string, user string, model string) attacher {
+	ocrOnly, _ := settings.Get("attachmentOcrOnly", user)
+	agenticRetrieval, _ := settings.Get("agenticDocumentRetrieval", user)
+	return attacher{
+		convID:           convID,
+		user:             user,
+		ocrOnly:          ocrOnly == "true",
+		agenticRetrieval: agenticRetrieval == "true",
+		vision:           models.SupportsVision(model, user),
+	}
+}
+
+// parts returns the text to append to the message content and the data
+// URLs of the images and files to send along with it.
+func (a attacher) parts(ctx context.Context, attachments []fs.Attachment) (text string, imageURLs []string, fileURLs []string) {
+	for _, att := range attachments {
+		if a.ocrOnly {
+			// embed all content if ocrOnly (vision assistant) required,
+			// extracting it now when the upload job has not run yet
+			text += embeddedAttachment(ocrFallback(ctx, a.convID, att, a.user))
+			continue
+		}
+
+		if fs.IsRetrievableDoc(att.File.Type) && a.agenticRetrieval {
+			// content of first page, model will figure to use tools to get rest of content if needed
+			text += embeddedAttachment(att)
+			continue
+		}
+
+		isImage := strings.HasPrefix(att.File.Type, "image/")
+		if isImage && !a.vision {
+			// the model cannot see images, send the extracted text instead
+			text += embeddedAttachment(ocrFallback(ctx, a.convID, att, a.user))
+			continue
+		}
+
+		file, err := os.ReadFile(att.File.Path)
+		if err != nil {
+			log.Error("Error reading attachment file", "err", err)
+			continue
+		}
+
+		// Strip any parameters from the mime type (e.g., ;charset=utf-8)
+		mimeType := strings.Split(att.File.Type, ";")[0]
+		if isImage {
+			file, mimeType, err = fs.DownscaleImage(file, mimeType, fs.MaxImageDimension)
+			if err != nil {
+				log.Warn("Could not downscale image, sending original", "file", att.File.ID, "err", err)
+			}
+		}
+		b64url := "data:" + strings.ReplaceAll(mimeType, " ", "") + ";base64," + toBase64(file)
+		log.Debug("Converted attachment to base64", "file", att.File.ID, "type", mimeType, "size", len(file))
+		if isImage {
+			imageURLs = append(imageURLs, b64url)
+		} else {
+			fileURLs = append(fileURLs, b64url)
+		}
+	}
+	return text, imageURLs, fileURLs
+}
+
+// pinnedMessages returns the text of the pinned messages that are not on
+// the path, oldest first, so key instructions from other branches still
+// reach the model. Pinned messages on the path stay in place.
+func pinnedMessages(path []int, convMessages map[int]*Message) []providers.SimpleMessage {
+	var ids []int
+	for id, msg := range convMessages {
+		if msg.Pinned && msg.Content != "" && !slices.Contains(path, id) && (msg.Role == "user" || msg.Role == "assistant") {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	pinned := make([]providers.SimpleMessage, 0, len(ids))
+	for _, id := range ids {
+		pinned = append(pinned, providers.SimpleMessage{Role: convMessages[id].Role, Content: convMessages[id].Content})
+	}
+	return pinned
+}
+
 func convertToolCallFileIDToBase64(f, user string) string {
 	if f != "" {
 		file, err := files.GetByIDs([]string{f}, user)
@@ -184,13 +273,7 @@ func convertToolCallFileIDToBase64(f, user string) string {
 		}
 
 		if len(file) > 0 {
-			data, err := os.ReadFile(file[0].Path)
-			if err != nil {
-				log.Error("Error reading tool call file", "err", err)
-			} else {
-				mimeType := strings.Split(file[0].Type, ";")[0]
-				f = "data:" + strings.ReplaceAll(mimeType, " ", "") + ";base64," + toBase64(data)
-			}
+			f = fileToBase64(file[0])
 		}
 	}
 
@@ -198,6 +281,44 @@ func convertToolCallFileIDToBase64(f, user string) string {
 
 }
 
+// toolCallFiles loads the files of all tool calls on a context path at
+// once, keyed by file ID.
+func toolCallFiles(path []int, convMessages map[int]*Message, user string) map[string]fs.File {
+	var ids []string
+	for _, id := range path {
+		for _, tool := range convMessages[id].Tools {
+			if tool.File != "" {
+				ids = append(ids, tool.File)
+			}
+		}
+	}
+
+	byID := make(map[string]fs.File, len(ids))
+	if len(ids) == 0 {
+		return byID
+	}
+	found, err := files.GetByIDs(ids, user)
+	if err != nil {
+		log.Error("Error fetching tool call files", "err", err)
+		return byID
+	}
+	for _, file := range found {
+		byID[file.ID] = file
+	}
+	return byID
+}
+
+// fileToBase64 returns the file as a data URL, or its ID when it cannot be read.
+func fileToBase64(file fs.File) string {
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		log.Error("Error reading tool call file", "err", err)
+		return file.ID
+	}
+	mimeType := strings.Split(file.Type, ";")[0]
+	return "data:" + strings.ReplaceAll(mimeType, " ", "") + ";base64," + toBase64(data)
+}
+
 func enterAgentLoop(
 	calls []providers.ToolCall,
 	providerParams providers.RequestParams,
@@ -205,6 +326,20 @@ func enterAgentLoop(
 	convID, user string,
 	sc utils.StreamClient,
 ) (*providers.ChatCompletionMessage, error) {
+	return runToolCalls(calls, providerParams, responseMessage, convID, user, sc, newToolBudget())
+}
+
+// runToolCalls runs one round of tool calls and continues the answer with
+// their results, as long as the model asks for tools and budget lasts.
+func runToolCalls(
+	calls []providers.ToolCall,
+	providerParams providers.RequestParams,
+	responseMessage *Message,
+	convID, user string,
+	sc utils.StreamClient,
+	budget *toolBudget,
+) (*providers.ChatCompletionMessage, error) {
+	budget.rounds++
 	for i, toolCall := range calls {
 
 		assistantMsg := providers.SimpleMessage{
@@ -221,9 +356,14 @@ func enterAgentLoop(
 		toolCall.MessageID = responseMessage.ID
 		toolCall.ConvID = convID
 
-		result := tools.ExecuteMCPTool(toolCall, user, convID)
+		started := time.Now()
+		result := tools.ExecuteMCPTool(requestContext(sc), toolCall, user, convID)
+		budget.spent += time.Since(started)
 		toolCall.Output = result.Content
 		toolCall.File = result.File
+		toolCall.OutputType = result.Type
+		toolCall.Code = result.Code
+		publishToolFailed(user, toolCall)
 
 		utils.SendStreamChunk(sc, utils.StreamChunk{
 			Type:    utils.TOOL_CALL,
@@ -233,6 +373,8 @@ func enterAgentLoop(
 		err := toolCalls.Save(&toolCall)
 		if err != nil {
 			log.Error("Error saving tool call output", "err", err)
+		} else {
+			messageCache.saveToolCall(&toolCall)
 		}
 
 		// Append tool result message to context for continued completion
@@ -261,12 +403,13 @@ func enterAgentLoop(
 		})
 	}
 
-	completion, err := provider.SendChatCompletionStreamRequest(providerParams, sc)
+	completion, err := streamCompletion(convID, providerParams, sc)
 	if err != nil {
 		log.Error("Error streaming chat completion after tool call", "err", err)
 		utils.SendStreamChunk(sc, utils.StreamChunk{
 			Type:    utils.EVENT_ERROR,
 			Payload: err.Error(),
+			Code:    apierr.CodeOf(err),
 		})
 		return completion, err
 	}
@@ -289,23 +432,95 @@ func enterAgentLoop(
 	}
 
 	calls = completion.ToolCalls
-	if len(calls) > 0 {
-		return enterAgentLoop(calls, providerParams, responseMessage, convID, user, sc)
+	if len(calls) > 0 && !sc.Gone() {
+		if reason := budget.exceeded(); reason != "" {
+			return finishWithoutTools(reason, budget, providerParams, responseMessage, convID, sc)
+		}
+		return runToolCalls(calls, providerParams, responseMessage, convID, user, sc, budget)
 	}
 
 	return completion, err
 }
 
+// completionStatus is the status a streamed message ends with, given the
+// last completion of its answer: "interrupted" when the client disconnected
+// before the answer was finished, "stopped" when the user stopped it and
+// "error" when it failed.
+func completionStatus(sc utils.StreamClient, msg *Message, completion *providers.ChatCompletionMessage) string {
+	switch {
+	case sc.Gone():
+		log.Info("Client disconnected, saving partial response", "messageID", msg.ID)
+		return StatusInterrupted
+	case completion != nil && completion.Stopped:
+		return StatusStopped
+	case msg.Error != "":
+		return StatusError
+	}
+	return StatusCompleted
+}
+
+// markStreaming returns a StreamClient.OnOutput hook that marks the message
+// streaming when the first chunk of the answer arrives, so the other
+// sessions can tell it from an answer still waiting for the provider.
+func markStreaming(user string, sessionID string, msg *Message) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if msg.ID <= 0 {
+				return
+			}
+			msg.Status = StatusStreaming
+			updated, err := updateMessage(msg.ID, user, *msg)
+			if err != nil {
+				log.Error("Error marking message streaming", "messageID", msg.ID, "err", err)
+				return
+			}
+			syncManager.Broadcast(user, sessionID, SyncEvent{
+				Type:           EventMessageUpdated,
+				ConversationID: updated.ConvID,
+				MessageID:      updated.ID,
+				Message:        updated,
+			})
+		})
+	}
+}
+
 func toBase64(data []byte) string {
 	return base64.StdEncoding.EncodeToString(data)
 }
 
+// ocrFallback makes sure an attachment carries its text content, running
+// OCR once when it was never extracted.
+func ocrFallback(ctx context.Context, convID string, att fs.Attachment, user string) fs.Attachment {
+	if att.File.Content != "" {
+		return att
+	}
+	content, err := fs.ExtractContent(ctx, att.File, user)
+	if err != nil {
+		log.Error("Error extracting attachment content", "file", att.File.ID, "err", err)
+		if strings.HasPrefix(att.File.Type, "image/") {
+			att.File.Content = "(image could not be read, the selected model does not support images)"
+		} else {
+			att.File.Content = "(file could not be read)"
+		}
+		return att
+	}
+	att.File.Content = content
+	messageCache.setFileContent(convID, att.File.ID, content)
+	return att
+}
+
 func embeddedAttachment(att fs.Attachment) string {
+	var description string
+	if att.File.Description != "" {
+		description = "description: " + att.File.Description + "\n"
+	}
 	return "\n\n" +
 		"[user attachment: \n" +
 		"id: " + att.File.ID + "\n" +
 		"name: " + att.File.Name + "\n" +
 		"type: " + att.File.Type + "\n" +
+		description +
 		"content: " + att.File.Content + "\n]\n"
 }
 
@@ -323,3 +538,53 @@ func toOpenAITools(tool []*tools.Tool) []openai.ChatCompletionToolUnionParam {
 
 	return result
 }
+
+func memoryEnabled(convID string, user string) bool {
+	conv, err := conversations.GetByID(convID, user)
+	return err == nil && conv.MemoryEnabled
+}
+
+// knowledgeAttached reports whether a knowledge base is attached to the
+// conversation.
+func knowledgeAttached(convID string) bool {
+	var attached bool
+	err := data.QueryRow(data.DB, `SELECT EXISTS(SELECT 1 FROM ConversationKnowledge WHERE conv_id = ?)`, convID).Scan(&attached)
+	return err == nil && attached
+}
+
+func relevantMemories(query string, user string) string {
+	all, err := memories.GetAll(user)
+	if err != nil {
+		log.Error("Error loading memories", "err", err)
+		return ""
+	}
+	return memory.Prompt(memory.Relevant(all, query, memory.MaxContextMemories))
+}
+
+// availableTools returns the enabled tools for a conversation, the remember
+// tool is dropped when the conversation opted out of memory,
+// search_history unless the user turned on historySearch and
+// search_knowledge unless a knowledge base is attached.
+func availableTools(convID string, user string) []openai.ChatCompletionToolUnionParam {
+	enabled := tools.GetAvailableTools(user)
+	withMemory := memoryEnabled(convID, user)
+	withHistory := historySearchEnabled(user)
+	withKnowledge := knowledgeAttached(convID)
+	filtered := make([]*tools.Tool, 0, len(enabled))
+	for _, t := range enabled {
+		if (t.Name == "remember" && !withMemory) || (t.Name == "search_history" && !withHistory) ||
+			(t.Name == "search_knowledge" && !withKnowledge) {
+			continue
+		}
+		filtered = append(filtered, t)
+	}
+	enabled = filtered
+	return toOpenAITools(enabled)
+}
+
+func validateSamplingParams(params *providers.SamplingParams) error {
+	if params == nil {
+		return nil
+	}
+	return params.Validate()
+}
@@ -0,0 +1,55 @@
+package chat
+
+import (
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/webhooks"
+)
+
+type MessageCompletedData struct {
+	ConversationID string   `json:"conversationId"`
+	Message        *Message `json:"message"`
+}
+
+type ToolFailedData struct {
+	ConversationID string      `json:"conversationId"`
+	MessageID      int         `json:"messageId"`
+	Tool           string      `json:"tool"`
+	Args           string      `json:"args,omitempty"`
+	Output         string      `json:"output,omitempty"`
+	Code           apierr.Code `json:"code"`
+}
+
+// publishOnSync is a sync hook that forwards new conversations, however
+// they were created, to the user's webhooks.
+func publishOnSync(userID string, event SyncEvent) {
+	if event.Type == EventConversationCreated && event.Conversation != nil {
+		webhooks.Publish(userID, webhooks.EventConversationCreated, event.Conversation)
+	}
+}
+
+// publishMessageCompleted notifies webhooks of a finished response.
+// Interrupted responses are skipped, they can still be continued.
+func publishMessageCompleted(user string, msg *Message) {
+	if msg.Status != StatusCompleted {
+		return
+	}
+	webhooks.Publish(user, webhooks.EventMessageCompleted, MessageCompletedData{
+		ConversationID: msg.ConvID,
+		Message:        msg,
+	})
+}
+
+func publishToolFailed(user string, toolCall providers.ToolCall) {
+	if toolCall.Code == "" {
+		return
+	}
+	webhooks.Publish(user, webhooks.EventToolFailed, ToolFailedData{
+		ConversationID: toolCall.ConvID,
+		MessageID:      toolCall.MessageID,
+		Tool:           toolCall.Name,
+		Args:           toolCall.Args,
+		Output:         toolCall.Output,
+		Code:           toolCall.Code,
+	})
+}
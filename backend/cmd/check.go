@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/mail"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+)
+
+const (
+	databaseFile = "./data/ai-ui.db"
+	uploadDir    = "./data/resources"
+	checkTimeout = 15 * time.Second
+)
+
+// checkResult is one line of the --check report.
+type checkResult struct {
+	name   string
+	detail string
+	err    error
+}
+
+// runCheck validates the environment, the database, the upload directory
+// and the providers without starting the server or changing anything,
+// prints a report to out and returns the exit code: 1 when a check failed.
+func runCheck(out io.Writer) int {
+	var results []checkResult
+	results = append(results, checkEnv()...)
+
+	db, dbResult := checkDatabase()
+	results = append(results, dbResult)
+	results = append(results, checkUploadDir())
+
+	if db != nil {
+		defer db.Close()
+		config.Setup(log, db)
+		providers.SetupProviderClient(log, db)
+		results = append(results, checkProviders()...)
+	}
+
+	failed := 0
+	for _, r := range results {
+		status := "ok  "
+		detail := r.detail
+		if r.err != nil {
+			status = "FAIL"
+			detail = r.err.Error()
+			failed++
+		}
+		fmt.Fprintf(out, "%s  %-24s %s\n", status, r.name, detail)
+	}
+	if failed > 0 {
+		fmt.Fprintf(out, "%d of %d checks failed\n", failed, len(results))
+		return 1
+	}
+	fmt.Fprintf(out, "all %d checks passed\n", len(results))
+	return 0
+}
+
+func checkEnv() []checkResult {
+	var results []checkResult
+	for _, e := range config.CheckEnv() {
+		results = append(results, checkResult{name: "env " + e.Key, err: errors.New(e.Message)})
+	}
+	if _, err := loadTLSSetup(); err != nil {
+		results = append(results, checkResult{name: "env TLS", err: err})
+	}
+	if err := mail.CheckEnv(); err != nil {
+		results = append(results, checkResult{name: "env SMTP", err: err})
+	}
+	if len(results) == 0 {
+		results = append(results, checkResult{name: "environment", detail: "valid"})
+	}
+	return results
+}
+
+// checkDatabase opens the database read-only. A database older than this
+// build is fine, the migrations run on start, a newer one is not.
+func checkDatabase() (*sql.DB, checkResult) {
+	result := checkResult{name: "database"}
+	db, err := data.OpenReadOnly(databaseFile)
+	if errors.Is(err, os.ErrNotExist) {
+		result.detail = "not created yet, it is set up on first start"
+		return nil, result
+	}
+	if err != nil {
+		result.err = fmt.Errorf("cannot open %s: %w", databaseFile, err)
+		return nil, result
+	}
+
+	version, err := data.UserVersion(db)
+	switch {
+	case err != nil:
+		result.err = fmt.Errorf("cannot read the schema version: %w", err)
+	case version > data.SchemaVersion:
+		result.err = fmt.Errorf("schema v%d is newer than this build (v%d)", version, data.SchemaVersion)
+	case version < data.SchemaVersion:
+		result.detail = fmt.Sprintf("schema v%d, migrated to v%d on start", version, data.SchemaVersion)
+	default:
+		result.detail = fmt.Sprintf("schema v%d", version)
+	}
+	if result.err != nil {
+		_ = db.Close()
+		return nil, result
+	}
+	return db, result
+}
+
+// checkUploadDir writes and removes a file where uploads are stored.
+func checkUploadDir() checkResult {
+	result := checkResult{name: "upload directory", detail: uploadDir + " is writable"}
+	if err := os.MkdirAll(uploadDir, 0o755); err != nil {
+		result.err = err
+		return result
+	}
+	probe, err := os.CreateTemp(uploadDir, ".check-*")
+	if err != nil {
+		result.err = err
+		return result
+	}
+	_ = probe.Close()
+	if err := os.Remove(probe.Name()); err != nil {
+		result.err = err
+	}
+	return result
+}
+
+func checkProviders() []checkResult {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+
+	reached, err := providers.CheckReachable(ctx)
+	if err != nil {
+		return []checkResult{{name: "providers", err: err}}
+	}
+	if len(reached) == 0 {
+		return []checkResult{{name: "providers", detail: "none configured"}}
+	}
+	results := make([]checkResult, 0, len(reached))
+	for _, r := range reached {
+		result := checkResult{name: "provider " + r.ProviderID, detail: r.BaseURL + " reachable"}
+		if r.Err != nil {
+			result.err = fmt.Errorf("%s: %w", r.BaseURL, r.Err)
+		}
+		results = append(results, result)
+	}
+	return results
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/account"
+	"github.com/Bajahaw/ai-ui/cmd/admin"
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
+
+// cliCommand is a subcommand of the binary. The admin commands work on the
+// database directly, so they still help when the web UI is unreachable or
+// logging in is broken.
+type cliCommand struct {
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+// commandOrder is the order of the help text.
+var commandOrder = []string{"serve", "check", "migrate", "create-user", "reset-password", "backup", "restore", "export-conversation"}
+
+var commands = map[string]cliCommand{
+	"serve": {
+		usage:   "serve",
+		summary: "Run the server, the default",
+		run:     func([]string) error { serve(); return nil },
+	},
+	"check": {
+		usage:   "check",
+		summary: "Validate the configuration, database, upload directory and providers",
+		run:     checkCommand,
+	},
+	"migrate": {
+		usage:   "migrate",
+		summary: "Create the database or bring its schema up to date",
+		run:     migrateCommand,
+	},
+	"create-user": {
+		usage:   "create-user [-admin] <username>",
+		summary: "Add a user, the password is read from standard input",
+		run:     createUserCommand,
+	},
+	"reset-password": {
+		usage:   "reset-password [-reset-2fa] <username>",
+		summary: "Set a new password, read from standard input",
+		run:     resetPasswordCommand,
+	},
+	"backup": {
+		usage:   "backup",
+		summary: "Write a database snapshot to BACKUP_DIR or the BACKUP_S3_* bucket",
+		run:     backupCommand,
+	},
+	"restore": {
+		usage:   "restore <file>",
+		summary: "Replace the database with a snapshot, the server must be stopped",
+		run:     restoreCommand,
+	},
+	"export-conversation": {
+		usage:   "export-conversation [-o file] <id>",
+		summary: "Write a conversation and its messages as JSON",
+		run:     exportConversationCommand,
+	},
+}
+
+// errUsage is returned for wrong arguments, the usage of the command is
+// printed instead of the error.
+var errUsage = errors.New("usage")
+
+// errFailed ends a command that already reported why it failed.
+var errFailed = errors.New("failed")
+
+// command splits the arguments into the command and its arguments, serve
+// when none is given. --check is kept for older deploy scripts.
+func command(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "serve", nil
+	}
+	switch args[0] {
+	case "--check":
+		return "check", args[1:]
+	case "-h", "--help":
+		return "help", args[1:]
+	}
+	return args[0], args[1:]
+}
+
+// runCommand runs a command and returns the exit code.
+func runCommand(name string, args []string) int {
+	cmd, ok := commands[name]
+	if !ok {
+		if name != "help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		}
+		printUsage(os.Stderr)
+		if name == "help" {
+			return 0
+		}
+		return 2
+	}
+
+	err := cmd.run(args)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(os.Stderr, "usage: ai-ui %s\n", cmd.usage)
+		return 2
+	case errors.Is(err, errFailed):
+		return 1
+	default:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 1
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: ai-ui [command]")
+	fmt.Fprintln(w)
+	for _, name := range commandOrder {
+		cmd := commands[name]
+		fmt.Fprintf(w, "  %-38s %s\n", cmd.usage, cmd.summary)
+	}
+}
+
+// parseFlags parses the flags of a command, which must be followed by
+// exactly n arguments.
+func parseFlags(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil || fs.NArg() != n {
+		return nil, errUsage
+	}
+	return fs.Args(), nil
+}
+
+// readPassword reads the first line of standard input, so the password
+// stays out of the shell history and process list.
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func checkCommand(args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	if runCheck(os.Stdout) != 0 {
+		return errFailed
+	}
+	return nil
+}
+
+func migrateCommand(args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	startDataSource()
+	version, err := data.UserVersion(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("database is at schema v%d\n", version)
+	return nil
+}
+
+func createUserCommand(args []string) error {
+	fs := flag.NewFlagSet("create-user", flag.ContinueOnError)
+	admin := fs.Bool("admin", false, "make the user an admin")
+	rest, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	username := rest[0]
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	// the sign up hooks give the user default settings, tools and providers
+	startDataSource()
+	setupConfig()
+	setupAudit()
+	setupAuth()
+	setupProviderClient()
+	setupSettings()
+	setupTools()
+	setupProvision()
+
+	if err := auth.CreateUser(username, password); err != nil {
+		return err
+	}
+	if *admin {
+		if err := auth.SetRole(username, auth.RoleAdmin); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("created user %s\n", username)
+	return nil
+}
+
+func resetPasswordCommand(args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	resetTwoFactor := fs.Bool("reset-2fa", false, "also turn off two-factor authentication")
+	rest, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	startDataSource()
+	setupAuth()
+	if err := auth.SetPassword(rest[0], password, *resetTwoFactor); err != nil {
+		return err
+	}
+	fmt.Printf("password of %s changed\n", rest[0])
+	return nil
+}
+
+func backupCommand(args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+	startDataSource()
+	admin.SetupAdmin(log, db)
+	info, err := admin.RunBackup()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s (%d bytes)\n", info.Name, info.Size)
+	return nil
+}
+
+func restoreCommand(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	previous, err := data.Restore(databaseFile, args[0])
+	if err != nil {
+		return err
+	}
+	if previous != "" {
+		fmt.Printf("previous database kept as %s\n", previous)
+	}
+	// a snapshot of an older version is migrated right away
+	startDataSource()
+	fmt.Printf("restored %s\n", args[0])
+	return nil
+}
+
+func exportConversationCommand(args []string) error {
+	fs := flag.NewFlagSet("export-conversation", flag.ContinueOnError)
+	output := fs.String("o", "", "write to a file instead of standard output")
+	rest, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	startDataSource()
+	account.SetupAccount(log, db)
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	err = account.ExportConversation(w, rest[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("conversation %q not found", rest[0])
+	}
+	return err
+}
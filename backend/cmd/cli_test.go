@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestCommand(t *testing.T) {
+	cases := []struct {
+		args []string
+		name string
+		rest int
+	}{
+		{nil, "serve", 0},
+		{[]string{"--check"}, "check", 0},
+		{[]string{"--help"}, "help", 0},
+		{[]string{"create-user", "-admin", "alice"}, "create-user", 2},
+	}
+	for _, tc := range cases {
+		name, rest := command(tc.args)
+		if name != tc.name || len(rest) != tc.rest {
+			t.Errorf("command(%q) = %q %q", tc.args, name, rest)
+		}
+	}
+}
+
+func TestRunCommandUsage(t *testing.T) {
+	if code := runCommand("bogus", nil); code != 2 {
+		t.Errorf("unknown command exit code = %d, want 2", code)
+	}
+	if code := runCommand("help", nil); code != 0 {
+		t.Errorf("help exit code = %d, want 0", code)
+	}
+	// wrong arguments fail before touching the database
+	if code := runCommand("create-user", nil); code != 2 {
+		t.Errorf("create-user without a name exit code = %d, want 2", code)
+	}
+	if code := runCommand("restore", []string{"a", "b"}); code != 2 {
+		t.Errorf("restore with two files exit code = %d, want 2", code)
+	}
+}
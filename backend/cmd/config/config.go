@@ -0,0 +1,584 @@
+// Package config holds the instance wide options an admin can change at
+// runtime. Each option reads, in order, the value stored by an admin, its
+// environment variable and its built-in default. Values are read on use,
+// so changes apply without a restart.
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/charmbracelet/log"
+)
+
+type Type string
+
+const (
+	TypeText     Type = "text"
+	TypeInteger  Type = "integer"
+	TypeDuration Type = "duration"
+	// TypeList is a comma separated list.
+	TypeList Type = "list"
+)
+
+const (
+	SourceDefault = "default"
+	SourceEnv     = "env"
+	SourceAdmin   = "admin"
+)
+
+type Definition struct {
+	Key         string `json:"key"`
+	Type        Type   `json:"type"`
+	Default     string `json:"default"`
+	Env         string `json:"env,omitempty"`
+	Min         int64  `json:"min,omitempty"`
+	Description string `json:"description"`
+	// AllowZero accepts a zero duration, which turns the feature off.
+	AllowZero bool `json:"allowZero,omitempty"`
+	// check validates values beyond their type.
+	check func(string) error
+}
+
+// Registry lists every option. Keys that are not registered here are
+// rejected on update.
+var Registry = []Definition{
+	{
+		Key:         "maxBodySize",
+		Type:        TypeInteger,
+		Default:     strconv.Itoa(10 << 20),
+		Env:         "MAX_BODY_SIZE",
+		Min:         1 << 10,
+		Description: "Largest JSON request body in bytes",
+	},
+	{
+		Key:         "maxUploadSize",
+		Type:        TypeInteger,
+		Default:     strconv.Itoa(100 << 20),
+		Env:         "MAX_UPLOAD_SIZE",
+		Min:         1 << 10,
+		Description: "Largest uploaded file in bytes",
+	},
+	{
+		Key:         "corsOrigins",
+		Type:        TypeList,
+		Env:         "CORS_ORIGINS",
+		Description: "Origins allowed to call the API from a browser, e.g. https://chat.example.com",
+	},
+	{
+		Key:         "providerConnectTimeout",
+		Type:        TypeDuration,
+		Default:     "30s",
+		Env:         "PROVIDER_CONNECT_TIMEOUT",
+		Description: "Default time to connect to a provider",
+	},
+	{
+		Key:         "providerReadTimeout",
+		Type:        TypeDuration,
+		Default:     "5m",
+		Env:         "PROVIDER_READ_TIMEOUT",
+		Description: "Default longest wait for the next part of a streamed response",
+	},
+	{
+		Key:         "providerTotalTimeout",
+		Type:        TypeDuration,
+		Default:     "30m",
+		Env:         "PROVIDER_TOTAL_TIMEOUT",
+		Description: "Default longest time for a whole response",
+	},
+	{
+		Key:         "completionCacheTTL",
+		Type:        TypeDuration,
+		Default:     "24h",
+		Env:         "COMPLETION_CACHE_TTL",
+		AllowZero:   true,
+		Description: "How long cached completions are reused, 0 turns the cache off",
+	},
+	{
+		Key:         "requestLogRetention",
+		Type:        TypeDuration,
+		Default:     "0s",
+		Env:         "REQUEST_LOG_RETENTION",
+		AllowZero:   true,
+		Description: "How long raw requests to providers and their responses are logged for debugging, 0 turns logging off",
+	},
+	{
+		Key:         "requestLogMaxEntries",
+		Type:        TypeInteger,
+		Default:     "1000",
+		Env:         "REQUEST_LOG_MAX_ENTRIES",
+		Min:         1,
+		Description: "Most logged provider requests kept, older ones are dropped first",
+	},
+	{
+		Key:         "jobRetention",
+		Type:        TypeDuration,
+		Default:     "168h",
+		Env:         "JOB_RETENTION",
+		Description: "How long finished background jobs are listed before they are deleted",
+	},
+	{
+		Key:         "usageRetention",
+		Type:        TypeDuration,
+		Default:     "720h",
+		Env:         "USAGE_RETENTION",
+		Description: "How long raw usage records are kept after they are rolled into daily summaries",
+	},
+	{
+		Key:         "conversationArchiveDays",
+		Type:        TypeInteger,
+		Default:     "0",
+		Env:         "CONVERSATION_ARCHIVE_DAYS",
+		Description: "Days after their last message unpinned conversations are archived, 0 never archives them",
+	},
+	{
+		Key:         "conversationDeleteDays",
+		Type:        TypeInteger,
+		Default:     "0",
+		Env:         "CONVERSATION_DELETE_DAYS",
+		Description: "Days after their last message unpinned conversations are deleted, 0 never deletes them",
+	},
+	{
+		Key:         "fileRetentionDays",
+		Type:        TypeInteger,
+		Default:     "0",
+		Env:         "FILE_RETENTION_DAYS",
+		Description: "Days after their upload files are deleted unless they are in a knowledge base or a pinned conversation, 0 keeps them",
+	},
+	{
+		Key:         "idempotencyKeyTTL",
+		Type:        TypeDuration,
+		Default:     "24h",
+		Env:         "IDEMPOTENCY_KEY_TTL",
+		Description: "How long the response to a request with an Idempotency-Key is replayed to retries",
+	},
+	{
+		Key:         "batchConcurrency",
+		Type:        TypeInteger,
+		Default:     "4",
+		Env:         "BATCH_CONCURRENCY",
+		Min:         1,
+		Description: "Prompts of a batch sent to the model at once",
+	},
+	{
+		Key:         "maxToolIterations",
+		Type:        TypeInteger,
+		Default:     "10",
+		Env:         "MAX_TOOL_ITERATIONS",
+		Description: "Most rounds of tool calls in one answer before the model has to answer without tools, 0 removes the limit",
+	},
+	{
+		Key:         "maxToolTime",
+		Type:        TypeDuration,
+		Default:     "10m",
+		Env:         "MAX_TOOL_TIME",
+		AllowZero:   true,
+		Description: "Longest time the tools of one answer may take together before the model has to answer without them, 0 removes the limit",
+	},
+	{
+		Key:         "streamHeartbeatInterval",
+		Type:        TypeDuration,
+		Default:     "15s",
+		Env:         "STREAM_HEARTBEAT_INTERVAL",
+		Description: "How long a stream may stay silent, for example while a tool runs, before a comment is sent so proxies keep the connection open",
+	},
+	{
+		Key:         "streamFlushInterval",
+		Type:        TypeDuration,
+		Default:     "0",
+		Env:         "STREAM_FLUSH_INTERVAL",
+		AllowZero:   true,
+		Description: "How long streamed text is collected before it is sent as one chunk, such as 20ms, 0 sends every token on its own",
+	},
+	{
+		Key:         "streamFlushBytes",
+		Type:        TypeInteger,
+		Default:     "4096",
+		Env:         "STREAM_FLUSH_BYTES",
+		Description: "Collected streamed text in bytes that is sent at once without waiting for the flush interval, 0 removes the limit",
+	},
+	{
+		Key:         "pluginTimeout",
+		Type:        TypeDuration,
+		Default:     "1m",
+		Env:         "PLUGIN_TIMEOUT",
+		Description: "Longest time a tool of a plugin runs before it is stopped",
+	},
+	{
+		Key:         "trustedProxies",
+		Type:        TypeList,
+		Env:         "TRUSTED_PROXIES",
+		Description: "IPs or CIDR ranges of reverse proxies whose X-Forwarded-* headers are honored",
+		check:       checkCIDRs,
+	},
+	{
+		Key:         "publicURL",
+		Type:        TypeText,
+		Env:         "PUBLIC_URL",
+		Description: "URL the instance is reached at, e.g. https://chat.example.com, used instead of the request host",
+		check:       checkURL,
+	},
+	{
+		Key:         "defaultModel",
+		Type:        TypeText,
+		Env:         "DEFAULT_MODEL",
+		Description: "Model selected for new users",
+	},
+	{
+		Key:         "maxConcurrentGenerations",
+		Type:        TypeInteger,
+		Default:     "3",
+		Env:         "MAX_CONCURRENT_GENERATIONS",
+		Description: "Most responses a user can generate at the same time, 0 removes the limit",
+	},
+	{
+		Key:         "realtimeTranscriptionModel",
+		Type:        TypeText,
+		Default:     "whisper-1",
+		Env:         "REALTIME_TRANSCRIPTION_MODEL",
+		Description: "Model the realtime API transcribes voice input with, the transcripts are saved as messages",
+	},
+	{
+		Key:         "emailDigestMinDuration",
+		Type:        TypeDuration,
+		Default:     "1m",
+		Env:         "EMAIL_DIGEST_MIN_DURATION",
+		AllowZero:   true,
+		Description: "Shortest generation that is emailed to users who opted in, when it finishes while they are away",
+	},
+	{
+		Key:         "emailDigestDelay",
+		Type:        TypeDuration,
+		Default:     "10m",
+		Env:         "EMAIL_DIGEST_DELAY",
+		AllowZero:   true,
+		Description: "How long results are collected before they are emailed together in one digest",
+	},
+	{
+		Key:         "moderationRules",
+		Type:        TypeList,
+		Env:         "MODERATION_RULES",
+		Description: "Words or phrases that flag a message or answer, case insensitive",
+	},
+	{
+		Key:         "moderationModel",
+		Type:        TypeText,
+		Env:         "MODERATION_MODEL",
+		Description: "Model at moderationBaseURL that classifies messages and answers as safe or unsafe, e.g. llama-guard3",
+	},
+	{
+		Key:         "moderationBaseURL",
+		Type:        TypeText,
+		Env:         "MODERATION_BASE_URL",
+		Description: "OpenAI compatible API serving the moderation model, e.g. http://localhost:11434/v1",
+		check:       checkURL,
+	},
+	{
+		Key:         "moderationAction",
+		Type:        TypeText,
+		Default:     "annotate",
+		Env:         "MODERATION_ACTION",
+		Description: "What happens to flagged content: annotate marks it, block stops it",
+		check:       checkOneOf("annotate", "block"),
+	},
+	{
+		Key:         "outboundProxy",
+		Type:        TypeText,
+		Env:         "OUTBOUND_PROXY",
+		Description: "HTTP or SOCKS5 proxy for requests to providers and MCP servers, e.g. socks5://proxy:1080, empty uses HTTP_PROXY and HTTPS_PROXY",
+		check:       checkProxy,
+	},
+	{
+		Key:         "outboundAllowedNetworks",
+		Type:        TypeList,
+		Default:     "127.0.0.0/8,::1",
+		Env:         "OUTBOUND_ALLOWED_NETWORKS",
+		Description: "Private, loopback or link-local ranges that provider, MCP server and webhook URLs of users may reach, e.g. 192.168.1.0/24; the others are blocked",
+		check:       checkCIDRs,
+	},
+	{
+		Key:         "registration",
+		Type:        TypeText,
+		Default:     "invite",
+		Env:         "REGISTRATION",
+		Description: "Who may sign up: invite needs a code from an admin, open lets anyone, closed stops sign ups; the first user can always sign up",
+		check:       checkOneOf("open", "invite", "closed"),
+	},
+}
+
+type ValidationError struct {
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+// Entry is an option with its current value and where the value comes from.
+type Entry struct {
+	Definition
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+var log *logger.Logger
+var repo Repository
+
+var (
+	mu     sync.RWMutex
+	stored = make(map[string]string)
+)
+
+func Setup(l *logger.Logger, db *sql.DB) {
+	log = l
+	repo = NewRepository(db)
+
+	values, err := repo.GetAll()
+	if err != nil {
+		log.Error("Error loading admin config, using defaults", "err", err)
+		values = make(map[string]string)
+	}
+
+	mu.Lock()
+	stored = values
+	mu.Unlock()
+
+	for _, def := range Registry {
+		if v, source := lookup(def); source == SourceEnv {
+			if err := validate(def, v); err != nil {
+				log.Warn("Invalid environment value, using default", "env", def.Env, "err", err)
+			}
+		}
+	}
+}
+
+func definition(key string) (Definition, bool) {
+	for _, def := range Registry {
+		if def.Key == key {
+			return def, true
+		}
+	}
+	return Definition{}, false
+}
+
+func lookup(def Definition) (string, string) {
+	mu.RLock()
+	v, ok := stored[def.Key]
+	mu.RUnlock()
+	if ok {
+		return v, SourceAdmin
+	}
+	if def.Env != "" {
+		if v := os.Getenv(def.Env); v != "" {
+			return v, SourceEnv
+		}
+	}
+	return def.Default, SourceDefault
+}
+
+// Get returns the value of an option, falling back to its default when the
+// configured value is invalid.
+func Get(key string) string {
+	def, ok := definition(key)
+	if !ok {
+		panic("config: unknown key " + key)
+	}
+	v, _ := lookup(def)
+	if validate(def, v) != nil {
+		return def.Default
+	}
+	return v
+}
+
+func Int64(key string) int64 {
+	n, _ := strconv.ParseInt(Get(key), 10, 64)
+	return n
+}
+
+func Duration(key string) time.Duration {
+	d, _ := time.ParseDuration(Get(key))
+	return d
+}
+
+func List(key string) []string {
+	var items []string
+	for item := range strings.SplitSeq(Get(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Entries returns every option with its current value.
+func Entries() []Entry {
+	entries := make([]Entry, 0, len(Registry))
+	for _, def := range Registry {
+		v, source := lookup(def)
+		if validate(def, v) != nil {
+			v, source = def.Default, SourceDefault
+		}
+		entries = append(entries, Entry{Definition: def, Value: v, Source: source})
+	}
+	return entries
+}
+
+// Update stores the given values, a nil value removes the stored one so the
+// option goes back to its environment variable or default. Nothing is saved
+// unless every value is valid.
+func Update(changes map[string]*string) ([]ValidationError, error) {
+	if errs := Validate(changes); len(errs) > 0 {
+		return errs, nil
+	}
+
+	if err := repo.Save(changes); err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	for key, v := range changes {
+		if v == nil {
+			delete(stored, key)
+		} else {
+			stored[key] = *v
+		}
+	}
+	mu.Unlock()
+	return nil, nil
+}
+
+// CheckEnv validates the options set in the environment, keyed by
+// variable. Setup falls back to the defaults for these.
+func CheckEnv() []ValidationError {
+	var errs []ValidationError
+	for _, def := range Registry {
+		if def.Env == "" {
+			continue
+		}
+		if v := os.Getenv(def.Env); v != "" {
+			if err := validate(def, v); err != nil {
+				errs = append(errs, ValidationError{Key: def.Env, Message: err.Error()})
+			}
+		}
+	}
+	return errs
+}
+
+// Validate checks changes as Update does without storing them.
+func Validate(changes map[string]*string) []ValidationError {
+	var errs []ValidationError
+	for key, v := range changes {
+		def, ok := definition(key)
+		if !ok {
+			errs = append(errs, ValidationError{Key: key, Message: "unknown option"})
+			continue
+		}
+		if v == nil {
+			continue
+		}
+		if err := validate(def, *v); err != nil {
+			errs = append(errs, ValidationError{Key: key, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+func validate(def Definition, v string) error {
+	switch def.Type {
+	case TypeInteger:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		if n < def.Min {
+			return fmt.Errorf("must be at least %d", def.Min)
+		}
+	case TypeDuration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 30s or 5m")
+		}
+		if d < 0 || (d == 0 && !def.AllowZero) {
+			return fmt.Errorf("must be a positive duration")
+		}
+	case TypeText, TypeList:
+		if len(v) > 2000 {
+			return fmt.Errorf("must be at most 2000 characters")
+		}
+	}
+	if def.check != nil {
+		return def.check(v)
+	}
+	return nil
+}
+
+func checkCIDRs(v string) error {
+	for item := range strings.SplitSeq(v, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		if _, err := ParsePrefix(item); err != nil {
+			return fmt.Errorf("%q is not an IP or CIDR range", item)
+		}
+	}
+	return nil
+}
+
+func checkOneOf(options ...string) func(string) error {
+	return func(v string) error {
+		if !slices.Contains(options, v) {
+			return fmt.Errorf("must be one of %v", options)
+		}
+		return nil
+	}
+}
+
+func checkURL(v string) error {
+	if v == "" {
+		return nil
+	}
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("must be an http or https URL")
+	}
+	return nil
+}
+
+func checkProxy(v string) error {
+	if v == "" {
+		return nil
+	}
+	_, err := ParseProxy(v)
+	return err
+}
+
+// ParseProxy parses the URL of an outbound proxy, which Go's HTTP client
+// supports with the http, https, socks5 and socks5h schemes.
+func ParseProxy(v string) (*url.URL, error) {
+	u, err := url.Parse(v)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("must be a proxy URL such as http://proxy:3128 or socks5://proxy:1080")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	}
+	return nil, fmt.Errorf("proxy scheme must be http, https, socks5 or socks5h")
+}
+
+// ParsePrefix parses a CIDR range, or a single IP as a range of one address.
+func ParsePrefix(v string) (netip.Prefix, error) {
+	if strings.Contains(v, "/") {
+		return netip.ParsePrefix(v)
+	}
+	addr, err := netip.ParseAddr(v)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
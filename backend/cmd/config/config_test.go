@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	logger "github.com/charmbracelet/log"
+)
+
+func setupTest(t *testing.T) {
+	t.Helper()
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("InitDataSource: %v", err)
+	}
+	t.Cleanup(func() { data.DB.Close() })
+	Setup(logger.New(os.Stderr), data.DB)
+}
+
+func ptr(s string) *string { return &s }
+
+func TestPrecedence(t *testing.T) {
+	setupTest(t)
+
+	if got := Duration("providerReadTimeout"); got != 5*time.Minute {
+		t.Errorf("default: got %s", got)
+	}
+
+	t.Setenv("PROVIDER_READ_TIMEOUT", "2m")
+	if got := Duration("providerReadTimeout"); got != 2*time.Minute {
+		t.Errorf("env: got %s", got)
+	}
+
+	if errs, err := Update(map[string]*string{"providerReadTimeout": ptr("90s")}); err != nil || len(errs) > 0 {
+		t.Fatalf("update: %v %v", errs, err)
+	}
+	if got := Duration("providerReadTimeout"); got != 90*time.Second {
+		t.Errorf("admin value: got %s", got)
+	}
+
+	// stored values survive a restart
+	Setup(log, data.DB)
+	if got := Duration("providerReadTimeout"); got != 90*time.Second {
+		t.Errorf("after reload: got %s", got)
+	}
+
+	if _, err := Update(map[string]*string{"providerReadTimeout": nil}); err != nil {
+		t.Fatal(err)
+	}
+	if got := Duration("providerReadTimeout"); got != 2*time.Minute {
+		t.Errorf("after reset: got %s", got)
+	}
+}
+
+func TestUpdateValidation(t *testing.T) {
+	setupTest(t)
+
+	errs, err := Update(map[string]*string{
+		"maxBodySize":        ptr("12"),
+		"providerTimeout":    ptr("1m"),
+		"completionCacheTTL": ptr("0s"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %+v", errs)
+	}
+	// nothing is saved when any value is invalid
+	if got := Duration("completionCacheTTL"); got != 24*time.Hour {
+		t.Errorf("invalid update was partially applied: %s", got)
+	}
+
+	t.Setenv("MAX_UPLOAD_SIZE", "lots")
+	if got := Int64("maxUploadSize"); got != 100<<20 {
+		t.Errorf("invalid env should fall back to the default, got %d", got)
+	}
+	if errs := CheckEnv(); len(errs) != 1 || errs[0].Key != "MAX_UPLOAD_SIZE" {
+		t.Errorf("CheckEnv: got %+v", errs)
+	}
+
+	t.Setenv("CORS_ORIGINS", " https://a.example , https://b.example,")
+	if got := List("corsOrigins"); len(got) != 2 || got[1] != "https://b.example" {
+		t.Errorf("list: got %q", got)
+	}
+	for _, e := range Entries() {
+		if e.Key == "corsOrigins" && e.Source != SourceEnv {
+			t.Errorf("corsOrigins source = %q", e.Source)
+		}
+	}
+}
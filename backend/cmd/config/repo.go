@@ -0,0 +1,61 @@
+package config
+
+import (
+	"database/sql"
+)
+
+type Repository interface {
+	GetAll() (map[string]string, error)
+	Save(changes map[string]*string) error
+}
+
+type RepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) GetAll() (map[string]string, error) {
+	rows, err := r.db.Query(`SELECT key, value FROM AdminSettings`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, rows.Err()
+}
+
+// Save writes the changes in one transaction, a nil value deletes the key.
+func (r *RepositoryImpl) Save(changes map[string]*string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for key, value := range changes {
+		if value == nil {
+			_, err = tx.Exec(`DELETE FROM AdminSettings WHERE key = ?`, key)
+		} else {
+			_, err = tx.Exec(
+				`INSERT INTO AdminSettings (key, value) VALUES (?, ?)
+				ON CONFLICT(key) DO UPDATE SET value = excluded.value`,
+				key, *value,
+			)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -2,8 +2,13 @@ package data
 
 import (
 	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 	// _ "github.com/mattn/go-sqlite3"
@@ -12,6 +17,13 @@ import (
 
 var DB *sql.DB
 
+const (
+	defaultJournalMode = "WAL"
+	busyTimeout        = 5000 // milliseconds
+	// SchemaVersion is the user_version RunMigrations brings a database to
+	SchemaVersion = 50
+)
+
 func InitDataSource(dataSourceName string) error {
 	var err error
 	// validate dataSourceName
@@ -19,9 +31,15 @@ func InitDataSource(dataSourceName string) error {
 	if err = os.MkdirAll(dir, 0o755); err != nil {
 		return err
 	}
-	// Add _pragma=foreign_keys(1) to ensure foreign keys are enabled on every connection
-	// This is critical for modernc.org/sqlite with connection pooling
-	dsn := dataSourceName + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	// Pragmas in the DSN run on every new connection of the pool, which
+	// is critical for modernc.org/sqlite since each connection has its own
+	// foreign key and busy timeout settings.
+	// Write transactions start IMMEDIATE so concurrent writers wait on the
+	// busy timeout instead of failing with "database is locked" on upgrade.
+	dsn := dataSourceName + "?" + dsnParams(journalMode())
+	if DB != nil {
+		forgetStatements(DB)
+	}
 	DB, err = sql.Open("sqlite", dsn)
 	if err != nil {
 		return err
@@ -33,26 +51,129 @@ func InitDataSource(dataSourceName string) error {
 		return err
 	}
 
-	// Set connection pool settings first
+	// WAL allows readers alongside the single writer, keep enough
+	// connections open for streaming and sync requests to share them
 	DB.SetMaxOpenConns(10)
-	DB.SetMaxIdleConns(5)
+	DB.SetMaxIdleConns(10)
 	DB.SetConnMaxLifetime(0)
+	DB.SetConnMaxIdleTime(5 * time.Minute)
 
-	// Enable foreign keys - CRITICAL: Must be executed to take effect
-	if _, err = DB.Exec(`PRAGMA foreign_keys = ON;`); err != nil {
-		return err
+	return RunMigrations(DB)
+}
+
+// journalMode is the SQLite journal mode, WAL unless SQLITE_JOURNAL_MODE
+// is set, e.g. to DELETE on file systems without shared memory support.
+func journalMode() string {
+	if mode := os.Getenv("SQLITE_JOURNAL_MODE"); mode != "" {
+		return strings.ToUpper(mode)
 	}
+	return defaultJournalMode
+}
 
-	// // Standard optimizations - disabled due to issues in development
-	// if _, err = DB.Exec(`PRAGMA journal_mode = WAL;`); err != nil {
-	// 	return err
-	// }
+func dsnParams(journal string) string {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout))
+	params.Add("_pragma", "journal_mode("+journal+")")
+	if journal == "WAL" {
+		// safe with WAL, only the last transactions may roll back on power loss
+		params.Add("_pragma", "synchronous(NORMAL)")
+	}
+	params.Set("_txlock", "immediate")
+	return params.Encode()
+}
 
-	if _, err = DB.Exec(`PRAGMA busy_timeout = 5000;`); err != nil {
-		return err
+// OpenReadOnly opens an existing database without creating or migrating
+// it, for inspecting it next to a running server.
+func OpenReadOnly(dataSourceName string) (*sql.DB, error) {
+	if _, err := os.Stat(dataSourceName); err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout))
+	params.Set("mode", "ro")
+	db, err := sql.Open("sqlite", "file:"+dataSourceName+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, err
 	}
+	return db, nil
+}
 
-	return RunMigrations(DB)
+// UserVersion is the schema version of db.
+func UserVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow("PRAGMA user_version;").Scan(&version)
+	return version, err
+}
+
+// Restore replaces the database at dataSourceName with the backup at
+// backupPath, after checking the backup is intact and not newer than this
+// build. The replaced database is kept next to it, its path is returned.
+// Nothing may have the database open meanwhile.
+func Restore(dataSourceName string, backupPath string) (string, error) {
+	backup, err := OpenReadOnly(backupPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot open backup: %w", err)
+	}
+	var integrity string
+	err = backup.QueryRow("PRAGMA integrity_check;").Scan(&integrity)
+	version, versionErr := UserVersion(backup)
+	_ = backup.Close()
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("cannot check backup: %w", err)
+	case integrity != "ok":
+		return "", fmt.Errorf("backup is corrupt: %s", integrity)
+	case versionErr != nil:
+		return "", versionErr
+	case version > SchemaVersion:
+		return "", fmt.Errorf("backup schema v%d is newer than this build (v%d)", version, SchemaVersion)
+	}
+
+	var previous string
+	if current, err := OpenReadOnly(dataSourceName); err == nil {
+		// VACUUM INTO also copies what is still in the WAL file
+		previous = dataSourceName + ".before-restore-" + time.Now().UTC().Format("20060102-150405")
+		_, err = current.Exec(`VACUUM INTO ?`, previous)
+		_ = current.Close()
+		if err != nil {
+			return "", fmt.Errorf("cannot keep the current database: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	staged := dataSourceName + ".restore"
+	if err := copyFile(backupPath, staged); err != nil {
+		return previous, err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(dataSourceName + suffix); err != nil && !os.IsNotExist(err) {
+			return previous, err
+		}
+	}
+	return previous, os.Rename(staged, dataSourceName)
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
 }
 
 func RunMigrations(db *sql.DB) error {
@@ -275,5 +396,1019 @@ func RunMigrations(db *sql.DB) error {
 		}
 	}
 
+	if userVersion < 6 {
+		// user roles, the first registered user becomes admin
+		schemaV6 := `
+		ALTER TABLE Users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+		UPDATE Users SET role = 'admin' WHERE id = (SELECT MIN(id) FROM Users);
+		`
+		_, err = db.Exec(schemaV6)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 6;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 7 {
+		// per-model default parameters, null columns fall through to the request defaults
+		schemaV7 := `
+		CREATE TABLE IF NOT EXISTS ModelParams (
+			model_id TEXT NOT NULL,
+			user TEXT NOT NULL,
+			temperature REAL,
+			top_p REAL,
+			max_tokens INTEGER,
+			reasoning_effort TEXT,
+			PRIMARY KEY (model_id, user),
+			FOREIGN KEY (model_id) REFERENCES Models(id) ON DELETE CASCADE,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+		`
+		_, err = db.Exec(schemaV7)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 7;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 8 {
+		// prompt templates, shared ones are visible to every user
+		schemaV8 := `
+		CREATE TABLE IF NOT EXISTS Templates (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			content TEXT NOT NULL,
+			shared BOOLEAN NOT NULL DEFAULT 0,
+			user TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+		`
+		_, err = db.Exec(schemaV8)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 8;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 9 {
+		// durable user facts and the per-conversation opt-out
+		schemaV9 := `
+		CREATE TABLE IF NOT EXISTS Memories (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user TEXT NOT NULL,
+			content TEXT NOT NULL,
+			source TEXT NOT NULL DEFAULT 'user',
+			conv_id TEXT REFERENCES Conversations(id) ON DELETE SET NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+
+		ALTER TABLE Conversations ADD COLUMN memory_enabled BOOLEAN NOT NULL DEFAULT 1;
+		`
+		_, err = db.Exec(schemaV9)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 9;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 10 {
+		// NULL means the provider did not report input modalities
+		schemaV10 := `
+		ALTER TABLE Models ADD COLUMN supports_vision BOOLEAN;
+		`
+		_, err = db.Exec(schemaV10)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 10;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 11 {
+		// model pricing in USD per million tokens, NULL when unknown
+		schemaV11 := `
+		ALTER TABLE Models ADD COLUMN prompt_price REAL;
+		ALTER TABLE Models ADD COLUMN completion_price REAL;
+		`
+		_, err = db.Exec(schemaV11)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 11;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 12 {
+		// request timeouts in seconds, 0 uses the server default
+		schemaV12 := `
+		ALTER TABLE Providers ADD COLUMN connect_timeout INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE Providers ADD COLUMN read_timeout INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE Providers ADD COLUMN total_timeout INTEGER NOT NULL DEFAULT 0;
+		`
+		_, err = db.Exec(schemaV12)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 12;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 13 {
+		// additional API keys per provider, rotated by key_strategy
+		schemaV13 := `
+		CREATE TABLE IF NOT EXISTS ProviderKeys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			provider_id TEXT NOT NULL,
+			api_key TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (provider_id) REFERENCES Providers(id) ON DELETE CASCADE
+		);
+
+		ALTER TABLE Providers ADD COLUMN key_strategy TEXT NOT NULL DEFAULT 'round_robin';
+		`
+		_, err = db.Exec(schemaV13)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 13;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 14 {
+		// answers of deterministic completions, reused until expires_at
+		schemaV14 := `
+		CREATE TABLE IF NOT EXISTS Cache (
+			key TEXT NOT NULL,
+			user TEXT NOT NULL,
+			model TEXT NOT NULL,
+			content TEXT NOT NULL,
+			reasoning TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			PRIMARY KEY (key, user),
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_cache_expires ON Cache(expires_at);
+		`
+		_, err = db.Exec(schemaV14)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 14;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 15 {
+		// routing metadata from OpenRouter style model lists
+		schemaV15 := `
+		ALTER TABLE Models ADD COLUMN context_length INTEGER;
+		ALTER TABLE Models ADD COLUMN input_modalities TEXT;
+		ALTER TABLE Models ADD COLUMN output_modalities TEXT;
+		`
+		_, err = db.Exec(schemaV15)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 15;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 16 {
+		// lookups done when loading a message tree
+		schemaV16 := `
+		CREATE INDEX IF NOT EXISTS idx_messages_conv ON Messages(conv_id);
+		CREATE INDEX IF NOT EXISTS idx_messages_parent ON Messages(parent_id);
+		CREATE INDEX IF NOT EXISTS idx_toolcalls_conv ON ToolCalls(conv_id);
+		CREATE INDEX IF NOT EXISTS idx_toolcalls_message ON ToolCalls(message_id);
+		CREATE INDEX IF NOT EXISTS idx_attachments_message ON Attachments(message_id);
+		`
+		_, err = db.Exec(schemaV16)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 16;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 17 {
+		// users signing in through an OpenID Connect provider
+		schemaV17 := `
+		ALTER TABLE Users ADD COLUMN oidc_subject TEXT;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc_subject ON Users(oidc_subject);
+		`
+		_, err = db.Exec(schemaV17)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 17;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 18 {
+		// TOTP two-factor authentication
+		schemaV18 := `
+		CREATE TABLE IF NOT EXISTS TwoFactor (
+			user TEXT PRIMARY KEY,
+			secret TEXT NOT NULL,
+			enabled BOOLEAN NOT NULL DEFAULT 0,
+			last_counter INTEGER NOT NULL DEFAULT 0,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+
+		CREATE TABLE IF NOT EXISTS RecoveryCodes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user TEXT NOT NULL,
+			code_hash TEXT NOT NULL,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON RecoveryCodes(user);
+		`
+		_, err = db.Exec(schemaV18)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 18;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 19 {
+		// instance wide options set by admins
+		schemaV19 := `
+		CREATE TABLE IF NOT EXISTS AdminSettings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);
+		`
+		_, err = db.Exec(schemaV19)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 19;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 20 {
+		// why the provider stopped, to continue answers cut off at the token limit
+		schemaV20 := `
+		ALTER TABLE Messages ADD COLUMN finish_reason TEXT NOT NULL DEFAULT '';
+		`
+		_, err = db.Exec(schemaV20)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 20;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 21 {
+		// unsent messages, restored on every device
+		schemaV21 := `
+		CREATE TABLE IF NOT EXISTS Drafts (
+			conv_id TEXT PRIMARY KEY,
+			content TEXT NOT NULL DEFAULT '',
+			parent_id INTEGER NOT NULL DEFAULT 0,
+			file_ids TEXT NOT NULL DEFAULT '',
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (conv_id) REFERENCES Conversations(id) ON DELETE CASCADE
+		);
+		`
+		_, err = db.Exec(schemaV21)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 21;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 22 {
+		// how often and how recently each user used a model or template,
+		// model usage outlives the model rows, which are replaced on refresh
+		schemaV22 := `
+		CREATE TABLE IF NOT EXISTS ModelUsage (
+			user TEXT NOT NULL,
+			model_id TEXT NOT NULL,
+			use_count INTEGER NOT NULL DEFAULT 0,
+			last_used_at DATETIME NOT NULL,
+			PRIMARY KEY (user, model_id),
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+
+		CREATE TABLE IF NOT EXISTS TemplateUsage (
+			user TEXT NOT NULL,
+			template_id TEXT NOT NULL,
+			use_count INTEGER NOT NULL DEFAULT 0,
+			last_used_at DATETIME NOT NULL,
+			PRIMARY KEY (user, template_id),
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE,
+			FOREIGN KEY (template_id) REFERENCES Templates(id) ON DELETE CASCADE
+		);
+		`
+		_, err = db.Exec(schemaV22)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 22;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 23 {
+		// per user favorite models and short names for models, e.g. fast
+		schemaV23 := `
+		CREATE TABLE IF NOT EXISTS ModelFavorites (
+			model_id TEXT NOT NULL,
+			user TEXT NOT NULL,
+			PRIMARY KEY (model_id, user),
+			FOREIGN KEY (model_id) REFERENCES Models(id) ON DELETE CASCADE,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+
+		CREATE TABLE IF NOT EXISTS ModelAliases (
+			alias TEXT NOT NULL,
+			user TEXT NOT NULL,
+			model_id TEXT NOT NULL,
+			PRIMARY KEY (alias, user),
+			FOREIGN KEY (model_id) REFERENCES Models(id) ON DELETE CASCADE,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+		`
+		_, err = db.Exec(schemaV23)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 23;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 24 {
+		// capabilities found by test calls, NULL until a model is probed
+		schemaV24 := `
+		ALTER TABLE Models ADD COLUMN supports_tools BOOLEAN;
+		ALTER TABLE Models ADD COLUMN supports_reasoning BOOLEAN;
+		ALTER TABLE Models ADD COLUMN probed_at DATETIME;
+		`
+		_, err = db.Exec(schemaV24)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 24;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 25 {
+		// events is a comma separated list of the subscribed event types
+		schemaV25 := `
+		CREATE TABLE IF NOT EXISTS Webhooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user TEXT NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT NOT NULL,
+			is_enabled BOOLEAN NOT NULL DEFAULT 1,
+			last_status INTEGER,
+			last_error TEXT,
+			last_delivery_at DATETIME,
+			created_at DATETIME NOT NULL,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhooks_user ON Webhooks(user);
+		`
+		_, err = db.Exec(schemaV25)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 25;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 26 {
+		// the conversation a Telegram or Slack chat continues,
+		// last_message_id is the answer the next message follows
+		schemaV26 := `
+		CREATE TABLE IF NOT EXISTS BridgeChats (
+			platform TEXT NOT NULL,
+			chat_id TEXT NOT NULL,
+			user TEXT NOT NULL,
+			conv_id TEXT NOT NULL,
+			last_message_id INTEGER NOT NULL,
+			updated_at DATETIME NOT NULL,
+			PRIMARY KEY (platform, chat_id),
+			FOREIGN KEY (conv_id) REFERENCES Conversations(id) ON DELETE CASCADE,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+		`
+		_, err = db.Exec(schemaV26)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 26;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 27 {
+		// responses of requests sent with an Idempotency-Key, replayed
+		// when the request is retried; status is 0 while it runs
+		schemaV27 := `
+		CREATE TABLE IF NOT EXISTS IdempotencyKeys (
+			user TEXT NOT NULL,
+			key TEXT NOT NULL,
+			endpoint TEXT NOT NULL,
+			fingerprint TEXT NOT NULL DEFAULT '',
+			status INTEGER NOT NULL DEFAULT 0,
+			content_type TEXT NOT NULL DEFAULT '',
+			body BLOB,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (user, key),
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created ON IdempotencyKeys(created_at);
+		`
+		_, err = db.Exec(schemaV27)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 27;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 28 {
+		// values redacted from the messages sent to providers, by the
+		// placeholder that replaced them, to restore them in answers
+		schemaV28 := `
+		CREATE TABLE IF NOT EXISTS Redactions (
+			conv_id TEXT NOT NULL,
+			placeholder TEXT NOT NULL,
+			value TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (conv_id, placeholder),
+			FOREIGN KEY (conv_id) REFERENCES Conversations(id) ON DELETE CASCADE
+		);
+		`
+		_, err = db.Exec(schemaV28)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 28;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 29 {
+		// messages flagged by moderation, kept after their conversation
+		// is deleted
+		schemaV29 := `
+		CREATE TABLE IF NOT EXISTS ModerationDecisions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user TEXT NOT NULL,
+			conv_id TEXT NOT NULL DEFAULT '',
+			message_id INTEGER NOT NULL DEFAULT 0,
+			stage TEXT NOT NULL,
+			source TEXT NOT NULL,
+			categories TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL,
+			excerpt TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_moderation_decisions_created ON ModerationDecisions(created_at);
+		`
+		_, err = db.Exec(schemaV29)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 29;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 30 {
+		// outbound proxy of a provider, empty uses the instance one
+		schemaV30 := `
+		ALTER TABLE Providers ADD COLUMN proxy TEXT NOT NULL DEFAULT '';
+		`
+		_, err = db.Exec(schemaV30)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 30;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 31 {
+		// pinned messages are always sent to the model, whatever branch
+		// is active
+		schemaV31 := `
+		ALTER TABLE Messages ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT 0;
+		`
+		_, err = db.Exec(schemaV31)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 31;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 32 {
+		// raw requests to providers and their responses, with keys
+		// scrubbed, kept while requestLogRetention is set
+		schemaV32 := `
+		CREATE TABLE IF NOT EXISTS RequestLogs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user TEXT NOT NULL,
+			provider_id TEXT NOT NULL,
+			method TEXT NOT NULL,
+			url TEXT NOT NULL,
+			status INTEGER NOT NULL DEFAULT 0,
+			request_headers TEXT NOT NULL DEFAULT '{}',
+			request_body TEXT NOT NULL DEFAULT '',
+			response_body TEXT NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT '',
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_request_logs_created ON RequestLogs(created_at);
+		`
+		_, err = db.Exec(schemaV32)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 32;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 33 {
+		// how clients render a tool's output
+		schemaV33 := `
+		ALTER TABLE ToolCalls ADD COLUMN output_type TEXT NOT NULL DEFAULT '';
+		`
+		_, err = db.Exec(schemaV33)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 33;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 34 {
+		// named collections of files, searchable from the conversations
+		// they are attached to
+		schemaV34 := `
+		CREATE TABLE IF NOT EXISTS KnowledgeBases (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			user TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+
+		CREATE TABLE IF NOT EXISTS KnowledgeBaseFiles (
+			kb_id TEXT NOT NULL,
+			file_id TEXT NOT NULL,
+			added_at DATETIME NOT NULL,
+			PRIMARY KEY (kb_id, file_id),
+			FOREIGN KEY (kb_id) REFERENCES KnowledgeBases(id) ON DELETE CASCADE,
+			FOREIGN KEY (file_id) REFERENCES Files(id) ON DELETE CASCADE
+		);
+
+		CREATE TABLE IF NOT EXISTS ConversationKnowledge (
+			conv_id TEXT NOT NULL,
+			kb_id TEXT NOT NULL,
+			PRIMARY KEY (conv_id, kb_id),
+			FOREIGN KEY (conv_id) REFERENCES Conversations(id) ON DELETE CASCADE,
+			FOREIGN KEY (kb_id) REFERENCES KnowledgeBases(id) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_knowledge_bases_user ON KnowledgeBases(user);
+		CREATE INDEX IF NOT EXISTS idx_knowledge_base_files_file ON KnowledgeBaseFiles(file_id);
+		CREATE INDEX IF NOT EXISTS idx_conversation_knowledge_kb ON ConversationKnowledge(kb_id);
+		`
+		_, err = db.Exec(schemaV34)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 34;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 35 {
+		// background work such as text extraction and crawls, retried by
+		// the workers until max_attempts
+		schemaV35 := `
+		CREATE TABLE IF NOT EXISTS Jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			payload TEXT NOT NULL DEFAULT '{}',
+			status TEXT NOT NULL DEFAULT 'queued',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL DEFAULT 3,
+			error TEXT NOT NULL DEFAULT '',
+			result TEXT NOT NULL DEFAULT '',
+			run_at DATETIME NOT NULL,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_jobs_due ON Jobs(status, run_at);
+		CREATE INDEX IF NOT EXISTS idx_jobs_user ON Jobs(user, id);
+		`
+		_, err = db.Exec(schemaV35)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 35;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 36 {
+		// token usage of every completion, and the monthly budgets admins
+		// set per user
+		schemaV36 := `
+		CREATE TABLE IF NOT EXISTS UsageRecords (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user TEXT NOT NULL,
+			model TEXT NOT NULL,
+			prompt_tokens INTEGER NOT NULL DEFAULT 0,
+			completion_tokens INTEGER NOT NULL DEFAULT 0,
+			cost REAL,
+			created_at DATETIME NOT NULL,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_usage_records_user ON UsageRecords(user, created_at);
+
+		CREATE TABLE IF NOT EXISTS UserBudgets (
+			user TEXT PRIMARY KEY,
+			monthly_tokens INTEGER NOT NULL DEFAULT 0,
+			monthly_cost REAL NOT NULL DEFAULT 0,
+			updated_at DATETIME NOT NULL,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+		`
+		_, err = db.Exec(schemaV36)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 36;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 37 {
+		// daily usage summaries, raw records are marked once rolled into
+		// them and pruned later
+		schemaV37 := `
+		ALTER TABLE UsageRecords ADD COLUMN rolled_up INTEGER NOT NULL DEFAULT 0;
+		CREATE INDEX IF NOT EXISTS idx_usage_records_rolled_up ON UsageRecords(rolled_up, created_at);
+
+		CREATE TABLE IF NOT EXISTS UsageDaily (
+			user TEXT NOT NULL,
+			day TEXT NOT NULL,
+			model TEXT NOT NULL,
+			requests INTEGER NOT NULL DEFAULT 0,
+			prompt_tokens INTEGER NOT NULL DEFAULT 0,
+			completion_tokens INTEGER NOT NULL DEFAULT 0,
+			cost REAL NOT NULL DEFAULT 0,
+			PRIMARY KEY (user, day, model),
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_usage_daily_day ON UsageDaily(day);
+		`
+		_, err = db.Exec(schemaV37)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 37;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 38 {
+		// logins and administrative changes; entries outlive the users
+		// they name
+		schemaV38 := `
+		CREATE TABLE IF NOT EXISTS AuditLog (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor TEXT NOT NULL,
+			action TEXT NOT NULL,
+			target TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL DEFAULT '',
+			payload TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON AuditLog(actor, id);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_action ON AuditLog(action, id);
+		`
+		_, err = db.Exec(schemaV38)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 38;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 39 {
+		// tools can call an HTTP endpoint instead of an MCP server
+		schemaV39 := `
+		ALTER TABLE Tools ADD COLUMN type TEXT NOT NULL DEFAULT 'mcp';
+		ALTER TABLE Tools ADD COLUMN http_json TEXT NOT NULL DEFAULT '';
+		`
+		_, err = db.Exec(schemaV39)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 39;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 40 {
+		// generated answers whose final save failed, kept until it succeeds
+		schemaV40 := `
+		CREATE TABLE IF NOT EXISTS FailedSaves (
+			message_id INTEGER PRIMARY KEY,
+			payload TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+		`
+		_, err = db.Exec(schemaV40)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 40;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 41 {
+		// the last message the user has seen in each conversation, existing
+		// conversations start out read
+		schemaV41 := `
+		CREATE TABLE IF NOT EXISTS ReadStates (
+			conv_id TEXT PRIMARY KEY,
+			message_id INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (conv_id) REFERENCES Conversations(id) ON DELETE CASCADE
+		);
+		INSERT OR IGNORE INTO ReadStates (conv_id, message_id)
+		SELECT conv_id, MAX(id) FROM Messages GROUP BY conv_id;
+		`
+		_, err = db.Exec(schemaV41)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 41;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 42 {
+		// the name and picture a user shows, the avatar is one of their files
+		schemaV42 := `
+		CREATE TABLE IF NOT EXISTS Profiles (
+			user TEXT PRIMARY KEY,
+			display_name TEXT NOT NULL DEFAULT '',
+			avatar_file_id TEXT,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE,
+			FOREIGN KEY (avatar_file_id) REFERENCES Files(id) ON DELETE SET NULL
+		);
+		`
+		_, err = db.Exec(schemaV42)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 42;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 43 {
+		// single-use codes admins hand out to let someone sign up, only the
+		// hash of a code is kept
+		schemaV43 := `
+		CREATE TABLE IF NOT EXISTS Invitations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			code_hash TEXT NOT NULL UNIQUE,
+			note TEXT NOT NULL DEFAULT '',
+			created_by TEXT,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			used_by TEXT,
+			used_at DATETIME,
+			FOREIGN KEY (created_by) REFERENCES Users(username) ON DELETE SET NULL
+		);
+		`
+		_, err = db.Exec(schemaV43)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 43;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 44 {
+		// providers an admin shares with every user, or with the users
+		// listed in ProviderUsers
+		schemaV44 := `
+		ALTER TABLE Providers ADD COLUMN shared BOOLEAN NOT NULL DEFAULT 0;
+		CREATE TABLE IF NOT EXISTS ProviderUsers (
+			provider_id TEXT NOT NULL,
+			user TEXT NOT NULL,
+			PRIMARY KEY (provider_id, user),
+			FOREIGN KEY (provider_id) REFERENCES Providers(id) ON DELETE CASCADE,
+			FOREIGN KEY (user) REFERENCES Users(username) ON DELETE CASCADE
+		);
+		`
+		_, err = db.Exec(schemaV44)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 44;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 45 {
+		// token caps every user other than the owner has on a shared
+		// provider, 0 is no cap
+		schemaV45 := `
+		CREATE TABLE IF NOT EXISTS ProviderQuotas (
+			provider_id TEXT PRIMARY KEY,
+			daily_tokens INTEGER NOT NULL DEFAULT 0,
+			monthly_tokens INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME NOT NULL,
+			FOREIGN KEY (provider_id) REFERENCES Providers(id) ON DELETE CASCADE
+		);
+		`
+		_, err = db.Exec(schemaV45)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 45;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 46 {
+		// files that are deleted once expired, such as ephemeral pastes,
+		// NULL is kept
+		schemaV46 := `
+		ALTER TABLE Files ADD COLUMN expires_at DATETIME;
+		CREATE INDEX IF NOT EXISTS idx_files_expires_at ON Files(expires_at) WHERE expires_at IS NOT NULL;
+		`
+		_, err = db.Exec(schemaV46)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 46;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 47 {
+		// a note of the user on a file, sent along with its content
+		schemaV47 := `
+		ALTER TABLE Files ADD COLUMN description TEXT NOT NULL DEFAULT '';
+		`
+		_, err = db.Exec(schemaV47)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 47;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 48 {
+		// pinned conversations are exempt from retention, archived ones
+		// are hidden from the conversation list
+		schemaV48 := `
+		ALTER TABLE Conversations ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT 0;
+		ALTER TABLE Conversations ADD COLUMN archived_at DATETIME;
+		`
+		_, err = db.Exec(schemaV48)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 48;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 49 {
+		// how far a running job got, reported by its handler
+		schemaV49 := `
+		ALTER TABLE Jobs ADD COLUMN progress TEXT NOT NULL DEFAULT '';
+		`
+		_, err = db.Exec(schemaV49)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 49;")
+		if err != nil {
+			return err
+		}
+	}
+
+	if userVersion < 50 {
+		// invalid two-factor codes in a row, and the lockout they caused
+		schemaV50 := `
+		ALTER TABLE TwoFactor ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE TwoFactor ADD COLUMN locked_until DATETIME;
+		`
+		_, err = db.Exec(schemaV50)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("PRAGMA user_version = 50;")
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -2,6 +2,7 @@ package data
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
 	"path"
 	"testing"
@@ -37,8 +38,8 @@ func TestRunMigrations_FreshDB(t *testing.T) {
 		t.Fatalf("Failed to get user_version: %v", err)
 	}
 
-	if userVersion != 5 {
-		t.Errorf("Expected user_version to be 5, got %d", userVersion)
+	if userVersion != 50 {
+		t.Errorf("Expected user_version to be 50, got %d", userVersion)
 	}
 
 	// Verify new columns exist
@@ -209,8 +210,8 @@ func TestRunMigrations_UpgradeFromV1(t *testing.T) {
 	if err := db.QueryRow("PRAGMA user_version;").Scan(&userVersion); err != nil {
 		t.Fatalf("Failed to retrieve user version: %v", err)
 	}
-	if userVersion != 5 {
-		t.Errorf("Expected bumped version to be 5, got %d", userVersion)
+	if userVersion != 50 {
+		t.Errorf("Expected bumped version to be 50, got %d", userVersion)
 	}
 
 	// Verify headers_json was added and old data is intact
@@ -223,3 +224,176 @@ func TestRunMigrations_UpgradeFromV1(t *testing.T) {
 		t.Errorf("Expected '{}' as DEFAULT for headers_json, got %q", headers)
 	}
 }
+
+func TestInitDataSource_Pragmas(t *testing.T) {
+	if err := InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("InitDataSource: %v", err)
+	}
+	defer DB.Close()
+
+	var journal string
+	if err := DB.QueryRow("PRAGMA journal_mode;").Scan(&journal); err != nil {
+		t.Fatal(err)
+	}
+	if journal != "wal" {
+		t.Errorf("journal_mode = %q, want wal", journal)
+	}
+
+	// every pooled connection must get the per-connection pragmas
+	conns := make([]*sql.Conn, 3)
+	for i := range conns {
+		conn, err := DB.Conn(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns[i] = conn
+	}
+	for _, conn := range conns {
+		var fk, timeout int
+		if err := conn.QueryRowContext(t.Context(), "PRAGMA foreign_keys;").Scan(&fk); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.QueryRowContext(t.Context(), "PRAGMA busy_timeout;").Scan(&timeout); err != nil {
+			t.Fatal(err)
+		}
+		if fk != 1 || timeout != busyTimeout {
+			t.Errorf("foreign_keys = %d, busy_timeout = %d", fk, timeout)
+		}
+	}
+}
+
+func TestInitDataSource_ConcurrentWrites(t *testing.T) {
+	if err := InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("InitDataSource: %v", err)
+	}
+	defer DB.Close()
+
+	const writers = 8
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		go func(i int) {
+			tx, err := DB.Begin()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if _, err := tx.Exec("INSERT INTO Users (username, pass_hash) VALUES (?, 'x')", fmt.Sprintf("user-%d", i)); err != nil {
+				_ = tx.Rollback()
+				errs <- err
+				return
+			}
+			errs <- tx.Commit()
+		}(i)
+	}
+	for i := 0; i < writers; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("concurrent write failed: %v", err)
+		}
+	}
+}
+
+func TestPrepared_ReusesStatements(t *testing.T) {
+	if err := InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("InitDataSource: %v", err)
+	}
+	defer DB.Close()
+
+	query := "SELECT COUNT(*) FROM Users WHERE username = ?"
+	first, err := Prepared(DB, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Prepared(DB, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("expected the cached statement to be reused")
+	}
+
+	var count int
+	if err := QueryRow(DB, query, "nobody").Scan(&count); err != nil || count != 0 {
+		t.Errorf("count = %d, err = %v", count, err)
+	}
+	if err := QueryRow(DB, "SELECT nope FROM Nowhere").Scan(&count); err == nil {
+		t.Errorf("expected an error for an invalid query")
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	dbPath := path.Join(t.TempDir(), "test.db")
+	if _, err := OpenReadOnly(dbPath); !os.IsNotExist(err) {
+		t.Fatalf("Expected a missing database to be reported, got %v", err)
+	}
+
+	if err := InitDataSource(dbPath); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	defer DB.Close()
+
+	db, err := OpenReadOnly(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database read-only: %v", err)
+	}
+	defer db.Close()
+
+	version, err := UserVersion(db)
+	if err != nil {
+		t.Fatalf("Failed to get user_version: %v", err)
+	}
+	if version != SchemaVersion {
+		t.Errorf("Expected user_version %d, got %d", SchemaVersion, version)
+	}
+	if _, err := db.Exec("CREATE TABLE Probe (id INTEGER)"); err == nil {
+		t.Error("Expected writes to a read-only database to fail")
+	}
+}
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := path.Join(dir, "ai-ui.db")
+	backupPath := path.Join(dir, "backup.db")
+
+	if err := InitDataSource(dbPath); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	if _, err := DB.Exec(`INSERT INTO Users (username, pass_hash) VALUES ('alice', 'x')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.Exec(`VACUUM INTO ?`, backupPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.Exec(`INSERT INTO Users (username, pass_hash) VALUES ('bob', 'x')`); err != nil {
+		t.Fatal(err)
+	}
+	DB.Close()
+
+	if _, err := Restore(dbPath, path.Join(dir, "missing.db")); err == nil {
+		t.Error("Expected a missing backup to be rejected")
+	}
+
+	previous, err := Restore(dbPath, backupPath)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	count := func(file string) int {
+		db, err := OpenReadOnly(file)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", file, err)
+		}
+		defer db.Close()
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM Users`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count(dbPath); n != 1 {
+		t.Errorf("Expected the restored database to have 1 user, got %d", n)
+	}
+	if n := count(previous); n != 2 {
+		t.Errorf("Expected the replaced database to be kept with 2 users, got %d", n)
+	}
+}
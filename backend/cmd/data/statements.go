@@ -0,0 +1,73 @@
+package data
+
+import (
+	"database/sql"
+	"sync"
+)
+
+type stmtKey struct {
+	db    *sql.DB
+	query string
+}
+
+var statements sync.Map // stmtKey -> *sql.Stmt
+
+// Prepared returns a prepared statement for query, preparing it on first
+// use. Statements are cached per database and reused by every connection
+// of the pool, so hot queries are parsed once instead of on every call.
+func Prepared(db *sql.DB, query string) (*sql.Stmt, error) {
+	key := stmtKey{db, query}
+	if stmt, ok := statements.Load(key); ok {
+		return stmt.(*sql.Stmt), nil
+	}
+
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	if existing, loaded := statements.LoadOrStore(key, stmt); loaded {
+		_ = stmt.Close()
+		return existing.(*sql.Stmt), nil
+	}
+	return stmt, nil
+}
+
+// Exec runs a statement through the prepared statement cache.
+func Exec(db *sql.DB, query string, args ...any) (sql.Result, error) {
+	stmt, err := Prepared(db, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(args...)
+}
+
+// Query runs a query through the prepared statement cache.
+func Query(db *sql.DB, query string, args ...any) (*sql.Rows, error) {
+	stmt, err := Prepared(db, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Query(args...)
+}
+
+// QueryRow runs a single row query through the prepared statement cache.
+// A query that fails to prepare runs unprepared so the error surfaces
+// from Scan as usual.
+func QueryRow(db *sql.DB, query string, args ...any) *sql.Row {
+	stmt, err := Prepared(db, query)
+	if err != nil {
+		return db.QueryRow(query, args...)
+	}
+	return stmt.QueryRow(args...)
+}
+
+// forgetStatements closes and drops the cached statements of db.
+func forgetStatements(db *sql.DB) {
+	statements.Range(func(k, v any) bool {
+		if k.(stmtKey).db == db {
+			_ = v.(*sql.Stmt).Close()
+			statements.Delete(k)
+		}
+		return true
+	})
+}
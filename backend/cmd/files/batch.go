@@ -0,0 +1,146 @@
+package files
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// maxBatchFiles bounds the files of one batch request.
+const maxBatchFiles = 500
+
+type BatchRequest struct {
+	FileIDs []string `json:"fileIds"`
+}
+
+type BatchDeleteResponse struct {
+	Deleted []string `json:"deleted"`
+	// NotFound lists the IDs that are not files of the user
+	NotFound []string `json:"notFound"`
+}
+
+// batchFiles reads a batch request and returns the requested files of the
+// user, with the IDs that were not found.
+func batchFiles(w http.ResponseWriter, r *http.Request) ([]File, []string, bool) {
+	user := utils.ExtractContextUser(r)
+	var req BatchRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	slices.Sort(req.FileIDs)
+	req.FileIDs = slices.Compact(req.FileIDs)
+	if len(req.FileIDs) == 0 || len(req.FileIDs) > maxBatchFiles {
+		utils.Error(w, fmt.Sprintf("Between 1 and %d files are needed", maxBatchFiles), http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	found, err := repo.GetByIDs(req.FileIDs, user)
+	if err != nil {
+		log.Error("Error querying files", "err", err)
+		utils.Error(w, "Error retrieving files", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	notFound := make([]string, 0)
+	for _, id := range req.FileIDs {
+		if !slices.ContainsFunc(found, func(f File) bool { return f.ID == id }) {
+			notFound = append(notFound, id)
+		}
+	}
+	return found, notFound, true
+}
+
+func batchDelete(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	found, notFound, ok := batchFiles(w, r)
+	if !ok {
+		return
+	}
+
+	resp := BatchDeleteResponse{Deleted: make([]string, 0, len(found)), NotFound: notFound}
+	for _, file := range found {
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			log.Error("Error deleting physical file", "id", file.ID, "err", err)
+			utils.Error(w, "Error deleting file "+file.ID, http.StatusInternalServerError)
+			return
+		}
+		if err := repo.DeleteByID(file.ID, user); err != nil {
+			log.Error("Error deleting file record from database", "id", file.ID, "err", err)
+			utils.Error(w, "Error deleting file "+file.ID, http.StatusInternalServerError)
+			return
+		}
+		resp.Deleted = append(resp.Deleted, file.ID)
+	}
+
+	utils.RespondWithJSON(w, resp, http.StatusOK)
+}
+
+// batchDownload streams a zip archive of the files under their names.
+// Files missing on disk are left out, like in the account export.
+func batchDownload(w http.ResponseWriter, r *http.Request) {
+	found, _, ok := batchFiles(w, r)
+	if !ok {
+		return
+	}
+	if len(found) == 0 {
+		utils.Error(w, "Files not found", http.StatusNotFound)
+		return
+	}
+
+	fileName := "files-" + time.Now().Format("20060102-150405") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	used := make(map[string]bool)
+	for _, file := range found {
+		name := archiveName(file.Name, used)
+		if err := copyToZip(zw, file.Path, name); err != nil {
+			// headers are already sent, skip the file rather than the archive
+			log.Warn("Skipping file in download", "id", file.ID, "err", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Error("Error finalizing download archive", "err", err)
+	}
+}
+
+// archiveName returns a name for a file in an archive that is not used
+// yet, numbering files that share a name like name (2).txt.
+func archiveName(name string, used map[string]bool) string {
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." {
+		name = "file"
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	used[name] = true
+	return name
+}
+
+func copyToZip(zw *zip.Writer, src, name string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entry, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
+}
@@ -3,6 +3,7 @@ package files
 import (
 	"database/sql"
 
+	"github.com/Bajahaw/ai-ui/cmd/jobs"
 	"github.com/Bajahaw/ai-ui/cmd/providers"
 	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
 
@@ -15,6 +16,21 @@ var provider providers.Client
 var repo Repository
 var settings stngs.Repository
 
+// updateHooks are told about files whose name, content or description
+// changed, so copies kept elsewhere can follow.
+var updateHooks []func(file File)
+
+// OnUpdate registers fn to be called with every updated file.
+func OnUpdate(fn func(file File)) {
+	updateHooks = append(updateHooks, fn)
+}
+
+func updated(file File) {
+	for _, fn := range updateHooks {
+		fn(file)
+	}
+}
+
 func SetupFiles(
 	l *logger.Logger,
 	d *sql.DB,
@@ -25,4 +41,6 @@ func SetupFiles(
 	provider = pc
 	settings = stngs.NewRepository(db)
 	repo = NewRepository(db)
+	jobs.Register(ExtractJob, extractJob)
+	go purgeExpired()
 }
@@ -0,0 +1,75 @@
+package files
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
+)
+
+// purgeEvery is how often expired files are deleted.
+const purgeEvery = 10 * time.Minute
+
+// ephemeralExpiry is when an ephemeral file uploaded now expires, after
+// the hours of the user's ephemeralFileTTL setting.
+func ephemeralExpiry(user string, now time.Time) *time.Time {
+	value, err := settings.Get("ephemeralFileTTL", user)
+	if err != nil {
+		def, _ := stngs.Lookup("ephemeralFileTTL")
+		value = def.Default
+	}
+	hours, err := strconv.Atoi(value)
+	if err != nil || hours < 1 {
+		hours = 24
+	}
+	expiresAt := now.UTC().Add(time.Duration(hours) * time.Hour)
+	return &expiresAt
+}
+
+// ExpireEphemeral lets the ephemeral files among ids expire now, once the
+// message they are attached to was sent. Kept files are not affected.
+func ExpireEphemeral(ids []string, user string) error {
+	if repo == nil {
+		return nil
+	}
+	return repo.Expire(ids, user, time.Now().UTC())
+}
+
+// ExpireUploadedBefore lets the user's files uploaded before cutoff expire
+// now, for retention. Files still in use elsewhere are kept, see
+// Repository.ExpireUploadedBefore.
+func ExpireUploadedBefore(user string, cutoff time.Time) (int, error) {
+	if repo == nil {
+		return 0, nil
+	}
+	return repo.ExpireUploadedBefore(user, cutoff, time.Now().UTC())
+}
+
+func purgeExpired() {
+	for {
+		purge(time.Now())
+		time.Sleep(purgeEvery)
+	}
+}
+
+// purge deletes the files that expired by now, with their stored data.
+func purge(now time.Time) {
+	expired, err := repo.GetExpired(now.UTC())
+	if err != nil {
+		log.Error("Error querying expired files", "err", err)
+		return
+	}
+	for _, file := range expired {
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			log.Error("Error deleting expired file", "file", file.ID, "err", err)
+			continue
+		}
+		if err := repo.DeleteByID(file.ID, file.User); err != nil {
+			log.Error("Error deleting expired file record", "file", file.ID, "err", err)
+		}
+	}
+	if len(expired) > 0 {
+		log.Info("Purged expired files", "count", len(expired))
+	}
+}
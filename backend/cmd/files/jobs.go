@@ -0,0 +1,51 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Bajahaw/ai-ui/cmd/jobs"
+)
+
+// ExtractJob is the kind of job that extracts the text of a file.
+const ExtractJob = "extract_content"
+
+type extractPayload struct {
+	FileID string `json:"fileId"`
+}
+
+type extractResult struct {
+	FileID     string `json:"fileId"`
+	Characters int    `json:"characters"`
+}
+
+// QueueExtraction extracts the text of a file in the background, so that
+// uploads return before OCR or page indexing is done.
+func QueueExtraction(fileID string, user string) (*jobs.Job, error) {
+	return jobs.Enqueue(user, ExtractJob, extractPayload{FileID: fileID})
+}
+
+func extractJob(ctx context.Context, job *jobs.Job) (any, error) {
+	var payload extractPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	found, err := repo.GetByIDs([]string{payload.FileID}, job.User)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, jobs.Permanent(fmt.Errorf("file not found: %s", payload.FileID))
+	}
+	file := found[0]
+	// a chat may have needed the text first
+	if file.Content != "" {
+		return extractResult{FileID: file.ID, Characters: len(file.Content)}, nil
+	}
+	content, err := ExtractContent(ctx, file, job.User)
+	if err != nil {
+		return nil, err
+	}
+	return extractResult{FileID: file.ID, Characters: len(content)}, nil
+}
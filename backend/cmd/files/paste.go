@@ -0,0 +1,113 @@
+package files
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// PastedFile is a stored paste, with the image as a data URL when asked
+// for so the client can preview it without another request.
+type PastedFile struct {
+	File
+	DataURL string `json:"dataUrl,omitempty"`
+}
+
+// paste stores a pasted image sent as the raw request body, or as base64
+// text with or without a data URL prefix. Like uploads the image is
+// compressed, and its text is extracted in the background since pasted
+// images are mostly screenshots.
+func paste(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	q := r.URL.Query()
+
+	// the body middleware limits the body, with room for base64
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.Error(w, "Pasted image is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		utils.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+	data, err := decodePaste(body, r.Header.Get("Content-Type"))
+	if err != nil {
+		utils.Error(w, "Invalid paste: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxUploadSize {
+		utils.Error(w, "Pasted image is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	mtype := mimetype.Detect(data)
+	if !strings.HasPrefix(mtype.String(), "image/") {
+		utils.Error(w, "Only images can be pasted", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	now := time.Now()
+	file := File{
+		Name:      q.Get("name"),
+		Type:      mtype.String(),
+		User:      user,
+		CreatedAt: now.Format(time.RFC3339),
+	}
+	if file.Name == "" {
+		file.Name = "pasted-" + now.Format("20060102-150405") + mtype.Extension()
+	}
+	if q.Get("ephemeral") == "true" {
+		file.ExpiresAt = ephemeralExpiry(user, now)
+	}
+
+	stored, err := storeFile(data, file)
+	if err != nil {
+		log.Error("Error saving pasted image", "err", err)
+		utils.Error(w, "Error saving file", http.StatusInternalServerError)
+		return
+	}
+	if _, err := QueueExtraction(stored.ID, user); err != nil {
+		log.Error("Error queuing content extraction", "file", stored.ID, "err", err)
+	}
+
+	resp := PastedFile{File: stored}
+	if q.Get("format") == "data-url" {
+		// the stored image, which may have been compressed
+		if saved, err := os.ReadFile(stored.Path); err == nil {
+			resp.DataURL = "data:" + stored.Type + ";base64," + base64.StdEncoding.EncodeToString(saved)
+		}
+	}
+	utils.RespondWithJSON(w, resp, http.StatusOK)
+}
+
+// decodePaste returns the image in a paste body. Text bodies and bodies
+// starting with a data URL are base64, anything else is the image itself.
+func decodePaste(body []byte, contentType string) ([]byte, error) {
+	text := strings.TrimSpace(string(body))
+	if !strings.HasPrefix(contentType, "text/") && !strings.HasPrefix(text, "data:") {
+		if len(body) == 0 {
+			return nil, errors.New("empty body")
+		}
+		return body, nil
+	}
+	if strings.HasPrefix(text, "data:") {
+		header, encoded, ok := strings.Cut(text, ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			return nil, errors.New("only base64 data URLs are supported")
+		}
+		text = encoded
+	}
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid base64")
+	}
+	return data, nil
+}
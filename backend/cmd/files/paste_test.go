@@ -0,0 +1,147 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+func pasteRequest(t *testing.T, query string, contentType string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/paste"+query, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req = req.WithContext(context.WithValue(req.Context(), "user", "testuser"))
+	w := httptest.NewRecorder()
+	paste(w, req)
+	return w
+}
+
+func TestPaste(t *testing.T) {
+	setupFileTest(t)
+	image := encodePNG(t, 20, 20)
+
+	w := pasteRequest(t, "?format=data-url", "image/png", image)
+	if w.Code != http.StatusOK {
+		t.Fatalf("raw image: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var pasted PastedFile
+	if err := json.Unmarshal(w.Body.Bytes(), &pasted); err != nil {
+		t.Fatal(err)
+	}
+	if pasted.Type != "image/png" || !strings.HasSuffix(pasted.Name, ".png") || pasted.ExpiresAt != nil {
+		t.Errorf("unexpected file: %+v", pasted.File)
+	}
+	if !strings.HasPrefix(pasted.DataURL, "data:image/png;base64,") {
+		t.Errorf("expected a data URL, got %q", pasted.DataURL)
+	}
+
+	dataURL := "data:image/png;base64," + base64.StdEncoding.EncodeToString(image)
+	w = pasteRequest(t, "?ephemeral=true&name=shot.png", "text/plain", []byte(dataURL))
+	if w.Code != http.StatusOK {
+		t.Fatalf("data URL: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var ephemeral PastedFile
+	if err := json.Unmarshal(w.Body.Bytes(), &ephemeral); err != nil {
+		t.Fatal(err)
+	}
+	if ephemeral.Name != "shot.png" || ephemeral.ExpiresAt == nil || ephemeral.DataURL != "" {
+		t.Errorf("unexpected ephemeral file: %+v", ephemeral)
+	}
+	if listed, _ := repo.GetAll("testuser"); len(listed) != 1 || listed[0].ID != pasted.ID {
+		t.Errorf("expected ephemeral files to be left out of the listing, got %+v", listed)
+	}
+
+	if w := pasteRequest(t, "", "text/plain", []byte("not base64!")); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid base64: expected 400, got %d", w.Code)
+	}
+	if w := pasteRequest(t, "", "application/octet-stream", []byte("%PDF-1.4 not an image")); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("not an image: expected 415, got %d", w.Code)
+	}
+
+	// sending the message lets only the ephemeral paste expire
+	if err := ExpireEphemeral([]string{pasted.ID, ephemeral.ID}, "testuser"); err != nil {
+		t.Fatal(err)
+	}
+	purge(time.Now().Add(time.Second))
+	if found, _ := repo.GetByIDs([]string{pasted.ID, ephemeral.ID}, "testuser"); len(found) != 1 || found[0].ID != pasted.ID {
+		t.Errorf("expected only the kept paste to remain, got %+v", found)
+	}
+	if _, err := os.Stat(ephemeral.Path); !os.IsNotExist(err) {
+		t.Errorf("expected the ephemeral image to be deleted, got %v", err)
+	}
+}
+
+func TestPasteThroughMiddleware(t *testing.T) {
+	setupFileTest(t)
+	utils.Setup(log)
+	handler := utils.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paste(w, r.WithContext(context.WithValue(r.Context(), "user", "testuser")))
+	}))
+	send := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/files/paste", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	image := encodePNG(t, 20, 20)
+	if w := send("image/png", image); w.Code != http.StatusOK {
+		t.Errorf("raw image: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	dataURL := "data:image/png;base64," + base64.StdEncoding.EncodeToString(image)
+	if w := send("text/plain", []byte(dataURL)); w.Code != http.StatusOK {
+		t.Errorf("data URL: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("image/png", make([]byte, utils.MaxUploadSize()*4/3+2048)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized paste: expected 413, got %d", w.Code)
+	}
+}
+
+func TestEphemeralUpload(t *testing.T) {
+	setupFileTest(t)
+	if err := settings.Save(map[string]string{"ephemeralFileTTL": "2"}, "testuser"); err != nil {
+		t.Fatal(err)
+	}
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, _ := form.CreateFormFile("file", "notes.txt")
+	part.Write([]byte("some notes"))
+	form.WriteField("ephemeral", "true")
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req = req.WithContext(context.WithValue(req.Context(), "user", "testuser"))
+	w := httptest.NewRecorder()
+	upload(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var file File
+	if err := json.Unmarshal(w.Body.Bytes(), &file); err != nil {
+		t.Fatal(err)
+	}
+	if file.ExpiresAt == nil || file.ExpiresAt.Sub(time.Now()) < time.Hour || file.ExpiresAt.Sub(time.Now()) > 2*time.Hour {
+		t.Fatalf("expected the file to expire in 2 hours, got %v", file.ExpiresAt)
+	}
+
+	purge(time.Now().Add(time.Hour))
+	if found, _ := repo.GetByIDs([]string{file.ID}, "testuser"); len(found) != 1 {
+		t.Error("the file was deleted before it expired")
+	}
+	purge(time.Now().Add(3 * time.Hour))
+	if found, _ := repo.GetByIDs([]string{file.ID}, "testuser"); len(found) != 0 {
+		t.Error("the file was kept after it expired")
+	}
+}
@@ -97,7 +97,7 @@ func RenderDocPageAsImage(path string, pageNumber int, user string) (File, error
 	}
 	header.Header.Set("Content-Type", "image/jpeg")
 
-	return saveUploadedFile(file, header, user)
+	return saveUploadedFile(file, header, user, nil)
 }
 
 // func readPDF(path string) (string, error) {
@@ -3,6 +3,7 @@ package files
 import (
 	"database/sql"
 	"strings"
+	"time"
 
 	"github.com/Bajahaw/ai-ui/cmd/data"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
@@ -28,6 +29,10 @@ type File struct {
 	User       string `json:"user,omitempty"`
 	CreatedAt  string `json:"createdAt"`
 	UploadedAt string `json:"uploadedAt"`
+	// Description is a note of the user sent to models with the content
+	Description string `json:"description"`
+	// ExpiresAt is when an ephemeral file is deleted, nil for kept files
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 }
 
 type FilePage struct {
@@ -52,9 +57,13 @@ type Repository interface {
 	GetPagesRange(fileID string, startPage int, endPage int) ([]FilePage, error)
 	SearchPages(fileID string, query string, limit int) ([]FilePage, error)
 	UpdateContent(id string, user string, content string) error
+	Update(file File) error
 	UpdateSize(id string, user string, size int64) error
 	DeleteByID(id string, user string) error
 	GetAllConversationAttachments(convID string) map[int][]Attachment
+	Expire(ids []string, user string, at time.Time) error
+	GetExpired(now time.Time) ([]File, error)
+	ExpireUploadedBefore(user string, cutoff time.Time, at time.Time) (int, error)
 }
 
 type RepositoryImpl struct {
@@ -67,9 +76,9 @@ func NewRepository(db *sql.DB) Repository {
 
 func (r *RepositoryImpl) GetAll(user string) ([]File, error) {
 	fileSql := `
-	SELECT id, name, type, size, path, url, content, created_at, uploaded_at
+	SELECT id, name, type, size, path, url, content, description, created_at, uploaded_at, expires_at
 	FROM Files
-	WHERE user = ?
+	WHERE user = ? AND expires_at IS NULL
 	`
 
 	rows, err := r.db.Query(fileSql, user)
@@ -89,8 +98,10 @@ func (r *RepositoryImpl) GetAll(user string) ([]File, error) {
 			&file.Path,
 			&file.URL,
 			&file.Content,
+			&file.Description,
 			&file.CreatedAt,
 			&file.UploadedAt,
+			&file.ExpiresAt,
 		); err != nil {
 			continue // mimic original behavior of skipping errors?
 		}
@@ -105,7 +116,7 @@ func (r *RepositoryImpl) GetByIDs(fileIDs []string, user string) ([]File, error)
 	}
 
 	fileSql := `
-	SELECT id, name, type, size, path, url, content, created_at, uploaded_at
+	SELECT id, name, type, size, path, url, content, description, created_at, uploaded_at, expires_at
 	FROM Files
 	WHERE id IN (` + utils.SqlPlaceholders(len(fileIDs)) + `) AND user = ?
 	`
@@ -133,8 +144,10 @@ func (r *RepositoryImpl) GetByIDs(fileIDs []string, user string) ([]File, error)
 			&file.Path,
 			&file.URL,
 			&file.Content,
+			&file.Description,
 			&file.CreatedAt,
 			&file.UploadedAt,
+			&file.ExpiresAt,
 		); err != nil {
 			continue
 		}
@@ -145,7 +158,7 @@ func (r *RepositoryImpl) GetByIDs(fileIDs []string, user string) ([]File, error)
 }
 
 func (r *RepositoryImpl) Save(file File) error {
-	attSql := `INSERT INTO Files (id, name, type, size, path, url, content, user, created_at, uploaded_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	attSql := `INSERT INTO Files (id, name, type, size, path, url, content, description, user, created_at, uploaded_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	_, err := r.db.Exec(attSql,
 		file.ID,
 		file.Name,
@@ -154,9 +167,11 @@ func (r *RepositoryImpl) Save(file File) error {
 		file.Path,
 		file.URL,
 		file.Content,
+		file.Description,
 		file.User,
 		file.CreatedAt,
 		file.UploadedAt,
+		file.ExpiresAt,
 	)
 	return err
 }
@@ -256,6 +271,20 @@ func (r *RepositoryImpl) UpdateContent(id string, user string, content string) e
 	return err
 }
 
+// Update saves the name, content and description of a file of its user,
+// sql.ErrNoRows means there is no such file.
+func (r *RepositoryImpl) Update(file File) error {
+	updateSql := `UPDATE Files SET name = ?, content = ?, description = ? WHERE id = ? AND user = ?`
+	result, err := r.db.Exec(updateSql, file.Name, file.Content, file.Description, file.ID, file.User)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 func (r *RepositoryImpl) UpdateSize(id string, user string, size int64) error {
 	updateSql := `UPDATE Files SET size = ? WHERE id = ? AND user = ?`
 	_, err := r.db.Exec(updateSql, size, id, user)
@@ -268,16 +297,108 @@ func (r *RepositoryImpl) DeleteByID(id string, user string) error {
 	return err
 }
 
+// Expire moves the expiry of the user's ephemeral files among ids to at,
+// files that are kept stay kept.
+func (r *RepositoryImpl) Expire(ids []string, user string, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := []any{at}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	args = append(args, user)
+	expireSql := `
+	UPDATE Files SET expires_at = ?
+	WHERE id IN (` + utils.SqlPlaceholders(len(ids)) + `) AND user = ? AND expires_at IS NOT NULL
+	`
+	_, err := r.db.Exec(expireSql, args...)
+	return err
+}
+
+// GetExpired returns the files of all users that expired by now.
+func (r *RepositoryImpl) GetExpired(now time.Time) ([]File, error) {
+	rows, err := r.db.Query(`SELECT id, path, user FROM Files WHERE expires_at <= ?`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		var file File
+		if err := rows.Scan(&file.ID, &file.Path, &file.User); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// ExpireUploadedBefore lets the user's kept files uploaded before cutoff
+// expire at, and returns how many there were. Files in a knowledge base,
+// used as an avatar or attached to a pinned conversation are kept.
+func (r *RepositoryImpl) ExpireUploadedBefore(user string, cutoff time.Time, at time.Time) (int, error) {
+	rows, err := r.db.Query(`
+	SELECT f.id, f.uploaded_at FROM Files f
+	WHERE f.user = ? AND f.expires_at IS NULL
+	AND NOT EXISTS (SELECT 1 FROM KnowledgeBaseFiles kb WHERE kb.file_id = f.id)
+	AND NOT EXISTS (SELECT 1 FROM Profiles p WHERE p.avatar_file_id = f.id)
+	AND NOT EXISTS (
+		SELECT 1 FROM Attachments a
+		JOIN Messages m ON a.message_id = m.id
+		JOIN Conversations c ON m.conv_id = c.id
+		WHERE a.file_id = f.id AND c.pinned = 1
+	)
+	AND NOT EXISTS (
+		SELECT 1 FROM ToolCalls tc
+		JOIN Conversations c ON tc.conv_id = c.id
+		WHERE tc.file_id = f.id AND c.pinned = 1
+	)
+	`, user)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	// uploaded_at is RFC 3339 text in the server's zone, so it is compared
+	// here rather than in SQL
+	var ids []any
+	for rows.Next() {
+		var id, uploadedAt string
+		if err := rows.Scan(&id, &uploadedAt); err != nil {
+			return 0, err
+		}
+		uploaded, err := time.Parse(time.RFC3339, uploadedAt)
+		if err != nil || !uploaded.Before(cutoff) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	expireSql := `UPDATE Files SET expires_at = ? WHERE id IN (` + utils.SqlPlaceholders(len(ids)) + `)`
+	if _, err := r.db.Exec(expireSql, append([]any{at}, ids...)...); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
 func (r *RepositoryImpl) GetAllConversationAttachments(convID string) map[int][]Attachment {
 	attachments := make(map[int][]Attachment)
 	sql := `
-	SELECT a.id, a.message_id, f.id, f.name, f.type, f.size, f.path, f.url, f.content, f.created_at
+	SELECT a.id, a.message_id, f.id, f.name, f.type, f.size, f.path, f.url, f.content, f.description, f.created_at
 	FROM Attachments a
 	JOIN Messages m ON a.message_id = m.id
 	JOIN Files f ON a.file_id = f.id
 	WHERE m.conv_id = ?
 	`
-	rows, err := data.DB.Query(sql, convID)
+	rows, err := data.Query(data.DB, sql, convID)
 	if err != nil {
 		log.Error("Error querying conversation attachments", "err", err)
 		return attachments
@@ -297,6 +418,7 @@ func (r *RepositoryImpl) GetAllConversationAttachments(convID string) map[int][]
 			&file.Path,
 			&file.URL,
 			&file.Content,
+			&file.Description,
 			&file.CreatedAt,
 		); err != nil {
 			log.Error("Error scanning attachment", "err", err)
@@ -1,22 +1,55 @@
 package files
 
 import (
+	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/idempotency"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 )
 
 func FileHandler() http.Handler {
-	mux := http.NewServeMux()
+	mux := openapi.NewRouter("/api/files", "Files")
 
-	mux.HandleFunc("POST 	/upload", upload)
-	mux.HandleFunc("GET 	/{id}", getFile)
-	mux.HandleFunc("GET 	/all", getAllFiles)
-	mux.HandleFunc("DELETE 	/delete/{id}", deleteFile)
-	mux.HandleFunc("POST 	/extract-content", extractContent)
+	mux.HandleFunc("POST 	/upload", idempotency.Handle(upload), openapi.Op{
+		Summary:     "Upload a file",
+		Description: "Set the ephemeral form field to true to delete the file once the message it is attached to is sent, or after the hours of the ephemeralFileTTL setting. " + idempotency.Description,
+		Upload:      "file",
+		Response:    File{},
+	})
+	mux.HandleFunc("POST 	/paste", idempotency.Handle(paste), openapi.Op{
+		Summary:     "Upload a pasted image",
+		Description: "The body is the image, or its base64 text with or without a data URL prefix. " + idempotency.Description,
+		Query: []openapi.Param{
+			{Name: "name", Description: "File name, pasted-<time> by default"},
+			{Name: "ephemeral", Description: "true to delete the image once the message it is attached to is sent, or after the hours of the ephemeralFileTTL setting"},
+			{Name: "format", Description: "data-url to also return the stored image as a data URL"},
+		},
+		Response: PastedFile{},
+	})
+	mux.HandleFunc("GET 	/{id}", getFile, openapi.Op{Summary: "Get a file", Response: File{}})
+	mux.HandleFunc("GET 	/all", getAllFiles, openapi.Op{Summary: "List the files of the user, without ephemeral ones", Response: []File{}})
+	mux.HandleFunc("PATCH 	/{id}", updateFile, openapi.Op{
+		Summary:     "Rename a file, correct its extracted text or describe it",
+		Description: "Fields that are left out are kept. The description is sent to models along with the content of the file.",
+		Request:     FileUpdate{},
+		Response:    File{},
+	})
+	mux.HandleFunc("DELETE 	/delete/{id}", deleteFile, openapi.Op{Summary: "Delete a file", Status: http.StatusNoContent})
+	mux.HandleFunc("POST 	/batch-delete", batchDelete, openapi.Op{Summary: "Delete several files", Request: BatchRequest{}, Response: BatchDeleteResponse{}})
+	mux.HandleFunc("POST 	/batch-download", batchDownload, openapi.Op{
+		Summary:     "Download several files as a zip archive",
+		Description: "Files are stored under their names, numbered when several share one.",
+		Request:     BatchRequest{},
+		ContentType: "application/zip",
+	})
+	mux.HandleFunc("POST 	/extract-content", extractContent, openapi.Op{Summary: "Extract the text of files, with OCR when needed", Request: ExtractRequest{}, Response: []File{}})
 
 	return http.StripPrefix("/api/files", auth.Authenticated(mux))
 }
@@ -54,14 +87,14 @@ func upload(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseMultipartForm(10 << 20) // limit to 10MB
 	if err != nil {
 		log.Error("Error parsing multipart form", "err", err)
-		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		utils.Error(w, "Error parsing form data", http.StatusBadRequest)
 		return
 	}
 
 	file, handler, err := r.FormFile("file")
 	if err != nil {
 		log.Error("Error retrieving file from form data", "err", err)
-		http.Error(w, "Error retrieving file", http.StatusBadRequest)
+		utils.Error(w, "Error retrieving file", http.StatusBadRequest)
 		return
 	}
 
@@ -72,10 +105,15 @@ func upload(w http.ResponseWriter, r *http.Request) {
 
 	defer file.Close()
 
-	fileData, err := saveUploadedFile(file, handler, user)
+	var expiresAt *time.Time
+	if r.FormValue("ephemeral") == "true" {
+		expiresAt = ephemeralExpiry(user, time.Now())
+	}
+
+	fileData, err := saveUploadedFile(file, handler, user, expiresAt)
 	if err != nil {
 		log.Error("Error saving uploaded file", "err", err)
-		http.Error(w, "Error saving file", http.StatusInternalServerError)
+		utils.Error(w, "Error saving file", http.StatusInternalServerError)
 		return
 	}
 
@@ -88,7 +126,7 @@ func getFile(w http.ResponseWriter, r *http.Request) {
 	files, err := repo.GetByIDs([]string{id}, user)
 	if err != nil || len(files) == 0 {
 		log.Warn("File not found", "id", id, "err", err)
-		http.Error(w, "File not found", http.StatusNotFound)
+		utils.Error(w, "File not found", http.StatusNotFound)
 		return
 	}
 
@@ -103,21 +141,21 @@ func deleteFile(w http.ResponseWriter, r *http.Request) {
 	files, err := repo.GetByIDs([]string{id}, user)
 	if err != nil || len(files) == 0 {
 		log.Warn("File not found for deletion", "id", id, "err", err)
-		http.Error(w, "File not found", http.StatusNotFound)
+		utils.Error(w, "File not found", http.StatusNotFound)
 		return
 	}
 
 	err = os.Remove(files[0].Path)
 	if err != nil {
 		log.Error("Error deleting physical file", "err", err)
-		http.Error(w, "Error deleting file: "+err.Error(), http.StatusInternalServerError)
+		utils.Error(w, "Error deleting file: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	err = repo.DeleteByID(id, user)
 	if err != nil {
 		log.Error("Error deleting file record from database", "err", err)
-		http.Error(w, "Error deleting file record: "+err.Error(), http.StatusInternalServerError)
+		utils.Error(w, "Error deleting file record: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -130,40 +168,101 @@ func getAllFiles(w http.ResponseWriter, r *http.Request) {
 	files, err := repo.GetAll(user)
 	if err != nil {
 		log.Error("Error querying all files", "err", err)
-		http.Error(w, "Error retrieving files", http.StatusInternalServerError)
+		utils.Error(w, "Error retrieving files", http.StatusInternalServerError)
 		return
 	}
 
 	utils.RespondWithJSON(w, files, http.StatusOK)
 }
 
-func extractContent(w http.ResponseWriter, r *http.Request) {
+const (
+	maxFileNameLength    = 255
+	maxDescriptionLength = 2000
+)
+
+type FileUpdate struct {
+	Name        *string `json:"name,omitempty"`
+	Content     *string `json:"content,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+func updateFile(w http.ResponseWriter, r *http.Request) {
 	user := utils.ExtractContextUser(r)
-	var req struct {
-		FileIDs []string `json:"fileIds"`
+	id := r.PathValue("id")
+	var req FileUpdate
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	found, err := repo.GetByIDs([]string{id}, user)
+	if err != nil || len(found) == 0 {
+		utils.Error(w, "File not found", http.StatusNotFound)
+		return
 	}
+	file := found[0]
+	file.User = user
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || utf8.RuneCountInString(name) > maxFileNameLength || strings.ContainsAny(name, "/\\\"\x00") {
+			utils.Error(w, fmt.Sprintf("Name must be 1 to %d characters without slashes or quotes", maxFileNameLength), http.StatusBadRequest)
+			return
+		}
+		file.Name = name
+	}
+	if req.Content != nil {
+		file.Content = *req.Content
+	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		if utf8.RuneCountInString(description) > maxDescriptionLength {
+			utils.Error(w, fmt.Sprintf("Description must be at most %d characters", maxDescriptionLength), http.StatusBadRequest)
+			return
+		}
+		file.Description = description
+	}
+
+	if err := repo.Update(file); err != nil {
+		log.Error("Error updating file", "id", id, "err", err)
+		utils.Error(w, "Error updating file", http.StatusInternalServerError)
+		return
+	}
+	updated(file)
+
+	file.User = ""
+	utils.RespondWithJSON(w, file, http.StatusOK)
+}
+
+type ExtractRequest struct {
+	FileIDs []string `json:"fileIds"`
+}
+
+func extractContent(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req ExtractRequest
 	if err := utils.ExtractJSONBody(r, &req); err != nil {
 		log.Error("Error parsing request body", "err", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	files, err := repo.GetByIDs(req.FileIDs, user)
 	if err != nil {
 		log.Error("Error querying files from db", "err", err)
-		http.Error(w, "Error retrieving files", http.StatusInternalServerError)
+		utils.Error(w, "Error retrieving files", http.StatusInternalServerError)
 		return
 	}
 
-	ocrModel, _ := settings.Get("ocrModel", user)
+	model := ocrModel(user)
 	updatedFiles := []File{}
 
 	for _, file := range files {
 		if file.Content == "" {
-			fileContent, err := extractFileContent(file, ocrModel)
+			fileContent, err := extractFileContent(r.Context(), file, model)
 			if err != nil {
 				log.Error("Error extracting file content", "err", err, "file", file.ID)
-				http.Error(w, "Error extracting content: "+err.Error(), http.StatusInternalServerError)
+				utils.Error(w, "Error extracting content: "+err.Error(), http.StatusInternalServerError)
 				return
 			}
 			file.Content = fileContent
@@ -180,3 +279,16 @@ func extractContent(w http.ResponseWriter, r *http.Request) {
 
 	utils.RespondWithJSON(w, updatedFiles, http.StatusOK)
 }
+
+// Remove deletes a file of the user and its stored data, a missing file is
+// not an error.
+func Remove(id string, user string) error {
+	found, err := repo.GetByIDs([]string{id}, user)
+	if err != nil || len(found) == 0 {
+		return err
+	}
+	if err := os.Remove(found[0].Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return repo.DeleteByID(id, user)
+}
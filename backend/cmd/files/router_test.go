@@ -0,0 +1,135 @@
+package files
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+
+	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
+	logger "github.com/charmbracelet/log"
+)
+
+// setupFileTest sets up the package with a fresh database, storing
+// uploads in a temporary directory.
+func setupFileTest(t *testing.T) *sql.DB {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	var db *sql.DB
+	repo, db = setupTestDB(t)
+	settings = stngs.NewRepository(db)
+	log = logger.New(os.Stdout)
+	return db
+}
+
+func patchFile(t *testing.T, id string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPatch, "/"+id, bytes.NewBufferString(body))
+	req.SetPathValue("id", id)
+	req = req.WithContext(context.WithValue(req.Context(), "user", "testuser"))
+	w := httptest.NewRecorder()
+	updateFile(w, req)
+	return w
+}
+
+func TestUpdateFile(t *testing.T) {
+	db := setupFileTest(t)
+	seedFile(t, db, "scan")
+	var notified []File
+	updateHooks = []func(File){func(file File) { notified = append(notified, file) }}
+	t.Cleanup(func() { updateHooks = nil })
+
+	w := patchFile(t, "scan", `{"name": " receipt.pdf ", "content": "fixed text", "description": "bakery receipt"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var file File
+	if err := json.Unmarshal(w.Body.Bytes(), &file); err != nil {
+		t.Fatal(err)
+	}
+	if file.Name != "receipt.pdf" || file.Content != "fixed text" || file.Description != "bakery receipt" {
+		t.Errorf("unexpected file: %+v", file)
+	}
+	if len(notified) != 1 || notified[0].Description != "bakery receipt" {
+		t.Errorf("expected the update hooks to be called, got %+v", notified)
+	}
+
+	// left out fields are kept
+	if w := patchFile(t, "scan", `{"description": ""}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	found, _ := repo.GetByIDs([]string{"scan"}, "testuser")
+	if len(found) != 1 || found[0].Name != "receipt.pdf" || found[0].Content != "fixed text" || found[0].Description != "" {
+		t.Errorf("unexpected stored file: %+v", found)
+	}
+
+	if w := patchFile(t, "scan", `{"name": "../etc/passwd"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("name with a slash: expected 400, got %d", w.Code)
+	}
+	if w := patchFile(t, "scan", `{"name": "  "}`); w.Code != http.StatusBadRequest {
+		t.Errorf("empty name: expected 400, got %d", w.Code)
+	}
+	if w := patchFile(t, "missing", `{"name": "x"}`); w.Code != http.StatusNotFound {
+		t.Errorf("unknown file: expected 404, got %d", w.Code)
+	}
+}
+
+func TestBatchOperations(t *testing.T) {
+	setupFileTest(t)
+	var ids []string
+	for _, content := range []string{"first", "second", "third"} {
+		file, err := storeFile([]byte(content), File{Name: "notes.txt", Type: "text/plain", User: "testuser"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, file.ID)
+	}
+	batch := func(handler http.HandlerFunc, ids ...string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(BatchRequest{FileIDs: ids})
+		req := httptest.NewRequest(http.MethodPost, "/batch", bytes.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), "user", "testuser"))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	w := batch(batchDownload, ids[0], ids[1], ids[2], "missing")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("download: expected a zip, got %d: %s", w.Code, w.Body.String())
+	}
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range archive.File {
+		names = append(names, entry.Name)
+	}
+	if want := []string{"notes.txt", "notes (2).txt", "notes (3).txt"}; !slices.Equal(names, want) {
+		t.Errorf("got entries %v, want %v", names, want)
+	}
+
+	if w := batch(batchDelete); w.Code != http.StatusBadRequest {
+		t.Errorf("no files: expected 400, got %d", w.Code)
+	}
+	w = batch(batchDelete, ids[0], ids[1], ids[1], "missing")
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp BatchDeleteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Deleted) != 2 || len(resp.NotFound) != 1 || resp.NotFound[0] != "missing" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if left, _ := repo.GetAll("testuser"); len(left) != 1 || left[0].ID != ids[2] {
+		t.Errorf("expected only the third file to be left, got %+v", left)
+	}
+}
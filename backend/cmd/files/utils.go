@@ -2,8 +2,11 @@ package files
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"fmt"
 	"image"
+	"image/color"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
@@ -21,8 +24,34 @@ import (
 	"github.com/google/uuid"
 )
 
-func saveUploadedFile(file multipart.File, handler *multipart.FileHeader, user string) (File, error) {
-	const maxUploadSize = 10 << 20 // 10 MB
+const maxUploadSize = 10 << 20 // 10 MB
+
+// saveUploadedFile stores an upload, expiresAt is set for ephemeral files.
+func saveUploadedFile(file multipart.File, handler *multipart.FileHeader, user string, expiresAt *time.Time) (File, error) {
+	fileData, err := storeUpload(file, handler, user, expiresAt)
+	if err != nil {
+		return File{}, err
+	}
+
+	// ocr only is for images and other docs, the text is extracted in the
+	// background and read from the file once it is done
+	ocrOnly, _ := settings.Get("attachmentOcrOnly", user)
+	if ocrOnly == "true" {
+		if _, err := QueueExtraction(fileData.ID, user); err != nil {
+			log.Error("Error queuing content extraction", "file", fileData.ID, "err", err)
+		}
+	}
+
+	return fileData, nil
+}
+
+// StoreUpload saves an uploaded file of the user to the upload directory
+// and records it, without extracting its content.
+func StoreUpload(file multipart.File, handler *multipart.FileHeader, user string) (File, error) {
+	return storeUpload(file, handler, user, nil)
+}
+
+func storeUpload(file multipart.File, handler *multipart.FileHeader, user string, expiresAt *time.Time) (File, error) {
 	defer file.Close()
 
 	fileType, err := detectFileType(file)
@@ -37,14 +66,33 @@ func saveUploadedFile(file multipart.File, handler *multipart.FileHeader, user s
 		return File{}, err
 	}
 
-	n := len(data)
-	if n > maxUploadSize {
-		return File{}, fmt.Errorf("file too large: %d bytes (max %d)", n, maxUploadSize)
+	if len(data) > maxUploadSize {
+		return File{}, fmt.Errorf("file too large: %d bytes (max %d)", len(data), maxUploadSize)
+	}
+
+	createdAt := time.Now()
+	lastModifiedStr := handler.Header.Get("Last-Modified")
+	if lastModifiedStr != "" {
+		if ts, err := strconv.ParseInt(lastModifiedStr, 10, 64); err == nil {
+			createdAt = time.UnixMilli(ts)
+		}
 	}
 
+	return storeFile(data, File{
+		Name:      handler.Filename,
+		Type:      fileType,
+		User:      user,
+		CreatedAt: createdAt.Format(time.RFC3339),
+		ExpiresAt: expiresAt,
+	})
+}
+
+// storeFile compresses images, writes data to the upload directory and
+// records it with the name, type, owner and times set in file.
+func storeFile(data []byte, file File) (File, error) {
 	// Basic image compression for image types. If compression produces a smaller
 	// payload, use it; otherwise keep original bytes.
-	if strings.HasPrefix(fileType, "image/") {
+	if strings.HasPrefix(file.Type, "image/") {
 		compressed, err := compressImage(bytes.NewReader(data))
 		if err != nil {
 			return File{}, err
@@ -57,7 +105,7 @@ func saveUploadedFile(file multipart.File, handler *multipart.FileHeader, user s
 		return File{}, err
 	}
 
-	fileName := uuid.New().String() + path.Ext(handler.Filename)
+	fileName := uuid.New().String() + path.Ext(file.Name)
 	filePath := path.Join(uploadDir, fileName)
 
 	dst, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
@@ -66,7 +114,7 @@ func saveUploadedFile(file multipart.File, handler *multipart.FileHeader, user s
 	}
 	defer dst.Close()
 
-	n, err = dst.Write(data)
+	n, err := dst.Write(data)
 	if err != nil {
 		_ = os.Remove(filePath)
 		return File{}, err
@@ -76,62 +124,20 @@ func saveUploadedFile(file multipart.File, handler *multipart.FileHeader, user s
 		return File{}, fmt.Errorf("written bytes mismatch: wrote %d of %d", n, len(data))
 	}
 
-	uploadedAt := time.Now()
-
-	fileData := File{
-		ID:         uuid.NewString(),
-		Name:       handler.Filename,
-		Type:       fileType,
-		Size:       int64(len(data)),
-		Path:       filePath,
-		UploadedAt: uploadedAt.Format(time.RFC3339),
-	}
-
-	urlPath := strings.TrimPrefix(fileData.Path, ".")
-
-	if !strings.HasPrefix(urlPath, "/") {
-		urlPath = "/" + urlPath
-	}
-
-	if !strings.HasPrefix(urlPath, "/data/resources/") {
-		urlPath = "/data/resources/" + strings.TrimPrefix(urlPath, "/")
-	}
-
-	// fileUrl := utils.GetServerURL(r) + urlPath
-
-	createdAt := time.Now()
-	lastModifiedStr := handler.Header.Get("Last-Modified")
-	if lastModifiedStr != "" {
-		if ts, err := strconv.ParseInt(lastModifiedStr, 10, 64); err == nil {
-			createdAt = time.UnixMilli(ts)
-		}
-	}
+	file.ID = uuid.NewString()
+	file.Size = int64(len(data))
+	file.Path = filePath
+	file.UploadedAt = time.Now().Format(time.RFC3339)
 
-	fileData.User = user
-	// fileData.URL = fileUrl
-	fileData.CreatedAt = createdAt.Format(time.RFC3339)
+	log.Debug("Uploaded file data", "file", file)
 
-	log.Debug("Uploaded file data", "file", fileData)
-
-	// ocr only is for images and other docs
-	ocrOnly, _ := settings.Get("attachmentOcrOnly", user)
-	if ocrOnly == "true" {
-		ocrModel, _ := settings.Get("ocrModel", user)
-		fileContent, err := extractFileContent(fileData, ocrModel)
-		if err != nil {
-			return File{}, err
-		}
-		fileData.Content = fileContent
-		log.Debug("Extracted file content", "content", fileContent)
-	}
-
-	err = repo.Save(fileData)
+	err = repo.Save(file)
 	if err != nil {
 		_ = os.Remove(filePath)
 		return File{}, err
 	}
 
-	return fileData, nil
+	return file, nil
 }
 
 func detectFileType(file multipart.File) (string, error) {
@@ -193,10 +199,111 @@ func compressImage(r io.Reader) (*bytes.Buffer, error) {
 	return buf, nil
 }
 
+// MaxImageDimension is the longest side, in pixels, of images sent to models.
+// Larger images cost more tokens without helping most models.
+const MaxImageDimension = 2048
+
+// DownscaleImage shrinks the image so its longest side is at most maxDim,
+// keeping the aspect ratio. Images already within the limit are returned
+// unchanged. PNGs stay PNG to keep transparency, everything else becomes JPEG.
+func DownscaleImage(data []byte, mimeType string, maxDim int) ([]byte, string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return data, mimeType, err
+	}
+	if cfg.Width <= maxDim && cfg.Height <= maxDim {
+		return data, mimeType, nil
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return data, mimeType, err
+	}
+
+	w, h := maxDim, cfg.Height*maxDim/cfg.Width
+	if cfg.Height > cfg.Width {
+		w, h = cfg.Width*maxDim/cfg.Height, maxDim
+	}
+	resized := resizeImage(img, max(w, 1), max(h, 1))
+
+	buf := &bytes.Buffer{}
+	if format == "png" {
+		if err := png.Encode(buf, resized); err != nil {
+			return data, mimeType, err
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+	if err := jpeg.Encode(buf, resized, &jpeg.Options{Quality: 85}); err != nil {
+		return data, mimeType, err
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
+
+// resizeImage scales src down to w x h by averaging each box of source
+// pixels that maps onto one destination pixel.
+func resizeImage(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := range h {
+		y0 := b.Min.Y + y*sh/h
+		y1 := max(b.Min.Y+(y+1)*sh/h, y0+1)
+		for x := range w {
+			x0 := b.Min.X + x*sw/w
+			x1 := max(b.Min.X+(x+1)*sw/w, x0+1)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					bl += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+// ExtractContent runs the user's OCR model over the file and stores the
+// result, so later requests can reuse it. The OCR request stops once ctx
+// is done.
+func ExtractContent(ctx context.Context, file File, user string) (string, error) {
+	file.User = user
+	content, err := extractFileContent(ctx, file, ocrModel(user))
+	if err != nil {
+		return "", err
+	}
+	if err := repo.UpdateContent(file.ID, user, content); err != nil {
+		log.Error("Error saving extracted content", "file", file.ID, "err", err)
+	}
+	return content, nil
+}
+
+// ocrModel is the user's OCR model, or their utility model when unset.
+// Chats only extract text for models that cannot read the file, so the
+// model of the conversation is no fallback here.
+func ocrModel(user string) string {
+	if model, _ := settings.Get("ocrModel", user); model != "" {
+		return providers.ResolveModel(model, user)
+	}
+	return providers.UtilityModel(user, "")
+}
+
 // extractFileContent extracts text content from the file at the given URL.
 // It sends a request to the OCR service and returns the extracted text.
 // currently supports images only. if file content is text, then it is not sent to OCR.
-func extractFileContent(file File, model string) (string, error) {
+func extractFileContent(ctx context.Context, file File, model string) (string, error) {
 	log.Debug("Extracting content from file", "path", file.Path, "type", file.Type)
 	if strings.HasPrefix(file.Type, "text/") {
 		fileContent, err := os.ReadFile(file.Path)
@@ -208,6 +315,10 @@ func extractFileContent(file File, model string) (string, error) {
 	}
 
 	if IsRetrievableDoc(file.Type) {
+		// pages are indexed once, even when the text is extracted again
+		if page, err := repo.GetPage(file.ID, 1); err == nil {
+			return "Document content page 1: \n\n" + page.Content + "... retrieve rest of content using tools", nil
+		}
 		pages, err := readDocPages(file.Path, file.ID)
 		if err != nil {
 			log.Error("Error reading document pages", "err", err, "type", file.Type)
@@ -225,6 +336,20 @@ func extractFileContent(file File, model string) (string, error) {
 	}
 
 	if strings.HasPrefix(file.Type, "image/") {
+		imageURL := file.URL
+		if imageURL == "" {
+			data, err := os.ReadFile(file.Path)
+			if err != nil {
+				log.Error("Error reading image file", "err", err)
+				return "", err
+			}
+			data, mimeType, err := DownscaleImage(data, file.Type, MaxImageDimension)
+			if err != nil {
+				log.Warn("Could not downscale image, sending original", "err", err)
+			}
+			imageURL = "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+		}
+
 		params := providers.RequestParams{
 			Messages: []providers.SimpleMessage{
 				{
@@ -238,13 +363,17 @@ func extractFileContent(file File, model string) (string, error) {
 						"as much as possible. If main content is not text, " +
 						"provide a detailed description of the image instead.",
 					Images: []string{
-						file.URL,
+						imageURL,
 					},
 				},
 			},
-			Model: model,
-			User:  file.User,
+			Context: ctx,
+			Model:   model,
+			User:    file.User,
 		}
+		// deterministic output lets repeated OCR of the same image hit the cache
+		temperature := 0.0
+		params.Temperature = &temperature
 
 		response, err := provider.SendChatCompletionRequest(params)
 		if err != nil || len(response.Content) == 0 {
@@ -0,0 +1,87 @@
+package files
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.SetRGBA(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDownscaleImageKeepsSmallImages(t *testing.T) {
+	data := encodePNG(t, 40, 20)
+
+	out, mimeType, err := DownscaleImage(data, "image/png", 64)
+	if err != nil {
+		t.Fatalf("DownscaleImage: %v", err)
+	}
+	if !bytes.Equal(out, data) || mimeType != "image/png" {
+		t.Errorf("small image was re-encoded")
+	}
+}
+
+func TestDownscaleImageKeepsAspectRatio(t *testing.T) {
+	data := encodePNG(t, 100, 400)
+
+	out, mimeType, err := DownscaleImage(data, "image/png", 50)
+	if err != nil {
+		t.Fatalf("DownscaleImage: %v", err)
+	}
+	if mimeType != "image/png" {
+		t.Errorf("mime type = %q, want image/png", mimeType)
+	}
+	cfg, err := png.DecodeConfig(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if cfg.Width != 12 || cfg.Height != 50 {
+		t.Errorf("size = %dx%d, want 12x50", cfg.Width, cfg.Height)
+	}
+}
+
+func TestDownscaleImageConvertsToJPEG(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out, mimeType, err := DownscaleImage(buf.Bytes(), "image/jpeg", 150)
+	if err != nil {
+		t.Fatalf("DownscaleImage: %v", err)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if mimeType != "image/jpeg" || cfg.Width != 150 || cfg.Height != 100 {
+		t.Errorf("got %s %dx%d, want image/jpeg 150x100", mimeType, cfg.Width, cfg.Height)
+	}
+}
+
+func TestDownscaleImageRejectsGarbage(t *testing.T) {
+	data := []byte("not an image")
+	out, mimeType, err := DownscaleImage(data, "image/png", 10)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !bytes.Equal(out, data) || mimeType != "image/png" {
+		t.Errorf("original data should be returned on error")
+	}
+}
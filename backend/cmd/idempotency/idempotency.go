@@ -0,0 +1,294 @@
+// Package idempotency lets clients retry POST requests safely. A request
+// sent with an Idempotency-Key header runs once; retries with the same key
+// get the recorded response instead of running it again, so a dropped
+// connection does not create a duplicate message or file.
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+const Header = "Idempotency-Key"
+
+// Description documents idempotent routes in the API spec.
+const Description = "Retries with the same Idempotency-Key header replay the recorded response."
+
+// ReplayedHeader marks a recorded response.
+const ReplayedHeader = "Idempotent-Replayed"
+
+const maxKeyLength = 255
+
+// maxRecorded caps the response kept for replay, a longer one is not
+// recorded and its key is released.
+const maxRecorded = 16 << 20
+
+// Handle makes next idempotent for requests that carry an Idempotency-Key.
+// Keys are per user and remembered for idempotencyKeyTTL. Responses with
+// a 429 or 5xx status, and event streams that did not finish cleanly, are
+// not recorded, retrying those runs the request again.
+func Handle(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" || repo == nil {
+			next(w, r)
+			return
+		}
+		if !validKey(key) {
+			utils.RespondWithError(w, apierr.BadRequest, "Idempotency-Key must be 1 to 255 printable ASCII characters", http.StatusBadRequest)
+			return
+		}
+
+		user := utils.ExtractContextUser(r)
+		endpoint := endpointOf(r)
+		cutoff := time.Now().Add(-config.Duration("idempotencyKeyTTL"))
+		record, fresh, err := repo.Reserve(user, key, endpoint, cutoff)
+		if err != nil {
+			log.Error("Error reserving idempotency key, running the request without it", "err", err)
+			next(w, r)
+			return
+		}
+		if !fresh {
+			replay(w, r, record, endpoint)
+			return
+		}
+
+		body, unread := newFingerprint(r), r.Body
+		r.Body = teeBody{Reader: io.TeeReader(unread, body), Closer: unread}
+		// ends the hashing of a multipart body when the key is released
+		defer body.sum()
+		rec := &recorder{ResponseWriter: w}
+
+		completed := false
+		defer func() {
+			if !completed {
+				// next panicked, let a retry run the request again
+				_ = repo.Release(user, key)
+			}
+		}()
+		next(rec, r)
+		completed = true
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if rec.overflow || rec.status == http.StatusTooManyRequests || rec.status >= 500 || interrupted(rec, r) {
+			if err := repo.Release(user, key); err != nil {
+				log.Error("Error releasing idempotency key", "err", err)
+			}
+			return
+		}
+
+		err = repo.Complete(user, key, &Record{
+			Fingerprint: fingerprint(body, unread),
+			Status:      rec.status,
+			ContentType: rec.Header().Get("Content-Type"),
+			Body:        rec.body,
+		})
+		if err != nil {
+			log.Error("Error recording idempotent response", "err", err)
+		}
+	}
+}
+
+// interrupted reports whether an event stream ended before its complete
+// event, with an error event, or with the client gone. Replaying it would
+// hand the truncated answer to every retry.
+func interrupted(rec *recorder, r *http.Request) bool {
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") {
+		return false
+	}
+	if rec.writeFailed || r.Context().Err() != nil {
+		return true
+	}
+	body := string(rec.body)
+	return strings.Contains(body, "event: "+utils.EVENT_ERROR+"\n") ||
+		!strings.Contains(body, "event: "+utils.EVENT_COMPLETE+"\n")
+}
+
+func replay(w http.ResponseWriter, r *http.Request, record *Record, endpoint string) {
+	if record.Endpoint != endpoint {
+		utils.RespondWithError(w, apierr.IdempotencyKeyReused, "Idempotency-Key was already used for another request", http.StatusUnprocessableEntity)
+		return
+	}
+	if record.Status == 0 {
+		utils.RespondWithError(w, apierr.IdempotencyKeyInUse, "A request with this Idempotency-Key is still running", http.StatusConflict)
+		return
+	}
+	if fingerprint(newFingerprint(r), r.Body) != record.Fingerprint {
+		utils.RespondWithError(w, apierr.IdempotencyKeyReused, "Idempotency-Key was already used with a different body", http.StatusUnprocessableEntity)
+		return
+	}
+
+	log.Debug("Replaying idempotent response", "endpoint", endpoint)
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(record.Status)
+	_, _ = w.Write(record.Body)
+}
+
+// fingerprinter hashes a request body as it is written to it.
+type fingerprinter interface {
+	io.Writer
+	sum() string
+}
+
+// newFingerprint hashes the raw body, or the parts of a multipart body,
+// whose boundary is picked at random for every retry.
+func newFingerprint(r *http.Request) fingerprinter {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return rawFingerprint{sha256.New()}
+	}
+	pr, pw := io.Pipe()
+	f := &partsFingerprint{PipeWriter: pw, done: make(chan string, 1)}
+	go func() {
+		f.done <- hashParts(multipart.NewReader(pr, params["boundary"]))
+		// keep reading so writes never block on a malformed body
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+	return f
+}
+
+// fingerprint hashes the rest of body into f, which may already hold the
+// part of the body the handler read.
+func fingerprint(f fingerprinter, body io.Reader) string {
+	_, _ = io.Copy(f, body)
+	return f.sum()
+}
+
+type rawFingerprint struct {
+	hash.Hash
+}
+
+func (f rawFingerprint) sum() string {
+	return hex.EncodeToString(f.Sum(nil))
+}
+
+// partsFingerprint feeds the body to hashParts as it is written.
+type partsFingerprint struct {
+	*io.PipeWriter
+	done   chan string
+	once   sync.Once
+	result string
+}
+
+func (f *partsFingerprint) sum() string {
+	f.once.Do(func() {
+		_ = f.Close()
+		f.result = <-f.done
+	})
+	return f.result
+}
+
+// hashParts hashes the field name, file name and content of every part.
+// A malformed body hashes the parts up to the error, and the error.
+func hashParts(mr *multipart.Reader) string {
+	h := sha256.New()
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(h, "error %q\n", err)
+			break
+		}
+		content := sha256.New()
+		_, err = io.Copy(content, part)
+		fmt.Fprintf(h, "%q %q %x\n", part.FormName(), part.FileName(), content.Sum(nil))
+		if err != nil {
+			fmt.Fprintf(h, "error %q\n", err)
+			break
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// endpointOf is the method and the full path, routers strip their prefix
+// from r.URL.Path.
+func endpointOf(r *http.Request) string {
+	path, _, _ := strings.Cut(r.RequestURI, "?")
+	if path == "" {
+		path = r.URL.Path
+	}
+	return r.Method + " " + path
+}
+
+func validKey(key string) bool {
+	if len(key) > maxKeyLength {
+		return false
+	}
+	for i := range len(key) {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+type teeBody struct {
+	io.Reader
+	io.Closer
+}
+
+// recorder keeps a copy of the response while it is written, flushing
+// through so streams still reach the client as they are generated.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	body        []byte
+	overflow    bool
+	writeFailed bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if !rec.overflow {
+		if len(rec.body)+len(p) > maxRecorded {
+			rec.overflow = true
+			rec.body = nil
+		} else {
+			rec.body = append(rec.body, p...)
+		}
+	}
+	n, err := rec.ResponseWriter.Write(p)
+	if err != nil {
+		rec.writeFailed = true
+	}
+	return n, err
+}
+
+func (rec *recorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rec *recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
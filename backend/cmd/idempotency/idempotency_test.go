@@ -0,0 +1,203 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func setupTest(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	SetupIdempotency(logger.New(os.Stdout), db)
+}
+
+func send(handler http.HandlerFunc, target string, key string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), "user", "u"))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestHandle(t *testing.T) {
+	setupTest(t)
+
+	runs := 0
+	handler := Handle(func(w http.ResponseWriter, r *http.Request) {
+		runs++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("event: complete\ndata: run " + string(body) + "\n\n"))
+	})
+
+	first := send(handler, "/api/files/upload", "key-1", "a")
+	retry := send(handler, "/api/files/upload", "key-1", "a")
+	if runs != 1 {
+		t.Fatalf("expected the request to run once, ran %d times", runs)
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the recorded response, got %d %q", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("Content-Type") != "text/event-stream" || retry.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("unexpected replay headers %v", retry.Header())
+	}
+
+	if rr := send(handler, "/api/files/upload", "key-1", "b"); rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), string(apierr.IdempotencyKeyReused)) {
+		t.Errorf("expected a different body to be rejected, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := send(handler, "/api/chat/stream", "key-1", "a"); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected another endpoint to be rejected, got %d", rr.Code)
+	}
+
+	send(handler, "/api/files/upload", "", "a")
+	send(handler, "/api/files/upload", "", "a")
+	if runs != 3 {
+		t.Errorf("expected requests without a key to always run, ran %d times", runs)
+	}
+
+	if rr := send(handler, "/api/files/upload", "bad key", "a"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid key to be rejected, got %d", rr.Code)
+	}
+}
+
+func TestHandleRetriesFailures(t *testing.T) {
+	setupTest(t)
+
+	runs := 0
+	handler := Handle(func(w http.ResponseWriter, r *http.Request) {
+		runs++
+		if runs == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
+	send(handler, "/api/chat/stream", "key", "{}")
+	if rr := send(handler, "/api/chat/stream", "key", "{}"); rr.Body.String() != "ok" || runs != 2 {
+		t.Errorf("expected a failed request to run again, got %q after %d runs", rr.Body.String(), runs)
+	}
+}
+
+func TestHandleRetriesInterruptedStreams(t *testing.T) {
+	setupTest(t)
+
+	runs := 0
+	handler := Handle(func(w http.ResponseWriter, r *http.Request) {
+		runs++
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: content\ndata: {\"content\":\"half an\"}\n\n"))
+		switch runs {
+		case 1:
+			w.Write([]byte("event: error\ndata: {\"error\":\"provider error\"}\n\nevent: complete\ndata: {}\n\n"))
+		case 2:
+		default:
+			w.Write([]byte("event: complete\ndata: {}\n\n"))
+		}
+	})
+
+	// an error event and a stream cut off before it completed
+	send(handler, "/api/chat/stream", "key", "{}")
+	send(handler, "/api/chat/stream", "key", "{}")
+	if runs != 2 {
+		t.Fatalf("expected the interrupted stream to run again, ran %d times", runs)
+	}
+
+	// a client that disconnected, even though the stream completed
+	req := httptest.NewRequest(http.MethodPost, "/api/chat/stream", strings.NewReader("{}"))
+	req.Header.Set(Header, "gone")
+	ctx, cancel := context.WithCancel(context.WithValue(req.Context(), "user", "u"))
+	cancel()
+	handler(httptest.NewRecorder(), req.WithContext(ctx))
+	if rr := send(handler, "/api/chat/stream", "gone", "{}"); runs != 4 || rr.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("expected the stream of a gone client to run again, ran %d times", runs)
+	}
+
+	if rr := send(handler, "/api/chat/stream", "gone", "{}"); runs != 4 || rr.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("expected the finished stream to be replayed, ran %d times: %d %s", runs, rr.Code, rr.Body)
+	}
+}
+
+func TestHandleInProgress(t *testing.T) {
+	setupTest(t)
+
+	var inner *httptest.ResponseRecorder
+	handler := Handle(func(w http.ResponseWriter, r *http.Request) {
+		inner = send(Handle(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("the retry must not run while the request runs")
+		}), "/api/chat/stream", "key", "{}")
+	})
+	send(handler, "/api/chat/stream", "key", "{}")
+
+	if inner.Code != http.StatusConflict || !strings.Contains(inner.Body.String(), string(apierr.IdempotencyKeyInUse)) {
+		t.Errorf("expected a conflict, got %d %s", inner.Code, inner.Body.String())
+	}
+}
+
+func TestHandleMultipartRetry(t *testing.T) {
+	setupTest(t)
+
+	runs := 0
+	handler := Handle(func(w http.ResponseWriter, r *http.Request) {
+		runs++
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(header.Filename))
+	})
+
+	upload := func(content string) *httptest.ResponseRecorder {
+		// every writer picks its own random boundary, like a client retrying
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("purpose", "chat")
+		fw, _ := mw.CreateFormFile("file", "notes.txt")
+		fw.Write([]byte(content))
+		mw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/files/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set(Header, "upload-key")
+		req = req.WithContext(context.WithValue(req.Context(), "user", "u"))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	upload("first draft")
+	retry := upload("first draft")
+	if runs != 1 || retry.Code != http.StatusCreated || retry.Header().Get(ReplayedHeader) != "true" {
+		t.Fatalf("expected the retried upload replayed, ran %d times, got %d", runs, retry.Code)
+	}
+
+	if rr := upload("second draft"); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected a different file to be refused, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,77 @@
+package idempotency
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Record is the response to a request sent with an Idempotency-Key.
+// Status is 0 while the request runs.
+type Record struct {
+	Endpoint    string
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+type Repository interface {
+	// Reserve claims key for a new request. It returns false, with the
+	// existing record, when the key was already used since cutoff.
+	Reserve(user string, key string, endpoint string, cutoff time.Time) (*Record, bool, error)
+	Complete(user string, key string, record *Record) error
+	Release(user string, key string) error
+}
+
+type RepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &RepositoryImpl{db: db}
+}
+
+// Reserve drops the expired keys of the user before claiming key, so the
+// table only holds keys that can still be replayed.
+func (r *RepositoryImpl) Reserve(user string, key string, endpoint string, cutoff time.Time) (*Record, bool, error) {
+	if _, err := r.db.Exec(`DELETE FROM IdempotencyKeys WHERE user = ? AND created_at <= ?`, user, cutoff.UTC()); err != nil {
+		return nil, false, err
+	}
+
+	result, err := r.db.Exec(`
+		INSERT INTO IdempotencyKeys (user, key, endpoint, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user, key) DO NOTHING
+	`, user, key, endpoint, time.Now().UTC())
+	if err != nil {
+		return nil, false, err
+	}
+	if n, _ := result.RowsAffected(); n == 1 {
+		return nil, true, nil
+	}
+
+	var record Record
+	err = r.db.QueryRow(`
+		SELECT endpoint, fingerprint, status, content_type, COALESCE(body, ''), created_at
+		FROM IdempotencyKeys WHERE user = ? AND key = ?
+	`, user, key).Scan(&record.Endpoint, &record.Fingerprint, &record.Status, &record.ContentType, &record.Body, &record.CreatedAt)
+	if err != nil {
+		return nil, false, err
+	}
+	return &record, false, nil
+}
+
+func (r *RepositoryImpl) Complete(user string, key string, record *Record) error {
+	_, err := r.db.Exec(`
+		UPDATE IdempotencyKeys SET fingerprint = ?, status = ?, content_type = ?, body = ?
+		WHERE user = ? AND key = ?
+	`, record.Fingerprint, record.Status, record.ContentType, record.Body, user, key)
+	return err
+}
+
+// Release forgets a key whose request should run again when retried.
+func (r *RepositoryImpl) Release(user string, key string) error {
+	_, err := r.db.Exec(`DELETE FROM IdempotencyKeys WHERE user = ? AND key = ?`, user, key)
+	return err
+}
@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"database/sql"
+	"os"
+	"strconv"
+
+	logger "github.com/charmbracelet/log"
+)
+
+const defaultWorkers = 2
+
+var log *logger.Logger
+var repo Repository
+
+// SetupJobs queues the jobs a previous run left unfinished and starts the
+// workers. Packages register their handlers before it is called.
+func SetupJobs(l *logger.Logger, db *sql.DB) {
+	log = l
+	repo = NewRepository(db)
+
+	if n, err := repo.RequeueRunning(); err != nil {
+		log.Error("Error requeuing interrupted jobs", "err", err)
+	} else if n > 0 {
+		log.Info("Requeued interrupted jobs", "count", n)
+	}
+
+	workers := defaultWorkers
+	if v := os.Getenv("JOB_WORKERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Warn("Invalid JOB_WORKERS, using default", "value", v, "default", defaultWorkers)
+		} else {
+			workers = n
+		}
+	}
+	start(workers)
+}
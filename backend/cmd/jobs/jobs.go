@@ -0,0 +1,224 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+)
+
+const (
+	maxAttempts  = 3
+	pollInterval = 5 * time.Second
+	jobTimeout   = 10 * time.Minute
+	pruneEvery   = time.Hour
+)
+
+// retryDelays are the waits before the second and third attempts.
+var retryDelays = []time.Duration{30 * time.Second, 5 * time.Minute}
+
+// Func does the work of a job and returns its result, which is saved as
+// JSON. Errors are retried unless wrapped with Permanent.
+type Func func(ctx context.Context, job *Job) (any, error)
+
+var (
+	mu       sync.RWMutex
+	handlers = make(map[string]Func)
+	// timeouts replace jobTimeout for kinds of long jobs
+	timeouts = make(map[string]time.Duration)
+	// wake tells an idle worker that a job was queued.
+	wake = make(chan struct{}, 1)
+)
+
+// Register sets the handler of a kind of job.
+func Register(kind string, h Func) {
+	mu.Lock()
+	handlers[kind] = h
+	mu.Unlock()
+}
+
+// SetTimeout gives the jobs of a kind longer than the default ten minutes
+// per attempt.
+func SetTimeout(kind string, d time.Duration) {
+	mu.Lock()
+	timeouts[kind] = d
+	mu.Unlock()
+}
+
+func timeout(kind string) time.Duration {
+	mu.RLock()
+	defer mu.RUnlock()
+	if d, ok := timeouts[kind]; ok {
+		return d
+	}
+	return jobTimeout
+}
+
+func handler(kind string) (Func, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	h, ok := handlers[kind]
+	return h, ok
+}
+
+type permanentError struct{ error }
+
+func (e permanentError) Unwrap() error { return e.error }
+
+// Permanent marks an error that a retry cannot fix, such as a missing file.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// Enqueue queues a job for the user, payload is saved as JSON.
+func Enqueue(user string, kind string, payload any) (*Job, error) {
+	if repo == nil {
+		return nil, fmt.Errorf("jobs are not set up")
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	job := &Job{
+		User:        user,
+		Kind:        kind,
+		Payload:     body,
+		Status:      StatusQueued,
+		MaxAttempts: maxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := repo.Save(job); err != nil {
+		return nil, err
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Get returns a job of the user.
+func Get(id int64, user string) (*Job, error) {
+	if repo == nil {
+		return nil, fmt.Errorf("jobs are not set up")
+	}
+	return repo.GetByID(id, user)
+}
+
+// Report saves the progress of a running job, as JSON. It is kept when the
+// job is retried, so a handler can resume from it.
+func Report(job *Job, progress any) error {
+	body, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	if err := repo.SaveProgress(job.ID, body); err != nil {
+		return err
+	}
+	job.Progress = body
+	return nil
+}
+
+func start(workers int) {
+	for range workers {
+		go work()
+	}
+	go prune()
+}
+
+// work runs due jobs one at a time, polling for retries and jobs queued
+// by other instances.
+func work() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		for runNext() {
+		}
+		select {
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext runs the next due job and reports whether there was one.
+func runNext() bool {
+	job, err := repo.Claim(time.Now().UTC())
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		log.Error("Error claiming job", "err", err)
+		return false
+	}
+	run(job)
+	return true
+}
+
+func run(job *Job) {
+	h, ok := handler(job.Kind)
+	if !ok {
+		fail(job, Permanent(fmt.Errorf("unknown job kind %q", job.Kind)))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout(job.Kind))
+	defer cancel()
+	result, err := safeRun(ctx, h, job)
+	if err != nil {
+		fail(job, err)
+		return
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		fail(job, Permanent(err))
+		return
+	}
+	if err := repo.Finish(job.ID, body); err != nil {
+		log.Error("Error saving job result", "job", job.ID, "err", err)
+	}
+}
+
+// safeRun keeps a panicking handler from stopping the worker.
+func safeRun(ctx context.Context, h Func, job *Job) (result any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return h(ctx, job)
+}
+
+func fail(job *Job, err error) {
+	var retryAt *time.Time
+	var permanent permanentError
+	if !errors.As(err, &permanent) && job.Attempts < job.MaxAttempts {
+		at := time.Now().UTC().Add(retryDelays[min(job.Attempts, len(retryDelays))-1])
+		retryAt = &at
+		log.Warn("Job failed, retrying", "job", job.ID, "kind", job.Kind, "attempt", job.Attempts, "err", err)
+	} else {
+		log.Error("Job failed", "job", job.ID, "kind", job.Kind, "attempts", job.Attempts, "err", err)
+	}
+	if err := repo.Fail(job.ID, err.Error(), retryAt); err != nil {
+		log.Error("Error saving job failure", "job", job.ID, "err", err)
+	}
+}
+
+// prune deletes finished jobs older than jobRetention.
+func prune() {
+	for {
+		before := time.Now().UTC().Add(-config.Duration("jobRetention"))
+		if err := repo.DeleteFinished(before); err != nil {
+			log.Error("Error pruning jobs", "err", err)
+		}
+		time.Sleep(pruneEvery)
+	}
+}
@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func TestJobs(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	log = logger.New(os.Stdout)
+	repo = NewRepository(db)
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	Register("flaky", func(ctx context.Context, job *Job) (any, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("try again")
+		}
+		return map[string]int{"calls": calls}, nil
+	})
+	Register("broken", func(ctx context.Context, job *Job) (any, error) {
+		return nil, Permanent(errors.New("cannot work"))
+	})
+
+	job, err := Enqueue("u", "flaky", map[string]string{"file": "f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !runNext() {
+		t.Fatal("expected the queued job to run")
+	}
+	got, _ := repo.GetByID(job.ID, "u")
+	if got.Status != StatusQueued || got.Attempts != 1 || got.Error != "try again" || !got.RunAt.After(time.Now()) {
+		t.Fatalf("expected the failed attempt to be retried later, got %+v", got)
+	}
+	if runNext() {
+		t.Fatal("expected the retry to wait for its delay")
+	}
+
+	if _, err := db.Exec("UPDATE Jobs SET run_at = ? WHERE id = ?", time.Now().UTC().Add(-time.Second), job.ID); err != nil {
+		t.Fatal(err)
+	}
+	runNext()
+	got, _ = repo.GetByID(job.ID, "u")
+	if got.Status != StatusDone || got.Attempts != 2 || string(got.Result) != `{"calls":2}` {
+		t.Errorf("expected the retry to finish the job, got %+v", got)
+	}
+
+	broken, _ := Enqueue("u", "broken", nil)
+	unknown, _ := Enqueue("u", "unknown", nil)
+	runNext()
+	runNext()
+	for _, id := range []int64{broken.ID, unknown.ID} {
+		if got, _ := repo.GetByID(id, "u"); got.Status != StatusFailed || got.Attempts != 1 {
+			t.Errorf("expected a permanent failure without retries, got %+v", got)
+		}
+	}
+
+	if jobs, _ := repo.GetAll("u", StatusFailed, 10); len(jobs) != 2 || jobs[0].ID != unknown.ID {
+		t.Errorf("expected the failed jobs newest first, got %v", jobs)
+	}
+
+	// a restart queues running jobs again
+	running, _ := Enqueue("u", "flaky", nil)
+	if _, err := repo.Claim(time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := repo.RequeueRunning(); err != nil || n != 1 {
+		t.Fatalf("expected one job to be requeued, got %d %v", n, err)
+	}
+	if got, _ := repo.GetByID(running.ID, "u"); got.Status != StatusQueued {
+		t.Errorf("expected the interrupted job to be queued, got %+v", got)
+	}
+
+	// progress is kept for the retry, which resumes from it
+	Register("resumable", func(ctx context.Context, job *Job) (any, error) {
+		if job.Progress != nil {
+			return job.Progress, nil
+		}
+		if err := Report(job, map[string]int{"done": 1}); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("interrupted")
+	})
+	resumable, _ := Enqueue("u", "resumable", nil)
+	for runNext() {
+	}
+	if _, err := db.Exec("UPDATE Jobs SET run_at = ? WHERE id = ?", time.Now().UTC().Add(-time.Second), resumable.ID); err != nil {
+		t.Fatal(err)
+	}
+	for runNext() {
+	}
+	if got, _ := Get(resumable.ID, "u"); got.Status != StatusDone || string(got.Progress) != `{"done":1}` || string(got.Result) != `{"done":1}` {
+		t.Errorf("expected the retry to resume from the reported progress, got %+v", got)
+	}
+}
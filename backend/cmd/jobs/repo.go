@@ -0,0 +1,179 @@
+package jobs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
+
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Job is background work of a user, such as extracting the text of an
+// upload or crawling a site. Failed attempts are retried with backoff.
+type Job struct {
+	ID          int64           `json:"id"`
+	User        string          `json:"-"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	Error       string          `json:"error,omitempty"`
+	// Progress is what the handler reported while it runs, see Report
+	Progress json.RawMessage `json:"progress,omitempty"`
+	// Result is set by the handler once the job is done
+	Result    json.RawMessage `json:"result,omitempty"`
+	RunAt     time.Time       `json:"runAt"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+type Repository interface {
+	Save(job *Job) error
+	GetAll(user string, status string, limit int) ([]*Job, error)
+	GetByID(id int64, user string) (*Job, error)
+	Claim(now time.Time) (*Job, error)
+	Finish(id int64, result json.RawMessage) error
+	SaveProgress(id int64, progress json.RawMessage) error
+	Fail(id int64, message string, retryAt *time.Time) error
+	RequeueRunning() (int64, error)
+	DeleteFinished(before time.Time) error
+}
+
+type RepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &RepositoryImpl{db: db}
+}
+
+const jobColumns = `id, user, kind, payload, status, attempts, max_attempts, error, progress, result, run_at, created_at, updated_at`
+
+func scanJob(row interface{ Scan(...any) error }) (*Job, error) {
+	var job Job
+	var payload, progress, result string
+	err := row.Scan(&job.ID, &job.User, &job.Kind, &payload, &job.Status, &job.Attempts, &job.MaxAttempts,
+		&job.Error, &progress, &result, &job.RunAt, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.Payload = json.RawMessage(payload)
+	if progress != "" {
+		job.Progress = json.RawMessage(progress)
+	}
+	if result != "" {
+		job.Result = json.RawMessage(result)
+	}
+	return &job, nil
+}
+
+func (r *RepositoryImpl) Save(job *Job) error {
+	query := `
+		INSERT INTO Jobs (user, kind, payload, status, max_attempts, run_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	res, err := data.Exec(r.db, query, job.User, job.Kind, string(job.Payload), job.Status, job.MaxAttempts,
+		job.RunAt, job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	job.ID, err = res.LastInsertId()
+	return err
+}
+
+// GetAll lists the jobs of a user, newest first. An empty status lists
+// every job.
+func (r *RepositoryImpl) GetAll(user string, status string, limit int) ([]*Job, error) {
+	query := `
+		SELECT ` + jobColumns + ` FROM Jobs
+		WHERE user = ? AND (? = '' OR status = ?)
+		ORDER BY id DESC
+		LIMIT ?
+	`
+	rows, err := data.Query(r.db, query, user, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]*Job, 0)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (r *RepositoryImpl) GetByID(id int64, user string) (*Job, error) {
+	return scanJob(data.QueryRow(r.db, `SELECT `+jobColumns+` FROM Jobs WHERE id = ? AND user = ?`, id, user))
+}
+
+// Claim marks the oldest queued job that is due as running and returns it,
+// or sql.ErrNoRows when there is none.
+func (r *RepositoryImpl) Claim(now time.Time) (*Job, error) {
+	query := `
+		UPDATE Jobs SET status = 'running', attempts = attempts + 1, updated_at = ?
+		WHERE id = (
+			SELECT id FROM Jobs WHERE status = 'queued' AND run_at <= ?
+			ORDER BY run_at, id LIMIT 1
+		)
+		RETURNING ` + jobColumns
+	return scanJob(data.QueryRow(r.db, query, now, now))
+}
+
+func (r *RepositoryImpl) Finish(id int64, result json.RawMessage) error {
+	query := `UPDATE Jobs SET status = 'done', error = '', result = ?, updated_at = ? WHERE id = ?`
+	_, err := data.Exec(r.db, query, string(result), time.Now().UTC(), id)
+	return err
+}
+
+func (r *RepositoryImpl) SaveProgress(id int64, progress json.RawMessage) error {
+	query := `UPDATE Jobs SET progress = ?, updated_at = ? WHERE id = ?`
+	_, err := data.Exec(r.db, query, string(progress), time.Now().UTC(), id)
+	return err
+}
+
+// Fail records the error of an attempt. The job is queued again at retryAt,
+// or failed for good when retryAt is nil.
+func (r *RepositoryImpl) Fail(id int64, message string, retryAt *time.Time) error {
+	now := time.Now().UTC()
+	if retryAt == nil {
+		query := `UPDATE Jobs SET status = 'failed', error = ?, updated_at = ? WHERE id = ?`
+		_, err := data.Exec(r.db, query, message, now, id)
+		return err
+	}
+	query := `UPDATE Jobs SET status = 'queued', error = ?, run_at = ?, updated_at = ? WHERE id = ?`
+	_, err := data.Exec(r.db, query, message, *retryAt, now, id)
+	return err
+}
+
+// RequeueRunning queues the jobs a stopped server left running again, or
+// fails those without attempts left.
+func (r *RepositoryImpl) RequeueRunning() (int64, error) {
+	query := `
+		UPDATE Jobs SET status = CASE WHEN attempts < max_attempts THEN 'queued' ELSE 'failed' END,
+			error = 'interrupted by a restart', updated_at = ?
+		WHERE status = 'running'
+	`
+	res, err := data.Exec(r.db, query, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (r *RepositoryImpl) DeleteFinished(before time.Time) error {
+	_, err := data.Exec(r.db, `DELETE FROM Jobs WHERE status IN ('done', 'failed') AND updated_at < ?`, before)
+	return err
+}
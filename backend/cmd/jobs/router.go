@@ -0,0 +1,73 @@
+package jobs
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+type JobsResponse struct {
+	Jobs []*Job `json:"jobs"`
+}
+
+func Handler() http.Handler {
+	mux := openapi.NewRouter("/api/jobs", "Jobs")
+
+	mux.HandleFunc("GET /", listJobs, openapi.Op{
+		Summary:  "List the background jobs of the user, newest first",
+		Response: JobsResponse{},
+		Query: []openapi.Param{
+			{Name: "status", Description: "Only jobs in this status: queued, running, done or failed"},
+			{Name: "limit", Description: "Jobs to return, at most 200"},
+		},
+	})
+	mux.HandleFunc("GET /{id}", getJob, openapi.Op{Summary: "Get a background job with its result", Response: Job{}})
+
+	return http.StripPrefix("/api/jobs", auth.Authenticated(mux))
+}
+
+func listJobs(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	q := r.URL.Query()
+	status := q.Get("status")
+	switch status {
+	case "", StatusQueued, StatusRunning, StatusDone, StatusFailed:
+	default:
+		utils.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			utils.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, 200)
+	}
+
+	jobs, err := repo.GetAll(user, status, limit)
+	if err != nil {
+		log.Error("Error querying jobs", "err", err)
+		utils.Error(w, "Error querying jobs", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, JobsResponse{Jobs: jobs}, http.StatusOK)
+}
+
+func getJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+	job, err := repo.GetByID(id, utils.ExtractContextUser(r))
+	if err != nil {
+		utils.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	utils.RespondWithJSON(w, job, http.StatusOK)
+}
@@ -0,0 +1,23 @@
+package knowledge
+
+import (
+	"database/sql"
+
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/jobs"
+	"github.com/Bajahaw/ai-ui/cmd/tools"
+
+	logger "github.com/charmbracelet/log"
+)
+
+var log *logger.Logger
+var repo Repository
+var files fs.Repository
+
+func SetupKnowledge(l *logger.Logger, db *sql.DB) {
+	log = l
+	repo = NewRepository(db)
+	files = fs.NewRepository(db)
+	tools.RegisterBuiltIn("search_knowledge", searchKnowledgeTool)
+	jobs.Register(CrawlJob, crawlJob)
+}
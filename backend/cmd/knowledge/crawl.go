@@ -0,0 +1,426 @@
+package knowledge
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/jobs"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"github.com/google/uuid"
+	nethtml "golang.org/x/net/html"
+)
+
+const (
+	crawlDepth       = 1
+	maxCrawlDepth    = 3
+	crawlPages       = 20
+	maxCrawlPages    = 100
+	maxCrawledBody   = 2 << 20
+	crawlTimeout     = 5 * time.Minute
+	crawlUserAgent   = "ai-ui-crawler/1.0"
+	maxCrawlErrors   = 20
+	maxPageNameRunes = 120
+)
+
+// CrawlJob is the kind of job that crawls a site into a knowledge base.
+const CrawlJob = "crawl"
+
+const (
+	PageAdded     = "added"
+	PageUpdated   = "updated"
+	PageUnchanged = "unchanged"
+)
+
+var crawlClient = &http.Client{Timeout: 15 * time.Second, Transport: utils.Outbound}
+
+type CrawlRequest struct {
+	URL string `json:"url"`
+	// MaxDepth is how many links away from url to follow, 1 by default and
+	// at most 3
+	MaxDepth int `json:"maxDepth,omitempty"`
+	// MaxPages bounds the pages saved, 20 by default and at most 100
+	MaxPages int `json:"maxPages,omitempty"`
+}
+
+type CrawledPage struct {
+	URL    string `json:"url"`
+	FileID string `json:"fileId"`
+	Title  string `json:"title"`
+	// Status tells whether the page is new to the knowledge base, or was
+	// crawled before and its text changed or not
+	Status string `json:"status"`
+}
+
+type CrawlResult struct {
+	Pages []CrawledPage `json:"pages"`
+	// Errors lists the pages that could not be fetched, as "url: reason"
+	Errors []string `json:"errors,omitempty"`
+}
+
+type crawlPayload struct {
+	KnowledgeBaseID string `json:"knowledgeBaseId"`
+	URL             string `json:"url"`
+	MaxDepth        int    `json:"maxDepth"`
+	MaxPages        int    `json:"maxPages"`
+}
+
+// crawlJob crawls a site and adds the new pages to the knowledge base.
+func crawlJob(ctx context.Context, job *jobs.Job) (any, error) {
+	var payload crawlPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	kb, err := repo.GetByID(payload.KnowledgeBaseID, job.User)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, jobs.Permanent(fmt.Errorf("knowledge base not found: %s", payload.KnowledgeBaseID))
+	}
+	if err != nil {
+		return nil, err
+	}
+	start, err := url.Parse(payload.URL)
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, crawlTimeout)
+	defer cancel()
+	result := crawl(ctx, kb.ID, start, payload.MaxDepth, payload.MaxPages, kb.User)
+	if len(result.Pages) == 0 && len(result.Errors) > 0 {
+		return nil, fmt.Errorf("could not crawl the site: %s", result.Errors[0])
+	}
+
+	var added []string
+	for _, page := range result.Pages {
+		if page.Status == PageAdded {
+			added = append(added, page.FileID)
+		}
+	}
+	if err := repo.AddFiles(kb.ID, added, kb.User); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// crawler walks the pages of one site breadth first and saves their
+// readable text as files of the user. Pages the knowledge base already
+// holds are updated instead.
+type crawler struct {
+	kbID     string
+	user     string
+	host     string
+	maxDepth int
+	maxPages int
+	seen     map[string]bool
+	result   CrawlResult
+}
+
+type crawlTarget struct {
+	url   *url.URL
+	depth int
+}
+
+// crawl fetches start and the pages it links to on the same host, up to
+// maxDepth links away, until maxPages are saved or ctx is done.
+func crawl(ctx context.Context, kbID string, start *url.URL, maxDepth, maxPages int, user string) CrawlResult {
+	c := &crawler{
+		kbID:     kbID,
+		user:     user,
+		host:     start.Host,
+		maxDepth: maxDepth,
+		maxPages: maxPages,
+		seen:     map[string]bool{},
+		result:   CrawlResult{Pages: []CrawledPage{}},
+	}
+	queue := []crawlTarget{{url: start}}
+	c.seen[crawlKey(start)] = true
+	for len(queue) > 0 && len(c.result.Pages) < maxPages && ctx.Err() == nil {
+		target := queue[0]
+		queue = queue[1:]
+
+		page, links, err := c.visit(ctx, target.url)
+		if err != nil {
+			c.fail(target.url, err)
+			continue
+		}
+		if page != nil {
+			c.result.Pages = append(c.result.Pages, *page)
+		}
+		if target.depth >= maxDepth {
+			continue
+		}
+		for _, link := range links {
+			if key := crawlKey(link); !c.seen[key] {
+				c.seen[key] = true
+				queue = append(queue, crawlTarget{url: link, depth: target.depth + 1})
+			}
+		}
+	}
+	return c.result
+}
+
+func (c *crawler) fail(u *url.URL, err error) {
+	if len(c.result.Errors) < maxCrawlErrors {
+		c.result.Errors = append(c.result.Errors, fmt.Sprintf("%s: %v", u, err))
+	}
+}
+
+// visit fetches a page and saves its text. Pages without text are skipped
+// but their links are still followed.
+func (c *crawler) visit(ctx context.Context, u *url.URL) (*CrawledPage, []*url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", crawlUserAgent)
+	req.Header.Set("Accept", "text/html,text/plain;q=0.9")
+	res, err := crawlClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("status %d", res.StatusCode)
+	}
+	// redirects may leave the site
+	if res.Request.URL.Host != c.host {
+		return nil, nil, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxCrawledBody))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var title, text string
+	var links []*url.URL
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		title, text, links, err = readablePage(string(body), res.Request.URL)
+		if err != nil {
+			return nil, nil, err
+		}
+	case "text/plain", "text/markdown":
+		text = strings.TrimSpace(string(body))
+	default:
+		return nil, nil, nil
+	}
+	if text == "" {
+		return nil, c.sameSite(links), nil
+	}
+
+	page, err := c.save(res.Request.URL, title, text)
+	if err != nil {
+		return nil, nil, err
+	}
+	return page, c.sameSite(links), nil
+}
+
+// save stores a new page, or updates the text of a page crawled before.
+func (c *crawler) save(source *url.URL, title, text string) (*CrawledPage, error) {
+	existing, err := repo.CrawledFile(c.kbID, crawlKey(source))
+	switch {
+	case err == nil && existing.Content == text:
+		return &CrawledPage{URL: existing.URL, FileID: existing.ID, Title: existing.Name, Status: PageUnchanged}, nil
+	case err == nil:
+		if err := os.WriteFile(existing.Path, []byte(text), 0o644); err != nil {
+			return nil, err
+		}
+		if err := repo.UpdateCrawledFile(existing.ID, text); err != nil {
+			return nil, err
+		}
+		return &CrawledPage{URL: existing.URL, FileID: existing.ID, Title: existing.Name, Status: PageUpdated}, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	file, err := savePage(source, title, text, c.user)
+	if err != nil {
+		return nil, err
+	}
+	return &CrawledPage{URL: file.URL, FileID: file.ID, Title: file.Name, Status: PageAdded}, nil
+}
+
+// sameSite keeps the http links to the host the crawl started on.
+func (c *crawler) sameSite(links []*url.URL) []*url.URL {
+	kept := links[:0]
+	for _, link := range links {
+		if link.Host == c.host && (link.Scheme == "http" || link.Scheme == "https") {
+			kept = append(kept, link)
+		}
+	}
+	return kept
+}
+
+// crawlKey identifies a page, ignoring its fragment.
+func crawlKey(u *url.URL) string {
+	key := *u
+	key.Fragment = ""
+	key.RawFragment = ""
+	if key.Path == "" {
+		key.Path = "/"
+	}
+	return key.String()
+}
+
+// savePage stores the text of a page as a file of the user, with a single
+// page so that it is ranked by the full text index.
+func savePage(source *url.URL, title, text, user string) (fs.File, error) {
+	uploadDir := path.Join(".", "data", "resources")
+	if err := os.MkdirAll(uploadDir, 0o755); err != nil {
+		return fs.File{}, err
+	}
+	id := uuid.New().String()
+	filePath := path.Join(uploadDir, id+".txt")
+	if err := os.WriteFile(filePath, []byte(text), 0o644); err != nil {
+		return fs.File{}, err
+	}
+
+	if title == "" {
+		title = source.Host + source.Path
+	}
+	now := time.Now().Format(time.RFC3339)
+	file := fs.File{
+		ID:         id,
+		Name:       truncateRunes(title, maxPageNameRunes),
+		Type:       "text/plain",
+		Size:       int64(len(text)),
+		Path:       filePath,
+		URL:        crawlKey(source),
+		Content:    text,
+		User:       user,
+		CreatedAt:  now,
+		UploadedAt: now,
+	}
+	if err := files.Save(file); err != nil {
+		_ = os.Remove(filePath)
+		return fs.File{}, err
+	}
+	page := fs.FilePage{ID: uuid.New().String(), FileID: id, PageNumber: 1, Content: text}
+	if err := files.SavePages([]fs.FilePage{page}); err != nil {
+		log.Error("Error indexing crawled page", "url", file.URL, "err", err)
+	}
+	return file, nil
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// skippedElements hold no readable text of a page.
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true,
+	"iframe": true, "nav": true, "header": true, "footer": true, "aside": true, "form": true,
+	"head": true,
+}
+
+// blockElements start a new line of text.
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true, "br": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"li": true, "ul": true, "ol": true, "tr": true, "table": true, "pre": true,
+	"blockquote": true, "dt": true, "dd": true, "hr": true, "figcaption": true,
+}
+
+// readablePage returns the title, the text and the links of an HTML page.
+// Navigation, scripts and forms are left out of the text, and the text of
+// <main> or <article> is preferred when the page has one.
+func readablePage(input string, base *url.URL) (string, string, []*url.URL, error) {
+	root, err := nethtml.Parse(strings.NewReader(input))
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	var title string
+	var links []*url.URL
+	var content *nethtml.Node
+	var walk func(n *nethtml.Node)
+	walk = func(n *nethtml.Node) {
+		if n.Type == nethtml.ElementNode {
+			switch n.Data {
+			case "title":
+				if title == "" && n.FirstChild != nil {
+					title = strings.Join(strings.Fields(n.FirstChild.Data), " ")
+				}
+			case "base":
+				if href, err := url.Parse(attr(n, "href")); err == nil {
+					base = base.ResolveReference(href)
+				}
+			case "a":
+				if href, err := url.Parse(attr(n, "href")); err == nil && attr(n, "href") != "" {
+					links = append(links, base.ResolveReference(href))
+				}
+			case "main", "article":
+				if content == nil {
+					content = n
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(root)
+	if content == nil {
+		content = root
+	}
+
+	var b strings.Builder
+	writeText(&b, content)
+	lines := strings.Split(b.String(), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return title, strings.Join(kept, "\n"), links, nil
+}
+
+func writeText(b *strings.Builder, n *nethtml.Node) {
+	switch n.Type {
+	case nethtml.TextNode:
+		b.WriteString(n.Data)
+		return
+	case nethtml.ElementNode:
+		if skippedElements[n.Data] {
+			return
+		}
+	}
+	block := n.Type == nethtml.ElementNode && blockElements[n.Data]
+	if block {
+		b.WriteString("\n")
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		writeText(b, child)
+	}
+	if block {
+		b.WriteString("\n")
+	}
+}
+
+func attr(n *nethtml.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,129 @@
+package knowledge
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func TestReadablePage(t *testing.T) {
+	base, _ := url.Parse("https://docs.example.com/guide/")
+	title, text, links, err := readablePage(`<html><head><title> Getting
+		started </title><script>var x = 1</script></head><body>
+		<nav><a href="/">Home</a></nav>
+		<main><h1>Install</h1><p>Run the   installer.</p><ul><li>Step one</li><li>Step <b>two</b></li></ul>
+		<a href="next#top">Next</a></main>
+		<footer>Copyright</footer></body></html>`, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Getting started" {
+		t.Errorf("unexpected title %q", title)
+	}
+	if text != "Install\nRun the installer.\nStep one\nStep two\nNext" {
+		t.Errorf("unexpected text %q", text)
+	}
+	if len(links) != 2 || links[0].String() != "https://docs.example.com/" || links[1].String() != "https://docs.example.com/guide/next#top" {
+		t.Errorf("unexpected links %v", links)
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	t.Chdir(t.TempDir())
+	log = logger.New(os.Stdout)
+	files = fs.NewRepository(db)
+	repo = NewRepository(db)
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Save(&KnowledgeBase{ID: "kb", Name: "Docs", User: "u"}); err != nil {
+		t.Fatal(err)
+	}
+
+	pages := map[string]string{
+		"/":      `<title>Home</title><p>Welcome</p><a href="/a">A</a><a href="/b#x">B</a><a href="https://elsewhere.example/">out</a>`,
+		"/a":     `<title>A</title><p>Page a</p><a href="/deep">deep</a><a href="/">home</a>`,
+		"/b":     `<title>B</title><p>Page b</p>`,
+		"/deep":  `<title>Deep</title><p>Too far</p>`,
+		"/empty": ``,
+	}
+	var fetched []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = append(fetched, r.URL.Path)
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}))
+	defer server.Close()
+	start, _ := url.Parse(server.URL + "/")
+
+	result := crawl(context.Background(), "kb", start, 1, 10, "u")
+	if len(result.Pages) != 3 || len(result.Errors) != 0 {
+		t.Fatalf("expected the start page and its 2 links, got %+v", result)
+	}
+	if strings.Join(fetched, ",") != "/,/a,/b" {
+		t.Errorf("expected each page fetched once without leaving the site, got %v", fetched)
+	}
+	saved, err := files.GetByIDs([]string{result.Pages[1].FileID}, "u")
+	if err != nil || len(saved) != 1 {
+		t.Fatalf("expected the page to be saved as a file, got %v %v", saved, err)
+	}
+	if saved[0].Name != "A" || !strings.HasPrefix(saved[0].Content, "Page a\n") || saved[0].URL != server.URL+"/a" {
+		t.Errorf("unexpected file %+v", saved[0])
+	}
+	if found, _ := files.SearchPages(saved[0].ID, "page", 5); len(found) != 1 {
+		t.Errorf("expected the page to be indexed, got %v", found)
+	}
+
+	fetched = nil
+	if result := crawl(context.Background(), "other", start, 3, 2, "u"); len(result.Pages) != 2 {
+		t.Errorf("expected the page limit to stop the crawl, got %+v", result)
+	}
+
+	// crawling again only updates the pages that changed
+	ids := make([]string, len(result.Pages))
+	for i, page := range result.Pages {
+		ids[i] = page.FileID
+	}
+	if err := repo.AddFiles("kb", ids, "u"); err != nil {
+		t.Fatal(err)
+	}
+	pages["/b"] = `<title>B</title><p>Page b, revised</p>`
+	again := crawl(context.Background(), "kb", start, 1, 10, "u")
+	if len(again.Pages) != 3 || again.Pages[0].Status != PageUnchanged || again.Pages[2].Status != PageUpdated {
+		t.Fatalf("expected the revised page to be updated in place, got %+v", again)
+	}
+	if again.Pages[2].FileID != result.Pages[2].FileID {
+		t.Errorf("expected the file of the page to be kept, got %s", again.Pages[2].FileID)
+	}
+	if found, _ := files.SearchPages(again.Pages[2].FileID, "revised", 5); len(found) != 1 {
+		t.Errorf("expected the new text to be indexed, got %v", found)
+	}
+	if text, _ := os.ReadFile(path.Join("data", "resources", again.Pages[2].FileID+".txt")); string(text) != "Page b, revised" {
+		t.Errorf("expected the file on disk to be rewritten, got %q", text)
+	}
+
+	missing, _ := url.Parse(server.URL + "/missing")
+	if result := crawl(context.Background(), "kb", missing, 1, 10, "u"); len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "status 404") {
+		t.Errorf("expected the failed page to be reported, got %+v", result)
+	}
+}
@@ -0,0 +1,103 @@
+package knowledge
+
+import (
+	"context"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func TestKnowledgeSearch(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	log = logger.New(os.Stdout)
+	repo = NewRepository(db)
+
+	for _, stmt := range []string{
+		"INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash'), ('other', 'hash')",
+		"INSERT INTO Conversations (id, user) VALUES ('conv', 'u'), ('theirs', 'other')",
+		"INSERT INTO Files (id, name, type, size, path, url, content, user) VALUES " +
+			"('manual', 'manual.pdf', 'application/pdf', 1, 'x', '', '', 'u'), " +
+			"('faq', 'faq.md', 'text/markdown', 1, 'x', '', 'Refunds take 5_days after the return is received.', 'u'), " +
+			"('loose', 'loose.txt', 'text/plain', 1, 'x', '', 'Refunds are not in any collection.', 'u'), " +
+			"('foreign', 'foreign.txt', 'text/plain', 1, 'x', '', 'Refunds of someone else.', 'other')",
+		"INSERT INTO FilePages (id, file_id, page_number, content) VALUES " +
+			"('p1', 'manual', 1, 'Installing the printer'), ('p2', 'manual', 2, 'Refunds for a broken printer')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	kb := &KnowledgeBase{ID: "kb", Name: "Support", User: "u"}
+	if err := repo.Save(kb); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.AddFiles("kb", []string{"manual", "faq", "foreign"}, "u"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.GetByID("kb", "u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.FileIDs) != 2 || slices.Contains(got.FileIDs, "foreign") {
+		t.Errorf("expected only the user's own files, got %v", got.FileIDs)
+	}
+
+	if out := searchKnowledgeTool(context.Background(), `{"query":"refunds"}`, "u", "conv"); !strings.Contains(out.Content, "no knowledge base") {
+		t.Errorf("expected an error without an attached knowledge base, got %s", out.Content)
+	}
+	if ok, err := repo.Attach("kb", "theirs", "u"); err != nil || ok {
+		t.Errorf("expected another user's conversation to be refused, got %v %v", ok, err)
+	}
+	if ok, err := repo.Attach("kb", "conv", "u"); err != nil || !ok {
+		t.Fatalf("expected the knowledge base to be attached, got %v %v", ok, err)
+	}
+
+	results, err := repo.Search("refunds printer", []string{"kb"}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Page != 2 || !strings.Contains(results[0].Snippet, "[Refunds]") {
+		t.Fatalf("expected the page with both words first, got %+v", results)
+	}
+
+	// files without pages need every word
+	results, err = repo.Search("refunds return", []string{"kb"}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[1].FileID != "faq" || results[1].Page != 0 {
+		t.Errorf("expected the file without pages after the page, got %+v", results)
+	}
+
+	// LIKE wildcards are matched literally
+	if results, _ := repo.Search("5%days", []string{"kb"}, 10); len(results) != 0 {
+		t.Errorf("expected no match for an escaped wildcard, got %+v", results)
+	}
+
+	out := searchKnowledgeTool(context.Background(), `{"query":"refunds","limit":1}`, "u", "conv")
+	if !strings.Contains(out.Content, `"fileName":"manual.pdf"`) || strings.Contains(out.Content, "faq") {
+		t.Errorf("expected one result from the attached knowledge base, got %s", out.Content)
+	}
+	if strings.Contains(out.Content, "loose") || strings.Contains(out.Content, "foreign") {
+		t.Errorf("expected files outside the knowledge base to be left out, got %s", out.Content)
+	}
+
+	if err := repo.DeleteByID("kb", "u"); err != nil {
+		t.Fatal(err)
+	}
+	var files int
+	if err := db.QueryRow("SELECT COUNT(*) FROM Files").Scan(&files); err != nil || files != 4 {
+		t.Errorf("expected the files to outlive the knowledge base, got %d %v", files, err)
+	}
+}
@@ -0,0 +1,336 @@
+package knowledge
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+)
+
+// KnowledgeBase is a named collection of the user's files. The files of the
+// collections attached to a conversation are searched by the
+// search_knowledge tool.
+type KnowledgeBase struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	User        string    `json:"-"`
+	FileIDs     []string  `json:"fileIds"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// KnowledgeResult is a part of a file matching a search.
+type KnowledgeResult struct {
+	FileID   string `json:"fileId"`
+	FileName string `json:"fileName"`
+	// URL is the source of a crawled page
+	URL string `json:"url,omitempty"`
+	// Page is 0 for files without pages
+	Page    int    `json:"page,omitempty"`
+	Snippet string `json:"snippet"`
+}
+
+type Repository interface {
+	GetAll(user string) ([]*KnowledgeBase, error)
+	GetByID(id string, user string) (*KnowledgeBase, error)
+	GetByConversation(convID string, user string) ([]*KnowledgeBase, error)
+	Save(kb *KnowledgeBase) error
+	Update(kb *KnowledgeBase) error
+	DeleteByID(id string, user string) error
+	AddFiles(id string, fileIDs []string, user string) error
+	RemoveFile(id string, fileID string) error
+	Attach(id string, convID string, user string) (bool, error)
+	Detach(id string, convID string) error
+	Search(query string, kbIDs []string, limit int) ([]KnowledgeResult, error)
+	CrawledFile(id string, url string) (fs.File, error)
+	UpdateCrawledFile(fileID string, text string) error
+}
+
+type RepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &RepositoryImpl{db: db}
+}
+
+const knowledgeColumns = `id, name, description, user, created_at, updated_at`
+
+func (r *RepositoryImpl) list(query string, args ...any) ([]*KnowledgeBase, error) {
+	rows, err := data.Query(r.db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	kbs := make([]*KnowledgeBase, 0)
+	byID := make(map[string]*KnowledgeBase)
+	for rows.Next() {
+		kb := KnowledgeBase{FileIDs: []string{}}
+		if err := rows.Scan(&kb.ID, &kb.Name, &kb.Description, &kb.User, &kb.CreatedAt, &kb.UpdatedAt); err != nil {
+			return nil, err
+		}
+		kbs = append(kbs, &kb)
+		byID[kb.ID] = &kb
+	}
+	if err := rows.Err(); err != nil || len(kbs) == 0 {
+		return kbs, err
+	}
+
+	ids := make([]any, 0, len(kbs))
+	for _, kb := range kbs {
+		ids = append(ids, kb.ID)
+	}
+	fileRows, err := r.db.Query(`SELECT kb_id, file_id FROM KnowledgeBaseFiles WHERE kb_id IN (`+placeholders(len(ids))+`) ORDER BY added_at, file_id`, ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer fileRows.Close()
+	for fileRows.Next() {
+		var kbID, fileID string
+		if err := fileRows.Scan(&kbID, &fileID); err != nil {
+			return nil, err
+		}
+		byID[kbID].FileIDs = append(byID[kbID].FileIDs, fileID)
+	}
+	return kbs, fileRows.Err()
+}
+
+func (r *RepositoryImpl) GetAll(user string) ([]*KnowledgeBase, error) {
+	return r.list(`SELECT `+knowledgeColumns+` FROM KnowledgeBases WHERE user = ? ORDER BY name COLLATE NOCASE, id`, user)
+}
+
+func (r *RepositoryImpl) GetByID(id string, user string) (*KnowledgeBase, error) {
+	kbs, err := r.list(`SELECT `+knowledgeColumns+` FROM KnowledgeBases WHERE id = ? AND user = ?`, id, user)
+	if err != nil {
+		return nil, err
+	}
+	if len(kbs) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return kbs[0], nil
+}
+
+func (r *RepositoryImpl) GetByConversation(convID string, user string) ([]*KnowledgeBase, error) {
+	query := `
+		SELECT ` + knowledgeColumns + ` FROM KnowledgeBases
+		WHERE user = ? AND id IN (SELECT kb_id FROM ConversationKnowledge WHERE conv_id = ?)
+		ORDER BY name COLLATE NOCASE, id
+	`
+	return r.list(query, user, convID)
+}
+
+func (r *RepositoryImpl) Save(kb *KnowledgeBase) error {
+	now := time.Now().UTC()
+	kb.CreatedAt = now
+	kb.UpdatedAt = now
+	query := `INSERT INTO KnowledgeBases (id, name, description, user, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := data.Exec(r.db, query, kb.ID, kb.Name, kb.Description, kb.User, kb.CreatedAt, kb.UpdatedAt)
+	return err
+}
+
+func (r *RepositoryImpl) Update(kb *KnowledgeBase) error {
+	kb.UpdatedAt = time.Now().UTC()
+	query := `UPDATE KnowledgeBases SET name = ?, description = ?, updated_at = ? WHERE id = ? AND user = ?`
+	_, err := data.Exec(r.db, query, kb.Name, kb.Description, kb.UpdatedAt, kb.ID, kb.User)
+	return err
+}
+
+func (r *RepositoryImpl) DeleteByID(id string, user string) error {
+	_, err := data.Exec(r.db, `DELETE FROM KnowledgeBases WHERE id = ? AND user = ?`, id, user)
+	return err
+}
+
+// AddFiles adds the files of the user among fileIDs, others are skipped.
+func (r *RepositoryImpl) AddFiles(id string, fileIDs []string, user string) error {
+	query := `
+		INSERT OR IGNORE INTO KnowledgeBaseFiles (kb_id, file_id, added_at)
+		SELECT ?, id, ? FROM Files WHERE id = ? AND user = ?
+	`
+	now := time.Now().UTC()
+	for _, fileID := range fileIDs {
+		if _, err := data.Exec(r.db, query, id, now, fileID, user); err != nil {
+			return err
+		}
+	}
+	_, err := data.Exec(r.db, `UPDATE KnowledgeBases SET updated_at = ? WHERE id = ?`, now, id)
+	return err
+}
+
+// CrawledFile returns the file of the knowledge base crawled from url, or
+// sql.ErrNoRows.
+func (r *RepositoryImpl) CrawledFile(id string, url string) (fs.File, error) {
+	query := `
+		SELECT f.id, f.name, f.path, f.content FROM Files f
+		JOIN KnowledgeBaseFiles k ON k.file_id = f.id
+		WHERE k.kb_id = ? AND f.url = ?
+		LIMIT 1
+	`
+	file := fs.File{URL: url}
+	err := data.QueryRow(r.db, query, id, url).Scan(&file.ID, &file.Name, &file.Path, &file.Content)
+	return file, err
+}
+
+// UpdateCrawledFile replaces the text of a crawled page and of its indexed
+// page.
+func (r *RepositoryImpl) UpdateCrawledFile(fileID string, text string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE Files SET content = ?, size = ?, uploaded_at = ? WHERE id = ?`,
+		text, len(text), time.Now().Format(time.RFC3339), fileID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE FilePages SET content = ? WHERE file_id = ? AND page_number = 1`, text, fileID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *RepositoryImpl) RemoveFile(id string, fileID string) error {
+	_, err := data.Exec(r.db, `DELETE FROM KnowledgeBaseFiles WHERE kb_id = ? AND file_id = ?`, id, fileID)
+	return err
+}
+
+// Attach attaches the collection to a conversation of the user, it returns
+// false when the user has no such conversation.
+func (r *RepositoryImpl) Attach(id string, convID string, user string) (bool, error) {
+	query := `
+		INSERT OR IGNORE INTO ConversationKnowledge (conv_id, kb_id)
+		SELECT id, ? FROM Conversations WHERE id = ? AND user = ?
+	`
+	if _, err := data.Exec(r.db, query, id, convID, user); err != nil {
+		return false, err
+	}
+	var attached bool
+	err := data.QueryRow(r.db, `SELECT EXISTS(SELECT 1 FROM ConversationKnowledge WHERE conv_id = ? AND kb_id = ?)`, convID, id).Scan(&attached)
+	return attached, err
+}
+
+func (r *RepositoryImpl) Detach(id string, convID string) error {
+	_, err := data.Exec(r.db, `DELETE FROM ConversationKnowledge WHERE conv_id = ? AND kb_id = ?`, convID, id)
+	return err
+}
+
+// maxSearchWords bounds the words of a search.
+const maxSearchWords = 10
+
+// Search looks for the words of query in the files of the collections. The
+// pages of documents are ranked by the full text index, files without pages
+// follow when their content has every word. The queries vary with the number
+// of collections and words, so they skip the statement cache.
+func (r *RepositoryImpl) Search(query string, kbIDs []string, limit int) ([]KnowledgeResult, error) {
+	words := strings.Fields(query)
+	words = words[:min(len(words), maxSearchWords)]
+	results := make([]KnowledgeResult, 0)
+	if len(words) == 0 || len(kbIDs) == 0 {
+		return results, nil
+	}
+	scope := `SELECT file_id FROM KnowledgeBaseFiles WHERE kb_id IN (` + placeholders(len(kbIDs)) + `)`
+
+	pagesSQL := `
+		SELECT p.file_id, f.name, f.url, p.page_number, snippet(FilePagesFTS, 0, '[', ']', '...', 64)
+		FROM FilePagesFTS fts
+		JOIN FilePages p ON p.rowid = fts.rowid
+		JOIN Files f ON f.id = p.file_id
+		WHERE FilePagesFTS MATCH ? AND p.file_id IN (` + scope + `)
+		ORDER BY rank
+		LIMIT ?
+	`
+	args := []any{ftsQuery(words)}
+	for _, id := range kbIDs {
+		args = append(args, id)
+	}
+	rows, err := r.db.Query(pagesSQL, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var res KnowledgeResult
+		if err := rows.Scan(&res.FileID, &res.FileName, &res.URL, &res.Page, &res.Snippet); err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil || len(results) >= limit {
+		return results, err
+	}
+
+	filesSQL := `
+		SELECT f.id, f.name, f.url, f.content FROM Files f
+		WHERE f.id IN (` + scope + `) AND NOT EXISTS (SELECT 1 FROM FilePages p WHERE p.file_id = f.id)
+	`
+	args = args[1:]
+	for _, word := range words {
+		filesSQL += ` AND f.content LIKE ? ESCAPE '\'`
+		args = append(args, likePattern(word))
+	}
+	filesSQL += ` ORDER BY f.uploaded_at DESC LIMIT ?`
+	fileRows, err := r.db.Query(filesSQL, append(args, limit-len(results))...)
+	if err != nil {
+		return nil, err
+	}
+	defer fileRows.Close()
+	for fileRows.Next() {
+		var res KnowledgeResult
+		var content string
+		if err := fileRows.Scan(&res.FileID, &res.FileName, &res.URL, &content); err != nil {
+			return nil, err
+		}
+		res.Snippet = excerpt(content, words[0])
+		results = append(results, res)
+	}
+	return results, fileRows.Err()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// ftsQuery matches any of the words, each quoted so that FTS5 does not read
+// them as operators. Pages with more of them rank first.
+func ftsQuery(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " OR ")
+}
+
+// likePattern matches s anywhere, with LIKE wildcards in s escaped by \.
+func likePattern(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(s) + "%"
+}
+
+const excerptLength = 400
+
+// excerpt returns about excerptLength bytes of s starting a little before
+// the first match of word.
+func excerpt(s string, word string) string {
+	start := strings.Index(strings.ToLower(s), strings.ToLower(word))
+	start = min(max(start-excerptLength/4, 0), len(s))
+	for start > 0 && start < len(s) && !utf8.RuneStart(s[start]) {
+		start--
+	}
+	end := min(start+excerptLength, len(s))
+	for end < len(s) && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	out := strings.TrimSpace(s[start:end])
+	if start > 0 {
+		out = "..." + out
+	}
+	if end < len(s) {
+		out += "..."
+	}
+	return out
+}
@@ -0,0 +1,339 @@
+package knowledge
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/jobs"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxNameLength        = 100
+	maxDescriptionLength = 2000
+	searchLimit          = 10
+	maxSearchLimit       = 50
+)
+
+type KnowledgeBaseRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// FileIDs are only read when creating a collection
+	FileIDs []string `json:"fileIds,omitempty"`
+}
+
+type FilesRequest struct {
+	FileIDs []string `json:"fileIds"`
+}
+
+type KnowledgeBasesResponse struct {
+	KnowledgeBases []*KnowledgeBase `json:"knowledgeBases"`
+}
+
+type KnowledgeSearchResponse struct {
+	Results []KnowledgeResult `json:"results"`
+}
+
+func (req *KnowledgeBaseRequest) valid() bool {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	return req.Name != "" && utf8.RuneCountInString(req.Name) <= maxNameLength &&
+		utf8.RuneCountInString(req.Description) <= maxDescriptionLength
+}
+
+func Handler() http.Handler {
+	mux := openapi.NewRouter("/api/knowledge", "Knowledge")
+
+	mux.HandleFunc("GET /", listKnowledgeBases, openapi.Op{
+		Summary:  "List the knowledge bases of the user",
+		Response: KnowledgeBasesResponse{},
+		Query:    []openapi.Param{{Name: "conversation", Description: "Only the knowledge bases attached to this conversation"}},
+	})
+	mux.HandleFunc("POST /", createKnowledgeBase, openapi.Op{Summary: "Create a knowledge base", Request: KnowledgeBaseRequest{}, Response: KnowledgeBase{}, Status: http.StatusCreated})
+	mux.HandleFunc("GET /{id}", getKnowledgeBase, openapi.Op{Summary: "Get a knowledge base", Response: KnowledgeBase{}})
+	mux.HandleFunc("PUT /{id}", updateKnowledgeBase, openapi.Op{Summary: "Rename or describe a knowledge base", Request: KnowledgeBaseRequest{}, Response: KnowledgeBase{}})
+	mux.HandleFunc("DELETE /{id}", deleteKnowledgeBase, openapi.Op{Summary: "Delete a knowledge base, its files are kept", Status: http.StatusNoContent})
+	mux.HandleFunc("POST /{id}/files", addFiles, openapi.Op{Summary: "Add files to a knowledge base", Request: FilesRequest{}, Response: KnowledgeBase{}})
+	mux.HandleFunc("DELETE /{id}/files/{fileId}", removeFile, openapi.Op{Summary: "Remove a file from a knowledge base", Status: http.StatusNoContent})
+	mux.HandleFunc("PUT /{id}/conversations/{convId}", attachConversation, openapi.Op{Summary: "Attach a knowledge base to a conversation", Status: http.StatusNoContent})
+	mux.HandleFunc("DELETE /{id}/conversations/{convId}", detachConversation, openapi.Op{Summary: "Detach a knowledge base from a conversation", Status: http.StatusNoContent})
+	mux.HandleFunc("POST /{id}/crawl", crawlSite, openapi.Op{
+		Summary:     "Crawl a site and add its pages to a knowledge base",
+		Description: "The crawl runs as a background job, its result is a CrawlResult. Pages crawled before are updated in place.",
+		Request:     CrawlRequest{},
+		Response:    jobs.Job{},
+		Status:      http.StatusAccepted,
+	})
+	mux.HandleFunc("GET /{id}/search", searchKnowledgeBase, openapi.Op{
+		Summary:  "Search the files of a knowledge base",
+		Response: KnowledgeSearchResponse{},
+		Query: []openapi.Param{
+			{Name: "q", Description: "Words to look for", Required: true},
+			{Name: "limit", Description: "Results to return, at most 50"},
+		},
+	})
+
+	return http.StripPrefix("/api/knowledge", auth.Authenticated(mux))
+}
+
+func listKnowledgeBases(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var kbs []*KnowledgeBase
+	var err error
+	if convID := r.URL.Query().Get("conversation"); convID != "" {
+		kbs, err = repo.GetByConversation(convID, user)
+	} else {
+		kbs, err = repo.GetAll(user)
+	}
+	if err != nil {
+		log.Error("Error querying knowledge bases", "err", err)
+		utils.Error(w, "Error querying knowledge bases", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, KnowledgeBasesResponse{KnowledgeBases: kbs}, http.StatusOK)
+}
+
+func createKnowledgeBase(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req KnowledgeBaseRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil || !req.valid() {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	kb := &KnowledgeBase{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Description: req.Description,
+		User:        user,
+	}
+	if err := repo.Save(kb); err != nil {
+		log.Error("Error saving knowledge base", "err", err)
+		utils.Error(w, "Error saving knowledge base", http.StatusInternalServerError)
+		return
+	}
+	if err := repo.AddFiles(kb.ID, req.FileIDs, user); err != nil {
+		log.Error("Error adding files to knowledge base", "err", err)
+		utils.Error(w, "Error adding files to knowledge base", http.StatusInternalServerError)
+		return
+	}
+	queueIndexing(req.FileIDs, user)
+	respondWithKnowledgeBase(w, kb.ID, user, http.StatusCreated)
+}
+
+func getKnowledgeBase(w http.ResponseWriter, r *http.Request) {
+	respondWithKnowledgeBase(w, r.PathValue("id"), utils.ExtractContextUser(r), http.StatusOK)
+}
+
+func respondWithKnowledgeBase(w http.ResponseWriter, id string, user string, status int) {
+	kb, err := repo.GetByID(id, user)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Knowledge base not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error querying knowledge base", "err", err)
+		utils.Error(w, "Error querying knowledge base", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, kb, status)
+}
+
+// ownKnowledgeBase responds with 404 unless the user owns the knowledge base.
+func ownKnowledgeBase(w http.ResponseWriter, r *http.Request) (*KnowledgeBase, bool) {
+	kb, err := repo.GetByID(r.PathValue("id"), utils.ExtractContextUser(r))
+	if err != nil {
+		utils.Error(w, "Knowledge base not found", http.StatusNotFound)
+		return nil, false
+	}
+	return kb, true
+}
+
+func updateKnowledgeBase(w http.ResponseWriter, r *http.Request) {
+	var req KnowledgeBaseRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil || !req.valid() {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	kb, ok := ownKnowledgeBase(w, r)
+	if !ok {
+		return
+	}
+
+	kb.Name = req.Name
+	kb.Description = req.Description
+	if err := repo.Update(kb); err != nil {
+		log.Error("Error updating knowledge base", "err", err)
+		utils.Error(w, "Error updating knowledge base", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, kb, http.StatusOK)
+}
+
+func deleteKnowledgeBase(w http.ResponseWriter, r *http.Request) {
+	kb, ok := ownKnowledgeBase(w, r)
+	if !ok {
+		return
+	}
+	if err := repo.DeleteByID(kb.ID, kb.User); err != nil {
+		log.Error("Error deleting knowledge base", "err", err)
+		utils.Error(w, "Error deleting knowledge base", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func addFiles(w http.ResponseWriter, r *http.Request) {
+	var req FilesRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil || len(req.FileIDs) == 0 {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	kb, ok := ownKnowledgeBase(w, r)
+	if !ok {
+		return
+	}
+	if err := repo.AddFiles(kb.ID, req.FileIDs, kb.User); err != nil {
+		log.Error("Error adding files to knowledge base", "err", err)
+		utils.Error(w, "Error adding files to knowledge base", http.StatusInternalServerError)
+		return
+	}
+	queueIndexing(req.FileIDs, kb.User)
+	respondWithKnowledgeBase(w, kb.ID, kb.User, http.StatusOK)
+}
+
+// queueIndexing extracts the text of the files that have none yet in the
+// background, so that they can be searched.
+func queueIndexing(fileIDs []string, user string) {
+	if len(fileIDs) == 0 {
+		return
+	}
+	found, err := files.GetByIDs(fileIDs, user)
+	if err != nil {
+		log.Error("Error querying files to index", "err", err)
+		return
+	}
+	for _, file := range found {
+		indexable := strings.HasPrefix(file.Type, "text/") || strings.HasPrefix(file.Type, "image/") || fs.IsRetrievableDoc(file.Type)
+		if file.Content != "" || !indexable {
+			continue
+		}
+		if _, err := fs.QueueExtraction(file.ID, user); err != nil {
+			log.Error("Error queuing file indexing", "file", file.ID, "err", err)
+		}
+	}
+}
+
+func removeFile(w http.ResponseWriter, r *http.Request) {
+	kb, ok := ownKnowledgeBase(w, r)
+	if !ok {
+		return
+	}
+	if err := repo.RemoveFile(kb.ID, r.PathValue("fileId")); err != nil {
+		log.Error("Error removing file from knowledge base", "err", err)
+		utils.Error(w, "Error removing file from knowledge base", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func attachConversation(w http.ResponseWriter, r *http.Request) {
+	kb, ok := ownKnowledgeBase(w, r)
+	if !ok {
+		return
+	}
+	attached, err := repo.Attach(kb.ID, r.PathValue("convId"), kb.User)
+	if err != nil {
+		log.Error("Error attaching knowledge base", "err", err)
+		utils.Error(w, "Error attaching knowledge base", http.StatusInternalServerError)
+		return
+	}
+	if !attached {
+		utils.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func detachConversation(w http.ResponseWriter, r *http.Request) {
+	kb, ok := ownKnowledgeBase(w, r)
+	if !ok {
+		return
+	}
+	if err := repo.Detach(kb.ID, r.PathValue("convId")); err != nil {
+		log.Error("Error detaching knowledge base", "err", err)
+		utils.Error(w, "Error detaching knowledge base", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func searchKnowledgeBase(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		utils.Error(w, "Search query is empty", http.StatusBadRequest)
+		return
+	}
+	limit := searchLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			utils.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+	kb, ok := ownKnowledgeBase(w, r)
+	if !ok {
+		return
+	}
+
+	results, err := repo.Search(q, []string{kb.ID}, limit)
+	if err != nil {
+		log.Error("Error searching knowledge base", "err", err)
+		utils.Error(w, "Error searching knowledge base", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, KnowledgeSearchResponse{Results: results}, http.StatusOK)
+}
+
+func crawlSite(w http.ResponseWriter, r *http.Request) {
+	var req CrawlRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil || req.MaxDepth < 0 || req.MaxPages < 0 {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if err := utils.ValidateOutboundURL(req.URL); err != nil {
+		utils.Error(w, "Invalid URL: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	kb, ok := ownKnowledgeBase(w, r)
+	if !ok {
+		return
+	}
+
+	payload := crawlPayload{KnowledgeBaseID: kb.ID, URL: req.URL, MaxDepth: crawlDepth, MaxPages: crawlPages}
+	if req.MaxDepth > 0 {
+		payload.MaxDepth = min(req.MaxDepth, maxCrawlDepth)
+	}
+	if req.MaxPages > 0 {
+		payload.MaxPages = min(req.MaxPages, maxCrawlPages)
+	}
+	job, err := jobs.Enqueue(kb.User, CrawlJob, payload)
+	if err != nil {
+		log.Error("Error queuing crawl", "err", err)
+		utils.Error(w, "Error queuing crawl", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, job, http.StatusAccepted)
+}
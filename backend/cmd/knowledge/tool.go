@@ -0,0 +1,58 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+)
+
+const (
+	toolSearchLimit    = 5
+	maxToolSearchLimit = 20
+)
+
+// searchKnowledgeTool searches the knowledge bases attached to the
+// conversation.
+func searchKnowledgeTool(ctx context.Context, args, user, convID string) providers.ToolOutput {
+	var params struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return providers.ToolOutput{Content: fmt.Sprintf("error decoding arguments: %v", err)}
+	}
+	if strings.TrimSpace(params.Query) == "" {
+		return providers.ToolOutput{Content: "error: query is empty"}
+	}
+
+	kbs, err := repo.GetByConversation(convID, user)
+	if err != nil {
+		log.Error("Error querying knowledge bases", "err", err)
+		return providers.ToolOutput{Content: "Error occurred while searching the knowledge bases."}
+	}
+	if len(kbs) == 0 {
+		return providers.ToolOutput{Content: "error: no knowledge base is attached to this conversation"}
+	}
+	ids := make([]string, len(kbs))
+	for i, kb := range kbs {
+		ids[i] = kb.ID
+	}
+	limit := params.Limit
+	if limit <= 0 {
+		limit = toolSearchLimit
+	}
+
+	results, err := repo.Search(params.Query, ids, min(limit, maxToolSearchLimit))
+	if err != nil {
+		log.Error("Error searching knowledge bases", "err", err)
+		return providers.ToolOutput{Content: "Error occurred while searching the knowledge bases."}
+	}
+	if len(results) == 0 {
+		return providers.ToolOutput{Content: "No matching passages found in the attached knowledge bases."}
+	}
+	out, _ := json.Marshal(results)
+	return providers.ToolOutput{Content: string(out), Type: providers.OutputTable}
+}
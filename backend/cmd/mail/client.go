@@ -0,0 +1,61 @@
+package mail
+
+import (
+	"database/sql"
+	"os"
+
+	"github.com/Bajahaw/ai-ui/cmd/settings"
+
+	logger "github.com/charmbracelet/log"
+)
+
+var log *logger.Logger
+var userSettings settings.Repository
+var smtpConfig *Config
+
+// SetupMail reads the SMTP server from the environment, mails are only
+// sent when SMTP_HOST and SMTP_FROM are set.
+func SetupMail(l *logger.Logger, db *sql.DB) {
+	log = l
+	userSettings = settings.NewRepository(db)
+
+	smtpConfig = configFromEnv()
+	if smtpConfig == nil {
+		return
+	}
+	if err := smtpConfig.validate(); err != nil {
+		log.Error("Email disabled, invalid SMTP configuration", "err", err)
+		smtpConfig = nil
+		return
+	}
+	log.Info("Email enabled", "host", smtpConfig.Host, "port", smtpConfig.Port)
+}
+
+func configFromEnv() *Config {
+	host, from := os.Getenv("SMTP_HOST"), os.Getenv("SMTP_FROM")
+	if host == "" || from == "" {
+		return nil
+	}
+	return &Config{
+		Host:     host,
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+		Security: os.Getenv("SMTP_SECURITY"),
+	}
+}
+
+// CheckEnv validates the SMTP server of the environment, it is nil when
+// none is set.
+func CheckEnv() error {
+	if c := configFromEnv(); c != nil {
+		return c.validate()
+	}
+	return nil
+}
+
+// Enabled reports whether an SMTP server is configured.
+func Enabled() bool {
+	return smtpConfig != nil
+}
@@ -0,0 +1,149 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/settings"
+)
+
+// DigestItem is one result in an email digest.
+type DigestItem struct {
+	Title          string
+	ConversationID string
+	Content        string
+	FinishedAt     time.Time
+}
+
+// previewLength is how much of each result is quoted in the mail
+const previewLength = 2000
+
+var (
+	digestMu sync.Mutex
+	queued   = make(map[string][]DigestItem)
+)
+
+// QueueDigest adds a result to the next digest mailed to user, if they
+// opted in with the emailDigest setting and set an emailAddress. Results
+// are collected for emailDigestDelay and sent together. This is the entry
+// point for anything that finishes work while the user is away.
+func QueueDigest(user string, item DigestItem) {
+	if smtpConfig == nil || userSettings == nil {
+		return
+	}
+	if enabled, _ := userSettings.Get("emailDigest", user); enabled != "true" {
+		return
+	}
+	if address, _ := userSettings.Get("emailAddress", user); address == "" {
+		return
+	}
+
+	digestMu.Lock()
+	defer digestMu.Unlock()
+	queued[user] = append(queued[user], item)
+	if len(queued[user]) == 1 {
+		time.AfterFunc(config.Duration("emailDigestDelay"), func() { flushDigest(user) })
+	}
+}
+
+// flushDigest mails the results queued for user. The address is read again
+// so a user who opted out meanwhile is not mailed.
+func flushDigest(user string) {
+	digestMu.Lock()
+	items := queued[user]
+	delete(queued, user)
+	digestMu.Unlock()
+	if len(items) == 0 {
+		return
+	}
+
+	if enabled, _ := userSettings.Get("emailDigest", user); enabled != "true" {
+		return
+	}
+	address, _ := userSettings.Get("emailAddress", user)
+	if address == "" {
+		return
+	}
+
+	msg, err := digestMessage(address, items, config.Get("publicURL"), settings.LocalizerFor(userSettings, user))
+	if err != nil {
+		log.Error("Error rendering email digest", "user", user, "err", err)
+		return
+	}
+	if err := Send(msg); err != nil {
+		log.Error("Error sending email digest", "user", user, "err", err)
+		return
+	}
+	log.Debug("Email digest sent", "user", user, "results", len(items))
+}
+
+type digestEntry struct {
+	DigestItem
+	Preview   string
+	Truncated bool
+	Link      string
+	// Finished is FinishedAt in the time zone and format of the user
+	Finished string
+}
+
+func digestMessage(to string, items []DigestItem, baseURL string, l settings.Localizer) (Message, error) {
+	entries := make([]digestEntry, len(items))
+	for i, item := range items {
+		preview, truncated := truncate(item.Content, previewLength)
+		entries[i] = digestEntry{DigestItem: item, Preview: preview, Truncated: truncated, Finished: l.Time(item.FinishedAt)}
+		if baseURL != "" {
+			entries[i].Link = strings.TrimSuffix(baseURL, "/") + "/c/" + item.ConversationID
+		}
+		if entries[i].Title == "" {
+			entries[i].Title = "Untitled conversation"
+		}
+	}
+
+	subject := "Your response is ready: " + entries[0].Title
+	if len(entries) > 1 {
+		subject = fmt.Sprintf("%d responses are ready", len(entries))
+	}
+
+	var text, html bytes.Buffer
+	if err := textDigest.Execute(&text, entries); err != nil {
+		return Message{}, err
+	}
+	if err := htmlDigest.Execute(&html, entries); err != nil {
+		return Message{}, err
+	}
+	return Message{To: to, Subject: subject, Text: text.String(), HTML: html.String()}, nil
+}
+
+// truncate cuts s to at most n runes.
+func truncate(s string, n int) (string, bool) {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s, false
+	}
+	return string(runes[:n]), true
+}
+
+var textDigest = template.Must(template.New("text").Parse(
+	`{{range .}}{{.Title}}
+Finished {{.Finished}}{{if .Link}}
+{{.Link}}{{end}}
+
+{{.Preview}}{{if .Truncated}}
+[...]{{end}}
+
+{{end}}`))
+
+var htmlDigest = htmltemplate.Must(htmltemplate.New("html").Parse(
+	`<!DOCTYPE html>
+<html><body style="font-family: sans-serif; max-width: 40em">
+{{range .}}<h3>{{if .Link}}<a href="{{.Link}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</h3>
+<p style="color: #666">Finished {{.Finished}}</p>
+<div style="white-space: pre-wrap">{{.Preview}}{{if .Truncated}} [...]{{end}}</div>
+<hr>
+{{end}}</body></html>`))
@@ -0,0 +1,105 @@
+package mail
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func setupTest(t *testing.T) chan Message {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_FROM", "AI UI <ai@example.com>")
+	t.Setenv("EMAIL_DIGEST_DELAY", "50ms")
+	SetupMail(logger.New(os.Stdout), db)
+	t.Cleanup(func() { smtpConfig = nil })
+
+	sent := make(chan Message, 10)
+	original := send
+	send = func(c *Config, msg Message) error {
+		sent <- msg
+		return nil
+	}
+	t.Cleanup(func() { send = original })
+	return sent
+}
+
+func TestConfigDefaults(t *testing.T) {
+	c := &Config{Host: "smtp.example.com", From: "ai@example.com", Security: SecurityTLS}
+	if err := c.validate(); err != nil || c.Port != "465" {
+		t.Errorf("expected port 465 for implicit TLS, got %q (%v)", c.Port, err)
+	}
+	c = &Config{Host: "smtp.example.com", From: "ai@example.com", Security: "ssl"}
+	if err := c.validate(); err == nil {
+		t.Error("expected an unknown security mode to be rejected")
+	}
+}
+
+func TestCompose(t *testing.T) {
+	msg := Message{To: "me@example.com", Subject: "Résumé ready", Text: "plain", HTML: "<p>rich</p>"}
+	raw := string(compose("ai@example.com", msg, time.Now()))
+
+	for _, want := range []string{
+		"To: me@example.com\r\n",
+		"Subject: =?utf-8?q?R=C3=A9sum=C3=A9_ready?=\r\n",
+		"multipart/alternative",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Type: text/html; charset=utf-8",
+		"<p>rich</p>",
+	} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("expected %q in the message:\n%s", want, raw)
+		}
+	}
+}
+
+func TestQueueDigest(t *testing.T) {
+	sent := setupTest(t)
+
+	QueueDigest("u", DigestItem{Title: "first", ConversationID: "c1", Content: "one", FinishedAt: time.Now()})
+	select {
+	case <-sent:
+		t.Fatal("expected no mail before the user opted in")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := userSettings.Save(map[string]string{"emailDigest": "true", "emailAddress": "me@example.com", "timezone": "Asia/Tokyo", "locale": "de-DE"}, "u"); err != nil {
+		t.Fatal(err)
+	}
+	QueueDigest("u", DigestItem{Title: "first", ConversationID: "c1", Content: "one", FinishedAt: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)})
+	QueueDigest("u", DigestItem{Title: "second", ConversationID: "c2", Content: "two", FinishedAt: time.Now()})
+
+	select {
+	case msg := <-sent:
+		if msg.To != "me@example.com" || msg.Subject != "2 responses are ready" {
+			t.Errorf("unexpected digest %+v", msg)
+		}
+		if !strings.Contains(msg.Text, "first") || !strings.Contains(msg.HTML, "second") {
+			t.Errorf("expected both results in the digest, got %q", msg.Text)
+		}
+		if !strings.Contains(msg.Text, "Finished 2025-03-01 21:00 JST") {
+			t.Errorf("expected the time in the user's zone, got %q", msg.Text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no digest was sent")
+	}
+	select {
+	case msg := <-sent:
+		t.Errorf("expected a single digest, got another %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,181 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	SecurityStartTLS = "starttls"
+	SecurityTLS      = "tls"
+	// SecurityNone sends mails in plain text, for a relay on the same host
+	SecurityNone = "none"
+)
+
+// Config of the SMTP server mails are sent through.
+type Config struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	// Security is starttls (the default), tls for implicit TLS or none
+	Security string
+}
+
+// Message is a mail with a plain text body and an optional HTML one.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+var ErrDisabled = errors.New("email is not configured")
+
+const timeout = 30 * time.Second
+
+// send delivers a message, replaced in tests
+var send = sendSMTP
+
+// Send mails msg through the configured SMTP server.
+func Send(msg Message) error {
+	if smtpConfig == nil {
+		return ErrDisabled
+	}
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+	return send(smtpConfig, msg)
+}
+
+func (c *Config) validate() error {
+	if c.Security == "" {
+		c.Security = SecurityStartTLS
+	}
+	if !slices.Contains([]string{SecurityStartTLS, SecurityTLS, SecurityNone}, c.Security) {
+		return fmt.Errorf("SMTP_SECURITY must be %s, %s or %s", SecurityStartTLS, SecurityTLS, SecurityNone)
+	}
+	if c.Port == "" {
+		c.Port = "587"
+		if c.Security == SecurityTLS {
+			c.Port = "465"
+		}
+	}
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		return fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+	return nil
+}
+
+func sendSMTP(c *Config, msg Message) error {
+	addr := net.JoinHostPort(c.Host, c.Port)
+	tlsConfig := &tls.Config{ServerName: c.Host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: timeout}
+	if c.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if c.Security == SecurityStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if c.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.Username, c.Password, c.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	from, _ := mail.ParseAddress(c.From)
+	to, _ := mail.ParseAddress(msg.To)
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(compose(c.From, msg, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// compose renders msg as a MIME mail, multipart/alternative when it has
+// an HTML body.
+func compose(from string, msg Message, date time.Time) []byte {
+	var b bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", key, value)
+	}
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+
+	if msg.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		b.WriteString("\r\n")
+		writeQuoted(&b, msg.Text)
+		return b.Bytes()
+	}
+
+	boundary := "ai-ui-" + strings.ToLower(rand.Text())
+	header("Content-Type", `multipart/alternative; boundary="`+boundary+`"`)
+	b.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	} {
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		header("Content-Type", part.contentType+"; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		b.WriteString("\r\n")
+		writeQuoted(&b, part.body)
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes()
+}
+
+func writeQuoted(b *bytes.Buffer, text string) {
+	w := quotedprintable.NewWriter(b)
+	_, _ = w.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n")))
+	_ = w.Close()
+}
@@ -5,23 +5,40 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"strings"
 	"syscall"
 	"time"
 
+	"github.com/Bajahaw/ai-ui/cmd/account"
+	"github.com/Bajahaw/ai-ui/cmd/admin"
+	"github.com/Bajahaw/ai-ui/cmd/audit"
 	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/bridge"
 	"github.com/Bajahaw/ai-ui/cmd/chat"
+	"github.com/Bajahaw/ai-ui/cmd/config"
 	"github.com/Bajahaw/ai-ui/cmd/data"
 	"github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/idempotency"
+	"github.com/Bajahaw/ai-ui/cmd/jobs"
+	"github.com/Bajahaw/ai-ui/cmd/knowledge"
+	"github.com/Bajahaw/ai-ui/cmd/mail"
+	"github.com/Bajahaw/ai-ui/cmd/memory"
+	"github.com/Bajahaw/ai-ui/cmd/moderation"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
 	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/provision"
 	"github.com/Bajahaw/ai-ui/cmd/settings"
+	"github.com/Bajahaw/ai-ui/cmd/templates"
 	"github.com/Bajahaw/ai-ui/cmd/tools"
+	"github.com/Bajahaw/ai-ui/cmd/tracing"
+	"github.com/Bajahaw/ai-ui/cmd/usage"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 	"github.com/Bajahaw/ai-ui/cmd/version"
+	"github.com/Bajahaw/ai-ui/cmd/web"
+	"github.com/Bajahaw/ai-ui/cmd/webhooks"
 
 	logger "github.com/charmbracelet/log"
 	"github.com/joho/godotenv"
@@ -31,19 +48,51 @@ var log *logger.Logger
 var db *sql.DB
 var provider providers.Client
 
+// console is where logs go, stdout unless a CLI command writes there
+var console io.Writer = os.Stdout
+
 func main() {
+	name, args := command(os.Args[1:])
+	if name != "serve" {
+		// keep stdout for what the command prints
+		console = os.Stderr
+	}
+
 	setupEnv()
 	setupLogger()
 	setupUtils()
 
+	os.Exit(runCommand(name, args))
+}
+
+// serve sets up every part of the app and runs the server until it is
+// stopped.
+func serve() {
+	setupTracing()
+
 	startDataSource()
 
+	setupConfig()
+	setupAudit()
 	setupAuth()
+	setupUsage()
 	setupProviderClient()
 	setupSettings()
 	setupFiles()
 	setupChatClient()
 	setupTools()
+	setupProvision()
+	setupAccount()
+	setupAdmin()
+	setupTemplates()
+	setupMemory()
+	setupKnowledge()
+	setupWebhooks()
+	setupIdempotency()
+	setupMail()
+	setupModeration()
+	setupBridge()
+	setupJobs()
 
 	startServer()
 }
@@ -51,30 +100,38 @@ func main() {
 func setupEnv() {
 	err := godotenv.Load("./.env")
 	if err != nil {
-		fmt.Println("No .env file found, proceeding with system environment variables")
+		fmt.Fprintln(console, "No .env file found, proceeding with system environment variables")
 	}
 }
 
 func setupLogger() {
-	log = logger.NewWithOptions(os.Stdout, logger.Options{
+	log = logger.NewWithOptions(console, logger.Options{
 		ReportTimestamp: true,
 	})
 
 	env := os.Getenv("ENV")
 	if env == "dev" {
 		log.SetLevel(logger.DebugLevel)
-		fmt.Println("--- Development mode: setting log level to DEBUG ---")
+		fmt.Fprintln(console, "--- Development mode: setting log level to DEBUG ---")
 	} else {
 		log.SetLevel(logger.InfoLevel)
-		fmt.Println("--- Production mode: setting log level to INFO ---")
+		fmt.Fprintln(console, "--- Production mode: setting log level to INFO ---")
 	}
 }
 
 func setupTools() {
 	tools.SetUpTools(log, db)
+	tools.LoadPlugins()
 	log.Info("Tools set up successfully")
 }
 
+// setupProvision applies the config file once users, settings, providers
+// and tools are set up.
+func setupProvision() {
+	provision.SetupProvision(log, db)
+	log.Info("Provisioning set up successfully")
+}
+
 func setupUtils() {
 	utils.Setup(log)
 	log.Info("Utils set up successfully")
@@ -83,6 +140,7 @@ func setupUtils() {
 func setupProviderClient() {
 	providers.SetupProviderClient(log, db)
 	provider = providers.NewClient()
+	providers.SetupDeclaredProviders()
 	log.Info("Provider client set up successfully")
 }
 
@@ -91,6 +149,11 @@ func setupChatClient() {
 	log.Info("Chat client set up successfully")
 }
 
+func setupConfig() {
+	config.Setup(log, db)
+	log.Info("Config loaded successfully")
+}
+
 func setupSettings() {
 	settings.SetupSettings(log, db)
 	log.Info("Settings set up successfully")
@@ -101,8 +164,78 @@ func setupFiles() {
 	log.Info("Files set up successfully")
 }
 
+func setupAccount() {
+	account.SetupAccount(log, db)
+	log.Info("Account set up successfully")
+}
+
+func setupAdmin() {
+	admin.SetupAdmin(log, db)
+	log.Info("Admin set up successfully")
+}
+
+func setupTemplates() {
+	templates.SetupTemplates(log, db)
+	log.Info("Templates set up successfully")
+}
+
+func setupMemory() {
+	memory.SetupMemory(log, db)
+	log.Info("Memory set up successfully")
+}
+
+func setupAudit() {
+	audit.SetupAudit(log, db)
+	log.Info("Audit log set up successfully")
+}
+
+func setupUsage() {
+	usage.SetupUsage(log, db)
+	log.Info("Usage set up successfully")
+}
+
+func setupKnowledge() {
+	knowledge.SetupKnowledge(log, db)
+	log.Info("Knowledge bases set up successfully")
+}
+
+func setupWebhooks() {
+	webhooks.SetupWebhooks(log, db)
+	log.Info("Webhooks set up successfully")
+}
+
+func setupIdempotency() {
+	idempotency.SetupIdempotency(log, db)
+	log.Info("Idempotency set up successfully")
+}
+
+func setupTracing() {
+	tracing.SetupTracing(log)
+}
+
+func setupMail() {
+	mail.SetupMail(log, db)
+	log.Info("Mail set up successfully")
+}
+
+func setupModeration() {
+	moderation.SetupModeration(log, db)
+	log.Info("Moderation set up successfully")
+}
+
+func setupBridge() {
+	bridge.SetupBridge(log, db)
+	log.Info("Bridge set up successfully")
+}
+
+// setupJobs starts the workers once every package registered its jobs.
+func setupJobs() {
+	jobs.SetupJobs(log, db)
+	log.Info("Jobs set up successfully")
+}
+
 func startDataSource() {
-	err := data.InitDataSource("./data/ai-ui.db")
+	err := data.InitDataSource(databaseFile)
 	if err != nil {
 		log.Fatal("Failed to initialize data source", "err", err)
 	}
@@ -119,50 +252,21 @@ func setupAuth() {
 	auth.OnRegister = []auth.PostRegisterHook{
 		settings.SetDefaults,
 		tools.SaveDefaultMCPServer,
+		providers.SyncDeclaredProviders,
+		tools.SyncDeclaredMCPServers,
+		provision.SyncUser,
 	}
 }
 
-// spaHandler serves static files and falls back to index.html for unknown
-// paths so that client-side routes work on hard refresh.
-type spaHandler struct {
-	staticDir string
-	fs        http.Handler
-}
-
-func (h spaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	staticAbs, err := filepath.Abs(h.staticDir)
-	if err != nil {
-		http.ServeFile(w, r, filepath.Join(h.staticDir, "index.html"))
-		return
-	}
-
-	cleanReqPath := filepath.Clean("/" + r.URL.Path)
-	cleanReqPath = strings.TrimPrefix(cleanReqPath, string(filepath.Separator))
-
-	requestedPath, err := filepath.Abs(filepath.Join(staticAbs, cleanReqPath))
-	if err != nil || (requestedPath != staticAbs && !strings.HasPrefix(requestedPath, staticAbs+string(filepath.Separator))) {
-		// Invalid or escaping static dir – serve SPA shell
-		http.ServeFile(w, r, filepath.Join(h.staticDir, "index.html"))
-		return
-	}
-
-	if _, err := os.Stat(requestedPath); os.IsNotExist(err) {
-		// Not a real file – serve the SPA shell
-		http.ServeFile(w, r, filepath.Join(h.staticDir, "index.html"))
-		return
-	}
-
-	h.fs.ServeHTTP(w, r)
-}
-
-func startServer() {
-
-	staticDir := "./static"
-	rawFs := http.FileServer(http.Dir(staticDir))
-	dataFs := http.FileServer(http.Dir("./data/resources"))
+// routes mounts the frontend and every API handler, which also registers
+// the routes of the OpenAPI spec.
+func routes() *http.ServeMux {
+	assets, source := web.Assets()
+	log.Info("Serving frontend", "from", source)
+	dataFs := http.FileServer(http.Dir(uploadDir))
 	mux := http.NewServeMux()
 
-	mux.Handle("/", spaHandler{staticDir: staticDir, fs: rawFs})
+	mux.Handle("/", web.Handler(assets))
 	mux.Handle("/data/resources/",
 		http.StripPrefix(
 			"/data/resources/",
@@ -172,31 +276,94 @@ func startServer() {
 	mux.Handle("/api/chat/", chat.Handler())
 	mux.Handle("/api/files/", files.FileHandler())
 	mux.Handle("/api/conversations/", chat.ConvsHandler())
+	mux.Handle("/api/sessions/", chat.SessionsHandler())
 	mux.Handle("/api/providers/", providers.Handler())
 	mux.Handle("/api/models/", providers.ModelsHandler())
 	mux.Handle("/api/settings/", settings.SettingsHandler())
 	mux.Handle("/api/tools/", tools.Handler())
 	mux.Handle("/api/auth/", auth.Handler())
+	mux.Handle("/api/account/", account.Handler())
+	mux.Handle("/api/admin/", admin.Handler())
+	mux.Handle("/api/templates/", templates.Handler())
+	mux.Handle("/api/prompts/", templates.PromptsHandler())
+	mux.Handle("/api/memory/", memory.Handler())
+	mux.Handle("/api/knowledge/", knowledge.Handler())
+	mux.Handle("/api/jobs/", jobs.Handler())
+	mux.Handle("/api/usage/", usage.Handler())
+	mux.Handle("/api/webhooks/", webhooks.Handler())
+	mux.Handle("/api/bridge/", bridge.Handler())
+	mux.Handle("/api/moderation/", moderation.Handler())
 	mux.HandleFunc("/api/version", version.HandleGetVersion)
+	mux.HandleFunc("GET /api/openapi.json", openapi.Handler)
+
+	openapi.Register("GET", "/api/version", "Meta", openapi.Op{
+		Summary:  "Get the server version",
+		Response: version.VersionResponse{},
+		Public:   true,
+	})
+	openapi.Register("GET", "/api/openapi.json", "Meta", openapi.Op{
+		Summary:     "Get this OpenAPI description",
+		ContentType: "application/json",
+		Public:      true,
+	})
+
+	return mux
+}
+
+func startServer() {
+	mux := routes()
 
 	server := &http.Server{
 		Addr:         ":8080",
-		Handler:      utils.Middleware(mux),
+		Handler:      tracing.Handler(utils.Middleware(mux)),
 		ReadTimeout:  30 * time.Minute,
 		WriteTimeout: 0, // 0 = no timeout; required for SSE connections
 		IdleTimeout:  30 * time.Minute,
 	}
 
+	tlsSetup, err := loadTLSSetup()
+	if err != nil {
+		log.Fatal("Invalid TLS configuration", "err", err)
+	}
+
+	var redirectServer *http.Server
+	if tlsSetup != nil {
+		server.Addr = tlsSetup.httpsAddr
+		server.TLSConfig = tlsSetup.serverConfig()
+		if tlsSetup.httpAddr != "" {
+			redirectServer = &http.Server{
+				Addr:              tlsSetup.httpAddr,
+				Handler:           tlsSetup.redirectHandler(),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+		}
+	}
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if tlsSetup != nil {
+			err = server.ListenAndServeTLS(tlsSetup.certFile, tlsSetup.keyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatal("Server Failed", "err", err)
 		}
 	}()
 
-	log.Info("Server started on port 8080")
+	if redirectServer != nil {
+		go func() {
+			if err := redirectServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal("HTTP redirect server Failed", "err", err)
+			}
+		}()
+		log.Info("Redirecting HTTP to HTTPS", "addr", redirectServer.Addr)
+	}
+
+	log.Info("Server started", "addr", server.Addr, "tls", tlsSetup != nil)
 
 	<-stop
 
@@ -204,9 +371,13 @@ func startServer() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if redirectServer != nil {
+		_ = redirectServer.Shutdown(ctx)
+	}
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatal("Server Shutdown Failed", "err", err)
 	}
+	tracing.Shutdown(ctx)
 
 	log.Info("Server gracefully stopped")
 }
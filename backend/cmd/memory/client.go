@@ -0,0 +1,15 @@
+package memory
+
+import (
+	"database/sql"
+
+	logger "github.com/charmbracelet/log"
+)
+
+var log *logger.Logger
+var repo Repository
+
+func SetupMemory(l *logger.Logger, db *sql.DB) {
+	log = l
+	repo = NewRepository(db)
+}
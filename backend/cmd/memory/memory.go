@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// MaxContextMemories caps how many memories are injected into a prompt.
+const MaxContextMemories = 20
+
+// MaxLength is the longest fact that can be stored.
+const MaxLength = 1000
+
+// Relevant picks up to limit memories for the given query. When there are
+// more memories than the limit, the ones sharing the most words with the
+// query win and ties keep the input order (most recent first).
+func Relevant(memories []*Memory, query string, limit int) []*Memory {
+	if len(memories) <= limit {
+		return memories
+	}
+
+	queryWords := words(query)
+	scores := make(map[int64]int, len(memories))
+	for _, m := range memories {
+		for w := range words(m.Content) {
+			if queryWords[w] {
+				scores[m.ID]++
+			}
+		}
+	}
+
+	ranked := make([]*Memory, len(memories))
+	copy(ranked, memories)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i].ID] > scores[ranked[j].ID]
+	})
+	return ranked[:limit]
+}
+
+// Prompt formats memories as a system prompt section.
+func Prompt(memories []*Memory) string {
+	if len(memories) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<user_memories>\n")
+	sb.WriteString("Facts the user asked you to remember from earlier conversations. Use them when relevant.\n\n")
+	for _, m := range memories {
+		sb.WriteString("- ")
+		sb.WriteString(strings.ReplaceAll(m.Content, "\n", " "))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("</user_memories>")
+	return sb.String()
+}
+
+func words(text string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		// short words are mostly stop words
+		if len(w) > 2 {
+			set[w] = true
+		}
+	}
+	return set
+}
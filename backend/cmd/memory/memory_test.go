@@ -0,0 +1,27 @@
+package memory
+
+import "testing"
+
+func TestRelevant(t *testing.T) {
+	memories := []*Memory{
+		{ID: 1, Content: "Prefers answers in British English"},
+		{ID: 2, Content: "Works on a Kotlin Android app"},
+		{ID: 3, Content: "Has a dog named Rex"},
+	}
+
+	if got := Relevant(memories, "anything", 5); len(got) != 3 {
+		t.Fatalf("expected all memories under the limit, got %d", len(got))
+	}
+
+	got := Relevant(memories, "How do I fix this Kotlin coroutine in my app?", 2)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 memories, got %d", len(got))
+	}
+	if got[0].ID != 2 {
+		t.Errorf("expected the Kotlin memory first, got %d", got[0].ID)
+	}
+	// no overlap for the rest, recency order is kept
+	if got[1].ID != 1 {
+		t.Errorf("expected the most recent unrelated memory second, got %d", got[1].ID)
+	}
+}
@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	SourceUser      = "user"
+	SourceAssistant = "assistant"
+)
+
+type Memory struct {
+	ID        int64     `json:"id"`
+	User      string    `json:"-"`
+	Content   string    `json:"content"`
+	Source    string    `json:"source"`
+	ConvID    string    `json:"convId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type Repository interface {
+	GetAll(user string) ([]*Memory, error)
+	GetByID(id int64, user string) (*Memory, error)
+	Save(memory *Memory) error
+	Update(memory *Memory) error
+	DeleteByID(id int64, user string) error
+}
+
+type RepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) GetAll(user string) ([]*Memory, error) {
+	query := `
+		SELECT id, user, content, source, COALESCE(conv_id, ''), created_at, updated_at
+		FROM Memories
+		WHERE user = ?
+		ORDER BY updated_at DESC, id DESC
+	`
+	rows, err := r.db.Query(query, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memories := make([]*Memory, 0)
+	for rows.Next() {
+		var m Memory
+		if err := rows.Scan(&m.ID, &m.User, &m.Content, &m.Source, &m.ConvID, &m.CreatedAt, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		memories = append(memories, &m)
+	}
+	return memories, rows.Err()
+}
+
+func (r *RepositoryImpl) GetByID(id int64, user string) (*Memory, error) {
+	query := `
+		SELECT id, user, content, source, COALESCE(conv_id, ''), created_at, updated_at
+		FROM Memories
+		WHERE id = ? AND user = ?
+	`
+	var m Memory
+	err := r.db.QueryRow(query, id, user).Scan(&m.ID, &m.User, &m.Content, &m.Source, &m.ConvID, &m.CreatedAt, &m.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *RepositoryImpl) Save(m *Memory) error {
+	now := time.Now().UTC()
+	m.CreatedAt = now
+	m.UpdatedAt = now
+
+	var convID any
+	if m.ConvID != "" {
+		convID = m.ConvID
+	}
+
+	query := `INSERT INTO Memories (user, content, source, conv_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`
+	res, err := r.db.Exec(query, m.User, m.Content, m.Source, convID, m.CreatedAt, m.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	m.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *RepositoryImpl) Update(m *Memory) error {
+	m.UpdatedAt = time.Now().UTC()
+	query := `UPDATE Memories SET content = ?, updated_at = ? WHERE id = ? AND user = ?`
+	res, err := r.db.Exec(query, m.Content, m.UpdatedAt, m.ID, m.User)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *RepositoryImpl) DeleteByID(id int64, user string) error {
+	res, err := r.db.Exec(`DELETE FROM Memories WHERE id = ? AND user = ?`, id, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package memory
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+type MemoryRequest struct {
+	Content string `json:"content"`
+}
+
+type MemoriesResponse struct {
+	Memories []*Memory `json:"memories"`
+}
+
+func Handler() http.Handler {
+	mux := openapi.NewRouter("/api/memory", "Memory")
+
+	mux.HandleFunc("GET /", listMemories, openapi.Op{Summary: "List the memories of the user", Response: MemoriesResponse{}})
+	mux.HandleFunc("POST /", createMemory, openapi.Op{Summary: "Add a memory", Request: MemoryRequest{}, Response: Memory{}, Status: http.StatusCreated})
+	mux.HandleFunc("PUT /{id}", updateMemory, openapi.Op{Summary: "Edit a memory", Request: MemoryRequest{}, Response: Memory{}})
+	mux.HandleFunc("DELETE /{id}", deleteMemory, openapi.Op{Summary: "Delete a memory", Status: http.StatusNoContent})
+
+	return http.StripPrefix("/api/memory", auth.Authenticated(mux))
+}
+
+func listMemories(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	memories, err := repo.GetAll(user)
+	if err != nil {
+		log.Error("Error querying memories", "err", err)
+		utils.Error(w, "Error querying memories", http.StatusInternalServerError)
+		return
+	}
+
+	response := MemoriesResponse{Memories: memories}
+	utils.RespondWithJSON(w, &response, http.StatusOK)
+}
+
+func createMemory(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req MemoryRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil || !req.valid() {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	m := &Memory{
+		User:    user,
+		Content: strings.TrimSpace(req.Content),
+		Source:  SourceUser,
+	}
+	if err := repo.Save(m); err != nil {
+		log.Error("Error saving memory", "err", err)
+		utils.Error(w, "Error saving memory", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, m, http.StatusCreated)
+}
+
+func updateMemory(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.Error(w, "Invalid memory ID", http.StatusBadRequest)
+		return
+	}
+
+	var req MemoryRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil || !req.valid() {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	m, err := repo.GetByID(id, user)
+	if err != nil {
+		utils.Error(w, "Memory not found", http.StatusNotFound)
+		return
+	}
+
+	m.Content = strings.TrimSpace(req.Content)
+	if err := repo.Update(m); err != nil {
+		log.Error("Error updating memory", "err", err)
+		utils.Error(w, "Error updating memory", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, m, http.StatusOK)
+}
+
+func deleteMemory(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.Error(w, "Invalid memory ID", http.StatusBadRequest)
+		return
+	}
+
+	err = repo.DeleteByID(id, user)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Memory not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error deleting memory", "err", err)
+		utils.Error(w, "Error deleting memory", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (req *MemoryRequest) valid() bool {
+	content := strings.TrimSpace(req.Content)
+	return content != "" && len(content) <= MaxLength
+}
@@ -0,0 +1,20 @@
+package moderation
+
+import (
+	"database/sql"
+	"os"
+
+	logger "github.com/charmbracelet/log"
+)
+
+var log *logger.Logger
+var repo Repository
+
+// apiKey authenticates with the API of the moderation model, if it needs one
+var apiKey string
+
+func SetupModeration(l *logger.Logger, db *sql.DB) {
+	log = l
+	repo = NewRepository(db)
+	apiKey = os.Getenv("MODERATION_API_KEY")
+}
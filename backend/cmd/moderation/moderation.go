@@ -0,0 +1,214 @@
+// Package moderation checks the messages of users and the answers of
+// models against the rules and model an admin configured, and records what
+// it flags.
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+)
+
+type Stage string
+
+const (
+	// StageInput is a message written by the user
+	StageInput Stage = "input"
+	// StageOutput is an answer of a model
+	StageOutput Stage = "output"
+)
+
+const (
+	ActionAnnotate = "annotate"
+	ActionBlock    = "block"
+)
+
+const (
+	SourceRules = "rules"
+	SourceModel = "model"
+)
+
+// modelTimeout bounds the wait for the moderation model, content is let
+// through when it does not answer in time.
+const modelTimeout = 30 * time.Second
+
+// excerptLength is how much of flagged content is recorded.
+const excerptLength = 200
+
+// Decision is the outcome of checking flagged content.
+type Decision struct {
+	ID             int64     `json:"id"`
+	User           string    `json:"user"`
+	ConversationID string    `json:"conversationId"`
+	MessageID      int       `json:"messageId"`
+	Stage          Stage     `json:"stage"`
+	Source         string    `json:"source"`
+	Categories     []string  `json:"categories"`
+	Action         string    `json:"action"`
+	Excerpt        string    `json:"excerpt"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// Blocked reports whether the content must not be used.
+func (d *Decision) Blocked() bool {
+	return d != nil && d.Action == ActionBlock
+}
+
+// Enabled reports whether rules or a model are configured.
+func Enabled() bool {
+	return len(config.List("moderationRules")) > 0 || modelConfigured()
+}
+
+// Blocking reports whether flagged content is blocked rather than only
+// marked.
+func Blocking() bool {
+	return Enabled() && config.Get("moderationAction") == ActionBlock
+}
+
+func modelConfigured() bool {
+	return config.Get("moderationModel") != "" && config.Get("moderationBaseURL") != ""
+}
+
+// Check runs text through the rules and then the model. Flagged content is
+// recorded and returned as a decision, nil means the content passed.
+// Errors of the model let the content through.
+func Check(ctx context.Context, user string, convID string, messageID int, stage Stage, text string) *Decision {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+
+	source, categories := "", []string(nil)
+	if terms := matchRules(config.List("moderationRules"), text); len(terms) > 0 {
+		source, categories = SourceRules, terms
+	} else if modelConfigured() {
+		flagged, cats, err := classify(ctx, stage, text)
+		if err != nil {
+			log.Warn("Moderation model failed, letting content through", "user", user, "stage", stage, "err", err)
+			return nil
+		}
+		if !flagged {
+			return nil
+		}
+		source, categories = SourceModel, cats
+	}
+	if source == "" {
+		return nil
+	}
+
+	d := &Decision{
+		User:           user,
+		ConversationID: convID,
+		MessageID:      messageID,
+		Stage:          stage,
+		Source:         source,
+		Categories:     categories,
+		Action:         config.Get("moderationAction"),
+		Excerpt:        excerpt(text),
+		CreatedAt:      time.Now().UTC(),
+	}
+	if d.Categories == nil {
+		d.Categories = []string{}
+	}
+	if err := repo.Save(d); err != nil {
+		log.Error("Error saving moderation decision", "user", user, "err", err)
+	}
+	log.Info("Content flagged by moderation", "user", user, "stage", stage, "source", source, "action", d.Action)
+	return d
+}
+
+// matchRules returns the terms found in text as whole words.
+func matchRules(terms []string, text string) []string {
+	var matched []string
+	for _, term := range terms {
+		re, err := regexp.Compile(`(?i)\b` + regexp.QuoteMeta(term) + `\b`)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(text) {
+			matched = append(matched, term)
+		}
+	}
+	return matched
+}
+
+const classifierPrompt = `You are a content moderator. Decide whether the following %s is safe for a shared family chat. ` +
+	`Reply with "safe", or with "unsafe" followed on the next line by a comma separated list of the violated categories.`
+
+var classify = classifyWithModel
+
+// httpClient is not guarded like the one of user supplied addresses, an
+// admin configures the moderation model, often on a local network.
+var httpClient = &http.Client{Transport: utils.OutboundTransport("")}
+
+// classifyWithModel asks the moderation model. The reply format is the one
+// of Llama Guard, which other instruction following models are asked to use.
+func classifyWithModel(ctx context.Context, stage Stage, text string) (bool, []string, error) {
+	ctx, cancel := context.WithTimeout(ctx, modelTimeout)
+	defer cancel()
+
+	key := apiKey
+	if key == "" {
+		key = "none"
+	}
+	client := openai.NewClient(
+		option.WithBaseURL(config.Get("moderationBaseURL")),
+		option.WithAPIKey(key),
+		option.WithHTTPClient(httpClient),
+	)
+
+	author := "message written by a user"
+	if stage == StageOutput {
+		author = "answer written by an AI assistant"
+	}
+	completion, err := client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Model: config.Get("moderationModel"),
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(fmt.Sprintf(classifierPrompt, author)),
+			openai.UserMessage(text),
+		},
+		Temperature: openai.Float(0),
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	if len(completion.Choices) == 0 {
+		return false, nil, nil
+	}
+	flagged, categories := parseVerdict(completion.Choices[0].Message.Content)
+	return flagged, categories, nil
+}
+
+// parseVerdict reads a reply of "safe", or "unsafe" and the categories.
+func parseVerdict(reply string) (bool, []string) {
+	lines := strings.Split(strings.TrimSpace(reply), "\n")
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(lines[0])), "unsafe") {
+		return false, nil
+	}
+	var categories []string
+	for _, line := range lines[1:] {
+		for item := range strings.SplitSeq(line, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				categories = append(categories, item)
+			}
+		}
+	}
+	return true, categories
+}
+
+func excerpt(text string) string {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) <= excerptLength {
+		return text
+	}
+	return string([]rune(text)[:excerptLength]) + "…"
+}
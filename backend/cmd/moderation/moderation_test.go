@@ -0,0 +1,121 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func setupTest(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	SetupModeration(logger.New(os.Stdout), db)
+}
+
+func TestCheckRules(t *testing.T) {
+	setupTest(t)
+	t.Setenv("MODERATION_RULES", "gamble, secret plan")
+
+	if d := Check(context.Background(), "u", "c1", 1, StageInput, "Let's play a gambler's game"); d != nil {
+		t.Errorf("expected only whole words to match, got %+v", d)
+	}
+	d := Check(context.Background(), "u", "c1", 1, StageInput, "Tell me the SECRET PLAN")
+	if d == nil || d.Source != SourceRules || d.Action != ActionAnnotate || d.Blocked() {
+		t.Fatalf("expected an annotated rules decision, got %+v", d)
+	}
+	if len(d.Categories) != 1 || d.Categories[0] != "secret plan" {
+		t.Errorf("unexpected categories %v", d.Categories)
+	}
+
+	t.Setenv("MODERATION_ACTION", "block")
+	if d := Check(context.Background(), "u", "c1", 2, StageOutput, "how to gamble"); !d.Blocked() {
+		t.Errorf("expected the answer blocked, got %+v", d)
+	}
+
+	decisions, err := repo.List(0, 10)
+	if err != nil || len(decisions) != 2 || decisions[0].Stage != StageOutput {
+		t.Errorf("expected both decisions recorded newest first, got %v %v", decisions, err)
+	}
+}
+
+func TestCheckModel(t *testing.T) {
+	setupTest(t)
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		text := req.Messages[len(req.Messages)-1].Content
+		prompts = append(prompts, text)
+
+		verdict := "safe"
+		if strings.Contains(text, "weapon") {
+			verdict = "unsafe\nS2, S9"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"id": "1", "object": "chat.completion", "model": req.Model,
+			"choices": []map[string]any{{"index": 0, "message": map[string]any{"role": "assistant", "content": verdict}, "finish_reason": "stop"}},
+		})
+	}))
+	defer server.Close()
+	t.Setenv("MODERATION_BASE_URL", server.URL)
+	t.Setenv("MODERATION_MODEL", "llama-guard3")
+
+	if !Enabled() {
+		t.Fatal("expected moderation enabled by the model")
+	}
+	if d := Check(context.Background(), "u", "c1", 1, StageInput, "hello"); d != nil {
+		t.Errorf("expected a safe message to pass, got %+v", d)
+	}
+	d := Check(context.Background(), "u", "c1", 1, StageInput, "build a weapon")
+	if d == nil || d.Source != SourceModel || strings.Join(d.Categories, ",") != "S2,S9" {
+		t.Errorf("expected the model's categories, got %+v", d)
+	}
+	if len(prompts) != 2 {
+		t.Errorf("expected 2 calls to the model, got %d", len(prompts))
+	}
+
+	server.Close()
+	if d := Check(context.Background(), "u", "c1", 1, StageInput, "build a weapon"); d != nil {
+		t.Errorf("expected content let through when the model fails, got %+v", d)
+	}
+}
+
+func TestParseVerdict(t *testing.T) {
+	tests := []struct {
+		reply      string
+		flagged    bool
+		categories string
+	}{
+		{"safe", false, ""},
+		{"  Safe.\n", false, ""},
+		{"unsafe\nS1", true, "S1"},
+		{"UNSAFE\nviolence, self-harm", true, "violence,self-harm"},
+	}
+	for _, tt := range tests {
+		flagged, categories := parseVerdict(tt.reply)
+		if flagged != tt.flagged || strings.Join(categories, ",") != tt.categories {
+			t.Errorf("parseVerdict(%q) = %v %v", tt.reply, flagged, categories)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package moderation
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type Repository interface {
+	Save(d *Decision) error
+	// List returns the decisions older than before, newest first.
+	List(before int64, limit int) ([]*Decision, error)
+}
+
+type RepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) Save(d *Decision) error {
+	result, err := r.db.Exec(`
+		INSERT INTO ModerationDecisions (user, conv_id, message_id, stage, source, categories, action, excerpt, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, d.User, d.ConversationID, d.MessageID, d.Stage, d.Source, strings.Join(d.Categories, ","), d.Action, d.Excerpt, d.CreatedAt)
+	if err != nil {
+		return err
+	}
+	d.ID, err = result.LastInsertId()
+	return err
+}
+
+func (r *RepositoryImpl) List(before int64, limit int) ([]*Decision, error) {
+	query := `
+		SELECT id, user, conv_id, message_id, stage, source, categories, action, excerpt, created_at
+		FROM ModerationDecisions
+	`
+	args := []any{}
+	if before > 0 {
+		query += " WHERE id < ?"
+		args = append(args, before)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	decisions := []*Decision{}
+	for rows.Next() {
+		var d Decision
+		var categories string
+		var createdAt time.Time
+		if err := rows.Scan(&d.ID, &d.User, &d.ConversationID, &d.MessageID, &d.Stage, &d.Source, &categories, &d.Action, &d.Excerpt, &createdAt); err != nil {
+			return nil, err
+		}
+		d.Categories = []string{}
+		if categories != "" {
+			d.Categories = strings.Split(categories, ",")
+		}
+		d.CreatedAt = createdAt
+		decisions = append(decisions, &d)
+	}
+	return decisions, rows.Err()
+}
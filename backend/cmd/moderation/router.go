@@ -0,0 +1,70 @@
+package moderation
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+type DecisionsResponse struct {
+	Decisions []*Decision `json:"decisions"`
+	// NextCursor is passed as before to get the next page
+	NextCursor int64 `json:"nextCursor,omitempty"`
+}
+
+func Handler() http.Handler {
+	mux := openapi.NewRouter("/api/moderation", "Moderation")
+
+	mux.HandleFunc("GET /decisions", listDecisions, openapi.Op{
+		Summary:  "List the content flagged by moderation, newest first",
+		Response: DecisionsResponse{},
+		Query: []openapi.Param{
+			{Name: "limit", Description: "Decisions per page, at most 200"},
+			{Name: "before", Description: "Only decisions older than this cursor"},
+		},
+	})
+
+	return http.StripPrefix("/api/moderation", auth.Authenticated(auth.Admin(mux)))
+}
+
+func listDecisions(w http.ResponseWriter, r *http.Request) {
+	limit := defaultListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			utils.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxListLimit)
+	}
+	var before int64
+	if v := r.URL.Query().Get("before"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			utils.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		before = n
+	}
+
+	decisions, err := repo.List(before, limit)
+	if err != nil {
+		log.Error("Error listing moderation decisions", "err", err)
+		utils.Error(w, "Failed to list decisions", http.StatusInternalServerError)
+		return
+	}
+
+	response := DecisionsResponse{Decisions: decisions}
+	if len(decisions) == limit {
+		response.NextCursor = decisions[len(decisions)-1].ID
+	}
+	utils.RespondWithJSON(w, response, http.StatusOK)
+}
@@ -0,0 +1,278 @@
+// Package openapi generates the OpenAPI 3 description of the REST API from
+// the routes themselves. Routers register their handlers through a Router,
+// documenting each with the Go types it decodes and encodes, so the spec
+// served at /api/openapi.json follows the code as the API grows.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+	"github.com/Bajahaw/ai-ui/cmd/version"
+)
+
+// sessionCookie is the cookie /api/auth/login sets
+const sessionCookie = "auth_token"
+
+// Op documents one route.
+type Op struct {
+	Summary     string
+	Description string
+	// Request is a value of the JSON body type, e.g. Request{}
+	Request any
+	// Response is a value of the JSON response type
+	Response any
+	// Status is the success status, 200 by default
+	Status int
+	// ContentType describes a response that is not JSON, e.g. text/event-stream
+	ContentType string
+	// Upload names the multipart form field of an uploaded file
+	Upload string
+	// Form lists the fields of a url-encoded form body
+	Form  []Param
+	Query []Param
+	// Public routes need no session
+	Public bool
+}
+
+// Param is a query parameter, always a string.
+type Param struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+type oneOf []any
+
+// OneOf documents a response that takes one of several shapes, such as a
+// list that is paged on request.
+func OneOf(values ...any) any {
+	return oneOf(values)
+}
+
+type route struct {
+	tag string
+	op  Op
+}
+
+var (
+	mu     sync.RWMutex
+	routes = make(map[string]map[string]route) // path -> method -> route
+)
+
+// Router is a ServeMux that documents the routes registered on it. The
+// patterns are relative to prefix, the path the router is mounted at.
+type Router struct {
+	*http.ServeMux
+	prefix string
+	tag    string
+}
+
+// NewRouter returns a router mounted at prefix whose routes are grouped
+// under tag in the spec.
+func NewRouter(prefix string, tag string) *Router {
+	return &Router{ServeMux: http.NewServeMux(), prefix: prefix, tag: tag}
+}
+
+// HandleFunc registers handler for pattern, a "METHOD /path" ServeMux
+// pattern, and adds it to the spec.
+func (rt *Router) HandleFunc(pattern string, handler http.HandlerFunc, op Op) {
+	rt.Handle(pattern, handler, op)
+}
+
+func (rt *Router) Handle(pattern string, handler http.Handler, op Op) {
+	rt.ServeMux.Handle(pattern, handler)
+
+	method, path, ok := strings.Cut(strings.Join(strings.Fields(pattern), " "), " ")
+	if !ok {
+		panic("openapi: pattern without a method " + pattern)
+	}
+	Register(method, rt.prefix+path, rt.tag, op)
+}
+
+// Register adds a route served outside of a Router to the spec.
+func Register(method string, path string, tag string, op Op) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if routes[path] == nil {
+		routes[path] = make(map[string]route)
+	}
+	routes[path][strings.ToLower(method)] = route{tag: tag, op: op}
+}
+
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type string `json:"type"`
+	In   string `json:"in"`
+	Name string `json:"name"`
+}
+
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+var pathParam = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// Spec builds the document of every registered route.
+func Spec() *Document {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	components := make(schemas)
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: "AI UI", Version: version.AppVersion},
+		Paths:   make(map[string]map[string]Operation),
+		Components: Components{
+			Schemas: components,
+			SecuritySchemes: map[string]SecurityScheme{
+				"session": {Type: "apiKey", In: "cookie", Name: sessionCookie},
+			},
+		},
+	}
+	errorSchema := components.of(reflect.TypeFor[utils.ErrorResponse]())
+
+	for path, methods := range routes {
+		// {path...} wildcards are plain parameters in OpenAPI
+		specPath := pathParam.ReplaceAllString(path, "{$1}")
+		doc.Paths[specPath] = make(map[string]Operation)
+		for method, r := range methods {
+			doc.Paths[specPath][method] = operation(components, method, path, r, errorSchema)
+		}
+	}
+	return doc
+}
+
+func operation(components schemas, method string, path string, r route, errorSchema *Schema) Operation {
+	op := Operation{
+		Tags:        []string{r.tag},
+		Summary:     r.op.Summary,
+		Description: r.op.Description,
+		OperationID: operationID(method, path),
+		Security:    []map[string][]string{{"session": {}}},
+		Responses: map[string]Response{
+			"default": {
+				Description: "Error",
+				Content:     map[string]MediaType{"application/json": {Schema: errorSchema}},
+			},
+		},
+	}
+	if r.op.Public {
+		op.Security = []map[string][]string{}
+	}
+
+	for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"},
+		})
+	}
+	for _, p := range r.op.Query {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name: p.Name, In: "query", Description: p.Description, Required: p.Required, Schema: &Schema{Type: "string"},
+		})
+	}
+
+	switch {
+	case r.op.Upload != "":
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+			"multipart/form-data": {Schema: &Schema{Type: "object", Properties: map[string]*Schema{
+				r.op.Upload: {Type: "string", Format: "binary"},
+			}}},
+		}}
+	case len(r.op.Form) > 0:
+		form := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		for _, p := range r.op.Form {
+			form.Properties[p.Name] = &Schema{Type: "string"}
+		}
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+			"application/x-www-form-urlencoded": {Schema: form},
+		}}
+	case r.op.Request != nil:
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+			"application/json": {Schema: components.schemaOf(r.op.Request)},
+		}}
+	}
+
+	status := r.op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := Response{Description: http.StatusText(status)}
+	switch {
+	case r.op.ContentType != "":
+		success.Content = map[string]MediaType{r.op.ContentType: {Schema: &Schema{Type: "string"}}}
+	case r.op.Response != nil:
+		success.Content = map[string]MediaType{"application/json": {Schema: components.schemaOf(r.op.Response)}}
+	}
+	op.Responses[strconv.Itoa(status)] = success
+	return op
+}
+
+// operationID derives a stable name from the route, e.g.
+// "GET /api/conversations/{id}/messages" is getConversationsIdMessages.
+func operationID(method string, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for word := range strings.FieldsFuncSeq(strings.TrimPrefix(path, "/api"), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// Handler serves the spec.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, Spec(), http.StatusOK)
+}
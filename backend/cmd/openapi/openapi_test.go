@@ -0,0 +1,120 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Base struct {
+	ID string `json:"id"`
+}
+
+type Item struct {
+	Base
+	Name     string            `json:"name"`
+	Size     int64             `json:"size,string"`
+	Tags     []string          `json:"tags,omitempty"`
+	Parent   *Item             `json:"parent,omitempty"`
+	Labels   map[string]string `json:"labels"`
+	Created  time.Time         `json:"createdAt"`
+	Payload  json.RawMessage   `json:"payload"`
+	Secret   string            `json:"-"`
+	internal string
+}
+
+type ItemPage struct {
+	Items []*Item `json:"items"`
+}
+
+func resetRoutes(t *testing.T) {
+	mu.Lock()
+	saved := routes
+	routes = make(map[string]map[string]route)
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		routes = saved
+		mu.Unlock()
+	})
+}
+
+func TestSchema(t *testing.T) {
+	s := make(schemas)
+	ref := s.of(reflect.TypeFor[Item]())
+	if ref.Ref != "#/components/schemas/openapi.Item" {
+		t.Fatalf("expected a reference to the component, got %+v", ref)
+	}
+
+	item := s["openapi.Item"]
+	for name, want := range map[string]string{
+		"id":        "string",
+		"name":      "string",
+		"size":      "string",
+		"tags":      "array",
+		"labels":    "object",
+		"createdAt": "string",
+	} {
+		if p, ok := item.Properties[name]; !ok || p.Type != want {
+			t.Errorf("property %s: got %+v, want type %s", name, p, want)
+		}
+	}
+	if p := item.Properties["parent"]; p == nil || p.Ref != ref.Ref {
+		t.Errorf("expected the recursive field to refer to the component, got %+v", p)
+	}
+	for _, hidden := range []string{"Secret", "internal", "Base"} {
+		if _, ok := item.Properties[hidden]; ok {
+			t.Errorf("unexpected property %s", hidden)
+		}
+	}
+	if p := item.Properties["payload"]; p == nil || p.Type != "" {
+		t.Errorf("expected raw JSON to accept anything, got %+v", p)
+	}
+}
+
+func TestSpec(t *testing.T) {
+	resetRoutes(t)
+
+	mux := NewRouter("/api/items", "Items")
+	teapot := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) }
+	mux.HandleFunc("GET 	/", teapot, Op{Summary: "List items", Response: OneOf([]*Item{}, ItemPage{}), Query: []Param{{Name: "limit"}}})
+	mux.HandleFunc("PUT /{id}", teapot, Op{Summary: "Edit an item", Request: Item{}, Response: Item{}})
+	mux.HandleFunc("GET /files/{path...}", teapot, Op{ContentType: "application/octet-stream", Public: true})
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/x", nil))
+	if rr.Code != http.StatusTeapot {
+		t.Fatalf("expected the handler to be served, got %d", rr.Code)
+	}
+
+	doc := Spec()
+	list, ok := doc.Paths["/api/items/"]["get"]
+	if !ok {
+		t.Fatalf("missing list operation in %v", doc.Paths)
+	}
+	if list.OperationID != "getItems" || list.Tags[0] != "Items" || len(list.Parameters) != 1 {
+		t.Errorf("unexpected list operation %+v", list)
+	}
+	if s := list.Responses["200"].Content["application/json"].Schema; len(s.OneOf) != 2 {
+		t.Errorf("expected two response shapes, got %+v", s)
+	}
+
+	edit := doc.Paths["/api/items/{id}"]["put"]
+	if edit.OperationID != "putItemsId" || len(edit.Parameters) != 1 || edit.Parameters[0].In != "path" {
+		t.Errorf("unexpected edit operation %+v", edit)
+	}
+	if edit.RequestBody == nil || edit.RequestBody.Content["application/json"].Schema.Ref == "" {
+		t.Errorf("expected the request body to refer to Item, got %+v", edit.RequestBody)
+	}
+	if _, ok := doc.Components.Schemas["utils.ErrorResponse"]; !ok {
+		t.Error("expected the error response to be documented")
+	}
+
+	files := doc.Paths["/api/items/files/{path}"]["get"]
+	if len(files.Security) != 0 || files.Parameters[0].Name != "path" {
+		t.Errorf("unexpected public wildcard operation %+v", files)
+	}
+}
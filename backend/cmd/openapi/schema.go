@@ -0,0 +1,144 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of the OpenAPI 3 schema object the generator uses.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+var (
+	timeType = reflect.TypeFor[time.Time]()
+	rawType  = reflect.TypeFor[json.RawMessage]()
+)
+
+// schemas collects the named structs the spec refers to.
+type schemas map[string]*Schema
+
+// of returns the schema of t as encoding/json marshals it. Named structs
+// become components referenced by their qualified Go name, e.g.
+// chat.Request. No property is marked required, clients may omit any
+// field of a request and the server fills in its zero value.
+func (s schemas) of(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time", Nullable: nullable}
+	case rawType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean", Nullable: nullable}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32", Nullable: nullable}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64", Nullable: nullable}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Nullable: nullable}
+	case reflect.String:
+		return &Schema{Type: "string", Nullable: nullable}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte", Nullable: nullable}
+		}
+		return &Schema{Type: "array", Items: s.of(t.Elem()), Nullable: true}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.of(t.Elem()), Nullable: true}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name := componentName(t)
+		if _, ok := s[name]; !ok {
+			// reserve the name first, structs may refer to themselves
+			s[name] = &Schema{}
+			*s[name] = *s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	// interfaces and anything else can hold any value
+	return &Schema{}
+}
+
+// schemaOf returns the schema of the type of v, or of each value given to
+// OneOf.
+func (s schemas) schemaOf(v any) *Schema {
+	if values, ok := v.(oneOf); ok {
+		schema := &Schema{}
+		for _, value := range values {
+			schema.OneOf = append(schema.OneOf, s.of(reflect.TypeOf(value)))
+		}
+		return schema
+	}
+	return s.of(reflect.TypeOf(v))
+}
+
+func (s schemas) object(t reflect.Type) *Schema {
+	obj := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	s.fields(t, obj)
+	return obj
+}
+
+// fields adds the JSON properties of struct t to obj, promoting the fields
+// of embedded structs like encoding/json does.
+func (s schemas) fields(t reflect.Type, obj *Schema) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			s.fields(ft, obj)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		if strings.Contains(opts, "string") {
+			obj.Properties[name] = &Schema{Type: "string"}
+		} else {
+			obj.Properties[name] = s.of(f.Type)
+		}
+	}
+}
+
+func componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	pkg = pkg[strings.LastIndex(pkg, "/")+1:]
+	name := t.Name()
+	// generic instantiations carry their type arguments in the name
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	return pkg + "." + name
+}
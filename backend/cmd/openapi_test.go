@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	log = logger.New(os.Stdout)
+	routes()
+
+	doc := openapi.Spec()
+	if len(doc.Paths) < 50 {
+		t.Fatalf("expected every API route in the spec, got %d paths", len(doc.Paths))
+	}
+	for _, path := range []string{"/api/admin/request-logs", "/api/admin/request-logs/{id}"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("expected admin route %s in the spec", path)
+		}
+	}
+
+	ids := make(map[string]string)
+	for path, methods := range doc.Paths {
+		for method, op := range methods {
+			if op.Summary == "" {
+				t.Errorf("%s %s has no summary", method, path)
+			}
+			if other, ok := ids[op.OperationID]; ok {
+				t.Errorf("%s %s and %s share the operation ID %s", method, path, other, op.OperationID)
+			}
+			ids[op.OperationID] = method + " " + path
+		}
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range regexp.MustCompile(`"#/components/schemas/([^"]+)"`).FindAllSubmatch(body, -1) {
+		if _, ok := doc.Components.Schemas[string(ref[1])]; !ok {
+			t.Errorf("unresolved reference %s", ref[1])
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package providers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// AliasesRequest maps each alias to a model ID, e.g. "fast" to
+// "provider-x/gpt-4o-mini".
+type AliasesRequest struct {
+	Aliases map[string]string `json:"aliases"`
+}
+
+type AliasesResponse struct {
+	Aliases map[string]string `json:"aliases"`
+}
+
+// aliases contain no slash, so they never look like a model ID
+var aliasName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ResolveModel returns the model ID an alias of the user stands for, or
+// model itself when it is not an alias.
+func ResolveModel(model string, user string) string {
+	if model == "" || strings.Contains(model, "/") {
+		return model
+	}
+	aliases, err := providers.GetModelAliases(user)
+	if err != nil {
+		log.Error("Error querying model aliases", "err", err)
+		return model
+	}
+	if modelID, ok := aliases[model]; ok {
+		return modelID
+	}
+	return model
+}
+
+// withPreferences marks the user's favorite models and lists their aliases.
+func withPreferences(models []*Model, user string) {
+	favorites, err := providers.GetFavoriteModels(user)
+	if err != nil {
+		log.Error("Error querying favorite models", "err", err)
+	}
+	aliases, err := providers.GetModelAliases(user)
+	if err != nil {
+		log.Error("Error querying model aliases", "err", err)
+	}
+
+	for _, m := range models {
+		m.Favorite = slices.Contains(favorites, m.ID)
+		for alias, modelID := range aliases {
+			if modelID == m.ID {
+				m.Aliases = append(m.Aliases, alias)
+			}
+		}
+		slices.Sort(m.Aliases)
+	}
+}
+
+func setFavoriteModel(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	modelID := r.PathValue("id")
+
+	favorite := r.Method == http.MethodPut
+	if favorite && !providers.ModelExists(modelID, user) {
+		utils.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+	if err := providers.SetFavoriteModel(modelID, user, favorite); err != nil {
+		log.Error("Error saving favorite model", "err", err)
+		utils.Error(w, "Error saving favorite model", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getModelAliases(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	aliases, err := providers.GetModelAliases(user)
+	if err != nil {
+		log.Error("Error querying model aliases", "err", err)
+		utils.Error(w, "Error querying model aliases", http.StatusInternalServerError)
+		return
+	}
+	response := AliasesResponse{Aliases: aliases}
+	utils.RespondWithJSON(w, &response, http.StatusOK)
+}
+
+// saveModelAliases replaces all aliases of the user.
+func saveModelAliases(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req AliasesRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Aliases == nil {
+		req.Aliases = make(map[string]string)
+	}
+
+	for alias, modelID := range req.Aliases {
+		if !aliasName.MatchString(alias) {
+			utils.Error(w, fmt.Sprintf("Invalid alias %q, use letters, digits, '.', '_' and '-'", alias), http.StatusBadRequest)
+			return
+		}
+		if !providers.ModelExists(modelID, user) {
+			utils.Error(w, fmt.Sprintf("Model %q of alias %q not found", modelID, alias), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := providers.SaveModelAliases(user, req.Aliases); err != nil {
+		log.Error("Error saving model aliases", "err", err)
+		utils.Error(w, "Error saving model aliases", http.StatusInternalServerError)
+		return
+	}
+	response := AliasesResponse{Aliases: req.Aliases}
+	utils.RespondWithJSON(w, &response, http.StatusOK)
+}
@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func TestModelAliasesAndFavorites(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	SetupProviderClient(logger.New(os.Stdout), db)
+	if err := providers.Save(&Provider{ID: "p", BaseURL: "http://localhost", User: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	err := providers.SaveModels([]*Model{
+		{ID: "p/gpt-4o-mini", ProviderID: "p", Name: "gpt-4o-mini", IsEnabled: true},
+		{ID: "p/gpt-4o", ProviderID: "p", Name: "gpt-4o", IsEnabled: true},
+	}, "u")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(method string, target string, body string, handler http.HandlerFunc, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewReader([]byte(body)))
+		req.SetPathValue("id", id)
+		req = req.WithContext(context.WithValue(req.Context(), "user", "u"))
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	if rr := request(http.MethodPut, "/aliases", `{"aliases":{"fast":"p/gpt-4o-mini","mini":"p/gpt-4o-mini"}}`, saveModelAliases, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 saving aliases, got %d: %s", rr.Code, rr.Body.String())
+	}
+	for _, body := range []string{`{"aliases":{"a/b":"p/gpt-4o"}}`, `{"aliases":{"smart":"p/unknown"}}`} {
+		if rr := request(http.MethodPut, "/aliases", body, saveModelAliases, ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", body, rr.Code)
+		}
+	}
+
+	if got := ResolveModel("fast", "u"); got != "p/gpt-4o-mini" {
+		t.Errorf("expected alias to resolve, got %q", got)
+	}
+	if got := ResolveModel("p/gpt-4o", "u"); got != "p/gpt-4o" {
+		t.Errorf("expected model IDs unchanged, got %q", got)
+	}
+	if got := ResolveModel("fast", "someone-else"); got != "fast" {
+		t.Errorf("expected aliases to be per user, got %q", got)
+	}
+
+	if rr := request(http.MethodPut, "/p/gpt-4o/favorite", "", setFavoriteModel, "p/gpt-4o"); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 marking favorite, got %d", rr.Code)
+	}
+	if rr := request(http.MethodPut, "/p/unknown/favorite", "", setFavoriteModel, "p/unknown"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown model, got %d", rr.Code)
+	}
+
+	models := providers.GetAllModels("u")
+	withPreferences(models, "u")
+	for _, m := range models {
+		switch m.ID {
+		case "p/gpt-4o":
+			if !m.Favorite || len(m.Aliases) != 0 {
+				t.Errorf("expected favorite without aliases, got %+v", m)
+			}
+		case "p/gpt-4o-mini":
+			if m.Favorite || len(m.Aliases) != 2 || m.Aliases[0] != "fast" {
+				t.Errorf("expected sorted aliases, got %+v", m)
+			}
+		}
+	}
+
+	if rr := request(http.MethodDelete, "/p/gpt-4o/favorite", "", setFavoriteModel, "p/gpt-4o"); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 removing favorite, got %d", rr.Code)
+	}
+	if favorites, _ := providers.GetFavoriteModels("u"); len(favorites) != 0 {
+		t.Errorf("expected no favorites left, got %v", favorites)
+	}
+}
@@ -0,0 +1,39 @@
+package providers
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/Bajahaw/ai-ui/cmd/audit"
+)
+
+// auditView is what the audit log keeps of a provider: the names of its
+// headers but not their values, and the proxy without its password.
+func auditView(p *Provider) map[string]any {
+	if p == nil {
+		return nil
+	}
+	return map[string]any{
+		"base_url":      p.BaseURL,
+		"headers":       slices.Sorted(maps.Keys(p.Headers)),
+		"proxy":         displayProxy(p.Proxy),
+		"timeouts":      p.Timeouts,
+		"key_strategy":  p.KeyStrategy,
+		"shared":        p.Shared,
+		"allowed_users": p.AllowedUsers,
+	}
+}
+
+// recordUpdate logs the fields of a provider an update changed, before is
+// the provider as loaded ahead of it.
+func recordUpdate(r *http.Request, user string, before *Provider) {
+	if before == nil {
+		return
+	}
+	after, err := providers.GetByID(before.ID, user)
+	if err != nil {
+		return
+	}
+	audit.Record(r, user, audit.ProviderUpdate, before.ID, audit.Diff(auditView(before), auditView(after)))
+}
@@ -0,0 +1,301 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultProvidersFile is read when PROVIDERS_FILE is not set.
+const defaultProvidersFile = "./data/providers.yaml"
+
+// providerTypes are the base URLs of well known providers, so a declared
+// provider only needs its type and key.
+var providerTypes = map[string]string{
+	"openai":     "https://api.openai.com/v1",
+	"openrouter": "https://openrouter.ai/api/v1",
+	"groq":       "https://api.groq.com/openai/v1",
+	"mistral":    "https://api.mistral.ai/v1",
+	"deepseek":   "https://api.deepseek.com/v1",
+	"ollama":     "http://localhost:11434/v1",
+}
+
+// DeclaredProvider is a provider set up by the deployment instead of in the
+// UI. It is added to every user, or only to Users when set.
+type DeclaredProvider struct {
+	Name    string            `yaml:"name"`
+	Type    string            `yaml:"type"`
+	URL     string            `yaml:"url"`
+	APIKey  string            `yaml:"api_key"`
+	Headers map[string]string `yaml:"headers"`
+	Users   []string          `yaml:"users"`
+}
+
+type providersFile struct {
+	Providers []DeclaredProvider `yaml:"providers"`
+}
+
+var (
+	declaredMu sync.RWMutex
+	// declared come from the providers file and the environment,
+	// provisioned from Declare
+	declared    []DeclaredProvider
+	provisioned []DeclaredProvider
+)
+
+var envProvider = regexp.MustCompile(`^PROVIDER_([A-Z0-9_]+?)_(URL|TYPE|KEY|USERS)$`)
+
+var invalidIDChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// SetupDeclaredProviders reads the declared providers and syncs them into
+// every existing user. New users get them through SyncDeclaredProviders.
+func SetupDeclaredProviders() {
+	path := os.Getenv("PROVIDERS_FILE")
+	explicit := path != ""
+	if !explicit {
+		path = defaultProvidersFile
+	}
+	fromFile, err := readProvidersFile(path)
+	if err != nil && (explicit || !errors.Is(err, os.ErrNotExist)) {
+		log.Error("Error reading providers file", "path", path, "err", err)
+	}
+
+	list, err := resolveDeclared(append(fromFile, providersFromEnv(os.Environ())...))
+	if err != nil {
+		log.Error("Invalid declared providers, none are synced", "err", err)
+		return
+	}
+	declaredMu.Lock()
+	declared = list
+	declaredMu.Unlock()
+	if len(list) == 0 {
+		return
+	}
+
+	for _, user := range auth.Usernames() {
+		SyncDeclaredProviders(user)
+	}
+	log.Info("Declared providers synced", "providers", len(list))
+}
+
+// Declare replaces the providers declared by provisioning and syncs them
+// into every user. It returns what it changes, or with dryRun what it
+// would change.
+func Declare(list []DeclaredProvider, dryRun bool) ([]string, error) {
+	declaredMu.RLock()
+	fromEnv := declared
+	declaredMu.RUnlock()
+
+	resolved, err := resolveDeclared(list)
+	if err != nil {
+		return nil, err
+	}
+	// names must be unique across the providers file and provisioning
+	if _, err := resolveDeclared(append(slices.Clone(fromEnv), resolved...)); err != nil {
+		return nil, err
+	}
+
+	changes := make([]string, 0)
+	for _, user := range auth.Usernames() {
+		for _, d := range resolved {
+			if len(d.Users) > 0 && !slices.Contains(d.Users, user) {
+				continue
+			}
+			if change := declaredChange(d, user); change != "" {
+				changes = append(changes, fmt.Sprintf("%s provider %s of %s", change, d.Name, user))
+			}
+		}
+	}
+	if dryRun {
+		return changes, nil
+	}
+
+	declaredMu.Lock()
+	provisioned = resolved
+	declaredMu.Unlock()
+	for _, user := range auth.Usernames() {
+		for _, p := range syncDeclared(resolved, user) {
+			go refreshDeclaredModels(p)
+		}
+	}
+	return changes, nil
+}
+
+// SyncDeclaredProviders adds the declared providers to a user, or updates
+// the URL and key of the ones the user already has. Models of new ones are
+// fetched in the background.
+func SyncDeclaredProviders(user string) {
+	declaredMu.RLock()
+	list := append(slices.Clone(declared), provisioned...)
+	declaredMu.RUnlock()
+
+	for _, p := range syncDeclared(list, user) {
+		go refreshDeclaredModels(p)
+	}
+}
+
+func refreshDeclaredModels(p *Provider) {
+	models, err := fetchAllModels(context.Background(), p)
+	if err != nil {
+		return
+	}
+	if err := providers.SaveModels(models, p.User); err != nil {
+		log.Error("Error saving models for declared provider", "provider", p.ID, "err", err)
+	}
+}
+
+// syncDeclared saves the providers of list meant for user and returns the
+// ones it created.
+func syncDeclared(list []DeclaredProvider, user string) []*Provider {
+	created := make([]*Provider, 0)
+	for _, d := range list {
+		if len(d.Users) > 0 && !slices.Contains(d.Users, user) {
+			continue
+		}
+		id := declaredID(d.Name, user)
+		switch declaredChange(d, user) {
+		case "":
+			continue
+		case "update":
+			err := providers.UpdateConnection(id, user, d.URL, d.APIKey)
+			if err == nil {
+				err = providers.UpdateHeaders(id, user, d.Headers)
+			}
+			if err != nil {
+				log.Error("Error updating declared provider", "provider", id, "user", user, "err", err)
+				continue
+			}
+			forgetPool(id)
+			continue
+		}
+
+		p := &Provider{ID: id, BaseURL: d.URL, APIKey: d.APIKey, User: user, Headers: d.Headers}
+		if err := providers.Save(p); err != nil {
+			log.Error("Error saving declared provider", "provider", id, "user", user, "err", err)
+			continue
+		}
+		created = append(created, p)
+	}
+	return created
+}
+
+// declaredChange tells whether syncing d into user adds or updates a
+// provider, "" when the user has it as declared.
+func declaredChange(d DeclaredProvider, user string) string {
+	existing, err := providers.GetByID(declaredID(d.Name, user), user)
+	if err != nil {
+		return "add"
+	}
+	if existing.BaseURL == d.URL && existing.APIKey == d.APIKey && maps.Equal(existing.Headers, d.Headers) {
+		return ""
+	}
+	return "update"
+}
+
+// declaredID is the id of a declared provider for a user. It stays the same
+// across restarts, so the provider is updated instead of added again.
+func declaredID(name string, user string) string {
+	sum := sha256.Sum256([]byte(user))
+	return name + "-" + hex.EncodeToString(sum[:4])
+}
+
+func readProvidersFile(path string) ([]DeclaredProvider, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file providersFile
+	// ${VAR} references keep keys out of the file
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(body))), &file); err != nil {
+		return nil, err
+	}
+	return file.Providers, nil
+}
+
+// providersFromEnv reads PROVIDER_<NAME>_URL, _TYPE, _KEY and _USERS. A
+// provider needs a URL or a type.
+func providersFromEnv(environ []string) []DeclaredProvider {
+	byName := make(map[string]*DeclaredProvider)
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		m := envProvider.FindStringSubmatch(key)
+		if m == nil || value == "" {
+			continue
+		}
+		d, ok := byName[m[1]]
+		if !ok {
+			d = &DeclaredProvider{Name: strings.ToLower(m[1])}
+			byName[m[1]] = d
+		}
+		switch m[2] {
+		case "URL":
+			d.URL = value
+		case "TYPE":
+			d.Type = value
+		case "KEY":
+			d.APIKey = value
+		case "USERS":
+			d.Users = stngs.SplitList(value)
+		}
+	}
+
+	list := make([]DeclaredProvider, 0, len(byName))
+	for _, name := range slices.Sorted(maps.Keys(byName)) {
+		if d := byName[name]; d.URL != "" || d.Type != "" {
+			list = append(list, *d)
+		}
+	}
+	return list
+}
+
+// resolveDeclared fills in the URLs of typed providers and checks the list.
+func resolveDeclared(list []DeclaredProvider) ([]DeclaredProvider, error) {
+	seen := make(map[string]bool)
+	resolved := make([]DeclaredProvider, 0, len(list))
+	for _, d := range list {
+		d.Name = strings.Trim(invalidIDChars.ReplaceAllString(strings.ToLower(d.Name), "-"), "-")
+		if d.Name == "" {
+			d.Name = d.Type
+		}
+		if d.URL == "" {
+			url, ok := providerTypes[strings.ToLower(d.Type)]
+			if !ok {
+				return nil, fmt.Errorf("provider %q needs a url or one of the types %s",
+					d.Name, strings.Join(slices.Sorted(maps.Keys(providerTypes)), ", "))
+			}
+			d.URL = url
+		}
+		if d.Name == "" {
+			d.Name = utils.ExtractProviderName(d.URL)
+		}
+		if seen[d.Name] {
+			return nil, fmt.Errorf("provider %q is declared twice", d.Name)
+		}
+		seen[d.Name] = true
+		if err := utils.ValidateOutboundURL(d.URL); err != nil {
+			return nil, fmt.Errorf("provider %q: url %w", d.Name, err)
+		}
+		if err := validateHeaders(d.Headers); err != nil {
+			return nil, fmt.Errorf("provider %q: %w", d.Name, err)
+		}
+		if d.Headers == nil {
+			d.Headers = make(map[string]string)
+		}
+		resolved = append(resolved, d)
+	}
+	return resolved, nil
+}
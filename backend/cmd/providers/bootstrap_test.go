@@ -0,0 +1,127 @@
+package providers
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func TestProvidersFromEnv(t *testing.T) {
+	list := providersFromEnv([]string{
+		"PROVIDER_OPENAI_TYPE=openai",
+		"PROVIDER_OPENAI_KEY=sk-1",
+		"PROVIDER_LOCAL_LLM_URL=http://localhost:8080/v1",
+		"PROVIDER_LOCAL_LLM_USERS=alice, bob",
+		"PROVIDER_KEYONLY_KEY=sk-2",
+		"PROVIDER_CONNECT_TIMEOUT=30",
+	})
+	if len(list) != 2 {
+		t.Fatalf("expected 2 providers, got %+v", list)
+	}
+	if d := list[0]; d.Name != "local_llm" || d.URL != "http://localhost:8080/v1" || len(d.Users) != 2 || d.Users[1] != "bob" {
+		t.Errorf("unexpected local provider: %+v", d)
+	}
+	if d := list[1]; d.Name != "openai" || d.Type != "openai" || d.APIKey != "sk-1" {
+		t.Errorf("unexpected openai provider: %+v", d)
+	}
+}
+
+func TestResolveDeclared(t *testing.T) {
+	list, err := resolveDeclared([]DeclaredProvider{
+		{Type: "groq", APIKey: "k"},
+		{Name: "Local LLM", URL: "http://localhost:8080/v1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list[0].Name != "groq" || list[0].URL != "https://api.groq.com/openai/v1" {
+		t.Errorf("expected the groq URL from its type, got %+v", list[0])
+	}
+	if list[1].Name != "local-llm" {
+		t.Errorf("expected a cleaned up name, got %q", list[1].Name)
+	}
+
+	for name, bad := range map[string][]DeclaredProvider{
+		"unknown type": {{Name: "x", Type: "nope"}},
+		"duplicate":    {{Type: "openai"}, {Type: "openai"}},
+		"bad header":   {{Type: "openai", Headers: map[string]string{"Host": "x"}}},
+	} {
+		if _, err := resolveDeclared(bad); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestReadProvidersFile(t *testing.T) {
+	t.Setenv("TEST_OPENAI_KEY", "sk-from-env")
+	file := path.Join(t.TempDir(), "providers.yaml")
+	content := `providers:
+  - name: openai
+    type: openai
+    api_key: ${TEST_OPENAI_KEY}
+    headers:
+      OpenAI-Organization: org-1
+  - name: ollama
+    url: http://localhost:11434/v1
+    users: [alice]
+`
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	list, err := readProvidersFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].APIKey != "sk-from-env" || list[0].Headers["OpenAI-Organization"] != "org-1" {
+		t.Errorf("unexpected providers: %+v", list)
+	}
+	if list[1].Users[0] != "alice" {
+		t.Errorf("expected users of ollama, got %+v", list[1])
+	}
+}
+
+func TestSyncDeclared(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('alice', 'hash'), ('bob', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	SetupProviderClient(logger.New(os.Stdout), db)
+
+	list, err := resolveDeclared([]DeclaredProvider{
+		{Type: "openai", APIKey: "sk-1"},
+		{Name: "ollama", Type: "ollama", Users: []string{"alice"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created := syncDeclared(list, "alice"); len(created) != 2 {
+		t.Fatalf("expected 2 providers for alice, got %d", len(created))
+	}
+	if created := syncDeclared(list, "bob"); len(created) != 1 || created[0].ID == declaredID("openai", "alice") {
+		t.Fatalf("expected only openai with its own id for bob, got %+v", created)
+	}
+
+	list[0].APIKey = "sk-2"
+	if created := syncDeclared(list, "alice"); len(created) != 0 {
+		t.Errorf("expected existing providers to be updated, got %d new", len(created))
+	}
+	p, err := providers.GetByID(declaredID("openai", "alice"), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.APIKey != "sk-2" || p.BaseURL != "https://api.openai.com/v1" {
+		t.Errorf("expected the new key, got %+v", p)
+	}
+	if n := len(providers.GetAll("bob")); n != 1 {
+		t.Errorf("expected 1 provider for bob, got %d", n)
+	}
+}
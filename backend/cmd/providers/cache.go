@@ -0,0 +1,91 @@
+package providers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+)
+
+// cacheTTL is how long a cached completion is reused, zero disables the cache.
+func cacheTTL() time.Duration {
+	return config.Duration("completionCacheTTL")
+}
+
+// cacheable tells whether a request always gets the same answer, so it can
+// be served from the cache: temperature 0, no tools, and the user did not
+// turn the cache off.
+func cacheable(params RequestParams) bool {
+	if cacheTTL() == 0 || len(params.Tools) > 0 {
+		return false
+	}
+	if params.Temperature == nil || *params.Temperature != 0 {
+		return false
+	}
+	enabled, err := settings.Get("completionCache", params.User)
+	return err != nil || enabled != "false"
+}
+
+// cacheKey hashes everything that shapes the answer. Message text is
+// trimmed so whitespace-only differences still hit the cache.
+func cacheKey(params RequestParams) string {
+	type message struct {
+		Role    string   `json:"role"`
+		Content string   `json:"content"`
+		Images  []string `json:"images,omitempty"`
+		Files   []string `json:"files,omitempty"`
+		Tool    string   `json:"tool,omitempty"`
+		Output  string   `json:"output,omitempty"`
+	}
+	normalized := struct {
+		Model     string         `json:"model"`
+		Messages  []message      `json:"messages"`
+		Params    SamplingParams `json:"params"`
+		Reasoning string         `json:"reasoning,omitempty"`
+	}{
+		Model:     params.Model,
+		Params:    params.SamplingParams,
+		Reasoning: string(params.ReasoningEffort),
+	}
+	for _, m := range params.Messages {
+		normalized.Messages = append(normalized.Messages, message{
+			Role:    m.Role,
+			Content: strings.TrimSpace(m.Content),
+			Images:  m.Images,
+			Files:   m.Files,
+			Tool:    m.ToolCall.Name + m.ToolCall.Args,
+			Output:  m.ToolCall.Output,
+		})
+	}
+
+	data, _ := json.Marshal(normalized)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func cachedCompletion(params RequestParams) (string, *ChatCompletionMessage) {
+	key := cacheKey(params)
+	msg, err := providers.GetCachedCompletion(key, params.User)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Error("Error reading completion cache", "err", err)
+		}
+		return key, nil
+	}
+	log.Debug("Completion served from cache", "model", params.Model)
+	return key, msg
+}
+
+func cacheCompletion(key string, params RequestParams, msg *ChatCompletionMessage) {
+	if msg.Content == "" || len(msg.ToolCalls) > 0 {
+		return
+	}
+	if err := providers.SaveCachedCompletion(key, params.User, params.Model, msg, cacheTTL()); err != nil {
+		log.Error("Error writing completion cache", "err", err)
+	}
+}
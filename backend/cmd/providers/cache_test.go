@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"database/sql"
+	"errors"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
+
+func TestCacheKeyNormalization(t *testing.T) {
+	zero := 0.0
+	base := RequestParams{
+		Model:    "p/m",
+		Messages: []SimpleMessage{{Role: "user", Content: "hello"}},
+	}
+	base.Temperature = &zero
+
+	spaced := base
+	spaced.Messages = []SimpleMessage{{Role: "user", Content: "  hello\n"}}
+	if cacheKey(base) != cacheKey(spaced) {
+		t.Errorf("surrounding whitespace should not change the key")
+	}
+
+	other := base
+	other.Model = "p/other"
+	if cacheKey(base) == cacheKey(other) {
+		t.Errorf("model must be part of the key")
+	}
+
+	maxTokens := int64(10)
+	limited := base
+	limited.MaxTokens = &maxTokens
+	if cacheKey(base) == cacheKey(limited) {
+		t.Errorf("params must be part of the key")
+	}
+}
+
+func TestCachedCompletionExpiry(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewRepository(db)
+
+	msg := &ChatCompletionMessage{Content: "cached answer"}
+	if err := repo.SaveCachedCompletion("k1", "u", "p/m", msg, time.Hour); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	got, err := repo.GetCachedCompletion("k1", "u")
+	if err != nil || got.Content != "cached answer" {
+		t.Fatalf("got %v, %v", got, err)
+	}
+
+	if _, err := repo.GetCachedCompletion("k1", "someone-else"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("cache must be per user, got %v", err)
+	}
+
+	if err := repo.SaveCachedCompletion("k2", "u", "p/m", msg, -time.Second); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if _, err := repo.GetCachedCompletion("k2", "u"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expired entry was returned, err = %v", err)
+	}
+}
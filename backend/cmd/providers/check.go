@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"context"
+	"sync"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+)
+
+// Reachability is whether a provider answered a model list request, Err
+// is nil when it did.
+type Reachability struct {
+	ProviderID string
+	BaseURL    string
+	Err        error
+}
+
+// CheckReachable lists the models of every provider of every user, each
+// distinct URL and key once. It stops waiting when ctx is done.
+func CheckReachable(ctx context.Context) ([]Reachability, error) {
+	owners, err := providers.Owners()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var unique []*Provider
+	for _, user := range owners {
+		for _, p := range providers.GetAll(user) {
+			if key := p.BaseURL + "\x00" + p.APIKey; !seen[key] {
+				seen[key] = true
+				unique = append(unique, p)
+			}
+		}
+	}
+
+	results := make([]Reachability, len(unique))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, probeConcurrency)
+	for i, p := range unique {
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = Reachability{ProviderID: p.ID, BaseURL: p.BaseURL, Err: ping(ctx, p)}
+		})
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// ping lists the models of the provider without retries.
+func ping(ctx context.Context, provider *Provider) error {
+	client := openai.NewClient(append(ClientOptions(provider), option.WithMaxRetries(0))...)
+	_, err := client.Models.List(ctx)
+	return err
+}
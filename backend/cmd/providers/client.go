@@ -3,6 +3,7 @@ package providers
 import (
 	"database/sql"
 
+	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 
 	logger "github.com/charmbracelet/log"
@@ -10,6 +11,7 @@ import (
 
 var log *logger.Logger
 var providers Repository
+var settings stngs.Repository
 
 type Client interface {
 	SendChatCompletionRequest(params RequestParams) (*ChatCompletionMessage, error)
@@ -25,4 +27,5 @@ func NewClient() Client {
 func SetupProviderClient(l *logger.Logger, db *sql.DB) {
 	log = l
 	providers = NewRepository(db)
+	settings = stngs.NewRepository(db)
 }
@@ -0,0 +1,56 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/openai/openai-go/v3"
+)
+
+// providerError gives the error of a request to a provider its API code.
+func providerError(ctx context.Context, err error, t Timeouts) error {
+	err = timeoutError(ctx, err, t)
+	if apierr.CodeOf(err) != "" || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		return apierr.Wrap(statusErrorCode(apiErr.StatusCode, apiErr.Code, apiErr.Message), err)
+	}
+	// the provider could not be reached at all
+	return apierr.Wrap(apierr.ProviderUnavailable, err)
+}
+
+// statusErrorCode maps an error response of a provider to an API code.
+func statusErrorCode(status int, providerCode string, message string) apierr.Code {
+	switch {
+	case contextTooLong(providerCode, message):
+		return apierr.ContextTooLong
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return apierr.ProviderUnauthorized
+	case status == http.StatusTooManyRequests:
+		return apierr.ProviderRateLimited
+	case status >= 500:
+		return apierr.ProviderUnavailable
+	}
+	return apierr.ProviderError
+}
+
+// contextTooLong recognizes the context length errors of the common
+// providers, which only agree on the wording.
+func contextTooLong(providerCode string, message string) bool {
+	if providerCode == "context_length_exceeded" {
+		return true
+	}
+	message = strings.ToLower(message)
+	for _, hint := range []string{"context length", "context window", "maximum context", "prompt is too long", "too many tokens"} {
+		if strings.Contains(message, hint) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+)
+
+func TestStatusErrorCode(t *testing.T) {
+	tests := []struct {
+		status  int
+		code    string
+		message string
+		want    apierr.Code
+	}{
+		{400, "context_length_exceeded", "", apierr.ContextTooLong},
+		{400, "", "This model's maximum context length is 8192 tokens", apierr.ContextTooLong},
+		{413, "", "prompt is too long: 210000 tokens > 200000 maximum", apierr.ContextTooLong},
+		{401, "invalid_api_key", "Incorrect API key provided", apierr.ProviderUnauthorized},
+		{429, "", "Rate limit reached", apierr.ProviderRateLimited},
+		{503, "", "The server is overloaded", apierr.ProviderUnavailable},
+		{400, "", "Invalid value for temperature", apierr.ProviderError},
+	}
+	for _, tt := range tests {
+		if got := statusErrorCode(tt.status, tt.code, tt.message); got != tt.want {
+			t.Errorf("statusErrorCode(%d, %q, %q) = %q, want %q", tt.status, tt.code, tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestProviderError(t *testing.T) {
+	ctx := context.Background()
+
+	err := providerError(ctx, errors.New("dial tcp 127.0.0.1:1: connect: connection refused"), Timeouts{})
+	if apierr.CodeOf(err) != apierr.ProviderUnavailable {
+		t.Errorf("unreachable provider: code = %q", apierr.CodeOf(err))
+	}
+
+	if err := providerError(ctx, context.Canceled, Timeouts{}); apierr.CodeOf(err) != "" {
+		t.Errorf("cancelled requests are not errors of the provider, got %q", apierr.CodeOf(err))
+	}
+
+	timeoutCtx, cancel := context.WithCancelCause(ctx)
+	cancel(ErrTimeout)
+	if err := providerError(timeoutCtx, context.Canceled, Timeouts{}); apierr.CodeOf(err) != apierr.ProviderTimeout {
+		t.Errorf("timeout: code = %q", apierr.CodeOf(err))
+	}
+}
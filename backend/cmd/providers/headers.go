@@ -0,0 +1,78 @@
+package providers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+const maxHeaders = 20
+
+// headers the HTTP client manages itself, setting them breaks the request
+var reservedHeaders = []string{"Host", "Content-Length", "Content-Type", "Connection", "Transfer-Encoding", "Accept-Encoding"}
+
+type HeadersRequest struct {
+	Headers map[string]string `json:"headers"`
+}
+
+// validateHeaders checks the extra headers sent with every request to a
+// provider, e.g. a gateway's own auth or routing header.
+func validateHeaders(headers map[string]string) error {
+	if len(headers) > maxHeaders {
+		return fmt.Errorf("at most %d headers are allowed", maxHeaders)
+	}
+	for name, value := range headers {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("invalid value of header %q", name)
+		}
+		for _, reserved := range reservedHeaders {
+			if http.CanonicalHeaderKey(name) == reserved {
+				return fmt.Errorf("header %q cannot be overridden", name)
+			}
+		}
+	}
+	return nil
+}
+
+// updateProviderHeaders replaces the extra headers of a provider.
+func updateProviderHeaders(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	id := r.PathValue("id")
+
+	var req HeadersRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Headers == nil {
+		req.Headers = make(map[string]string)
+	}
+	if err := validateHeaders(req.Headers); err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before, _ := providers.GetByID(id, user)
+	err := providers.UpdateHeaders(id, user, req.Headers)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Provider not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error updating provider headers", "err", err)
+		utils.Error(w, "Error updating provider headers", http.StatusInternalServerError)
+		return
+	}
+	recordUpdate(r, user, before)
+
+	utils.RespondWithJSON(w, &req, http.StatusOK)
+}
@@ -0,0 +1,20 @@
+package providers
+
+import "testing"
+
+func TestValidateHeaders(t *testing.T) {
+	valid := map[string]string{"X-Gateway-Route": "eu", "Authorization": "Bearer gateway-token"}
+	if err := validateHeaders(valid); err != nil {
+		t.Errorf("expected %v to be valid, got %v", valid, err)
+	}
+	for _, headers := range []map[string]string{
+		{"Bad Header": "x"},
+		{"X-Route": "a\r\nInjected: yes"},
+		{"content-type": "text/plain"},
+		{"Host": "example.com"},
+	} {
+		if err := validateHeaders(headers); err == nil {
+			t.Errorf("expected %v to be rejected", headers)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package providers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/audit"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"github.com/openai/openai-go/v3/option"
+)
+
+// Key selection strategies of providers with more than one API key.
+const (
+	StrategyRoundRobin  = "round_robin"
+	StrategyLeastErrors = "least_errors"
+)
+
+var keyStrategies = []string{StrategyRoundRobin, StrategyLeastErrors}
+
+const (
+	rateLimitCooldown    = time.Minute
+	unauthorizedCooldown = 10 * time.Minute
+)
+
+// APIKey is an additional key of a provider. The key itself is never
+// returned to clients, only a masked hint and its runtime state.
+type APIKey struct {
+	ID            int64      `json:"id"`
+	ProviderID    string     `json:"provider_id"`
+	Key           string     `json:"-"`
+	Hint          string     `json:"hint"`
+	Errors        int        `json:"errors"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+	CreatedAt     string     `json:"created_at"`
+}
+
+type APIKeyRequest struct {
+	APIKey string `json:"api_key"`
+}
+
+type KeyStrategyRequest struct {
+	Strategy string `json:"strategy"`
+}
+
+type keyState struct {
+	errors        int
+	cooldownUntil time.Time
+}
+
+// keyPool spreads requests of one provider over its keys. State lives
+// in memory only, a restart gives every key a clean slate.
+type keyPool struct {
+	mu       sync.Mutex
+	keys     []string
+	strategy string
+	next     int
+	state    map[string]*keyState
+}
+
+var (
+	keyPools   = make(map[string]*keyPool)
+	keyPoolsMu sync.Mutex
+)
+
+// poolFor returns the pool of the provider, refreshed with its current keys.
+func poolFor(provider *Provider) *keyPool {
+	keyPoolsMu.Lock()
+	defer keyPoolsMu.Unlock()
+
+	pool, ok := keyPools[provider.ID]
+	if !ok {
+		pool = &keyPool{state: make(map[string]*keyState)}
+		keyPools[provider.ID] = pool
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.keys = provider.allKeys()
+	pool.strategy = provider.KeyStrategy
+	for key := range pool.state {
+		if !slices.Contains(pool.keys, key) {
+			delete(pool.state, key)
+		}
+	}
+	return pool
+}
+
+func forgetPool(providerID string) {
+	keyPoolsMu.Lock()
+	delete(keyPools, providerID)
+	keyPoolsMu.Unlock()
+}
+
+// pick returns the next usable key, skipping the ones in excluded.
+// When every key is cooling down the one that recovers first is used.
+func (p *keyPool) pick(excluded []string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var best, fallback string
+	var fallbackUntil time.Time
+	for i := range p.keys {
+		idx := (p.next + i) % len(p.keys)
+		key := p.keys[idx]
+		if slices.Contains(excluded, key) {
+			continue
+		}
+		st := p.stateOf(key)
+		if st.cooldownUntil.After(now) {
+			if fallback == "" || st.cooldownUntil.Before(fallbackUntil) {
+				fallback, fallbackUntil = key, st.cooldownUntil
+			}
+			continue
+		}
+		if best == "" {
+			best = key
+			if p.strategy != StrategyLeastErrors {
+				break
+			}
+		} else if st.errors < p.stateOf(best).errors {
+			best = key
+		}
+	}
+
+	if best == "" {
+		best = fallback
+	}
+	if best == "" {
+		return "", false
+	}
+	p.next = (slices.Index(p.keys, best) + 1) % len(p.keys)
+	return best, true
+}
+
+func (p *keyPool) report(key string, status int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st := p.stateOf(key)
+	switch status {
+	case http.StatusTooManyRequests:
+		st.errors++
+		st.cooldownUntil = time.Now().Add(rateLimitCooldown)
+	case http.StatusUnauthorized:
+		st.errors++
+		st.cooldownUntil = time.Now().Add(unauthorizedCooldown)
+	}
+}
+
+func (p *keyPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.keys)
+}
+
+func (p *keyPool) stateOf(key string) *keyState {
+	st, ok := p.state[key]
+	if !ok {
+		st = &keyState{}
+		p.state[key] = st
+	}
+	return st
+}
+
+// status copies the runtime state of each key into keys.
+func (p *keyPool) status(keys []*APIKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for _, k := range keys {
+		st, ok := p.state[k.Key]
+		if !ok {
+			continue
+		}
+		k.Errors = st.errors
+		if st.cooldownUntil.After(now) {
+			until := st.cooldownUntil
+			k.CooldownUntil = &until
+		}
+	}
+}
+
+// middleware sets the key of every attempt and moves on to another key
+// when the provider answers 429 or 401, before anything reaches the caller.
+func (p *keyPool) middleware(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+	var tried []string
+	for {
+		key, ok := p.pick(tried)
+		if !ok {
+			return next(req)
+		}
+		tried = append(tried, key)
+		req.Header.Set("Authorization", "Bearer "+key)
+
+		res, err := next(req)
+		if err != nil || (res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusUnauthorized) {
+			return res, err
+		}
+		p.report(key, res.StatusCode)
+		log.Warn("Provider rejected API key", "status", res.StatusCode, "key", maskKey(key))
+
+		if len(tried) >= p.size() || req.GetBody == nil {
+			return res, err
+		}
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return res, err
+		}
+		res.Body.Close()
+		req.Body = body
+	}
+}
+
+func (provider *Provider) allKeys() []string {
+	keys := make([]string, 0, len(provider.APIKeys)+1)
+	if provider.APIKey != "" {
+		keys = append(keys, provider.APIKey)
+	}
+	for _, k := range provider.APIKeys {
+		if !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:3] + "..." + key[len(key)-4:]
+}
+
+func getProviderKeys(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	provider, err := providers.GetByID(r.PathValue("id"), user)
+	if err != nil || provider.User != user {
+		utils.Error(w, "Provider not found", http.StatusNotFound)
+		return
+	}
+
+	keys, err := providers.GetKeys(provider.ID, user)
+	if err != nil {
+		log.Error("Error querying provider keys", "err", err)
+		utils.Error(w, "Error querying provider keys", http.StatusInternalServerError)
+		return
+	}
+	poolFor(provider).status(keys)
+
+	utils.RespondWithJSON(w, keys, http.StatusOK)
+}
+
+func addProviderKey(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req APIKeyRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil || strings.TrimSpace(req.APIKey) == "" {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	key := &APIKey{
+		ProviderID: r.PathValue("id"),
+		Key:        strings.TrimSpace(req.APIKey),
+	}
+	err := providers.AddKey(key, user)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Provider not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error saving provider key", "err", err)
+		utils.Error(w, "Error saving provider key", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, user, audit.ProviderKeyAdd, key.ProviderID, map[string]any{"keyId": key.ID, "hint": key.Hint})
+
+	utils.RespondWithJSON(w, key, http.StatusCreated)
+}
+
+func deleteProviderKey(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	id, err := strconv.ParseInt(r.PathValue("keyId"), 10, 64)
+	if err != nil {
+		utils.Error(w, "Invalid key id", http.StatusBadRequest)
+		return
+	}
+
+	err = providers.DeleteKey(id, r.PathValue("id"), user)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error deleting provider key", "err", err)
+		utils.Error(w, "Error deleting provider key", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, user, audit.ProviderKeyDelete, r.PathValue("id"), map[string]any{"keyId": id})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func updateKeyStrategy(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req KeyStrategyRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(keyStrategies, req.Strategy) {
+		utils.Error(w, "strategy must be one of "+strings.Join(keyStrategies, ", "), http.StatusBadRequest)
+		return
+	}
+
+	before, _ := providers.GetByID(r.PathValue("id"), user)
+	err := providers.UpdateKeyStrategy(r.PathValue("id"), user, req.Strategy)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Provider not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error updating key strategy", "err", err)
+		utils.Error(w, "Error updating key strategy", http.StatusInternalServerError)
+		return
+	}
+	recordUpdate(r, user, before)
+	w.WriteHeader(http.StatusNoContent)
+}
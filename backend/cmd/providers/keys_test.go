@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func newTestPool(strategy string, keys ...string) *keyPool {
+	return &keyPool{
+		keys:     keys,
+		strategy: strategy,
+		state:    make(map[string]*keyState),
+	}
+}
+
+func TestKeyPoolRoundRobin(t *testing.T) {
+	p := newTestPool(StrategyRoundRobin, "a", "b", "c")
+
+	var got []string
+	for range 4 {
+		key, _ := p.pick(nil)
+		got = append(got, key)
+	}
+	want := []string{"a", "b", "c", "a"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestKeyPoolSkipsCoolingKeys(t *testing.T) {
+	p := newTestPool(StrategyRoundRobin, "a", "b")
+	p.report("a", http.StatusTooManyRequests)
+
+	for range 3 {
+		if key, _ := p.pick(nil); key != "b" {
+			t.Fatalf("picked %q, want b", key)
+		}
+	}
+
+	// with every key cooling down the pool still returns one
+	p.report("b", http.StatusUnauthorized)
+	if key, ok := p.pick(nil); !ok || key != "a" {
+		t.Errorf("picked %q, want a which recovers first", key)
+	}
+}
+
+func TestKeyPoolLeastErrors(t *testing.T) {
+	p := newTestPool(StrategyLeastErrors, "a", "b", "c")
+	p.stateOf("a").errors = 3
+	p.stateOf("b").errors = 1
+	p.stateOf("c").errors = 2
+
+	if key, _ := p.pick(nil); key != "b" {
+		t.Errorf("picked %q, want b", key)
+	}
+}
+
+func TestKeyPoolMiddlewareRotatesOnRateLimit(t *testing.T) {
+	log = logger.New(os.Stderr)
+	p := newTestPool(StrategyRoundRobin, "a", "b")
+
+	var seen []string
+	next := func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		if string(body) != "payload" {
+			t.Errorf("attempt got body %q", body)
+		}
+		auth := req.Header.Get("Authorization")
+		seen = append(seen, auth)
+		status := http.StatusOK
+		if auth == "Bearer a" {
+			status = http.StatusTooManyRequests
+		}
+		return &http.Response{StatusCode: status, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://provider.test", bytes.NewReader([]byte("payload")))
+	res, err := p.middleware(req, next)
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("got %v %v, want 200", res, err)
+	}
+	if len(seen) != 2 || seen[0] != "Bearer a" || seen[1] != "Bearer b" {
+		t.Errorf("attempts = %v", seen)
+	}
+}
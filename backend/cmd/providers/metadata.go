@@ -0,0 +1,73 @@
+package providers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// ModelMetadata is the routing metadata OpenRouter, and gateways copying
+// its model list format, publish next to each model ID.
+type ModelMetadata struct {
+	ContextLength    *int64   `json:"context_length,omitempty"`
+	InputModalities  []string `json:"input_modalities,omitempty"`
+	OutputModalities []string `json:"output_modalities,omitempty"`
+}
+
+// openRouterModel is the part of an OpenRouter /models entry we keep.
+type openRouterModel struct {
+	ContextLength *int64 `json:"context_length"`
+	TopProvider   *struct {
+		ContextLength *int64 `json:"context_length"`
+	} `json:"top_provider"`
+	Architecture *struct {
+		InputModalities  []string `json:"input_modalities"`
+		OutputModalities []string `json:"output_modalities"`
+	} `json:"architecture"`
+	Pricing *struct {
+		Prompt     string `json:"prompt"`
+		Completion string `json:"completion"`
+	} `json:"pricing"`
+}
+
+// applyMetadata fills the capabilities, prices and context length of the
+// model from its raw list entry. Fields the provider did not send stay nil.
+func applyMetadata(m *Model, raw string) {
+	var info openRouterModel
+	if err := json.Unmarshal([]byte(raw), &info); err != nil {
+		return
+	}
+
+	m.ContextLength = info.ContextLength
+	if m.ContextLength == nil && info.TopProvider != nil {
+		m.ContextLength = info.TopProvider.ContextLength
+	}
+	if info.Architecture != nil {
+		m.InputModalities = info.Architecture.InputModalities
+		m.OutputModalities = info.Architecture.OutputModalities
+		vision := slices.Contains(m.InputModalities, "image")
+		m.SupportsVision = &vision
+	}
+	if info.Pricing != nil {
+		m.Pricing = Pricing{
+			PromptPrice:     perMillion(info.Pricing.Prompt),
+			CompletionPrice: perMillion(info.Pricing.Completion),
+		}
+	}
+}
+
+// modalities are stored comma separated, NULL when unknown.
+func joinModalities(values []string) any {
+	if len(values) == 0 {
+		return nil
+	}
+	return strings.Join(values, ",")
+}
+
+func splitModalities(value sql.NullString) []string {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	return strings.Split(value.String, ",")
+}
@@ -0,0 +1,40 @@
+package providers
+
+import "testing"
+
+func TestApplyMetadataOpenRouter(t *testing.T) {
+	raw := `{
+		"id": "openai/gpt-4o",
+		"context_length": 128000,
+		"architecture": {
+			"input_modalities": ["text", "image"],
+			"output_modalities": ["text"]
+		},
+		"pricing": {"prompt": "0.0000025", "completion": "0.00001"}
+	}`
+
+	var m Model
+	applyMetadata(&m, raw)
+
+	if m.ContextLength == nil || *m.ContextLength != 128000 {
+		t.Errorf("context length = %v", m.ContextLength)
+	}
+	if m.SupportsVision == nil || !*m.SupportsVision {
+		t.Errorf("expected vision support")
+	}
+	if len(m.OutputModalities) != 1 || m.OutputModalities[0] != "text" {
+		t.Errorf("output modalities = %v", m.OutputModalities)
+	}
+	if m.PromptPrice == nil || *m.PromptPrice != 2.5 || m.CompletionPrice == nil || *m.CompletionPrice != 10 {
+		t.Errorf("pricing = %+v", m.Pricing)
+	}
+}
+
+func TestApplyMetadataPlainList(t *testing.T) {
+	var m Model
+	applyMetadata(&m, `{"id": "gpt-4o", "object": "model", "owned_by": "openai"}`)
+
+	if m.SupportsVision != nil || m.ContextLength != nil || m.PromptPrice != nil {
+		t.Errorf("unknown metadata should stay nil, got %+v", m)
+	}
+}
@@ -0,0 +1,229 @@
+package providers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// ModelParams is a saved parameter preset for one model.
+type ModelParams struct {
+	ModelID         string   `json:"model_id"`
+	User            string   `json:"-"`
+	Temperature     *float64 `json:"temperature"`
+	TopP            *float64 `json:"top_p"`
+	MaxTokens       *int64   `json:"max_tokens"`
+	ReasoningEffort *string  `json:"reasoning_effort"`
+}
+
+type ModelParamsRequest struct {
+	Temperature     *float64 `json:"temperature"`
+	TopP            *float64 `json:"top_p"`
+	MaxTokens       *int64   `json:"max_tokens"`
+	ReasoningEffort *string  `json:"reasoning_effort"`
+}
+
+// SamplingParams are the optional generation parameters of a request.
+// Nil fields are not sent, so the provider defaults apply.
+type SamplingParams struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	MaxTokens        *int64   `json:"max_tokens,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	// Stop sequences end the response where the model would generate them
+	Stop []string `json:"stop,omitempty"`
+}
+
+const maxStopSequences = 4
+
+func (p *SamplingParams) Validate() error {
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > 2) {
+		return errors.New("temperature must be between 0 and 2")
+	}
+	if p.TopP != nil && (*p.TopP < 0 || *p.TopP > 1) {
+		return errors.New("top_p must be between 0 and 1")
+	}
+	if p.MaxTokens != nil && *p.MaxTokens < 1 {
+		return errors.New("max_tokens must be positive")
+	}
+	if p.FrequencyPenalty != nil && (*p.FrequencyPenalty < -2 || *p.FrequencyPenalty > 2) {
+		return errors.New("frequency_penalty must be between -2 and 2")
+	}
+	if p.PresencePenalty != nil && (*p.PresencePenalty < -2 || *p.PresencePenalty > 2) {
+		return errors.New("presence_penalty must be between -2 and 2")
+	}
+	if len(p.Stop) > maxStopSequences {
+		return fmt.Errorf("at most %d stop sequences are allowed", maxStopSequences)
+	}
+	if slices.Contains(p.Stop, "") {
+		return errors.New("stop sequences must not be empty")
+	}
+	return nil
+}
+
+var reasoningEfforts = []string{"disabled", "minimal", "low", "medium", "high"}
+
+func (p *ModelParamsRequest) validate() error {
+	sampling := SamplingParams{
+		Temperature: p.Temperature,
+		TopP:        p.TopP,
+		MaxTokens:   p.MaxTokens,
+	}
+	if err := sampling.Validate(); err != nil {
+		return err
+	}
+	if p.ReasoningEffort != nil && !slices.Contains(reasoningEfforts, *p.ReasoningEffort) {
+		return errors.New("invalid reasoning_effort")
+	}
+	return nil
+}
+
+// resolveSamplingParams fills the parameters that were not set by the
+// request, first from the model's saved profile and then from the user's
+// settings. A profile reasoning effort takes precedence over the user's
+// global reasoning setting.
+func resolveSamplingParams(params *RequestParams) {
+	profile, err := providers.GetModelParams(params.Model, params.User)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Error("Error loading model params", "model", params.Model, "err", err)
+	}
+	if profile != nil {
+		params.Temperature = firstSet(params.Temperature, profile.Temperature)
+		params.TopP = firstSet(params.TopP, profile.TopP)
+		params.MaxTokens = firstSet(params.MaxTokens, profile.MaxTokens)
+		if profile.ReasoningEffort != nil {
+			params.ReasoningEffort = ReasoningEffort(*profile.ReasoningEffort)
+		}
+	}
+
+	params.Temperature = firstSet(params.Temperature, floatSetting("temperature", params.User))
+	params.TopP = firstSet(params.TopP, floatSetting("topP", params.User))
+	params.FrequencyPenalty = firstSet(params.FrequencyPenalty, floatSetting("frequencyPenalty", params.User))
+	params.PresencePenalty = firstSet(params.PresencePenalty, floatSetting("presencePenalty", params.User))
+	if params.MaxTokens == nil {
+		if n := floatSetting("maxTokens", params.User); n != nil {
+			maxTokens := int64(*n)
+			params.MaxTokens = &maxTokens
+		}
+	}
+}
+
+func firstSet[T any](values ...*T) *T {
+	for _, v := range values {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func floatSetting(key string, user string) *float64 {
+	value, err := settings.Get(key, user)
+	if err != nil || value == "" {
+		return nil
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+func setSamplingParams(openAIparams *openai.ChatCompletionNewParams, params RequestParams) {
+	if params.Temperature != nil {
+		openAIparams.Temperature = openai.Float(*params.Temperature)
+	}
+	if params.TopP != nil {
+		openAIparams.TopP = openai.Float(*params.TopP)
+	}
+	if params.MaxTokens != nil {
+		openAIparams.MaxCompletionTokens = openai.Int(*params.MaxTokens)
+	}
+	if params.FrequencyPenalty != nil {
+		openAIparams.FrequencyPenalty = openai.Float(*params.FrequencyPenalty)
+	}
+	if params.PresencePenalty != nil {
+		openAIparams.PresencePenalty = openai.Float(*params.PresencePenalty)
+	}
+	if len(params.Stop) > 0 {
+		openAIparams.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: params.Stop}
+	}
+}
+
+func getModelParams(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	modelID := r.PathValue("id")
+
+	if !providers.ModelExists(modelID, user) {
+		utils.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+
+	params, err := providers.GetModelParams(modelID, user)
+	if errors.Is(err, sql.ErrNoRows) {
+		params = &ModelParams{ModelID: modelID}
+	} else if err != nil {
+		log.Error("Error querying model params", "err", err)
+		utils.Error(w, "Error querying model params", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, params, http.StatusOK)
+}
+
+func saveModelParams(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	modelID := r.PathValue("id")
+
+	var req ModelParamsRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !providers.ModelExists(modelID, user) {
+		utils.Error(w, "Model not found", http.StatusNotFound)
+		return
+	}
+
+	params := &ModelParams{
+		ModelID:         modelID,
+		User:            user,
+		Temperature:     req.Temperature,
+		TopP:            req.TopP,
+		MaxTokens:       req.MaxTokens,
+		ReasoningEffort: req.ReasoningEffort,
+	}
+	if err := providers.SaveModelParams(params); err != nil {
+		log.Error("Error saving model params", "err", err)
+		utils.Error(w, "Error saving model params", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, params, http.StatusOK)
+}
+
+func deleteModelParams(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	modelID := r.PathValue("id")
+
+	if err := providers.DeleteModelParams(modelID, user); err != nil {
+		log.Error("Error deleting model params", "err", err)
+		utils.Error(w, "Error deleting model params", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
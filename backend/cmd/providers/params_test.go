@@ -0,0 +1,28 @@
+package providers
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/openai/openai-go/v3"
+)
+
+func TestStopSequences(t *testing.T) {
+	params := SamplingParams{Stop: []string{"\n\n", "END"}}
+	if err := params.Validate(); err != nil {
+		t.Fatalf("expected valid stop sequences, got %v", err)
+	}
+
+	var openAIparams openai.ChatCompletionNewParams
+	setSamplingParams(&openAIparams, RequestParams{SamplingParams: params})
+	if !slices.Equal(openAIparams.Stop.OfStringArray, params.Stop) {
+		t.Errorf("expected stop sequences to be sent, got %v", openAIparams.Stop.OfStringArray)
+	}
+
+	for _, stop := range [][]string{{"a", "b", "c", "d", "e"}, {""}} {
+		p := SamplingParams{Stop: stop}
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected stop %q to be rejected", stop)
+		}
+	}
+}
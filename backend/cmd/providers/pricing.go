@@ -0,0 +1,80 @@
+package providers
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/Bajahaw/ai-ui/cmd/usage"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// Pricing holds model prices in USD per million tokens.
+type Pricing struct {
+	PromptPrice     *float64 `json:"prompt_price,omitempty"`
+	CompletionPrice *float64 `json:"completion_price,omitempty"`
+}
+
+// Cost returns the price of a completion, counting unknown prices as zero.
+func (p *Pricing) Cost(promptTokens, completionTokens int) float64 {
+	var cost float64
+	if p.PromptPrice != nil {
+		cost += float64(promptTokens) * *p.PromptPrice / 1e6
+	}
+	if p.CompletionPrice != nil {
+		cost += float64(completionTokens) * *p.CompletionPrice / 1e6
+	}
+	// round to a millionth of a dollar to avoid float noise in the UI
+	return math.Round(cost*1e6) / 1e6
+}
+
+func pricingFromNull(prompt, completion sql.NullFloat64) Pricing {
+	var p Pricing
+	if prompt.Valid {
+		p.PromptPrice = &prompt.Float64
+	}
+	if completion.Valid {
+		p.CompletionPrice = &completion.Float64
+	}
+	return p
+}
+
+func perMillion(perToken string) *float64 {
+	n, err := strconv.ParseFloat(perToken, 64)
+	if err != nil || n < 0 {
+		return nil
+	}
+	n = math.Round(n*1e6*1e6) / 1e6
+	return &n
+}
+
+// sendUsage streams the token usage of one completion, priced
+// with the model's saved prices when they are known, and records it.
+func sendUsage(sc utils.StreamClient, params RequestParams, stats utils.StreamStats) {
+	chunk := utils.StreamUsage{
+		Model:            params.Model,
+		PromptTokens:     stats.PromptTokens,
+		CompletionTokens: stats.CompletionTokens,
+		Cost:             UsageCost(params.Model, params.User, stats.PromptTokens, stats.CompletionTokens),
+	}
+	usage.Record(params.User, params.Model, stats.PromptTokens, stats.CompletionTokens, chunk.Cost)
+
+	utils.SendStreamChunk(sc, utils.StreamChunk{
+		Type:    utils.EVENT_USAGE,
+		Payload: chunk,
+	})
+}
+
+// UsageCost prices a completion, nil when the model has no prices.
+func UsageCost(model string, user string, promptTokens, completionTokens int) *float64 {
+	pricing, err := providers.GetPricing(model, user)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Error("Error loading model pricing", "model", model, "err", err)
+	}
+	if pricing == nil {
+		return nil
+	}
+	cost := pricing.Cost(promptTokens, completionTokens)
+	return &cost
+}
@@ -0,0 +1,148 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+)
+
+// Capabilities are the features a probe found a model to support, nil when
+// the probe could not tell, e.g. because the provider was unreachable.
+type Capabilities struct {
+	Tools     *bool
+	Vision    *bool
+	Reasoning *bool
+}
+
+const (
+	probeConcurrency = 4
+	probeTimeout     = 60 * time.Second
+)
+
+// probeImage is a solid red square, a model that really sees it names the
+// color, one that silently drops images can only guess.
+var probeImage = func() string {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for x := range 16 {
+		for y := range 16 {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img)
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}()
+
+// probeModels makes tiny test calls to each model to find out whether it
+// supports tool calls, images and reasoning, since many OpenAI compatible
+// gateways advertise features they do not have. The results are saved.
+func probeModels(provider *Provider, models []*Model) {
+	// an undecided capability is better than a refresh that hangs on retries
+	client := openai.NewClient(append(ClientOptions(provider), option.WithMaxRetries(0))...)
+
+	sem := make(chan struct{}, probeConcurrency)
+	var wg sync.WaitGroup
+	for _, m := range models {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			caps := probeModel(client, m.Name)
+			if err := providers.SaveCapabilities(m.ID, caps); err != nil {
+				log.Error("Error saving model capabilities", "model", m.ID, "err", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func probeModel(client openai.Client, model string) Capabilities {
+	var caps Capabilities
+
+	prompt := func(text string) []openai.ChatCompletionMessageParamUnion {
+		return []openai.ChatCompletionMessageParamUnion{openai.UserMessage(text)}
+	}
+
+	completion, err := probeCall(client, openai.ChatCompletionNewParams{
+		Model:    model,
+		Messages: prompt("Call the get_time tool."),
+		Tools: []openai.ChatCompletionToolUnionParam{
+			openai.ChatCompletionFunctionTool(openai.FunctionDefinitionParam{
+				Name:        "get_time",
+				Description: openai.String("Returns the current time"),
+				Parameters:  openai.FunctionParameters{"type": "object", "properties": map[string]any{}},
+			}),
+		},
+		ToolChoice:          openai.ChatCompletionToolChoiceOptionUnionParam{OfAuto: openai.String("required")},
+		MaxCompletionTokens: openai.Int(64),
+	})
+	caps.Tools = probeOutcome(err, func() bool {
+		return len(completion.Choices[0].Message.ToolCalls) > 0
+	})
+
+	completion, err = probeCall(client, openai.ChatCompletionNewParams{
+		Model: model,
+		Messages: OpenAIMessageParams([]SimpleMessage{{
+			Role:    "user",
+			Content: "What color is this image? Answer with one word.",
+			Images:  []string{probeImage},
+		}}),
+		MaxCompletionTokens: openai.Int(16),
+	})
+	caps.Vision = probeOutcome(err, func() bool {
+		return strings.Contains(strings.ToLower(completion.Choices[0].Message.Content), "red")
+	})
+
+	completion, err = probeCall(client, openai.ChatCompletionNewParams{
+		Model:               model,
+		Messages:            prompt("What is 17 * 23? Answer with the number only."),
+		ReasoningEffort:     openai.ReasoningEffortLow,
+		MaxCompletionTokens: openai.Int(512),
+	})
+	caps.Reasoning = probeOutcome(err, func() bool {
+		msg := completion.Choices[0].Message
+		return msg.Reasoning != "" || msg.ReasoningContent != "" || msg.ReasoningText != "" ||
+			completion.Usage.CompletionTokensDetails.ReasoningTokens > 0
+	})
+
+	return caps
+}
+
+func probeCall(client openai.Client, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	completion, err := client.Chat.Completions.New(ctx, params)
+	if err == nil && len(completion.Choices) == 0 {
+		err = errors.New("no choices in response")
+	}
+	return completion, err
+}
+
+// probeOutcome decides a capability from a probe call. A request the
+// provider rejects means the feature is missing, while network, rate limit
+// and server errors leave it undecided.
+func probeOutcome(err error, supported func() bool) *bool {
+	if err != nil {
+		var apiErr *openai.Error
+		if !errors.As(err, &apiErr) || apiErr.StatusCode >= 500 || apiErr.StatusCode == 429 ||
+			apiErr.StatusCode == 401 || apiErr.StatusCode == 403 {
+			return nil
+		}
+		rejected := false
+		return &rejected
+	}
+	ok := supported()
+	return &ok
+}
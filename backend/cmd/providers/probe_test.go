@@ -0,0 +1,139 @@
+package providers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+// fakeGateway answers like a gateway where "smart" supports everything,
+// "plain" rejects tools and ignores images and "broken" always fails.
+func fakeGateway(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model           string            `json:"model"`
+			Tools           []json.RawMessage `json:"tools"`
+			ReasoningEffort string            `json:"reasoning_effort"`
+			Messages        json.RawMessage   `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad probe request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+
+		if req.Model == "broken" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"message":"overloaded"}}`))
+			return
+		}
+		if len(req.Tools) > 0 && req.Model == "plain" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"tools are not supported"}}`))
+			return
+		}
+
+		message := map[string]any{"role": "assistant", "content": "blue"}
+		switch {
+		case len(req.Tools) > 0:
+			message["tool_calls"] = []map[string]any{{
+				"id": "call_1", "type": "function",
+				"function": map[string]any{"name": "get_time", "arguments": "{}"},
+			}}
+		case strings.Contains(string(req.Messages), "image_url"):
+			if req.Model == "smart" {
+				message["content"] = "Red."
+			}
+		case req.ReasoningEffort != "":
+			message["content"] = "391"
+			if req.Model == "smart" {
+				message["reasoning_content"] = "17 * 23 = 391"
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"id": "1", "object": "chat.completion", "model": req.Model,
+			"choices": []map[string]any{{"index": 0, "message": message, "finish_reason": "stop"}},
+		})
+	}))
+}
+
+func TestProbeModels(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	SetupProviderClient(logger.New(os.Stdout), db)
+
+	server := fakeGateway(t)
+	defer server.Close()
+
+	provider := &Provider{ID: "p", BaseURL: server.URL, User: "u"}
+	if err := providers.Save(provider); err != nil {
+		t.Fatal(err)
+	}
+	vision := true
+	models := []*Model{
+		{ID: "p/smart", ProviderID: "p", Name: "smart", IsEnabled: true},
+		{ID: "p/plain", ProviderID: "p", Name: "plain", IsEnabled: true, SupportsVision: &vision},
+		{ID: "p/broken", ProviderID: "p", Name: "broken", IsEnabled: true},
+	}
+	if err := providers.SaveModels(models, "u"); err != nil {
+		t.Fatal(err)
+	}
+
+	probeModels(provider, models)
+
+	got := make(map[string]*Model)
+	for _, m := range providers.GetModelsByProvider("p") {
+		got[m.ID] = m
+	}
+	check := func(model string, field string, value *bool, want *bool) {
+		t.Helper()
+		if (value == nil) != (want == nil) || (value != nil && *value != *want) {
+			t.Errorf("%s %s: got %v, want %v", model, field, fmtBool(value), fmtBool(want))
+		}
+	}
+	yes, no := true, false
+	check("smart", "tools", got["p/smart"].SupportsTools, &yes)
+	check("smart", "vision", got["p/smart"].SupportsVision, &yes)
+	check("smart", "reasoning", got["p/smart"].SupportsReasoning, &yes)
+	check("plain", "tools", got["p/plain"].SupportsTools, &no)
+	check("plain", "vision", got["p/plain"].SupportsVision, &no)
+	check("plain", "reasoning", got["p/plain"].SupportsReasoning, &no)
+	check("broken", "tools", got["p/broken"].SupportsTools, nil)
+	check("broken", "vision", got["p/broken"].SupportsVision, nil)
+
+	for _, m := range got {
+		if m.ProbedAt == nil {
+			t.Errorf("expected %s to be marked as probed", m.ID)
+		}
+	}
+
+	// a later refresh must not undo the probed vision result
+	if err := providers.SaveModels(models[1:2], "u"); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range providers.GetModelsByProvider("p") {
+		if m.ID == "p/plain" {
+			check("plain", "vision after refresh", m.SupportsVision, &no)
+		}
+	}
+}
+
+func fmtBool(b *bool) any {
+	if b == nil {
+		return "unknown"
+	}
+	return *b
+}
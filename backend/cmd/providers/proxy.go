@@ -0,0 +1,73 @@
+package providers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+type ProxyRequest struct {
+	// Proxy is an http, https, socks5 or socks5h URL, empty uses the
+	// proxy of the instance
+	Proxy string `json:"proxy"`
+}
+
+func validateProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	u, err := config.ParseProxy(proxy)
+	if err != nil {
+		return err
+	}
+	// a proxy of a user must not reach blocked networks either
+	return utils.ValidateOutboundURL("http://" + u.Host)
+}
+
+// displayProxy hides the password of a proxy URL in responses.
+func displayProxy(proxy string) string {
+	if proxy == "" {
+		return ""
+	}
+	u, err := config.ParseProxy(proxy)
+	if err != nil {
+		return ""
+	}
+	return u.Redacted()
+}
+
+// updateProviderProxy sets the proxy requests to a provider go through,
+// e.g. to reach it from behind a corporate proxy or in another region.
+func updateProviderProxy(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	id := r.PathValue("id")
+
+	var req ProxyRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validateProxy(req.Proxy); err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before, _ := providers.GetByID(id, user)
+	err := providers.UpdateProxy(id, user, req.Proxy)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Provider not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error updating provider proxy", "err", err)
+		utils.Error(w, "Error updating provider proxy", http.StatusInternalServerError)
+		return
+	}
+	recordUpdate(r, user, before)
+
+	utils.RespondWithJSON(w, &ProxyRequest{Proxy: displayProxy(req.Proxy)}, http.StatusOK)
+}
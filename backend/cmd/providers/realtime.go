@@ -0,0 +1,70 @@
+package providers
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"golang.org/x/net/websocket"
+)
+
+// realtimeURL turns the base URL of a provider, e.g. https://api.openai.com/v1,
+// into the websocket URL of its realtime API for the model.
+func realtimeURL(baseURL string, model string) (*url.URL, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/realtime"
+	q := u.Query()
+	q.Set("model", model)
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+// DialRealtime opens a websocket to the OpenAI compatible realtime API of
+// the model's provider. The API key stays on the server, the caller relays
+// events between the browser and the returned connection.
+func DialRealtime(model string, user string) (*websocket.Conn, error) {
+	providerID, name := utils.ExtractProviderID(model)
+	provider, err := providers.GetByID(providerID, user)
+	if err != nil {
+		return nil, apierr.New(apierr.NotFound, "Provider not found")
+	}
+
+	target, err := realtimeURL(provider.BaseURL, name)
+	if err != nil {
+		return nil, apierr.Wrap(apierr.BadRequest, err)
+	}
+	config, err := websocket.NewConfig(target.String(), provider.BaseURL)
+	if err != nil {
+		return nil, apierr.Wrap(apierr.BadRequest, err)
+	}
+
+	key := provider.APIKey
+	if len(provider.APIKeys) > 0 {
+		if picked, ok := poolFor(provider).pick(nil); ok {
+			key = picked
+		}
+	}
+	config.Header.Set("Authorization", "Bearer "+key)
+	for k, v := range provider.Headers {
+		config.Header.Set(k, v)
+	}
+	config.Dialer = utils.GuardDialer(&net.Dialer{Timeout: provider.Timeouts.connect()})
+
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, apierr.Wrap(apierr.ProviderUnavailable, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,69 @@
+package providers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// ModelUse is how often and how recently a user chatted with a model.
+type ModelUse struct {
+	ModelID    string    `json:"model_id"`
+	UseCount   int       `json:"use_count"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+type RecentModel struct {
+	*Model
+	UseCount   int       `json:"use_count"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+type RecentModelsResponse struct {
+	Models []*RecentModel `json:"models"`
+}
+
+const (
+	defaultRecentLimit = 10
+	maxRecentLimit     = 50
+)
+
+// RecordModelUse counts a chat with the model, so the quick-switcher can
+// offer the models the user actually uses first.
+func RecordModelUse(modelID string, user string) {
+	if err := providers.RecordModelUse(modelID, user); err != nil {
+		log.Error("Error recording model use", "model", modelID, "err", err)
+	}
+}
+
+// getRecentModels lists the user's models by last use, or by number of uses
+// with ?sort=frequent.
+func getRecentModels(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	limit, err := utils.QueryLimit(r, defaultRecentLimit, maxRecentLimit)
+	if err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	uses, err := providers.GetRecentModels(user, r.URL.Query().Get("sort") == "frequent", limit)
+	if err != nil {
+		log.Error("Error querying recent models", "err", err)
+		utils.Error(w, "Error querying recent models", http.StatusInternalServerError)
+		return
+	}
+
+	models := make(map[string]*Model)
+	for _, m := range providers.GetAllModels(user) {
+		models[m.ID] = m
+	}
+
+	response := RecentModelsResponse{Models: make([]*RecentModel, 0, len(uses))}
+	for _, u := range uses {
+		if m, ok := models[u.ModelID]; ok {
+			response.Models = append(response.Models, &RecentModel{Model: m, UseCount: u.UseCount, LastUsedAt: u.LastUsedAt})
+		}
+	}
+	utils.RespondWithJSON(w, &response, http.StatusOK)
+}
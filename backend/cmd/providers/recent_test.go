@@ -0,0 +1,62 @@
+package providers
+
+import (
+	"path"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
+
+func TestRecentModels(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewRepository(db)
+	if err := repo.Save(&Provider{ID: "p", BaseURL: "http://localhost", User: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	err := repo.SaveModels([]*Model{
+		{ID: "p/a", ProviderID: "p", Name: "a", IsEnabled: true},
+		{ID: "p/b", ProviderID: "p", Name: "b", IsEnabled: true},
+		{ID: "p/off", ProviderID: "p", Name: "off", IsEnabled: false},
+	}, "u")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"p/a", "p/a", "p/a", "p/off", "p/gone", "p/b"} {
+		if err := repo.RecordModelUse(id, "u"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(uses []*ModelUse) []string {
+		var ids []string
+		for _, u := range uses {
+			ids = append(ids, u.ModelID)
+		}
+		return ids
+	}
+
+	recent, err := repo.GetRecentModels("u", false, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// disabled and removed models are left out
+	if got := ids(recent); len(got) != 2 || got[0] != "p/b" || got[1] != "p/a" {
+		t.Errorf("expected most recent first, got %v", got)
+	}
+
+	frequent, err := repo.GetRecentModels("u", true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frequent) != 1 || frequent[0].ModelID != "p/a" || frequent[0].UseCount != 3 {
+		t.Errorf("expected p/a used 3 times, got %+v", frequent)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/Bajahaw/ai-ui/cmd/data"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 )
 
@@ -18,17 +20,66 @@ type Provider struct {
 	APIKey  string            `json:"api_key"`
 	User    string            `json:"-"`
 	Headers map[string]string `json:"headers"`
+	Timeouts
+	// APIKeys are the additional keys, loaded by GetByID only
+	APIKeys     []string `json:"-"`
+	KeyStrategy string   `json:"key_strategy"`
+	// Proxy overrides the outbound proxy of the instance
+	Proxy string `json:"proxy"`
+	// Shared providers of an admin can be used by every user, or only the
+	// AllowedUsers when there are any. Only the owner can change them.
+	Shared       bool     `json:"shared"`
+	AllowedUsers []string `json:"allowed_users"`
 }
 
+// usableBy matches the providers p a user can send requests to: their own
+// and the shared ones they are allowed on. It takes the user twice.
+const usableBy = `(p.user = ? OR (p.shared = 1 AND (
+	NOT EXISTS (SELECT 1 FROM ProviderUsers pu WHERE pu.provider_id = p.id)
+	OR EXISTS (SELECT 1 FROM ProviderUsers pu WHERE pu.provider_id = p.id AND pu.user = ?))))`
+
 type Repository interface {
 	GetAll(user string) []*Provider
+	// Owners lists the users with providers
+	Owners() ([]string, error)
+	// GetAll and GetByID include the shared providers the user is allowed on
 	GetByID(id string, user string) (*Provider, error)
 	Save(provider *Provider) error
+	// SetSharing shares a provider of owner with the users, or with every
+	// user when there are none, or stops sharing it
+	SetSharing(id string, owner string, shared bool, users []string) error
 	DeleteByID(id string, user string) error
+	UpdateTimeouts(id string, user string, timeouts Timeouts) error
+	UpdateHeaders(id string, user string, headers map[string]string) error
+	UpdateKeyStrategy(id string, user string, strategy string) error
+	UpdateProxy(id string, user string, proxy string) error
+	UpdateConnection(id string, user string, baseURL string, apiKey string) error
+	GetKeys(providerID string, user string) ([]*APIKey, error)
+	AddKey(key *APIKey, user string) error
+	DeleteKey(id int64, providerID string, user string) error
 	SaveModels(models []*Model, user string) error
 	GetAllModels(user string) []*Model
 	GetModelsByProvider(providerID string) []*Model
 	DeleteModelsNotIn(providerID string, modelIDs []string) error
+	SaveCapabilities(modelID string, caps Capabilities) error
+	ModelExists(modelID string, user string) bool
+	SupportsVision(modelID string, user string) bool
+	GetPricing(modelID string, user string) (*Pricing, error)
+	GetModelParams(modelID string, user string) (*ModelParams, error)
+	SaveModelParams(params *ModelParams) error
+	DeleteModelParams(modelID string, user string) error
+	GetFavoriteModels(user string) ([]string, error)
+	SetFavoriteModel(modelID string, user string, favorite bool) error
+	GetModelAliases(user string) (map[string]string, error)
+	SaveModelAliases(user string, aliases map[string]string) error
+	RecordModelUse(modelID string, user string) error
+	GetRecentModels(user string, byCount bool, limit int) ([]*ModelUse, error)
+	GetCachedCompletion(key string, user string) (*ChatCompletionMessage, error)
+	SaveCachedCompletion(key string, user string, model string, msg *ChatCompletionMessage, ttl time.Duration) error
+	SaveRequestLog(entry *RequestLog, cutoff time.Time, maxEntries int) error
+	ListRequestLogs(user string, providerID string, before int64, limit int) ([]*RequestLog, error)
+	GetRequestLog(id int64) (*RequestLog, error)
+	DeleteRequestLogs() error
 }
 
 type Repo struct {
@@ -45,8 +96,9 @@ func NewRepository(db *sql.DB) Repository {
 
 func (repo *Repo) GetAll(user string) []*Provider {
 	var allProviders = make([]*Provider, 0)
-	query := `SELECT id, url, api_key, headers_json FROM Providers WHERE user = ?`
-	rows, err := repo.db.Query(query, user)
+	query := `SELECT p.id, p.url, p.api_key, p.user, p.headers_json, p.connect_timeout, p.read_timeout, p.total_timeout, p.key_strategy, p.proxy, p.shared
+		FROM Providers p WHERE ` + usableBy
+	rows, err := repo.db.Query(query, user, user)
 	if err != nil {
 		log.Error("Error querying providers", "err", err)
 		return allProviders
@@ -55,7 +107,7 @@ func (repo *Repo) GetAll(user string) []*Provider {
 	for rows.Next() {
 		var p Provider
 		var headersJson string
-		if err = rows.Scan(&p.ID, &p.BaseURL, &p.APIKey, &headersJson); err != nil {
+		if err = rows.Scan(&p.ID, &p.BaseURL, &p.APIKey, &p.User, &headersJson, &p.ConnectTimeout, &p.ReadTimeout, &p.TotalTimeout, &p.KeyStrategy, &p.Proxy, &p.Shared); err != nil {
 			log.Error("Error scanning provider", "err", err)
 			continue
 		}
@@ -67,25 +119,56 @@ func (repo *Repo) GetAll(user string) []*Provider {
 			headers = make(map[string]string)
 		}
 		allProviders = append(allProviders, &Provider{
-			ID:      p.ID,
-			BaseURL: p.BaseURL,
-			APIKey:  p.APIKey,
-			User:    user,
-			Headers: headers,
+			ID:          p.ID,
+			BaseURL:     p.BaseURL,
+			APIKey:      p.APIKey,
+			User:        p.User,
+			Headers:     headers,
+			Timeouts:    p.Timeouts,
+			KeyStrategy: p.KeyStrategy,
+			Proxy:       p.Proxy,
+			Shared:      p.Shared,
 		})
 	}
 	if err = rows.Err(); err != nil {
 		log.Error("Error iterating over provider rows", "err", err)
 	}
+	rows.Close()
+
+	for _, p := range allProviders {
+		if p.Shared && p.User == user {
+			if p.AllowedUsers, err = repo.allowedUsers(p.ID); err != nil {
+				log.Error("Error querying provider users", "provider", p.ID, "err", err)
+			}
+		}
+	}
 
 	return allProviders
 }
 
+func (repo *Repo) Owners() ([]string, error) {
+	rows, err := repo.db.Query(`SELECT DISTINCT user FROM Providers ORDER BY user`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := make([]string, 0)
+	for rows.Next() {
+		var user string
+		if err := rows.Scan(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
 func (repo *Repo) GetByID(id string, user string) (*Provider, error) {
 	var p Provider
 	var headersJson string
-	query := `SELECT id, url, api_key, headers_json FROM Providers WHERE id = ? AND user = ?`
-	err := repo.db.QueryRow(query, id, user).Scan(&p.ID, &p.BaseURL, &p.APIKey, &headersJson)
+	query := `SELECT p.id, p.url, p.api_key, p.user, p.headers_json, p.connect_timeout, p.read_timeout, p.total_timeout, p.key_strategy, p.proxy, p.shared
+		FROM Providers p WHERE p.id = ? AND ` + usableBy
+	err := repo.db.QueryRow(query, id, user, user).Scan(&p.ID, &p.BaseURL, &p.APIKey, &p.User, &headersJson, &p.ConnectTimeout, &p.ReadTimeout, &p.TotalTimeout, &p.KeyStrategy, &p.Proxy, &p.Shared)
 	if err != nil {
 		return nil, err
 	}
@@ -98,15 +181,81 @@ func (repo *Repo) GetByID(id string, user string) (*Provider, error) {
 		headers = make(map[string]string)
 	}
 
+	// the keys of a shared provider are those of its owner
+	keys, err := repo.GetKeys(p.ID, p.User)
+	if err != nil {
+		return nil, err
+	}
+	var allowed []string
+	if p.Shared && p.User == user {
+		if allowed, err = repo.allowedUsers(p.ID); err != nil {
+			return nil, err
+		}
+	}
+	apiKeys := make([]string, 0, len(keys))
+	for _, k := range keys {
+		apiKeys = append(apiKeys, k.Key)
+	}
+
 	return &Provider{
-		ID:      p.ID,
-		BaseURL: p.BaseURL,
-		APIKey:  p.APIKey,
-		User:    user,
-		Headers: headers,
+		ID:           p.ID,
+		BaseURL:      p.BaseURL,
+		APIKey:       p.APIKey,
+		User:         p.User,
+		Headers:      headers,
+		Timeouts:     p.Timeouts,
+		APIKeys:      apiKeys,
+		KeyStrategy:  p.KeyStrategy,
+		Proxy:        p.Proxy,
+		Shared:       p.Shared,
+		AllowedUsers: allowed,
 	}, nil
 }
 
+func (repo *Repo) allowedUsers(providerID string) ([]string, error) {
+	rows, err := repo.db.Query(`SELECT user FROM ProviderUsers WHERE provider_id = ? ORDER BY user`, providerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := make([]string, 0)
+	for rows.Next() {
+		var user string
+		if err := rows.Scan(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (repo *Repo) SetSharing(id string, owner string, shared bool, users []string) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE Providers SET shared = ? WHERE id = ? AND user = ?`, shared, id, owner)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec(`DELETE FROM ProviderUsers WHERE provider_id = ?`, id); err != nil {
+		return err
+	}
+	if shared {
+		for _, user := range users {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO ProviderUsers (provider_id, user) VALUES (?, ?)`, id, user); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
 func (repo *Repo) Save(provider *Provider) error {
 	if provider.Headers == nil {
 		provider.Headers = make(map[string]string)
@@ -114,11 +263,133 @@ func (repo *Repo) Save(provider *Provider) error {
 	headersBytes, _ := json.Marshal(provider.Headers)
 	headersJson := string(headersBytes)
 
-	query := `INSERT INTO Providers (id, url, api_key, user, headers_json) VALUES (?, ?, ?, ?, ?)`
-	_, err := repo.db.Exec(query, provider.ID, provider.BaseURL, provider.APIKey, provider.User, headersJson)
+	if provider.KeyStrategy == "" {
+		provider.KeyStrategy = StrategyRoundRobin
+	}
+
+	query := `INSERT INTO Providers (id, url, api_key, user, headers_json, connect_timeout, read_timeout, total_timeout, key_strategy, proxy) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := repo.db.Exec(query, provider.ID, provider.BaseURL, provider.APIKey, provider.User, headersJson,
+		provider.ConnectTimeout, provider.ReadTimeout, provider.TotalTimeout, provider.KeyStrategy, provider.Proxy)
 	return err
 }
 
+func (repo *Repo) UpdateTimeouts(id string, user string, timeouts Timeouts) error {
+	query := `UPDATE Providers SET connect_timeout = ?, read_timeout = ?, total_timeout = ? WHERE id = ? AND user = ?`
+	result, err := repo.db.Exec(query, timeouts.ConnectTimeout, timeouts.ReadTimeout, timeouts.TotalTimeout, id, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (repo *Repo) UpdateHeaders(id string, user string, headers map[string]string) error {
+	headersBytes, _ := json.Marshal(headers)
+	query := `UPDATE Providers SET headers_json = ? WHERE id = ? AND user = ?`
+	result, err := repo.db.Exec(query, string(headersBytes), id, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (repo *Repo) UpdateConnection(id string, user string, baseURL string, apiKey string) error {
+	query := `UPDATE Providers SET url = ?, api_key = ? WHERE id = ? AND user = ?`
+	result, err := repo.db.Exec(query, baseURL, apiKey, id, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (repo *Repo) UpdateProxy(id string, user string, proxy string) error {
+	query := `UPDATE Providers SET proxy = ? WHERE id = ? AND user = ?`
+	result, err := repo.db.Exec(query, proxy, id, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (repo *Repo) UpdateKeyStrategy(id string, user string, strategy string) error {
+	query := `UPDATE Providers SET key_strategy = ? WHERE id = ? AND user = ?`
+	result, err := repo.db.Exec(query, strategy, id, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (repo *Repo) GetKeys(providerID string, user string) ([]*APIKey, error) {
+	query := `
+		SELECT k.id, k.provider_id, k.api_key, k.created_at
+		FROM ProviderKeys k
+		JOIN Providers p ON k.provider_id = p.id
+		WHERE k.provider_id = ? AND p.user = ?
+		ORDER BY k.id
+	`
+	rows, err := repo.db.Query(query, providerID, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]*APIKey, 0)
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(&k.ID, &k.ProviderID, &k.Key, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		k.Hint = maskKey(k.Key)
+		keys = append(keys, &k)
+	}
+	return keys, rows.Err()
+}
+
+func (repo *Repo) AddKey(key *APIKey, user string) error {
+	query := `
+		INSERT INTO ProviderKeys (provider_id, api_key)
+		SELECT id, ? FROM Providers WHERE id = ? AND user = ?
+		RETURNING id, created_at
+	`
+	err := repo.db.QueryRow(query, key.Key, key.ProviderID, user).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return err
+	}
+	key.Hint = maskKey(key.Key)
+	return nil
+}
+
+func (repo *Repo) DeleteKey(id int64, providerID string, user string) error {
+	query := `
+		DELETE FROM ProviderKeys
+		WHERE id = ? AND provider_id = ?
+		AND provider_id IN (SELECT id FROM Providers WHERE user = ?)
+	`
+	result, err := repo.db.Exec(query, id, providerID, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 func (repo *Repo) DeleteByID(id string, user string) error {
 	query := `DELETE FROM Providers WHERE id = ? AND user = ?`
 	_, err := repo.db.Exec(query, id, user)
@@ -142,8 +413,9 @@ func (repo *Repo) SaveModels(models []*Model, user string) error {
 
 	providerIDsMap := make(map[string]struct{})
 	var upsertSQL strings.Builder
-	upsertSQL.WriteString("INSERT INTO Models (id, provider_id, name, is_enabled) VALUES ")
-	upsertArgs := make([]any, 0, len(models)*4)
+	upsertSQL.WriteString("INSERT INTO Models (id, provider_id, name, is_enabled, supports_vision, prompt_price, completion_price, " +
+		"context_length, input_modalities, output_modalities) VALUES ")
+	upsertArgs := make([]any, 0, len(models)*10)
 
 	for i, m := range models {
 		if m.ProviderID == "" {
@@ -154,8 +426,9 @@ func (repo *Repo) SaveModels(models []*Model, user string) error {
 		if i > 0 {
 			upsertSQL.WriteString(",")
 		}
-		upsertSQL.WriteString("(?, ?, ?, ?)")
-		upsertArgs = append(upsertArgs, m.ID, m.ProviderID, m.Name, m.IsEnabled)
+		upsertSQL.WriteString("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		upsertArgs = append(upsertArgs, m.ID, m.ProviderID, m.Name, m.IsEnabled, m.SupportsVision, m.PromptPrice, m.CompletionPrice,
+			m.ContextLength, joinModalities(m.InputModalities), joinModalities(m.OutputModalities))
 	}
 
 	// Validate all distinct provider IDs in one DB call.
@@ -176,7 +449,17 @@ func (repo *Repo) SaveModels(models []*Model, user string) error {
 	}
 
 	// on conflict, update only when provider_id matches to prevent cross-provider overwrites.
-	upsertSQL.WriteString(" ON CONFLICT(id) DO UPDATE SET is_enabled=excluded.is_enabled WHERE Models.provider_id=excluded.provider_id")
+	// known capabilities and prices are kept when the update does not carry them,
+	// and probed capabilities win over the ones the provider advertises.
+	upsertSQL.WriteString(" ON CONFLICT(id) DO UPDATE SET is_enabled=excluded.is_enabled, " +
+		"supports_vision=CASE WHEN Models.probed_at IS NULL " +
+		"THEN COALESCE(excluded.supports_vision, Models.supports_vision) ELSE Models.supports_vision END, " +
+		"prompt_price=COALESCE(excluded.prompt_price, Models.prompt_price), " +
+		"completion_price=COALESCE(excluded.completion_price, Models.completion_price), " +
+		"context_length=COALESCE(excluded.context_length, Models.context_length), " +
+		"input_modalities=COALESCE(excluded.input_modalities, Models.input_modalities), " +
+		"output_modalities=COALESCE(excluded.output_modalities, Models.output_modalities) " +
+		"WHERE Models.provider_id=excluded.provider_id")
 
 	_, err = tx.Exec(upsertSQL.String(), upsertArgs...)
 	if err != nil {
@@ -186,32 +469,66 @@ func (repo *Repo) SaveModels(models []*Model, user string) error {
 	return tx.Commit()
 }
 
+const modelColumns = `m.id, m.provider_id, m.name, m.is_enabled, m.supports_vision,
+	m.prompt_price, m.completion_price, m.context_length, m.input_modalities, m.output_modalities,
+	m.supports_tools, m.supports_reasoning, m.probed_at`
+
+func scanModel(rows *sql.Rows) (*Model, error) {
+	var m Model
+	var vision sql.NullBool
+	var promptPrice, completionPrice sql.NullFloat64
+	var contextLength sql.NullInt64
+	var input, output sql.NullString
+	var tools, reasoning sql.NullBool
+	var probedAt sql.NullTime
+	err := rows.Scan(&m.ID, &m.ProviderID, &m.Name, &m.IsEnabled, &vision,
+		&promptPrice, &completionPrice, &contextLength, &input, &output,
+		&tools, &reasoning, &probedAt)
+	if err != nil {
+		return nil, err
+	}
+	if vision.Valid {
+		m.SupportsVision = &vision.Bool
+	}
+	if tools.Valid {
+		m.SupportsTools = &tools.Bool
+	}
+	if reasoning.Valid {
+		m.SupportsReasoning = &reasoning.Bool
+	}
+	if probedAt.Valid {
+		m.ProbedAt = &probedAt.Time
+	}
+	if contextLength.Valid {
+		m.ContextLength = &contextLength.Int64
+	}
+	m.Pricing = pricingFromNull(promptPrice, completionPrice)
+	m.InputModalities = splitModalities(input)
+	m.OutputModalities = splitModalities(output)
+	return &m, nil
+}
+
 func (repo *Repo) GetAllModels(user string) []*Model {
 	var models = make([]*Model, 0)
 	query := `
-		SELECT m.id, m.provider_id, m.name, m.is_enabled 
+		SELECT ` + modelColumns + `
 		FROM Models m
 		JOIN Providers p ON m.provider_id = p.id
-		WHERE p.user = ?
+		WHERE ` + usableBy + `
 	`
-	rows, err := repo.db.Query(query, user)
+	rows, err := repo.db.Query(query, user, user)
 	if err != nil {
 		log.Error("Error querying models", "err", err)
 		return models
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var m Model
-		if err = rows.Scan(&m.ID, &m.ProviderID, &m.Name, &m.IsEnabled); err != nil {
+		m, err := scanModel(rows)
+		if err != nil {
 			log.Error("Error scanning model", "err", err)
 			continue
 		}
-		models = append(models, &Model{
-			ID:         m.ID,
-			Name:       m.Name,
-			ProviderID: m.ProviderID,
-			IsEnabled:  m.IsEnabled,
-		})
+		models = append(models, m)
 	}
 	if err = rows.Err(); err != nil {
 		log.Error("Error iterating over model rows", "err", err)
@@ -222,7 +539,7 @@ func (repo *Repo) GetAllModels(user string) []*Model {
 
 func (repo *Repo) GetModelsByProvider(providerID string) []*Model {
 	var models = make([]*Model, 0)
-	query := `SELECT id, provider_id, name, is_enabled FROM Models WHERE provider_id = ?`
+	query := `SELECT ` + modelColumns + ` FROM Models m WHERE m.provider_id = ?`
 	rows, err := repo.db.Query(query, providerID)
 	if err != nil {
 		log.Error("Error querying models by provider", "err", err)
@@ -230,17 +547,12 @@ func (repo *Repo) GetModelsByProvider(providerID string) []*Model {
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var m Model
-		if err = rows.Scan(&m.ID, &m.ProviderID, &m.Name, &m.IsEnabled); err != nil {
+		m, err := scanModel(rows)
+		if err != nil {
 			log.Error("Error scanning model", "err", err)
 			continue
 		}
-		models = append(models, &Model{
-			ID:         m.ID,
-			Name:       m.Name,
-			ProviderID: m.ProviderID,
-			IsEnabled:  m.IsEnabled,
-		})
+		models = append(models, m)
 	}
 	if err = rows.Err(); err != nil {
 		log.Error("Error iterating over model rows by provider", "err", err)
@@ -271,3 +583,340 @@ func (repo *Repo) DeleteModelsNotIn(providerID string, modelIDs []string) error
 	_, err := repo.db.Exec(sb.String(), args...)
 	return err
 }
+
+// SaveCapabilities stores the probed capabilities of a model, the ones the
+// probe could not decide keep their value.
+func (repo *Repo) SaveCapabilities(modelID string, caps Capabilities) error {
+	query := `
+		UPDATE Models SET
+			supports_tools = COALESCE(?, supports_tools),
+			supports_vision = COALESCE(?, supports_vision),
+			supports_reasoning = COALESCE(?, supports_reasoning),
+			probed_at = ?
+		WHERE id = ?
+	`
+	_, err := data.Exec(repo.db, query, caps.Tools, caps.Vision, caps.Reasoning, time.Now().UTC(), modelID)
+	return err
+}
+
+func (repo *Repo) ModelExists(modelID string, user string) bool {
+	query := `
+		SELECT COUNT(1)
+		FROM Models m
+		JOIN Providers p ON m.provider_id = p.id
+		WHERE m.id = ? AND ` + usableBy + `
+	`
+	var count int
+	if err := repo.db.QueryRow(query, modelID, user, user).Scan(&count); err != nil {
+		log.Error("Error checking model", "err", err)
+		return false
+	}
+	return count > 0
+}
+
+func (repo *Repo) GetFavoriteModels(user string) ([]string, error) {
+	rows, err := data.Query(repo.db, `SELECT model_id FROM ModelFavorites WHERE user = ? ORDER BY model_id`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	favorites := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		favorites = append(favorites, id)
+	}
+	return favorites, rows.Err()
+}
+
+func (repo *Repo) SetFavoriteModel(modelID string, user string, favorite bool) error {
+	query := `INSERT INTO ModelFavorites (model_id, user) VALUES (?, ?) ON CONFLICT DO NOTHING`
+	if !favorite {
+		query = `DELETE FROM ModelFavorites WHERE model_id = ? AND user = ?`
+	}
+	_, err := data.Exec(repo.db, query, modelID, user)
+	return err
+}
+
+// GetModelAliases maps each alias of the user to its model ID.
+func (repo *Repo) GetModelAliases(user string) (map[string]string, error) {
+	rows, err := data.Query(repo.db, `SELECT alias, model_id FROM ModelAliases WHERE user = ?`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := make(map[string]string)
+	for rows.Next() {
+		var alias, modelID string
+		if err := rows.Scan(&alias, &modelID); err != nil {
+			return nil, err
+		}
+		aliases[alias] = modelID
+	}
+	return aliases, rows.Err()
+}
+
+// SaveModelAliases replaces all aliases of the user.
+func (repo *Repo) SaveModelAliases(user string, aliases map[string]string) error {
+	tx, err := repo.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.Exec(`DELETE FROM ModelAliases WHERE user = ?`, user); err != nil {
+		return err
+	}
+	for alias, modelID := range aliases {
+		if _, err := tx.Exec(`INSERT INTO ModelAliases (alias, user, model_id) VALUES (?, ?, ?)`, alias, user, modelID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (repo *Repo) RecordModelUse(modelID string, user string) error {
+	query := `
+		INSERT INTO ModelUsage (user, model_id, use_count, last_used_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT (user, model_id) DO UPDATE SET use_count = use_count + 1, last_used_at = excluded.last_used_at
+	`
+	_, err := data.Exec(repo.db, query, user, modelID, time.Now().UTC())
+	return err
+}
+
+// GetRecentModels returns the used models that still exist and are enabled,
+// most recently used first, or most used first when byCount is set.
+func (repo *Repo) GetRecentModels(user string, byCount bool, limit int) ([]*ModelUse, error) {
+	order := "u.last_used_at DESC"
+	if byCount {
+		order = "u.use_count DESC, u.last_used_at DESC"
+	}
+	query := `
+		SELECT u.model_id, u.use_count, u.last_used_at
+		FROM ModelUsage u
+		JOIN Models m ON m.id = u.model_id
+		JOIN Providers p ON m.provider_id = p.id
+		WHERE u.user = ? AND p.user = u.user AND m.is_enabled = 1
+		ORDER BY ` + order + `
+		LIMIT ?
+	`
+	rows, err := data.Query(repo.db, query, user, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uses := make([]*ModelUse, 0)
+	for rows.Next() {
+		var u ModelUse
+		if err := rows.Scan(&u.ModelID, &u.UseCount, &u.LastUsedAt); err != nil {
+			return nil, err
+		}
+		uses = append(uses, &u)
+	}
+	return uses, rows.Err()
+}
+
+// SupportsVision reports whether the model accepts image input.
+// Models the provider gave no modalities for are assumed to.
+func (repo *Repo) SupportsVision(modelID string, user string) bool {
+	query := `
+		SELECT m.supports_vision
+		FROM Models m
+		JOIN Providers p ON m.provider_id = p.id
+		WHERE m.id = ? AND ` + usableBy + `
+	`
+	var vision sql.NullBool
+	if err := data.QueryRow(repo.db, query, modelID, user, user).Scan(&vision); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Error("Error checking model vision support", "err", err)
+		}
+		return true
+	}
+	return !vision.Valid || vision.Bool
+}
+
+// GetPricing returns the saved prices of the model,
+// or nil when neither price is known.
+func (repo *Repo) GetPricing(modelID string, user string) (*Pricing, error) {
+	query := `
+		SELECT m.prompt_price, m.completion_price
+		FROM Models m
+		JOIN Providers p ON m.provider_id = p.id
+		WHERE m.id = ? AND ` + usableBy + `
+	`
+	var promptPrice, completionPrice sql.NullFloat64
+	if err := data.QueryRow(repo.db, query, modelID, user, user).Scan(&promptPrice, &completionPrice); err != nil {
+		return nil, err
+	}
+	if !promptPrice.Valid && !completionPrice.Valid {
+		return nil, nil
+	}
+	pricing := pricingFromNull(promptPrice, completionPrice)
+	return &pricing, nil
+}
+
+func (repo *Repo) GetModelParams(modelID string, user string) (*ModelParams, error) {
+	params := ModelParams{ModelID: modelID, User: user}
+	var temperature, topP sql.NullFloat64
+	var maxTokens sql.NullInt64
+	var reasoningEffort sql.NullString
+
+	query := `SELECT temperature, top_p, max_tokens, reasoning_effort FROM ModelParams WHERE model_id = ? AND user = ?`
+	err := repo.db.QueryRow(query, modelID, user).Scan(&temperature, &topP, &maxTokens, &reasoningEffort)
+	if err != nil {
+		return nil, err
+	}
+
+	if temperature.Valid {
+		params.Temperature = &temperature.Float64
+	}
+	if topP.Valid {
+		params.TopP = &topP.Float64
+	}
+	if maxTokens.Valid {
+		params.MaxTokens = &maxTokens.Int64
+	}
+	if reasoningEffort.Valid {
+		params.ReasoningEffort = &reasoningEffort.String
+	}
+	return &params, nil
+}
+
+func (repo *Repo) SaveModelParams(params *ModelParams) error {
+	query := `
+		INSERT INTO ModelParams (model_id, user, temperature, top_p, max_tokens, reasoning_effort)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(model_id, user) DO UPDATE SET
+			temperature = excluded.temperature,
+			top_p = excluded.top_p,
+			max_tokens = excluded.max_tokens,
+			reasoning_effort = excluded.reasoning_effort
+	`
+	_, err := repo.db.Exec(query,
+		params.ModelID,
+		params.User,
+		params.Temperature,
+		params.TopP,
+		params.MaxTokens,
+		params.ReasoningEffort,
+	)
+	return err
+}
+
+func (repo *Repo) DeleteModelParams(modelID string, user string) error {
+	_, err := repo.db.Exec(`DELETE FROM ModelParams WHERE model_id = ? AND user = ?`, modelID, user)
+	return err
+}
+
+func (repo *Repo) GetCachedCompletion(key string, user string) (*ChatCompletionMessage, error) {
+	var msg ChatCompletionMessage
+	query := `SELECT content, reasoning FROM Cache WHERE key = ? AND user = ? AND expires_at > ?`
+	err := repo.db.QueryRow(query, key, user, time.Now().UTC()).Scan(&msg.Content, &msg.Reasoning)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// SaveCachedCompletion stores the answer and drops expired entries of the user.
+func (repo *Repo) SaveCachedCompletion(key string, user string, model string, msg *ChatCompletionMessage, ttl time.Duration) error {
+	now := time.Now().UTC()
+	if _, err := repo.db.Exec(`DELETE FROM Cache WHERE user = ? AND expires_at <= ?`, user, now); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO Cache (key, user, model, content, reasoning, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(key, user) DO UPDATE SET
+			content = excluded.content,
+			reasoning = excluded.reasoning,
+			created_at = CURRENT_TIMESTAMP,
+			expires_at = excluded.expires_at
+	`
+	_, err := repo.db.Exec(query, key, user, model, msg.Content, msg.Reasoning, now.Add(ttl))
+	return err
+}
+
+// SaveRequestLog stores the log and drops the logs older than cutoff and
+// beyond the newest maxEntries.
+func (repo *Repo) SaveRequestLog(entry *RequestLog, cutoff time.Time, maxEntries int) error {
+	headers, _ := json.Marshal(entry.RequestHeaders)
+	result, err := repo.db.Exec(`
+		INSERT INTO RequestLogs (user, provider_id, method, url, status, request_headers, request_body, response_body, error, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, entry.User, entry.ProviderID, entry.Method, entry.URL, entry.Status, string(headers),
+		entry.RequestBody, entry.ResponseBody, entry.Error, entry.DurationMs, entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+	entry.ID, _ = result.LastInsertId()
+
+	_, err = repo.db.Exec(`
+		DELETE FROM RequestLogs
+		WHERE created_at < ? OR id <= (SELECT id FROM RequestLogs ORDER BY id DESC LIMIT 1 OFFSET ?)
+	`, cutoff, maxEntries)
+	return err
+}
+
+func (repo *Repo) ListRequestLogs(user string, providerID string, before int64, limit int) ([]*RequestLog, error) {
+	query := `SELECT id, user, provider_id, method, url, status, error, duration_ms, created_at FROM RequestLogs WHERE 1 = 1`
+	var args []any
+	if user != "" {
+		query += ` AND user = ?`
+		args = append(args, user)
+	}
+	if providerID != "" {
+		query += ` AND provider_id = ?`
+		args = append(args, providerID)
+	}
+	if before > 0 {
+		query += ` AND id < ?`
+		args = append(args, before)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := repo.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []*RequestLog{}
+	for rows.Next() {
+		var entry RequestLog
+		if err := rows.Scan(&entry.ID, &entry.User, &entry.ProviderID, &entry.Method, &entry.URL, &entry.Status, &entry.Error, &entry.DurationMs, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		logs = append(logs, &entry)
+	}
+	return logs, rows.Err()
+}
+
+func (repo *Repo) GetRequestLog(id int64) (*RequestLog, error) {
+	var entry RequestLog
+	var headers string
+	err := repo.db.QueryRow(`
+		SELECT id, user, provider_id, method, url, status, request_headers, request_body, response_body, error, duration_ms, created_at
+		FROM RequestLogs WHERE id = ?
+	`, id).Scan(&entry.ID, &entry.User, &entry.ProviderID, &entry.Method, &entry.URL, &entry.Status, &headers,
+		&entry.RequestBody, &entry.ResponseBody, &entry.Error, &entry.DurationMs, &entry.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(headers), &entry.RequestHeaders)
+	return &entry, nil
+}
+
+func (repo *Repo) DeleteRequestLogs() error {
+	_, err := repo.db.Exec(`DELETE FROM RequestLogs`)
+	return err
+}
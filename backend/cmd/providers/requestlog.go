@@ -0,0 +1,199 @@
+package providers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+
+	"github.com/openai/openai-go/v3/option"
+)
+
+// maxLoggedBody bounds each logged request and response body.
+const maxLoggedBody = 256 << 10
+
+const scrubbed = "[scrubbed]"
+
+// RequestLog is a raw request to a provider and its response, kept for
+// debugging while requestLogRetention is set. Credentials are scrubbed.
+type RequestLog struct {
+	ID             int64             `json:"id"`
+	User           string            `json:"user"`
+	ProviderID     string            `json:"providerId"`
+	Method         string            `json:"method"`
+	URL            string            `json:"url"`
+	Status         int               `json:"status"`
+	RequestHeaders map[string]string `json:"requestHeaders,omitempty"`
+	RequestBody    string            `json:"requestBody,omitempty"`
+	ResponseBody   string            `json:"responseBody,omitempty"`
+	Error          string            `json:"error,omitempty"`
+	DurationMs     int64             `json:"durationMs"`
+	CreatedAt      time.Time         `json:"createdAt"`
+}
+
+// dataURL matches inlined files, which are logged without their content.
+var dataURL = regexp.MustCompile(`data:([\w/+.-]+);base64,[A-Za-z0-9+/=]+`)
+
+// requestLogger records the requests of a provider's client.
+type requestLogger struct {
+	provider *Provider
+}
+
+func (l requestLogger) middleware(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+	if config.Duration("requestLogRetention") <= 0 {
+		return next(req)
+	}
+
+	entry := &RequestLog{
+		User:           l.provider.User,
+		ProviderID:     l.provider.ID,
+		Method:         req.Method,
+		URL:            l.url(req.URL),
+		RequestHeaders: l.headers(req.Header),
+		CreatedAt:      time.Now().UTC(),
+	}
+	if body := requestBody(req); body != nil {
+		entry.RequestBody = l.scrub(body)
+	}
+
+	start := time.Now()
+	res, err := next(req)
+	if err != nil {
+		entry.Error = err.Error()
+		entry.DurationMs = time.Since(start).Milliseconds()
+		saveRequestLog(entry)
+		return res, err
+	}
+	entry.Status = res.StatusCode
+	// streamed responses are complete once the SDK closes them
+	res.Body = &loggedBody{ReadCloser: res.Body, entry: entry, start: start, scrub: l.scrub}
+	return res, nil
+}
+
+// headers returns the request headers with credentials scrubbed.
+func (l requestLogger) headers(h http.Header) map[string]string {
+	headers := make(map[string]string, len(h))
+	for name, values := range h {
+		value := strings.Join(values, ", ")
+		if credential(name) {
+			value = scrubbed
+		}
+		headers[name] = l.scrub([]byte(value))
+	}
+	return headers
+}
+
+// url returns the request URL with credentials scrubbed, gateways may take
+// the key as a query parameter.
+func (l requestLogger) url(u *url.URL) string {
+	masked := *u
+	params := strings.Split(u.RawQuery, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil && credential(unescaped) {
+			params[i] = name + "=" + scrubbed
+		}
+	}
+	masked.RawQuery = strings.Join(params, "&")
+	return l.scrub([]byte(masked.String()))
+}
+
+// credential reports whether a header or query parameter name looks like
+// it holds a credential.
+func credential(name string) bool {
+	lower := strings.ToLower(name)
+	return strings.Contains(lower, "auth") || strings.Contains(lower, "key") || strings.Contains(lower, "token") || strings.Contains(lower, "secret")
+}
+
+// scrub removes the provider's keys and inlined files from a payload.
+func (l requestLogger) scrub(payload []byte) string {
+	text := string(payload)
+	for _, key := range append([]string{l.provider.APIKey}, l.provider.APIKeys...) {
+		if len(key) >= 4 {
+			text = strings.ReplaceAll(text, key, scrubbed)
+		}
+	}
+	return dataURL.ReplaceAllString(text, "data:$1;base64,[omitted]")
+}
+
+// requestBody reads the body without consuming it.
+func requestBody(req *http.Request) []byte {
+	if req.Body == nil {
+		return nil
+	}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			defer body.Close()
+			data, _ := io.ReadAll(io.LimitReader(body, maxLoggedBody))
+			return data
+		}
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	return data[:min(len(data), maxLoggedBody)]
+}
+
+// loggedBody keeps the start of a response as it is read and saves the log
+// when the body is closed.
+type loggedBody struct {
+	io.ReadCloser
+	entry *RequestLog
+	start time.Time
+	scrub func([]byte) string
+	buf   bytes.Buffer
+	once  sync.Once
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := maxLoggedBody - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(n, room)])
+	}
+	if err != nil && err != io.EOF {
+		b.entry.Error = err.Error()
+	}
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.entry.ResponseBody = b.scrub(b.buf.Bytes())
+		b.entry.DurationMs = time.Since(b.start).Milliseconds()
+		saveRequestLog(b.entry)
+	})
+	return err
+}
+
+func saveRequestLog(entry *RequestLog) {
+	cutoff := time.Now().UTC().Add(-config.Duration("requestLogRetention"))
+	if err := providers.SaveRequestLog(entry, cutoff, int(config.Int64("requestLogMaxEntries"))); err != nil {
+		log.Error("Error saving request log", "provider", entry.ProviderID, "err", err)
+	}
+}
+
+// RequestLogs lists the logged requests, newest first and without their
+// headers and bodies, optionally of one user or provider.
+func RequestLogs(user string, providerID string, before int64, limit int) ([]*RequestLog, error) {
+	return providers.ListRequestLogs(user, providerID, before, limit)
+}
+
+// GetRequestLog returns a logged request with its payloads.
+func GetRequestLog(id int64) (*RequestLog, error) {
+	return providers.GetRequestLog(id)
+}
+
+// DeleteRequestLogs deletes every logged request.
+func DeleteRequestLogs() error {
+	return providers.DeleteRequestLogs()
+}
@@ -0,0 +1,102 @@
+package providers
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func TestRequestLogging(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	SetupProviderClient(logger.New(os.Stdout), db)
+
+	var requests atomic.Int32
+	server := flakyGateway(0, 0, &requests)
+	defer server.Close()
+	const key = "sk-very-secret-key"
+	if err := providers.Save(&Provider{ID: "logged", BaseURL: server.URL, APIKey: key, User: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	stream := func(content string) {
+		t.Helper()
+		sc := utils.StreamClient{User: "u", Writer: httptest.NewRecorder()}
+		params := RequestParams{Model: "logged/m", User: "u", Messages: []SimpleMessage{{Role: "user", Content: content}}}
+		if _, err := NewClient().SendChatCompletionStreamRequest(params, sc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stream("not logged")
+	if logs, _ := providers.ListRequestLogs("", "", 0, 10); len(logs) != 0 {
+		t.Fatalf("expected no logs while logging is off, got %d", len(logs))
+	}
+
+	t.Setenv("REQUEST_LOG_RETENTION", "1h")
+	stream("my key is " + key + " and a picture data:image/png;base64,iVBORw0KGgo=")
+	logs, err := providers.ListRequestLogs("u", "logged", 0, 10)
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("expected one log, got %v %v", logs, err)
+	}
+	if logs[0].RequestBody != "" || logs[0].Status != 200 || !strings.HasSuffix(logs[0].URL, "/chat/completions") {
+		t.Errorf("expected a summary of the request, got %+v", logs[0])
+	}
+
+	entry, err := providers.GetRequestLog(logs[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.RequestHeaders["Authorization"] != scrubbed {
+		t.Errorf("expected the authorization header to be scrubbed, got %q", entry.RequestHeaders["Authorization"])
+	}
+	if strings.Contains(entry.RequestBody, key) || !strings.Contains(entry.RequestBody, "my key is "+scrubbed) {
+		t.Errorf("expected the key to be scrubbed from the body, got %s", entry.RequestBody)
+	}
+	if !strings.Contains(entry.RequestBody, "data:image/png;base64,[omitted]") {
+		t.Errorf("expected the inlined file to be omitted, got %s", entry.RequestBody)
+	}
+	if !strings.Contains(entry.ResponseBody, `"content":"hi"`) || !strings.Contains(entry.ResponseBody, "[DONE]") {
+		t.Errorf("expected the whole streamed response, got %s", entry.ResponseBody)
+	}
+
+	t.Setenv("REQUEST_LOG_MAX_ENTRIES", "2")
+	stream("second")
+	stream("third")
+	logs, _ = providers.ListRequestLogs("", "", 0, 10)
+	if len(logs) != 2 || !strings.Contains(mustRequestLog(t, logs[0].ID).RequestBody, "third") {
+		t.Errorf("expected only the 2 newest logs to be kept, got %d", len(logs))
+	}
+}
+
+func TestRequestLogURL(t *testing.T) {
+	l := requestLogger{provider: &Provider{APIKey: "sk-in-the-path"}}
+	u, _ := url.Parse("https://gateway.example.com/v1/sk-in-the-path/chat?api-key=abc&Key=def&model=m&access_token=ghi")
+	want := "https://gateway.example.com/v1/" + scrubbed + "/chat?api-key=" + scrubbed + "&Key=" + scrubbed + "&model=m&access_token=" + scrubbed
+	if got := l.url(u); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func mustRequestLog(t *testing.T, id int64) *RequestLog {
+	t.Helper()
+	entry, err := providers.GetRequestLog(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
@@ -0,0 +1,65 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
+	"github.com/openai/openai-go/v3"
+)
+
+// retryBaseDelay is the delay before the first retry of a stream, doubled
+// for every further one.
+var retryBaseDelay = 500 * time.Millisecond
+
+// streamRetries is how often the user wants a failing stream retried.
+func streamRetries(user string) int {
+	value, err := settings.Get("streamRetries", user)
+	if err != nil {
+		def, _ := stngs.Lookup("streamRetries")
+		value = def.Default
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// transient reports whether a failed request is worth sending again: the
+// provider could not be reached, dropped the connection or answered with a
+// timeout, a rate limit or a server error.
+func transient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		status := apiErr.StatusCode
+		return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+	}
+	return true
+}
+
+// retryDelay is the backoff before the given retry, jittered between half
+// and all of it so that clients of a recovering gateway do not retry in step.
+func retryDelay(attempt int) time.Duration {
+	d := retryBaseDelay << attempt
+	return d/2 + rand.N(d/2+1)
+}
+
+// sleep waits for d, returning false when ctx ends first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
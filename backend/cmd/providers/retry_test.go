@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	logger "github.com/charmbracelet/log"
+)
+
+// flakyGateway fails the first requests with the given status and then
+// streams "hi", counting the requests it got.
+func flakyGateway(failures int32, status int, requests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":{"message":"bad gateway"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"id":"1","object":"chat.completion.chunk","model":"m","choices":[{"index":0,"delta":{"role":"assistant","content":"hi"}}]}`+"\n\n")
+		fmt.Fprint(w, `data: {"id":"1","object":"chat.completion.chunk","model":"m","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+}
+
+func TestStreamRetriesTransientErrors(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	SetupProviderClient(logger.New(os.Stdout), db)
+
+	original := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = original })
+
+	stream := func(providerID string, failures int32, status int) (*ChatCompletionMessage, int32, error) {
+		t.Helper()
+		var requests atomic.Int32
+		server := flakyGateway(failures, status, &requests)
+		defer server.Close()
+		if err := providers.Save(&Provider{ID: providerID, BaseURL: server.URL, User: "u"}); err != nil {
+			t.Fatal(err)
+		}
+		sc := utils.StreamClient{User: "u", Writer: httptest.NewRecorder()}
+		params := RequestParams{Model: providerID + "/m", User: "u", Messages: []SimpleMessage{{Role: "user", Content: "hello"}}}
+		msg, err := NewClient().SendChatCompletionStreamRequest(params, sc)
+		return msg, requests.Load(), err
+	}
+
+	msg, requests, err := stream("flaky", 2, http.StatusBadGateway)
+	if err != nil || msg.Content != "hi" || requests != 3 {
+		t.Errorf("expected the answer after 2 retries, got %v %v after %d requests", msg, err, requests)
+	}
+
+	_, requests, err = stream("invalid", 1, http.StatusBadRequest)
+	if err == nil || requests != 1 {
+		t.Errorf("expected a bad request to fail right away, got %v after %d requests", err, requests)
+	}
+
+	if err := settings.Save(map[string]string{"streamRetries": "0"}, "u"); err != nil {
+		t.Fatal(err)
+	}
+	_, requests, err = stream("overloaded", 1, http.StatusServiceUnavailable)
+	if apierr.CodeOf(err) != apierr.ProviderUnavailable || requests != 1 {
+		t.Errorf("expected no retries when disabled, got %v after %d requests", err, requests)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := range 4 {
+		full := retryBaseDelay << attempt
+		for range 20 {
+			if d := retryDelay(attempt); d < full/2 || d > full {
+				t.Fatalf("retryDelay(%d) = %s, want between %s and %s", attempt, d, full/2, full)
+			}
+		}
+	}
+}
@@ -2,10 +2,15 @@ package providers
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"net/http"
+	"time"
 
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/audit"
 	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 
 	"github.com/google/uuid"
@@ -17,19 +22,59 @@ type Request struct {
 	BaseURL string            `json:"base_url"`
 	APIKey  string            `json:"api_key"`
 	Headers map[string]string `json:"headers"`
+	Proxy   string            `json:"proxy,omitempty"`
+	Timeouts
 }
 
 type Response struct {
 	ID      string            `json:"id"`
 	BaseURL string            `json:"base_url"`
 	Headers map[string]string `json:"headers"`
+	// Proxy is shown without its password
+	Proxy string `json:"proxy,omitempty"`
+	Timeouts
+	Shared bool `json:"shared"`
+	// Owner is the admin sharing the provider, empty for the providers of
+	// the requesting user
+	Owner string `json:"owner,omitempty"`
+	// AllowedUsers are the users a shared provider of the requesting user
+	// is limited to, every user when empty
+	AllowedUsers []string `json:"allowed_users,omitempty"`
+}
+
+// newResponse shows a provider to user. Shared providers of someone else
+// only show what they are, not how they are reached.
+func newResponse(p *Provider, user string) Response {
+	if p.User != user {
+		return Response{ID: p.ID, BaseURL: p.BaseURL, Headers: map[string]string{}, Shared: true, Owner: p.User}
+	}
+	return Response{
+		ID:           p.ID,
+		BaseURL:      p.BaseURL,
+		Headers:      p.Headers,
+		Proxy:        displayProxy(p.Proxy),
+		Timeouts:     p.Timeouts,
+		Shared:       p.Shared,
+		AllowedUsers: p.AllowedUsers,
+	}
 }
 
 type Model struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
-	ProviderID string `json:"provider"`
-	IsEnabled  bool   `json:"is_enabled"`
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	ProviderID     string `json:"provider"`
+	IsEnabled      bool   `json:"is_enabled"`
+	SupportsVision *bool  `json:"supports_vision,omitempty"`
+	// SupportsTools and SupportsReasoning are only known once the model
+	// was probed, at ProbedAt
+	SupportsTools     *bool      `json:"supports_tools,omitempty"`
+	SupportsReasoning *bool      `json:"supports_reasoning,omitempty"`
+	ProbedAt          *time.Time `json:"probed_at,omitempty"`
+	Pricing
+	ModelMetadata
+	// Favorite and Aliases are the preferences of the requesting user
+	Favorite bool     `json:"favorite,omitempty"`
+	Aliases  []string `json:"aliases,omitempty"`
 }
 
 type ModelRequest struct {
@@ -42,22 +87,44 @@ type ModelsResponse struct {
 
 func Handler() http.Handler {
 
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("GET /", getProvidersList)
-	mux.HandleFunc("GET /{id}", getProvider)
-	mux.HandleFunc("POST /save", saveProvider)
-	mux.HandleFunc("DELETE /delete/{id}", deleteProvider)
-	mux.HandleFunc("POST /refresh-models/{id}", refreshProviderModels)
+	mux := openapi.NewRouter("/api/providers", "Providers")
+
+	mux.HandleFunc("GET /", getProvidersList, openapi.Op{Summary: "List providers", Response: []Response{}})
+	mux.HandleFunc("GET /{id}", getProvider, openapi.Op{Summary: "Get a provider", Response: Response{}})
+	mux.HandleFunc("POST /save", saveProvider, openapi.Op{Summary: "Add a provider", Request: Request{}, Response: Response{}, Status: http.StatusCreated})
+	mux.HandleFunc("DELETE /delete/{id}", deleteProvider, openapi.Op{Summary: "Delete a provider and its models", Status: http.StatusNoContent})
+	mux.HandleFunc("PUT /{id}/timeouts", updateProviderTimeouts, openapi.Op{Summary: "Set the timeouts of a provider", Request: Timeouts{}, Response: Timeouts{}})
+	mux.HandleFunc("PUT /{id}/headers", updateProviderHeaders, openapi.Op{Summary: "Replace the headers sent to a provider", Request: HeadersRequest{}, Response: HeadersRequest{}})
+	mux.HandleFunc("PUT /{id}/proxy", updateProviderProxy, openapi.Op{Summary: "Set the proxy requests to a provider go through", Request: ProxyRequest{}, Response: ProxyRequest{}})
+	mux.HandleFunc("PUT /{id}/key-strategy", updateKeyStrategy, openapi.Op{Summary: "Choose how the keys of a provider are rotated", Request: KeyStrategyRequest{}, Status: http.StatusNoContent})
+	mux.HandleFunc("GET /keys/{id}", getProviderKeys, openapi.Op{Summary: "List the additional keys of a provider", Response: []APIKey{}})
+	mux.HandleFunc("POST /keys/{id}", addProviderKey, openapi.Op{Summary: "Add a key to a provider", Request: APIKeyRequest{}, Response: APIKey{}, Status: http.StatusCreated})
+	mux.HandleFunc("DELETE /keys/{id}/{keyId}", deleteProviderKey, openapi.Op{Summary: "Remove a key of a provider", Status: http.StatusNoContent})
+	mux.Handle("PUT /{id}/sharing", auth.Admin(http.HandlerFunc(updateProviderSharing)), openapi.Op{
+		Summary:     "Share a provider with other users",
+		Description: "Admins only. A shared provider is usable by the listed users, or by every user when none are listed; they cannot see or change its key.",
+		Request:     SharingRequest{},
+		Response:    SharingRequest{},
+	})
+	mux.HandleFunc("POST /refresh-models/{id}", refreshProviderModels, openapi.Op{Summary: "Fetch the models of a provider again", Description: "Answers 204, or with the probed models when probe is true.", Response: ModelsResponse{}, Query: []openapi.Param{{Name: "probe", Description: "true to test what the enabled models support"}}})
 
 	return http.StripPrefix("/api/providers", auth.Authenticated(mux))
 }
 
 func ModelsHandler() http.Handler {
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("GET /all", getAllModels)
-	mux.HandleFunc("POST /save-all", saveModels)
+	mux := openapi.NewRouter("/api/models", "Models")
+
+	mux.HandleFunc("GET /all", getAllModels, openapi.Op{Summary: "List the models of every provider", Response: ModelsResponse{}})
+	mux.HandleFunc("GET /recent", getRecentModels, openapi.Op{Summary: "List the recently used models", Response: RecentModelsResponse{}, Query: []openapi.Param{{Name: "sort", Description: "recent (default) or frequent"}, {Name: "limit", Description: "Most models returned, default 10"}}})
+	mux.HandleFunc("GET /aliases", getModelAliases, openapi.Op{Summary: "Get the model aliases", Response: AliasesResponse{}})
+	mux.HandleFunc("PUT /aliases", saveModelAliases, openapi.Op{Summary: "Replace the model aliases", Request: AliasesRequest{}, Response: AliasesResponse{}})
+	mux.HandleFunc("POST /save-all", saveModels, openapi.Op{Summary: "Enable or disable models", Request: ModelRequest{}, Status: http.StatusNoContent})
+	// model IDs contain a slash, so {id} must be URL-encoded
+	mux.HandleFunc("GET /{id}/params", getModelParams, openapi.Op{Summary: "Get the default parameters of a model", Response: ModelParams{}})
+	mux.HandleFunc("PUT /{id}/params", saveModelParams, openapi.Op{Summary: "Set the default parameters of a model", Request: ModelParamsRequest{}, Response: ModelParams{}})
+	mux.HandleFunc("DELETE /{id}/params", deleteModelParams, openapi.Op{Summary: "Remove the default parameters of a model", Status: http.StatusNoContent})
+	mux.HandleFunc("PUT /{id}/favorite", setFavoriteModel, openapi.Op{Summary: "Mark a model as favorite", Status: http.StatusNoContent})
+	mux.HandleFunc("DELETE /{id}/favorite", setFavoriteModel, openapi.Op{Summary: "Unmark a favorite model", Status: http.StatusNoContent})
 
 	return http.StripPrefix("/api/models", auth.Authenticated(mux))
 }
@@ -65,6 +132,7 @@ func ModelsHandler() http.Handler {
 func getAllModels(w http.ResponseWriter, r *http.Request) {
 	user := utils.ExtractContextUser(r)
 	models := providers.GetAllModels(user)
+	withPreferences(models, user)
 	response := ModelsResponse{
 		Models: models,
 	}
@@ -77,7 +145,7 @@ func saveModels(w http.ResponseWriter, r *http.Request) {
 	err := utils.ExtractJSONBody(r, &models)
 	if err != nil {
 		log.Error("Error unmarshalling request body", "err", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
@@ -85,41 +153,37 @@ func saveModels(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Error("Error saving models for provider", "err", err)
 		if errors.Is(err, ErrUnauthorizedProviderReference) {
-			http.Error(w, "Unauthorized provider reference", http.StatusUnauthorized)
+			utils.Error(w, "Unauthorized provider reference", http.StatusUnauthorized)
 			return
 		}
-		http.Error(w, "Error saving models for provider", http.StatusInternalServerError)
+		utils.Error(w, "Error saving models for provider", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func fetchAllModels(provider *Provider) ([]*Model, error) {
+// fetchAllModels lists the models of the provider, until ctx is done.
+func fetchAllModels(ctx context.Context, provider *Provider) ([]*Model, error) {
 	models := make([]*Model, 0)
-	opts := []option.RequestOption{
-		option.WithAPIKey(provider.APIKey),
-		option.WithBaseURL(provider.BaseURL),
-		option.WithQuery("output_modalities", "all"),
-	}
-	for key, value := range provider.Headers {
-		opts = append(opts, option.WithHeader(key, value))
-	}
+	opts := append(ClientOptions(provider), option.WithQuery("output_modalities", "all"))
 	client := openai.NewClient(opts...)
 
-	list, err := client.Models.List(context.Background(), opts...)
+	list, err := client.Models.List(ctx)
 	if err != nil {
 		log.Error("Error fetching models", "provider", provider.ID, "err", err)
 		return nil, err
 	}
 
 	for _, model := range list.Data {
-		models = append(models, &Model{
+		m := &Model{
 			ID:         provider.ID + "/" + model.ID,
 			Name:       model.ID,
 			ProviderID: provider.ID,
 			IsEnabled:  true,
-		})
+		}
+		applyMetadata(m, model.RawJSON())
+		models = append(models, m)
 	}
 
 	return models, nil
@@ -131,11 +195,7 @@ func getProvidersList(w http.ResponseWriter, r *http.Request) {
 
 	response := make([]Response, 0, len(providers))
 	for _, p := range providers {
-		response = append(response, Response{
-			ID:      p.ID,
-			BaseURL: p.BaseURL,
-			Headers: p.Headers,
-		})
+		response = append(response, newResponse(p, user))
 	}
 
 	utils.RespondWithJSON(w, &response, http.StatusOK)
@@ -147,16 +207,11 @@ func getProvider(w http.ResponseWriter, r *http.Request) {
 	provider, err := providers.GetByID(id, user)
 	if err != nil {
 		log.Error("Provider not found", "err", err)
-		http.Error(w, "Provider not found", http.StatusNotFound)
+		utils.Error(w, "Provider not found", http.StatusNotFound)
 		return
 	}
 
-	response := Response{
-		ID:      provider.ID,
-		BaseURL: provider.BaseURL,
-		Headers: provider.Headers,
-	}
-
+	response := newResponse(provider, user)
 	utils.RespondWithJSON(w, &response, http.StatusOK)
 }
 
@@ -165,26 +220,45 @@ func saveProvider(w http.ResponseWriter, r *http.Request) {
 	err := utils.ExtractJSONBody(r, &req)
 	if err != nil || req.BaseURL == "" {
 		log.Error("Error unmarshalling request body", "err", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err = req.Timeouts.Validate(); err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = validateHeaders(req.Headers); err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = validateProxy(req.Proxy); err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = utils.ValidateOutboundURL(req.BaseURL); err != nil {
+		utils.Error(w, "base_url "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	provider := &Provider{
-		ID:      utils.ExtractProviderName(req.BaseURL) + "-" + uuid.New().String()[:4],
-		BaseURL: req.BaseURL,
-		APIKey:  req.APIKey,
-		User:    utils.ExtractContextUser(r),
-		Headers: req.Headers,
+		ID:       utils.ExtractProviderName(req.BaseURL) + "-" + uuid.New().String()[:4],
+		BaseURL:  req.BaseURL,
+		APIKey:   req.APIKey,
+		User:     utils.ExtractContextUser(r),
+		Headers:  req.Headers,
+		Proxy:    req.Proxy,
+		Timeouts: req.Timeouts,
 	}
 
 	err = providers.Save(provider)
 	if err != nil {
 		log.Error("Error saving provider", "err", err)
-		http.Error(w, "Error saving provider", http.StatusInternalServerError)
+		utils.Error(w, "Error saving provider", http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, provider.User, audit.ProviderCreate, provider.ID, audit.Diff(nil, auditView(provider)))
 
-	models, fetchErr := fetchAllModels(provider)
+	models, fetchErr := fetchAllModels(r.Context(), provider)
 	if fetchErr != nil {
 		log.Error("Error fetching models for new provider", "err", fetchErr)
 	} else {
@@ -193,12 +267,7 @@ func saveProvider(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	response := Response{
-		ID:      provider.ID,
-		BaseURL: provider.BaseURL,
-		Headers: provider.Headers,
-	}
-
+	response := newResponse(provider, provider.User)
 	utils.RespondWithJSON(w, &response, http.StatusCreated)
 }
 
@@ -208,28 +277,61 @@ func deleteProvider(w http.ResponseWriter, r *http.Request) {
 	err := providers.DeleteByID(id, user)
 	if err != nil {
 		log.Error("Error deleting provider", "err", err)
-		http.Error(w, "Error deleting provider", http.StatusInternalServerError)
+		utils.Error(w, "Error deleting provider", http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, user, audit.ProviderDelete, id, nil)
+	forgetPool(id)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func updateProviderTimeouts(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	id := r.PathValue("id")
+
+	var req Timeouts
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before, _ := providers.GetByID(id, user)
+	err := providers.UpdateTimeouts(id, user, req)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Provider not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error updating provider timeouts", "err", err)
+		utils.Error(w, "Error updating provider timeouts", http.StatusInternalServerError)
+		return
+	}
+	recordUpdate(r, user, before)
+
+	utils.RespondWithJSON(w, &req, http.StatusOK)
+}
+
 func refreshProviderModels(w http.ResponseWriter, r *http.Request) {
 	user := utils.ExtractContextUser(r)
 	id := r.PathValue("id")
 
 	provider, err := providers.GetByID(id, user)
-	if err != nil {
+	if err != nil || provider.User != user {
 		log.Error("Provider not found", "err", err)
-		http.Error(w, "Provider not found", http.StatusNotFound)
+		utils.Error(w, "Provider not found", http.StatusNotFound)
 		return
 	}
 
 	// Fetch fresh model list from provider API
-	freshModels, fetchErr := fetchAllModels(provider)
+	freshModels, fetchErr := fetchAllModels(r.Context(), provider)
 	if fetchErr != nil {
 		log.Error("Error fetching models from provider", "err", fetchErr)
-		http.Error(w, "Failed to fetch models from provider", http.StatusBadGateway)
+		utils.RespondWithError(w, apierr.ProviderUnavailable, "Failed to fetch models from provider", http.StatusBadGateway)
 		return
 	}
 
@@ -253,19 +355,36 @@ func refreshProviderModels(w http.ResponseWriter, r *http.Request) {
 	if err = providers.SaveModels(freshModels, user); err != nil {
 		log.Error("Error saving refreshed models", "err", err)
 		if errors.Is(err, ErrUnauthorizedProviderReference) {
-			http.Error(w, "Unauthorized provider reference", http.StatusUnauthorized)
+			utils.Error(w, "Unauthorized provider reference", http.StatusUnauthorized)
 			return
 		}
-		http.Error(w, "Error saving models", http.StatusInternalServerError)
+		utils.Error(w, "Error saving models", http.StatusInternalServerError)
 		return
 	}
 
 	// Remove stale models that no longer exist at the provider
 	if err = providers.DeleteModelsNotIn(provider.ID, newModelIDs); err != nil {
 		log.Error("Error deleting stale models", "err", err)
-		http.Error(w, "Error cleaning up stale models", http.StatusInternalServerError)
+		utils.Error(w, "Error cleaning up stale models", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	if r.URL.Query().Get("probe") != "true" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Probe the enabled models for the features they really support
+	enabled := make([]*Model, 0, len(freshModels))
+	for _, m := range freshModels {
+		if m.IsEnabled {
+			enabled = append(enabled, m)
+		}
+	}
+	probeModels(provider, enabled)
+
+	models := providers.GetModelsByProvider(provider.ID)
+	withPreferences(models, user)
+	response := ModelsResponse{Models: models}
+	utils.RespondWithJSON(w, &response, http.StatusOK)
 }
@@ -10,11 +10,16 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/tracing"
+	"github.com/Bajahaw/ai-ui/cmd/usage"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 
 	"github.com/google/uuid"
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
+	"github.com/openai/openai-go/v3/packages/ssestream"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type ActiveStream struct {
@@ -48,12 +53,16 @@ type SimpleMessage struct {
 }
 
 type RequestParams struct {
+	// Context is the context of the request the completion is made for,
+	// the provider request is stopped once it is done. Nil never stops it.
+	Context         context.Context
 	Messages        []SimpleMessage
 	Model           string
 	ReasoningEffort openai.ReasoningEffort
 	User            string
 	MessageID       int
 	Tools           []openai.ChatCompletionToolUnionParam
+	SamplingParams
 }
 
 type ChatCompletionMessage struct {
@@ -61,6 +70,15 @@ type ChatCompletionMessage struct {
 	Reasoning string
 	ToolCalls []ToolCall
 	Stats     utils.StreamStats
+	// FinishReason is why the provider stopped, "length" when the answer
+	// was cut off by the max token limit
+	FinishReason string
+	// Disconnected is set when the stream stopped early because the client
+	// went away, the message holds what was generated until then
+	Disconnected bool
+	// Stopped is set when the user cancelled the stream with CancelStream,
+	// the message holds what was generated until then
+	Stopped bool
 }
 
 type ToolCall struct {
@@ -72,34 +90,64 @@ type ToolCall struct {
 	Args        string `json:"args,omitempty"`
 	Output      string `json:"tool_output,omitempty"`
 	File        string `json:"files,omitempty"`
+	OutputType  string `json:"output_type,omitempty"`
 	TokenCount  int    `json:"tokenCount,omitempty"`
 	ContextSize int    `json:"contextSize,omitempty"`
+	// Code is set when the tool call failed, it is not stored
+	Code apierr.Code `json:"code,omitempty"`
 }
 
 type ToolOutput struct {
-	Content string `json:"content"`
-	File    string `json:"file_ids,omitempty"`
+	Content string      `json:"content"`
+	File    string      `json:"file_ids,omitempty"`
+	Type    string      `json:"output_type,omitempty"`
+	Code    apierr.Code `json:"code,omitempty"`
 }
 
+// Output types tell clients how to render a tool's output, plain text
+// when none is set.
+const (
+	// OutputJSON is any JSON value
+	OutputJSON     = "json"
+	OutputMarkdown = "markdown"
+	// OutputImageURL is text about an image, shown from the tool call's
+	// file or the path in the text
+	OutputImageURL = "image_url"
+	// OutputTable is a JSON array of objects, one per row
+	OutputTable = "table"
+)
+
 func (c *ClientImpl) SendChatCompletionRequest(params RequestParams) (*ChatCompletionMessage, error) {
+	ctx, span := tracing.Start(parentContext(params), "provider.completion", attribute.String("model", params.Model))
+	params.Context = ctx
+	result, err := c.sendChatCompletion(params)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (c *ClientImpl) sendChatCompletion(params RequestParams) (*ChatCompletionMessage, error) {
 	providerID, model := utils.ExtractProviderID(params.Model)
 	provider, err := providers.GetByID(providerID, params.User)
 	if err != nil {
 		log.Error("Error querying provider", "err", err)
-		return nil, errors.New("Model or provider not found")
+		return nil, apierr.New(apierr.NotFound, "Model or provider not found")
+	}
+	resolveSamplingParams(&params)
+
+	var key string
+	if cacheable(params) {
+		var cached *ChatCompletionMessage
+		if key, cached = cachedCompletion(params); cached != nil {
+			return cached, nil
+		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	timeouts := provider.Timeouts
+	ctx, cancel := context.WithTimeoutCause(parentContext(params), timeouts.total(),
+		fmt.Errorf("%w: no complete response within %s", ErrTimeout, timeouts.total()))
 	defer cancel()
 
-	opts := []option.RequestOption{
-		option.WithAPIKey(provider.APIKey),
-		option.WithBaseURL(provider.BaseURL),
-	}
-	for key, value := range provider.Headers {
-		opts = append(opts, option.WithHeader(key, value))
-	}
-	client := openai.NewClient(opts...)
+	client := openai.NewClient(ClientOptions(provider)...)
 
 	openAIparams := openai.ChatCompletionNewParams{
 		Model:    model,
@@ -107,6 +155,8 @@ func (c *ClientImpl) SendChatCompletionRequest(params RequestParams) (*ChatCompl
 		Tools:    params.Tools,
 	}
 
+	setSamplingParams(&openAIparams, params)
+
 	log.Debug("Params ReasoningEffort:", "value", params.ReasoningEffort)
 	if params.ReasoningEffort != "" {
 		openAIparams.ReasoningEffort = params.ReasoningEffort
@@ -117,8 +167,10 @@ func (c *ClientImpl) SendChatCompletionRequest(params RequestParams) (*ChatCompl
 
 	completion, err := client.Chat.Completions.New(ctx, openAIparams)
 	if err != nil {
-		return nil, err
+		return nil, providerError(ctx, err, timeouts)
 	}
+	prompt, generated := int(completion.Usage.PromptTokens), int(completion.Usage.CompletionTokens)
+	usage.Record(params.User, params.Model, prompt, generated, UsageCost(params.Model, params.User, prompt, generated))
 
 	var toolCalls []ToolCall
 	for _, tc := range completion.Choices[0].Message.ToolCalls {
@@ -139,22 +191,77 @@ func (c *ClientImpl) SendChatCompletionRequest(params RequestParams) (*ChatCompl
 		reasoning = completion.Choices[0].Message.ReasoningContent
 	}
 
-	return &ChatCompletionMessage{
-		Content:   completion.Choices[0].Message.Content,
-		Reasoning: reasoning,
-		ToolCalls: toolCalls,
-	}, nil
+	result := &ChatCompletionMessage{
+		Content:      completion.Choices[0].Message.Content,
+		Reasoning:    reasoning,
+		ToolCalls:    toolCalls,
+		FinishReason: completion.Choices[0].FinishReason,
+	}
+	if key != "" {
+		cacheCompletion(key, params, result)
+	}
+	return result, nil
+}
+
+// parentContext is the context provider requests for params are made in.
+func parentContext(params RequestParams) context.Context {
+	if params.Context != nil {
+		return params.Context
+	}
+	return context.Background()
 }
 
 // SendChatCompletionStreamRequest streams chat completions and returns the full content
 func (c *ClientImpl) SendChatCompletionStreamRequest(params RequestParams, sc utils.StreamClient) (*ChatCompletionMessage, error) {
+	ctx, span := tracing.Start(parentContext(params), "provider.stream", attribute.String("model", params.Model))
+	params.Context = ctx
+	result, err := c.sendChatCompletionStream(params, sc)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (c *ClientImpl) sendChatCompletionStream(params RequestParams, sc utils.StreamClient) (*ChatCompletionMessage, error) {
 	providerID, model := utils.ExtractProviderID(params.Model)
 	provider, err := providers.GetByID(providerID, params.User)
 	if err != nil {
-		return nil, errors.New("Provider not found")
+		return nil, apierr.New(apierr.NotFound, "Provider not found")
+	}
+	resolveSamplingParams(&params)
+
+	timeouts := provider.Timeouts
+	// the stream outlives the request only through its own cancellation,
+	// the parent just carries the trace
+	ctx, cancel := context.WithTimeoutCause(context.WithoutCancel(parentContext(params)), timeouts.total(),
+		fmt.Errorf("%w: no complete response within %s", ErrTimeout, timeouts.total()))
+
+	// the read timeout restarts with every chunk, so only a stalled stream hits it
+	ctx, cancelIdle := context.WithCancelCause(ctx)
+	idle := time.AfterFunc(timeouts.read(), func() {
+		cancelIdle(fmt.Errorf("%w: no data from provider for %s", ErrTimeout, timeouts.read()))
+	})
+	defer idle.Stop()
+	defer cancelIdle(nil)
+
+	// stop generating, and paying for, tokens nobody will read
+	watched := sc.Context
+	if watched == nil {
+		watched = params.Context
+	}
+	if watched != nil {
+		stopWatching := context.AfterFunc(watched, func() { cancelIdle(utils.ErrClientGone) })
+		defer stopWatching()
+	}
+	// output tells whether the client got anything yet, once it did a
+	// failed stream can no longer be retried
+	output := false
+	send := func(chunk utils.StreamChunk) bool {
+		output = true
+		if err := utils.SendStreamChunk(sc, chunk); err != nil {
+			cancelIdle(err)
+			return false
+		}
+		return true
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 
 	activeStreamsMu.Lock()
 	activeStreams[params.MessageID] = ActiveStream{
@@ -170,89 +277,114 @@ func (c *ClientImpl) SendChatCompletionStreamRequest(params RequestParams, sc ut
 		cancel()
 	}()
 
-	opts := []option.RequestOption{
-		option.WithAPIKey(provider.APIKey),
-		option.WithBaseURL(provider.BaseURL),
-		// option.WithDebugLog(log.StandardLog()),
-	}
-	for key, value := range provider.Headers {
-		opts = append(opts, option.WithHeader(key, value))
-	}
-	client := openai.NewClient(opts...)
+	// transient errors are retried below, also after the stream started
+	client := openai.NewClient(append(ClientOptions(provider), option.WithMaxRetries(0))...)
 
 	openAIparams := openai.ChatCompletionNewParams{
 		Model:           model,
 		Messages:        OpenAIMessageParams(params.Messages),
 		ReasoningEffort: params.ReasoningEffort,
 		Tools:           params.Tools,
+		StreamOptions: openai.ChatCompletionStreamOptionsParam{
+			IncludeUsage: openai.Bool(true),
+		},
 	}
+	setSamplingParams(&openAIparams, params)
 
 	utils.AddStreamHeaders(sc.Writer)
 
-	stream := client.Chat.Completions.NewStreaming(ctx, openAIparams)
-	acc := openai.ChatCompletionAccumulator{}
-	uniqueToolIDs := make(map[string]string)
-	// isDeepseekThinkStyle := -1
-	// isDeepseekReasoningFinished := false
-
-	start := time.Now()
-
-	for stream.Next() {
-		chunk := stream.Current()
-		acc.AddChunk(chunk)
-
-		if len(chunk.Choices) > 0 {
-			// accContent := acc.Choices[0].Message.Content
-			contentDelta := chunk.Choices[0].Delta.Content
-			reasoningDelta := chunk.Choices[0].Delta.Reasoning
-
-			// Compatibility across providers (e.g. GitHub Copilot, Fireworks).
-			reasoningTxtDelta := chunk.Choices[0].Delta.ReasoningText
-			if reasoningTxtDelta != "" && reasoningDelta == "" {
-				reasoningDelta = reasoningTxtDelta
-			}
+	retries := streamRetries(params.User)
+	var stream *ssestream.Stream[openai.ChatCompletionChunk]
+	var acc openai.ChatCompletionAccumulator
+	var uniqueToolIDs map[string]string
+	var start time.Time
+	for attempt := 0; ; attempt++ {
+		stream = client.Chat.Completions.NewStreaming(ctx, openAIparams)
+		acc = openai.ChatCompletionAccumulator{}
+		uniqueToolIDs = make(map[string]string)
+		start = time.Now()
+
+		for stream.Next() {
+			idle.Reset(timeouts.read())
+			chunk := stream.Current()
+			acc.AddChunk(chunk)
+
+			if len(chunk.Choices) > 0 {
+				// accContent := acc.Choices[0].Message.Content
+				contentDelta := chunk.Choices[0].Delta.Content
+				reasoningDelta := chunk.Choices[0].Delta.Reasoning
+
+				// Compatibility across providers (e.g. GitHub Copilot, Fireworks).
+				reasoningTxtDelta := chunk.Choices[0].Delta.ReasoningText
+				if reasoningTxtDelta != "" && reasoningDelta == "" {
+					reasoningDelta = reasoningTxtDelta
+				}
 
-			reasoningContentDelta := chunk.Choices[0].Delta.ReasoningContent
-			if reasoningContentDelta != "" && reasoningDelta == "" {
-				reasoningDelta = reasoningContentDelta
-			}
+				reasoningContentDelta := chunk.Choices[0].Delta.ReasoningContent
+				if reasoningContentDelta != "" && reasoningDelta == "" {
+					reasoningDelta = reasoningContentDelta
+				}
 
-			if reasoningDelta != "" {
-				utils.SendStreamChunk(sc, utils.StreamChunk{
+				if reasoningDelta != "" && !send(utils.StreamChunk{
 					Payload: reasoningDelta,
 					Type:    utils.REASONING,
-				})
-			}
+				}) {
+					break
+				}
 
-			if contentDelta != "" {
-				utils.SendStreamChunk(sc, utils.StreamChunk{
+				if contentDelta != "" && !send(utils.StreamChunk{
 					Payload: contentDelta,
 					Type:    utils.CONTENT,
-				})
-			}
+				}) {
+					break
+				}
+
+				if toolCall, ok := acc.JustFinishedToolCall(); ok {
 
-			if toolCall, ok := acc.JustFinishedToolCall(); ok {
+					uniqueToolIDs[toolCall.ID] = uuid.New().String()
 
-				uniqueToolIDs[toolCall.ID] = uuid.New().String()
+					if !send(utils.StreamChunk{
+						Type: utils.TOOL_CALL,
+						Payload: ToolCall{
+							ID: uniqueToolIDs[toolCall.ID],
+							// ReferenceID: toolCall.ID,
+							Name: toolCall.Name,
+							Args: toolCall.Arguments,
+						},
+					}) {
+						break
+					}
+				}
 
-				utils.SendStreamChunk(sc, utils.StreamChunk{
-					Type: utils.TOOL_CALL,
-					Payload: ToolCall{
-						ID: uniqueToolIDs[toolCall.ID],
-						// ReferenceID: toolCall.ID,
-						Name: toolCall.Name,
-						Args: toolCall.Arguments,
-					},
-				})
 			}
+		}
+		stream.Close()
 
+		err := stream.Err()
+		if err == nil || output || attempt >= retries || ctx.Err() != nil || !transient(err) {
+			break
 		}
+		delay := retryDelay(attempt)
+		log.Warn("Transient provider error, retrying stream", "messageID", params.MessageID, "attempt", attempt+1, "delay", delay, "err", err)
+		idle.Stop()
+		if !sleep(ctx, delay) {
+			break
+		}
+		idle.Reset(timeouts.read())
 	}
 
 	duration := time.Since(start)
+	disconnected := errors.Is(context.Cause(ctx), utils.ErrClientGone)
+	if disconnected {
+		log.Debug("Client disconnected, stopped provider stream", "messageID", params.MessageID)
+	}
+	stopped := !disconnected && errors.Is(context.Cause(ctx), context.Canceled)
 
-	if err := stream.Err(); err != nil {
+	if err := stream.Err(); err != nil && !disconnected && !stopped {
 		log.Debug("Stream error", "err", err)
+		if err := timeoutError(ctx, err, timeouts); errors.Is(err, ErrTimeout) {
+			return nil, err
+		}
 		if errors.Is(err, context.Canceled) {
 			log.Debug("Stream cancelled by user")
 			// Ignore context cancelled error and return partial response
@@ -279,11 +411,13 @@ func (c *ClientImpl) SendChatCompletionStreamRequest(params RequestParams, sc ut
 					errMsg.Error.Message = "- " + errMsg.Error.Message
 				}
 
-				err = fmt.Errorf("%d %s %s",
+				err = apierr.Wrap(statusErrorCode(apiErr.StatusCode, errMsg.Error.Code, errMsg.Error.Message), fmt.Errorf("%d %s %s",
 					apiErr.StatusCode,
 					http.StatusText(apiErr.StatusCode),
 					errMsg.Error.Message,
-				)
+				))
+			} else {
+				err = apierr.Wrap(apierr.ProviderUnavailable, err)
 			}
 
 			return nil, err
@@ -293,12 +427,14 @@ func (c *ClientImpl) SendChatCompletionStreamRequest(params RequestParams, sc ut
 	if !(len(acc.Choices) > 0) {
 		log.Debug("Stream completed with no choices")
 		// If cancelled by user, return empty content instead of error
-		if errors.Is(stream.Err(), context.Canceled) {
+		if disconnected || stopped || errors.Is(stream.Err(), context.Canceled) {
 			return &ChatCompletionMessage{
-				Content:   "",
-				Reasoning: "",
-				ToolCalls: []ToolCall{},
-				Stats:     utils.StreamStats{},
+				Content:      "",
+				Reasoning:    "",
+				ToolCalls:    []ToolCall{},
+				Stats:        utils.StreamStats{},
+				Disconnected: disconnected,
+				Stopped:      stopped,
 			}, nil
 		}
 		return nil, fmt.Errorf("no choices in completion")
@@ -311,6 +447,11 @@ func (c *ClientImpl) SendChatCompletionStreamRequest(params RequestParams, sc ut
 	// so we generate our own IDs here
 	var toolCalls []ToolCall
 	for _, tc := range acc.Choices[0].Message.ToolCalls {
+		// nobody is left to see the tool run, or it was not wanted anymore,
+		// and the last call may be cut off
+		if disconnected || stopped {
+			break
+		}
 		id, ok := uniqueToolIDs[tc.ID]
 		if !ok {
 			id = uuid.New().String()
@@ -348,6 +489,8 @@ func (c *ClientImpl) SendChatCompletionStreamRequest(params RequestParams, sc ut
 		Speed: math.Round(float64(acc.Usage.CompletionTokens)/seconds*10) / 10,
 	}
 
+	sendUsage(sc, params, stats)
+
 	if len(toolCalls) > 0 {
 		// append tool call stats to the first tool call because
 		// we only need stats per completion, not per tool call
@@ -356,9 +499,12 @@ func (c *ClientImpl) SendChatCompletionStreamRequest(params RequestParams, sc ut
 	}
 
 	return &ChatCompletionMessage{
-		Content:   acc.Choices[0].Message.Content,
-		Reasoning: reasoning,
-		ToolCalls: toolCalls,
-		Stats:     stats,
+		Content:      acc.Choices[0].Message.Content,
+		Reasoning:    reasoning,
+		ToolCalls:    toolCalls,
+		Stats:        stats,
+		FinishReason: acc.Choices[0].FinishReason,
+		Disconnected: disconnected,
+		Stopped:      stopped,
 	}, nil
 }
@@ -0,0 +1,61 @@
+package providers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// SharingRequest shares a provider. Users limits it to some users, every
+// user can use it when there are none.
+type SharingRequest struct {
+	Shared bool     `json:"shared"`
+	Users  []string `json:"users"`
+}
+
+// updateProviderSharing lets a team use one paid key of an admin, who
+// keeps it to themselves: the others can only send requests through it.
+func updateProviderSharing(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	id := r.PathValue("id")
+
+	var req SharingRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	known := auth.Usernames()
+	for _, u := range req.Users {
+		if !slices.Contains(known, u) {
+			utils.Error(w, "Unknown user "+u, http.StatusBadRequest)
+			return
+		}
+	}
+	if !req.Shared {
+		req.Users = nil
+	}
+
+	before, _ := providers.GetByID(id, user)
+	err := providers.SetSharing(id, user, req.Shared, req.Users)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Provider not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error updating provider sharing", "err", err)
+		utils.Error(w, "Error updating provider sharing", http.StatusInternalServerError)
+		return
+	}
+	recordUpdate(r, user, before)
+
+	if req.Users == nil {
+		req.Users = []string{}
+	}
+	slices.Sort(req.Users)
+	req.Users = slices.Compact(req.Users)
+	utils.RespondWithJSON(w, &req, http.StatusOK)
+}
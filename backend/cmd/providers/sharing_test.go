@@ -0,0 +1,88 @@
+package providers
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	logger "github.com/charmbracelet/log"
+)
+
+func TestSharedProviders(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('admin', 'hash'), ('bob', 'hash'), ('carol', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	SetupProviderClient(logger.New(os.Stdout), db)
+	if err := providers.Save(&Provider{ID: "team", BaseURL: "http://localhost", APIKey: "sk-team", User: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := providers.Save(&Provider{ID: "own", BaseURL: "http://localhost", User: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := providers.SaveModels([]*Model{{ID: "team/m", ProviderID: "team", Name: "m", IsEnabled: true}}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	usable := func(user string) []string {
+		var ids []string
+		for _, p := range providers.GetAll(user) {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+
+	// private until shared
+	if ids := usable("bob"); len(ids) != 1 || ids[0] != "own" {
+		t.Fatalf("bob should only see his provider, got %v", ids)
+	}
+	if _, err := providers.GetByID("team", "bob"); err == nil {
+		t.Error("a private provider should not be found for others")
+	}
+
+	if err := providers.SetSharing("team", "bob", true, nil); err == nil {
+		t.Error("only the owner can share a provider")
+	}
+	if err := providers.SetSharing("team", "admin", true, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []string{"bob", "carol"} {
+		p, err := providers.GetByID("team", user)
+		if err != nil || p.User != "admin" || p.APIKey != "sk-team" {
+			t.Errorf("%s should use the shared provider with the owner's key, got %+v, %v", user, p, err)
+		}
+		if !providers.ModelExists("team/m", user) || len(providers.GetAllModels(user)) != 1 {
+			t.Errorf("%s should see the models of the shared provider", user)
+		}
+	}
+	shared, _ := providers.GetByID("team", "bob")
+	if resp := newResponse(shared, "bob"); resp.Owner != "admin" || resp.Proxy != "" || len(resp.Headers) != 0 {
+		t.Errorf("others should not see how a shared provider is reached: %+v", resp)
+	}
+
+	// limited to an allowlist
+	if err := providers.SetSharing("team", "admin", true, []string{"carol"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := providers.GetByID("team", "bob"); err == nil {
+		t.Error("bob is not on the allowlist")
+	}
+	if _, err := providers.GetByID("team", "carol"); err != nil {
+		t.Errorf("carol is on the allowlist: %v", err)
+	}
+	if p, _ := providers.GetByID("team", "admin"); len(p.AllowedUsers) != 1 || p.AllowedUsers[0] != "carol" {
+		t.Errorf("the owner should see the allowlist, got %v", p.AllowedUsers)
+	}
+
+	if err := providers.SetSharing("team", "admin", false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ids := usable("carol"); len(ids) != 0 {
+		t.Errorf("unshared provider still usable: %v", ids)
+	}
+}
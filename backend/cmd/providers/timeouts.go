@@ -0,0 +1,93 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/tracing"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+const maxTimeoutSeconds = 24 * 60 * 60
+
+var ErrTimeout = apierr.New(apierr.ProviderTimeout, "provider timeout")
+
+// Timeouts of requests to a provider in seconds, zero uses the default
+// from the admin config.
+// Read is the longest wait for the next piece of the response,
+// so slow reasoning models only need a larger total.
+type Timeouts struct {
+	ConnectTimeout int `json:"connect_timeout,omitempty"`
+	ReadTimeout    int `json:"read_timeout,omitempty"`
+	TotalTimeout   int `json:"total_timeout,omitempty"`
+}
+
+func (t Timeouts) Validate() error {
+	fields := []struct {
+		name  string
+		value int
+	}{
+		{"connect_timeout", t.ConnectTimeout},
+		{"read_timeout", t.ReadTimeout},
+		{"total_timeout", t.TotalTimeout},
+	}
+	for _, f := range fields {
+		if f.value < 0 || f.value > maxTimeoutSeconds {
+			return fmt.Errorf("%s must be between 0 and %d seconds", f.name, maxTimeoutSeconds)
+		}
+	}
+	return nil
+}
+
+func (t Timeouts) connect() time.Duration {
+	return seconds(t.ConnectTimeout, config.Duration("providerConnectTimeout"))
+}
+
+func (t Timeouts) read() time.Duration {
+	return seconds(t.ReadTimeout, config.Duration("providerReadTimeout"))
+}
+
+func (t Timeouts) total() time.Duration {
+	return seconds(t.TotalTimeout, config.Duration("providerTotalTimeout"))
+}
+
+func seconds(v int, fallback time.Duration) time.Duration {
+	if v <= 0 {
+		return fallback
+	}
+	return time.Duration(v) * time.Second
+}
+
+// httpClient applies the connect timeout to dialing and the TLS handshake,
+// and the read timeout to waiting for the response headers. Requests go
+// through the given proxy, or the one of the instance when it is empty, and
+// blocked addresses are refused.
+func (t Timeouts) httpClient(proxy string) *http.Client {
+	transport := utils.OutboundTransport(proxy)
+	transport.DialContext = utils.GuardedDialContext(&net.Dialer{
+		Timeout:   t.connect(),
+		KeepAlive: 30 * time.Second,
+	})
+	transport.TLSHandshakeTimeout = t.connect()
+	transport.ResponseHeaderTimeout = t.read()
+	return &http.Client{Transport: tracing.Transport(transport)}
+}
+
+// timeoutError tells apart the ways a request to a provider can time out
+// and wraps them in ErrTimeout. Other errors are returned unchanged.
+func timeoutError(ctx context.Context, err error, t Timeouts) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrTimeout) {
+		return cause
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w: provider did not respond within %s", ErrTimeout, t.read())
+	}
+	return err
+}
@@ -0,0 +1,20 @@
+package providers
+
+// UtilityModel returns the model that runs the side work of a user, like
+// titles, summaries and text extraction: their utility model when set,
+// otherwise fallback, usually the model of the conversation, and the
+// user's fallback model when that is empty too.
+func UtilityModel(user string, fallback string) string {
+	if model, err := settings.Get("utilityModel", user); err == nil && model != "" {
+		return ResolveModel(model, user)
+	}
+	if fallback != "" {
+		return ResolveModel(fallback, user)
+	}
+	model, err := settings.Get("model", user)
+	if err != nil {
+		log.Error("Error querying fallback model", "user", user, "err", err)
+		return ""
+	}
+	return ResolveModel(model, user)
+}
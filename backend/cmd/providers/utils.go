@@ -2,9 +2,30 @@ package providers
 
 import (
 	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
 	"github.com/openai/openai-go/v3/packages/param"
 )
 
+// ClientOptions returns the options for an OpenAI client talking to the
+// provider: credentials, custom headers, timeouts, proxy, key rotation and
+// request logging.
+func ClientOptions(provider *Provider) []option.RequestOption {
+	opts := []option.RequestOption{
+		option.WithAPIKey(provider.APIKey),
+		option.WithBaseURL(provider.BaseURL),
+		option.WithHTTPClient(provider.Timeouts.httpClient(provider.Proxy)),
+	}
+	for key, value := range provider.Headers {
+		opts = append(opts, option.WithHeader(key, value))
+	}
+	if len(provider.APIKeys) > 0 {
+		opts = append(opts, option.WithMiddleware(poolFor(provider).middleware))
+	}
+	// after the key pool, so every attempt is logged
+	opts = append(opts, option.WithMiddleware(requestLogger{provider: provider}.middleware))
+	return opts
+}
+
 func OpenAIMessageParams(messages []SimpleMessage) []openai.ChatCompletionMessageParamUnion {
 	openaiMessages := make([]openai.ChatCompletionMessageParamUnion, 0, len(messages))
 	for _, msg := range messages {
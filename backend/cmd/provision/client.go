@@ -0,0 +1,47 @@
+package provision
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+
+	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
+	logger "github.com/charmbracelet/log"
+)
+
+// defaultFile is read when CONFIG_FILE is not set.
+const defaultFile = "./data/ai-ui.yaml"
+
+var log *logger.Logger
+var settings stngs.Repository
+
+// SetupProvision applies the config file, or with CONFIG_DRY_RUN=true only
+// logs what applying it would change.
+func SetupProvision(l *logger.Logger, db *sql.DB) {
+	log = l
+	settings = stngs.NewRepository(db)
+
+	path := os.Getenv("CONFIG_FILE")
+	explicit := path != ""
+	if !explicit {
+		path = defaultFile
+	}
+	file, err := readFile(path)
+	if err != nil {
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			log.Error("Error reading config file", "path", path, "err", err)
+		}
+		return
+	}
+
+	dryRun := os.Getenv("CONFIG_DRY_RUN") == "true"
+	changes, err := Apply(file, dryRun)
+	if err != nil {
+		log.Error("Config file not applied", "path", path, "err", err)
+		return
+	}
+	for _, change := range changes {
+		log.Info("Config file", "change", change, "dryRun", dryRun)
+	}
+	log.Info("Config file applied", "path", path, "changes", len(changes), "dryRun", dryRun)
+}
@@ -0,0 +1,269 @@
+package provision
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
+	"github.com/Bajahaw/ai-ui/cmd/tools"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the whole configuration of an instance. Every section is
+// optional, and applying the same file twice changes nothing.
+type File struct {
+	// Options are instance options, as set on the admin config page.
+	Options map[string]string `yaml:"options"`
+	// Settings are given to every user, a user's own Settings win.
+	Settings   map[string]string            `yaml:"settings"`
+	Users      []User                       `yaml:"users"`
+	Providers  []providers.DeclaredProvider `yaml:"providers"`
+	MCPServers []tools.DeclaredMCPServer    `yaml:"mcp_servers"`
+}
+
+// User is created with Password when missing. An existing user keeps its
+// password, and its role when Role is empty.
+type User struct {
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	Role     string            `yaml:"role"`
+	Settings map[string]string `yaml:"settings"`
+}
+
+var (
+	mu sync.RWMutex
+	// applied is the last file applied, new users get its settings
+	applied *File
+)
+
+func readFile(path string) (*File, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file File
+	// ${VAR} references keep secrets out of the file
+	decoder := yaml.NewDecoder(bytes.NewReader([]byte(os.ExpandEnv(string(body)))))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Apply makes the instance match file and returns what it changes, or with
+// dryRun what it would change. Nothing is changed when the file is invalid.
+func Apply(file *File, dryRun bool) ([]string, error) {
+	if err := check(file); err != nil {
+		return nil, err
+	}
+	// providers and MCP servers are checked by planning them
+	if _, err := providers.Declare(file.Providers, true); err != nil {
+		return nil, err
+	}
+	if _, err := tools.DeclareMCPServers(file.MCPServers, true); err != nil {
+		return nil, err
+	}
+
+	changes := make([]string, 0)
+	changes = append(changes, planOptions(file)...)
+	if !dryRun {
+		if err := applyOptions(file); err != nil {
+			return changes, err
+		}
+	}
+	users, err := applyUsers(file, dryRun)
+	changes = append(changes, users...)
+	if err != nil {
+		return changes, err
+	}
+	userSettings, err := applySettings(file, dryRun)
+	changes = append(changes, userSettings...)
+	if err != nil {
+		return changes, err
+	}
+
+	if !dryRun {
+		mu.Lock()
+		applied = file
+		mu.Unlock()
+	}
+
+	declaredProviders, err := providers.Declare(file.Providers, dryRun)
+	changes = append(changes, declaredProviders...)
+	if err != nil {
+		return changes, err
+	}
+	servers, err := tools.DeclareMCPServers(file.MCPServers, dryRun)
+	changes = append(changes, servers...)
+	return changes, err
+}
+
+// SyncUser gives a new user the settings of the applied file.
+func SyncUser(user string) {
+	mu.RLock()
+	file := applied
+	mu.RUnlock()
+	if file == nil {
+		return
+	}
+	if _, err := syncSettings(file, user, false); err != nil {
+		log.Error("Error applying config file settings", "user", user, "err", err)
+	}
+}
+
+func check(file *File) error {
+	if errs := config.Validate(optionChanges(file)); len(errs) > 0 {
+		return fmt.Errorf("option %s: %s", errs[0].Key, errs[0].Message)
+	}
+	if errs := stngs.Validate(file.Settings); len(errs) > 0 {
+		return fmt.Errorf("setting %s: %s", errs[0].Key, errs[0].Message)
+	}
+
+	seen := make(map[string]bool)
+	for _, u := range file.Users {
+		if u.Username == "" {
+			return fmt.Errorf("a user needs a username")
+		}
+		if seen[u.Username] {
+			return fmt.Errorf("user %q is declared twice", u.Username)
+		}
+		seen[u.Username] = true
+		if u.Role != "" && u.Role != auth.RoleAdmin && u.Role != auth.RoleUser {
+			return fmt.Errorf("user %q: role must be %s or %s", u.Username, auth.RoleAdmin, auth.RoleUser)
+		}
+		if _, err := auth.Role(u.Username); err != nil && u.Password == "" {
+			return fmt.Errorf("user %q does not exist and needs a password", u.Username)
+		}
+		if errs := stngs.Validate(u.Settings); len(errs) > 0 {
+			return fmt.Errorf("user %q: setting %s: %s", u.Username, errs[0].Key, errs[0].Message)
+		}
+	}
+	return nil
+}
+
+func optionChanges(file *File) map[string]*string {
+	changes := make(map[string]*string, len(file.Options))
+	for key, v := range file.Options {
+		changes[key] = &v
+	}
+	return changes
+}
+
+func planOptions(file *File) []string {
+	current := make(map[string]string)
+	for _, e := range config.Entries() {
+		current[e.Key] = e.Value
+	}
+	changes := make([]string, 0)
+	for _, key := range slices.Sorted(maps.Keys(file.Options)) {
+		if current[key] != file.Options[key] {
+			changes = append(changes, "set option "+key)
+		}
+	}
+	return changes
+}
+
+func applyOptions(file *File) error {
+	if len(file.Options) == 0 {
+		return nil
+	}
+	errs, err := config.Update(optionChanges(file))
+	if len(errs) > 0 {
+		return fmt.Errorf("option %s: %s", errs[0].Key, errs[0].Message)
+	}
+	return err
+}
+
+func applyUsers(file *File, dryRun bool) ([]string, error) {
+	changes := make([]string, 0)
+	// the first user of an instance becomes its admin
+	empty := len(auth.Usernames()) == 0
+	for _, u := range file.Users {
+		role, err := auth.Role(u.Username)
+		switch {
+		case err == nil:
+		case dryRun:
+			changes = append(changes, "create user "+u.Username)
+			role = auth.RoleUser
+			if empty {
+				role, empty = auth.RoleAdmin, false
+			}
+		default:
+			changes = append(changes, "create user "+u.Username)
+			if err := auth.CreateUser(u.Username, u.Password); err != nil {
+				return changes, fmt.Errorf("user %q: %w", u.Username, err)
+			}
+			if role, err = auth.Role(u.Username); err != nil {
+				return changes, err
+			}
+		}
+		if u.Role == "" || u.Role == role {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("make %s %s", u.Username, u.Role))
+		if dryRun {
+			continue
+		}
+		if err := auth.SetRole(u.Username, u.Role); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+func applySettings(file *File, dryRun bool) ([]string, error) {
+	changes := make([]string, 0)
+	for _, user := range auth.Usernames() {
+		keys, err := syncSettings(file, user, dryRun)
+		if len(keys) > 0 {
+			changes = append(changes, fmt.Sprintf("set %s of %s", strings.Join(keys, ", "), user))
+		}
+		if err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// syncSettings saves the settings file gives user and returns the keys that
+// differed.
+func syncSettings(file *File, user string, dryRun bool) ([]string, error) {
+	want := maps.Clone(file.Settings)
+	if want == nil {
+		want = make(map[string]string)
+	}
+	for _, u := range file.Users {
+		if u.Username == user {
+			maps.Copy(want, u.Settings)
+		}
+	}
+	if len(want) == 0 {
+		return nil, nil
+	}
+
+	current, err := settings.GetAll(user)
+	if err != nil {
+		return nil, err
+	}
+	changed := make(map[string]string)
+	for key, v := range want {
+		if current[key] != v {
+			changed[key] = v
+		}
+	}
+	keys := slices.Sorted(maps.Keys(changed))
+	if dryRun || len(changed) == 0 {
+		return keys, nil
+	}
+	return keys, settings.Save(changed, user)
+}
@@ -0,0 +1,130 @@
+package provision
+
+import (
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
+	"github.com/Bajahaw/ai-ui/cmd/tools"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func TestApply(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	log = logger.New(os.Stdout)
+	settings = stngs.NewRepository(db)
+	config.Setup(log, db)
+	auth.Setup(log, db)
+	providers.SetupProviderClient(log, db)
+	tools.SetUpTools(log, db)
+
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash, role) VALUES ('alice', 'hash', 'admin')"); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath(t, `
+options:
+  maxBodySize: "2097152"
+settings:
+  systemPrompt: Be brief.
+users:
+  - username: bob
+    password: ${BOB_PASSWORD}
+    role: admin
+    settings:
+      systemPrompt: Be thorough.
+providers:
+  - type: openai
+    api_key: sk-test
+    users: [alice]
+`)
+	t.Setenv("BOB_PASSWORD", "correct horse")
+	parsed, err := readFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := Apply(parsed, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"set option maxBodySize", "create user bob", "make bob admin", "set systemPrompt of alice", "add provider openai of alice"} {
+		if !slices.Contains(changes, want) {
+			t.Errorf("expected %q in dry run %q", want, changes)
+		}
+	}
+	if _, err := auth.Role("bob"); err == nil {
+		t.Error("dry run created a user")
+	}
+	if config.Int64("maxBodySize") == 2<<20 {
+		t.Error("dry run changed an option")
+	}
+
+	if _, err := Apply(parsed, false); err != nil {
+		t.Fatal(err)
+	}
+	if role, err := auth.Role("bob"); err != nil || role != auth.RoleAdmin {
+		t.Errorf("expected bob to be an admin, got %q, %v", role, err)
+	}
+	if config.Int64("maxBodySize") != 2<<20 {
+		t.Errorf("option not applied: %d", config.Int64("maxBodySize"))
+	}
+	for user, want := range map[string]string{"alice": "Be brief.", "bob": "Be thorough."} {
+		if got, _ := settings.Get("systemPrompt", user); got != want {
+			t.Errorf("expected %s's system prompt %q, got %q", user, want, got)
+		}
+	}
+
+	changes, err = Apply(parsed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("expected applying twice to change nothing, got %q", changes)
+	}
+}
+
+func TestApplyRejectsInvalidFile(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  string
+	}{
+		{"unknown section", "agents: []", "field agents not found"},
+		{"unknown option", "options: {nope: '1'}", "unknown option"},
+		{"bad setting", "settings: {nope: '1'}", "unknown setting"},
+		{"bad role", "users: [{username: carol, password: longenough, role: owner}]", "role must be"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := readFile(filepath(t, tt.body))
+			if err == nil {
+				_, err = Apply(parsed, true)
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error with %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func filepath(t *testing.T, body string) string {
+	t.Helper()
+	file := path.Join(t.TempDir(), "ai-ui.yaml")
+	if err := os.WriteFile(file, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
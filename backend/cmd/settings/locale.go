@@ -0,0 +1,99 @@
+package settings
+
+import (
+	"time"
+	// the alpine image has no zoneinfo
+	_ "time/tzdata"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Localizer formats dates and numbers for a user, in the time zone and
+// for the locale of their settings.
+type Localizer struct {
+	Location *time.Location
+	Locale   language.Tag
+}
+
+// NewLocalizer returns the Localizer for the values of the timezone and
+// locale settings, falling back to UTC and English for empty or invalid
+// values.
+func NewLocalizer(timezone string, locale string) Localizer {
+	loc, err := loadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	tag, err := language.Parse(locale)
+	if err != nil || locale == "" {
+		tag = language.English
+	}
+	return Localizer{Location: loc, Locale: tag}
+}
+
+// LocalizerFor reads the timezone and locale settings of user from r.
+func LocalizerFor(r Repository, user string) Localizer {
+	timezone, _ := r.Get("timezone", user)
+	locale, _ := r.Get("locale", user)
+	return NewLocalizer(timezone, locale)
+}
+
+// Time formats t in the user's time zone, with the zone abbreviation.
+func (l Localizer) Time(t time.Time) string {
+	return t.In(l.Location).Format(l.layout())
+}
+
+// Date formats the day of t in the user's time zone.
+func (l Localizer) Date(t time.Time) string {
+	layout := time.DateOnly
+	switch l.style() {
+	case styleUS:
+		layout = "Monday, January 2, 2006"
+	case styleEnglish:
+		layout = "Monday, 2 January 2006"
+	}
+	return t.In(l.Location).Format(layout)
+}
+
+// Number formats n with the decimal and grouping separators of the locale.
+func (l Localizer) Number(n float64) string {
+	return message.NewPrinter(l.Locale).Sprintf("%v", n)
+}
+
+// layout is how times are written for the locale.
+func (l Localizer) layout() string {
+	switch l.style() {
+	case styleUS:
+		return "Jan 2, 2006, 3:04 PM MST"
+	case styleEnglish:
+		return "2 Jan 2006, 15:04 MST"
+	}
+	return "2006-01-02 15:04 MST"
+}
+
+// Date styles of locales. Month names are only written in English, other
+// languages get numeric dates.
+const (
+	styleUS      = "us"
+	styleEnglish = "en"
+	styleNumeric = "numeric"
+)
+
+func (l Localizer) style() string {
+	base, _ := l.Locale.Base()
+	if base.String() != "en" {
+		return styleNumeric
+	}
+	if region, _ := l.Locale.Region(); region.String() == "US" {
+		return styleUS
+	}
+	return styleEnglish
+}
+
+// loadLocation loads the time zone of a timezone setting, UTC when empty.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
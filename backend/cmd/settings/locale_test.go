@@ -0,0 +1,32 @@
+package settings
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocalizer(t *testing.T) {
+	at := time.Date(2025, 3, 1, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		timezone, locale string
+		time, date, num  string
+	}{
+		{"", "", "Mar 1, 2025, 11:30 PM UTC", "Saturday, March 1, 2025", "1,234.5"},
+		{"Europe/London", "en-GB", "1 Mar 2025, 23:30 GMT", "Saturday, 1 March 2025", "1,234.5"},
+		{"Asia/Tokyo", "de-DE", "2025-03-02 08:30 JST", "2025-03-02", "1.234,5"},
+		// invalid values fall back to UTC and English
+		{"Nowhere/Town", "!!", "Mar 1, 2025, 11:30 PM UTC", "Saturday, March 1, 2025", "1,234.5"},
+	}
+	for _, tt := range tests {
+		l := NewLocalizer(tt.timezone, tt.locale)
+		if got := l.Time(at); got != tt.time {
+			t.Errorf("%s %s: time %q, want %q", tt.timezone, tt.locale, got, tt.time)
+		}
+		if got := l.Date(at); got != tt.date {
+			t.Errorf("%s %s: date %q, want %q", tt.timezone, tt.locale, got, tt.date)
+		}
+		if got := l.Number(1234.5); got != tt.num {
+			t.Errorf("%s %s: number %q, want %q", tt.timezone, tt.locale, got, tt.num)
+		}
+	}
+}
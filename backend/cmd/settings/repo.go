@@ -1,6 +1,10 @@
 package settings
 
-import "database/sql"
+import (
+	"database/sql"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
 
 type Repository interface {
 	GetAll(user string) (map[string]string, error)
@@ -78,7 +82,7 @@ func (r *RepositoryImpl) SaveDefaults(defaults map[string]string, user string) e
 
 func (r *RepositoryImpl) Get(key string, user string) (string, error) {
 	sql := "SELECT value FROM Settings WHERE key = ? AND user = ?"
-	row := r.db.QueryRow(sql, key, user)
+	row := data.QueryRow(r.db, sql, key, user)
 
 	var value string
 	err := row.Scan(&value)
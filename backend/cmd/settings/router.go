@@ -1,16 +1,19 @@
 package settings
 
 import (
+	"github.com/Bajahaw/ai-ui/cmd/audit"
 	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 	"net/http"
 )
 
 func SettingsHandler() http.Handler {
-	mux := http.NewServeMux()
+	mux := openapi.NewRouter("/api/settings", "Settings")
 
-	mux.HandleFunc("GET 	/", getAllSettings)
-	mux.HandleFunc("POST 	/update", updateSettings)
+	mux.HandleFunc("GET 	/", getAllSettings, openapi.Op{Summary: "Get the user's settings", Response: Settings{}})
+	mux.HandleFunc("POST 	/update", updateSettings, openapi.Op{Summary: "Update settings", Request: Settings{}, Response: Settings{}})
+	mux.HandleFunc("GET 	/schema", getSettingsSchema, openapi.Op{Summary: "Describe every setting", Response: Schema{}})
 
 	return http.StripPrefix("/api/settings", auth.Authenticated(mux))
 }
@@ -20,30 +23,61 @@ func getAllSettings(w http.ResponseWriter, r *http.Request) {
 	settings, err := repo.GetAll(user)
 	if err != nil {
 		log.Error("Error querying settings", "err", err)
-		http.Error(w, "Error querying settings", http.StatusInternalServerError)
+		utils.Error(w, "Error querying settings", http.StatusInternalServerError)
 		return
 	}
 
+	// stale keys from before the schema existed are not exposed
+	for key := range settings {
+		if _, ok := Lookup(key); !ok {
+			delete(settings, key)
+		}
+	}
+
 	response := Settings{settings}
 	utils.RespondWithJSON(w, &response, http.StatusOK)
 }
 
+func getSettingsSchema(w http.ResponseWriter, r *http.Request) {
+	response := Schema{Registry}
+	utils.RespondWithJSON(w, &response, http.StatusOK)
+}
+
 func updateSettings(w http.ResponseWriter, r *http.Request) {
 	user := utils.ExtractContextUser(r)
 	var request Settings
 	err := utils.ExtractJSONBody(r, &request)
 	if err != nil {
 		log.Error("Error unmarshalling request body", "err", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	if errs := Validate(request.Settings); len(errs) > 0 {
+		log.Warn("Rejected invalid settings", "user", user, "errors", len(errs))
+		response := ValidationResponse{Error: "Invalid settings", Fields: errs}
+		utils.RespondWithJSON(w, &response, http.StatusBadRequest)
+		return
+	}
+
+	before := make(map[string]string, len(request.Settings))
+	if current, err := repo.GetAll(user); err == nil {
+		for key := range request.Settings {
+			if v, ok := current[key]; ok {
+				before[key] = v
+			}
+		}
+	}
+
 	err = repo.Save(request.Settings, user)
 	if err != nil {
 		log.Error("Error updating settings", "err", err)
-		http.Error(w, "Error updating settings", http.StatusInternalServerError)
+		utils.Error(w, "Error updating settings", http.StatusInternalServerError)
 		return
 	}
+	if changes := audit.Diff(before, request.Settings); len(changes) > 0 {
+		audit.Record(r, user, audit.SettingsUpdate, user, changes)
+	}
 
 	response := request
 
@@ -0,0 +1,447 @@
+package settings
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"golang.org/x/text/language"
+)
+
+type SettingType string
+
+const (
+	TypeText    SettingType = "text"
+	TypeBoolean SettingType = "boolean"
+	TypeEnum    SettingType = "enum"
+	TypeModel   SettingType = "model"
+	TypeNumber  SettingType = "number"
+	TypeInteger SettingType = "integer"
+	TypeEmail   SettingType = "email"
+	// TypeList is a comma separated, ordered list of distinct options
+	TypeList SettingType = "list"
+	// TypeTimezone is an IANA time zone name like Europe/Berlin
+	TypeTimezone SettingType = "timezone"
+	// TypeLocale is a BCP 47 language tag like en-US
+	TypeLocale SettingType = "locale"
+)
+
+// Scope tells whether a setting changes server behaviour
+// or is only a preference consumed by the UI.
+const (
+	ScopeServer = "server"
+	ScopeClient = "client"
+)
+
+type Definition struct {
+	Key         string      `json:"key"`
+	Type        SettingType `json:"type"`
+	Options     []string    `json:"options,omitempty"`
+	Default     string      `json:"default"`
+	Scope       string      `json:"scope"`
+	MaxLength   int         `json:"maxLength,omitempty"`
+	Min         *float64    `json:"min,omitempty"`
+	Max         *float64    `json:"max,omitempty"`
+	Description string      `json:"description"`
+}
+
+type ValidationError struct {
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+type ValidationResponse struct {
+	Error  string            `json:"error"`
+	Fields []ValidationError `json:"fields"`
+}
+
+type Schema struct {
+	Settings []Definition `json:"settings"`
+}
+
+// Registry lists every setting a user can store. Keys that are not
+// registered here are rejected on update.
+var Registry = []Definition{
+	{
+		Key:         "model",
+		Type:        TypeModel,
+		Default:     "gpt-4o",
+		Scope:       ScopeServer,
+		Description: "Fallback model for new conversations",
+	},
+	{
+		Key:         "defaultModel",
+		Type:        TypeModel,
+		Scope:       ScopeClient,
+		Description: "Model preselected in the chat input",
+	},
+	{
+		Key:         "systemPrompt",
+		Type:        TypeText,
+		Default:     "You are a helpful assistant. Provide clear accurate and helpful responses to the user questions.",
+		Scope:       ScopeServer,
+		MaxLength:   20000,
+		Description: "Instructions sent at the start of every conversation",
+	},
+	{
+		Key:         "appendDateToSystemPrompt",
+		Type:        TypeBoolean,
+		Default:     "false",
+		Scope:       ScopeServer,
+		Description: "Append the current date and time, in the user's time zone, to the system prompt",
+	},
+	{
+		Key:         "appendProfileToSystemPrompt",
+		Type:        TypeBoolean,
+		Default:     "false",
+		Scope:       ScopeServer,
+		Description: "Append the user profile to the system prompt",
+	},
+	{
+		Key:         "userProfile",
+		Type:        TypeText,
+		Scope:       ScopeServer,
+		MaxLength:   4000,
+		Description: "Facts about the user the model should know, such as their name, role or location",
+	},
+	{
+		Key:         "appendPlatformInstructions",
+		Type:        TypeBoolean,
+		Default:     "true",
+		Scope:       ScopeServer,
+		Description: "Append formatting instructions for this UI to the system prompt",
+	},
+	{
+		Key:         "reasoningEffort",
+		Type:        TypeEnum,
+		Options:     []string{"disabled", "none", "minimal", "low", "medium", "high"},
+		Default:     "disabled",
+		Scope:       ScopeServer,
+		Description: "Reasoning effort requested from reasoning models",
+	},
+	{
+		Key:         "responseType",
+		Type:        TypeEnum,
+		Options:     []string{"messages", "answer"},
+		Default:     "messages",
+		Scope:       ScopeServer,
+		Description: "What POST /api/chat/complete returns: the question and the answer, or only the answer",
+	},
+	{
+		Key:         "attachmentOcrOnly",
+		Type:        TypeBoolean,
+		Default:     "false",
+		Scope:       ScopeServer,
+		Description: "Always extract attachment text with the OCR model",
+	},
+	{
+		Key:         "ephemeralFileTTL",
+		Type:        TypeInteger,
+		Default:     "24",
+		Min:         bound(1),
+		Max:         bound(720),
+		Scope:       ScopeServer,
+		Description: "Hours ephemeral uploads are kept when the message they are attached to is not sent before",
+	},
+	{
+		Key:         "conversationArchiveDays",
+		Type:        TypeInteger,
+		Min:         bound(0),
+		Scope:       ScopeServer,
+		Description: "Days after their last message unpinned conversations are archived, 0 never; empty uses the server's policy",
+	},
+	{
+		Key:         "conversationDeleteDays",
+		Type:        TypeInteger,
+		Min:         bound(0),
+		Scope:       ScopeServer,
+		Description: "Days after their last message unpinned conversations are deleted, 0 never; empty uses the server's policy",
+	},
+	{
+		Key:         "fileRetentionDays",
+		Type:        TypeInteger,
+		Min:         bound(0),
+		Scope:       ScopeServer,
+		Description: "Days after their upload files outside knowledge bases and pinned conversations are deleted, 0 never; empty uses the server's policy",
+	},
+	{
+		Key:         "agenticDocumentRetrieval",
+		Type:        TypeBoolean,
+		Default:     "false",
+		Scope:       ScopeServer,
+		Description: "Let the model search documents with tools instead of inlining them",
+	},
+	{
+		Key:         "historySearch",
+		Type:        TypeBoolean,
+		Default:     "false",
+		Scope:       ScopeServer,
+		Description: "Let the model search your past conversations with the search_history tool",
+	},
+	{
+		Key:         "utilityModel",
+		Type:        TypeModel,
+		Scope:       ScopeServer,
+		Description: "Model used for titles, summaries and text extraction, the conversation's model when unset",
+	},
+	{
+		Key:         "ocrModel",
+		Type:        TypeModel,
+		Scope:       ScopeServer,
+		Description: "Model used to extract text from images and scanned documents, the utility model when unset",
+	},
+	{
+		Key:         "imageModel",
+		Type:        TypeModel,
+		Default:     "dall-e-3",
+		Scope:       ScopeServer,
+		Description: "Model used by the image generation tool",
+	},
+	{
+		Key:         "temperature",
+		Type:        TypeNumber,
+		Min:         bound(0),
+		Max:         bound(2),
+		Scope:       ScopeServer,
+		Description: "Sampling temperature, empty uses the provider default",
+	},
+	{
+		Key:         "topP",
+		Type:        TypeNumber,
+		Min:         bound(0),
+		Max:         bound(1),
+		Scope:       ScopeServer,
+		Description: "Nucleus sampling probability mass, empty uses the provider default",
+	},
+	{
+		Key:         "maxTokens",
+		Type:        TypeInteger,
+		Min:         bound(1),
+		Scope:       ScopeServer,
+		Description: "Maximum number of tokens to generate, empty means no limit",
+	},
+	{
+		Key:         "frequencyPenalty",
+		Type:        TypeNumber,
+		Min:         bound(-2),
+		Max:         bound(2),
+		Scope:       ScopeServer,
+		Description: "Penalty for tokens based on how often they already appeared",
+	},
+	{
+		Key:         "presencePenalty",
+		Type:        TypeNumber,
+		Min:         bound(-2),
+		Max:         bound(2),
+		Scope:       ScopeServer,
+		Description: "Penalty for tokens that already appeared at all",
+	},
+	{
+		Key:         "completionCache",
+		Type:        TypeBoolean,
+		Default:     "true",
+		Scope:       ScopeServer,
+		Description: "Reuse answers of identical requests sent with temperature 0, such as OCR",
+	},
+	{
+		Key:         "streamRetries",
+		Type:        TypeInteger,
+		Default:     "2",
+		Min:         bound(0),
+		Max:         bound(5),
+		Scope:       ScopeServer,
+		Description: "How often a response is retried when the provider fails transiently before sending anything",
+	},
+	{
+		Key:         "postProcessors",
+		Type:        TypeList,
+		Options:     []string{"stripWrappers", "normalizeLatex", "redact"},
+		Scope:       ScopeServer,
+		Description: "Rewrites applied in order to every answer before it is saved",
+	},
+	{
+		Key:         "redactionRules",
+		Type:        TypeText,
+		MaxLength:   4000,
+		Scope:       ScopeServer,
+		Description: "Regular expressions, one per line, matched by the redact post-processor and custom outbound redaction",
+	},
+	{
+		Key:         "outboundRedaction",
+		Type:        TypeList,
+		Options:     []string{"email", "phone", "creditCard", "custom"},
+		Scope:       ScopeServer,
+		Description: "Personal data replaced by placeholders in the messages sent to providers, and restored in their answers",
+	},
+	{
+		Key:         "timezone",
+		Type:        TypeTimezone,
+		Scope:       ScopeServer,
+		Description: "Time zone dates and times are shown in, like Europe/Berlin; UTC when unset",
+	},
+	{
+		Key:         "locale",
+		Type:        TypeLocale,
+		Scope:       ScopeServer,
+		Description: "Language and region dates and numbers are formatted for, like en-US",
+	},
+	{
+		Key:         "emailAddress",
+		Type:        TypeEmail,
+		Scope:       ScopeServer,
+		MaxLength:   254,
+		Description: "Address email digests are sent to",
+	},
+	{
+		Key:         "emailDigest",
+		Type:        TypeBoolean,
+		Default:     "false",
+		Scope:       ScopeServer,
+		Description: "Email the results of long responses that finish while no session is open",
+	},
+	{
+		Key:         "enterBehavior",
+		Type:        TypeEnum,
+		Options:     []string{"send", "newline"},
+		Default:     "send",
+		Scope:       ScopeClient,
+		Description: "What the Enter key does in the chat input",
+	},
+	{
+		Key:         "theme",
+		Type:        TypeEnum,
+		Options:     []string{"dark", "light"},
+		Default:     "dark",
+		Scope:       ScopeClient,
+		Description: "Color theme of the interface",
+	},
+}
+
+func Lookup(key string) (Definition, bool) {
+	for _, def := range Registry {
+		if def.Key == key {
+			return def, true
+		}
+	}
+	return Definition{}, false
+}
+
+func (d Definition) Validate(value string) error {
+	switch d.Type {
+	case TypeBoolean:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("must be \"true\" or \"false\"")
+		}
+	case TypeEnum:
+		if !slices.Contains(d.Options, value) {
+			return fmt.Errorf("must be one of %v", d.Options)
+		}
+	case TypeList:
+		seen := make(map[string]bool)
+		for _, item := range SplitList(value) {
+			if !slices.Contains(d.Options, item) {
+				return fmt.Errorf("items must be among %v", d.Options)
+			}
+			if seen[item] {
+				return fmt.Errorf("%q is listed twice", item)
+			}
+			seen[item] = true
+		}
+	case TypeNumber, TypeInteger:
+		// empty clears the value so the provider default applies
+		if value == "" {
+			return nil
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		if d.Type == TypeInteger && n != math.Trunc(n) {
+			return fmt.Errorf("must be a whole number")
+		}
+		if d.Min != nil && n < *d.Min {
+			return fmt.Errorf("must be at least %v", *d.Min)
+		}
+		if d.Max != nil && n > *d.Max {
+			return fmt.Errorf("must be at most %v", *d.Max)
+		}
+	case TypeTimezone:
+		if _, err := loadLocation(value); err != nil {
+			return fmt.Errorf("must be a time zone like Europe/Berlin")
+		}
+	case TypeLocale:
+		if value == "" {
+			return nil
+		}
+		if _, err := language.Parse(value); err != nil {
+			return fmt.Errorf("must be a language tag like en-US")
+		}
+	case TypeEmail:
+		if value == "" {
+			return nil
+		}
+		if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+			return fmt.Errorf("must be an email address")
+		}
+	}
+
+	if d.MaxLength > 0 && utf8.RuneCountInString(value) > d.MaxLength {
+		return fmt.Errorf("must be at most %d characters", d.MaxLength)
+	}
+	return nil
+}
+
+// Validate checks a settings update against the registry
+// and returns one error per offending key.
+func Validate(settings map[string]string) []ValidationError {
+	var errs []ValidationError
+	for key, value := range settings {
+		def, ok := Lookup(key)
+		if !ok {
+			errs = append(errs, ValidationError{Key: key, Message: "unknown setting"})
+			continue
+		}
+		if err := def.Validate(value); err != nil {
+			errs = append(errs, ValidationError{Key: key, Message: err.Error()})
+		}
+	}
+
+	slices.SortFunc(errs, func(a, b ValidationError) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return errs
+}
+
+// SplitList returns the items of a list setting.
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func bound(v float64) *float64 {
+	return &v
+}
+
+func defaults() map[string]string {
+	values := make(map[string]string)
+	for _, def := range Registry {
+		if def.Default != "" {
+			values[def.Key] = def.Default
+		}
+	}
+	if model := config.Get("defaultModel"); model != "" {
+		values["model"] = model
+		values["defaultModel"] = model
+	}
+	return values
+}
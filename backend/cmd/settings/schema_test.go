@@ -0,0 +1,62 @@
+package settings
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	errs := Validate(map[string]string{
+		"systemPrompt":             "Be brief.",
+		"appendDateToSystemPrompt": "yes",
+		"reasoningEffort":          "extreme",
+		"enterBehaviour":           "send",
+		"enterBehavior":            "newline",
+		"temperature":              "0.7",
+		"topP":                     "1.5",
+		"maxTokens":                "10.5",
+		"presencePenalty":          "",
+		"emailAddress":             "me at example.com",
+		"postProcessors":           "redact, stripWrappers, redact",
+		"timezone":                 "Mars/Olympus_Mons",
+		"locale":                   "en-US-!",
+	})
+
+	want := []string{"appendDateToSystemPrompt", "emailAddress", "enterBehaviour", "locale", "maxTokens", "postProcessors", "reasoningEffort", "timezone", "topP"}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors (%v), want %d", len(errs), errs, len(want))
+	}
+	for i, key := range want {
+		if errs[i].Key != key {
+			t.Errorf("error %d: got key %q, want %q", i, errs[i].Key, key)
+		}
+	}
+}
+
+func TestRegistryDefaultsAreValid(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, def := range Registry {
+		if seen[def.Key] {
+			t.Errorf("duplicate setting %q", def.Key)
+		}
+		seen[def.Key] = true
+
+		if def.Default == "" {
+			continue
+		}
+		if err := def.Validate(def.Default); err != nil {
+			t.Errorf("default for %q is invalid: %v", def.Key, err)
+		}
+	}
+}
+
+func TestValidateList(t *testing.T) {
+	def, _ := Lookup("postProcessors")
+	for _, value := range []string{"", "redact", "stripWrappers, normalizeLatex,redact"} {
+		if err := def.Validate(value); err != nil {
+			t.Errorf("expected %q to be valid, got %v", value, err)
+		}
+	}
+	for _, value := range []string{"shout", "redact,redact"} {
+		if err := def.Validate(value); err == nil {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package templates
+
+import (
+	"database/sql"
+
+	logger "github.com/charmbracelet/log"
+)
+
+var log *logger.Logger
+var repo Repository
+
+func SetupTemplates(l *logger.Logger, db *sql.DB) {
+	log = l
+	repo = NewRepository(db)
+}
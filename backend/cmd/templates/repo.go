@@ -0,0 +1,167 @@
+package templates
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Repository interface {
+	GetAll(user string) ([]*Template, error)
+	GetByID(id string, user string) (*Template, error)
+	Save(template *Template) error
+	Update(template *Template) error
+	DeleteByID(id string, user string) error
+	RecordUse(id string, user string) error
+	GetRecent(user string, byCount bool, limit int) ([]*RecentTemplate, error)
+}
+
+type RepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &RepositoryImpl{db: db}
+}
+
+// GetAll returns the user's own templates and the ones shared by others.
+func (r *RepositoryImpl) GetAll(user string) ([]*Template, error) {
+	query := `
+		SELECT id, name, description, content, shared, user, created_at, updated_at
+		FROM Templates
+		WHERE user = ? OR shared = 1
+		ORDER BY name
+	`
+	rows, err := r.db.Query(query, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := make([]*Template, 0)
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+func (r *RepositoryImpl) GetByID(id string, user string) (*Template, error) {
+	query := `
+		SELECT id, name, description, content, shared, user, created_at, updated_at
+		FROM Templates
+		WHERE id = ? AND (user = ? OR shared = 1)
+	`
+	return scanTemplate(r.db.QueryRow(query, id, user))
+}
+
+func (r *RepositoryImpl) Save(t *Template) error {
+	query := `INSERT INTO Templates (id, name, description, content, shared, user, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := r.db.Exec(query, t.ID, t.Name, t.Description, t.Content, t.Shared, t.Owner, t.CreatedAt, t.UpdatedAt)
+	return err
+}
+
+func (r *RepositoryImpl) Update(t *Template) error {
+	t.UpdatedAt = time.Now().UTC()
+	query := `UPDATE Templates SET name = ?, description = ?, content = ?, shared = ?, updated_at = ? WHERE id = ? AND user = ?`
+	res, err := r.db.Exec(query, t.Name, t.Description, t.Content, t.Shared, t.UpdatedAt, t.ID, t.Owner)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *RepositoryImpl) DeleteByID(id string, user string) error {
+	res, err := r.db.Exec(`DELETE FROM Templates WHERE id = ? AND user = ?`, id, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *RepositoryImpl) RecordUse(id string, user string) error {
+	query := `
+		INSERT INTO TemplateUsage (user, template_id, use_count, last_used_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT (user, template_id) DO UPDATE SET use_count = use_count + 1, last_used_at = excluded.last_used_at
+	`
+	_, err := r.db.Exec(query, user, id, time.Now().UTC())
+	return err
+}
+
+// GetRecent returns the templates the user used and can still see, most
+// recently used first, or most used first when byCount is set.
+func (r *RepositoryImpl) GetRecent(user string, byCount bool, limit int) ([]*RecentTemplate, error) {
+	order := "u.last_used_at DESC"
+	if byCount {
+		order = "u.use_count DESC, u.last_used_at DESC"
+	}
+	query := `
+		SELECT t.id, t.name, t.description, t.content, t.shared, t.user, t.created_at, t.updated_at,
+			u.use_count, u.last_used_at
+		FROM TemplateUsage u
+		JOIN Templates t ON t.id = u.template_id
+		WHERE u.user = ? AND (t.user = u.user OR t.shared = 1)
+		ORDER BY ` + order + `
+		LIMIT ?
+	`
+	rows, err := r.db.Query(query, user, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recent := make([]*RecentTemplate, 0)
+	for rows.Next() {
+		var t RecentTemplate
+		t.Template = &Template{}
+		err := rows.Scan(
+			&t.ID,
+			&t.Name,
+			&t.Description,
+			&t.Content,
+			&t.Shared,
+			&t.Owner,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+			&t.UseCount,
+			&t.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		t.Variables = Variables(t.Content)
+		recent = append(recent, &t)
+	}
+	return recent, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTemplate(row scanner) (*Template, error) {
+	var t Template
+	err := row.Scan(
+		&t.ID,
+		&t.Name,
+		&t.Description,
+		&t.Content,
+		&t.Shared,
+		&t.Owner,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	t.Variables = Variables(t.Content)
+	return &t, nil
+}
@@ -0,0 +1,226 @@
+package templates
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+type TemplateRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Content     string `json:"content"`
+	Shared      bool   `json:"shared"`
+}
+
+type TemplatesResponse struct {
+	Templates []*Template `json:"templates"`
+}
+
+// RecentTemplate is a template with how often and how recently the user
+// used it.
+type RecentTemplate struct {
+	*Template
+	UseCount   int       `json:"useCount"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+}
+
+type RecentTemplatesResponse struct {
+	Templates []*RecentTemplate `json:"templates"`
+}
+
+const (
+	defaultRecentLimit = 10
+	maxRecentLimit     = 50
+)
+
+type RenderRequest struct {
+	Variables map[string]string `json:"variables"`
+}
+
+type RenderResponse struct {
+	Content string `json:"content"`
+}
+
+func Handler() http.Handler {
+	mux := openapi.NewRouter("/api/templates", "Templates")
+
+	mux.HandleFunc("GET /", listTemplates, openapi.Op{Summary: "List prompt templates", Response: TemplatesResponse{}})
+	mux.HandleFunc("GET /{id}", getTemplate, openapi.Op{Summary: "Get a template", Response: Template{}})
+	mux.HandleFunc("POST /", createTemplate, openapi.Op{Summary: "Create a template", Request: TemplateRequest{}, Response: Template{}, Status: http.StatusCreated})
+	mux.HandleFunc("PUT /{id}", updateTemplate, openapi.Op{Summary: "Edit a template", Request: TemplateRequest{}, Response: Template{}})
+	mux.HandleFunc("DELETE /{id}", deleteTemplate, openapi.Op{Summary: "Delete a template", Status: http.StatusNoContent})
+	mux.HandleFunc("POST /{id}/render", renderTemplate, openapi.Op{Summary: "Render a template with variables", Request: RenderRequest{}, Response: RenderResponse{}})
+
+	return http.StripPrefix("/api/templates", auth.Authenticated(mux))
+}
+
+// PromptsHandler serves the quick-switcher view of the templates.
+func PromptsHandler() http.Handler {
+	mux := openapi.NewRouter("/api/prompts", "Templates")
+
+	mux.HandleFunc("GET /recent", listRecentTemplates, openapi.Op{
+		Summary:  "List the recently used templates",
+		Response: RecentTemplatesResponse{},
+		Query: []openapi.Param{
+			{Name: "sort", Description: "recent (default) or frequent"},
+			{Name: "limit", Description: "Most templates returned, default 10"},
+		},
+	})
+
+	return http.StripPrefix("/api/prompts", auth.Authenticated(mux))
+}
+
+func listTemplates(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	templates, err := repo.GetAll(user)
+	if err != nil {
+		log.Error("Error querying templates", "err", err)
+		utils.Error(w, "Error querying templates", http.StatusInternalServerError)
+		return
+	}
+
+	response := TemplatesResponse{Templates: templates}
+	utils.RespondWithJSON(w, &response, http.StatusOK)
+}
+
+// listRecentTemplates lists the templates the user rendered by last use, or
+// by number of uses with ?sort=frequent.
+func listRecentTemplates(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	limit, err := utils.QueryLimit(r, defaultRecentLimit, maxRecentLimit)
+	if err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	templates, err := repo.GetRecent(user, r.URL.Query().Get("sort") == "frequent", limit)
+	if err != nil {
+		log.Error("Error querying recent templates", "err", err)
+		utils.Error(w, "Error querying recent templates", http.StatusInternalServerError)
+		return
+	}
+
+	response := RecentTemplatesResponse{Templates: templates}
+	utils.RespondWithJSON(w, &response, http.StatusOK)
+}
+
+func getTemplate(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	t, err := repo.GetByID(r.PathValue("id"), user)
+	if err != nil {
+		utils.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	utils.RespondWithJSON(w, t, http.StatusOK)
+}
+
+func createTemplate(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req TemplateRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil || !req.valid() {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	t := &Template{
+		ID:          uuid.New().String(),
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Content:     req.Content,
+		Shared:      req.Shared,
+		Owner:       user,
+		Variables:   Variables(req.Content),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := repo.Save(t); err != nil {
+		log.Error("Error saving template", "err", err)
+		utils.Error(w, "Error saving template", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, t, http.StatusCreated)
+}
+
+func updateTemplate(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req TemplateRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil || !req.valid() {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	t, err := repo.GetByID(r.PathValue("id"), user)
+	if err != nil || t.Owner != user {
+		// shared templates can only be edited by their owner
+		utils.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+
+	t.Name = strings.TrimSpace(req.Name)
+	t.Description = req.Description
+	t.Content = req.Content
+	t.Shared = req.Shared
+	t.Variables = Variables(req.Content)
+	if err := repo.Update(t); err != nil {
+		log.Error("Error updating template", "err", err)
+		utils.Error(w, "Error updating template", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, t, http.StatusOK)
+}
+
+func deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	err := repo.DeleteByID(r.PathValue("id"), user)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error deleting template", "err", err)
+		utils.Error(w, "Error deleting template", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func renderTemplate(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req RenderRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	content, err := RenderByID(r.PathValue("id"), user, req.Variables)
+	var missing *MissingVariablesError
+	if errors.As(err, &missing) {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		utils.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+
+	response := RenderResponse{Content: content}
+	utils.RespondWithJSON(w, &response, http.StatusOK)
+}
+
+func (req *TemplateRequest) valid() bool {
+	return strings.TrimSpace(req.Name) != "" && strings.TrimSpace(req.Content) != ""
+}
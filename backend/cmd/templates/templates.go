@@ -0,0 +1,78 @@
+package templates
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Template struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Content     string    `json:"content"`
+	Shared      bool      `json:"shared"`
+	Owner       string    `json:"owner"`
+	Variables   []string  `json:"variables"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// placeholders look like {{name}}, surrounding spaces are allowed
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+type MissingVariablesError struct {
+	Names []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	return "missing template variables: " + strings.Join(e.Names, ", ")
+}
+
+// Variables returns the distinct placeholder names in order of appearance.
+func Variables(content string) []string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, match := range placeholder.FindAllStringSubmatch(content, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// Render substitutes every placeholder with its value. All placeholders must
+// have a value, extra variables are ignored.
+func Render(content string, variables map[string]string) (string, error) {
+	var missing []string
+	for _, name := range Variables(content) {
+		if _, ok := variables[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", &MissingVariablesError{Names: missing}
+	}
+
+	return placeholder.ReplaceAllStringFunc(content, func(m string) string {
+		return variables[placeholder.FindStringSubmatch(m)[1]]
+	}), nil
+}
+
+// RenderByID renders a template the user owns or that is shared with them.
+func RenderByID(id string, user string, variables map[string]string) (string, error) {
+	t, err := repo.GetByID(id, user)
+	if err != nil {
+		return "", fmt.Errorf("template not found: %w", err)
+	}
+	content, err := Render(t.Content, variables)
+	if err != nil {
+		return "", err
+	}
+	if err := repo.RecordUse(id, user); err != nil {
+		log.Error("Error recording template use", "id", id, "err", err)
+	}
+	return content, nil
+}
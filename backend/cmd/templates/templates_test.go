@@ -0,0 +1,39 @@
+package templates
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestVariables(t *testing.T) {
+	got := Variables("Review this {{language}} code:\n{{ code }}\nAnswer in {{language}}. {{ not valid-name }}")
+	want := []string{"language", "code"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	content := "Explain this {{language}} snippet:\n{{ code }}"
+
+	got, err := Render(content, map[string]string{
+		"language": "Go",
+		"code":     "fmt.Println(\"{{language}}\")",
+		"unused":   "x",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// values are inserted verbatim and never expanded again
+	want := "Explain this Go snippet:\nfmt.Println(\"{{language}}\")"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	_, err = Render(content, map[string]string{"language": "Go"})
+	var missing *MissingVariablesError
+	if !errors.As(err, &missing) || !reflect.DeepEqual(missing.Names, []string{"code"}) {
+		t.Errorf("expected missing variable error for code, got %v", err)
+	}
+}
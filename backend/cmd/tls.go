@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsSetup is the optional built-in TLS, for installs without a reverse
+// proxy in front. It serves either the certificate in TLS_CERT_FILE and
+// TLS_KEY_FILE, or certificates from Let's Encrypt for TLS_DOMAINS.
+// HTTP/2 is negotiated on the TLS listener.
+type tlsSetup struct {
+	certFile  string
+	keyFile   string
+	manager   *autocert.Manager
+	httpsAddr string
+	// httpAddr redirects plain HTTP to HTTPS and answers ACME challenges,
+	// empty when HTTP_REDIRECT_ADDR is "off".
+	httpAddr string
+}
+
+// loadTLSSetup reads the TLS configuration, it returns nil when TLS is off.
+func loadTLSSetup() (*tlsSetup, error) {
+	t := &tlsSetup{
+		certFile:  os.Getenv("TLS_CERT_FILE"),
+		keyFile:   os.Getenv("TLS_KEY_FILE"),
+		httpsAddr: envOr("HTTPS_ADDR", ":443"),
+		httpAddr:  envOr("HTTP_REDIRECT_ADDR", ":80"),
+	}
+	if t.httpAddr == "off" {
+		t.httpAddr = ""
+	}
+
+	var domains []string
+	for d := range strings.SplitSeq(os.Getenv("TLS_DOMAINS"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, d)
+		}
+	}
+
+	switch {
+	case t.certFile == "" && t.keyFile == "" && len(domains) == 0:
+		return nil, nil
+	case len(domains) > 0 && (t.certFile != "" || t.keyFile != ""):
+		return nil, errors.New("set either TLS_CERT_FILE and TLS_KEY_FILE or TLS_DOMAINS, not both")
+	case len(domains) == 0 && (t.certFile == "" || t.keyFile == ""):
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	if len(domains) > 0 {
+		t.manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(envOr("TLS_CACHE_DIR", "./data/certs")),
+			Email:      os.Getenv("TLS_ACME_EMAIL"),
+		}
+	}
+	return t, nil
+}
+
+func envOr(key string, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (t *tlsSetup) serverConfig() *tls.Config {
+	if t.manager != nil {
+		// includes h2 and the ACME TLS-ALPN challenge protocol
+		return t.manager.TLSConfig()
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+}
+
+// redirectHandler sends plain HTTP requests to HTTPS, except ACME
+// HTTP-01 challenges which must be answered over HTTP.
+func (t *tlsSetup) redirectHandler() http.Handler {
+	_, httpsPort, _ := net.SplitHostPort(t.httpsAddr)
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+	if t.manager != nil {
+		return t.manager.HTTPHandler(redirect)
+	}
+	return redirect
+}
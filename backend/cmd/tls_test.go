@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoadTLSSetup(t *testing.T) {
+	if setup, err := loadTLSSetup(); setup != nil || err != nil {
+		t.Fatalf("TLS should be off without configuration, got %+v, %v", setup, err)
+	}
+
+	t.Setenv("TLS_CERT_FILE", "cert.pem")
+	if _, err := loadTLSSetup(); err == nil {
+		t.Errorf("expected an error for a certificate without a key")
+	}
+
+	t.Setenv("TLS_KEY_FILE", "key.pem")
+	t.Setenv("HTTP_REDIRECT_ADDR", "off")
+	setup, err := loadTLSSetup()
+	if err != nil || setup.manager != nil || setup.httpAddr != "" || setup.httpsAddr != ":443" {
+		t.Fatalf("unexpected setup %+v, %v", setup, err)
+	}
+
+	t.Setenv("TLS_DOMAINS", "chat.example.com")
+	if _, err := loadTLSSetup(); err == nil {
+		t.Errorf("expected an error when both certificate files and domains are set")
+	}
+
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_KEY_FILE", "")
+	setup, err = loadTLSSetup()
+	if err != nil || setup.manager == nil {
+		t.Fatalf("expected ACME to be used for TLS_DOMAINS, got %+v, %v", setup, err)
+	}
+	if err := setup.manager.HostPolicy(t.Context(), "other.example.com"); err == nil {
+		t.Errorf("certificates must only be requested for the configured domains")
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		httpsAddr string
+		want      string
+	}{
+		{":443", "https://chat.example.com/c/1?x=y"},
+		{":8443", "https://chat.example.com:8443/c/1?x=y"},
+	}
+	for _, tt := range tests {
+		setup := &tlsSetup{httpsAddr: tt.httpsAddr}
+		req := httptest.NewRequest("GET", "http://chat.example.com:80/c/1?x=y", nil)
+		w := httptest.NewRecorder()
+		setup.redirectHandler().ServeHTTP(w, req)
+
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != tt.want {
+			t.Errorf("%s: got %d %q, want %q", tt.httpsAddr, w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// ArgsError is the output of a tool call whose arguments do not match the
+// tool's input schema, so the model can correct them and call it again.
+type ArgsError struct {
+	Error  string `json:"error"`
+	Tool   string `json:"tool"`
+	Reason string `json:"reason"`
+	Hint   string `json:"hint"`
+}
+
+// validateArgs checks the arguments of a tool call against the tool's input
+// schema. Tools without a usable schema accept any arguments.
+func validateArgs(tool *Tool, args string) error {
+	if strings.TrimSpace(args) == "" {
+		args = "{}"
+	}
+	var instance any
+	if err := json.Unmarshal([]byte(args), &instance); err != nil {
+		return fmt.Errorf("arguments are not valid JSON: %v", err)
+	}
+
+	resolved := argsSchema(tool)
+	if resolved == nil {
+		return nil
+	}
+	return resolved.Validate(instance)
+}
+
+func argsSchema(tool *Tool) *jsonschema.Resolved {
+	if tool.InputSchema == "" {
+		return nil
+	}
+	var schema jsonschema.Schema
+	if err := json.Unmarshal([]byte(tool.InputSchema), &schema); err != nil {
+		log.Debug("Skipping validation of tool arguments", "tool", tool.Name, "err", err)
+		return nil
+	}
+	// older drafts are not supported by the validator
+	if schema.Schema != "" && !strings.Contains(schema.Schema, "draft-07") && !strings.Contains(schema.Schema, "2020-12") {
+		return nil
+	}
+	resolved, err := schema.Resolve(nil)
+	if err != nil {
+		log.Debug("Skipping validation of tool arguments", "tool", tool.Name, "err", err)
+		return nil
+	}
+	return resolved
+}
+
+func argsErrorOutput(tool *Tool, err error) providers.ToolOutput {
+	out, _ := json.Marshal(ArgsError{
+		Error:  "invalid_arguments",
+		Tool:   tool.Name,
+		Reason: err.Error(),
+		Hint:   "Fix the arguments to match the tool's input schema and call the tool again.",
+	})
+	return providers.ToolOutput{Content: string(out), Type: providers.OutputJSON, Code: apierr.ToolInvalidArgs}
+}
@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func TestValidateArgs(t *testing.T) {
+	log = logger.New(os.Stdout)
+	tool := &Tool{
+		Name:        "read_document_page",
+		InputSchema: `{"type":"object","properties":{"file_id":{"type":"string"},"start_page":{"type":"integer"}},"required":["file_id","start_page"]}`,
+	}
+	tests := []struct {
+		name  string
+		args  string
+		valid bool
+	}{
+		{"valid", `{"file_id": "f", "start_page": 2}`, true},
+		{"missing", `{"file_id": "f"}`, false},
+		{"wrong type", `{"file_id": "f", "start_page": "2"}`, false},
+		{"not json", `{"file_id": `, false},
+		{"empty", ``, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateArgs(tool, tt.args)
+			if (err == nil) != tt.valid {
+				t.Errorf("validateArgs(%s) = %v, want valid %v", tt.args, err, tt.valid)
+			}
+		})
+	}
+
+	for _, schema := range []string{"", "not a schema", `{"$schema": "http://json-schema.org/draft-04/schema#", "required": ["a"]}`} {
+		if err := validateArgs(&Tool{InputSchema: schema}, `{}`); err != nil {
+			t.Errorf("expected a tool without a usable schema to accept any arguments, got %v for %q", err, schema)
+		}
+	}
+
+	out := argsErrorOutput(tool, validateArgs(tool, `{"file_id": "f"}`))
+	var argsErr ArgsError
+	if err := json.Unmarshal([]byte(out.Content), &argsErr); err != nil || out.Code != apierr.ToolInvalidArgs {
+		t.Fatalf("expected a structured error, got %+v", out)
+	}
+	if argsErr.Tool != tool.Name || !strings.Contains(argsErr.Reason, "start_page") {
+		t.Errorf("expected the reason to name the missing argument, got %+v", argsErr)
+	}
+}
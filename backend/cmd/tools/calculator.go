@@ -0,0 +1,616 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+)
+
+// ── calculate ───────────────────────────────────────────────────────────
+//
+// A small evaluator for the arithmetic models get wrong: numbers with the
+// usual operators and functions, quantities with units that can be
+// converted with "to" or "in", and dates that days, weeks, months or years
+// can be added to or subtracted from. Nothing else can be evaluated, so it
+// is safe to run on any input.
+
+const maxExpressionLength = 1000
+
+func calculateTool(args string) providers.ToolOutput {
+	var params struct {
+		Expression string `json:"expression"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return providers.ToolOutput{Content: fmt.Sprintf("error decoding arguments: %v", err)}
+	}
+	if len(params.Expression) > maxExpressionLength {
+		return providers.ToolOutput{Content: fmt.Sprintf("error: expression is longer than %d characters", maxExpressionLength)}
+	}
+
+	result, err := evaluate(params.Expression, time.Now())
+	if err != nil {
+		return providers.ToolOutput{Content: fmt.Sprintf("error: %v", err)}
+	}
+	return providers.ToolOutput{Content: fmt.Sprintf("%s = %s", strings.TrimSpace(params.Expression), result)}
+}
+
+// unit is a unit of measure, converted to the base unit of its dimension as
+// value*factor + offset.
+type unit struct {
+	name      string
+	dimension string
+	factor    float64
+	offset    float64
+}
+
+var units = map[string]unit{}
+
+func init() {
+	add := func(dimension string, factor float64, names ...string) {
+		for _, name := range names {
+			units[name] = unit{name: names[0], dimension: dimension, factor: factor}
+		}
+	}
+
+	add("length", 1, "m", "meter", "meters", "metre", "metres")
+	add("length", 1000, "km", "kilometer", "kilometers")
+	add("length", 0.01, "cm", "centimeter", "centimeters")
+	add("length", 0.001, "mm", "millimeter", "millimeters")
+	add("length", 1609.344, "mi", "mile", "miles")
+	add("length", 0.9144, "yd", "yard", "yards")
+	add("length", 0.3048, "ft", "foot", "feet")
+	add("length", 0.0254, "inch", "inches")
+	add("length", 1852, "nmi")
+
+	add("mass", 1, "kg", "kilogram", "kilograms")
+	add("mass", 0.001, "g", "gram", "grams")
+	add("mass", 1e-6, "mg", "milligram", "milligrams")
+	add("mass", 1000, "t", "tonne", "tonnes")
+	add("mass", 0.45359237, "lb", "lbs", "pound", "pounds")
+	add("mass", 0.028349523125, "oz", "ounce", "ounces")
+
+	add("volume", 1, "l", "L", "liter", "liters", "litre", "litres")
+	add("volume", 0.001, "ml", "mL", "milliliter", "milliliters")
+	add("volume", 3.785411784, "gal", "gallon", "gallons")
+	add("volume", 0.0295735295625, "floz")
+	add("volume", 0.2365882365, "cup", "cups")
+
+	add("time", 0.001, "ms", "millisecond", "milliseconds")
+	add("time", 1, "s", "sec", "second", "seconds")
+	add("time", 60, "min", "minute", "minutes")
+	add("time", 3600, "h", "hr", "hour", "hours")
+	add("time", 86400, "days", "day")
+	add("time", 7*86400, "weeks", "week")
+	add("time", 30.436875*86400, "months", "month")
+	add("time", 365.2425*86400, "years", "year")
+
+	add("speed", 1, "m/s")
+	add("speed", 1/3.6, "km/h", "kph")
+	add("speed", 0.44704, "mph")
+	add("speed", 0.514444, "knot", "knots")
+
+	add("data", 1, "B", "byte", "bytes")
+	add("data", 0.125, "bit", "bits")
+	add("data", 1e3, "KB", "kB")
+	add("data", 1e6, "MB")
+	add("data", 1e9, "GB")
+	add("data", 1e12, "TB")
+	add("data", 1<<10, "KiB")
+	add("data", 1<<20, "MiB")
+	add("data", 1<<30, "GiB")
+	add("data", 1<<40, "TiB")
+
+	add("area", 1, "m2", "sqm")
+	add("area", 1e6, "km2")
+	add("area", 10000, "ha", "hectare", "hectares")
+	add("area", 4046.8564224, "acre", "acres")
+	add("area", 0.09290304, "ft2", "sqft")
+
+	for name, offset := range map[string]float64{"C": 273.15, "K": 0, "F": 273.15 - 32*5.0/9} {
+		factor := 1.0
+		if name == "F" {
+			factor = 5.0 / 9
+		}
+		units[name] = unit{name: name, dimension: "temperature", factor: factor, offset: offset}
+	}
+	units["celsius"] = units["C"]
+	units["fahrenheit"] = units["F"]
+	units["kelvin"] = units["K"]
+}
+
+func lookupUnit(name string) (unit, bool) {
+	if u, ok := units[name]; ok {
+		return u, true
+	}
+	u, ok := units[strings.ToLower(name)]
+	return u, ok
+}
+
+// value is a number, optionally with a unit, or a date.
+type value struct {
+	num  float64
+	unit *unit
+	date *time.Time
+}
+
+func (v value) String() string {
+	if v.date != nil {
+		if v.date.Hour() == 0 && v.date.Minute() == 0 && v.date.Second() == 0 {
+			return fmt.Sprintf("%s (%s)", v.date.Format(time.DateOnly), v.date.Weekday())
+		}
+		return v.date.Format(time.RFC3339)
+	}
+	num := formatNumber(v.num)
+	if v.unit != nil {
+		return num + " " + v.unit.name
+	}
+	return num
+}
+
+func formatNumber(n float64) string {
+	if n == math.Trunc(n) && math.Abs(n) < 1e15 {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(n, 'g', 12, 64)
+}
+
+// convert returns the value in the given unit of the same dimension.
+func (v value) convert(to *unit) (value, error) {
+	if v.date != nil {
+		return value{}, fmt.Errorf("cannot convert a date to %s", to.name)
+	}
+	if v.unit == nil || v.unit.dimension != to.dimension {
+		return value{}, fmt.Errorf("cannot convert %s to %s", v, to.name)
+	}
+	base := v.num*v.unit.factor + v.unit.offset
+	return value{num: (base - to.offset) / to.factor, unit: to}, nil
+}
+
+type token struct {
+	kind string // number, date, ident, op
+	text string
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r) || r == '°':
+			i++
+		case isDate(runes[i:]):
+			tokens = append(tokens, token{"date", string(runes[i : i+10])})
+			i += 10
+		case unicode.IsDigit(r) || r == '.':
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' || runes[j] == '_') {
+				j++
+			}
+			// exponent, as in 1.5e3
+			if j+1 < len(runes) && (runes[j] == 'e' || runes[j] == 'E') &&
+				(unicode.IsDigit(runes[j+1]) || (j+2 < len(runes) && (runes[j+1] == '-' || runes[j+1] == '+') && unicode.IsDigit(runes[j+2]))) {
+				j += 2
+				for j < len(runes) && unicode.IsDigit(runes[j]) {
+					j++
+				}
+			}
+			tokens = append(tokens, token{"number", strings.ReplaceAll(string(runes[i:j]), "_", "")})
+			i = j
+		case unicode.IsLetter(r):
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			// compound units such as km/h and m/s
+			if j+1 < len(runes) && runes[j] == '/' && unicode.IsLetter(runes[j+1]) {
+				k := j + 1
+				for k < len(runes) && unicode.IsLetter(runes[k]) {
+					k++
+				}
+				if _, ok := units[string(runes[i:k])]; ok {
+					j = k
+				}
+			}
+			tokens = append(tokens, token{"ident", string(runes[i:j])})
+			i = j
+		case strings.ContainsRune("+-*/%^(),", r):
+			tokens = append(tokens, token{"op", string(r)})
+			i++
+		case r == '×':
+			tokens = append(tokens, token{"op", "*"})
+			i++
+		case r == '÷':
+			tokens = append(tokens, token{"op", "/"})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	return tokens, nil
+}
+
+// isDate reports whether the input starts with a YYYY-MM-DD date.
+func isDate(runes []rune) bool {
+	if len(runes) < 10 {
+		return false
+	}
+	for i, r := range runes[:10] {
+		if i == 4 || i == 7 {
+			if r != '-' {
+				return false
+			}
+		} else if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return len(runes) == 10 || !unicode.IsDigit(runes[10])
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	now    time.Time
+}
+
+// evaluate computes an expression, optionally ending in "to <unit>".
+func evaluate(input string, now time.Time) (string, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return "", err
+	}
+	if len(tokens) == 0 {
+		return "", fmt.Errorf("expression is empty")
+	}
+
+	p := &parser{tokens: tokens, now: now}
+	v, err := p.expr()
+	if err != nil {
+		return "", err
+	}
+	if t := p.peek(); t.kind == "ident" && (t.text == "to" || t.text == "in" || t.text == "as") {
+		p.pos++
+		name := p.next()
+		to, ok := lookupUnit(name.text)
+		if name.kind != "ident" || !ok {
+			return "", fmt.Errorf("unknown unit %q", name.text)
+		}
+		if v, err = v.convert(&to); err != nil {
+			return "", err
+		}
+	}
+	if p.pos < len(p.tokens) {
+		return "", fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if v.date == nil && (math.IsNaN(v.num) || math.IsInf(v.num, 0)) {
+		return "", fmt.Errorf("result is not a number")
+	}
+	return v.String(), nil
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{}
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) expr() (value, error) {
+	left, err := p.term()
+	if err != nil {
+		return value{}, err
+	}
+	for t := p.peek(); t.kind == "op" && (t.text == "+" || t.text == "-"); t = p.peek() {
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return value{}, err
+		}
+		if left, err = addValues(left, right, t.text == "-"); err != nil {
+			return value{}, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) term() (value, error) {
+	left, err := p.unary()
+	if err != nil {
+		return value{}, err
+	}
+	for t := p.peek(); t.kind == "op" && (t.text == "*" || t.text == "/" || t.text == "%"); t = p.peek() {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return value{}, err
+		}
+		if left, err = mulValues(left, right, t.text); err != nil {
+			return value{}, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) unary() (value, error) {
+	if t := p.peek(); t.kind == "op" && (t.text == "-" || t.text == "+") {
+		p.pos++
+		v, err := p.unary()
+		if err != nil {
+			return value{}, err
+		}
+		if v.date != nil {
+			return value{}, fmt.Errorf("cannot negate a date")
+		}
+		if t.text == "-" {
+			v.num = -v.num
+		}
+		return v, nil
+	}
+	return p.power()
+}
+
+func (p *parser) power() (value, error) {
+	base, err := p.quantity()
+	if err != nil {
+		return value{}, err
+	}
+	if t := p.peek(); t.kind == "op" && t.text == "^" {
+		p.pos++
+		exp, err := p.unary()
+		if err != nil {
+			return value{}, err
+		}
+		if base.unit != nil || base.date != nil || exp.unit != nil || exp.date != nil {
+			return value{}, fmt.Errorf("only plain numbers can be raised to a power")
+		}
+		return value{num: math.Pow(base.num, exp.num)}, nil
+	}
+	return base, nil
+}
+
+// quantity is a primary optionally followed by a unit, as in 5 km.
+func (p *parser) quantity() (value, error) {
+	v, err := p.primary()
+	if err != nil {
+		return value{}, err
+	}
+	t := p.peek()
+	if t.kind != "ident" || v.unit != nil || v.date != nil {
+		return v, nil
+	}
+	u, ok := lookupUnit(t.text)
+	if !ok || p.followedByCall() {
+		return v, nil
+	}
+	p.pos++
+	v.unit = &u
+	return v, nil
+}
+
+func (p *parser) followedByCall() bool {
+	return p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text == "("
+}
+
+func (p *parser) primary() (value, error) {
+	t := p.next()
+	switch t.kind {
+	case "number":
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return value{}, fmt.Errorf("invalid number %q", t.text)
+		}
+		return value{num: n}, nil
+	case "date":
+		d, err := time.Parse(time.DateOnly, t.text)
+		if err != nil {
+			return value{}, fmt.Errorf("invalid date %q", t.text)
+		}
+		return value{date: &d}, nil
+	case "ident":
+		return p.ident(t.text)
+	case "op":
+		if t.text == "(" {
+			v, err := p.expr()
+			if err != nil {
+				return value{}, err
+			}
+			if p.next().text != ")" {
+				return value{}, fmt.Errorf("missing )")
+			}
+			return v, nil
+		}
+		return value{}, fmt.Errorf("unexpected %q", t.text)
+	}
+	return value{}, fmt.Errorf("unexpected end of expression")
+}
+
+func (p *parser) ident(name string) (value, error) {
+	switch strings.ToLower(name) {
+	case "pi":
+		return value{num: math.Pi}, nil
+	case "e":
+		return value{num: math.E}, nil
+	case "today":
+		y, m, d := p.now.Date()
+		today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		return value{date: &today}, nil
+	case "now":
+		now := p.now.UTC().Truncate(time.Second)
+		return value{date: &now}, nil
+	}
+
+	fn, ok := functions[strings.ToLower(name)]
+	if !ok || p.next().text != "(" {
+		return value{}, fmt.Errorf("unknown name %q", name)
+	}
+	var args []float64
+	for p.peek().text != ")" {
+		v, err := p.expr()
+		if err != nil {
+			return value{}, err
+		}
+		if v.unit != nil || v.date != nil {
+			return value{}, fmt.Errorf("%s takes plain numbers", name)
+		}
+		args = append(args, v.num)
+		if p.peek().text != "," {
+			break
+		}
+		p.pos++
+	}
+	if p.next().text != ")" {
+		return value{}, fmt.Errorf("missing ) after the arguments of %s", name)
+	}
+	if fn.arity >= 0 && len(args) != fn.arity {
+		return value{}, fmt.Errorf("%s takes %d argument(s)", name, fn.arity)
+	}
+	if len(args) == 0 {
+		return value{}, fmt.Errorf("%s takes at least one argument", name)
+	}
+	return value{num: fn.call(args)}, nil
+}
+
+type function struct {
+	arity int // -1 for any number of arguments
+	call  func([]float64) float64
+}
+
+func unary(f func(float64) float64) function {
+	return function{arity: 1, call: func(a []float64) float64 { return f(a[0]) }}
+}
+
+var functions = map[string]function{
+	"sqrt":  unary(math.Sqrt),
+	"cbrt":  unary(math.Cbrt),
+	"abs":   unary(math.Abs),
+	"floor": unary(math.Floor),
+	"ceil":  unary(math.Ceil),
+	"round": unary(math.Round),
+	"exp":   unary(math.Exp),
+	"ln":    unary(math.Log),
+	"log":   unary(math.Log10),
+	"log2":  unary(math.Log2),
+	"sin":   unary(math.Sin),
+	"cos":   unary(math.Cos),
+	"tan":   unary(math.Tan),
+	"asin":  unary(math.Asin),
+	"acos":  unary(math.Acos),
+	"atan":  unary(math.Atan),
+	"pow":   {arity: 2, call: func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"min": {arity: -1, call: func(a []float64) float64 {
+		m := a[0]
+		for _, n := range a[1:] {
+			m = math.Min(m, n)
+		}
+		return m
+	}},
+	"max": {arity: -1, call: func(a []float64) float64 {
+		m := a[0]
+		for _, n := range a[1:] {
+			m = math.Max(m, n)
+		}
+		return m
+	}},
+}
+
+func addValues(a, b value, subtract bool) (value, error) {
+	sign := 1.0
+	if subtract {
+		sign = -1
+	}
+	switch {
+	case a.date != nil && b.date != nil:
+		if !subtract {
+			return value{}, fmt.Errorf("cannot add two dates")
+		}
+		days := units["days"]
+		return value{num: a.date.Sub(*b.date).Hours() / 24, unit: &days}, nil
+	case a.date != nil:
+		return addToDate(*a.date, b, sign)
+	case b.date != nil:
+		if subtract {
+			return value{}, fmt.Errorf("cannot subtract a date from %s", a)
+		}
+		return addToDate(*b.date, a, 1)
+	case a.unit == nil && b.unit == nil:
+		return value{num: a.num + sign*b.num}, nil
+	case a.unit == nil || b.unit == nil:
+		return value{}, fmt.Errorf("cannot add %s and %s", a, b)
+	}
+	converted, err := b.convert(a.unit)
+	if err != nil {
+		return value{}, err
+	}
+	return value{num: a.num + sign*converted.num, unit: a.unit}, nil
+}
+
+// addToDate adds whole months and years as calendar months and years, and
+// anything else as a duration.
+func addToDate(d time.Time, v value, sign float64) (value, error) {
+	if v.unit == nil || v.unit.dimension != "time" {
+		return value{}, fmt.Errorf("only durations such as 3 days can be added to a date, got %s", v)
+	}
+	n := sign * v.num
+	var result time.Time
+	switch {
+	case v.unit.name == "months" && n == math.Trunc(n):
+		result = d.AddDate(0, int(n), 0)
+	case v.unit.name == "years" && n == math.Trunc(n):
+		result = d.AddDate(int(n), 0, 0)
+	default:
+		result = d.Add(time.Duration(n * v.unit.factor * float64(time.Second)))
+	}
+	return value{date: &result}, nil
+}
+
+func mulValues(a, b value, op string) (value, error) {
+	if a.date != nil || b.date != nil {
+		return value{}, fmt.Errorf("dates can only be added to or subtracted from")
+	}
+	switch op {
+	case "*":
+		if a.unit != nil && b.unit != nil {
+			return value{}, fmt.Errorf("cannot multiply %s by %s", a, b)
+		}
+		u := a.unit
+		if u == nil {
+			u = b.unit
+		}
+		return value{num: a.num * b.num, unit: u}, nil
+	case "/":
+		if b.num == 0 {
+			return value{}, fmt.Errorf("division by zero")
+		}
+		switch {
+		case b.unit == nil:
+			return value{num: a.num / b.num, unit: a.unit}, nil
+		case a.unit == nil:
+			return value{}, fmt.Errorf("cannot divide %s by %s", a, b)
+		}
+		converted, err := b.convert(a.unit)
+		if err != nil {
+			return value{}, err
+		}
+		return value{num: a.num / converted.num}, nil
+	default:
+		if a.unit != nil || b.unit != nil {
+			return value{}, fmt.Errorf("%% takes plain numbers")
+		}
+		if b.num == 0 {
+			return value{}, fmt.Errorf("division by zero")
+		}
+		return value{num: math.Mod(a.num, b.num)}, nil
+	}
+}
@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2024, 3, 1, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"2 ^ 3 ^ 2", "512"},
+		{"-2 ^ 2", "-4"},
+		{"0.1 + 0.2", "0.3"},
+		{"10 / 4", "2.5"},
+		{"10 % 4", "2"},
+		{"1_000_000 * 1.5e3", "1500000000"},
+		{"sqrt(16) + max(1, 5, 3)", "9"},
+		{"round(pi * 100) / 100", "3.14"},
+		{"5 km + 300 m", "5.3 km"},
+		{"5 km to mi", "3.10685596119 mi"},
+		{"100 °C to F", "212 F"},
+		{"98.6 F in C", "37 C"},
+		{"3 GiB to MB", "3221.225472 MB"},
+		{"90 km/h to m/s", "25 m/s"},
+		{"2 * 3 hours to min", "360 min"},
+		{"6 km / 2 km", "3"},
+		{"2024-03-01 + 45 days", "2024-04-15 (Monday)"},
+		{"2024-01-31 + 1 month", "2024-03-02 (Saturday)"},
+		{"2024-12-25 - 2024-01-01", "359 days"},
+		{"today - 1 week", "2024-02-23 (Friday)"},
+		{"now + 90 min", "2024-03-01T16:34:05Z"},
+	}
+	for _, tt := range tests {
+		got, err := evaluate(tt.expr, now)
+		if err != nil || got != tt.want {
+			t.Errorf("evaluate(%q) = %q, %v, want %q", tt.expr, got, err, tt.want)
+		}
+	}
+
+	for _, expr := range []string{
+		"", "1 +", "(1 + 2", "1 / 0", "5 km + 3 kg", "5 km to kg", "2024-01-01 + 2024-01-02",
+		"2024-01-01 * 2", "2 km ^ 2", "foo(1)", "os.exit(1)", "sqrt(1, 2)", "10 ^ 400", "1 $ 2",
+	} {
+		if got, err := evaluate(expr, now); err == nil {
+			t.Errorf("evaluate(%q) = %q, want an error", expr, got)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/memory"
 	providers "github.com/Bajahaw/ai-ui/cmd/providers"
 	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
 	logger "github.com/charmbracelet/log"
@@ -20,6 +21,7 @@ var (
 	files             fs.Repository
 	settings          stngs.Repository
 	providerRepo      providers.Repository
+	memories          memory.Repository
 )
 
 func SetUpTools(l *logger.Logger, database *sql.DB) {
@@ -34,6 +36,7 @@ func SetUpTools(l *logger.Logger, database *sql.DB) {
 	files = fs.NewRepository(db)
 	settings = stngs.NewRepository(db)
 	providerRepo = providers.NewRepository(db)
+	memories = memory.NewRepository(db)
 
 	// // might get unique constraint error but that's fine
 	// _ = mcpRepo.SaveMCPServer(MCPServer{
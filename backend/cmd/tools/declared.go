@@ -0,0 +1,162 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// DeclaredMCPServer is an MCP server set up by the deployment instead of in
+// the UI. It is added to every user, or only to Users when set.
+type DeclaredMCPServer struct {
+	Name     string            `yaml:"name"`
+	Endpoint string            `yaml:"endpoint"`
+	APIKey   string            `yaml:"api_key"`
+	Headers  map[string]string `yaml:"headers"`
+	Users    []string          `yaml:"users"`
+}
+
+var (
+	declaredMu  sync.RWMutex
+	declaredMCP []DeclaredMCPServer
+)
+
+var invalidIDChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// DeclareMCPServers replaces the declared MCP servers and syncs them into
+// every user. It returns what it changes, or with dryRun what it would
+// change.
+func DeclareMCPServers(list []DeclaredMCPServer, dryRun bool) ([]string, error) {
+	if err := validateDeclared(list); err != nil {
+		return nil, err
+	}
+
+	changes := make([]string, 0)
+	for _, user := range auth.Usernames() {
+		for _, d := range list {
+			if !declaredFor(d, user) {
+				continue
+			}
+			if change := declaredChange(d, user); change != "" {
+				changes = append(changes, fmt.Sprintf("%s MCP server %s of %s", change, d.Name, user))
+			}
+		}
+	}
+	if dryRun {
+		return changes, nil
+	}
+
+	declaredMu.Lock()
+	declaredMCP = list
+	declaredMu.Unlock()
+	for _, user := range auth.Usernames() {
+		syncDeclared(list, user)
+	}
+	return changes, nil
+}
+
+// SyncDeclaredMCPServers adds the declared MCP servers to a new user.
+func SyncDeclaredMCPServers(user string) {
+	declaredMu.RLock()
+	list := declaredMCP
+	declaredMu.RUnlock()
+
+	syncDeclared(list, user)
+}
+
+func syncDeclared(list []DeclaredMCPServer, user string) {
+	for _, d := range list {
+		if !declaredFor(d, user) {
+			continue
+		}
+		change := declaredChange(d, user)
+		if change == "" {
+			continue
+		}
+
+		server := &MCPServer{
+			ID:       declaredID(d.Name, user),
+			Name:     d.Name,
+			Endpoint: d.Endpoint,
+			APIKey:   d.APIKey,
+			User:     user,
+			Headers:  d.Headers,
+		}
+		var err error
+		if change == "add" {
+			err = mcps.Save(server)
+		} else {
+			err = mcps.Update(server)
+		}
+		if err != nil {
+			log.Error("Error saving declared MCP server", "server", server.ID, "user", user, "err", err)
+			continue
+		}
+
+		// an unreachable server keeps its old tools until it is refreshed
+		fresh, err := GetMCPTools(context.Background(), *server)
+		if err != nil {
+			continue
+		}
+		if err := syncTools(server.ID, fresh); err != nil {
+			log.Error("Error syncing tools of declared MCP server", "server", server.ID, "err", err)
+		}
+	}
+}
+
+func declaredFor(d DeclaredMCPServer, user string) bool {
+	return len(d.Users) == 0 || slices.Contains(d.Users, user)
+}
+
+// declaredChange tells whether syncing d into user adds or updates a
+// server, "" when the user has it as declared.
+func declaredChange(d DeclaredMCPServer, user string) string {
+	existing, err := mcps.GetByID(declaredID(d.Name, user), user)
+	if err != nil {
+		return "add"
+	}
+	if existing.Name == d.Name && existing.Endpoint == d.Endpoint && existing.APIKey == d.APIKey &&
+		maps.Equal(existing.Headers, d.Headers) {
+		return ""
+	}
+	return "update"
+}
+
+// declaredID is the id of a declared server for a user. It stays the same
+// across restarts, so the server is updated instead of added again.
+func declaredID(name string, user string) string {
+	slug := strings.Trim(invalidIDChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	sum := sha256.Sum256([]byte(user))
+	return "declared-" + slug + "-" + hex.EncodeToString(sum[:4])
+}
+
+func validateDeclared(list []DeclaredMCPServer) error {
+	seen := make(map[string]bool)
+	for i := range list {
+		d := &list[i]
+		if d.Name == "" {
+			return fmt.Errorf("MCP server %d needs a name", i+1)
+		}
+		id := declaredID(d.Name, "")
+		if seen[id] {
+			return fmt.Errorf("MCP server %q is declared twice", d.Name)
+		}
+		seen[id] = true
+		if err := utils.ValidateOutboundURL(d.Endpoint); err != nil {
+			return fmt.Errorf("MCP server %q: endpoint %w", d.Name, err)
+		}
+		if d.Headers == nil {
+			d.Headers = make(map[string]string)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"os"
+	"path"
+	"slices"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func TestDeclareMCPServers(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	log = logger.New(os.Stdout)
+	auth.Setup(log, db)
+	tools = NewToolRepository(db)
+	mcps = NewMCPRepository(db, tools)
+
+	for _, stmt := range []string{
+		"INSERT INTO Users (username, pass_hash) VALUES ('alice', 'hash'), ('bob', 'hash')",
+		"INSERT INTO MCPServers (id, name, endpoint, api_key, user, headers_json) VALUES ('" +
+			declaredID("Search", "alice") + "', 'Search', 'https://search.example.com/mcp', 'old', 'alice', '{}')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	list := []DeclaredMCPServer{
+		{Name: "Search", Endpoint: "https://search.example.com/mcp", APIKey: "new"},
+		{Name: "Wiki", Endpoint: "https://wiki.example.com/mcp", Users: []string{"bob"}},
+	}
+	changes, err := DeclareMCPServers(list, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"update MCP server Search of alice", "add MCP server Search of bob", "add MCP server Wiki of bob"}
+	if !slices.Equal(changes, want) {
+		t.Errorf("expected %q, got %q", want, changes)
+	}
+	if server, _ := mcps.GetByID(declaredID("Search", "alice"), "alice"); server.APIKey != "old" {
+		t.Errorf("dry run updated the server: %+v", server)
+	}
+
+	if _, err := DeclareMCPServers(append(list, DeclaredMCPServer{Name: "search", Endpoint: "https://x.example.com"}), true); err == nil {
+		t.Error("expected an error for a server declared twice")
+	}
+	if _, err := DeclareMCPServers([]DeclaredMCPServer{{Name: "Bad", Endpoint: "ftp://x"}}, true); err == nil {
+		t.Error("expected an error for a bad endpoint")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"mime"
 	"os"
 	"path"
 	"strconv"
@@ -63,7 +64,7 @@ func listDocumentPartsTool(args, user string) providers.ToolOutput {
 	}
 
 	out, _ := json.MarshalIndent(entries, "", "  ")
-	return providers.ToolOutput{Content: string(out)}
+	return providers.ToolOutput{Content: string(out), Type: providers.OutputTable}
 }
 
 // ── read_document_part ──────────────────────────────────────────────────
@@ -741,6 +742,10 @@ func saveGeneratedFile(data []byte, fileName, user string) (fs.File, error) {
 		mimeType = "image/jpeg"
 	case ".webp":
 		mimeType = "image/webp"
+	default:
+		if t := mime.TypeByExtension(ext); t != "" {
+			mimeType = t
+		}
 	}
 
 	now := time.Now().Format(time.RFC3339)
@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+)
+
+// ── read_file ───────────────────────────────────────────────────────────
+
+const (
+	readFileLength    = 20000
+	maxReadFileLength = 50000
+)
+
+// readFileTool returns the extracted text of a file attached in the
+// conversation, a range of its pages or a slice of its characters, so long
+// documents can be read in parts.
+func readFileTool(args, convID string) providers.ToolOutput {
+	var params struct {
+		FileID    string `json:"file_id"`
+		StartPage int    `json:"start_page"`
+		EndPage   int    `json:"end_page"`
+		Offset    int    `json:"offset"`
+		Length    int    `json:"length"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return providers.ToolOutput{Content: fmt.Sprintf("error decoding arguments: %v", err)}
+	}
+	if params.Offset < 0 || params.Length < 0 {
+		return providers.ToolOutput{Content: "error: offset and length must not be negative"}
+	}
+
+	file, ok := conversationFile(params.FileID, convID)
+	if !ok {
+		return providers.ToolOutput{Content: fmt.Sprintf("error: no file with id %s is attached to this conversation", params.FileID)}
+	}
+
+	var text string
+	if params.StartPage > 0 || params.EndPage > 0 {
+		end := params.EndPage
+		if end == 0 {
+			end = params.StartPage
+		}
+		if params.StartPage < 1 || params.StartPage > end {
+			return providers.ToolOutput{Content: "error: start_page must be at least 1 and not after end_page"}
+		}
+		pages, err := files.GetPagesRange(file.ID, params.StartPage, end)
+		if err != nil {
+			return providers.ToolOutput{Content: fmt.Sprintf("error reading document pages: %v", err)}
+		}
+		if len(pages) == 0 {
+			return providers.ToolOutput{Content: "No pages found in the specified range, the file may not have pages."}
+		}
+		text = pagesText(pages)
+	} else {
+		var err error
+		if text, err = fileText(file); err != nil {
+			return providers.ToolOutput{Content: fmt.Sprintf("error reading file: %v", err)}
+		}
+	}
+	if text == "" {
+		return providers.ToolOutput{Content: fmt.Sprintf("No text could be extracted from %s (%s).", file.Name, file.Type)}
+	}
+
+	length := params.Length
+	if length == 0 {
+		length = readFileLength
+	}
+	length = min(length, maxReadFileLength)
+
+	total := utf8.RuneCountInString(text)
+	if params.Offset >= total {
+		return providers.ToolOutput{Content: fmt.Sprintf("error: offset %d is past the end of the text (%d characters)", params.Offset, total)}
+	}
+	runes := []rune(text)
+	end := min(params.Offset+length, total)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "%s, characters %d-%d of %d", file.Name, params.Offset, end, total)
+	if end < total {
+		fmt.Fprintf(&out, ", call again with offset %d for more", end)
+	}
+	out.WriteString(":\n\n")
+	out.WriteString(string(runes[params.Offset:end]))
+	return providers.ToolOutput{Content: out.String()}
+}
+
+// conversationFile finds a file attached to a message of the conversation.
+func conversationFile(fileID, convID string) (fs.File, bool) {
+	for _, attachments := range files.GetAllConversationAttachments(convID) {
+		for _, att := range attachments {
+			if att.File.ID == fileID {
+				return att.File, true
+			}
+		}
+	}
+	return fs.File{}, false
+}
+
+// fileText returns all the text of a file: its pages, the content extracted
+// on upload or, for text files, the file itself.
+func fileText(file fs.File) (string, error) {
+	pages, err := files.GetPagesRange(file.ID, 1, math.MaxInt32)
+	if err != nil {
+		return "", err
+	}
+	if len(pages) > 0 {
+		return pagesText(pages), nil
+	}
+	if file.Content != "" || !isTextFile(file.Type) {
+		return file.Content, nil
+	}
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToValidUTF8(string(data), "\uFFFD"), nil
+}
+
+func pagesText(pages []fs.FilePage) string {
+	var text strings.Builder
+	for _, page := range pages {
+		fmt.Fprintf(&text, "@Page %d:\n%s\n\n", page.PageNumber, page.Content)
+	}
+	return text.String()
+}
+
+func isTextFile(mimeType string) bool {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	return strings.HasPrefix(mimeType, "text/") || mimeType == "application/json" ||
+		mimeType == "application/xml" || strings.HasSuffix(mimeType, "+json") || strings.HasSuffix(mimeType, "+xml")
+}
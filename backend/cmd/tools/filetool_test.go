@@ -0,0 +1,69 @@
+package tools
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+)
+
+func TestReadFileTool(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	files = fs.NewRepository(db)
+
+	notes := path.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(notes, []byte("héllo world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		"INSERT INTO Users (username, pass_hash) VALUES ('testuser', 'hash')",
+		"INSERT INTO Conversations (id, user) VALUES ('conv', 'testuser'), ('other', 'testuser')",
+		"INSERT INTO Messages (id, conv_id, role, model, content) VALUES (1, 'conv', 'user', '', 'read these'), (2, 'other', 'user', '', '')",
+		"INSERT INTO Files (id, name, type, size, path, url, content, user) VALUES " +
+			"('doc', 'report.pdf', 'application/pdf', 1, 'x', '', 'first page only', 'testuser'), " +
+			"('notes', 'notes.txt', 'text/plain', 1, '" + notes + "', '', '', 'testuser'), " +
+			"('secret', 'secret.txt', 'text/plain', 1, 'x', '', 'secret', 'testuser')",
+		"INSERT INTO Attachments (id, message_id, file_id) VALUES ('a1', 1, 'doc'), ('a2', 1, 'notes'), ('a3', 2, 'secret')",
+		"INSERT INTO FilePages (id, file_id, page_number, content) VALUES ('p1', 'doc', 1, 'Intro'), ('p2', 'doc', 2, 'Results'), ('p3', 'doc', 3, 'Appendix')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		args string
+		want []string
+		not  []string
+	}{
+		{"all pages", `{"file_id": "doc"}`, []string{"@Page 1:\nIntro", "@Page 3:\nAppendix"}, []string{"first page only", "call again"}},
+		{"page range", `{"file_id": "doc", "start_page": 2, "end_page": 2}`, []string{"@Page 2:\nResults"}, []string{"Intro", "Appendix"}},
+		{"characters", `{"file_id": "notes", "offset": 1, "length": 4}`, []string{"notes.txt, characters 1-5 of 11, call again with offset 5", "éllo"}, []string{"world"}},
+		{"other conversation", `{"file_id": "secret"}`, []string{"no file with id secret"}, []string{"secret.txt"}},
+		{"past the end", `{"file_id": "notes", "offset": 11}`, []string{"past the end"}, nil},
+		{"bad range", `{"file_id": "doc", "start_page": 3, "end_page": 2}`, []string{"error:"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := readFileTool(tt.args, "conv").Content
+			for _, s := range tt.want {
+				if !strings.Contains(out, s) {
+					t.Errorf("expected %q in %q", s, out)
+				}
+			}
+			for _, s := range tt.not {
+				if strings.Contains(out, s) {
+					t.Errorf("did not expect %q in %q", s, out)
+				}
+			}
+		})
+	}
+}
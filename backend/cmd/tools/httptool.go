@@ -0,0 +1,406 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/audit"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// HTTPTemplate is the request an HTTP tool makes. {name} placeholders in URL
+// are replaced by the arguments of the call, a query pair whose argument is
+// missing is left out. The other arguments are sent as query parameters of
+// GET and DELETE requests and as a JSON body of the others. A URL starting
+// with / is relative to the endpoint of its server.
+type HTTPTemplate struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+// HTTP tools belong to servers whose id starts with httpServerPrefix. The
+// server holds the base URL, key and headers its tools share.
+const httpServerPrefix = "http-"
+
+const (
+	httpToolTimeout = time.Minute
+	// maxHTTPToolOutput is the most of a response given to the model
+	maxHTTPToolOutput = 100_000
+	maxOpenAPISpec    = 5 << 20
+)
+
+var httpToolClient = &http.Client{Timeout: httpToolTimeout, Transport: utils.Outbound}
+
+var placeholder = regexp.MustCompile(`\{([a-zA-Z0-9_.-]+)\}`)
+
+var httpMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+type HTTPToolRequest struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	InputSchema json.RawMessage `json:"input_schema,omitempty"`
+}
+
+type HTTPServerRequest struct {
+	ID      string            `json:"id,omitempty"`
+	Name    string            `json:"name"`
+	BaseURL string            `json:"base_url"`
+	APIKey  string            `json:"api_key"`
+	Headers map[string]string `json:"headers"`
+	Tools   []HTTPToolRequest `json:"tools"`
+}
+
+type OpenAPIImportRequest struct {
+	// ID replaces the tools of an earlier import.
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	// Spec is an OpenAPI 3 document in JSON or YAML, or SpecURL where to
+	// get it.
+	Spec    string `json:"spec,omitempty"`
+	SpecURL string `json:"spec_url,omitempty"`
+	// BaseURL replaces the first server of the spec.
+	BaseURL string            `json:"base_url,omitempty"`
+	APIKey  string            `json:"api_key"`
+	Headers map[string]string `json:"headers"`
+	// Operations limits the import to these operation ids.
+	Operations []string `json:"operations,omitempty"`
+}
+
+func saveHTTPServer(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req HTTPServerRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	respondWithHTTPServer(w, r, user, req)
+}
+
+func importOpenAPI(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req OpenAPIImportRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	spec := []byte(req.Spec)
+	if req.SpecURL != "" {
+		var err error
+		if spec, err = fetchSpec(req.SpecURL); err != nil {
+			utils.Error(w, "spec_url "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if len(spec) == 0 {
+		utils.Error(w, "spec or spec_url is required", http.StatusBadRequest)
+		return
+	}
+
+	server, err := openAPITools(spec, req.SpecURL, req.Operations)
+	if err != nil {
+		utils.Error(w, "Invalid OpenAPI spec: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	server.ID = req.ID
+	server.APIKey = req.APIKey
+	server.Headers = req.Headers
+	if req.Name != "" {
+		server.Name = req.Name
+	}
+	if req.BaseURL != "" {
+		server.BaseURL = req.BaseURL
+	}
+	respondWithHTTPServer(w, r, user, server)
+}
+
+func respondWithHTTPServer(w http.ResponseWriter, r *http.Request, user string, req HTTPServerRequest) {
+	server, err := httpServer(req, user)
+	if err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var before *MCPServer
+	if req.ID != "" {
+		if before, err = mcps.GetByID(req.ID, user); err != nil || !strings.HasPrefix(req.ID, httpServerPrefix) {
+			utils.Error(w, "HTTP tool server not found", http.StatusNotFound)
+			return
+		}
+		err = mcps.Update(server)
+	} else {
+		err = mcps.Save(&MCPServer{ID: server.ID, Name: server.Name, Endpoint: server.Endpoint, APIKey: server.APIKey, User: user, Headers: server.Headers})
+	}
+	if err == nil {
+		err = syncTools(server.ID, server.Tools)
+	}
+	if err != nil {
+		log.Error("Error saving HTTP tools", "err", err)
+		utils.Error(w, "Error saving HTTP tools", http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, user, audit.MCPSave, server.ID, audit.Diff(mcpAuditView(before), mcpAuditView(server)))
+
+	utils.RespondWithJSON(w, MCPServerResponse{
+		ID:       server.ID,
+		Name:     server.Name,
+		Endpoint: server.Endpoint,
+		Tools:    tools.GetAllByMCPServerID(server.ID),
+		Headers:  server.Headers,
+	}, http.StatusOK)
+}
+
+// httpServer checks req and turns it into a server with its tools.
+func httpServer(req HTTPServerRequest, user string) (*MCPServer, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if len(req.Tools) == 0 {
+		return nil, fmt.Errorf("at least one tool is required")
+	}
+	if req.BaseURL != "" {
+		if err := utils.ValidateOutboundURL(req.BaseURL); err != nil {
+			return nil, fmt.Errorf("base_url %w", err)
+		}
+	}
+
+	id := req.ID
+	if id == "" {
+		id = httpServerPrefix + uuid.NewString()
+	}
+	server := &MCPServer{ID: id, Name: req.Name, Endpoint: req.BaseURL, APIKey: req.APIKey, User: user, Headers: req.Headers}
+	seen := make(map[string]bool)
+	for _, t := range req.Tools {
+		if !validToolName.MatchString(t.Name) {
+			return nil, fmt.Errorf("invalid tool name %q", t.Name)
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("tool %s is declared twice", t.Name)
+		}
+		seen[t.Name] = true
+
+		method := strings.ToUpper(t.Method)
+		if method == "" {
+			method = http.MethodGet
+		}
+		if !slices.Contains(httpMethods, method) {
+			return nil, fmt.Errorf("tool %s: method must be one of %s", t.Name, strings.Join(httpMethods, ", "))
+		}
+		if err := checkTemplateURL(t.URL, req.BaseURL); err != nil {
+			return nil, fmt.Errorf("tool %s: %w", t.Name, err)
+		}
+
+		schema := string(t.InputSchema)
+		if schema == "" || schema == "null" {
+			schema = placeholderSchema(t.URL)
+		}
+		var object map[string]any
+		if err := json.Unmarshal([]byte(schema), &object); err != nil {
+			return nil, fmt.Errorf("tool %s: input_schema must be a JSON object", t.Name)
+		}
+
+		server.Tools = append(server.Tools, &Tool{
+			ID:          uuid.NewString(),
+			MCPServerID: id,
+			Name:        t.Name,
+			Description: t.Description,
+			InputSchema: schema,
+			IsEnabled:   true,
+			Type:        ToolTypeHTTP,
+			HTTP:        &HTTPTemplate{Method: method, URL: t.URL},
+		})
+	}
+	return server, nil
+}
+
+// checkTemplateURL makes sure the host of a tool is fixed, so a model
+// cannot choose where a call goes.
+func checkTemplateURL(template, baseURL string) error {
+	if strings.HasPrefix(template, "/") {
+		if baseURL == "" {
+			return fmt.Errorf("url %s is relative but there is no base_url", template)
+		}
+		return nil
+	}
+	_, host, _ := strings.Cut(template, "://")
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	if strings.ContainsAny(host, "{}") {
+		return fmt.Errorf("url cannot have placeholders in its host")
+	}
+	u, err := url.Parse(placeholder.ReplaceAllString(template, "x"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an http or https URL or a path")
+	}
+	return utils.ValidateOutboundURL(u.String())
+}
+
+// placeholderSchema asks for every placeholder of a URL as a string.
+func placeholderSchema(template string) string {
+	properties := make(map[string]any)
+	required := make([]string, 0)
+	for _, m := range placeholder.FindAllStringSubmatch(template, -1) {
+		properties[m[1]] = map[string]string{"type": "string"}
+		required = append(required, m[1])
+	}
+	schema, _ := json.Marshal(map[string]any{"type": "object", "properties": properties, "required": required})
+	return string(schema)
+}
+
+func fetchSpec(raw string) ([]byte, error) {
+	if err := utils.ValidateOutboundURL(raw); err != nil {
+		return nil, err
+	}
+	resp, err := httpToolClient.Get(raw)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("answered %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxOpenAPISpec))
+}
+
+// httpTool runs an HTTP tool of server.
+func httpTool(ctx context.Context, tool *Tool, server *MCPServer, args string) providers.ToolOutput {
+	if tool.HTTP == nil {
+		return providers.ToolOutput{Content: "error: the tool has no request", Code: apierr.ToolFailed}
+	}
+	values := make(map[string]any)
+	if strings.TrimSpace(args) != "" {
+		if err := json.Unmarshal([]byte(args), &values); err != nil {
+			return providers.ToolOutput{Content: "Error parsing tool arguments."}
+		}
+	}
+
+	req, err := httpToolRequest(tool.HTTP, server, values)
+	if err != nil {
+		return providers.ToolOutput{Content: "error: " + err.Error(), Code: apierr.ToolFailed}
+	}
+	req = req.WithContext(ctx)
+	log.Debug("Executing HTTP tool", "tool", tool.Name, "method", req.Method, "url", req.URL.Redacted())
+
+	resp, err := httpToolClient.Do(req)
+	if err != nil {
+		log.Error("Error calling HTTP tool", "tool", tool.Name, "err", err)
+		return providers.ToolOutput{Content: "Error calling " + req.URL.Host, Code: toolErrorCode(err)}
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxHTTPToolOutput+1))
+	content := string(body)
+	if len(body) > maxHTTPToolOutput {
+		content = string(body[:maxHTTPToolOutput]) + "\n[truncated]"
+	}
+	if resp.StatusCode >= 300 {
+		return providers.ToolOutput{Content: fmt.Sprintf("error: %s\n\n%s", resp.Status, content), Code: apierr.ToolFailed}
+	}
+	return providers.ToolOutput{Content: content}
+}
+
+// httpToolRequest fills in the template of a tool with values.
+func httpToolRequest(template *HTTPTemplate, server *MCPServer, values map[string]any) (*http.Request, error) {
+	used := make(map[string]bool)
+	fill := func(s string, escape func(string) string) (string, bool) {
+		missing := false
+		s = placeholder.ReplaceAllStringFunc(s, func(m string) string {
+			name := m[1 : len(m)-1]
+			v, ok := values[name]
+			if !ok || v == nil {
+				missing = true
+				return ""
+			}
+			used[name] = true
+			return escape(argString(v))
+		})
+		return s, missing
+	}
+
+	raw := template.URL
+	if strings.HasPrefix(raw, "/") {
+		raw = strings.TrimSuffix(server.Endpoint, "/") + raw
+	}
+	path, rawQuery, _ := strings.Cut(raw, "?")
+	path, missing := fill(path, url.PathEscape)
+	if missing {
+		return nil, fmt.Errorf("missing arguments for %s", template.URL)
+	}
+	pairs := make([]string, 0)
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		if filled, missing := fill(pair, url.QueryEscape); !missing {
+			pairs = append(pairs, filled)
+		}
+	}
+
+	rest := make(map[string]any)
+	for name, v := range values {
+		if !used[name] {
+			rest[name] = v
+		}
+	}
+	var body io.Reader
+	if template.Method == http.MethodGet || template.Method == http.MethodDelete {
+		for _, name := range slices.Sorted(maps.Keys(rest)) {
+			pairs = append(pairs, url.QueryEscape(name)+"="+url.QueryEscape(argString(rest[name])))
+		}
+	} else if len(rest) > 0 {
+		b, _ := json.Marshal(rest)
+		body = bytes.NewReader(b)
+	}
+	if len(pairs) > 0 {
+		path += "?" + strings.Join(pairs, "&")
+	}
+
+	if err := utils.ValidateOutboundURL(path); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(template.Method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json, text/plain;q=0.9, */*;q=0.8")
+	if server.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+server.APIKey)
+	}
+	for k, v := range server.Headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// argString is how an argument is written into a URL.
+func argString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
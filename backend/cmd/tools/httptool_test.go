@@ -0,0 +1,176 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func TestHTTPTool(t *testing.T) {
+	log = logger.New(os.Stdout)
+	var got *http.Request
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			http.Error(w, "no such order", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	t.Cleanup(srv.Close)
+	server := &MCPServer{Endpoint: srv.URL + "/v1", APIKey: "secret", Headers: map[string]string{"X-Team": "a"}}
+
+	tool := &Tool{Name: "get_order", Type: ToolTypeHTTP, HTTP: &HTTPTemplate{Method: http.MethodGet, URL: "/orders/{id}?verbose={verbose}"}}
+	out := httpTool(t.Context(), tool, server, `{"id": "a b/c", "page": 2}`)
+	if out.Content != `{"ok": true}` {
+		t.Fatalf("unexpected output %q", out.Content)
+	}
+	if got.URL.EscapedPath() != "/v1/orders/a%20b%2Fc" || got.URL.RawQuery != "page=2" {
+		t.Errorf("unexpected request %s", got.URL)
+	}
+	if got.Header.Get("Authorization") != "Bearer secret" || got.Header.Get("X-Team") != "a" {
+		t.Errorf("unexpected headers %v", got.Header)
+	}
+
+	tool.HTTP = &HTTPTemplate{Method: http.MethodPost, URL: srv.URL + "/orders?dry={dry}"}
+	httpTool(t.Context(), tool, server, `{"dry": true, "items": ["x"]}`)
+	if got.URL.RawQuery != "dry=true" || body != `{"items":["x"]}` {
+		t.Errorf("unexpected request %s with body %s", got.URL, body)
+	}
+
+	tool.HTTP = &HTTPTemplate{Method: http.MethodGet, URL: "/missing"}
+	if out := httpTool(t.Context(), tool, server, `{}`); !strings.HasPrefix(out.Content, "error: 404") || !strings.Contains(out.Content, "no such order") {
+		t.Errorf("expected the error of the API, got %q", out.Content)
+	}
+	tool.HTTP = &HTTPTemplate{Method: http.MethodGet, URL: "/orders/{id}"}
+	if out := httpTool(t.Context(), tool, server, `{}`); !strings.Contains(out.Content, "missing arguments") {
+		t.Errorf("expected missing arguments, got %q", out.Content)
+	}
+}
+
+func TestHTTPServerValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		req  HTTPServerRequest
+		err  string
+	}{
+		{"placeholder host", HTTPServerRequest{Name: "x", Tools: []HTTPToolRequest{{Name: "t", URL: "https://{host}/a"}}}, "placeholders in its host"},
+		{"relative without base", HTTPServerRequest{Name: "x", Tools: []HTTPToolRequest{{Name: "t", URL: "/a"}}}, "no base_url"},
+		{"bad method", HTTPServerRequest{Name: "x", BaseURL: "https://api.example.com", Tools: []HTTPToolRequest{{Name: "t", Method: "TRACE", URL: "/a"}}}, "method must be"},
+		{"duplicate", HTTPServerRequest{Name: "x", BaseURL: "https://api.example.com", Tools: []HTTPToolRequest{{Name: "t", URL: "/a"}, {Name: "t", URL: "/b"}}}, "declared twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := httpServer(tt.req, "alice"); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected error with %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	server, err := httpServer(HTTPServerRequest{Name: "x", BaseURL: "https://api.example.com", Tools: []HTTPToolRequest{{Name: "t", URL: "/users/{id}"}}}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tool := server.Tools[0]; tool.HTTP.Method != http.MethodGet || !strings.Contains(tool.InputSchema, `"required":["id"]`) {
+		t.Errorf("unexpected tool %+v", tool)
+	}
+}
+
+const petstore = `
+openapi: 3.0.0
+info: {title: Petstore}
+servers: [{url: /api}]
+paths:
+  /pets/{petId}:
+    parameters:
+      - {name: petId, in: path, required: true, schema: {type: integer}}
+    get:
+      operationId: showPet
+      summary: Info for a pet
+      parameters:
+        - $ref: '#/components/parameters/fields'
+        - {name: X-Trace, in: header, schema: {type: string}}
+  /pets:
+    post:
+      operationId: create pet
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/Pet'}
+components:
+  parameters:
+    fields: {name: fields, in: query, description: Fields to return, schema: {type: string}}
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        name: {type: string}
+        owner: {$ref: '#/components/schemas/Pet'}
+`
+
+func TestOpenAPITools(t *testing.T) {
+	server, err := openAPITools([]byte(petstore), "https://pets.example.com/spec.yaml", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Name != "Petstore" || server.BaseURL != "https://pets.example.com/api" || len(server.Tools) != 2 {
+		t.Fatalf("unexpected server %+v", server)
+	}
+
+	create, show := server.Tools[0], server.Tools[1]
+	if show.Name != "showPet" || show.Method != http.MethodGet || show.URL != "/pets/{petId}?fields={fields}" || show.Description != "Info for a pet" {
+		t.Errorf("unexpected tool %+v", show)
+	}
+	var schema struct {
+		Properties map[string]map[string]any `json:"properties"`
+		Required   []string                  `json:"required"`
+	}
+	json.Unmarshal(show.InputSchema, &schema)
+	if len(schema.Properties) != 2 || schema.Properties["fields"]["description"] != "Fields to return" || len(schema.Required) != 1 {
+		t.Errorf("unexpected schema %s", show.InputSchema)
+	}
+
+	if create.Name != "create_pet" || create.Method != http.MethodPost || create.URL != "/pets" {
+		t.Errorf("unexpected tool %+v", create)
+	}
+	if !strings.Contains(string(create.InputSchema), `"required":["name"]`) || strings.Contains(string(create.InputSchema), "$ref") {
+		t.Errorf("unexpected schema %s", create.InputSchema)
+	}
+
+	if _, err := openAPITools([]byte(petstore), "", []string{"nope"}); err == nil {
+		t.Error("expected an error when no operation is left")
+	}
+}
+
+func TestHTTPToolStopsWithRequest(t *testing.T) {
+	log = logger.New(os.Stdout)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	tool := &Tool{Name: "slow", Type: ToolTypeHTTP, HTTP: &HTTPTemplate{Method: http.MethodGet, URL: srv.URL + "/slow"}}
+
+	started := time.Now()
+	out := httpTool(ctx, tool, &MCPServer{}, `{}`)
+	if !strings.HasPrefix(out.Content, "Error calling") || time.Since(started) > 5*time.Second {
+		t.Errorf("expected the call to stop with its request, got %q after %s", out.Content, time.Since(started))
+	}
+}
@@ -11,11 +11,10 @@ import (
 	"github.com/Bajahaw/ai-ui/cmd/providers"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 	"github.com/openai/openai-go/v3"
-	"github.com/openai/openai-go/v3/option"
 	"github.com/openai/openai-go/v3/responses"
 )
 
-func generateImageTool(args string, user string, convID string) providers.ToolOutput {
+func generateImageTool(ctx context.Context, args string, user string, convID string) providers.ToolOutput {
 	var params struct {
 		Prompt string `json:"prompt"`
 	}
@@ -39,17 +38,9 @@ func generateImageTool(args string, user string, convID string) providers.ToolOu
 		return providers.ToolOutput{Content: fmt.Sprintf("Error querying provider %s for imageModel: %v. Please select a valid Image Model in settings.", providerID, err)}
 	}
 
-	opts := []option.RequestOption{
-		option.WithAPIKey(provider.APIKey),
-		option.WithBaseURL(provider.BaseURL),
-	}
-	for key, value := range provider.Headers {
-		opts = append(opts, option.WithHeader(key, value))
-	}
-
-	client := openai.NewClient(opts...)
+	client := openai.NewClient(providers.ClientOptions(provider)...)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
 	defer cancel()
 
 	res, err := client.Responses.New(ctx, responses.ResponseNewParams{
@@ -57,7 +48,7 @@ func generateImageTool(args string, user string, convID string) providers.ToolOu
 		Input: responses.ResponseNewParamsInputUnion{
 			OfString: openai.String(params.Prompt),
 		},
-	}, opts...)
+	})
 
 	if err != nil {
 		return providers.ToolOutput{Content: fmt.Sprintf("error generating image: %v", err)}
@@ -110,5 +101,6 @@ func generateImageTool(args string, user string, convID string) providers.ToolOu
 		Content: fmt.Sprintf("Image generated successfully. File ID: %s Name: %s Path: %s",
 			fileData.ID, fileData.Name, fileData.Path,
 		),
+		Type: providers.OutputImageURL,
 	}
 }
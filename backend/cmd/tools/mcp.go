@@ -3,11 +3,15 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/audit"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 
 	"github.com/google/uuid"
@@ -67,7 +71,7 @@ func getMCPServer(w http.ResponseWriter, r *http.Request) {
 	server, err := mcps.GetByID(id, user)
 	if err != nil {
 		log.Error("Error getting MCP server", "err", err)
-		http.Error(w, "MCP server not found", http.StatusNotFound)
+		utils.Error(w, "MCP server not found", http.StatusNotFound)
 		return
 	}
 
@@ -84,6 +88,7 @@ func getMCPServer(w http.ResponseWriter, r *http.Request) {
 func restoreDefaultMCPServer(w http.ResponseWriter, r *http.Request) {
 	user := utils.ExtractContextUser(r)
 	SaveDefaultMCPServer(user)
+	audit.Record(r, user, audit.MCPRestore, "", nil)
 	utils.RespondWithJSON(w, map[string]string{"status": "success"}, http.StatusOK)
 }
 
@@ -93,7 +98,12 @@ func saveMCPServer(w http.ResponseWriter, r *http.Request) {
 	err := utils.ExtractJSONBody(r, &req)
 	if err != nil {
 		log.Error("Error unmarshalling request body", "err", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err = utils.ValidateOutboundURL(req.Endpoint); err != nil {
+		utils.Error(w, "endpoint "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -111,20 +121,26 @@ func saveMCPServer(w http.ResponseWriter, r *http.Request) {
 		Headers:  req.Headers,
 	}
 
-	server.Tools, err = GetMCPTools(server)
+	server.Tools, err = GetMCPTools(r.Context(), server)
 	if err != nil {
 		log.Error("Error getting MCP tools", "err", err)
-		http.Error(w, "Error connecting to MCP server", http.StatusBadRequest)
+		utils.Error(w, "Error connecting to MCP server", http.StatusBadRequest)
 		return
 	}
 
+	var before *MCPServer
+	if req.ID != "" {
+		before, _ = mcps.GetByID(req.ID, user)
+	}
+
 	// Save MCP server does save tools as well
 	err = mcps.Save(&server)
 	if err != nil {
 		log.Error("Error saving MCP server", "err", err)
-		http.Error(w, "Error saving MCP server", http.StatusInternalServerError)
+		utils.Error(w, "Error saving MCP server", http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, user, audit.MCPSave, server.ID, audit.Diff(mcpAuditView(before), mcpAuditView(&server)))
 
 	response := MCPServerResponse{
 		ID:       server.ID,
@@ -143,13 +159,28 @@ func deleteMCPServer(w http.ResponseWriter, r *http.Request) {
 	err := mcps.DeleteByID(id, user)
 	if err != nil {
 		log.Error("Error deleting MCP server", "err", err)
-		http.Error(w, "Error deleting MCP server", http.StatusInternalServerError)
+		utils.Error(w, "Error deleting MCP server", http.StatusInternalServerError)
 		return
 	}
+	audit.Record(r, user, audit.MCPDelete, id, nil)
 
 	utils.RespondWithJSON(w, "MCP server deleted successfully", http.StatusOK)
 }
 
+// mcpAuditView is what the audit log keeps of an MCP server, without the
+// values of its headers.
+func mcpAuditView(s *MCPServer) map[string]any {
+	if s == nil {
+		return nil
+	}
+	return map[string]any{
+		"name":     s.Name,
+		"endpoint": s.Endpoint,
+		"api_key":  s.APIKey,
+		"headers":  slices.Sorted(maps.Keys(s.Headers)),
+	}
+}
+
 func refreshMCPTools(w http.ResponseWriter, r *http.Request) {
 	user := utils.ExtractContextUser(r)
 	id := r.PathValue("id")
@@ -157,7 +188,12 @@ func refreshMCPTools(w http.ResponseWriter, r *http.Request) {
 	server, err := mcps.GetByID(id, user)
 	if err != nil {
 		log.Error("MCP server not found", "err", err)
-		http.Error(w, "MCP server not found", http.StatusNotFound)
+		utils.Error(w, "MCP server not found", http.StatusNotFound)
+		return
+	}
+
+	if strings.HasPrefix(server.ID, httpServerPrefix) {
+		utils.Error(w, "HTTP tools change when they are saved again", http.StatusBadRequest)
 		return
 	}
 
@@ -171,16 +207,28 @@ func refreshMCPTools(w http.ResponseWriter, r *http.Request) {
 		}
 	} else {
 		var fetchErr error
-		freshTools, fetchErr = GetMCPTools(*server)
+		freshTools, fetchErr = GetMCPTools(r.Context(), *server)
 		if fetchErr != nil {
 			log.Error("Error fetching tools from MCP server", "err", fetchErr)
-			http.Error(w, "Failed to fetch tools from MCP server", http.StatusBadGateway)
+			utils.RespondWithError(w, apierr.ToolFailed, "Failed to fetch tools from MCP server", http.StatusBadGateway)
 			return
 		}
 	}
 
+	if err = syncTools(server.ID, freshTools); err != nil {
+		log.Error("Error syncing refreshed tools", "err", err)
+		utils.Error(w, "Error saving tools", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// syncTools replaces the tools of an MCP server with freshTools, keeping the
+// IDs and user-set flags of the tools it already had.
+func syncTools(serverID string, freshTools []*Tool) error {
 	// Build map of existing tools keyed by name to preserve IDs and user-set flags
-	existingTools := tools.GetAllByMCPServerID(server.ID)
+	existingTools := tools.GetAllByMCPServerID(serverID)
 	existingMap := make(map[string]*Tool, len(existingTools))
 	for _, t := range existingTools {
 		existingMap[t.Name] = t
@@ -198,24 +246,18 @@ func refreshMCPTools(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Upsert all fields (including schema/description changes) with correct state values
-	if err = tools.UpsertAll(freshTools); err != nil {
-		log.Error("Error saving refreshed tools", "err", err)
-		http.Error(w, "Error saving tools", http.StatusInternalServerError)
-		return
+	if err := tools.UpsertAll(freshTools); err != nil {
+		return err
 	}
 
 	// Remove stale tools that no longer exist on the MCP server
-	if err = tools.DeleteNotIn(server.ID, newToolIDs); err != nil {
-		log.Error("Error deleting stale tools", "err", err)
-		http.Error(w, "Error cleaning up stale tools", http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusNoContent)
+	return tools.DeleteNotIn(serverID, newToolIDs)
 }
 
-func GetMCPTools(server MCPServer) ([]*Tool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+// GetMCPTools lists the tools of an MCP server, for at most a minute and
+// until ctx is done.
+func GetMCPTools(ctx context.Context, server MCPServer) ([]*Tool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
 	client := mcp.NewClient(&mcp.Implementation{Name: "mcp-client", Version: "2025-11-25"}, nil)
@@ -328,7 +370,7 @@ func httpClientWithCustomHeaders(headers map[string]string) *http.Client {
 	return &http.Client{
 		Transport: &acceptHeaderRoundTripper{
 			extraHeaders: headers,
-			delegate:     http.DefaultTransport,
+			delegate:     utils.Outbound,
 		},
 	}
 }
@@ -9,6 +9,7 @@ type MCPServerRepository interface {
 	GetAll(user string) []*MCPServer
 	GetByID(id string, user string) (*MCPServer, error)
 	Save(server *MCPServer) error
+	Update(server *MCPServer) error
 	DeleteByID(id string, user string) error
 }
 
@@ -113,6 +114,18 @@ func (repo *MCPRepositoryImpl) Save(server *MCPServer) error {
 	return nil
 }
 
+// Update changes the connection of a server, leaving its tools alone.
+func (repo *MCPRepositoryImpl) Update(server *MCPServer) error {
+	if server.Headers == nil {
+		server.Headers = make(map[string]string)
+	}
+	headersBytes, _ := json.Marshal(server.Headers)
+
+	query := `UPDATE MCPServers SET name = ?, endpoint = ?, api_key = ?, headers_json = ? WHERE id = ? AND user = ?`
+	_, err := repo.db.Exec(query, server.Name, server.Endpoint, server.APIKey, string(headersBytes), server.ID, server.User)
+	return err
+}
+
 func (repo *MCPRepositoryImpl) DeleteByID(id string, user string) error {
 	_, err := repo.db.Exec(`DELETE FROM MCPServers WHERE id = ? AND user = ?`, id, user)
 	return err
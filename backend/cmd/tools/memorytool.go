@@ -0,0 +1,40 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/memory"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+)
+
+func rememberTool(args string, user string, convID string) providers.ToolOutput {
+	var params struct {
+		Fact string `json:"fact"`
+	}
+	if err := json.Unmarshal([]byte(args), &params); err != nil {
+		return providers.ToolOutput{Content: fmt.Sprintf("error decoding arguments: %v", err)}
+	}
+
+	fact := strings.TrimSpace(params.Fact)
+	if fact == "" {
+		return providers.ToolOutput{Content: "error: fact is required"}
+	}
+	if len(fact) > memory.MaxLength {
+		return providers.ToolOutput{Content: fmt.Sprintf("error: fact is longer than %d characters", memory.MaxLength)}
+	}
+
+	m := &memory.Memory{
+		User:    user,
+		Content: fact,
+		Source:  memory.SourceAssistant,
+		ConvID:  convID,
+	}
+	if err := memories.Save(m); err != nil {
+		log.Error("Error saving memory", "err", err)
+		return providers.ToolOutput{Content: "Error occurred while saving memory."}
+	}
+
+	return providers.ToolOutput{Content: "Saved to memory."}
+}
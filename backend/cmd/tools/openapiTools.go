@@ -0,0 +1,231 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The parts of an OpenAPI 3 document needed to turn its operations into
+// HTTP tools.
+type openAPISpec struct {
+	Info struct {
+		Title string `yaml:"title"`
+	} `yaml:"info"`
+	Servers []struct {
+		URL string `yaml:"url"`
+	} `yaml:"servers"`
+	Paths      map[string]openAPIPathItem `yaml:"paths"`
+	Components struct {
+		Schemas    map[string]any          `yaml:"schemas"`
+		Parameters map[string]openAPIParam `yaml:"parameters"`
+	} `yaml:"components"`
+}
+
+type openAPIPathItem struct {
+	Parameters []openAPIParam    `yaml:"parameters"`
+	Get        *openAPIOperation `yaml:"get"`
+	Post       *openAPIOperation `yaml:"post"`
+	Put        *openAPIOperation `yaml:"put"`
+	Patch      *openAPIOperation `yaml:"patch"`
+	Delete     *openAPIOperation `yaml:"delete"`
+}
+
+type openAPIOperation struct {
+	OperationID string         `yaml:"operationId"`
+	Summary     string         `yaml:"summary"`
+	Description string         `yaml:"description"`
+	Parameters  []openAPIParam `yaml:"parameters"`
+	RequestBody *struct {
+		Required bool `yaml:"required"`
+		Content  map[string]struct {
+			Schema map[string]any `yaml:"schema"`
+		} `yaml:"content"`
+	} `yaml:"requestBody"`
+}
+
+type openAPIParam struct {
+	Ref         string         `yaml:"$ref"`
+	Name        string         `yaml:"name"`
+	In          string         `yaml:"in"`
+	Description string         `yaml:"description"`
+	Required    bool           `yaml:"required"`
+	Schema      map[string]any `yaml:"schema"`
+}
+
+// maxRefDepth stops recursive schemas from being inlined forever.
+const maxRefDepth = 8
+
+var invalidToolChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// openAPITools makes an HTTP tool of every operation of spec, or of the
+// ones in only. Path and query parameters become placeholders of the URL and
+// the properties of a JSON body are sent as the other arguments. Header and
+// cookie parameters are left out.
+func openAPITools(spec []byte, specURL string, only []string) (HTTPServerRequest, error) {
+	var doc openAPISpec
+	// YAML is a superset of JSON, so one decoder reads both
+	if err := yaml.Unmarshal(spec, &doc); err != nil {
+		return HTTPServerRequest{}, err
+	}
+	if len(doc.Paths) == 0 {
+		return HTTPServerRequest{}, fmt.Errorf("no paths")
+	}
+
+	server := HTTPServerRequest{Name: doc.Info.Title}
+	if len(doc.Servers) > 0 {
+		server.BaseURL = strings.TrimSuffix(doc.Servers[0].URL, "/")
+		// a relative server is relative to where the spec was found
+		if base, err := url.Parse(specURL); err == nil && specURL != "" {
+			if ref, err := url.Parse(server.BaseURL); err == nil {
+				server.BaseURL = strings.TrimSuffix(base.ResolveReference(ref).String(), "/")
+			}
+		}
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(doc.Paths)) {
+		item := doc.Paths[path]
+		for _, op := range []struct {
+			method string
+			op     *openAPIOperation
+		}{
+			{http.MethodGet, item.Get},
+			{http.MethodPost, item.Post},
+			{http.MethodPut, item.Put},
+			{http.MethodPatch, item.Patch},
+			{http.MethodDelete, item.Delete},
+		} {
+			if op.op == nil || (len(only) > 0 && !slices.Contains(only, op.op.OperationID)) {
+				continue
+			}
+			server.Tools = append(server.Tools, doc.tool(op.method, path, item.Parameters, op.op))
+		}
+	}
+	if len(server.Tools) == 0 {
+		return server, fmt.Errorf("no operations to import")
+	}
+	return server, nil
+}
+
+func (doc *openAPISpec) tool(method, path string, shared []openAPIParam, op *openAPIOperation) HTTPToolRequest {
+	name := op.OperationID
+	if name == "" {
+		name = strings.ToLower(method) + "_" + path
+	}
+	name = strings.Trim(invalidToolChars.ReplaceAllString(name, "_"), "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	properties := make(map[string]any)
+	required := make([]string, 0)
+	query := make([]string, 0)
+	// parameters of the operation override those of its path
+	params := make(map[string]openAPIParam)
+	for _, p := range append(slices.Clone(shared), op.Parameters...) {
+		p = doc.param(p)
+		params[p.In+":"+p.Name] = p
+	}
+	for _, key := range slices.Sorted(maps.Keys(params)) {
+		p := params[key]
+		if p.In != "path" && p.In != "query" {
+			continue
+		}
+		schema := doc.resolve(p.Schema, 0)
+		if schema == nil {
+			schema = map[string]any{"type": "string"}
+		}
+		if p.Description != "" {
+			schema["description"] = p.Description
+		}
+		properties[p.Name] = schema
+		if p.Required || p.In == "path" {
+			required = append(required, p.Name)
+		}
+		if p.In == "query" {
+			query = append(query, url.QueryEscape(p.Name)+"={"+p.Name+"}")
+		}
+	}
+
+	if op.RequestBody != nil {
+		if content, ok := op.RequestBody.Content["application/json"]; ok {
+			body := doc.resolve(content.Schema, 0)
+			if props, ok := body["properties"].(map[string]any); ok {
+				maps.Copy(properties, props)
+			}
+			if list, ok := body["required"].([]any); ok && op.RequestBody.Required {
+				for _, r := range list {
+					if s, ok := r.(string); ok {
+						required = append(required, s)
+					}
+				}
+			}
+		}
+	}
+
+	schema, _ := json.Marshal(map[string]any{"type": "object", "properties": properties, "required": required})
+	template := path
+	if len(query) > 0 {
+		template += "?" + strings.Join(query, "&")
+	}
+	return HTTPToolRequest{
+		Name:        name,
+		Description: strings.TrimSpace(op.Summary + "\n\n" + op.Description),
+		Method:      method,
+		URL:         template,
+		InputSchema: schema,
+	}
+}
+
+func (doc *openAPISpec) param(p openAPIParam) openAPIParam {
+	if ref, ok := strings.CutPrefix(p.Ref, "#/components/parameters/"); ok {
+		if resolved, ok := doc.Components.Parameters[ref]; ok {
+			return resolved
+		}
+	}
+	return p
+}
+
+// resolve returns a copy of schema with references to the components
+// inlined, as models do not follow them.
+func (doc *openAPISpec) resolve(schema map[string]any, depth int) map[string]any {
+	if schema == nil {
+		return nil
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		name, _ := strings.CutPrefix(ref, "#/components/schemas/")
+		target, ok := doc.Components.Schemas[name].(map[string]any)
+		if !ok || depth >= maxRefDepth {
+			return map[string]any{"type": "object"}
+		}
+		return doc.resolve(target, depth+1)
+	}
+
+	out := make(map[string]any, len(schema))
+	for k, v := range schema {
+		out[k] = doc.resolveValue(v, depth)
+	}
+	return out
+}
+
+func (doc *openAPISpec) resolveValue(v any, depth int) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return doc.resolve(v, depth)
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = doc.resolveValue(item, depth)
+		}
+		return list
+	default:
+		return v
+	}
+}
@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// mcpOutput turns the result of an MCP tool into a tool output. Text blocks
+// are kept as they are, images, audio and binary resources are saved as
+// files of the user and described by their ID and path, and resource links
+// become markdown links. The first image is attached to the tool call, so
+// the model and the client can see it.
+func mcpOutput(result *mcp.CallToolResult, user string) providers.ToolOutput {
+	var output providers.ToolOutput
+	parts := make([]string, 0, len(result.Content))
+	for i, block := range result.Content {
+		switch c := block.(type) {
+		case *mcp.TextContent:
+			parts = append(parts, c.Text)
+		case *mcp.ImageContent:
+			fileID, part := saveMCPFile(c.Data, c.MIMEType, fmt.Sprintf("image_%d", i+1), user)
+			if fileID != "" && output.File == "" {
+				output.File = fileID
+				output.Type = providers.OutputImageURL
+			}
+			parts = append(parts, part)
+		case *mcp.AudioContent:
+			_, part := saveMCPFile(c.Data, c.MIMEType, fmt.Sprintf("audio_%d", i+1), user)
+			parts = append(parts, part)
+		case *mcp.ResourceLink:
+			parts = append(parts, resourceLink(c))
+		case *mcp.EmbeddedResource:
+			if c.Resource == nil {
+				continue
+			}
+			if c.Resource.Blob != nil {
+				name := strings.TrimSuffix(path.Base(c.Resource.URI), path.Ext(c.Resource.URI))
+				_, part := saveMCPFile(c.Resource.Blob, c.Resource.MIMEType, name, user)
+				parts = append(parts, fmt.Sprintf("Resource %s: %s", c.Resource.URI, part))
+			} else {
+				parts = append(parts, fmt.Sprintf("Resource %s:\n%s", c.Resource.URI, c.Resource.Text))
+			}
+		default:
+			rawJSON, _ := json.Marshal(block)
+			parts = append(parts, string(rawJSON))
+		}
+	}
+
+	output.Content = strings.Join(parts, "\n\n")
+	if len(parts) == 0 && result.StructuredContent != nil {
+		rawJSON, _ := json.Marshal(result.StructuredContent)
+		output.Content = string(rawJSON)
+		output.Type = providers.OutputJSON
+	}
+	if output.Type == "" {
+		output.Type = providers.OutputMarkdown
+		if len(result.Content) == 1 {
+			if _, ok := result.Content[0].(*mcp.TextContent); ok {
+				output.Type = inferOutputType(output.Content)
+			}
+		}
+	}
+	if result.IsError {
+		output.Code = apierr.ToolFailed
+	}
+	return output
+}
+
+// saveMCPFile saves binary content returned by a tool and describes it to
+// the model. The file ID is empty when saving failed.
+func saveMCPFile(data []byte, mimeType, name, user string) (string, string) {
+	ext := ".bin"
+	switch mimeType {
+	case "image/jpeg":
+		ext = ".jpg"
+	case "image/png":
+		ext = ".png"
+	default:
+		if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+
+	fileName := fmt.Sprintf("%s_%s%s", name, time.Now().Format("20060102_150405"), ext)
+	fileData, err := saveGeneratedFile(data, fileName, user)
+	if err != nil {
+		log.Error("Error saving tool output file", "name", fileName, "err", err)
+		return "", fmt.Sprintf("A %s file was returned but could not be saved.", mimeType)
+	}
+	return fileData.ID, fmt.Sprintf("Saved %s (%s). File ID: %s Path: /%s", fileData.Name, mimeType, fileData.ID, fileData.Path)
+}
+
+func resourceLink(c *mcp.ResourceLink) string {
+	title := c.Title
+	if title == "" {
+		title = c.Name
+	}
+	link := fmt.Sprintf("[%s](%s)", title, c.URI)
+	if c.Description != "" {
+		link += " - " + c.Description
+	}
+	return link
+}
+
+// inferOutputType tells JSON, and arrays of objects as tables, from
+// markdown, which plain text renders as too.
+func inferOutputType(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "{") && !strings.HasPrefix(text, "[") {
+		return providers.OutputMarkdown
+	}
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return providers.OutputMarkdown
+	}
+	rows, ok := value.([]any)
+	if !ok || len(rows) == 0 {
+		return providers.OutputJSON
+	}
+	for _, row := range rows {
+		if _, ok := row.(map[string]any); !ok {
+			return providers.OutputJSON
+		}
+	}
+	return providers.OutputTable
+}
@@ -0,0 +1,64 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	fs "github.com/Bajahaw/ai-ui/cmd/files"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestMCPOutputType(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []mcp.Content
+		output  string
+		typ     string
+	}{
+		{"markdown", []mcp.Content{&mcp.TextContent{Text: "# Title\n- item"}}, "# Title\n- item", providers.OutputMarkdown},
+		{"object", []mcp.Content{&mcp.TextContent{Text: `{"a": 1}`}}, `{"a": 1}`, providers.OutputJSON},
+		{"table", []mcp.Content{&mcp.TextContent{Text: ` [{"a": 1}, {"a": 2}]`}}, ` [{"a": 1}, {"a": 2}]`, providers.OutputTable},
+		{"mixed array", []mcp.Content{&mcp.TextContent{Text: `[{"a": 1}, 2]`}}, `[{"a": 1}, 2]`, providers.OutputJSON},
+		{"not json", []mcp.Content{&mcp.TextContent{Text: "[link](https://example.com)"}}, "[link](https://example.com)", providers.OutputMarkdown},
+		{"blocks", []mcp.Content{&mcp.TextContent{Text: "a"}, &mcp.TextContent{Text: "b"}}, "a\n\nb", providers.OutputMarkdown},
+		{"link", []mcp.Content{&mcp.ResourceLink{URI: "file:///a.txt", Name: "a.txt", Description: "notes"}}, "[a.txt](file:///a.txt) - notes", providers.OutputMarkdown},
+		{"embedded", []mcp.Content{&mcp.EmbeddedResource{Resource: &mcp.ResourceContents{URI: "file:///a.txt", Text: "hello"}}}, "Resource file:///a.txt:\nhello", providers.OutputMarkdown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := mcpOutput(&mcp.CallToolResult{Content: tt.content}, "testuser")
+			if out.Content != tt.output || out.Type != tt.typ {
+				t.Errorf("got %q (%s), want %q (%s)", out.Content, out.Type, tt.output, tt.typ)
+			}
+		})
+	}
+
+	out := mcpOutput(&mcp.CallToolResult{StructuredContent: map[string]int{"a": 1}, IsError: true}, "testuser")
+	if out.Content != `{"a":1}` || out.Type != providers.OutputJSON || out.Code != apierr.ToolFailed {
+		t.Errorf("expected the structured content of a failed call, got %+v", out)
+	}
+}
+
+func TestMCPOutputSavesImages(t *testing.T) {
+	db, _ := setupTestDB(t)
+	files = fs.NewRepository(db)
+	t.Chdir(t.TempDir())
+
+	out := mcpOutput(&mcp.CallToolResult{Content: []mcp.Content{
+		&mcp.TextContent{Text: "Here is the chart"},
+		&mcp.ImageContent{Data: []byte("\x89PNG"), MIMEType: "image/png"},
+	}}, "testuser")
+	if out.File == "" || out.Type != providers.OutputImageURL {
+		t.Fatalf("expected the image to be attached, got %+v", out)
+	}
+	saved, err := files.GetByIDs([]string{out.File}, "testuser")
+	if err != nil || len(saved) != 1 || saved[0].Type != "image/png" {
+		t.Fatalf("expected the image to be saved as a file, got %v %v", saved, err)
+	}
+	if !strings.HasPrefix(out.Content, "Here is the chart\n\nSaved image_2_") || !strings.Contains(out.Content, "File ID: "+out.File) {
+		t.Errorf("expected the image to be described, got %q", out.Content)
+	}
+}
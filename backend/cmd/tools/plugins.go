@@ -0,0 +1,212 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+
+	"github.com/google/uuid"
+)
+
+// defaultPluginsDir is searched when PLUGINS_DIR is not set.
+const defaultPluginsDir = "./data/plugins"
+
+// BuiltInTool is a tool that runs inside ai-ui. Registered tools are listed
+// on every user's default server next to the tools that ship with ai-ui.
+type BuiltInTool struct {
+	Name        string
+	Description string
+	// InputSchema is the JSON schema of the arguments.
+	InputSchema string
+	// Run stops once ctx is done, when the request is cancelled.
+	Run func(ctx context.Context, args, user, convID string) providers.ToolOutput
+}
+
+// registered are the tools added with RegisterTool, in registration order.
+var registered []BuiltInTool
+
+var validToolName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// RegisterTool adds a built-in tool. It is called during setup, before
+// LoadPlugins, and fails for names that are taken.
+func RegisterTool(t BuiltInTool) error {
+	if !validToolName.MatchString(t.Name) {
+		return fmt.Errorf("invalid tool name %q", t.Name)
+	}
+	if t.Run == nil {
+		return fmt.Errorf("tool %s has no Run function", t.Name)
+	}
+	if !json.Valid([]byte(t.InputSchema)) {
+		return fmt.Errorf("tool %s: input schema is not valid JSON", t.Name)
+	}
+	if slices.ContainsFunc(GetBuiltInTools(), func(b *Tool) bool { return b.Name == t.Name }) {
+		return fmt.Errorf("tool %s is already registered", t.Name)
+	}
+	registered = append(registered, t)
+	builtInHandlers[t.Name] = t.Run
+	return nil
+}
+
+// registeredTools returns the definitions of the registered tools.
+func registeredTools() []*Tool {
+	list := make([]*Tool, 0, len(registered))
+	for _, t := range registered {
+		list = append(list, &Tool{
+			ID:          uuid.New().String(),
+			Name:        t.Name,
+			MCPServerID: "default",
+			Description: t.Description,
+			InputSchema: t.InputSchema,
+			IsEnabled:   true,
+		})
+	}
+	return list
+}
+
+// pluginTool is how a plugin describes one of its tools.
+type pluginTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// pluginCall is what a plugin reads from stdin when one of its tools runs.
+type pluginCall struct {
+	Arguments      json.RawMessage `json:"arguments"`
+	User           string          `json:"user"`
+	ConversationID string          `json:"conversation_id"`
+}
+
+// LoadPlugins registers the tools of the executables in PLUGINS_DIR and
+// brings the default server of every user up to date with the built-in
+// tools.
+//
+// A plugin is run as `plugin describe` at startup and prints
+// {"tools": [{"name", "description", "input_schema"}]}. Each call runs
+// `plugin call <name>` with a pluginCall on stdin; what it prints is the
+// output of the tool, and a non-zero exit is reported to the model as an
+// error.
+func LoadPlugins() {
+	dir := os.Getenv("PLUGINS_DIR")
+	if dir == "" {
+		dir = defaultPluginsDir
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Error("Error reading plugins directory", "dir", dir, "err", err)
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+		path, _ := filepath.Abs(filepath.Join(dir, entry.Name()))
+		if err := loadPlugin(path); err != nil {
+			log.Error("Error loading plugin", "plugin", entry.Name(), "err", err)
+		}
+	}
+
+	syncDefaultServers()
+}
+
+func loadPlugin(path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Duration("pluginTimeout"))
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "describe").Output()
+	if err != nil {
+		return err
+	}
+	var described struct {
+		Tools []pluginTool `json:"tools"`
+	}
+	if err := json.Unmarshal(out, &described); err != nil {
+		return fmt.Errorf("invalid describe output: %w", err)
+	}
+
+	for _, t := range described.Tools {
+		schema := string(t.InputSchema)
+		if schema == "" {
+			schema = `{"type":"object","properties":{}}`
+		}
+		err := RegisterTool(BuiltInTool{
+			Name:        t.Name,
+			Description: t.Description,
+			InputSchema: schema,
+			Run:         pluginRunner(path, t.Name),
+		})
+		if err != nil {
+			return err
+		}
+		log.Info("Plugin tool registered", "tool", t.Name, "plugin", filepath.Base(path))
+	}
+	return nil
+}
+
+func pluginRunner(path, name string) func(ctx context.Context, args, user, convID string) providers.ToolOutput {
+	return func(ctx context.Context, args, user, convID string) providers.ToolOutput {
+		if strings.TrimSpace(args) == "" {
+			args = "{}"
+		}
+		input, _ := json.Marshal(pluginCall{
+			Arguments:      json.RawMessage(args),
+			User:           user,
+			ConversationID: convID,
+		})
+
+		ctx, cancel := context.WithTimeout(ctx, config.Duration("pluginTimeout"))
+		defer cancel()
+		cmd := exec.CommandContext(ctx, path, "call", name)
+		cmd.Stdin = bytes.NewReader(input)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			log.Error("Plugin tool failed", "tool", name, "err", err, "stderr", stderr.String())
+			message := strings.TrimSpace(stderr.String())
+			if message == "" {
+				message = err.Error()
+			}
+			return providers.ToolOutput{Content: "error: " + message, Code: toolErrorCode(ctx.Err())}
+		}
+		return providers.ToolOutput{Content: string(out)}
+	}
+}
+
+// syncDefaultServers refreshes the tools of every user's default server, so
+// tools added since the server was created show up.
+func syncDefaultServers() {
+	rows, err := db.Query(`SELECT id FROM MCPServers WHERE id LIKE 'default%'`)
+	if err != nil {
+		log.Error("Error querying default servers", "err", err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		fresh := GetBuiltInTools()
+		for _, t := range fresh {
+			t.MCPServerID = id
+		}
+		if err := syncTools(id, fresh); err != nil {
+			log.Error("Error syncing built-in tools", "server", id, "err", err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+const testPlugin = `#!/bin/sh
+case "$1" in
+describe)
+	echo '{"tools": [{"name": "echo_call", "description": "Echo", "input_schema": {"type": "object"}}, {"name": "fail"}, {"name": "slow"}]}' ;;
+call)
+	[ "$2" = fail ] && { echo "out of coffee" >&2; exit 1; }
+	[ "$2" = slow ] && exec sleep 10
+	cat ;;
+esac
+`
+
+func TestLoadPlugins(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db = data.DB
+	t.Cleanup(func() { db.Close() })
+	log = logger.New(os.Stdout)
+	tools = NewToolRepository(db)
+	mcps = NewMCPRepository(db, tools)
+	t.Cleanup(func() {
+		for _, r := range registered {
+			delete(builtInHandlers, r.Name)
+		}
+		registered = nil
+	})
+
+	for _, stmt := range []string{
+		"INSERT INTO Users (username, pass_hash) VALUES ('alice', 'hash')",
+		"INSERT INTO MCPServers (id, name, endpoint, api_key, user) VALUES ('default-alice', 'Default Server', '', '', 'alice')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(path.Join(dir, "coffee"), []byte(testPlugin), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// not executable, so not a plugin
+	if err := os.WriteFile(path.Join(dir, "README"), []byte("notes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PLUGINS_DIR", dir)
+	LoadPlugins()
+
+	names := make([]string, 0)
+	for _, tool := range tools.GetAllByMCPServerID("default-alice") {
+		names = append(names, tool.Name)
+	}
+	for _, want := range []string{"search_ddgs", "echo_call", "fail"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("expected %s on the default server, got %v", want, names)
+		}
+	}
+
+	out := builtInHandlers["echo_call"](context.Background(), `{"q": 1}`, "alice", "conv")
+	if out.Content != `{"arguments":{"q":1},"user":"alice","conversation_id":"conv"}` {
+		t.Errorf("unexpected output %q", out.Content)
+	}
+	if out := builtInHandlers["fail"](context.Background(), "", "alice", "conv"); !strings.Contains(out.Content, "out of coffee") {
+		t.Errorf("expected the error of the plugin, got %q", out.Content)
+	}
+
+	// a cancelled request stops the plugin
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if out := builtInHandlers["slow"](ctx, "", "alice", "conv"); !strings.HasPrefix(out.Content, "error:") || time.Since(start) > 5*time.Second {
+		t.Errorf("expected the plugin to be stopped with the request, got %q after %s", out.Content, time.Since(start))
+	}
+
+	if err := RegisterTool(BuiltInTool{Name: "calculate", InputSchema: "{}", Run: builtInHandlers["fail"]}); err == nil {
+		t.Error("expected an error for a taken name")
+	}
+}
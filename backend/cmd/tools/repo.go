@@ -2,6 +2,7 @@ package tools
 
 import (
 	"database/sql"
+	"encoding/json"
 	"strings"
 )
 
@@ -25,10 +26,56 @@ func NewToolRepository(db *sql.DB) ToolRepository {
 	return &ToolRepositoryImpl{db: db}
 }
 
+const toolColumns = `id, mcp_server_id, name, description, input_schema, require_approval, is_enabled, type, http_json`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTool(row scanner) (*Tool, error) {
+	var tool Tool
+	var httpTemplate string
+	if err := row.Scan(
+		&tool.ID,
+		&tool.MCPServerID,
+		&tool.Name,
+		&tool.Description,
+		&tool.InputSchema,
+		&tool.RequireApproval,
+		&tool.IsEnabled,
+		&tool.Type,
+		&httpTemplate,
+	); err != nil {
+		return nil, err
+	}
+	if httpTemplate != "" {
+		tool.HTTP = &HTTPTemplate{}
+		if err := json.Unmarshal([]byte(httpTemplate), tool.HTTP); err != nil {
+			return nil, err
+		}
+	}
+	return &tool, nil
+}
+
+func toolType(tool *Tool) string {
+	if tool.Type == "" {
+		return ToolTypeMCP
+	}
+	return tool.Type
+}
+
+func httpJSON(tool *Tool) string {
+	if tool.HTTP == nil {
+		return ""
+	}
+	b, _ := json.Marshal(tool.HTTP)
+	return string(b)
+}
+
 func (repo *ToolRepositoryImpl) GetAll(user string) []*Tool {
 	var allTools = make([]*Tool, 0)
 	sql := `
-		SELECT t.id, t.mcp_server_id, t.name, t.description, t.input_schema, t.require_approval, t.is_enabled 
+		SELECT t.id, t.mcp_server_id, t.name, t.description, t.input_schema, t.require_approval, t.is_enabled, t.type, t.http_json
 		FROM Tools t
 		JOIN MCPServers m ON t.mcp_server_id = m.id
 		WHERE m.user = ?
@@ -42,45 +89,25 @@ func (repo *ToolRepositoryImpl) GetAll(user string) []*Tool {
 
 	defer rows.Close()
 	for rows.Next() {
-		var tool Tool
-		if err := rows.Scan(
-			&tool.ID,
-			&tool.MCPServerID,
-			&tool.Name,
-			&tool.Description,
-			&tool.InputSchema,
-			&tool.RequireApproval,
-			&tool.IsEnabled,
-		); err != nil {
+		tool, err := scanTool(rows)
+		if err != nil {
 			log.Error("Error scanning tool", "err", err)
 			continue
 		}
-		allTools = append(allTools, &tool)
+		allTools = append(allTools, tool)
 	}
 
 	return allTools
 }
 
 func (repo *ToolRepositoryImpl) GetByName(name, user string) (*Tool, error) {
-	var tool Tool
-	sql := `SELECT id, mcp_server_id, name, description, input_schema, require_approval, is_enabled FROM Tools WHERE name = ? and mcp_server_id IN (SELECT id FROM MCPServers WHERE user = ?)`
-	err := repo.db.QueryRow(sql, name, user).Scan(
-		&tool.ID,
-		&tool.MCPServerID,
-		&tool.Name,
-		&tool.Description,
-		&tool.InputSchema,
-		&tool.RequireApproval,
-		&tool.IsEnabled)
-	if err != nil {
-		return nil, err
-	}
-	return &tool, nil
+	sql := `SELECT ` + toolColumns + ` FROM Tools WHERE name = ? and mcp_server_id IN (SELECT id FROM MCPServers WHERE user = ?)`
+	return scanTool(repo.db.QueryRow(sql, name, user))
 }
 
 func (repo *ToolRepositoryImpl) GetAllByMCPServerID(mcpID string) []*Tool {
 	var tools = make([]*Tool, 0)
-	sql := `SELECT id, mcp_server_id, name, description, input_schema, require_approval, is_enabled FROM Tools WHERE mcp_server_id = ?`
+	sql := `SELECT ` + toolColumns + ` FROM Tools WHERE mcp_server_id = ?`
 	rows, err := repo.db.Query(sql, mcpID)
 	if err != nil {
 		log.Error("Error querying tools by MCPServerID", "err", err)
@@ -89,45 +116,25 @@ func (repo *ToolRepositoryImpl) GetAllByMCPServerID(mcpID string) []*Tool {
 	defer rows.Close()
 
 	for rows.Next() {
-		var tool Tool
-		if err := rows.Scan(
-			&tool.ID,
-			&tool.MCPServerID,
-			&tool.Name,
-			&tool.Description,
-			&tool.InputSchema,
-			&tool.RequireApproval,
-			&tool.IsEnabled,
-		); err != nil {
+		tool, err := scanTool(rows)
+		if err != nil {
 			log.Error("Error scanning tool", "err", err)
 			continue
 		}
-		tools = append(tools, &tool)
+		tools = append(tools, tool)
 	}
 
 	return tools
 }
 
 func (repo *ToolRepositoryImpl) GetByID(id string) (*Tool, error) {
-	var tool Tool
-	sql := `SELECT id, mcp_server_id, name, description, input_schema, require_approval, is_enabled FROM Tools WHERE id = ?`
-	err := repo.db.QueryRow(sql, id).Scan(
-		&tool.ID,
-		&tool.MCPServerID,
-		&tool.Name,
-		&tool.Description,
-		&tool.InputSchema,
-		&tool.RequireApproval,
-		&tool.IsEnabled)
-	if err != nil {
-		return nil, err
-	}
-	return &tool, nil
+	sql := `SELECT ` + toolColumns + ` FROM Tools WHERE id = ?`
+	return scanTool(repo.db.QueryRow(sql, id))
 }
 
 func (repo *ToolRepositoryImpl) Save(tool *Tool) error {
-	sql := `INSERT INTO Tools (id, mcp_server_id, name, description, input_schema, require_approval, is_enabled) VALUES (?, ?, ?, ?, ?, ?, ?)`
-	_, err := repo.db.Exec(sql, tool.ID, tool.MCPServerID, tool.Name, tool.Description, tool.InputSchema, tool.RequireApproval, tool.IsEnabled)
+	sql := `INSERT INTO Tools (id, mcp_server_id, name, description, input_schema, require_approval, is_enabled, type, http_json) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := repo.db.Exec(sql, tool.ID, tool.MCPServerID, tool.Name, tool.Description, tool.InputSchema, tool.RequireApproval, tool.IsEnabled, toolType(tool), httpJSON(tool))
 	if err != nil {
 		return err
 	}
@@ -136,8 +143,8 @@ func (repo *ToolRepositoryImpl) Save(tool *Tool) error {
 
 func (repo *ToolRepositoryImpl) SaveAll(tools []*Tool) error {
 	sql := `
-	INSERT INTO Tools (id, mcp_server_id, name, description, input_schema, require_approval, is_enabled)
-	VALUES (?, ?, ?, ?, ?, ?, ?) 
+	INSERT INTO Tools (id, mcp_server_id, name, description, input_schema, require_approval, is_enabled, type, http_json)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	ON CONFLICT(id) DO UPDATE SET require_approval=excluded.require_approval, is_enabled=excluded.is_enabled
 	WHERE Tools.mcp_server_id = excluded.mcp_server_id`
 
@@ -151,6 +158,8 @@ func (repo *ToolRepositoryImpl) SaveAll(tools []*Tool) error {
 			tool.InputSchema,
 			tool.RequireApproval,
 			tool.IsEnabled,
+			toolType(tool),
+			httpJSON(tool),
 		); err != nil {
 			return err
 		}
@@ -163,14 +172,16 @@ func (repo *ToolRepositoryImpl) SaveAll(tools []*Tool) error {
 // while preserving the tool ID and user-set flags (is_enabled, require_approval).
 func (repo *ToolRepositoryImpl) UpsertAll(tools []*Tool) error {
 	sql := `
-	INSERT INTO Tools (id, mcp_server_id, name, description, input_schema, require_approval, is_enabled)
-	VALUES (?, ?, ?, ?, ?, ?, ?) 
+	INSERT INTO Tools (id, mcp_server_id, name, description, input_schema, require_approval, is_enabled, type, http_json)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	ON CONFLICT(id) DO UPDATE SET
 		name=excluded.name,
 		description=excluded.description,
 		input_schema=excluded.input_schema,
 		require_approval=excluded.require_approval,
-		is_enabled=excluded.is_enabled
+		is_enabled=excluded.is_enabled,
+		type=excluded.type,
+		http_json=excluded.http_json
 	WHERE Tools.mcp_server_id = excluded.mcp_server_id`
 
 	for _, tool := range tools {
@@ -182,6 +193,8 @@ func (repo *ToolRepositoryImpl) UpsertAll(tools []*Tool) error {
 			tool.InputSchema,
 			tool.RequireApproval,
 			tool.IsEnabled,
+			toolType(tool),
+			httpJSON(tool),
 		); err != nil {
 			return err
 		}
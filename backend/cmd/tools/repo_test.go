@@ -7,6 +7,9 @@ import (
 	"testing"
 
 	"github.com/Bajahaw/ai-ui/cmd/data"
+	"github.com/Bajahaw/ai-ui/cmd/providers"
+
+	logger "github.com/charmbracelet/log"
 )
 
 // setupTestDB creates a temp SQLite DB with full schema and returns the db + repo.
@@ -362,3 +365,31 @@ func TestRefreshFlow_UpdatesSchemaPreservesFlags(t *testing.T) {
 		t.Errorf("brand_new description wrong: got %q", brandNew.Description)
 	}
 }
+
+func TestToolCalls_GettersReturnSameFields(t *testing.T) {
+	db, _ := setupTestDB(t)
+	log = logger.New(os.Stdout)
+	for _, stmt := range []string{
+		"INSERT INTO Conversations (id, user, title, created_at, updated_at) VALUES ('conv1', 'testuser', '', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)",
+		"INSERT INTO Messages (id, conv_id, role, model, parent_id, content, status, created_at, updated_at) VALUES (3, 'conv1', 'assistant', 'm', 0, '', 'completed', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	repo := NewToolCallsRepository(db)
+	saved := &providers.ToolCall{ID: "call1", ReferenceID: "ref1", ConvID: "conv1", MessageID: 3, Name: "calculate", Args: "{}", Output: "2", OutputType: "json", TokenCount: 5}
+	if err := repo.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+
+	byMessage := repo.GetAllByMessageID(3)
+	byConv := repo.GetAllByConvID("conv1")
+	if len(byMessage) != 1 || len(byConv) != 1 {
+		t.Fatalf("expected one tool call each, got %d and %d", len(byMessage), len(byConv))
+	}
+	if *byMessage[0] != *saved || *byConv[0] != *saved {
+		t.Errorf("expected %+v, got %+v and %+v", saved, byMessage[0], byConv[0])
+	}
+}
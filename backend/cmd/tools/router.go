@@ -4,25 +4,29 @@ import (
 	"net/http"
 
 	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
 	"github.com/Bajahaw/ai-ui/cmd/utils"
 )
 
 func Handler() http.Handler {
-	mux := http.NewServeMux()
+	mux := openapi.NewRouter("/api/tools", "Tools")
 
-	mux.HandleFunc("GET /all", listAllTools)
-	mux.HandleFunc("POST /saveAll", saveListOfTools)
-	mux.HandleFunc("GET /approve", approveTool)
+	mux.HandleFunc("GET /all", listAllTools, openapi.Op{Summary: "List the tools of the user", Response: ToolListResponse{}})
+	mux.HandleFunc("POST /saveAll", saveListOfTools, openapi.Op{Summary: "Save which tools are enabled and need approval", Request: ToolListResponse{}})
+	mux.HandleFunc("GET /approve", approveTool, openapi.Op{Summary: "Approve or reject a pending tool call", Query: []openapi.Param{{Name: "call_id", Required: true}, {Name: "approved", Description: "true to run the tool"}}})
 	// mux.HandleFunc("GET /{id}", GetTool)
 	// mux.HandleFunc("POST /save", SaveTool)
 	// mux.HandleFunc("DELETE /delete/{id}", DeleteTool)
 
-	mux.HandleFunc("GET /mcp/all", listMCPServers)
-	mux.HandleFunc("GET /mcp/{id}", getMCPServer)
-	mux.HandleFunc("POST /mcp/save", saveMCPServer)
-	mux.HandleFunc("POST /mcp/restore-default", restoreDefaultMCPServer)
-	mux.HandleFunc("DELETE /mcp/delete/{id}", deleteMCPServer)
-	mux.HandleFunc("POST /mcp/refresh-tools/{id}", refreshMCPTools)
+	mux.HandleFunc("GET /mcp/all", listMCPServers, openapi.Op{Summary: "List MCP servers", Response: []MCPServerResponse{}})
+	mux.HandleFunc("GET /mcp/{id}", getMCPServer, openapi.Op{Summary: "Get an MCP server", Response: MCPServerResponse{}})
+	mux.HandleFunc("POST /mcp/save", saveMCPServer, openapi.Op{Summary: "Add or update an MCP server", Request: MCPServerRequest{}, Response: MCPServerResponse{}})
+	mux.HandleFunc("POST /mcp/restore-default", restoreDefaultMCPServer, openapi.Op{Summary: "Restore the built-in MCP server", Response: map[string]string{}})
+	mux.HandleFunc("DELETE /mcp/delete/{id}", deleteMCPServer, openapi.Op{Summary: "Delete an MCP server", Response: ""})
+	mux.HandleFunc("POST /mcp/refresh-tools/{id}", refreshMCPTools, openapi.Op{Summary: "Fetch the tools of an MCP server again", Status: http.StatusNoContent})
+
+	mux.HandleFunc("POST /http/save", saveHTTPServer, openapi.Op{Summary: "Add or replace HTTP tools", Description: "HTTP tools are grouped in a server sharing a base URL, key and headers; list and delete them with the MCP server endpoints.", Request: HTTPServerRequest{}, Response: MCPServerResponse{}})
+	mux.HandleFunc("POST /http/openapi", importOpenAPI, openapi.Op{Summary: "Add HTTP tools from an OpenAPI spec", Description: "Every operation, or those in operations, becomes a tool; importing again with the id replaces them.", Request: OpenAPIImportRequest{}, Response: MCPServerResponse{}})
 
 	return http.StripPrefix("/api/tools", auth.Authenticated(mux))
 }
@@ -44,7 +48,7 @@ func saveListOfTools(w http.ResponseWriter, r *http.Request) {
 	user := utils.ExtractContextUser(r)
 	var req ToolListResponse
 	if err := utils.ExtractJSONBody(r, &req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
@@ -56,13 +60,13 @@ func saveListOfTools(w http.ResponseWriter, r *http.Request) {
 
 	for _, tool := range req.Tools {
 		if _, exists := mcpToUserID[tool.MCPServerID]; !exists {
-			http.Error(w, "Unauthorized MCP server reference or server not found", http.StatusUnauthorized)
+			utils.Error(w, "Unauthorized MCP server reference or server not found", http.StatusUnauthorized)
 			return
 		}
 	}
 
 	if err := tools.SaveAll(req.Tools); err != nil {
-		http.Error(w, "Error saving tools", http.StatusInternalServerError)
+		utils.Error(w, "Error saving tools", http.StatusInternalServerError)
 		return
 	}
 	utils.RespondWithJSON(w, nil, http.StatusOK)
@@ -74,7 +78,7 @@ func approveTool(w http.ResponseWriter, r *http.Request) {
 	toolApproval := r.URL.Query().Get("approved") == "true"
 
 	if toolCallID == "" {
-		http.Error(w, "Tool Call ID is required", http.StatusBadRequest)
+		utils.Error(w, "Tool Call ID is required", http.StatusBadRequest)
 		return
 	}
 
@@ -83,12 +87,12 @@ func approveTool(w http.ResponseWriter, r *http.Request) {
 	toolCallManager.mu.Unlock()
 
 	if !exists {
-		http.Error(w, "No pending tool call found", http.StatusNotFound)
+		utils.Error(w, "No pending tool call found", http.StatusNotFound)
 		return
 	}
 
 	if ch.User != user {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		utils.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -3,6 +3,7 @@ package tools
 import (
 	"database/sql"
 
+	"github.com/Bajahaw/ai-ui/cmd/data"
 	"github.com/Bajahaw/ai-ui/cmd/providers"
 )
 
@@ -28,52 +29,53 @@ func (repo *ToolCallsRepositoryImpl) Save(toolCall *providers.ToolCall) error {
 		fileID = nil
 	}
 
-	query := `INSERT INTO ToolCalls (id, reference_id, conv_id, message_id, name, args, output, file_id, token_count, context_size) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err := repo.db.Exec(query, toolCall.ID, toolCall.ReferenceID, toolCall.ConvID, toolCall.MessageID, toolCall.Name, toolCall.Args, toolCall.Output, fileID, toolCall.TokenCount, toolCall.ContextSize)
+	query := `INSERT INTO ToolCalls (id, reference_id, conv_id, message_id, name, args, output, output_type, file_id, token_count, context_size) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := data.Exec(repo.db, query, toolCall.ID, toolCall.ReferenceID, toolCall.ConvID, toolCall.MessageID, toolCall.Name, toolCall.Args, toolCall.Output, toolCall.OutputType, fileID, toolCall.TokenCount, toolCall.ContextSize)
 	return err
 }
 
 func (repo *ToolCallsRepositoryImpl) GetAllByMessageID(messageID int) []*providers.ToolCall {
-	query := `SELECT id, reference_id, name, args, output, file_id, token_count, context_size FROM ToolCalls WHERE message_id = ?`
-	var toolCalls = make([]*providers.ToolCall, 0)
+	query := `SELECT ` + toolCallColumns + ` FROM ToolCalls WHERE message_id = ?`
+	return repo.queryToolCalls(query, messageID)
+}
 
-	rows, err := repo.db.Query(query, messageID)
-	if err != nil {
-		log.Error("Error querying tool calls", "err", err)
-		return toolCalls
-	}
+func (repo *ToolCallsRepositoryImpl) GetAllByConvID(convID string) []*providers.ToolCall {
+	query := `SELECT ` + toolCallColumns + ` FROM ToolCalls WHERE conv_id = ?`
+	return repo.queryToolCalls(query, convID)
+}
 
-	defer rows.Close()
-	for rows.Next() {
-		var toolCall providers.ToolCall
-		var fileID sql.NullString
-		if err := rows.Scan(
-			&toolCall.ID,
-			&toolCall.ReferenceID,
-			&toolCall.Name,
-			&toolCall.Args,
-			&toolCall.Output,
-			&fileID,
-			&toolCall.TokenCount,
-			&toolCall.ContextSize,
-		); err != nil {
-			log.Error("Error scanning tool call", "err", err)
-			return toolCalls
-		}
-		if fileID.Valid {
-			toolCall.File = fileID.String
-		}
+// toolCallColumns are the ToolCalls columns read by scanToolCall, so every
+// query returns the same fields.
+const toolCallColumns = `id, reference_id, conv_id, message_id, name, args, output, output_type, file_id, token_count, context_size`
 
-		toolCalls = append(toolCalls, &toolCall)
+func scanToolCall(row scanner) (*providers.ToolCall, error) {
+	var toolCall providers.ToolCall
+	var fileID sql.NullString
+	if err := row.Scan(
+		&toolCall.ID,
+		&toolCall.ReferenceID,
+		&toolCall.ConvID,
+		&toolCall.MessageID,
+		&toolCall.Name,
+		&toolCall.Args,
+		&toolCall.Output,
+		&toolCall.OutputType,
+		&fileID,
+		&toolCall.TokenCount,
+		&toolCall.ContextSize,
+	); err != nil {
+		return nil, err
 	}
-	return toolCalls
+	if fileID.Valid {
+		toolCall.File = fileID.String
+	}
+	return &toolCall, nil
 }
 
-func (repo *ToolCallsRepositoryImpl) GetAllByConvID(convID string) []*providers.ToolCall {
-	query := `SELECT id, reference_id, message_id, name, args, output, file_id, token_count, context_size FROM ToolCalls WHERE conv_id = ?`
+func (repo *ToolCallsRepositoryImpl) queryToolCalls(query string, args ...any) []*providers.ToolCall {
 	var toolCalls = make([]*providers.ToolCall, 0)
 
-	rows, err := repo.db.Query(query, convID)
+	rows, err := data.Query(repo.db, query, args...)
 	if err != nil {
 		log.Error("Error querying tool calls", "err", err)
 		return toolCalls
@@ -81,27 +83,12 @@ func (repo *ToolCallsRepositoryImpl) GetAllByConvID(convID string) []*providers.
 
 	defer rows.Close()
 	for rows.Next() {
-		var toolCall providers.ToolCall
-		var fileID sql.NullString
-		if err := rows.Scan(
-			&toolCall.ID,
-			&toolCall.ReferenceID,
-			&toolCall.MessageID,
-			&toolCall.Name,
-			&toolCall.Args,
-			&toolCall.Output,
-			&fileID,
-			&toolCall.TokenCount,
-			&toolCall.ContextSize,
-		); err != nil {
+		toolCall, err := scanToolCall(rows)
+		if err != nil {
 			log.Error("Error scanning tool call", "err", err)
 			return toolCalls
 		}
-		if fileID.Valid {
-			toolCall.File = fileID.String
-		}
-
-		toolCalls = append(toolCalls, &toolCall)
+		toolCalls = append(toolCalls, toolCall)
 	}
 	return toolCalls
 }
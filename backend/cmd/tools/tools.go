@@ -3,17 +3,23 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
 	fs "github.com/Bajahaw/ai-ui/cmd/files"
 	"github.com/google/uuid"
 
 	"github.com/Bajahaw/ai-ui/cmd/providers"
+	stngs "github.com/Bajahaw/ai-ui/cmd/settings"
+	"github.com/Bajahaw/ai-ui/cmd/tracing"
 	"github.com/evgensoft/ddgo"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 type Tool struct {
@@ -24,8 +30,16 @@ type Tool struct {
 	InputSchema     string `json:"input_schema,omitempty"`
 	RequireApproval bool   `json:"require_approval"`
 	IsEnabled       bool   `json:"is_enabled"`
+	// Type is ToolTypeMCP or ToolTypeHTTP, HTTP tools are run from HTTP.
+	Type string        `json:"type,omitempty"`
+	HTTP *HTTPTemplate `json:"http,omitempty"`
 }
 
+const (
+	ToolTypeMCP  = "mcp"
+	ToolTypeHTTP = "http"
+)
+
 type PendingToolCall struct {
 	User     string
 	ToolCall providers.ToolCall
@@ -63,7 +77,30 @@ var toolCallManager = ToolCallManager{
 // 	return results
 // }
 
-func ExecuteMCPTool(toolCall providers.ToolCall, user, convID string) providers.ToolOutput {
+// builtInHandlers run the built-in tools implemented in packages that import
+// this one.
+var builtInHandlers = map[string]func(ctx context.Context, args, user, convID string) providers.ToolOutput{}
+
+// RegisterBuiltIn sets the function running the built-in tool name, it is
+// called during setup.
+func RegisterBuiltIn(name string, handler func(ctx context.Context, args, user, convID string) providers.ToolOutput) {
+	builtInHandlers[name] = handler
+}
+
+// ExecuteMCPTool runs a tool call of the user. Waiting for approval, calls
+// to MCP servers and HTTP tools, built-in tools and plugins stop once ctx
+// is done.
+func ExecuteMCPTool(ctx context.Context, toolCall providers.ToolCall, user, convID string) providers.ToolOutput {
+	ctx, span := tracing.Start(ctx, "tool.execute", attribute.String("tool", toolCall.Name))
+	defer span.End()
+	output := executeMCPTool(ctx, toolCall, user, convID)
+	if output.Code != "" {
+		span.SetStatus(codes.Error, string(output.Code))
+	}
+	return output
+}
+
+func executeMCPTool(ctx context.Context, toolCall providers.ToolCall, user, convID string) providers.ToolOutput {
 	tool, err := tools.GetByName(toolCall.Name, user)
 	if err != nil {
 		log.Error("Error retrieving tool", "err", err)
@@ -76,7 +113,14 @@ func ExecuteMCPTool(toolCall providers.ToolCall, user, convID string) providers.
 		return providers.ToolOutput{Content: "Error occurred while retrieving MCP server."}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	// invalid arguments are sent back to the model before asking for
+	// approval or calling the server
+	if err := validateArgs(tool, toolCall.Args); err != nil {
+		log.Debug("Invalid tool arguments", "tool", tool.Name, "err", err)
+		return argsErrorOutput(tool, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
 	defer cancel()
 
 	if tool.RequireApproval {
@@ -99,7 +143,10 @@ func ExecuteMCPTool(toolCall providers.ToolCall, user, convID string) providers.
 
 		select {
 		case <-ctx.Done():
-			return providers.ToolOutput{Content: "Tool call approval timed out."}
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return providers.ToolOutput{Content: "Tool call was cancelled."}
+			}
+			return providers.ToolOutput{Content: "Tool call approval timed out.", Code: apierr.ToolTimeout}
 		case approved := <-responseChan:
 			if !approved {
 				return providers.ToolOutput{Content: "Tool call was not approved."}
@@ -107,12 +154,16 @@ func ExecuteMCPTool(toolCall providers.ToolCall, user, convID string) providers.
 		}
 	}
 
+	if tool.Type == ToolTypeHTTP {
+		return httpTool(ctx, tool, server, toolCall.Args)
+	}
+
 	if strings.HasPrefix(server.ID, "default") {
 		switch tool.Name {
 		case "search_ddgs":
 			return ddgsTool(toolCall.Args)
 		case "get_weather":
-			return weatherTool()
+			return weatherTool(user)
 		case "search_document":
 			return searchDocumentTool(toolCall.Args)
 		case "read_document_page":
@@ -130,7 +181,16 @@ func ExecuteMCPTool(toolCall providers.ToolCall, user, convID string) providers.
 		case "delete_document_part":
 			return deleteDocumentPartTool(toolCall.Args, user)
 		case "generate_image":
-			return generateImageTool(toolCall.Args, user, convID)
+			return generateImageTool(ctx, toolCall.Args, user, convID)
+		case "remember":
+			return rememberTool(toolCall.Args, user, convID)
+		case "calculate":
+			return calculateTool(toolCall.Args)
+		case "read_file":
+			return readFileTool(toolCall.Args, convID)
+		}
+		if handler, ok := builtInHandlers[tool.Name]; ok {
+			return handler(ctx, toolCall.Args, user, convID)
 		}
 	}
 
@@ -155,7 +215,7 @@ func ExecuteMCPTool(toolCall providers.ToolCall, user, convID string) providers.
 
 		if err != nil {
 			log.Error("Error connecting to MCP server", "err", err)
-			return providers.ToolOutput{Content: "Error connecting to MCP server"}
+			return providers.ToolOutput{Content: "Error connecting to MCP server", Code: toolErrorCode(err)}
 		}
 
 		mcpSessionManager.add(server.ID, session)
@@ -184,16 +244,25 @@ func ExecuteMCPTool(toolCall providers.ToolCall, user, convID string) providers.
 
 		// session.Close() // this might throw the same error if connection is broken
 
-		return providers.ToolOutput{Content: "Tool execution failed!"}
+		if code := toolErrorCode(err); code == apierr.ToolTimeout {
+			return providers.ToolOutput{Content: "Tool execution timed out!", Code: code}
+		}
+		return providers.ToolOutput{Content: "Tool execution failed!", Code: apierr.ToolFailed}
 	}
 
-	output := result.Content
 	// output is an array of mcp.Content objects
-	log.Debug(len(output))
-	log.Debug(output)
+	log.Debug(len(result.Content))
+	log.Debug(result.Content)
 
-	rawJSON, _ := json.Marshal(output)
-	return providers.ToolOutput{Content: string(rawJSON)}
+	return mcpOutput(result, user)
+}
+
+// toolErrorCode tells a tool that ran out of time apart from one that failed.
+func toolErrorCode(err error) apierr.Code {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return apierr.ToolTimeout
+	}
+	return apierr.ToolFailed
 }
 
 func GetAvailableTools(user string) []*Tool {
@@ -211,7 +280,7 @@ func GetAvailableTools(user string) []*Tool {
 }
 
 func GetBuiltInTools() []*Tool {
-	return []*Tool{
+	return append([]*Tool{
 		{
 			ID:          uuid.New().String(),
 			Name:        "search_ddgs",
@@ -300,7 +369,47 @@ func GetBuiltInTools() []*Tool {
 			InputSchema: `{"type":"object","properties":{"prompt":{"type":"string","description":"A detailed prompt for the image generation model"}},"required":["prompt"]}`,
 			IsEnabled:   true,
 		},
-	}
+		{
+			ID:          uuid.New().String(),
+			Name:        "remember",
+			MCPServerID: "default",
+			Description: "Save a durable fact about the user (preferences, background, ongoing projects) so it is available in future conversations. Use only for information worth keeping long term, one short fact per call.",
+			InputSchema: `{"type":"object","properties":{"fact":{"type":"string","description":"The fact to remember, written as a short standalone sentence"}},"required":["fact"]}`,
+			IsEnabled:   true,
+		},
+		{
+			ID:          uuid.New().String(),
+			Name:        "calculate",
+			MCPServerID: "default",
+			Description: "Evaluate an expression exactly instead of doing arithmetic yourself. Supports + - * / % ^, parentheses, functions (sqrt, cbrt, abs, round, floor, ceil, exp, ln, log, log2, sin, cos, tan, asin, acos, atan, pow, min, max) and pi. Units convert with 'to', e.g. '5 km + 300 m to mi', '98.6 F to C', '3 GiB to MB'. Dates are YYYY-MM-DD or today: '2024-03-01 + 45 days', 'today + 2 months', '2024-12-25 - today'.",
+			InputSchema: `{"type":"object","properties":{"expression":{"type":"string","description":"The expression to evaluate"}},"required":["expression"]}`,
+			IsEnabled:   true,
+		},
+		{
+			ID:          uuid.New().String(),
+			Name:        "read_file",
+			MCPServerID: "default",
+			Description: "Read the extracted text of a file attached earlier in this conversation. Long files are returned in parts: pass start_page and end_page to read pages of a document, or offset and length to read characters; the output tells the offset to continue from.",
+			InputSchema: `{"type":"object","properties":{"file_id":{"type":"string","description":"The id of the attached file"},"start_page":{"type":"integer","minimum":1,"description":"The 1-based page to start reading from, for paged documents"},"end_page":{"type":"integer","minimum":1,"description":"The 1-based page to stop reading at (inclusive)"},"offset":{"type":"integer","minimum":0,"description":"The character to start reading from, 0 by default"},"length":{"type":"integer","minimum":1,"maximum":50000,"description":"The number of characters to read, 20000 by default"}},"required":["file_id"]}`,
+			IsEnabled:   true,
+		},
+		{
+			ID:          uuid.New().String(),
+			Name:        "search_history",
+			MCPServerID: "default",
+			Description: "Search the user's past conversations for earlier questions and answers, e.g. when they refer to something discussed before. Returns matching messages with their conversation title, date and a snippet; cite them by title and date. Words and \"quoted phrases\" must all appear; filters: role:user|assistant, before:YYYY-MM-DD, after:YYYY-MM-DD. Only available when the user enabled history search.",
+			InputSchema: `{"type":"object","properties":{"query":{"type":"string","description":"Words or \"quoted phrases\" to look for, optionally with filters"},"limit":{"type":"integer","minimum":1,"maximum":20,"description":"Maximum number of results, 5 by default"}},"required":["query"]}`,
+			IsEnabled:   true,
+		},
+		{
+			ID:          uuid.New().String(),
+			Name:        "search_knowledge",
+			MCPServerID: "default",
+			Description: "Search the knowledge bases attached to this conversation for passages relevant to the user's question. Returns the matching files with a page number when known and a snippet; use read_file or view_document_page for more context and cite the file name. Only available when a knowledge base is attached.",
+			InputSchema: `{"type":"object","properties":{"query":{"type":"string","description":"Words to look for in the files"},"limit":{"type":"integer","minimum":1,"maximum":20,"description":"Maximum number of results, 5 by default"}},"required":["query"]}`,
+			IsEnabled:   true,
+		},
+	}, registeredTools()...)
 }
 
 func ddgsTool(q string) providers.ToolOutput {
@@ -332,16 +441,17 @@ func ddgsTool(q string) providers.ToolOutput {
 	}
 
 	if len(result) == 0 {
-		output = "Search failed! Probably bot detection triggered."
+		return providers.ToolOutput{Content: "Search failed! Probably bot detection triggered."}
 	}
 
-	return providers.ToolOutput{Content: output}
+	return providers.ToolOutput{Content: output, Type: providers.OutputMarkdown}
 }
 
-func weatherTool() providers.ToolOutput {
+func weatherTool(user string) providers.ToolOutput {
 	// simulate delay
 	time.Sleep(2 * time.Second)
-	return providers.ToolOutput{Content: "Temperature: 22°C, Condition: Sunny"}
+	l := stngs.LocalizerFor(settings, user)
+	return providers.ToolOutput{Content: fmt.Sprintf("Temperature: %s°C, Condition: Sunny, Observed: %s", l.Number(22), l.Time(time.Now()))}
 }
 
 func searchDocumentTool(args string) providers.ToolOutput {
@@ -424,5 +534,5 @@ func viewDocumentPageTool(args, user, convID string) providers.ToolOutput {
 		return providers.ToolOutput{Content: fmt.Sprintf("error rendering document page: %v", err)}
 	}
 
-	return providers.ToolOutput{File: imgData.ID, Content: fmt.Sprintf("Rendered page %d of document %s as image. Screenshot ID: %s Path: /%s", params.PageNumber, docs[0].Name, imgData.ID, imgData.Path)}
+	return providers.ToolOutput{File: imgData.ID, Type: providers.OutputImageURL, Content: fmt.Sprintf("Rendered page %d of document %s as image. Screenshot ID: %s Path: /%s", params.PageNumber, docs[0].Name, imgData.ID, imgData.Path)}
 }
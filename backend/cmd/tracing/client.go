@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"github.com/Bajahaw/ai-ui/cmd/version"
+
+	logger "github.com/charmbracelet/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+)
+
+var log *logger.Logger
+var tracerProvider *sdktrace.TracerProvider
+
+// SetupTracing exports spans over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT
+// or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set. The exporter reads the rest
+// of the standard OTEL_* variables, headers, timeouts and so on. Without an
+// endpoint spans are dropped where they are made.
+func SetupTracing(l *logger.Logger) {
+	log = l
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return
+	}
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		log.Error("Tracing disabled, invalid OTLP exporter configuration", "err", err)
+		return
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName()),
+		semconv.ServiceVersion(version.AppVersion),
+	))
+	if err != nil {
+		log.Warn("Failed to describe the tracing resource", "err", err)
+		res = resource.Default()
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Warn("Tracing error", "err", err)
+	}))
+	log.Info("Tracing enabled", "service", serviceName())
+}
+
+// serviceName is OTEL_SERVICE_NAME, or ai-ui.
+func serviceName() string {
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		return name
+	}
+	return "ai-ui"
+}
+
+// Shutdown exports the spans still buffered, call it before exiting.
+func Shutdown(ctx context.Context) {
+	if tracerProvider == nil {
+		return
+	}
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		log.Warn("Failed to flush traces", "err", err)
+	}
+}
@@ -0,0 +1,17 @@
+package tracing
+
+import "testing"
+
+func TestRoute(t *testing.T) {
+	cases := map[string]string{
+		"/api/chat/stream":                          "/api/chat/stream",
+		"/api/conversations/conv-1a2b/messages":     "/api/conversations/{id}/messages",
+		"/api/conversations/conv-1/messages/42/pin": "/api/conversations/{id}/messages/{id}/pin",
+		"/api/files/":                               "/api/files/",
+	}
+	for path, want := range cases {
+		if got := route(path); got != want {
+			t.Errorf("route(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package usage
+
+import (
+	"database/sql"
+
+	logger "github.com/charmbracelet/log"
+)
+
+var log *logger.Logger
+var repo Repository
+
+func SetupUsage(l *logger.Logger, db *sql.DB) {
+	log = l
+	repo = NewRepository(db)
+	go aggregate()
+}
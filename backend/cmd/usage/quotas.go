@@ -0,0 +1,132 @@
+package usage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+)
+
+// Quota caps the tokens each user other than the owner uses with a shared
+// provider, per day and per calendar month (UTC), so no one drains a key
+// the team shares. A zero cap is no cap.
+type Quota struct {
+	ProviderID    string    `json:"provider"`
+	DailyTokens   int64     `json:"dailyTokens"`
+	MonthlyTokens int64     `json:"monthlyTokens"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// QuotaStatus is the usage of a user with a shared provider against its
+// quota. Remainders are left out for caps that are not set.
+type QuotaStatus struct {
+	Quota
+	TokensToday      int64  `json:"tokensToday"`
+	TokensThisMonth  int64  `json:"tokensThisMonth"`
+	DailyRemaining   *int64 `json:"dailyRemaining,omitempty"`
+	MonthlyRemaining *int64 `json:"monthlyRemaining,omitempty"`
+	Exceeded         bool   `json:"exceeded"`
+	// ResetsAt is when the provider can be used again once exceeded
+	ResetsAt *time.Time `json:"resetsAt,omitempty"`
+}
+
+// QuotaStatuses returns the usage of the user with every shared provider
+// that has a quota for them.
+func QuotaStatuses(user string) ([]*QuotaStatus, error) {
+	quotas, err := repo.UserQuotas(user)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*QuotaStatus, 0, len(quotas))
+	for _, q := range quotas {
+		status, err := quotaStatus(user, q, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func quotaStatus(user string, q *Quota, now time.Time) (*QuotaStatus, error) {
+	day := now.UTC().Truncate(24 * time.Hour)
+	month := monthStart(now)
+	status := &QuotaStatus{Quota: *q}
+
+	var err error
+	if status.TokensToday, err = repo.ProviderTokens(user, q.ProviderID, day); err != nil {
+		return nil, err
+	}
+	if status.TokensThisMonth, err = repo.ProviderTokens(user, q.ProviderID, month); err != nil {
+		return nil, err
+	}
+
+	if q.DailyTokens > 0 {
+		remaining := max(q.DailyTokens-status.TokensToday, 0)
+		status.DailyRemaining = &remaining
+		if remaining == 0 {
+			status.Exceeded = true
+			resets := day.AddDate(0, 0, 1)
+			status.ResetsAt = &resets
+		}
+	}
+	if q.MonthlyTokens > 0 {
+		remaining := max(q.MonthlyTokens-status.TokensThisMonth, 0)
+		status.MonthlyRemaining = &remaining
+		if remaining == 0 {
+			status.Exceeded = true
+			resets := month.AddDate(0, 1, 0)
+			status.ResetsAt = &resets
+		}
+	}
+	return status, nil
+}
+
+// CheckQuota returns an apierr.QuotaExceeded error when the model belongs
+// to a shared provider whose quota the user used up. Like budgets it is
+// checked before a generation starts, so the last one may go over.
+func CheckQuota(user, model string) error {
+	if repo == nil {
+		return nil
+	}
+	providerID, _, ok := strings.Cut(model, "/")
+	if !ok {
+		return nil
+	}
+	quotas, err := repo.UserQuotas(user)
+	if err != nil {
+		log.Error("Error checking provider quota", "user", user, "err", err)
+		return nil
+	}
+	for _, q := range quotas {
+		if q.ProviderID != providerID {
+			continue
+		}
+		status, err := quotaStatus(user, q, time.Now())
+		if err != nil {
+			log.Error("Error checking provider quota", "user", user, "provider", providerID, "err", err)
+			return nil
+		}
+		if status.Exceeded {
+			return apierr.New(apierr.QuotaExceeded,
+				fmt.Sprintf("Your quota for the shared provider %s is used up, it resets at %s", providerID, status.ResetsAt.Format(time.RFC3339)))
+		}
+	}
+	return nil
+}
+
+func Quotas() ([]*Quota, error) {
+	return repo.GetQuotas()
+}
+
+// SetQuota sets the quota of a provider, sql.ErrNoRows means there is no
+// such provider.
+func SetQuota(quota *Quota) error {
+	quota.UpdatedAt = time.Now().UTC()
+	return repo.SaveQuota(quota)
+}
+
+func DeleteQuota(providerID string) error {
+	return repo.DeleteQuota(providerID)
+}
@@ -0,0 +1,320 @@
+package usage
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+)
+
+// Entry is the token usage of one completion. Cost is nil when the model
+// has no prices.
+type Entry struct {
+	ID               int64
+	User             string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Cost             *float64
+	CreatedAt        time.Time
+}
+
+// DailyUsage is the usage of a user with a model on a day (UTC).
+type DailyUsage struct {
+	Day              string  `json:"day"`
+	User             string  `json:"user"`
+	Model            string  `json:"model"`
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Budget limits the usage of a user per calendar month (UTC). A zero limit
+// is no limit.
+type Budget struct {
+	User          string    `json:"user"`
+	MonthlyTokens int64     `json:"monthlyTokens"`
+	MonthlyCost   float64   `json:"monthlyCost"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+type Repository interface {
+	Save(entry *Entry) error
+	Totals(user string, since time.Time) (int64, float64, error)
+	Rollup(before time.Time) (int64, error)
+	DeleteRolledUp(before time.Time) (int64, error)
+	Daily(user, model, from, to string) ([]*DailyUsage, error)
+	GetBudget(user string) (*Budget, error)
+	GetBudgets() ([]*Budget, error)
+	SaveBudget(budget *Budget) error
+	DeleteBudget(user string) error
+	// ProviderTokens returns the tokens a user used with the models of a
+	// provider since the start of a day
+	ProviderTokens(user, providerID string, since time.Time) (int64, error)
+	GetQuotas() ([]*Quota, error)
+	// UserQuotas returns the quotas of the shared providers a user can use
+	// but does not own
+	UserQuotas(user string) ([]*Quota, error)
+	SaveQuota(quota *Quota) error
+	DeleteQuota(providerID string) error
+}
+
+type RepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &RepositoryImpl{db: db}
+}
+
+func (r *RepositoryImpl) Save(entry *Entry) error {
+	query := `
+		INSERT INTO UsageRecords (user, model, prompt_tokens, completion_tokens, cost, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	res, err := data.Exec(r.db, query, entry.User, entry.Model, entry.PromptTokens, entry.CompletionTokens,
+		entry.Cost, entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+	entry.ID, err = res.LastInsertId()
+	return err
+}
+
+// Totals returns the tokens and the cost a user used since the start of a
+// day, from the summaries and the records not rolled into them yet.
+func (r *RepositoryImpl) Totals(user string, since time.Time) (int64, float64, error) {
+	query := `
+		SELECT COALESCE(SUM(tokens), 0), COALESCE(SUM(cost), 0) FROM (
+			SELECT prompt_tokens + completion_tokens AS tokens, cost
+			FROM UsageDaily WHERE user = ? AND day >= ?
+			UNION ALL
+			SELECT prompt_tokens + completion_tokens, cost
+			FROM UsageRecords WHERE user = ? AND rolled_up = 0 AND created_at >= ?
+		)
+	`
+	var tokens int64
+	var cost float64
+	err := data.QueryRow(r.db, query, user, since.Format(time.DateOnly), user, since).Scan(&tokens, &cost)
+	return tokens, cost, err
+}
+
+// Rollup adds the records older than before to the daily summaries and
+// marks them, returning how many were rolled up.
+func (r *RepositoryImpl) Rollup(before time.Time) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// created_at is saved in UTC, so its first 10 characters are the day
+	_, err = tx.Exec(`
+		INSERT INTO UsageDaily (user, day, model, requests, prompt_tokens, completion_tokens, cost)
+		SELECT user, substr(created_at, 1, 10), model, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), COALESCE(SUM(cost), 0)
+		FROM UsageRecords WHERE rolled_up = 0 AND created_at < ?
+		GROUP BY user, substr(created_at, 1, 10), model
+		ON CONFLICT (user, day, model) DO UPDATE SET
+			requests = requests + excluded.requests,
+			prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+			completion_tokens = completion_tokens + excluded.completion_tokens,
+			cost = cost + excluded.cost
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`UPDATE UsageRecords SET rolled_up = 1 WHERE rolled_up = 0 AND created_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// DeleteRolledUp deletes the rolled up records older than before.
+func (r *RepositoryImpl) DeleteRolledUp(before time.Time) (int64, error) {
+	res, err := data.Exec(r.db, `DELETE FROM UsageRecords WHERE rolled_up = 1 AND created_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Daily returns the usage per day and model between two days (inclusive,
+// YYYY-MM-DD), newest first. Today comes from the records not rolled up
+// yet. An empty user or model matches all.
+func (r *RepositoryImpl) Daily(user, model, from, to string) ([]*DailyUsage, error) {
+	query := `
+		SELECT day, user, model, SUM(requests), SUM(prompt_tokens), SUM(completion_tokens), SUM(cost) FROM (
+			SELECT day, user, model, requests, prompt_tokens, completion_tokens, cost FROM UsageDaily
+			UNION ALL
+			SELECT substr(created_at, 1, 10), user, model, 1, prompt_tokens, completion_tokens, COALESCE(cost, 0)
+			FROM UsageRecords WHERE rolled_up = 0
+		)
+		WHERE day >= ? AND day <= ? AND (? = '' OR user = ?) AND (? = '' OR model = ?)
+		GROUP BY day, user, model
+		ORDER BY day DESC, user, model
+	`
+	rows, err := data.Query(r.db, query, from, to, user, user, model, model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := make([]*DailyUsage, 0)
+	for rows.Next() {
+		var d DailyUsage
+		if err := rows.Scan(&d.Day, &d.User, &d.Model, &d.Requests, &d.PromptTokens, &d.CompletionTokens, &d.Cost); err != nil {
+			return nil, err
+		}
+		days = append(days, &d)
+	}
+	return days, rows.Err()
+}
+
+const budgetColumns = `user, monthly_tokens, monthly_cost, updated_at`
+
+func scanBudget(row interface{ Scan(...any) error }) (*Budget, error) {
+	var b Budget
+	if err := row.Scan(&b.User, &b.MonthlyTokens, &b.MonthlyCost, &b.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// GetBudget returns the budget of a user, or sql.ErrNoRows.
+func (r *RepositoryImpl) GetBudget(user string) (*Budget, error) {
+	return scanBudget(data.QueryRow(r.db, `SELECT `+budgetColumns+` FROM UserBudgets WHERE user = ?`, user))
+}
+
+func (r *RepositoryImpl) GetBudgets() ([]*Budget, error) {
+	rows, err := data.Query(r.db, `SELECT `+budgetColumns+` FROM UserBudgets ORDER BY user`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := make([]*Budget, 0)
+	for rows.Next() {
+		b, err := scanBudget(rows)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, b)
+	}
+	return budgets, rows.Err()
+}
+
+// SaveBudget sets the budget of a user, sql.ErrNoRows means there is no
+// such user.
+func (r *RepositoryImpl) SaveBudget(budget *Budget) error {
+	query := `
+		INSERT INTO UserBudgets (user, monthly_tokens, monthly_cost, updated_at)
+		SELECT username, ?, ?, ? FROM Users WHERE username = ?
+		ON CONFLICT (user) DO UPDATE SET
+			monthly_tokens = excluded.monthly_tokens,
+			monthly_cost = excluded.monthly_cost,
+			updated_at = excluded.updated_at
+	`
+	res, err := data.Exec(r.db, query, budget.MonthlyTokens, budget.MonthlyCost, budget.UpdatedAt, budget.User)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *RepositoryImpl) DeleteBudget(user string) error {
+	_, err := data.Exec(r.db, `DELETE FROM UserBudgets WHERE user = ?`, user)
+	return err
+}
+
+// ProviderTokens matches the models of the provider by the prefix of their
+// id, which is the provider id and a slash.
+func (r *RepositoryImpl) ProviderTokens(user, providerID string, since time.Time) (int64, error) {
+	query := `
+		SELECT COALESCE(SUM(tokens), 0) FROM (
+			SELECT prompt_tokens + completion_tokens AS tokens, model
+			FROM UsageDaily WHERE user = ? AND day >= ?
+			UNION ALL
+			SELECT prompt_tokens + completion_tokens, model
+			FROM UsageRecords WHERE user = ? AND rolled_up = 0 AND created_at >= ?
+		)
+		WHERE substr(model, 1, length(?) + 1) = ? || '/'
+	`
+	var tokens int64
+	err := data.QueryRow(r.db, query, user, since.Format(time.DateOnly), user, since, providerID, providerID).Scan(&tokens)
+	return tokens, err
+}
+
+const quotaColumns = `q.provider_id, q.daily_tokens, q.monthly_tokens, q.updated_at`
+
+func scanQuotas(rows *sql.Rows) ([]*Quota, error) {
+	defer rows.Close()
+	quotas := make([]*Quota, 0)
+	for rows.Next() {
+		var q Quota
+		if err := rows.Scan(&q.ProviderID, &q.DailyTokens, &q.MonthlyTokens, &q.UpdatedAt); err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, &q)
+	}
+	return quotas, rows.Err()
+}
+
+func (r *RepositoryImpl) GetQuotas() ([]*Quota, error) {
+	rows, err := data.Query(r.db, `SELECT `+quotaColumns+` FROM ProviderQuotas q ORDER BY q.provider_id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanQuotas(rows)
+}
+
+func (r *RepositoryImpl) UserQuotas(user string) ([]*Quota, error) {
+	query := `
+		SELECT ` + quotaColumns + `
+		FROM ProviderQuotas q
+		JOIN Providers p ON p.id = q.provider_id
+		WHERE p.shared = 1 AND p.user != ? AND (
+			NOT EXISTS (SELECT 1 FROM ProviderUsers pu WHERE pu.provider_id = p.id)
+			OR EXISTS (SELECT 1 FROM ProviderUsers pu WHERE pu.provider_id = p.id AND pu.user = ?))
+		ORDER BY q.provider_id
+	`
+	rows, err := data.Query(r.db, query, user, user)
+	if err != nil {
+		return nil, err
+	}
+	return scanQuotas(rows)
+}
+
+// SaveQuota sets the quota of a provider, sql.ErrNoRows means there is no
+// such provider.
+func (r *RepositoryImpl) SaveQuota(quota *Quota) error {
+	query := `
+		INSERT INTO ProviderQuotas (provider_id, daily_tokens, monthly_tokens, updated_at)
+		SELECT id, ?, ?, ? FROM Providers WHERE id = ?
+		ON CONFLICT (provider_id) DO UPDATE SET
+			daily_tokens = excluded.daily_tokens,
+			monthly_tokens = excluded.monthly_tokens,
+			updated_at = excluded.updated_at
+	`
+	res, err := data.Exec(r.db, query, quota.DailyTokens, quota.MonthlyTokens, quota.UpdatedAt, quota.ProviderID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *RepositoryImpl) DeleteQuota(providerID string) error {
+	_, err := data.Exec(r.db, `DELETE FROM ProviderQuotas WHERE provider_id = ?`, providerID)
+	return err
+}
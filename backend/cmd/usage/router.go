@@ -0,0 +1,71 @@
+package usage
+
+import (
+	"net/http"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+func Handler() http.Handler {
+	mux := openapi.NewRouter("/api/usage", "Usage")
+
+	mux.HandleFunc("GET /budget", getBudgetStatus, openapi.Op{Summary: "Get the usage of this month and the remaining budget", Response: BudgetStatus{}})
+	mux.HandleFunc("GET /quotas", getQuotaStatuses, openapi.Op{Summary: "Get the usage of shared providers against their quotas", Response: QuotasResponse{}})
+	mux.HandleFunc("GET /daily", getDailyUsage, openapi.Op{
+		Summary: "Get the usage per day and model",
+		Query: []openapi.Param{
+			{Name: "from", Description: "First day (YYYY-MM-DD), 30 days before to by default"},
+			{Name: "to", Description: "Last day (YYYY-MM-DD), today (UTC) by default"},
+			{Name: "model", Description: "Only this model"},
+		},
+		Response: DailyUsageResponse{},
+	})
+
+	return http.StripPrefix("/api/usage", auth.Authenticated(mux))
+}
+
+func getBudgetStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := Status(utils.ExtractContextUser(r))
+	if err != nil {
+		log.Error("Error querying usage", "err", err)
+		utils.Error(w, "Error querying usage", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, status, http.StatusOK)
+}
+
+type QuotasResponse struct {
+	Quotas []*QuotaStatus `json:"quotas"`
+}
+
+func getQuotaStatuses(w http.ResponseWriter, r *http.Request) {
+	quotas, err := QuotaStatuses(utils.ExtractContextUser(r))
+	if err != nil {
+		log.Error("Error querying quotas", "err", err)
+		utils.Error(w, "Error querying quotas", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, QuotasResponse{Quotas: quotas}, http.StatusOK)
+}
+
+type DailyUsageResponse struct {
+	Days []*DailyUsage `json:"days"`
+}
+
+func getDailyUsage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, to, err := ParseRange(q)
+	if err != nil {
+		utils.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	days, err := Daily(utils.ExtractContextUser(r), q.Get("model"), from, to)
+	if err != nil {
+		log.Error("Error querying usage", "err", err)
+		utils.Error(w, "Error querying usage", http.StatusInternalServerError)
+		return
+	}
+	utils.RespondWithJSON(w, DailyUsageResponse{Days: days}, http.StatusOK)
+}
@@ -0,0 +1,181 @@
+package usage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/config"
+)
+
+const (
+	rollupEvery = time.Hour
+	// defaultDays is how many days the reports cover without a range.
+	defaultDays = 30
+)
+
+// BudgetStatus is the usage of a user in the current month against the
+// budget. Limits and remainders are left out when they are not set.
+type BudgetStatus struct {
+	PeriodStart     time.Time `json:"periodStart"`
+	ResetsAt        time.Time `json:"resetsAt"`
+	TokensUsed      int64     `json:"tokensUsed"`
+	CostUsed        float64   `json:"costUsed"`
+	TokenLimit      *int64    `json:"tokenLimit,omitempty"`
+	CostLimit       *float64  `json:"costLimit,omitempty"`
+	TokensRemaining *int64    `json:"tokensRemaining,omitempty"`
+	CostRemaining   *float64  `json:"costRemaining,omitempty"`
+	Exceeded        bool      `json:"exceeded"`
+}
+
+// Record saves the usage of a completion. It is a no-op until the package
+// is set up.
+func Record(user, model string, promptTokens, completionTokens int, cost *float64) {
+	if repo == nil || user == "" || promptTokens+completionTokens == 0 {
+		return
+	}
+	entry := &Entry{
+		User:             user,
+		Model:            model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Cost:             cost,
+		CreatedAt:        time.Now().UTC(),
+	}
+	if err := repo.Save(entry); err != nil {
+		log.Error("Error saving usage", "user", user, "model", model, "err", err)
+	}
+}
+
+// monthStart returns the start of the calendar month (UTC) of t.
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Status returns the usage of the user this month against the budget.
+func Status(user string) (*BudgetStatus, error) {
+	start := monthStart(time.Now())
+	status := &BudgetStatus{PeriodStart: start, ResetsAt: start.AddDate(0, 1, 0)}
+	tokens, cost, err := repo.Totals(user, start)
+	if err != nil {
+		return nil, err
+	}
+	status.TokensUsed = tokens
+	status.CostUsed = roundCost(cost)
+
+	budget, err := repo.GetBudget(user)
+	if errors.Is(err, sql.ErrNoRows) {
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if budget.MonthlyTokens > 0 {
+		remaining := max(budget.MonthlyTokens-tokens, 0)
+		status.TokenLimit = &budget.MonthlyTokens
+		status.TokensRemaining = &remaining
+		status.Exceeded = remaining == 0
+	}
+	if budget.MonthlyCost > 0 {
+		remaining := roundCost(max(budget.MonthlyCost-cost, 0))
+		status.CostLimit = &budget.MonthlyCost
+		status.CostRemaining = &remaining
+		status.Exceeded = status.Exceeded || remaining == 0
+	}
+	return status, nil
+}
+
+// Check returns an apierr.BudgetExceeded error once the user used up the
+// budget of the month. Usage is checked before a generation starts, so the
+// last one may go over the budget.
+func Check(user string) error {
+	if repo == nil {
+		return nil
+	}
+	status, err := Status(user)
+	if err != nil {
+		// a broken budget lookup should not stop every chat
+		log.Error("Error checking usage budget", "user", user, "err", err)
+		return nil
+	}
+	if !status.Exceeded {
+		return nil
+	}
+	return apierr.New(apierr.BudgetExceeded,
+		fmt.Sprintf("The usage budget of this month is used up, it resets on %s", status.ResetsAt.Format("2006-01-02")))
+}
+
+// round to a millionth of a dollar to avoid float noise
+func roundCost(cost float64) float64 {
+	return math.Round(cost*1e6) / 1e6
+}
+
+func Budgets() ([]*Budget, error) {
+	return repo.GetBudgets()
+}
+
+// SetBudget sets the budget of a user, sql.ErrNoRows means there is no
+// such user.
+func SetBudget(budget *Budget) error {
+	budget.UpdatedAt = time.Now().UTC()
+	return repo.SaveBudget(budget)
+}
+
+func DeleteBudget(user string) error {
+	return repo.DeleteBudget(user)
+}
+
+// aggregate rolls the records of past days into the daily summaries and
+// prunes the ones older than usageRetention.
+func aggregate() {
+	for {
+		rollup(time.Now())
+		time.Sleep(rollupEvery)
+	}
+}
+
+func rollup(now time.Time) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	n, err := repo.Rollup(today)
+	if err != nil {
+		log.Error("Error rolling up usage", "err", err)
+		return
+	}
+	if n > 0 {
+		log.Info("Rolled up usage records", "count", n)
+	}
+	if _, err := repo.DeleteRolledUp(now.UTC().Add(-config.Duration("usageRetention"))); err != nil {
+		log.Error("Error pruning usage records", "err", err)
+	}
+}
+
+// ParseRange reads the from and to days (YYYY-MM-DD) of a report, the last
+// 30 days by default.
+func ParseRange(q url.Values) (from, to string, err error) {
+	end := time.Now().UTC()
+	if v := q.Get("to"); v != "" {
+		if end, err = time.Parse(time.DateOnly, v); err != nil {
+			return "", "", fmt.Errorf("invalid to day %q", v)
+		}
+	}
+	start := end.AddDate(0, 0, -(defaultDays - 1))
+	if v := q.Get("from"); v != "" {
+		if start, err = time.Parse(time.DateOnly, v); err != nil {
+			return "", "", fmt.Errorf("invalid from day %q", v)
+		}
+	}
+	if start.After(end) {
+		return "", "", fmt.Errorf("from is after to")
+	}
+	return start.Format(time.DateOnly), end.Format(time.DateOnly), nil
+}
+
+// Daily returns the usage per day and model, see Repository.Daily.
+func Daily(user, model, from, to string) ([]*DailyUsage, error) {
+	return repo.Daily(user, model, from, to)
+}
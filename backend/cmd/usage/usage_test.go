@@ -0,0 +1,226 @@
+package usage
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func setupTest(t *testing.T) *sql.DB {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	log = logger.New(os.Stdout)
+	repo = NewRepository(db)
+	t.Cleanup(func() { repo = nil })
+	return db
+}
+
+func TestBudget(t *testing.T) {
+	db := setupTest(t)
+
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('testuser', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	// usage of last month does not count
+	if _, err := db.Exec("INSERT INTO UsageRecords (user, model, prompt_tokens, completion_tokens, cost, created_at) VALUES ('testuser', 'm', 5000, 0, 1, '2000-01-01 00:00:00')"); err != nil {
+		t.Fatal(err)
+	}
+
+	cost := 0.25
+	Record("testuser", "m", 100, 50, &cost)
+	Record("testuser", "m", 30, 20, nil)
+	Record("testuser", "m", 0, 0, &cost)
+
+	status, err := Status("testuser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.TokensUsed != 200 || status.CostUsed != 0.25 {
+		t.Errorf("expected 200 tokens and 0.25 cost, got %d and %v", status.TokensUsed, status.CostUsed)
+	}
+	if status.TokenLimit != nil || status.Exceeded {
+		t.Errorf("expected no limits, got %+v", status)
+	}
+	if err := Check("testuser"); err != nil {
+		t.Errorf("expected no error without budget, got %v", err)
+	}
+
+	if err := SetBudget(&Budget{User: "testuser", MonthlyTokens: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	status, _ = Status("testuser")
+	if status.TokensRemaining == nil || *status.TokensRemaining != 800 || status.CostLimit != nil {
+		t.Errorf("expected 800 tokens remaining and no cost limit, got %+v", status)
+	}
+
+	if err := SetBudget(&Budget{User: "testuser", MonthlyCost: 0.2}); err != nil {
+		t.Fatal(err)
+	}
+	status, _ = Status("testuser")
+	if !status.Exceeded || status.TokenLimit != nil || *status.CostRemaining != 0 {
+		t.Errorf("expected the cost budget to be exceeded, got %+v", status)
+	}
+	if err := Check("testuser"); apierr.CodeOf(err) != apierr.BudgetExceeded {
+		t.Errorf("expected %s, got %v", apierr.BudgetExceeded, err)
+	}
+
+	if err := SetBudget(&Budget{User: "nobody", MonthlyTokens: 1}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for unknown user, got %v", err)
+	}
+
+	if err := DeleteBudget("testuser"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check("testuser"); err != nil {
+		t.Errorf("expected no error after deleting the budget, got %v", err)
+	}
+}
+
+func TestRollup(t *testing.T) {
+	db := setupTest(t)
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('a', 'hash'), ('b', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	today := now.Truncate(24 * time.Hour)
+	yesterday := today.Add(-time.Hour)
+	old := today.AddDate(0, 0, -40)
+	cost := 0.5
+	for _, e := range []*Entry{
+		{User: "a", Model: "m1", PromptTokens: 10, CompletionTokens: 5, Cost: &cost, CreatedAt: yesterday},
+		{User: "a", Model: "m1", PromptTokens: 20, CompletionTokens: 5, CreatedAt: yesterday.Add(-time.Hour)},
+		{User: "a", Model: "m2", PromptTokens: 1, CompletionTokens: 1, CreatedAt: old},
+		{User: "b", Model: "m1", PromptTokens: 7, CompletionTokens: 3, Cost: &cost, CreatedAt: yesterday},
+		{User: "a", Model: "m1", PromptTokens: 100, CompletionTokens: 0, CreatedAt: now},
+	} {
+		if err := repo.Save(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	monthTokens, monthCost, err := repo.Totals("a", monthStart(yesterday))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rollup(now)
+	// rolling up again must not count records twice
+	rollup(now)
+
+	var raw int
+	db.QueryRow("SELECT COUNT(*) FROM UsageRecords").Scan(&raw)
+	if raw != 4 {
+		t.Errorf("expected the record of 40 days ago to be pruned, %d left", raw)
+	}
+
+	tokens, c, err := repo.Totals("a", monthStart(yesterday))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens != monthTokens || c != monthCost {
+		t.Errorf("expected totals %d/%v after rollup, got %d/%v", monthTokens, monthCost, tokens, c)
+	}
+
+	from, to := old.Format(time.DateOnly), today.Format(time.DateOnly)
+	days, err := Daily("a", "", from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 3 {
+		t.Fatalf("expected 3 days of usage for a, got %d", len(days))
+	}
+	if d := days[0]; d.Day != to || d.Requests != 1 || d.PromptTokens != 100 {
+		t.Errorf("expected today from the raw records, got %+v", d)
+	}
+	if d := days[1]; d.Day != yesterday.Format(time.DateOnly) || d.Requests != 2 || d.PromptTokens != 30 || d.CompletionTokens != 10 || d.Cost != 0.5 {
+		t.Errorf("unexpected summary of yesterday: %+v", d)
+	}
+	if d := days[2]; d.Day != from || d.Model != "m2" {
+		t.Errorf("expected the pruned day to stay in the summaries, got %+v", d)
+	}
+
+	all, _ := Daily("", "m1", yesterday.Format(time.DateOnly), yesterday.Format(time.DateOnly))
+	if len(all) != 2 || all[0].User != "a" || all[1].User != "b" {
+		t.Errorf("expected m1 usage of a and b yesterday, got %d rows", len(all))
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	from, to, err := ParseRange(url.Values{"to": {"2024-03-10"}})
+	if err != nil || from != "2024-02-10" || to != "2024-03-10" {
+		t.Errorf("expected 30 days up to 2024-03-10, got %s..%s (%v)", from, to, err)
+	}
+	if _, _, err := ParseRange(url.Values{"from": {"2024-03-11"}, "to": {"2024-03-10"}}); err == nil {
+		t.Error("expected an error when from is after to")
+	}
+	if _, _, err := ParseRange(url.Values{"from": {"yesterday"}}); err == nil {
+		t.Error("expected an error for an invalid day")
+	}
+}
+
+func TestProviderQuota(t *testing.T) {
+	db := setupTest(t)
+
+	for _, stmt := range []string{
+		"INSERT INTO Users (username, pass_hash) VALUES ('admin', 'hash'), ('bob', 'hash')",
+		"INSERT INTO Providers (id, url, api_key, user, shared) VALUES ('team', 'http://localhost', 'sk', 'admin', 1), ('own', 'http://localhost', '', 'bob', 0)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SetQuota(&Quota{ProviderID: "missing", DailyTokens: 1}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown provider, got %v", err)
+	}
+	if err := SetQuota(&Quota{ProviderID: "team", DailyTokens: 100, MonthlyTokens: 1000}); err != nil {
+		t.Fatal(err)
+	}
+
+	Record("bob", "team/gpt", 60, 40, nil)
+	Record("bob", "own/gpt", 500, 0, nil)
+	// a provider whose id starts with the same text is not counted
+	Record("bob", "teammate/gpt", 500, 0, nil)
+
+	statuses, err := QuotaStatuses("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].TokensToday != 100 || !statuses[0].Exceeded || *statuses[0].DailyRemaining != 0 {
+		t.Fatalf("unexpected quota status: %+v", statuses)
+	}
+	if err := CheckQuota("bob", "team/gpt"); apierr.CodeOf(err) != apierr.QuotaExceeded {
+		t.Errorf("expected QUOTA_EXCEEDED, got %v", err)
+	}
+	if err := CheckQuota("bob", "own/gpt"); err != nil {
+		t.Errorf("own providers have no quota, got %v", err)
+	}
+
+	// the owner is not limited
+	Record("admin", "team/gpt", 500, 0, nil)
+	if err := CheckQuota("admin", "team/gpt"); err != nil {
+		t.Errorf("the owner should not be limited, got %v", err)
+	}
+	if statuses, _ := QuotaStatuses("admin"); len(statuses) != 0 {
+		t.Errorf("the owner has no quota, got %+v", statuses)
+	}
+
+	if err := SetQuota(&Quota{ProviderID: "team", MonthlyTokens: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckQuota("bob", "team/gpt"); err != nil {
+		t.Errorf("expected the raised quota to allow bob, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+)
+
+// MaxBodySize is the largest JSON request body in bytes.
+func MaxBodySize() int64 {
+	return config.Int64("maxBodySize")
+}
+
+// MaxUploadSize is the largest uploaded file in bytes.
+func MaxUploadSize() int64 {
+	return config.Int64("maxUploadSize")
+}
+
+// formPaths are the API routes taking form data instead of JSON.
+var formPaths = map[string]string{
+	"/api/files/upload":   "multipart/form-data",
+	"/api/chat/batch/csv": "multipart/form-data",
+	"/api/account/avatar": "multipart/form-data",
+	"/api/auth/login":     "application/x-www-form-urlencoded",
+}
+
+// rawPaths are the API routes taking a file as the raw body, of any type.
+// Their limit leaves room for base64 encoded files.
+var rawPaths = map[string]bool{
+	"/api/files/paste": true,
+}
+
+// bodyMiddleware limits the size of API request bodies and rejects bodies
+// of a content type the route does not accept.
+func bodyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || !hasBody(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if rawPaths[r.URL.Path] {
+			limit := MaxUploadSize()*4/3 + 1024
+			if r.ContentLength > limit {
+				Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limit, wantType := MaxBodySize(), "application/json"
+		if formType, ok := formPaths[r.URL.Path]; ok {
+			wantType = formType
+			if formType == "multipart/form-data" {
+				limit = MaxUploadSize()
+			}
+		}
+
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != wantType {
+			Error(w, "Content-Type must be "+wantType, http.StatusUnsupportedMediaType)
+			return
+		}
+		if r.ContentLength > limit {
+			Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyMiddleware(t *testing.T) {
+	var read int
+	handler := bodyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		read = len(data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"json", "/api/chat/stream", "application/json; charset=utf-8", `{}`, http.StatusNoContent},
+		{"wrong type", "/api/chat/stream", "text/plain", `{}`, http.StatusUnsupportedMediaType},
+		{"missing type", "/api/chat/stream", "", `{}`, http.StatusUnsupportedMediaType},
+		{"login form", "/api/auth/login", "application/x-www-form-urlencoded", "username=a", http.StatusNoContent},
+		{"json upload", "/api/files/upload", "application/json", `{}`, http.StatusUnsupportedMediaType},
+		{"avatar form", "/api/account/avatar", "multipart/form-data; boundary=x", "--x--", http.StatusNoContent},
+		{"raw paste", "/api/files/paste", "image/png", "\x89PNG", http.StatusNoContent},
+		{"too large", "/api/chat/stream", "application/json", strings.Repeat("a", int(MaxBodySize())+1), http.StatusRequestEntityTooLarge},
+		{"no body", "/api/chat/cancel", "", "", http.StatusNoContent},
+		{"not api", "/data/resources/x", "text/plain", "x", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	// bodies without a length are cut at the limit
+	req := httptest.NewRequest(http.MethodPost, "/api/chat/stream", io.MultiReader(strings.NewReader(strings.Repeat("a", int(MaxBodySize())+1))))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || int64(read) > MaxBodySize() {
+		t.Errorf("status = %d, read = %d", rec.Code, read)
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Error(rec, "Conversation not found\n", http.StatusNotFound)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var body ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body.Error.Code != "NOT_FOUND" || body.Error.Message != "Conversation not found" {
+		t.Errorf("unexpected body: %+v", body)
+	}
+}
+
+func TestExtractJSONBodyRejectsTrailingData(t *testing.T) {
+	var v struct{ A int }
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"A": 1} {"A": 2}`))
+	if err := ExtractJSONBody(req, &v); err == nil {
+		t.Errorf("expected an error for trailing data")
+	}
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{\"A\": 1}\n"))
+	if err := ExtractJSONBody(req, &v); err != nil || v.A != 1 {
+		t.Errorf("v = %+v, err = %v", v, err)
+	}
+}
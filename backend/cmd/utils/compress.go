@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// minCompressSize is the smallest response worth compressing, smaller
+// bodies fit in a packet either way.
+const minCompressSize = 1024
+
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(io.Discard) },
+}
+
+// compressMiddleware gzips JSON API responses for clients that accept it.
+// Streams and websockets are left alone, they flush as they go.
+func compressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") ||
+			r.Header.Get("Upgrade") != "" ||
+			!acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressWriter{ResponseWriter: w, status: http.StatusOK}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+func acceptsGzip(header string) bool {
+	for part := range strings.SplitSeq(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(coding) == "gzip" {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// compressWriter holds back the status until the first write, then
+// compresses the body when it is JSON and large enough.
+type compressWriter struct {
+	http.ResponseWriter
+	status  int
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.decided {
+		return
+	}
+	w.status = code
+	// informational responses are not the final status
+	if code < http.StatusOK {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.decide(len(p))
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher, a flush before the first write sends the
+// headers uncompressed, as streams do.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(0)
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) decide(size int) {
+	w.decided = true
+	h := w.Header()
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if mediaType == "application/json" && h.Get("Content-Encoding") == "" && size >= minCompressSize &&
+		w.status != http.StatusNoContent && w.status != http.StatusNotModified {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.gz = gzipWriters.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(0)
+	}
+	if w.gz != nil {
+		_ = w.gz.Close()
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+	}
+}
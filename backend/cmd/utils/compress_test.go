@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressMiddleware(t *testing.T) {
+	large := `{"text": "` + strings.Repeat("a", 2*minCompressSize) + `"}`
+	handler := compressMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/large":
+			RespondWithJSON(w, map[string]string{"text": strings.Repeat("a", 2*minCompressSize)}, http.StatusCreated)
+		case "/api/small":
+			RespondWithJSON(w, map[string]string{"text": "a"}, http.StatusOK)
+		case "/api/stream":
+			AddStreamHeaders(w)
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte(strings.Repeat("data: {}\n\n", minCompressSize)))
+		}
+	}))
+
+	get := func(path string, encoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/api/large", "br, gzip")
+	if rr.Code != http.StatusCreated || rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a gzipped 201, got %d %q", rr.Code, rr.Header().Get("Content-Encoding"))
+	}
+	gz, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(gz)
+	if strings.ReplaceAll(large, " ", "") != string(body) {
+		t.Errorf("unexpected body %.40q", body)
+	}
+
+	for _, tt := range []struct{ path, encoding string }{
+		{"/api/small", "gzip"},
+		{"/api/stream", "gzip"},
+		{"/api/large", "gzip;q=0"},
+		{"/api/large", ""},
+	} {
+		if rr := get(tt.path, tt.encoding); rr.Header().Get("Content-Encoding") != "" || rr.Code != http.StatusOK && rr.Code != http.StatusCreated {
+			t.Errorf("%s with %q: expected no compression, got %d %q", tt.path, tt.encoding, rr.Code, rr.Header().Get("Content-Encoding"))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+)
+
+// ErrorResponse is the body of every API error response.
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code    apierr.Code `json:"code"`
+	Message string      `json:"message"`
+}
+
+// Error replies with a JSON error body, it is the drop-in replacement
+// of http.Error for API handlers. The code is derived from the status.
+func Error(w http.ResponseWriter, message string, status int) {
+	RespondWithError(w, apierr.FromStatus(status), message, status)
+}
+
+// ErrorFrom replies with the code and status of a coded error, errors
+// without a code are sent with the fallback status.
+func ErrorFrom(w http.ResponseWriter, err error, fallback int) {
+	if code := apierr.CodeOf(err); code != "" {
+		RespondWithError(w, code, err.Error(), apierr.Status(code))
+		return
+	}
+	Error(w, err.Error(), fallback)
+}
+
+// RespondWithError replies with a JSON error body carrying code.
+func RespondWithError(w http.ResponseWriter, code apierr.Code, message string, status int) {
+	h := w.Header()
+	// drop headers meant for a successful response, like http.Error does
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	body := ErrorResponse{ErrorBody{Code: code, Message: strings.TrimSpace(message)}}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error("failed to write error response", "err", err)
+	}
+}
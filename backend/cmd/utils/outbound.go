@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+)
+
+// ErrBlockedAddress is returned for addresses of users in private,
+// loopback or link-local ranges an admin did not allow.
+var ErrBlockedAddress = errors.New("address is in a blocked network")
+
+// Outbound is the transport of requests to addresses users supply, such as
+// MCP servers and webhooks. It goes through the outbound proxy of the
+// instance and refuses to dial blocked addresses.
+var Outbound http.RoundTripper = guardedTransport()
+
+func guardedTransport() *http.Transport {
+	transport := OutboundTransport("")
+	transport.DialContext = GuardedDialContext(&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	})
+	return transport
+}
+
+// OutboundProxy returns the proxy function of requests the server makes to
+// providers and MCP servers: proxyURL when set, else the outboundProxy
+// option, else HTTP_PROXY, HTTPS_PROXY and NO_PROXY. The option is read
+// per request so changes apply without a restart.
+func OutboundProxy(proxyURL string) func(*http.Request) (*url.URL, error) {
+	return func(r *http.Request) (*url.URL, error) {
+		for _, raw := range []string{proxyURL, config.Get("outboundProxy")} {
+			if raw == "" {
+				continue
+			}
+			if u, err := config.ParseProxy(raw); err == nil {
+				return u, nil
+			}
+		}
+		return http.ProxyFromEnvironment(r)
+	}
+}
+
+// OutboundTransport is a clone of the default transport going through
+// OutboundProxy(proxyURL).
+func OutboundTransport(proxyURL string) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = OutboundProxy(proxyURL)
+	return transport
+}
+
+// sharedRange is the carrier-grade NAT range, which cloud providers also
+// use for metadata services.
+var sharedRange = netip.MustParsePrefix("100.64.0.0/10")
+
+// AllowedAddress reports whether users may make the server connect to
+// addr. Private, loopback, link-local (which holds cloud metadata
+// services), shared, unspecified and multicast addresses are blocked
+// unless they are in the outboundAllowedNetworks option.
+func AllowedAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, item := range config.List("outboundAllowedNetworks") {
+		if prefix, err := config.ParsePrefix(item); err == nil && prefix.Masked().Contains(addr) {
+			return true
+		}
+	}
+	return !(addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() ||
+		addr.IsUnspecified() || sharedRange.Contains(addr) || addr.Is4() && addr.As4()[0] == 0)
+}
+
+// GuardDialer makes d refuse to connect to blocked addresses. The check
+// runs on the resolved address, so host names that resolve to a blocked
+// address, even after a first lookup was allowed, are refused too.
+func GuardDialer(d *net.Dialer) *net.Dialer {
+	d.Control = func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		addr, err := netip.ParseAddr(host)
+		if err != nil || !AllowedAddress(addr) {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+		}
+		return nil
+	}
+	return d
+}
+
+// GuardedDialContext dials like d, refusing blocked addresses except the
+// outbound proxy of the instance, which an admin chose and which often
+// sits in a private network.
+func GuardedDialContext(d *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	guarded := *d
+	GuardDialer(&guarded)
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(address); err == nil && instanceProxy(host) {
+			return d.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+}
+
+// instanceProxy reports whether host is the outbound proxy of the instance
+// or of the environment.
+func instanceProxy(host string) bool {
+	for _, raw := range []string{config.Get("outboundProxy"), os.Getenv("HTTPS_PROXY"), os.Getenv("https_proxy"), os.Getenv("HTTP_PROXY"), os.Getenv("http_proxy")} {
+		if raw == "" {
+			continue
+		}
+		if !strings.Contains(raw, "://") {
+			raw = "http://" + raw
+		}
+		if u, err := url.Parse(raw); err == nil && u.Hostname() == host {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateOutboundURL checks a URL a user wants the server to call, so a
+// blocked address is reported when it is saved rather than on first use.
+// Host names that cannot be resolved yet pass, the dialer checks them.
+func ValidateOutboundURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("must be an http or https URL")
+	}
+	addrs := []netip.Addr{}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		addrs = append(addrs, addr)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		addrs, _ = net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !AllowedAddress(addr) {
+			return fmt.Errorf("%w: %s resolves to %s, an admin can allow it in outboundAllowedNetworks", ErrBlockedAddress, u.Hostname(), addr.Unmap())
+		}
+	}
+	return nil
+}
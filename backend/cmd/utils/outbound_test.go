@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestAllowedAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"169.254.169.254", false},
+		{"fd00:ec2::254", false},
+		{"100.100.100.200", false},
+		{"10.0.0.5", false},
+		{"192.168.1.20", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::ffff:169.254.169.254", false},
+		// loopback is allowed by default for local model servers
+		{"127.0.0.1", true},
+		{"::1", true},
+	}
+	for _, tt := range tests {
+		if got := AllowedAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("AllowedAddress(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+
+	t.Setenv("OUTBOUND_ALLOWED_NETWORKS", "192.168.1.0/24")
+	if !AllowedAddress(netip.MustParseAddr("192.168.1.20")) {
+		t.Error("expected an allowed network to be reachable")
+	}
+	if AllowedAddress(netip.MustParseAddr("127.0.0.1")) {
+		t.Error("expected loopback to be blocked once it is not listed")
+	}
+}
+
+func TestValidateOutboundURL(t *testing.T) {
+	for _, raw := range []string{"https://api.openai.com/v1", "http://127.0.0.1:11434/v1", "https://unresolvable.invalid/v1"} {
+		if err := ValidateOutboundURL(raw); err != nil {
+			t.Errorf("expected %s to be valid, got %v", raw, err)
+		}
+	}
+	for _, raw := range []string{"http://169.254.169.254/latest/meta-data", "http://[fd00:ec2::254]/", "http://10.1.2.3:8080/mcp"} {
+		if err := ValidateOutboundURL(raw); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("expected %s to be blocked, got %v", raw, err)
+		}
+	}
+	if err := ValidateOutboundURL("file:///etc/passwd"); err == nil {
+		t.Error("expected a file URL to be rejected")
+	}
+}
+
+func TestOutboundRefusesBlockedAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	client := &http.Client{Transport: Outbound}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected loopback to be reachable by default, got %v", err)
+	}
+	resp.Body.Close()
+
+	t.Setenv("OUTBOUND_ALLOWED_NETWORKS", "192.168.1.0/24")
+	client.CloseIdleConnections()
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("expected the dial to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Bajahaw/ai-ui/cmd/config"
+)
+
+type forwardedKey struct{}
+
+// forwarded is the scheme and host the client used, as seen before any
+// reverse proxy. The scheme is empty when neither TLS nor a trusted proxy
+// tells it.
+type forwarded struct {
+	scheme string
+	host   string
+}
+
+var trusted struct {
+	mu   sync.Mutex
+	raw  string
+	nets []netip.Prefix
+}
+
+// trustedProxies parses the trustedProxies option, reusing the last
+// result while the option is unchanged.
+func trustedProxies() []netip.Prefix {
+	raw := config.Get("trustedProxies")
+	trusted.mu.Lock()
+	defer trusted.mu.Unlock()
+	if raw != trusted.raw || (raw != "" && trusted.nets == nil) {
+		trusted.raw, trusted.nets = raw, nil
+		for _, item := range config.List("trustedProxies") {
+			if prefix, err := config.ParsePrefix(item); err == nil {
+				trusted.nets = append(trusted.nets, prefix.Masked())
+			}
+		}
+	}
+	return trusted.nets
+}
+
+func isTrusted(addr netip.Addr, nets []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range nets {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return addr.Unmap(), err == nil
+}
+
+// clientIP walks X-Forwarded-For from the closest hop and returns the
+// first address that is not a trusted proxy. Entries further left are set
+// by the client and cannot be trusted.
+func clientIP(r *http.Request, remote netip.Addr, nets []netip.Prefix) netip.Addr {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	if len(hops) == 0 {
+		if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return realIP.Unmap()
+		}
+		return remote
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !isTrusted(client, nets) {
+			break
+		}
+	}
+	return client
+}
+
+func firstValue(header string) string {
+	v, _, _ := strings.Cut(header, ",")
+	return strings.TrimSpace(v)
+}
+
+// proxyMiddleware honors the X-Forwarded-* headers of trusted proxies: the
+// client IP replaces RemoteAddr, and the original scheme and host are kept
+// for RequestScheme and RequestHost. Headers from other peers are ignored.
+func proxyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fwd := forwarded{host: r.Host}
+		if r.TLS != nil {
+			fwd.scheme = "https"
+		}
+
+		nets := trustedProxies()
+		if remote, ok := remoteIP(r); ok && isTrusted(remote, nets) {
+			r.RemoteAddr = net.JoinHostPort(clientIP(r, remote, nets).String(), "0")
+			if proto := strings.ToLower(firstValue(r.Header.Get("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+				fwd.scheme = proto
+			}
+			if host := firstValue(r.Header.Get("X-Forwarded-Host")); host != "" {
+				fwd.host = host
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), forwardedKey{}, fwd)))
+	})
+}
+
+func requestForwarded(r *http.Request) forwarded {
+	if fwd, ok := r.Context().Value(forwardedKey{}).(forwarded); ok {
+		return fwd
+	}
+	fwd := forwarded{host: r.Host}
+	if r.TLS != nil {
+		fwd.scheme = "https"
+	}
+	return fwd
+}
+
+// RequestScheme is the scheme the client used to reach the server. When
+// neither TLS nor a trusted proxy tells it, the server is assumed to sit
+// behind a TLS terminating proxy and it is https, or http with ENV=dev.
+func RequestScheme(r *http.Request) string {
+	if scheme := requestForwarded(r).scheme; scheme != "" {
+		return scheme
+	}
+	if os.Getenv("ENV") == "dev" {
+		return "http"
+	}
+	return "https"
+}
+
+// RequestHost is the host the client used to reach the server.
+func RequestHost(r *http.Request) string {
+	return requestForwarded(r).host
+}
+
+// ClientIP is the address of the client, without the port.
+func ClientIP(r *http.Request) string {
+	if addr, ok := remoteIP(r); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    string
+		env        string
+		remote     string
+		headers    map[string]string
+		wantIP     string
+		wantServer string
+	}{
+		{
+			name:       "untrusted peer headers are ignored",
+			remote:     "203.0.113.7:5000",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Proto": "http", "X-Forwarded-Host": "evil.example"},
+			wantIP:     "203.0.113.7",
+			wantServer: "https://chat.example.com",
+		},
+		{
+			name:       "plain http in development",
+			env:        "dev",
+			remote:     "203.0.113.7:5000",
+			wantIP:     "203.0.113.7",
+			wantServer: "http://chat.example.com",
+		},
+		{
+			name:       "trusted proxy without TLS",
+			trusted:    "10.0.0.0/8",
+			remote:     "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-Proto": "http"},
+			wantIP:     "10.0.0.2",
+			wantServer: "http://chat.example.com",
+		},
+		{
+			name:       "trusted proxy",
+			trusted:    "10.0.0.0/8",
+			remote:     "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.9", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "public.example.com"},
+			wantIP:     "198.51.100.9",
+			wantServer: "https://public.example.com",
+		},
+		{
+			name:    "spoofed entries left of the proxies are skipped",
+			trusted: "10.0.0.2, 172.16.0.0/12",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.9, 172.16.0.5"},
+			wantIP:  "198.51.100.9",
+		},
+		{
+			name:    "X-Real-IP without X-Forwarded-For",
+			trusted: "10.0.0.2",
+			remote:  "10.0.0.2:5000",
+			headers: map[string]string{"X-Real-IP": "198.51.100.9"},
+			wantIP:  "198.51.100.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.trusted)
+			t.Setenv("ENV", tt.env)
+			var gotIP, gotServer string
+			handler := proxyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotIP, gotServer = ClientIP(r), GetServerURL(r)
+			}))
+
+			req := httptest.NewRequest("GET", "http://chat.example.com/api/chat", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if gotIP != tt.wantIP {
+				t.Errorf("client IP = %q, want %q", gotIP, tt.wantIP)
+			}
+			if tt.wantServer != "" && gotServer != tt.wantServer {
+				t.Errorf("server URL = %q, want %q", gotServer, tt.wantServer)
+			}
+		})
+	}
+}
+
+func TestGetServerURL_PublicURL(t *testing.T) {
+	t.Setenv("PUBLIC_URL", "https://chat.example.com/")
+	req := httptest.NewRequest("GET", "http://10.0.0.2:8080/", nil)
+	if got := GetServerURL(req); got != "https://chat.example.com" {
+		t.Errorf("GetServerURL = %q", got)
+	}
+}
@@ -1,30 +1,71 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/apierr"
+	"github.com/Bajahaw/ai-ui/cmd/config"
 )
 
+// HeartbeatInterval is how long a stream may stay silent before it gets a
+// comment line, well below the usual 60s idle timeout of reverse proxies.
+func HeartbeatInterval() time.Duration {
+	return config.Duration("streamHeartbeatInterval")
+}
+
 const (
-	EVENT_METADATA = "metadata"
-	EVENT_ERROR    = "error"
-	EVENT_CHUNK    = "chunk"
-	EVENT_COMPLETE = "complete"
-	TOOL_CALL      = "tool_call"
-	CONTENT        = "content"
-	REASONING      = "reasoning"
+	EVENT_METADATA   = "metadata"
+	EVENT_ERROR      = "error"
+	EVENT_CHUNK      = "chunk"
+	EVENT_COMPLETE   = "complete"
+	EVENT_USAGE      = "usage"
+	EVENT_MODERATION = "moderation"
+	TOOL_CALL        = "tool_call"
+	CONTENT          = "content"
+	REASONING        = "reasoning"
 )
 
+// EVENT_TOOL_BUDGET is sent when an answer used up its tool calls and is
+// finished without tools.
+const EVENT_TOOL_BUDGET = "tool_budget_exceeded"
+
+// ErrClientGone is returned when a chunk cannot be written because the
+// client went away.
+var ErrClientGone = errors.New("client disconnected")
+
 type StreamClient struct {
 	User      string
 	MessageID int
 	Writer    http.ResponseWriter
+	// Context is the request context, it is done once the client disconnects
+	Context context.Context
+	// OnOutput is called before every chunk of the answer (content,
+	// reasoning or tool calls) is sent, optional
+	OnOutput func()
+	// Transform rewrites every chunk before it is sent, optional. A chunk
+	// left with an empty text payload is not sent.
+	Transform func(chunk StreamChunk) StreamChunk
+	// batch coalesces text chunks, set by Batch
+	batch *chunkBatch
+}
+
+// Gone reports whether the client of the stream disconnected.
+func (c StreamClient) Gone() bool {
+	return c.Context != nil && c.Context.Err() != nil
 }
 
 type StreamChunk struct {
 	Type    string `json:"type"`
 	Payload any    `json:"payload"`
+	// Code is an optional machine readable reason sent with error events
+	Code apierr.Code `json:"code,omitempty"`
 }
 
 type StreamMetadata struct {
@@ -40,6 +81,15 @@ type StreamComplete struct {
 	StreamStats        StreamStats `json:"streamStats"`
 }
 
+// StreamUsage sent after every completion of a response,
+// including the follow-ups after tool calls
+type StreamUsage struct {
+	Model            string   `json:"model"`
+	PromptTokens     int      `json:"promptTokens"`
+	CompletionTokens int      `json:"completionTokens"`
+	Cost             *float64 `json:"cost,omitempty"`
+}
+
 type StreamStats struct {
 	// PromptTokens or Context Size or Input tokens
 	PromptTokens int
@@ -59,9 +109,22 @@ func AddStreamHeaders(w http.ResponseWriter) {
 }
 
 func SendStreamChunk(client StreamClient, chunk StreamChunk) error {
-	err := streamChunk(client.Writer, chunk)
-	// Stream cache removed
-	return err
+	if client.Gone() {
+		return ErrClientGone
+	}
+	if client.OnOutput != nil && (chunk.Type == CONTENT || chunk.Type == REASONING || chunk.Type == TOOL_CALL) {
+		client.OnOutput()
+	}
+	if client.Transform != nil {
+		chunk = client.Transform(chunk)
+		if chunk.Payload == "" {
+			return nil
+		}
+	}
+	if client.batch != nil {
+		return client.batch.send(chunk)
+	}
+	return streamChunk(client.Writer, chunk)
 }
 
 func streamChunk(w http.ResponseWriter, chunk StreamChunk) error {
@@ -75,13 +138,178 @@ func streamChunk(w http.ResponseWriter, chunk StreamChunk) error {
 		return err
 	}
 
-	if chunk.Type == EVENT_ERROR || chunk.Type == EVENT_METADATA || chunk.Type == EVENT_COMPLETE {
-		fmt.Fprintf(w, "event: %s\ndata: { \"%s\": %s }\n\n", chunk.Type, chunk.Type, payload)
+	switch {
+	case chunk.Type == EVENT_ERROR && chunk.Code != "":
+		_, err = fmt.Fprintf(w, "event: %s\ndata: { \"%s\": %s, \"code\": %q }\n\n", chunk.Type, chunk.Type, payload, chunk.Code)
+	case chunk.Type == EVENT_ERROR || chunk.Type == EVENT_METADATA || chunk.Type == EVENT_COMPLETE || chunk.Type == EVENT_USAGE || chunk.Type == EVENT_MODERATION:
+		_, err = fmt.Fprintf(w, "event: %s\ndata: { \"%s\": %s }\n\n", chunk.Type, chunk.Type, payload)
+	default:
+		_, err = fmt.Fprintf(w, "data: { \"%s\": %s }\n\n", chunk.Type, payload)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrClientGone, err)
+	}
+	flusher.Flush()
+	return nil
+}
+
+// syncWriter serializes writes so the heartbeat can share the response
+// with the handler. Every SSE frame is written with a single Write call.
+type syncWriter struct {
+	http.ResponseWriter
+	mu sync.Mutex
+	// written is when the last frame was written
+	written time.Time
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.written = time.Now()
+	return w.ResponseWriter.Write(p)
+}
+
+// idle reports whether nothing was written for d.
+func (w *syncWriter) idle(d time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return time.Since(w.written) >= d
+}
+
+func (w *syncWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
 		flusher.Flush()
-		return nil
 	}
+}
 
-	fmt.Fprintf(w, "data: { \"%s\": %s }\n\n", chunk.Type, payload)
-	flusher.Flush()
+func (w *syncWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// KeepAlive sends an SSE comment once the stream was silent for interval,
+// so proxies do not drop the connection while the model is thinking or a
+// tool is running. The returned client must be used for all writes until
+// stop is called.
+func KeepAlive(client StreamClient, interval time.Duration) (StreamClient, func()) {
+	w := &syncWriter{ResponseWriter: client.Writer, written: time.Now()}
+	client.Writer = w
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !w.idle(interval) {
+					continue
+				}
+				if _, err := w.Write([]byte(": ping\n\n")); err != nil {
+					return
+				}
+				w.Flush()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return client, func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// Batch coalesces consecutive content or reasoning chunks of client into
+// one SSE frame, written once interval passed since the first of them or
+// maxBytes of text are pending. Any other chunk writes the pending text
+// first, so the order is kept. Fast models otherwise cost a write and a
+// flush per token. A zero interval turns batching off.
+//
+// The returned client must be used for all writes, and flush called
+// before the handler returns.
+func Batch(client StreamClient, interval time.Duration, maxBytes int) (StreamClient, func()) {
+	if interval <= 0 {
+		return client, func() {}
+	}
+	// the timer writes from its own goroutine
+	if _, ok := client.Writer.(*syncWriter); !ok {
+		client.Writer = &syncWriter{ResponseWriter: client.Writer}
+	}
+	b := &chunkBatch{w: client.Writer, interval: interval, maxBytes: maxBytes}
+	client.batch = b
+	return client, b.flush
+}
+
+type chunkBatch struct {
+	mu       sync.Mutex
+	w        http.ResponseWriter
+	interval time.Duration
+	maxBytes int
+
+	typ   string
+	text  strings.Builder
+	timer *time.Timer
+	// err is the failed write of a timed flush, returned by the next send
+	err error
+}
+
+func (b *chunkBatch) send(chunk StreamChunk) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+
+	text, ok := chunk.Payload.(string)
+	if !ok || (chunk.Type != CONTENT && chunk.Type != REASONING) {
+		if err := b.flushLocked(); err != nil {
+			return err
+		}
+		return streamChunk(b.w, chunk)
+	}
+	if chunk.Type != b.typ {
+		if err := b.flushLocked(); err != nil {
+			return err
+		}
+		b.typ = chunk.Type
+	}
+	b.text.WriteString(text)
+	if b.maxBytes > 0 && b.text.Len() >= b.maxBytes {
+		return b.flushLocked()
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.interval, b.flush)
+	}
+	return nil
+}
+
+func (b *chunkBatch) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_ = b.flushLocked()
+}
+
+func (b *chunkBatch) flushLocked() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.text.Len() == 0 {
+		return nil
+	}
+	chunk := StreamChunk{Type: b.typ, Payload: b.text.String()}
+	b.text.Reset()
+	if err := streamChunk(b.w, chunk); err != nil {
+		b.err = err
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveSendsHeartbeat(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sc, stop := KeepAlive(StreamClient{Writer: rec}, 10*time.Millisecond)
+
+	time.Sleep(35 * time.Millisecond)
+	if err := SendStreamChunk(sc, StreamChunk{Type: CONTENT, Payload: "hi"}); err != nil {
+		t.Fatalf("SendStreamChunk: %v", err)
+	}
+	stop()
+	stop()
+
+	body := rec.Body.String()
+	if !strings.Contains(body, ": ping\n\n") {
+		t.Errorf("expected heartbeat comment, got %q", body)
+	}
+	if !strings.Contains(body, `data: { "content": "hi" }`) {
+		t.Errorf("expected content chunk, got %q", body)
+	}
+
+	// nothing is written after stop
+	n := rec.Body.Len()
+	time.Sleep(25 * time.Millisecond)
+	if rec.Body.Len() != n {
+		t.Errorf("heartbeat kept writing after stop")
+	}
+}
+
+func TestKeepAliveOnlyPingsIdleStreams(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sc, stop := KeepAlive(StreamClient{Writer: rec}, 20*time.Millisecond)
+	for range 12 {
+		_ = SendStreamChunk(sc, StreamChunk{Type: CONTENT, Payload: "tok"})
+		time.Sleep(5 * time.Millisecond)
+	}
+	stop()
+
+	if strings.Contains(rec.Body.String(), ": ping") {
+		t.Errorf("expected no heartbeat while chunks are sent, got %q", rec.Body.String())
+	}
+}
+
+func TestErrorChunkCode(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sc := StreamClient{Writer: rec}
+
+	_ = SendStreamChunk(sc, StreamChunk{Type: EVENT_ERROR, Payload: "timed out", Code: "provider_timeout"})
+	_ = SendStreamChunk(sc, StreamChunk{Type: EVENT_ERROR, Payload: "boom"})
+
+	want := "event: error\ndata: { \"error\": \"timed out\", \"code\": \"provider_timeout\" }\n\n" +
+		"event: error\ndata: { \"error\": \"boom\" }\n\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+type brokenWriter struct{ *httptest.ResponseRecorder }
+
+func (brokenWriter) Write([]byte) (int, error) { return 0, errors.New("broken pipe") }
+
+func TestSendStreamChunkClientGone(t *testing.T) {
+	err := SendStreamChunk(StreamClient{Writer: brokenWriter{httptest.NewRecorder()}}, StreamChunk{Type: CONTENT, Payload: "hi"})
+	if !errors.Is(err, ErrClientGone) {
+		t.Errorf("expected ErrClientGone on write failure, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	err = SendStreamChunk(StreamClient{Writer: rec, Context: ctx}, StreamChunk{Type: CONTENT, Payload: "hi"})
+	if !errors.Is(err, ErrClientGone) || rec.Body.Len() != 0 {
+		t.Errorf("expected nothing written after disconnect, got %v %q", err, rec.Body.String())
+	}
+}
+
+func TestBatchCoalescesText(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sc, flush := Batch(StreamClient{Writer: rec}, time.Hour, 12)
+
+	for _, chunk := range []StreamChunk{
+		{Type: REASONING, Payload: "think"},
+		{Type: CONTENT, Payload: "Hel"},
+		{Type: CONTENT, Payload: "lo"},
+		{Type: EVENT_USAGE, Payload: 1},
+		{Type: CONTENT, Payload: " wor"},
+		{Type: CONTENT, Payload: "ld, again"},
+		{Type: CONTENT, Payload: "!"},
+	} {
+		if err := SendStreamChunk(sc, chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flush()
+
+	want := `data: { "reasoning": "think" }` + "\n\n" +
+		`data: { "content": "Hello" }` + "\n\n" +
+		"event: usage\ndata: { \"usage\": 1 }\n\n" +
+		`data: { "content": " world, again" }` + "\n\n" +
+		`data: { "content": "!" }` + "\n\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBatchFlushesAfterInterval(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sc, flush := Batch(StreamClient{Writer: rec}, 5*time.Millisecond, 0)
+	defer flush()
+
+	_ = SendStreamChunk(sc, StreamChunk{Type: CONTENT, Payload: "hi"})
+	time.Sleep(30 * time.Millisecond)
+	sc.Writer.(*syncWriter).mu.Lock()
+	body := rec.Body.String()
+	sc.Writer.(*syncWriter).mu.Unlock()
+	if body != `data: { "content": "hi" }`+"\n\n" {
+		t.Errorf("expected the text sent after the interval, got %q", body)
+	}
+}
+
+// flushCounter counts the flushes of a stream, each is a write to the
+// client's connection.
+type flushCounter struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (w *flushCounter) Flush() { w.flushes++ }
+
+func benchmarkStream(b *testing.B, interval time.Duration) {
+	for b.Loop() {
+		w := &flushCounter{ResponseRecorder: httptest.NewRecorder()}
+		sc, flush := Batch(StreamClient{Writer: w}, interval, 4096)
+		for range 1000 {
+			_ = SendStreamChunk(sc, StreamChunk{Type: CONTENT, Payload: "tok "})
+		}
+		flush()
+		b.ReportMetric(float64(w.flushes), "flushes/op")
+	}
+}
+
+func BenchmarkStreamTokens(b *testing.B) {
+	b.Run("unbatched", func(b *testing.B) { benchmarkStream(b, 0) })
+	b.Run("batched", func(b *testing.B) { benchmarkStream(b, 20*time.Millisecond) })
+}
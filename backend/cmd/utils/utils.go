@@ -1,19 +1,24 @@
 package utils
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	url2 "net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Bajahaw/ai-ui/cmd/config"
 	logger "github.com/charmbracelet/log"
 )
 
 var log *logger.Logger
-var ServerURL = ""
 
 func Setup(l *logger.Logger) {
 	log = l
@@ -23,13 +28,18 @@ func Setup(l *logger.Logger) {
 //////////////////////////////// Helper Functions ////////////////////////////////
 //////////////////////////////////////////////////////////////////////////////////
 
-// corsMiddleware currently used for local vite server
+// corsMiddleware allows browsers on the configured origins to call the
+// API, and any origin in dev mode for the local vite server.
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
+		if origin == "" || (os.Getenv("ENV") != "dev" && !slices.Contains(config.List("corsOrigins"), origin)) {
+			next.ServeHTTP(w, r)
+			return
+		}
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Session-ID")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Session-ID, Idempotency-Key")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -46,6 +56,9 @@ func ExtractJSONBody(r *http.Request, v any) error {
 	if err != nil {
 		return err
 	}
+	if dec.More() {
+		return errors.New("unexpected data after JSON body")
+	}
 	if err := r.Body.Close(); err != nil {
 		return err
 	}
@@ -57,7 +70,7 @@ func RespondWithJSON(w http.ResponseWriter, data any, statusCode int) {
 
 	buf, err := json.Marshal(data)
 	if err != nil {
-		http.Error(w, "failed to encode JSON", http.StatusInternalServerError)
+		Error(w, "failed to encode JSON", http.StatusInternalServerError)
 		return
 	}
 
@@ -107,6 +120,12 @@ func (r *statusRecorder) Flush() {
 	}
 }
 
+// Hijack implements http.Hijacker to support websocket upgrades
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(r.ResponseWriter).Hijack()
+}
+
 
 func cacheControlMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -150,6 +169,7 @@ func logMiddleware(next http.Handler) http.Handler {
 			"method", r.Method,
 			"duration", durationStr,
 			"path", r.URL.Path,
+			"ip", ClientIP(r),
 		)
 	})
 }
@@ -157,13 +177,12 @@ func logMiddleware(next http.Handler) http.Handler {
 func Middleware(next http.Handler) http.Handler {
 	var middlewares []func(http.Handler) http.Handler
 
-	if os.Getenv("ENV") == "dev" {
-		log.Debug("Development mode CORS active")
-		middlewares = append(middlewares, corsMiddleware)
-	}
-
+	middlewares = append(middlewares, corsMiddleware)
+	middlewares = append(middlewares, bodyMiddleware)
 	middlewares = append(middlewares, cacheControlMiddleware)
+	middlewares = append(middlewares, compressMiddleware)
 	middlewares = append(middlewares, logMiddleware)
+	middlewares = append(middlewares, proxyMiddleware)
 
 	for _, m := range middlewares {
 		next = m(next)
@@ -171,19 +190,13 @@ func Middleware(next http.Handler) http.Handler {
 	return next
 }
 
+// GetServerURL is the base URL clients reach the server at: the publicURL
+// option when set, otherwise the scheme and host of the request.
 func GetServerURL(r *http.Request) string {
-	if ServerURL != "" {
-		return ServerURL
-	}
-	scheme := "https"
-	if os.Getenv("ENV") == "dev" {
-		scheme = "http"
+	if public := config.Get("publicURL"); public != "" {
+		return strings.TrimSuffix(public, "/")
 	}
-	// if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
-	// 	scheme = "https"
-	// }
-	ServerURL = scheme + "://" + r.Host
-	return ServerURL
+	return RequestScheme(r) + "://" + RequestHost(r)
 }
 
 func ExtractProviderName(url string) string {
@@ -212,6 +225,20 @@ func SqlPlaceholders(n int) string {
 	return strings.Join(placeholders, ", ")
 }
 
+// QueryLimit reads the limit query parameter, def when it is missing and at
+// most max.
+func QueryLimit(r *http.Request, def int, max int) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	return min(limit, max), nil
+}
+
 func ExtractContextUser(r *http.Request) string {
 	user := r.Context().Value("user").(string)
 	return user
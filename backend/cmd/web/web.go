@@ -0,0 +1,66 @@
+// Package web serves the frontend. Release builds embed it, so the binary
+// runs without a static directory next to it.
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+)
+
+// dist is filled with the frontend build (frontend/dist) before compiling.
+// It only holds a placeholder in a source checkout.
+//
+//go:embed all:dist
+var dist embed.FS
+
+// Assets returns the frontend files and where they come from: STATIC_DIR
+// when set, otherwise the embedded build, falling back to ./static for
+// binaries built without the frontend.
+func Assets() (fs.FS, string) {
+	if dir := os.Getenv("STATIC_DIR"); dir != "" {
+		return os.DirFS(dir), dir
+	}
+	embedded, _ := fs.Sub(dist, "dist")
+	if _, err := fs.Stat(embedded, "index.html"); err == nil {
+		return embedded, "embedded"
+	}
+	return os.DirFS("./static"), "./static"
+}
+
+// Handler serves the frontend files and answers every other path with
+// index.html so client side routes work on a hard refresh. Unknown API and
+// data paths get a 404 instead of the app shell.
+func Handler(assets fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		urlPath := path.Clean("/" + r.URL.Path)
+		if strings.HasPrefix(urlPath, "/api/") || strings.HasPrefix(urlPath, "/data/") {
+			utils.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+
+		name := strings.TrimPrefix(urlPath, "/")
+		if info, err := fs.Stat(assets, name); name != "" && err == nil && !info.IsDir() {
+			if strings.HasPrefix(name, "assets/") {
+				// vite puts a content hash in the names of these files
+				w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			}
+			http.ServeFileFS(w, r, assets, name)
+			return
+		}
+
+		index, err := fs.ReadFile(assets, "index.html")
+		if err != nil {
+			utils.Error(w, "Frontend not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(index)
+	})
+}
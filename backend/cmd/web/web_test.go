@@ -0,0 +1,54 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHandler(t *testing.T) {
+	assets := fstest.MapFS{
+		"index.html":       {Data: []byte("<html>app</html>")},
+		"assets/app-1a.js": {Data: []byte("console.log(1)")},
+		"favicon.svg":      {Data: []byte("<svg/>")},
+	}
+	handler := Handler(assets)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/", http.StatusOK, "<html>app</html>"},
+		{"/c/123", http.StatusOK, "<html>app</html>"},
+		{"/assets/app-1a.js", http.StatusOK, "console.log(1)"},
+		{"/favicon.svg", http.StatusOK, "<svg/>"},
+		{"/assets", http.StatusOK, "<html>app</html>"},
+		{"/../../etc/passwd", http.StatusOK, "<html>app</html>"},
+		{"/api/unknown", http.StatusNotFound, "NOT_FOUND"},
+		{"/data/other/file", http.StatusNotFound, "NOT_FOUND"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantBody) {
+			t.Errorf("%s: got %d %q", tt.path, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/assets/app-1a.js", nil))
+	if !strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+		t.Errorf("hashed assets should be cached, got %q", w.Header().Get("Cache-Control"))
+	}
+}
+
+func TestAssets(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("STATIC_DIR", dir)
+	if _, source := Assets(); source != dir {
+		t.Errorf("STATIC_DIR should take precedence, got %q", source)
+	}
+}
@@ -0,0 +1,136 @@
+package webhooks
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type Webhook struct {
+	ID        int64    `json:"id"`
+	User      string   `json:"-"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret,omitempty"`
+	Events    []string `json:"events"`
+	IsEnabled bool     `json:"isEnabled"`
+	// LastStatus is the HTTP status of the last delivery, 0 when it failed
+	// before a response or there was none yet
+	LastStatus     int        `json:"lastStatus,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	LastDeliveryAt *time.Time `json:"lastDeliveryAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+type Repository interface {
+	GetAll(user string) ([]*Webhook, error)
+	GetByID(id int64, user string) (*Webhook, error)
+	// GetSubscribed returns the enabled webhooks of the user for the event.
+	GetSubscribed(user string, event string) ([]*Webhook, error)
+	Save(webhook *Webhook) error
+	Update(webhook *Webhook) error
+	SaveDelivery(id int64, status int, deliveryErr string) error
+	DeleteByID(id int64, user string) error
+}
+
+type RepositoryImpl struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) Repository {
+	return &RepositoryImpl{db: db}
+}
+
+const webhookColumns = `id, user, url, secret, events, is_enabled, COALESCE(last_status, 0), COALESCE(last_error, ''), last_delivery_at, created_at`
+
+func scanWebhook(row interface{ Scan(...any) error }) (*Webhook, error) {
+	var w Webhook
+	var events string
+	var lastDelivery sql.NullTime
+	err := row.Scan(&w.ID, &w.User, &w.URL, &w.Secret, &events, &w.IsEnabled,
+		&w.LastStatus, &w.LastError, &lastDelivery, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	w.Events = strings.Split(events, ",")
+	if lastDelivery.Valid {
+		w.LastDeliveryAt = &lastDelivery.Time
+	}
+	return &w, nil
+}
+
+func (r *RepositoryImpl) query(query string, args ...any) ([]*Webhook, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]*Webhook, 0)
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (r *RepositoryImpl) GetAll(user string) ([]*Webhook, error) {
+	return r.query(`SELECT `+webhookColumns+` FROM Webhooks WHERE user = ? ORDER BY id`, user)
+}
+
+func (r *RepositoryImpl) GetByID(id int64, user string) (*Webhook, error) {
+	row := r.db.QueryRow(`SELECT `+webhookColumns+` FROM Webhooks WHERE id = ? AND user = ?`, id, user)
+	return scanWebhook(row)
+}
+
+func (r *RepositoryImpl) GetSubscribed(user string, event string) ([]*Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM Webhooks
+		WHERE user = ? AND is_enabled = 1 AND ',' || events || ',' LIKE '%,' || ? || ',%'
+		ORDER BY id
+	`
+	return r.query(query, user, event)
+}
+
+func (r *RepositoryImpl) Save(w *Webhook) error {
+	w.CreatedAt = time.Now().UTC()
+	query := `INSERT INTO Webhooks (user, url, secret, events, is_enabled, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	res, err := r.db.Exec(query, w.User, w.URL, w.Secret, strings.Join(w.Events, ","), w.IsEnabled, w.CreatedAt)
+	if err != nil {
+		return err
+	}
+	w.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *RepositoryImpl) Update(w *Webhook) error {
+	query := `UPDATE Webhooks SET url = ?, events = ?, is_enabled = ? WHERE id = ? AND user = ?`
+	res, err := r.db.Exec(query, w.URL, strings.Join(w.Events, ","), w.IsEnabled, w.ID, w.User)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *RepositoryImpl) SaveDelivery(id int64, status int, deliveryErr string) error {
+	query := `UPDATE Webhooks SET last_status = ?, last_error = ?, last_delivery_at = ? WHERE id = ?`
+	_, err := r.db.Exec(query, status, deliveryErr, time.Now().UTC(), id)
+	return err
+}
+
+func (r *RepositoryImpl) DeleteByID(id int64, user string) error {
+	res, err := r.db.Exec(`DELETE FROM Webhooks WHERE id = ? AND user = ?`, id, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/auth"
+	"github.com/Bajahaw/ai-ui/cmd/openapi"
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+const maxWebhooks = 20
+
+type WebhookRequest struct {
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	IsEnabled *bool    `json:"isEnabled,omitempty"`
+}
+
+type WebhooksResponse struct {
+	Webhooks []*Webhook `json:"webhooks"`
+}
+
+type TestResponse struct {
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func Handler() http.Handler {
+	mux := openapi.NewRouter("/api/webhooks", "Webhooks")
+
+	mux.HandleFunc("GET /", listWebhooks, openapi.Op{Summary: "List webhooks", Response: WebhooksResponse{}})
+	mux.HandleFunc("POST /", createWebhook, openapi.Op{Summary: "Register a webhook, its secret is only returned here", Request: WebhookRequest{}, Response: Webhook{}, Status: http.StatusCreated})
+	mux.HandleFunc("PUT /{id}", updateWebhook, openapi.Op{Summary: "Change a webhook", Request: WebhookRequest{}, Response: Webhook{}})
+	mux.HandleFunc("DELETE /{id}", deleteWebhook, openapi.Op{Summary: "Delete a webhook", Status: http.StatusNoContent})
+	mux.HandleFunc("POST /{id}/test", testWebhook, openapi.Op{Summary: "Send a ping event to a webhook", Response: TestResponse{}})
+
+	return http.StripPrefix("/api/webhooks", auth.Authenticated(mux))
+}
+
+func listWebhooks(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	webhooks, err := repo.GetAll(user)
+	if err != nil {
+		log.Error("Error querying webhooks", "err", err)
+		utils.Error(w, "Error querying webhooks", http.StatusInternalServerError)
+		return
+	}
+	for _, wh := range webhooks {
+		wh.Secret = ""
+	}
+
+	response := WebhooksResponse{Webhooks: webhooks}
+	utils.RespondWithJSON(w, &response, http.StatusOK)
+}
+
+// createWebhook registers a webhook. Its signing secret is only returned
+// here, the receiver has to keep it.
+func createWebhook(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	var req WebhookRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		utils.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	existing, err := repo.GetAll(user)
+	if err != nil {
+		log.Error("Error querying webhooks", "err", err)
+		utils.Error(w, "Error querying webhooks", http.StatusInternalServerError)
+		return
+	}
+	if len(existing) >= maxWebhooks {
+		utils.Error(w, "Too many webhooks, delete one first", http.StatusBadRequest)
+		return
+	}
+
+	wh := &Webhook{
+		User:      user,
+		URL:       req.URL,
+		Secret:    rand.Text(),
+		Events:    req.Events,
+		IsEnabled: req.IsEnabled == nil || *req.IsEnabled,
+	}
+	if err := repo.Save(wh); err != nil {
+		log.Error("Error saving webhook", "err", err)
+		utils.Error(w, "Error saving webhook", http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondWithJSON(w, wh, http.StatusCreated)
+}
+
+func updateWebhook(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	wh, ok := webhookFromPath(w, r, user)
+	if !ok {
+		return
+	}
+
+	var req WebhookRequest
+	if err := utils.ExtractJSONBody(r, &req); err != nil {
+		log.Error("Error unmarshalling request body", "err", err)
+		utils.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		utils.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	wh.URL = req.URL
+	wh.Events = req.Events
+	if req.IsEnabled != nil {
+		wh.IsEnabled = *req.IsEnabled
+	}
+	if err := repo.Update(wh); err != nil {
+		log.Error("Error updating webhook", "err", err)
+		utils.Error(w, "Error updating webhook", http.StatusInternalServerError)
+		return
+	}
+
+	wh.Secret = ""
+	utils.RespondWithJSON(w, wh, http.StatusOK)
+}
+
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	err = repo.DeleteByID(id, user)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Error deleting webhook", "err", err)
+		utils.Error(w, "Error deleting webhook", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// testWebhook sends a ping event once, without retries, and reports how the
+// receiver answered.
+func testWebhook(w http.ResponseWriter, r *http.Request) {
+	user := utils.ExtractContextUser(r)
+	wh, ok := webhookFromPath(w, r, user)
+	if !ok {
+		return
+	}
+
+	payload := Payload{ID: uuid.NewString(), Event: EventPing, CreatedAt: time.Now().UTC(), Data: map[string]any{"webhookId": wh.ID}}
+	body, _ := json.Marshal(payload)
+	status, err := post(wh, payload, body)
+
+	response := TestResponse{Status: status}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	if saveErr := repo.SaveDelivery(wh.ID, status, response.Error); saveErr != nil {
+		log.Error("Error saving webhook delivery", "webhook", wh.ID, "err", saveErr)
+	}
+	utils.RespondWithJSON(w, &response, http.StatusOK)
+}
+
+func webhookFromPath(w http.ResponseWriter, r *http.Request, user string) (*Webhook, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		utils.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return nil, false
+	}
+	wh, err := repo.GetByID(id, user)
+	if err != nil {
+		utils.Error(w, "Webhook not found", http.StatusNotFound)
+		return nil, false
+	}
+	return wh, true
+}
+
+// validate returns what is wrong with the request, or "" when it is valid.
+func (req *WebhookRequest) validate() string {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "Invalid webhook URL, use an http or https URL"
+	}
+	if err := utils.ValidateOutboundURL(req.URL); err != nil {
+		return "Invalid webhook URL, " + err.Error()
+	}
+	if len(req.Events) == 0 {
+		return "Subscribe to at least one event"
+	}
+	slices.Sort(req.Events)
+	req.Events = slices.Compact(req.Events)
+	for _, event := range req.Events {
+		if !slices.Contains(Events, event) {
+			return "Unknown event " + strconv.Quote(event)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/utils"
+
+	"github.com/google/uuid"
+)
+
+// Event types a webhook can subscribe to
+const (
+	EventMessageCompleted    = "message_completed"
+	EventConversationCreated = "conversation_created"
+	EventToolFailed          = "tool_failed"
+	// EventPing is only sent by the test endpoint
+	EventPing = "ping"
+)
+
+var Events = []string{EventMessageCompleted, EventConversationCreated, EventToolFailed}
+
+// Payload is the JSON body POSTed to a webhook.
+type Payload struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      any       `json:"data"`
+}
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	timeout         = 10 * time.Second
+)
+
+// retryDelays are the waits before each retry of a failed delivery
+var retryDelays = []time.Duration{2 * time.Second, 10 * time.Second, 1 * time.Minute, 5 * time.Minute}
+
+var httpClient = &http.Client{Timeout: timeout, Transport: utils.Outbound}
+
+// pending tracks deliveries in flight, so tests can wait for them
+var pending sync.WaitGroup
+
+// Publish sends the event to every enabled webhook of the user subscribed
+// to it. Delivery happens in the background and never blocks the caller.
+func Publish(user string, event string, data any) {
+	if repo == nil {
+		return
+	}
+	webhooks, err := repo.GetSubscribed(user, event)
+	if err != nil {
+		log.Error("Error querying webhooks", "event", event, "err", err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	payload := Payload{ID: uuid.NewString(), Event: event, CreatedAt: time.Now().UTC(), Data: data}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Error("Error marshalling webhook payload", "event", event, "err", err)
+		return
+	}
+	for _, w := range webhooks {
+		pending.Add(1)
+		go func() {
+			defer pending.Done()
+			deliver(w, payload, body)
+		}()
+	}
+}
+
+// deliver POSTs the payload, retrying with backoff on network errors, rate
+// limits and server errors. The outcome of the last attempt is saved.
+func deliver(w *Webhook, payload Payload, body []byte) {
+	var status int
+	var err error
+	for attempt := 0; ; attempt++ {
+		status, err = post(w, payload, body)
+		if err == nil || attempt == len(retryDelays) || !retryable(status) {
+			break
+		}
+		log.Warn("Webhook delivery failed, retrying", "webhook", w.ID, "attempt", attempt+1, "err", err)
+		time.Sleep(retryDelays[attempt])
+	}
+
+	deliveryErr := ""
+	if err != nil {
+		deliveryErr = err.Error()
+		log.Error("Webhook delivery failed", "webhook", w.ID, "event", payload.Event, "err", err)
+	}
+	if saveErr := repo.SaveDelivery(w.ID, status, deliveryErr); saveErr != nil {
+		log.Error("Error saving webhook delivery", "webhook", w.ID, "err", saveErr)
+	}
+}
+
+func post(w *Webhook, payload Payload, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ai-ui-webhooks")
+	req.Header.Set("X-Webhook-ID", payload.ID)
+	req.Header.Set("X-Webhook-Event", payload.Event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set(SignatureHeader, Sign(w.Secret, timestamp, body))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// Sign returns the signature of a delivery, the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret. Receivers recompute
+// it to verify the sender and reject old timestamps to stop replays.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
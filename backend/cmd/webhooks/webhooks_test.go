@@ -0,0 +1,122 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Bajahaw/ai-ui/cmd/data"
+
+	logger "github.com/charmbracelet/log"
+)
+
+func setupTest(t *testing.T) {
+	if err := data.InitDataSource(path.Join(t.TempDir(), "test.db")); err != nil {
+		t.Fatalf("Failed to init data source: %v", err)
+	}
+	db := data.DB
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO Users (username, pass_hash) VALUES ('u', 'hash')"); err != nil {
+		t.Fatal(err)
+	}
+	SetupWebhooks(logger.New(os.Stdout), db)
+
+	delays := retryDelays
+	retryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+	t.Cleanup(func() { retryDelays = delays })
+}
+
+func request(method string, target string, body string, handler http.HandlerFunc, id string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, bytes.NewReader([]byte(body)))
+	req.SetPathValue("id", id)
+	req = req.WithContext(context.WithValue(req.Context(), "user", "u"))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	setupTest(t)
+
+	var calls atomic.Int32
+	received := make(chan *http.Request, 1)
+	var receivedBody []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// fail the first attempt so the delivery is retried
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		receivedBody, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer receiver.Close()
+
+	rr := request(http.MethodPost, "/", `{"url":"`+receiver.URL+`","events":["message_completed"]}`, createWebhook, "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var created Webhook
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil || created.Secret == "" {
+		t.Fatalf("expected the secret in the response, got %s", rr.Body.String())
+	}
+
+	Publish("u", EventConversationCreated, map[string]string{"id": "c1"})
+	Publish("u", EventMessageCompleted, map[string]string{"content": "hello"})
+	pending.Wait()
+
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("expected one failed and one successful attempt, got %d calls", n)
+	}
+	r := <-received
+	if r.Header.Get("X-Webhook-Event") != EventMessageCompleted {
+		t.Errorf("unexpected event header %q", r.Header.Get("X-Webhook-Event"))
+	}
+	want := Sign(created.Secret, r.Header.Get("X-Webhook-Timestamp"), receivedBody)
+	if r.Header.Get(SignatureHeader) != want {
+		t.Errorf("signature mismatch, got %q want %q", r.Header.Get(SignatureHeader), want)
+	}
+	var payload Payload
+	if err := json.Unmarshal(receivedBody, &payload); err != nil || payload.Event != EventMessageCompleted {
+		t.Errorf("unexpected payload %s", receivedBody)
+	}
+
+	wh, err := repo.GetByID(created.ID, "u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wh.LastStatus != http.StatusOK || wh.LastError != "" || wh.LastDeliveryAt == nil {
+		t.Errorf("expected the successful delivery to be recorded, got %+v", wh)
+	}
+
+	rr = request(http.MethodGet, "/", "", listWebhooks, "")
+	if bytes.Contains(rr.Body.Bytes(), []byte(created.Secret)) {
+		t.Error("expected the secret to be hidden when listing")
+	}
+}
+
+func TestWebhookValidation(t *testing.T) {
+	setupTest(t)
+
+	for _, body := range []string{
+		`{"url":"ftp://example.com","events":["message_completed"]}`,
+		`{"url":"https://example.com/hook","events":[]}`,
+		`{"url":"https://example.com/hook","events":["message_deleted"]}`,
+	} {
+		if rr := request(http.MethodPost, "/", body, createWebhook, ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", body, rr.Code)
+		}
+	}
+
+	if rr := request(http.MethodPut, "/1", `{"url":"https://example.com/hook","events":["tool_failed"]}`, updateWebhook, "1"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 updating a missing webhook, got %d", rr.Code)
+	}
+}
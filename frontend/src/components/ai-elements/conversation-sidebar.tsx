@@ -369,6 +369,12 @@ export const ConversationSidebar = ({
                                     <span className="text-sm flex-1 truncate text-foreground/80">
                                       {item.data.title}
                                     </span>
+                                    {!!item.data.backendConversation?.unread && (
+                                      <span
+                                        className="h-2 w-2 rounded-full bg-primary shrink-0"
+                                        aria-label={`${item.data.backendConversation.unread} unread`}
+                                      />
+                                    )}
                                   </div>
                                 </Button>
                                 <DropdownMenu>
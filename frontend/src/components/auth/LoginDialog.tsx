@@ -26,7 +26,19 @@ export const LoginDialog: React.FC<LoginDialogProps> = ({
   const [confirmPassword, setConfirmPassword] = useState("");
   const [showPassword, setShowPassword] = useState(false);
   const [isDialogOpen, setIsDialogOpen] = useState(false);
-  const { login, register, isLoading, error, clearError } = useAuth();
+  const [code, setCode] = useState("");
+  const [invitation, setInvitation] = useState("");
+  const {
+    login,
+    register,
+    isLoading,
+    isSSOEnabled,
+    isTwoFactorRequired,
+    registration,
+    cancelTwoFactor,
+    error,
+    clearError,
+  } = useAuth();
   const [validationError, setValidationError] = useState<string | null>(null);
 
   const isControlled = open !== undefined && onOpenChange !== undefined;
@@ -50,13 +62,15 @@ export const LoginDialog: React.FC<LoginDialogProps> = ({
 
     try {
       if (isLoginMode) {
-        await login(username.trim(), password.trim());
+        await login(username.trim(), password.trim(), code.trim());
       } else {
-        await register(username.trim(), password.trim());
+        await register(username.trim(), password.trim(), invitation.trim());
       }
       setUsername("");
       setPassword("");
       setConfirmPassword("");
+      setCode("");
+      setInvitation("");
       setDialogOpen(false);
     } catch (err) {
       // Error is handled by the auth context
@@ -72,8 +86,11 @@ export const LoginDialog: React.FC<LoginDialogProps> = ({
       setUsername("");
       setPassword("");
       setConfirmPassword("");
+      setCode("");
+      setInvitation("");
       setValidationError(null);
       clearError();
+      cancelTwoFactor();
     }
   };
 
@@ -252,6 +269,48 @@ export const LoginDialog: React.FC<LoginDialogProps> = ({
                 </div>
               </div>
 
+              {!isLoginMode && registration === "invite" && (
+                <input
+                  type="text"
+                  placeholder="Invitation code"
+                  value={invitation}
+                  onChange={(e) => {
+                    setInvitation(e.target.value);
+                    if (error) clearError();
+                  }}
+                  className={cn(
+                    "w-full px-4 py-2.5 rounded-xl border bg-background text-foreground placeholder:text-muted-foreground transition-all focus:outline-none focus:ring-[0.5px] focus:ring-offset-0",
+                    error
+                      ? "border-destructive focus:ring-destructive"
+                      : "border-input focus:ring-primary/40 focus:border-primary",
+                  )}
+                  disabled={isLoading}
+                  autoComplete="off"
+                />
+              )}
+
+              {isLoginMode && isTwoFactorRequired && (
+                <input
+                  type="text"
+                  inputMode="numeric"
+                  placeholder="Authenticator or recovery code"
+                  value={code}
+                  onChange={(e) => {
+                    setCode(e.target.value);
+                    if (error) clearError();
+                  }}
+                  className={cn(
+                    "w-full px-4 py-2.5 rounded-xl border bg-background text-foreground placeholder:text-muted-foreground transition-all focus:outline-none focus:ring-[0.5px] focus:ring-offset-0",
+                    error
+                      ? "border-destructive focus:ring-destructive"
+                      : "border-input focus:ring-primary/40 focus:border-primary",
+                  )}
+                  disabled={isLoading}
+                  autoComplete="one-time-code"
+                  autoFocus
+                />
+              )}
+
               <div
                 className={cn(
                   "grid w-full transition-all !duration-200 ease-in-out",
@@ -274,7 +333,11 @@ export const LoginDialog: React.FC<LoginDialogProps> = ({
                 isLoading ||
                 !username.trim() ||
                 !password.trim() ||
-                (!isLoginMode && !confirmPassword.trim())
+                (!isLoginMode && !confirmPassword.trim()) ||
+                (!isLoginMode &&
+                  registration === "invite" &&
+                  !invitation.trim()) ||
+                (isLoginMode && isTwoFactorRequired && !code.trim())
               }
               className="w-full px-6 py-2 rounded-lg bg-primary text-primary-foreground hover:bg-primary/90 transition-all duration-300 disabled:opacity-50 disabled:cursor-not-allowed"
             >
@@ -287,18 +350,29 @@ export const LoginDialog: React.FC<LoginDialogProps> = ({
                   : "Register"}
             </button>
 
-            <div className="pt-2 text-center">
-              <button
-                type="button"
-                onClick={toggleMode}
-                className="text-sm text-muted-foreground hover:text-foreground underline underline-offset-4 transition-colors"
-                disabled={isLoading}
+            {isLoginMode && isSSOEnabled && (
+              <a
+                href="/api/auth/oidc/login"
+                className="block w-full px-6 py-2 rounded-lg border text-center hover:bg-accent transition-all duration-300"
               >
-                {isLoginMode
-                  ? "Don't have an account? Register"
-                  : "Already have an account? Login"}
-              </button>
-            </div>
+                Login with SSO
+              </a>
+            )}
+
+            {registration !== "closed" && (
+              <div className="pt-2 text-center">
+                <button
+                  type="button"
+                  onClick={toggleMode}
+                  className="text-sm text-muted-foreground hover:text-foreground underline underline-offset-4 transition-colors"
+                  disabled={isLoading}
+                >
+                  {isLoginMode
+                    ? "Don't have an account? Register"
+                    : "Already have an account? Login"}
+                </button>
+              </div>
+            )}
           </form>
         </div>
       </DialogContent>
@@ -1,9 +1,10 @@
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import { Button } from "@/components/ui/button";
 import { Input } from "@/components/ui/input";
 import { Label } from "@/components/ui/label";
-import { Lock, User } from "lucide-react";
+import { Lock, ShieldCheck, User } from "lucide-react";
 import { authAPI } from "@/lib/api/auth";
+import { TwoFactorSetup } from "@/lib/api/types";
 import {
   Dialog,
   DialogContent,
@@ -12,6 +13,144 @@ import {
   DialogTrigger,
 } from "@/components/ui/dialog";
 
+const TwoFactorRow = () => {
+  const [enabled, setEnabled] = useState(false);
+  const [open, setOpen] = useState(false);
+  const [setup, setSetup] = useState<TwoFactorSetup | null>(null);
+  const [recoveryCodes, setRecoveryCodes] = useState<string[] | null>(null);
+  const [code, setCode] = useState("");
+  const [isSaving, setIsSaving] = useState(false);
+  const [error, setError] = useState<string | null>(null);
+
+  useEffect(() => {
+    authAPI
+      .getTwoFactorStatus()
+      .then((status) => setEnabled(status.enabled))
+      .catch(() => setEnabled(false));
+  }, []);
+
+  const handleOpenChange = async (newOpen: boolean) => {
+    setOpen(newOpen);
+    setCode("");
+    setError(null);
+    setRecoveryCodes(null);
+    setSetup(null);
+    if (newOpen && !enabled) {
+      try {
+        setSetup(await authAPI.setupTwoFactor());
+      } catch (err) {
+        setError(err instanceof Error ? err.message : "Failed to start setup");
+      }
+    }
+  };
+
+  const handleConfirm = async () => {
+    setError(null);
+    setIsSaving(true);
+    try {
+      if (enabled) {
+        await authAPI.disableTwoFactor(code.trim());
+        setEnabled(false);
+        setOpen(false);
+      } else {
+        setRecoveryCodes(await authAPI.verifyTwoFactor(code.trim()));
+        setEnabled(true);
+      }
+      setCode("");
+    } catch (err) {
+      setError(err instanceof Error ? err.message : "Invalid code");
+    } finally {
+      setIsSaving(false);
+    }
+  };
+
+  return (
+    <div className="flex justify-between items-center pb-2">
+      <div className="space-y-1">
+        <Label className="text-base">Two-factor authentication</Label>
+        <p className="text-sm text-muted-foreground">
+          {enabled
+            ? "A code from your authenticator app is required at login"
+            : "Require a code from an authenticator app at login"}
+        </p>
+      </div>
+      <Dialog open={open} onOpenChange={handleOpenChange}>
+        <DialogTrigger asChild>
+          <Button variant="outline" size="sm">
+            <ShieldCheck className="mr-2 h-4 w-4" />
+            {enabled ? "Disable" : "Enable"}
+          </Button>
+        </DialogTrigger>
+        <DialogContent className="sm:max-w-[425px]">
+          <DialogHeader>
+            <DialogTitle>Two-factor authentication</DialogTitle>
+          </DialogHeader>
+          {recoveryCodes ? (
+            <div className="space-y-4 pt-4">
+              <p className="text-sm text-muted-foreground">
+                Save these recovery codes. Each one can be used once to log in
+                without your authenticator app, and they are not shown again.
+              </p>
+              <div className="grid grid-cols-2 gap-2 font-mono text-sm">
+                {recoveryCodes.map((c) => (
+                  <span key={c}>{c}</span>
+                ))}
+              </div>
+              <div className="flex justify-end pt-2">
+                <Button onClick={() => setOpen(false)}>Done</Button>
+              </div>
+            </div>
+          ) : (
+            <div className="space-y-4 pt-4">
+              {setup && (
+                <div className="space-y-2">
+                  <p className="text-sm text-muted-foreground">
+                    Add this key to your authenticator app, or open the link on
+                    your device, then enter the code it shows.
+                  </p>
+                  <code className="block break-all rounded bg-muted p-2 text-sm">
+                    {setup.secret}
+                  </code>
+                  <a
+                    href={setup.url}
+                    className="text-sm underline underline-offset-4"
+                  >
+                    Open in authenticator app
+                  </a>
+                </div>
+              )}
+              <div className="space-y-2">
+                <Label htmlFor="totp-code">
+                  {enabled ? "Authenticator or recovery code" : "Code"}
+                </Label>
+                <Input
+                  id="totp-code"
+                  value={code}
+                  onChange={(e) => setCode(e.target.value)}
+                  autoComplete="one-time-code"
+                  placeholder="123456"
+                />
+              </div>
+
+              {error && <div className="text-sm text-red-500">{error}</div>}
+
+              <div className="flex justify-end pt-2">
+                <Button
+                  onClick={handleConfirm}
+                  disabled={isSaving || !code.trim() || (!enabled && !setup)}
+                  variant={enabled ? "destructive" : "default"}
+                >
+                  {enabled ? "Disable" : "Verify"}
+                </Button>
+              </div>
+            </div>
+          )}
+        </DialogContent>
+      </Dialog>
+    </div>
+  );
+};
+
 export const AuthSection = () => {
   const [password, setPassword] = useState("");
   const [confirmPassword, setConfirmPassword] = useState("");
@@ -126,6 +265,7 @@ export const AuthSection = () => {
             </DialogContent>
           </Dialog>
         </div>
+        <TwoFactorRow />
       </div>
     </div>
   );
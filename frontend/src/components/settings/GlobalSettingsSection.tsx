@@ -28,6 +28,8 @@ export const GlobalSettingsSection = () => {
   const systemPrompt = data.settings.systemPrompt || "";
   const appendDate = data.settings.appendDateToSystemPrompt || "false";
   const appendPlatform = data.settings.appendPlatformInstructions || "false";
+  const appendProfile = data.settings.appendProfileToSystemPrompt || "false";
+  const userProfile = data.settings.userProfile || "";
   const defaultModel = data.settings.defaultModel || "";
   const imageModel = data.settings.imageModel || "dall-e-3";
   const reasoningEffort = data.settings.reasoningEffort || "medium";
@@ -41,6 +43,8 @@ export const GlobalSettingsSection = () => {
     enterBehavior,
     appendDateToSystemPrompt: appendDate,
     appendPlatformInstructions: appendPlatform,
+    appendProfileToSystemPrompt: appendProfile,
+    userProfile,
   });
 
   useEffect(() => {
@@ -52,6 +56,8 @@ export const GlobalSettingsSection = () => {
       enterBehavior,
       appendDateToSystemPrompt: appendDate,
       appendPlatformInstructions: appendPlatform,
+      appendProfileToSystemPrompt: appendProfile,
+      userProfile,
     });
     setHasChanges(false);
   }, [
@@ -62,6 +68,8 @@ export const GlobalSettingsSection = () => {
     enterBehavior,
     appendDate,
     appendPlatform,
+    appendProfile,
+    userProfile,
   ]);
 
   const handleChange = (key: string, value: string) => {
@@ -93,6 +101,8 @@ export const GlobalSettingsSection = () => {
       enterBehavior,
       appendDateToSystemPrompt: appendDate,
       appendPlatformInstructions: appendPlatform,
+      appendProfileToSystemPrompt: appendProfile,
+      userProfile,
     });
     setHasChanges(false);
   };
@@ -230,6 +240,34 @@ export const GlobalSettingsSection = () => {
               disabled={isSaving}
             />
           </div>
+          <div className="flex items-center justify-between pt-2">
+            <div>
+              <Label className="!mb-0">Append profile</Label>
+            </div>
+            <Switch
+              className="mx-1"
+              checked={local.appendProfileToSystemPrompt === "true"}
+              onCheckedChange={() =>
+                handleChange(
+                  "appendProfileToSystemPrompt",
+                  local.appendProfileToSystemPrompt === "true"
+                    ? "false"
+                    : "true",
+                )
+              }
+              disabled={isSaving}
+            />
+          </div>
+          {local.appendProfileToSystemPrompt === "true" && (
+            <Textarea
+              id="user-profile"
+              placeholder="Facts the model should know about you, such as your name, role or location."
+              value={local.userProfile}
+              onChange={(e) => handleChange("userProfile", e.target.value)}
+              className="min-h-[80px] text-sm resize-none !bg-secondary/50 rounded-xl border-border/80 focus-visible:border-border"
+              disabled={isSaving}
+            />
+          )}
           <Textarea
             id="system-prompt"
             placeholder="You are a helpful AI assistant. Provide clear, accurate, and helpful responses to user questions."
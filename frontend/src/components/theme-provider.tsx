@@ -1,4 +1,5 @@
 import { createContext, useContext, useEffect, useState } from "react";
+import { getProfile, updateProfile } from "@/lib/api/account";
 
 type Theme = "dark" | "light";
 
@@ -34,6 +35,22 @@ export function ThemeProvider({
     return defaultTheme;
   });
 
+  // the theme is stored with the account so it follows the user to other
+  // devices, localStorage only avoids a flash before it loads
+  useEffect(() => {
+    getProfile()
+      .then((profile) => {
+        const stored = profile.preferences.theme;
+        if (stored === "light" || stored === "dark") {
+          localStorage.setItem(storageKey, stored);
+          setTheme(stored);
+        }
+      })
+      .catch(() => {
+        // not logged in yet, keep the local theme
+      });
+  }, [storageKey]);
+
   useEffect(() => {
     const root = window.document.documentElement;
 
@@ -46,6 +63,9 @@ export function ThemeProvider({
     setTheme: (theme: Theme) => {
       localStorage.setItem(storageKey, theme);
       setTheme(theme);
+      updateProfile({ preferences: { theme } }).catch(() => {
+        // saved locally only
+      });
     },
   };
 
@@ -6,16 +6,26 @@ import React, {
   ReactNode,
 } from "react";
 import { authAPI } from "@/lib/api/auth.ts";
+import { ApiError } from "@/lib/api/errorHandler.ts";
+import { RegistrationMode } from "@/lib/api/types.ts";
 
 interface AuthContextType {
   isAuthenticated: boolean;
   isCheckingAuth: boolean;
   isLoading: boolean;
-  login: (username: string, password: string) => Promise<void>;
+  isSSOEnabled: boolean;
+  isTwoFactorRequired: boolean;
+  registration: RegistrationMode;
+  login: (username: string, password: string, code?: string) => Promise<void>;
   logout: () => Promise<void>;
-  register: (username: string, password: string) => Promise<void>;
+  register: (
+    username: string,
+    password: string,
+    invitation?: string,
+  ) => Promise<void>;
   error: string | null;
   clearError: () => void;
+  cancelTwoFactor: () => void;
 }
 
 const AuthContext = createContext<AuthContextType | undefined>(undefined);
@@ -28,6 +38,9 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
   const [isAuthenticated, setIsAuthenticated] = useState(false);
   const [isCheckingAuth, setIsCheckingAuth] = useState(true);
   const [isLoading, setIsLoading] = useState(false);
+  const [isSSOEnabled, setIsSSOEnabled] = useState(false);
+  const [isTwoFactorRequired, setIsTwoFactorRequired] = useState(false);
+  const [registration, setRegistration] = useState<RegistrationMode>("open");
   const [error, setError] = useState<string | null>(null);
 
   // Check authentication status on mount
@@ -36,6 +49,8 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
       try {
         const status = await authAPI.getAuthStatus();
         setIsAuthenticated(status.authenticated);
+        setIsSSOEnabled(status.oidc);
+        setRegistration(status.registration ?? "open");
       } catch (err) {
         console.error("Error checking auth status:", err);
         setIsAuthenticated(false);
@@ -50,11 +65,12 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
   const register = async (
     username: string,
     password: string,
+    invitation?: string,
   ): Promise<void> => {
     try {
       setError(null);
       setIsLoading(true);
-      await authAPI.register(username, password);
+      await authAPI.register(username, password, invitation);
       await login(username, password);
     } catch (err) {
       const errorMessage =
@@ -66,11 +82,11 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
     }
   };
 
-  const login = async (username: string, password: string) => {
+  const login = async (username: string, password: string, code?: string) => {
     try {
       setError(null);
       setIsLoading(true);
-      await authAPI.login(username, password);
+      await authAPI.login(username, password, code);
       // After login, re-check auth status
       const status = await authAPI.getAuthStatus();
       if (!status.authenticated) {
@@ -79,7 +95,13 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
         );
       }
       setIsAuthenticated(true);
+      setIsTwoFactorRequired(false);
     } catch (err) {
+      if ((err as ApiError).code === "TOTP_REQUIRED") {
+        // not an error: the dialog asks for the code next
+        setIsTwoFactorRequired(true);
+        throw err;
+      }
       const errorMessage = err instanceof Error ? err.message : "Login failed";
       setError(errorMessage);
       setIsAuthenticated(false);
@@ -110,15 +132,23 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
     setError(null);
   };
 
+  const cancelTwoFactor = () => {
+    setIsTwoFactorRequired(false);
+  };
+
   const value: AuthContextType = {
     isAuthenticated,
     isCheckingAuth,
     isLoading,
+    isSSOEnabled,
+    isTwoFactorRequired,
+    registration,
     login,
     logout,
     register,
     error,
     clearError,
+    cancelTwoFactor,
   };
 
   return <AuthContext.Provider value={value}>{children}</AuthContext.Provider>;
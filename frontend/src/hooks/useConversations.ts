@@ -361,6 +361,20 @@ export const useConversations = () => {
 
   const managerRef = useRef(new ClientConversationManager());
   const manager = managerRef.current;
+  const activeConversationIdRef = useRef<string | null>(null);
+  activeConversationIdRef.current = activeConversationId;
+
+  // Opening a conversation marks its answers read on every session
+  useEffect(() => {
+    if (!activeConversationId || manager.getUnread(activeConversationId) === 0) {
+      return;
+    }
+    manager.setUnread(activeConversationId, 0);
+    setConversations([...manager.getAllConversations()]);
+    conversationsAPI.markConversationRead(activeConversationId).catch((err) => {
+      console.error("Failed to mark conversation read:", err);
+    });
+  }, [activeConversationId, manager, conversations]);
 
   const currentConversation = conversations.find(
     (conv) => conv.id === activeConversationId,
@@ -387,10 +401,23 @@ export const useConversations = () => {
           manager.handleExternalUpdate(event.conversation);
         } else if (event.type === "conversation_deleted") {
           manager.handleExternalDelete(event.conversationId);
+        } else if (event.type === "conversation_read") {
+          manager.setUnread(event.conversationId, 0);
         } else if (
           event.type === "message_saved" ||
-          event.type === "message_updated"
+          event.type === "message_updated" ||
+          event.type === "generation_completed"
         ) {
+          if (
+            event.type === "message_saved" &&
+            event.message.role === "assistant" &&
+            event.conversationId !== activeConversationIdRef.current
+          ) {
+            manager.setUnread(
+              event.conversationId,
+              manager.getUnread(event.conversationId) + 1,
+            );
+          }
           // Skip if this conversation's messages haven't been fetched yet —
           // opening the conversation will load a fresh copy from the server.
           if (manager.hasLoadedMessages(event.conversationId)) {
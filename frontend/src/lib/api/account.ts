@@ -0,0 +1,73 @@
+import { Profile, ProfileUpdate } from "./types";
+import { getHeaders } from "./headers";
+import { ApiErrorHandler } from "./errorHandler";
+
+// Get the user's profile and preferences
+export const getProfile = async (): Promise<Profile> => {
+  const response = await fetch("/api/account/", {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch profile: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+// Update the fields that are set, returns the whole profile
+export const updateProfile = async (update: ProfileUpdate): Promise<Profile> => {
+  const response = await fetch("/api/account/", {
+    method: "PATCH",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    body: JSON.stringify(update),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    const message = await ApiErrorHandler.readErrorMessage(response);
+    throw new Error(`Failed to update profile: ${message}`);
+  }
+
+  return response.json();
+};
+
+// Upload an image as the user's avatar, replacing the previous one
+export const uploadAvatar = async (file: File): Promise<Profile> => {
+  const formData = new FormData();
+  formData.append("file", file);
+
+  const response = await fetch("/api/account/avatar", {
+    method: "PUT",
+    headers: getHeaders(),
+    body: formData,
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    const message = await ApiErrorHandler.readErrorMessage(response);
+    throw new Error(`Failed to upload avatar: ${message}`);
+  }
+
+  return response.json();
+};
+
+export const deleteAvatar = async (): Promise<Profile> => {
+  const response = await fetch("/api/account/avatar", {
+    method: "DELETE",
+    headers: getHeaders(),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to remove avatar: ${response.statusText}`);
+  }
+
+  return response.json();
+};
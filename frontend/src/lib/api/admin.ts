@@ -0,0 +1,111 @@
+import {
+  AdminStats,
+  AuditLogPage,
+  Invitation,
+  InvitationsResponse,
+} from "./types";
+import { getHeaders } from "./headers";
+
+// Get the instance overview, activity counted over the last days (admins only)
+export const getAdminStats = async (days?: number): Promise<AdminStats> => {
+  const query = days ? `?days=${days}` : "";
+  const response = await fetch(`/api/admin/stats${query}`, {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch stats: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+export interface AuditLogFilter {
+  actor?: string;
+  action?: string; // "provider." matches every provider action
+  target?: string;
+  since?: string; // RFC 3339
+  until?: string; // RFC 3339
+  limit?: number;
+  before?: number;
+}
+
+// List logins and administrative changes, newest first (admins only)
+export const getAuditLog = async (
+  filter: AuditLogFilter = {},
+): Promise<AuditLogPage> => {
+  const params = new URLSearchParams();
+  Object.entries(filter).forEach(([key, value]) => {
+    if (value !== undefined && value !== "") params.set(key, String(value));
+  });
+  const query = params.toString();
+  const response = await fetch(`/api/admin/audit${query ? `?${query}` : ""}`, {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch audit log: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+// List the invitations to sign up, newest first (admins only)
+export const getInvitations = async (): Promise<InvitationsResponse> => {
+  const response = await fetch("/api/admin/invitations", {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch invitations: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+// Create a single-use invitation, the response is the only time its code is
+// shown (admins only)
+export const createInvitation = async (
+  note: string,
+  expiresInDays?: number,
+): Promise<Invitation> => {
+  const response = await fetch("/api/admin/invitations", {
+    method: "POST",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    body: JSON.stringify({ note, expiresInDays }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to create invitation: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+// Revoke an invitation (admins only)
+export const deleteInvitation = async (id: number): Promise<void> => {
+  const response = await fetch(`/api/admin/invitations/${id}`, {
+    method: "DELETE",
+    headers: getHeaders(),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to delete invitation: ${response.statusText}`);
+  }
+};
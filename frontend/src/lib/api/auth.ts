@@ -1,6 +1,6 @@
 import { ApiErrorHandler } from "./errorHandler.ts";
 
-import { AuthStatus } from "./types.ts";
+import { AuthStatus, TwoFactorSetup, TwoFactorStatus } from "./types.ts";
 import { getHeaders } from "./headers.ts";
 
 // Authentication API client
@@ -32,8 +32,13 @@ export class AuthAPI {
     }, "getAuthStatus");
   }
 
-  // POST /api/auth/register - Register a new instance
-  async register(username: string, password: string): Promise<void> {
+  // POST /api/auth/register - Register a new account, with an invitation
+  // code when registration is by invitation
+  async register(
+    username: string,
+    password: string,
+    invitation?: string,
+  ): Promise<void> {
     if (!username || !password) {
       throw new Error("Username and password are required");
     }
@@ -44,7 +49,7 @@ export class AuthAPI {
         headers: getHeaders({
           "Content-Type": "application/json",
         }),
-        body: JSON.stringify({ username, password }),
+        body: JSON.stringify({ username, password, invitation }),
         credentials: "include",
       });
 
@@ -54,8 +59,13 @@ export class AuthAPI {
     }, "register");
   }
 
-  // POST /api/auth/login - Login with username and password
-  async login(username: string, password: string): Promise<void> {
+  // POST /api/auth/login - Login with username and password, plus a
+  // two-factor code when the API replied with TOTP_REQUIRED
+  async login(
+    username: string,
+    password: string,
+    code?: string,
+  ): Promise<void> {
     if (!username || !password) {
       throw new Error("Username and password are required");
     }
@@ -64,6 +74,9 @@ export class AuthAPI {
       const formData = new URLSearchParams();
       formData.append("username", username);
       formData.append("password", password);
+      if (code) {
+        formData.append("code", code);
+      }
 
       const response = await fetch("/api/auth/login", {
         method: "POST",
@@ -97,12 +110,87 @@ export class AuthAPI {
       });
 
       if (!response.ok) {
-        const errorText = await response.text();
+        const errorText = await ApiErrorHandler.readErrorMessage(response);
         throw new Error(errorText || "Failed to change password");
       }
     }, "changePassword");
   }
 
+  // GET /api/auth/2fa - Check whether two-factor login is enabled
+  async getTwoFactorStatus(): Promise<TwoFactorStatus> {
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch("/api/auth/2fa", {
+        method: "GET",
+        headers: getHeaders(),
+        credentials: "include",
+      });
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(response, "Two-factor status");
+      }
+
+      return response.json();
+    }, "getTwoFactorStatus");
+  }
+
+  // POST /api/auth/2fa/setup - Start enrollment with a new secret
+  async setupTwoFactor(): Promise<TwoFactorSetup> {
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch("/api/auth/2fa/setup", {
+        method: "POST",
+        headers: getHeaders(),
+        credentials: "include",
+      });
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(response, "Two-factor setup");
+      }
+
+      return response.json();
+    }, "setupTwoFactor");
+  }
+
+  // POST /api/auth/2fa/verify - Confirm enrollment, returns recovery codes
+  async verifyTwoFactor(code: string): Promise<string[]> {
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch("/api/auth/2fa/verify", {
+        method: "POST",
+        headers: getHeaders({
+          "Content-Type": "application/json",
+        }),
+        body: JSON.stringify({ code }),
+        credentials: "include",
+      });
+
+      if (!response.ok) {
+        const errorText = await ApiErrorHandler.readErrorMessage(response);
+        throw new Error(errorText || "Failed to verify code");
+      }
+
+      const data: { recoveryCodes: string[] } = await response.json();
+      return data.recoveryCodes;
+    }, "verifyTwoFactor");
+  }
+
+  // POST /api/auth/2fa/disable - Turn off two-factor login
+  async disableTwoFactor(code: string): Promise<void> {
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch("/api/auth/2fa/disable", {
+        method: "POST",
+        headers: getHeaders({
+          "Content-Type": "application/json",
+        }),
+        body: JSON.stringify({ code }),
+        credentials: "include",
+      });
+
+      if (!response.ok) {
+        const errorText = await ApiErrorHandler.readErrorMessage(response);
+        throw new Error(errorText || "Failed to disable two-factor login");
+      }
+    }, "disableTwoFactor");
+  }
+
   // POST /api/auth/logout - Logout and clear cookie
   async logout(): Promise<void> {
     return ApiErrorHandler.handleApiCall(async () => {
@@ -1,6 +1,10 @@
 import {
+  ActiveGenerations,
+  BatchResults,
   ChatRequest,
+  Job,
   Message,
+  PromptBatch,
   RetryResponse,
   StreamChunk,
   StreamComplete,
@@ -67,7 +71,7 @@ export class ChatAPI {
       clearTimeout(timeoutId);
 
       if (!response.ok) {
-        const errorText = await response.text();
+        const errorText = await ApiErrorHandler.readErrorMessage(response);
         throw new Error(
           `Stream request failed: ${response.statusText} - ${errorText}`,
         );
@@ -171,6 +175,107 @@ export class ChatAPI {
     }, "cancelStream");
   }
 
+  // Full messages by ID, e.g. the branch picked from the conversation tree.
+  // IDs that are not found are left out.
+  async fetchMessages(ids: number[]): Promise<Record<number, Message>> {
+    if (ids.length === 0) {
+      return {};
+    }
+
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch("/api/chat/messages/batch", {
+        method: "POST",
+        headers: getHeaders({
+          "Content-Type": "application/json",
+        }),
+        credentials: "include",
+        body: JSON.stringify({ ids }),
+      });
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(response, "Fetch messages");
+      }
+
+      const data: { messages: Record<number, Message> } =
+        await response.json();
+      return data.messages;
+    }, "fetchMessages");
+  }
+
+  async fetchActiveGenerations(): Promise<ActiveGenerations> {
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch("/api/chat/active", {
+        method: "GET",
+        headers: getHeaders(),
+        credentials: "include",
+      });
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(
+          response,
+          "Fetch active generations",
+        );
+      }
+
+      return response.json() as Promise<ActiveGenerations>;
+    }, "fetchActiveGenerations");
+  }
+
+  // POST /api/chat/batch, or /api/chat/batch/csv with a CSV file; poll the
+  // job for its progress
+  async runBatch(
+    batch: PromptBatch | { model: string; file: File; column?: string },
+  ): Promise<Job<BatchResults>> {
+    return ApiErrorHandler.handleApiCall(async () => {
+      let response: Response;
+      if ("file" in batch) {
+        const form = new FormData();
+        form.append("file", batch.file);
+        form.append("model", batch.model);
+        if (batch.column) {
+          form.append("column", batch.column);
+        }
+        response = await fetch("/api/chat/batch/csv", {
+          method: "POST",
+          headers: getHeaders(),
+          credentials: "include",
+          body: form,
+        });
+      } else {
+        response = await fetch("/api/chat/batch", {
+          method: "POST",
+          headers: getHeaders({ "Content-Type": "application/json" }),
+          credentials: "include",
+          body: JSON.stringify(batch),
+        });
+      }
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(response, "Run batch");
+      }
+      return response.json() as Promise<Job<BatchResults>>;
+    }, "runBatch");
+  }
+
+  // GET /api/chat/batch/{id}/results, a CSV file
+  async downloadBatchResults(id: number): Promise<Blob> {
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch(`/api/chat/batch/${id}/results`, {
+        method: "GET",
+        headers: getHeaders(),
+        credentials: "include",
+      });
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(
+          response,
+          `Download results of batch ${id}`,
+        );
+      }
+      return response.blob();
+    }, `downloadBatchResults(${id})`);
+  }
+
   async retryMessageStream(
     conversationId: string,
     parentId: number,
@@ -213,7 +318,7 @@ export class ChatAPI {
       clearTimeout(timeoutId);
 
       if (!response.ok) {
-        const errorText = await response.text();
+        const errorText = await ApiErrorHandler.readErrorMessage(response);
         throw new Error(
           `Stream request failed: ${response.statusText} - ${errorText}`,
         );
@@ -242,6 +347,69 @@ export class ChatAPI {
     }
   }
 
+  async continueMessageStream(
+    conversationId: string,
+    messageId: number,
+    onChunk?: (chunk: string) => void,
+    onReasoning?: (reasoning: string) => void,
+    onMetadata?: (metadata: StreamMetadata) => void,
+    onComplete?: (data: StreamComplete) => void,
+    onError?: (error: string) => void,
+    sessionId?: string,
+  ): Promise<void> {
+    if (!conversationId) {
+      throw new Error("Valid conversation ID is required");
+    }
+    if (!messageId) {
+      throw new Error("Valid message ID is required");
+    }
+
+    try {
+      const controller = new AbortController();
+      const timeoutId = setTimeout(() => controller.abort(), 30 * 60 * 1000); // 30 minutes timeout
+      const response = await fetch("/api/chat/continue", {
+        method: "POST",
+        headers: getHeaders({
+          "Content-Type": "application/json",
+          ...(sessionId ? { "X-Session-ID": sessionId } : {}),
+        }),
+        credentials: "include",
+        body: JSON.stringify({ conversationId, messageId }),
+        signal: controller.signal,
+      });
+
+      clearTimeout(timeoutId);
+
+      if (!response.ok) {
+        const errorText = await ApiErrorHandler.readErrorMessage(response);
+        throw new Error(
+          `Stream request failed: ${response.statusText} - ${errorText}`,
+        );
+      }
+
+      const reader = response.body?.getReader();
+      if (!reader) {
+        throw new Error("No response body available for streaming");
+      }
+
+      await this.processStream(
+        reader,
+        onChunk,
+        onReasoning,
+        undefined,
+        onMetadata,
+        onComplete,
+        onError,
+      );
+    } catch (err) {
+      console.error("Stream error:", err);
+      if (onError) {
+        onError(err instanceof Error ? err.message : String(err));
+      }
+      throw err;
+    }
+  }
+
   private async processStream(
     reader: ReadableStreamDefaultReader<Uint8Array>,
     onChunk?: (chunk: string) => void,
@@ -1,4 +1,14 @@
-import { Conversation, Message, WelcomeStats } from "./types.ts";
+import {
+  Conversation,
+  ConversationFile,
+  ConversationSummaryText,
+  ConversationTree,
+  Draft,
+  Message,
+  ReadState,
+  SearchPage,
+  WelcomeStats,
+} from "./types.ts";
 
 import {
   ApiErrorHandler,
@@ -14,10 +24,11 @@ import { getHeaders } from "./headers.ts";
 export class ConversationsAPI {
   constructor() {}
 
-  // GET /api/conversations
-  async fetchConversations(): Promise<Conversation[]> {
+  // GET /api/conversations, the archived ones with archived
+  async fetchConversations(archived = false): Promise<Conversation[]> {
     return ApiErrorHandler.handleApiCall(async () => {
-      const response = await fetch("/api/conversations", {
+      const query = archived ? "?archived=true" : "";
+      const response = await fetch(`/api/conversations${query}`, {
         method: "GET",
         headers: getHeaders({
           "Content-Type": "application/json",
@@ -189,6 +200,33 @@ export class ConversationsAPI {
     }, "fetchStats");
   }
 
+  // GET /api/conversations/{id}/files
+  async fetchConversationFiles(
+    id: string,
+    type?: string,
+  ): Promise<ConversationFile[]> {
+    return ApiErrorHandler.handleApiCall(async () => {
+      const query = type ? `?type=${encodeURIComponent(type)}` : "";
+      const response = await fetch(
+        `/api/conversations/${encodeURIComponent(id)}/files${query}`,
+        {
+          method: "GET",
+          headers: getHeaders(),
+          credentials: "include",
+        },
+      );
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(
+          response,
+          `Fetch files of conversation ${id}`,
+        );
+      }
+      const data = await response.json();
+      return data.files ?? [];
+    }, `fetchConversationFiles(${id})`);
+  }
+
   // POST /api/conversations/{id}/rename
   async renameConversation(id: string, title: string): Promise<void> {
     if (!id) {
@@ -220,6 +258,253 @@ export class ConversationsAPI {
       }
     }, `renameConversation(${id})`);
   }
+
+  // POST /api/conversations/{id}/title
+  async generateTitle(id: string): Promise<Conversation> {
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch(
+        `/api/conversations/${encodeURIComponent(id)}/title`,
+        {
+          method: "POST",
+          headers: getHeaders(),
+          credentials: "include",
+        },
+      );
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(
+          response,
+          `Generate title of conversation ${id}`,
+        );
+      }
+      return response.json();
+    }, `generateTitle(${id})`);
+  }
+
+  // POST /api/conversations/{id}/summary
+  async summarizeConversation(id: string): Promise<ConversationSummaryText> {
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch(
+        `/api/conversations/${encodeURIComponent(id)}/summary`,
+        {
+          method: "POST",
+          headers: getHeaders(),
+          credentials: "include",
+        },
+      );
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(
+          response,
+          `Summarize conversation ${id}`,
+        );
+      }
+      return response.json();
+    }, `summarizeConversation(${id})`);
+  }
+
+  // POST /api/conversations/{id}/read, up to the latest message when messageId is omitted
+  async markConversationRead(id: string, messageId?: number): Promise<ReadState> {
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch(
+        `/api/conversations/${encodeURIComponent(id)}/read`,
+        {
+          method: "POST",
+          headers: getHeaders(),
+          credentials: "include",
+          body: JSON.stringify(messageId ? { messageId } : {}),
+        },
+      );
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(
+          response,
+          `Mark conversation ${id} read`,
+        );
+      }
+      return response.json();
+    }, `markConversationRead(${id})`);
+  }
+
+  // GET /api/conversations/search?q=model:gpt-4o before:2024-06-01 "segfault"
+  async searchMessages(query: string, before?: number): Promise<SearchPage> {
+    const params = new URLSearchParams({ q: query });
+    if (before) {
+      params.set("before", String(before));
+    }
+
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch(`/api/conversations/search?${params}`, {
+        method: "GET",
+        headers: getHeaders(),
+        credentials: "include",
+      });
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(response, "Search messages");
+      }
+
+      return response.json() as Promise<SearchPage>;
+    }, "searchMessages");
+  }
+
+  // GET /api/conversations/{id}/tree
+  async fetchConversationTree(id: string): Promise<ConversationTree> {
+    if (!id) {
+      throw new Error("Invalid conversation ID provided");
+    }
+
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch(
+        `/api/conversations/${encodeURIComponent(id)}/tree`,
+        {
+          method: "GET",
+          headers: getHeaders(),
+          credentials: "include",
+        },
+      );
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(response, `Fetch tree ${id}`);
+      }
+
+      return response.json() as Promise<ConversationTree>;
+    }, `fetchConversationTree(${id})`);
+  }
+
+  // GET /api/conversations/{id}/draft
+  async fetchDraft(id: string): Promise<Draft> {
+    if (!id) {
+      throw new Error("Invalid conversation ID provided");
+    }
+
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch(
+        `/api/conversations/${encodeURIComponent(id)}/draft`,
+        {
+          method: "GET",
+          headers: getHeaders({
+            "Content-Type": "application/json",
+          }),
+          credentials: "include",
+        },
+      );
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(response, `Fetch draft ${id}`);
+      }
+
+      return response.json() as Promise<Draft>;
+    }, `fetchDraft(${id})`);
+  }
+
+  // PUT /api/conversations/{id}/draft, an empty draft deletes it
+  async saveDraft(
+    id: string,
+    content: string,
+    attachedFileIds: string[] = [],
+    parentId?: number,
+    sessionId?: string,
+  ): Promise<Draft> {
+    if (!id) {
+      throw new Error("Invalid conversation ID provided");
+    }
+
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch(
+        `/api/conversations/${encodeURIComponent(id)}/draft`,
+        {
+          method: "PUT",
+          headers: getHeaders({
+            "Content-Type": "application/json",
+            ...(sessionId ? { "X-Session-ID": sessionId } : {}),
+          }),
+          credentials: "include",
+          body: JSON.stringify({ content, attachedFileIds, parentId }),
+        },
+      );
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(response, `Save draft ${id}`);
+      }
+
+      return response.json() as Promise<Draft>;
+    }, `saveDraft(${id})`);
+  }
+
+  // PUT or DELETE /api/conversations/{id}/pin
+  async setConversationPinned(id: string, pinned: boolean): Promise<Conversation> {
+    return this.toggleConversation(id, "pin", pinned);
+  }
+
+  // PUT or DELETE /api/conversations/{id}/archive
+  async setConversationArchived(
+    id: string,
+    archived: boolean,
+  ): Promise<Conversation> {
+    return this.toggleConversation(id, "archive", archived);
+  }
+
+  private async toggleConversation(
+    id: string,
+    action: "pin" | "archive",
+    on: boolean,
+  ): Promise<Conversation> {
+    if (!id) {
+      throw new Error("Invalid conversation ID provided");
+    }
+
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch(
+        `/api/conversations/${encodeURIComponent(id)}/${action}`,
+        {
+          method: on ? "PUT" : "DELETE",
+          headers: getHeaders(),
+          credentials: "include",
+        },
+      );
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(
+          response,
+          `${on ? "Set" : "Clear"} ${action} of conversation ${id}`,
+        );
+      }
+
+      return response.json() as Promise<Conversation>;
+    }, `toggleConversation(${action}, ${id})`);
+  }
+
+  // PUT or DELETE /api/conversations/{id}/messages/{messageId}/pin
+  async setMessagePinned(
+    id: string,
+    messageId: number,
+    pinned: boolean,
+  ): Promise<Message> {
+    if (!id) {
+      throw new Error("Invalid conversation ID provided");
+    }
+
+    return ApiErrorHandler.handleApiCall(async () => {
+      const response = await fetch(
+        `/api/conversations/${encodeURIComponent(id)}/messages/${messageId}/pin`,
+        {
+          method: pinned ? "PUT" : "DELETE",
+          headers: getHeaders(),
+          credentials: "include",
+        },
+      );
+
+      if (!response.ok) {
+        await ApiErrorHandler.handleFetchError(
+          response,
+          `Pin message ${messageId}`,
+        );
+      }
+
+      return response.json() as Promise<Message>;
+    }, `setMessagePinned(${messageId})`);
+  }
 }
 
 // Default instance
@@ -1,6 +1,7 @@
 // Error handling utilities for API calls
 
 export interface ApiError extends Error {
+  code?: string;
   status?: number;
   statusText?: string;
   url?: string;
@@ -51,6 +52,32 @@ export class ApiErrorHandler {
     return error;
   }
 
+  /**
+   * Reads the message of an error response, the API replies with
+   * { "error": { "code", "message" } }
+   */
+  static async readErrorMessage(response: Response): Promise<string> {
+    return (await this.readError(response)).message;
+  }
+
+  /**
+   * Reads the machine readable code and the message of an error response
+   */
+  static async readError(
+    response: Response,
+  ): Promise<{ code?: string; message: string }> {
+    const text = await response.text();
+    try {
+      const body = JSON.parse(text);
+      if (typeof body?.error?.message === "string") {
+        return { code: body.error.code, message: body.error.message };
+      }
+    } catch {
+      // not JSON, use the raw text
+    }
+    return { message: text };
+  }
+
   /**
    * Handles fetch response errors with detailed information
    */
@@ -59,22 +86,26 @@ export class ApiErrorHandler {
     context: string,
   ): Promise<never> {
     let errorDetails: string;
+    let code: string | undefined;
 
     try {
-      const errorText = await response.text();
-      errorDetails = errorText || response.statusText;
+      const body = await this.readError(response);
+      errorDetails = body.message || response.statusText;
+      code = body.code;
     } catch {
       errorDetails = response.statusText || "Unknown error";
     }
 
     const message = `${context} failed (${response.status}): ${errorDetails}`;
 
-    throw this.createApiError(
+    const error = this.createApiError(
       message,
       response.status,
       response.statusText,
       response.url,
     );
+    error.code = code;
+    throw error;
   }
 
   /**
@@ -1,6 +1,13 @@
-import { FileUploadResponse, File as ApiFile } from "./types";
+import {
+  BatchDeleteResponse,
+  FileUploadResponse,
+  File as ApiFile,
+  FileUpdate,
+  PastedFile,
+} from "./types";
 
 import { getHeaders } from "./headers";
+import { ApiErrorHandler } from "./errorHandler";
 
 export class FileUploadError extends Error {
   constructor(
@@ -26,7 +33,12 @@ export const getFiles = async (): Promise<ApiFile[]> => {
   return response.json();
 };
 
-export const uploadFile = async (file: File): Promise<FileUploadResponse> => {
+// Ephemeral uploads are deleted once the message they are attached to is
+// sent, or after the ephemeralFileTTL setting.
+export const uploadFile = async (
+  file: File,
+  options: { ephemeral?: boolean } = {},
+): Promise<FileUploadResponse> => {
   if (!file) {
     throw new FileUploadError("No file provided");
   }
@@ -40,6 +52,9 @@ export const uploadFile = async (file: File): Promise<FileUploadResponse> => {
   const formData = new FormData();
   formData.append("file", file);
   formData.append("lastModified", file.lastModified.toString());
+  if (options.ephemeral) {
+    formData.append("ephemeral", "true");
+  }
 
   try {
     const response = await fetch("/api/files/upload", {
@@ -50,7 +65,7 @@ export const uploadFile = async (file: File): Promise<FileUploadResponse> => {
     });
 
     if (!response.ok) {
-      const errorText = await response.text();
+      const errorText = await ApiErrorHandler.readErrorMessage(response);
       throw new FileUploadError(`Upload failed: ${errorText}`, response.status);
     }
 
@@ -66,6 +81,35 @@ export const uploadFile = async (file: File): Promise<FileUploadResponse> => {
   }
 };
 
+// pasteImage uploads a pasted image. Ephemeral pastes are deleted once
+// the message they are attached to is sent.
+export const pasteImage = async (
+  image: Blob,
+  options: { name?: string; ephemeral?: boolean; dataUrl?: boolean } = {},
+): Promise<PastedFile> => {
+  const params = new URLSearchParams();
+  if (options.name) params.set("name", options.name);
+  if (options.ephemeral) params.set("ephemeral", "true");
+  if (options.dataUrl) params.set("format", "data-url");
+
+  const response = await fetch(`/api/files/paste?${params}`, {
+    headers: {
+      ...getHeaders(),
+      "Content-Type": image.type || "application/octet-stream",
+    },
+    method: "POST",
+    credentials: "include",
+    body: image,
+  });
+
+  if (!response.ok) {
+    const errorText = await ApiErrorHandler.readErrorMessage(response);
+    throw new FileUploadError(`Paste failed: ${errorText}`, response.status);
+  }
+
+  return response.json();
+};
+
 export const deleteFile = async (id: string): Promise<void> => {
   const response = await fetch(`/api/files/delete/${id}`, {
     headers: getHeaders(),
@@ -78,6 +122,69 @@ export const deleteFile = async (id: string): Promise<void> => {
   }
 };
 
+// updateFile renames a file, corrects its extracted text or sets its
+// description. Fields that are left out are kept.
+export const updateFile = async (
+  id: string,
+  update: FileUpdate,
+): Promise<ApiFile> => {
+  const response = await fetch(`/api/files/${id}`, {
+    method: "PATCH",
+    headers: {
+      ...getHeaders(),
+      "Content-Type": "application/json",
+    },
+    credentials: "include",
+    body: JSON.stringify(update),
+  });
+
+  if (!response.ok) {
+    const errorText = await ApiErrorHandler.readErrorMessage(response);
+    throw new Error(`Failed to update file: ${errorText}`);
+  }
+
+  return response.json();
+};
+
+export const deleteFiles = async (
+  fileIds: string[],
+): Promise<BatchDeleteResponse> => {
+  const response = await fetch("/api/files/batch-delete", {
+    method: "POST",
+    headers: {
+      ...getHeaders(),
+      "Content-Type": "application/json",
+    },
+    credentials: "include",
+    body: JSON.stringify({ fileIds }),
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to delete files");
+  }
+
+  return response.json();
+};
+
+// downloadFiles returns a zip archive of the files.
+export const downloadFiles = async (fileIds: string[]): Promise<Blob> => {
+  const response = await fetch("/api/files/batch-download", {
+    method: "POST",
+    headers: {
+      ...getHeaders(),
+      "Content-Type": "application/json",
+    },
+    credentials: "include",
+    body: JSON.stringify({ fileIds }),
+  });
+
+  if (!response.ok) {
+    throw new Error("Failed to download files");
+  }
+
+  return response.blob();
+};
+
 export const extractContent = async (fileIds: string[]): Promise<ApiFile[]> => {
   const response = await fetch(`/api/files/extract-content`, {
     method: "POST",
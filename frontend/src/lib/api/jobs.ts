@@ -0,0 +1,39 @@
+import { Job, JobStatus } from "./types";
+import { getHeaders } from "./headers";
+
+// Get the user's background jobs, newest first
+export const getJobs = async (status?: JobStatus): Promise<Job[]> => {
+  const query = status ? `?status=${status}` : "";
+  const response = await fetch(`/api/jobs/${query}`, {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch jobs: ${response.statusText}`);
+  }
+
+  const data: { jobs: Job[] } = await response.json();
+  return data.jobs;
+};
+
+export const getJob = async <Result = unknown>(
+  id: number,
+): Promise<Job<Result>> => {
+  const response = await fetch(`/api/jobs/${id}`, {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch job: ${response.statusText}`);
+  }
+
+  return response.json();
+};
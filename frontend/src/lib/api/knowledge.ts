@@ -0,0 +1,191 @@
+import {
+  CrawlRequest,
+  CrawlResult,
+  Job,
+  KnowledgeBase,
+  KnowledgeBaseRequest,
+  KnowledgeResult,
+} from "./types";
+import { getHeaders } from "./headers";
+
+// Get the user's knowledge bases, or only those attached to a conversation
+export const getKnowledgeBases = async (
+  conversationId?: string,
+): Promise<KnowledgeBase[]> => {
+  const query = conversationId
+    ? `?conversation=${encodeURIComponent(conversationId)}`
+    : "";
+  const response = await fetch(`/api/knowledge/${query}`, {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch knowledge bases: ${response.statusText}`);
+  }
+
+  const data: { knowledgeBases: KnowledgeBase[] } = await response.json();
+  return data.knowledgeBases;
+};
+
+export const createKnowledgeBase = async (
+  req: KnowledgeBaseRequest,
+): Promise<KnowledgeBase> => {
+  const response = await fetch("/api/knowledge/", {
+    method: "POST",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    body: JSON.stringify(req),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to create knowledge base: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+export const updateKnowledgeBase = async (
+  id: string,
+  req: KnowledgeBaseRequest,
+): Promise<KnowledgeBase> => {
+  const response = await fetch(`/api/knowledge/${id}`, {
+    method: "PUT",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    body: JSON.stringify(req),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to update knowledge base: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+// Delete a knowledge base, its files are kept
+export const deleteKnowledgeBase = async (id: string): Promise<void> => {
+  const response = await fetch(`/api/knowledge/${id}`, {
+    method: "DELETE",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to delete knowledge base: ${response.statusText}`);
+  }
+};
+
+export const addKnowledgeFiles = async (
+  id: string,
+  fileIds: string[],
+): Promise<KnowledgeBase> => {
+  const response = await fetch(`/api/knowledge/${id}/files`, {
+    method: "POST",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    body: JSON.stringify({ fileIds }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to add files: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+export const removeKnowledgeFile = async (
+  id: string,
+  fileId: string,
+): Promise<void> => {
+  const response = await fetch(`/api/knowledge/${id}/files/${fileId}`, {
+    method: "DELETE",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to remove file: ${response.statusText}`);
+  }
+};
+
+// Attach or detach a knowledge base, the model can search attached ones
+export const setKnowledgeAttached = async (
+  id: string,
+  conversationId: string,
+  attached: boolean,
+): Promise<void> => {
+  const response = await fetch(
+    `/api/knowledge/${id}/conversations/${conversationId}`,
+    {
+      method: attached ? "PUT" : "DELETE",
+      headers: getHeaders({
+        "Content-Type": "application/json",
+      }),
+      credentials: "include",
+    },
+  );
+
+  if (!response.ok) {
+    throw new Error(
+      `Failed to update the conversation's knowledge: ${response.statusText}`,
+    );
+  }
+};
+
+// Queue a crawl of a site, poll the job for its result
+export const crawlSite = async (
+  id: string,
+  req: CrawlRequest,
+): Promise<Job<CrawlResult>> => {
+  const response = await fetch(`/api/knowledge/${id}/crawl`, {
+    method: "POST",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    body: JSON.stringify(req),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to queue crawl: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+export const searchKnowledgeBase = async (
+  id: string,
+  query: string,
+): Promise<KnowledgeResult[]> => {
+  const response = await fetch(
+    `/api/knowledge/${id}/search?q=${encodeURIComponent(query)}`,
+    {
+      method: "GET",
+      headers: getHeaders({
+        "Content-Type": "application/json",
+      }),
+      credentials: "include",
+    },
+  );
+
+  if (!response.ok) {
+    throw new Error(`Failed to search knowledge base: ${response.statusText}`);
+  }
+
+  const data: { results: KnowledgeResult[] } = await response.json();
+  return data.results;
+};
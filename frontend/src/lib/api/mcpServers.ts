@@ -1,5 +1,10 @@
 
-import { MCPServerRequest, MCPServerResponse } from "./types";
+import {
+  HTTPServerRequest,
+  MCPServerRequest,
+  MCPServerResponse,
+  OpenAPIImportRequest,
+} from "./types";
 import { getHeaders } from "./headers";
 
 // Get all MCP servers
@@ -89,3 +94,43 @@ export const refreshMCPTools = async (id: string): Promise<void> => {
     );
   }
 };
+
+// Add or replace HTTP tools
+export const saveHTTPTools = async (
+  serverData: HTTPServerRequest,
+): Promise<MCPServerResponse> => {
+  const response = await fetch("/api/tools/http/save", {
+    method: "POST",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    body: JSON.stringify(serverData),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to save HTTP tools: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+// Add HTTP tools from an OpenAPI spec
+export const importOpenAPITools = async (
+  request: OpenAPIImportRequest,
+): Promise<MCPServerResponse> => {
+  const response = await fetch("/api/tools/http/openapi", {
+    method: "POST",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    body: JSON.stringify(request),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to import OpenAPI spec: ${response.statusText}`);
+  }
+
+  return response.json();
+};
@@ -4,9 +4,19 @@
  * Uses global model management endpoints:
  *   GET  /api/models/all       -> returns all models (enabled + disabled)
  *   POST /api/models/save-all  -> persists model enable/disable changes
+ *   GET  /api/models/recent    -> models by last use, for the quick-switcher
+ *   GET  /api/prompts/recent   -> prompt templates by last use
+ *   PUT/DELETE /api/models/{id}/favorite -> marks or unmarks a favorite
+ *   GET/PUT /api/models/aliases -> the user's model aliases
  */
 
-import { Model, ModelsResponse } from "./types";
+import {
+  Model,
+  ModelAliasesResponse,
+  ModelsResponse,
+  RecentModelsResponse,
+  RecentPromptsResponse,
+} from "./types";
 
 import { getHeaders } from "./headers";
 
@@ -29,6 +39,52 @@ export async function getAllModels(): Promise<ModelsResponse> {
   return response.json();
 }
 
+/**
+ * Fetch the models the user chats with, most recently used first,
+ * or most used first when frequent is set.
+ */
+export async function getRecentModels(
+  frequent = false,
+): Promise<RecentModelsResponse> {
+  const query = frequent ? "?sort=frequent" : "";
+  const response = await fetch(`/api/models/recent${query}`, {
+    method: "GET",
+    headers: getHeaders({ "Content-Type": "application/json" }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(
+      `Failed to fetch recent models: ${response.status} ${response.statusText}`,
+    );
+  }
+
+  return response.json();
+}
+
+/**
+ * Fetch the prompt templates the user used, most recently used first,
+ * or most used first when frequent is set.
+ */
+export async function getRecentPrompts(
+  frequent = false,
+): Promise<RecentPromptsResponse> {
+  const query = frequent ? "?sort=frequent" : "";
+  const response = await fetch(`/api/prompts/recent${query}`, {
+    method: "GET",
+    headers: getHeaders({ "Content-Type": "application/json" }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(
+      `Failed to fetch recent prompts: ${response.status} ${response.statusText}`,
+    );
+  }
+
+  return response.json();
+}
+
 /**
  * Save the entire models list with updated enable/disable states.
  */
@@ -56,6 +112,67 @@ export async function saveAllModels(models: Model[]): Promise<void> {
   }
 }
 
+/**
+ * Mark or unmark a model as favorite.
+ */
+export async function setFavoriteModel(
+  modelId: string,
+  favorite: boolean,
+): Promise<void> {
+  const response = await fetch(
+    `/api/models/${encodeURIComponent(modelId)}/favorite`,
+    {
+      method: favorite ? "PUT" : "DELETE",
+      headers: getHeaders(),
+      credentials: "include",
+    },
+  );
+
+  if (!response.ok) {
+    throw new Error(
+      `Failed to update favorite: ${response.status} ${response.statusText}`,
+    );
+  }
+}
+
+export async function getModelAliases(): Promise<ModelAliasesResponse> {
+  const response = await fetch("/api/models/aliases", {
+    method: "GET",
+    headers: getHeaders({ "Content-Type": "application/json" }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(
+      `Failed to fetch model aliases: ${response.status} ${response.statusText}`,
+    );
+  }
+
+  return response.json();
+}
+
+/**
+ * Replace all model aliases of the user.
+ */
+export async function saveModelAliases(
+  aliases: Record<string, string>,
+): Promise<ModelAliasesResponse> {
+  const response = await fetch("/api/models/aliases", {
+    method: "PUT",
+    headers: getHeaders({ "Content-Type": "application/json" }),
+    credentials: "include",
+    body: JSON.stringify({ aliases }),
+  });
+
+  if (!response.ok) {
+    throw new Error(
+      `Failed to save model aliases: ${response.status} ${await response.text()}`,
+    );
+  }
+
+  return response.json();
+}
+
 /**
  * Optimistic utility:
  * Applies enable/disable to a local array (immutable) so UI can update while request is in-flight.
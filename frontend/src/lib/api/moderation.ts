@@ -0,0 +1,28 @@
+import { ModerationDecisionsPage } from "./types";
+import { getHeaders } from "./headers";
+
+// List the content flagged by moderation, newest first (admins only)
+export const getModerationDecisions = async (
+  before?: number,
+  limit?: number,
+): Promise<ModerationDecisionsPage> => {
+  const params = new URLSearchParams();
+  if (before) params.set("before", before.toString());
+  if (limit) params.set("limit", limit.toString());
+
+  const response = await fetch(`/api/moderation/decisions?${params}`, {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(
+      `Failed to fetch moderation decisions: ${response.statusText}`,
+    );
+  }
+
+  return response.json();
+};
@@ -1,5 +1,10 @@
-
-import { FrontendProvider, ProviderRequest, ProviderResponse } from "./types";
+import {
+  FrontendProvider,
+  Model,
+  ModelsResponse,
+  ProviderRequest,
+  ProviderResponse,
+} from "./types";
 import { getHeaders } from "./headers";
 
 // Get all providers
@@ -60,6 +65,95 @@ export const refreshProviderModels = async (id: string): Promise<void> => {
   }
 };
 
+// Refresh models and probe the enabled ones for tool, vision and reasoning
+// support with small test calls. Slow, as it calls every model.
+export const probeProviderModels = async (id: string): Promise<Model[]> => {
+  const response = await fetch(
+    `/api/providers/refresh-models/${id}?probe=true`,
+    {
+      method: "POST",
+      headers: getHeaders({
+        "Content-Type": "application/json",
+      }),
+      credentials: "include",
+    },
+  );
+
+  if (!response.ok) {
+    throw new Error(`Failed to probe provider models: ${response.statusText}`);
+  }
+
+  const data: ModelsResponse = await response.json();
+  return data.models;
+};
+
+// Replace the extra headers sent with every request to a provider
+export const updateProviderHeaders = async (
+  id: string,
+  headers: Record<string, string>,
+): Promise<void> => {
+  const response = await fetch(`/api/providers/${id}/headers`, {
+    method: "PUT",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    body: JSON.stringify({ headers }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(
+      `Failed to update provider headers: ${response.statusText}`,
+    );
+  }
+};
+
+// Set the proxy requests to a provider go through, empty uses the one of
+// the instance
+export const updateProviderProxy = async (
+  id: string,
+  proxy: string,
+): Promise<string> => {
+  const response = await fetch(`/api/providers/${id}/proxy`, {
+    method: "PUT",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    body: JSON.stringify({ proxy }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to update provider proxy: ${response.statusText}`);
+  }
+
+  const data: { proxy: string } = await response.json();
+  return data.proxy;
+};
+
+// Share a provider with the users, or with everyone when there are none
+// (admins only)
+export const updateProviderSharing = async (
+  id: string,
+  shared: boolean,
+  users: string[] = [],
+): Promise<void> => {
+  const response = await fetch(`/api/providers/${id}/sharing`, {
+    method: "PUT",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    body: JSON.stringify({ shared, users }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(
+      `Failed to update provider sharing: ${response.statusText}`,
+    );
+  }
+};
+
 // Delete provider
 export const deleteProvider = async (id: string): Promise<void> => {
   const response = await fetch(`/api/providers/delete/${id}`, {
@@ -0,0 +1,55 @@
+import { RequestLog, RequestLogsPage } from "./types";
+import { getHeaders } from "./headers";
+
+// List logged provider requests, newest first (admins only)
+export const getRequestLogs = async (
+  filter: { user?: string; provider?: string } = {},
+  before?: number,
+  limit?: number,
+): Promise<RequestLogsPage> => {
+  const params = new URLSearchParams();
+  if (filter.user) params.set("user", filter.user);
+  if (filter.provider) params.set("provider", filter.provider);
+  if (before) params.set("before", before.toString());
+  if (limit) params.set("limit", limit.toString());
+
+  const response = await fetch(`/api/admin/request-logs?${params}`, {
+    method: "GET",
+    headers: getHeaders(),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch request logs: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+// Get a logged request with its headers and payloads
+export const getRequestLog = async (id: number): Promise<RequestLog> => {
+  const response = await fetch(`/api/admin/request-logs/${id}`, {
+    method: "GET",
+    headers: getHeaders(),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch request log: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+// Delete every logged request
+export const clearRequestLogs = async (): Promise<void> => {
+  const response = await fetch("/api/admin/request-logs", {
+    method: "DELETE",
+    headers: getHeaders(),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to delete request logs: ${response.statusText}`);
+  }
+};
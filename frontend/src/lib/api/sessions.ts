@@ -0,0 +1,19 @@
+import { Session } from "./types";
+import { getHeaders } from "./headers";
+
+// Get the user's connected sessions, the calling one marked current
+export const getActiveSessions = async (): Promise<Session[]> => {
+  const response = await fetch("/api/sessions/active", {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch sessions: ${response.statusText}`);
+  }
+
+  return response.json();
+};
@@ -2,6 +2,37 @@
 
 export interface AuthStatus {
   authenticated: boolean;
+  oidc: boolean;
+  registration: RegistrationMode;
+}
+
+// Who may sign up, the first user always can
+export type RegistrationMode = "open" | "invite" | "closed";
+
+// A single-use code to sign up, the code is only returned when created
+export interface Invitation {
+  id: number;
+  code?: string;
+  note: string;
+  createdBy: string;
+  createdAt: string;
+  expiresAt: string;
+  usedBy?: string;
+  usedAt?: string;
+}
+
+export interface InvitationsResponse {
+  registration: RegistrationMode;
+  invitations: Invitation[];
+}
+
+export interface TwoFactorStatus {
+  enabled: boolean;
+}
+
+export interface TwoFactorSetup {
+  secret: string;
+  url: string;
 }
 
 // File types
@@ -17,6 +48,31 @@ export interface File {
   // Optional uploaded timestamp (server may provide this). If present,
   // use `uploadedAt` for UI sorting/labeling; otherwise fall back to `createdAt`.
   uploadedAt?: string;
+  // A note of the user sent to models along with the content.
+  description?: string;
+  // When an ephemeral file is deleted, absent for kept files.
+  expiresAt?: string;
+}
+
+export interface BatchDeleteResponse {
+  deleted: string[];
+  notFound: string[];
+}
+
+export interface FileUpdate {
+  name?: string;
+  content?: string;
+  description?: string;
+}
+
+// A file attached to or made in a conversation, with the messages it
+// appears in. The extracted text is left out.
+export interface ConversationFile extends File {
+  messageIds: number[];
+}
+
+export interface PastedFile extends File {
+  dataUrl?: string;
 }
 
 export interface Attachment {
@@ -25,6 +81,16 @@ export interface Attachment {
   file: File;
 }
 
+// Lifecycle of a message: pending until the provider sends the first
+// chunk, streaming until the answer ends with one of the other statuses.
+export type MessageStatus =
+  | "pending"
+  | "streaming"
+  | "completed"
+  | "error"
+  | "stopped"
+  | "interrupted";
+
 export interface Message {
   id: number;
 
@@ -34,7 +100,7 @@ export interface Message {
 
   content: string;
   reasoning?: string;
-  status: string;
+  status: MessageStatus;
   tools?: ToolCall[];
 
   parentId?: number;
@@ -47,6 +113,80 @@ export interface Message {
   speed?: number;
   tokenCount?: number;
   contextSize?: number;
+  // "length" when the answer was cut off at the max token limit
+  finishReason?: string;
+  // always sent to the model, even from another branch
+  pinned?: boolean;
+}
+
+// Branch structure of a conversation without message bodies
+export interface TreeNode {
+  id: number;
+  parentId?: number;
+  role: string;
+  model?: string;
+  status: MessageStatus;
+  preview: string;
+  childCount: number;
+  pinned?: boolean;
+}
+
+export interface ConversationTree {
+  conversationId: string;
+  roots: number[];
+  nodes: TreeNode[]; // by ID, parents before their children
+}
+
+// Draft is an unsent message, kept on the server per conversation
+export interface Draft {
+  conversationId: string;
+  content: string;
+  parentId?: number;
+  attachedFileIds: string[];
+  updatedAt?: string;
+}
+
+export interface SearchQuery {
+  terms?: string[];
+  role?: "user" | "assistant";
+  model?: string;
+  conversationId?: string;
+  after?: string;
+  before?: string;
+  hasAttachment?: boolean;
+  hasToolCall?: boolean;
+}
+
+export interface SearchResult {
+  conversationId: string;
+  conversationTitle: string;
+  messageId: number;
+  role: "user" | "assistant";
+  model?: string;
+  snippet: string;
+  // start of the message the result replies to
+  context?: string;
+  createdAt: string;
+}
+
+export interface SearchPage {
+  query: SearchQuery;
+  results: SearchResult[];
+  nextCursor?: number;
+}
+
+// A response being generated, listed by /api/chat/active so the UI can show
+// that another response is in progress
+export interface Generation {
+  conversationId: string;
+  messageId?: number;
+  model: string;
+  startedAt: string;
+}
+
+export interface ActiveGenerations {
+  generations: Generation[];
+  limit: number;
 }
 
 export interface Conversation {
@@ -57,6 +197,12 @@ export interface Conversation {
 
   createdAt: string;
   updatedAt: string;
+  // Answers the user has not seen yet, only set in the conversation list
+  unread?: number;
+  // Pinned conversations are exempt from retention
+  pinned?: boolean;
+  // Set while the conversation is archived
+  archivedAt?: string;
 
   // Client-only compatibility fields
   messages: Record<number, Message>; // Always initialized to {} in frontend
@@ -65,6 +211,19 @@ export interface Conversation {
   activeBranches?: Record<number, number>; // messageId -> activeChildId mapping
 }
 
+// How far the user has read a conversation
+export interface ReadState {
+  conversationId: string;
+  lastReadMessageId: number;
+  updatedAt: string;
+}
+
+// Summary of a conversation written by the utility model
+export interface ConversationSummaryText {
+  summary: string;
+  model: string;
+}
+
 export interface ChatRequest {
   conversationId: string | null;
   parentId: number;
@@ -98,6 +257,8 @@ export interface ToolCall {
   name: string;
   args?: string;
   tool_output?: string;
+  // How to render tool_output, plain text when unset
+  output_type?: "json" | "markdown" | "image_url" | "table";
 }
 
 // Streaming types
@@ -111,6 +272,14 @@ export interface StreamChunk {
   content?: string;
   reasoning?: string;
   tool_call?: ToolCall;
+  tool_budget_exceeded?: ToolBudgetExceeded;
+}
+
+// Sent when an answer used up its tool calls and finishes without tools
+export interface ToolBudgetExceeded {
+  reason: "iterations" | "time";
+  iterations: number;
+  toolTimeMs: number;
 }
 
 export interface StreamStats {
@@ -186,7 +355,12 @@ export const backendToFrontendMessage = (
     content: backendMsg.content || "",
     reasoning: backendMsg.reasoning,
     toolCalls: backendMsg.tools,
-    status: backendMsg.status === "pending" ? "pending" : "completed",
+    // "streaming" is still in progress; error, stopped and interrupted
+    // answers are finished
+    status:
+      backendMsg.status === "pending" || backendMsg.status === "streaming"
+        ? "pending"
+        : "completed",
     error: backendMsg.error,
     timestamp: Date.now(), // Backend doesn't provide timestamp, use current time
     attachments: backendMsg.attachments,
@@ -203,12 +377,17 @@ export interface ProviderRequest {
   base_url: string;
   api_key: string;
   headers?: Record<string, string>;
+  proxy?: string; // http(s) or socks5 URL, empty uses the instance proxy
 }
 
 export interface ProviderResponse {
   id: string;
   base_url: string;
   headers?: Record<string, string>;
+  proxy?: string; // without its password
+  shared: boolean;
+  owner?: string; // the admin sharing it, unset for own providers
+  allowed_users?: string[]; // of an own shared provider, empty means everyone
 }
 
 export interface Model {
@@ -219,12 +398,55 @@ export interface Model {
   provider: string; // provider id
 
   is_enabled: boolean; // whether the model is enabled (shown/usable)
+
+  favorite?: boolean; // marked as favorite by the user
+
+  aliases?: string[]; // short names the user can chat with instead of the id
+
+  supports_vision?: boolean; // capabilities, missing when unknown
+
+  supports_tools?: boolean;
+
+  supports_reasoning?: boolean;
+
+  probed_at?: string; // when the capabilities were last verified by a probe
 }
 
 export interface ModelsResponse {
   models: Model[];
 }
 
+// Alias -> model id, e.g. { fast: "provider-x/gpt-4o-mini" }
+export interface ModelAliasesResponse {
+  aliases: Record<string, string>;
+}
+
+// Models ordered by use for the quick-switcher
+export interface RecentModel extends Model {
+  use_count: number;
+  last_used_at: string;
+}
+
+export interface RecentModelsResponse {
+  models: RecentModel[];
+}
+
+export interface RecentPrompt {
+  id: string;
+  name: string;
+  description: string;
+  content: string;
+  shared: boolean;
+  owner: string;
+  variables: string[];
+  useCount: number;
+  lastUsedAt: string;
+}
+
+export interface RecentPromptsResponse {
+  templates: RecentPrompt[];
+}
+
 // Settings API Types
 export interface Settings {
   settings: Record<string, string>;
@@ -271,6 +493,69 @@ export interface Tool {
   input_schema?: Record<string, any>;
   require_approval?: boolean;
   is_enabled?: boolean;
+  type?: "mcp" | "http";
+  http?: HTTPTemplate;
+}
+
+// HTTP Tools API Types
+export interface HTTPTemplate {
+  method: string;
+  url: string;
+}
+
+export interface HTTPToolRequest {
+  name: string;
+  description?: string;
+  method?: string;
+  url: string;
+  input_schema?: Record<string, any>;
+}
+
+export interface HTTPServerRequest {
+  id?: string;
+  name: string;
+  base_url?: string;
+  api_key?: string;
+  headers?: Record<string, string>;
+  tools: HTTPToolRequest[];
+}
+
+export interface OpenAPIImportRequest {
+  id?: string;
+  name?: string;
+  spec?: string;
+  spec_url?: string;
+  base_url?: string;
+  api_key?: string;
+  headers?: Record<string, string>;
+  operations?: string[];
+}
+
+// The user's profile and the preferences that follow them to every device
+export interface Profile {
+  username: string;
+  role: string;
+  displayName: string;
+  avatarFileId?: string;
+  avatarUrl?: string;
+  defaultModel: string;
+  preferences: Record<string, string>; // client-scope settings, e.g. theme
+}
+
+// Only the fields that are set change
+export interface ProfileUpdate {
+  displayName?: string;
+  defaultModel?: string;
+  preferences?: Record<string, string>;
+}
+
+// A connected tab or app of the user
+export interface Session {
+  id: string;
+  device: string; // e.g. "Firefox on Linux"
+  connectedAt: string;
+  lastSeen: string;
+  current?: boolean;
 }
 
 export type ConversationEvent =
@@ -296,4 +581,272 @@ export type ConversationEvent =
       conversationId: string;
       messageId: number;
       message: Message;
-    };
+    }
+  | {
+      // final state of a generated answer, after its last message_updated
+      type: "generation_completed";
+      conversationId: string;
+      messageId: number;
+      message: Message;
+    }
+  | {
+      type: "draft_updated";
+      conversationId: string;
+      draft: Draft;
+    }
+  | {
+      type: "conversation_read";
+      conversationId: string;
+      messageId: number;
+    }
+  | { type: "session_connected"; session: Session }
+  | { type: "session_disconnected"; session: Session };
+
+// Webhook API Types
+export type WebhookEvent =
+  | "message_completed"
+  | "conversation_created"
+  | "tool_failed";
+
+export interface Webhook {
+  id: number;
+  url: string;
+  secret?: string; // only returned when the webhook is created
+  events: WebhookEvent[];
+  isEnabled: boolean;
+  lastStatus?: number;
+  lastError?: string;
+  lastDeliveryAt?: string;
+  createdAt: string;
+}
+
+export interface WebhookRequest {
+  url: string;
+  events: WebhookEvent[];
+  isEnabled?: boolean;
+}
+
+export interface WebhookTestResult {
+  status?: number;
+  error?: string;
+}
+
+// Moderation API Types
+// Sent with the stream "moderation" event and listed to admins
+export interface ModerationDecision {
+  id: number;
+  user: string;
+  conversationId: string;
+  messageId: number;
+  stage: "input" | "output";
+  source: "rules" | "model";
+  categories: string[];
+  action: "annotate" | "block";
+  excerpt: string;
+  createdAt: string;
+}
+
+export interface ModerationDecisionsPage {
+  decisions: ModerationDecision[];
+  nextCursor?: number;
+}
+
+// Request log API Types
+// Raw provider request kept for debugging, with credentials scrubbed.
+// Headers and bodies are only returned for a single log.
+export interface RequestLog {
+  id: number;
+  user: string;
+  providerId: string;
+  method: string;
+  url: string;
+  status: number;
+  requestHeaders?: Record<string, string>;
+  requestBody?: string;
+  responseBody?: string;
+  error?: string;
+  durationMs: number;
+  createdAt: string;
+}
+
+export interface RequestLogsPage {
+  logs: RequestLog[];
+  nextCursor?: number;
+}
+
+// Knowledge base API Types
+// A named collection of files, searchable from the conversations it is
+// attached to
+export interface KnowledgeBase {
+  id: string;
+  name: string;
+  description: string;
+  fileIds: string[];
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface KnowledgeBaseRequest {
+  name: string;
+  description?: string;
+  fileIds?: string[]; // only read when creating
+}
+
+export interface KnowledgeResult {
+  fileId: string;
+  fileName: string;
+  url?: string; // source of a crawled page
+  page?: number; // missing for files without pages
+  snippet: string;
+}
+
+export interface CrawlRequest {
+  url: string;
+  maxDepth?: number; // links to follow from url, 1 by default, at most 3
+  maxPages?: number; // 20 by default, at most 100
+}
+
+export interface CrawlResult {
+  pages: {
+    url: string;
+    fileId: string;
+    title: string;
+    status: "added" | "updated" | "unchanged";
+  }[];
+  errors?: string[];
+}
+
+// A list of prompts run against one model in the background
+export interface PromptBatch {
+  model: string;
+  prompts: string[];
+  systemPrompt?: string; // the systemPrompt setting when omitted
+}
+
+export interface BatchItem {
+  prompt: string;
+  content: string;
+  error?: string;
+  tokens: number;
+}
+
+// progress of a running batch job, items are null until answered
+export interface BatchProgress {
+  done: number;
+  total: number;
+  items: (BatchItem | null)[];
+}
+
+export interface BatchResults {
+  model: string;
+  items: BatchItem[];
+}
+
+// Job API Types
+// Background work such as text extraction and crawls, retried on failure
+export type JobStatus = "queued" | "running" | "done" | "failed";
+
+export interface Job<Result = unknown> {
+  id: number;
+  kind: string;
+  payload: unknown;
+  status: JobStatus;
+  attempts: number;
+  maxAttempts: number;
+  error?: string;
+  progress?: unknown; // reported by some jobs while they run
+  result?: Result; // set once the job is done
+  runAt: string;
+  createdAt: string;
+  updatedAt: string;
+}
+
+// Usage API Types
+// Monthly limits on the tokens and cost of a user, 0 means no limit
+export interface UsageBudget {
+  user: string;
+  monthlyTokens: number;
+  monthlyCost: number;
+  updatedAt: string;
+}
+
+export interface BudgetStatus {
+  periodStart: string;
+  resetsAt: string; // the first of next month, UTC
+  tokensUsed: number;
+  costUsed: number;
+  tokenLimit?: number;
+  costLimit?: number;
+  tokensRemaining?: number;
+  costRemaining?: number;
+  exceeded: boolean;
+}
+
+// Token caps of each user other than the owner on a shared provider, 0
+// means no cap
+export interface ProviderQuota {
+  provider: string;
+  dailyTokens: number;
+  monthlyTokens: number;
+  updatedAt: string;
+}
+
+export interface QuotaStatus extends ProviderQuota {
+  tokensToday: number;
+  tokensThisMonth: number;
+  dailyRemaining?: number;
+  monthlyRemaining?: number;
+  exceeded: boolean;
+  resetsAt?: string; // when the provider can be used again once exceeded
+}
+
+export interface DailyUsage {
+  day: string; // YYYY-MM-DD, UTC
+  user: string;
+  model: string;
+  requests: number;
+  promptTokens: number;
+  completionTokens: number;
+  cost: number;
+}
+
+// Admin API Types
+export interface AdminStats {
+  since: string; // first day counted, YYYY-MM-DD
+  users: number;
+  activeUsers: number; // sent a message since then
+  conversations: number;
+  messages: number;
+  messagesPerDay: { day: string; count: number }[];
+  activeStreams: number;
+  providers: {
+    providerId: string;
+    url?: string; // missing once the provider is deleted
+    responses: number;
+    errors: number;
+    errorRate: number;
+  }[];
+  storage: {
+    databaseBytes: number;
+    files: number;
+    fileBytes: number;
+  };
+}
+
+// Actions are grouped by the part before the dot: auth, user, provider,
+// mcp, settings, config and budget
+export interface AuditEntry {
+  id: number;
+  actor: string; // the username tried, for failed logins
+  action: string; // e.g. "auth.login_failed", "provider.update"
+  target?: string;
+  ip?: string;
+  // changes are { field: { from, to } } with secrets redacted
+  payload?: Record<string, unknown>;
+  createdAt: string;
+}
+
+export interface AuditLogPage {
+  entries: AuditEntry[];
+  nextCursor?: number; // pass as before for the next page
+}
@@ -0,0 +1,203 @@
+import {
+  BudgetStatus,
+  DailyUsage,
+  ProviderQuota,
+  QuotaStatus,
+  UsageBudget,
+} from "./types";
+import { getHeaders } from "./headers";
+
+// Get the user's usage of this month and the remaining budget
+export const getBudgetStatus = async (): Promise<BudgetStatus> => {
+  const response = await fetch("/api/usage/budget", {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch usage: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+// List the budgets of all users (admins only)
+export const getBudgets = async (): Promise<UsageBudget[]> => {
+  const response = await fetch("/api/admin/budgets", {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch budgets: ${response.statusText}`);
+  }
+
+  const data: { budgets: UsageBudget[] } = await response.json();
+  return data.budgets;
+};
+
+// Set the monthly budget of a user, 0 means no limit (admins only)
+export const setBudget = async (
+  user: string,
+  monthlyTokens: number,
+  monthlyCost: number,
+): Promise<UsageBudget> => {
+  const response = await fetch(`/api/admin/budgets/${encodeURIComponent(user)}`, {
+    method: "PUT",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+    body: JSON.stringify({ monthlyTokens, monthlyCost }),
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to set budget: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+export const deleteBudget = async (user: string): Promise<void> => {
+  const response = await fetch(`/api/admin/budgets/${encodeURIComponent(user)}`, {
+    method: "DELETE",
+    headers: getHeaders(),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to delete budget: ${response.statusText}`);
+  }
+};
+
+// Get the user's usage of shared providers against their quotas
+export const getQuotaStatuses = async (): Promise<QuotaStatus[]> => {
+  const response = await fetch("/api/usage/quotas", {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch quotas: ${response.statusText}`);
+  }
+
+  const data: { quotas: QuotaStatus[] } = await response.json();
+  return data.quotas;
+};
+
+// List the quotas of shared providers (admins only)
+export const getQuotas = async (): Promise<ProviderQuota[]> => {
+  const response = await fetch("/api/admin/quotas", {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch quotas: ${response.statusText}`);
+  }
+
+  const data: { quotas: ProviderQuota[] } = await response.json();
+  return data.quotas;
+};
+
+// Set the token caps of each user of a shared provider, 0 means no cap
+// (admins only)
+export const setQuota = async (
+  provider: string,
+  dailyTokens: number,
+  monthlyTokens: number,
+): Promise<ProviderQuota> => {
+  const response = await fetch(`/api/admin/quotas/${encodeURIComponent(provider)}`, {
+    method: "PUT",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+    body: JSON.stringify({ dailyTokens, monthlyTokens }),
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to set quota: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+export const deleteQuota = async (provider: string): Promise<void> => {
+  const response = await fetch(`/api/admin/quotas/${encodeURIComponent(provider)}`, {
+    method: "DELETE",
+    headers: getHeaders(),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to delete quota: ${response.statusText}`);
+  }
+};
+
+export interface UsageRange {
+  from?: string; // YYYY-MM-DD, 30 days before to by default
+  to?: string; // YYYY-MM-DD, today (UTC) by default
+  model?: string;
+}
+
+const rangeQuery = (range: UsageRange & { user?: string }): string => {
+  const params = new URLSearchParams();
+  Object.entries(range).forEach(([key, value]) => {
+    if (value) params.set(key, value);
+  });
+  const query = params.toString();
+  return query ? `?${query}` : "";
+};
+
+// Get the user's usage per day and model, newest first
+export const getDailyUsage = async (
+  range: UsageRange = {},
+): Promise<DailyUsage[]> => {
+  const response = await fetch(`/api/usage/daily${rangeQuery(range)}`, {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch usage: ${response.statusText}`);
+  }
+
+  const data: { days: DailyUsage[] } = await response.json();
+  return data.days;
+};
+
+// Get the usage of all users, or one, per day and model (admins only)
+export const getUsageReport = async (
+  range: UsageRange & { user?: string } = {},
+): Promise<DailyUsage[]> => {
+  const response = await fetch(`/api/admin/usage${rangeQuery(range)}`, {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch usage: ${response.statusText}`);
+  }
+
+  const data: { days: DailyUsage[] } = await response.json();
+  return data.days;
+};
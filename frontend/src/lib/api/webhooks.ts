@@ -0,0 +1,89 @@
+import { Webhook, WebhookRequest, WebhookTestResult } from "./types";
+import { getHeaders } from "./headers";
+
+// Get the user's webhooks, without their secrets
+export const getWebhooks = async (): Promise<Webhook[]> => {
+  const response = await fetch("/api/webhooks/", {
+    method: "GET",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to fetch webhooks: ${response.statusText}`);
+  }
+
+  const data: { webhooks: Webhook[] } = await response.json();
+  return data.webhooks;
+};
+
+// Register a webhook, the returned secret is shown only this once
+export const createWebhook = async (req: WebhookRequest): Promise<Webhook> => {
+  const response = await fetch("/api/webhooks/", {
+    method: "POST",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    body: JSON.stringify(req),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to create webhook: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+export const updateWebhook = async (
+  id: number,
+  req: WebhookRequest,
+): Promise<Webhook> => {
+  const response = await fetch(`/api/webhooks/${id}`, {
+    method: "PUT",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    body: JSON.stringify(req),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to update webhook: ${response.statusText}`);
+  }
+
+  return response.json();
+};
+
+export const deleteWebhook = async (id: number): Promise<void> => {
+  const response = await fetch(`/api/webhooks/${id}`, {
+    method: "DELETE",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to delete webhook: ${response.statusText}`);
+  }
+};
+
+// Send a ping event and report how the receiver answered
+export const testWebhook = async (id: number): Promise<WebhookTestResult> => {
+  const response = await fetch(`/api/webhooks/${id}/test`, {
+    method: "POST",
+    headers: getHeaders({
+      "Content-Type": "application/json",
+    }),
+    credentials: "include",
+  });
+
+  if (!response.ok) {
+    throw new Error(`Failed to test webhook: ${response.statusText}`);
+  }
+
+  return response.json();
+};
@@ -846,4 +846,16 @@ export class ClientConversationManager {
   handleExternalDelete(conversationId: string): void {
     this.conversations.delete(conversationId);
   }
+
+  // Number of answers in a conversation the user has not seen yet
+  getUnread(conversationId: string): number {
+    return this.conversations.get(conversationId)?.backendConversation?.unread || 0;
+  }
+
+  setUnread(conversationId: string, unread: number): void {
+    const backendConv = this.conversations.get(conversationId)?.backendConversation;
+    if (backendConv) {
+      backendConv.unread = unread;
+    }
+  }
 }